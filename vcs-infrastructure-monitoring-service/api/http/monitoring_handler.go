@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -30,6 +31,7 @@ func (h *MonitoringHandler) RegisterRoutes(r *gin.RouterGroup) {
 		monitoring.GET("/metrics/:instance_id/history", h.GetHistoricalMetrics)
 		monitoring.GET("/metrics/:instance_id/aggregate", h.GetAggregatedMetrics)
 		monitoring.GET("/logs/:instance_id", h.GetLogs)
+		monitoring.GET("/nginx/:instance_id/analytics", h.GetAccessLogAnalytics)
 		monitoring.GET("/health/:instance_id", h.GetHealthStatus)
 		monitoring.GET("/infrastructure", h.ListInfrastructure)
 	}
@@ -153,6 +155,38 @@ func (h *MonitoringHandler) GetAggregatedMetrics(c *gin.Context) {
 	})
 }
 
+func (h *MonitoringHandler) GetAccessLogAnalytics(c *gin.Context) {
+	instanceID := c.Param("instance_id")
+	timeRange := c.DefaultQuery("range", "1h")
+
+	analytics, err := h.metricsService.GetAccessLogAnalytics(c.Request.Context(), instanceID, timeRange)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidTimeRange) {
+			c.JSON(http.StatusBadRequest, dto.APIResponse{
+				Success: false,
+				Code:    "BAD_REQUEST",
+				Message: "Invalid time range",
+				Error:   err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to get access log analytics",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Access log analytics retrieved successfully",
+		Data:    analytics,
+	})
+}
+
 func (h *MonitoringHandler) ListInfrastructure(c *gin.Context) {
 	keys, err := h.redisClient.Keys(c.Request.Context(), "infra:container:*").Result()
 	if err != nil {
@@ -3,6 +3,7 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -51,6 +52,14 @@ func (m *MockMetricsService) AggregateMetrics(ctx context.Context, instanceID st
 	return args.Get(0).(*dto.AggregatedMetricsResponse), args.Error(1)
 }
 
+func (m *MockMetricsService) GetAccessLogAnalytics(ctx context.Context, instanceID string, timeRange string) (*dto.NginxAccessAnalyticsResponse, error) {
+	args := m.Called(ctx, instanceID, timeRange)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dto.NginxAccessAnalyticsResponse), args.Error(1)
+}
+
 var _ services.IMetricsService = (*MockMetricsService)(nil)
 
 func TestGetCurrentMetrics_Success(t *testing.T) {
@@ -409,3 +418,65 @@ func TestGetLogs_WithQueryParams(t *testing.T) {
 
 	mockService.AssertExpectations(t)
 }
+
+func TestGetAccessLogAnalytics_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := new(MockMetricsService)
+	mockRedis := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	handler := NewMonitoringHandler(mockService, mockRedis)
+
+	expected := &dto.NginxAccessAnalyticsResponse{
+		InstanceID: "nginx-1",
+		TimeRange:  "24h",
+		Overall: dto.NginxAccessAnalytics{
+			Requests:    200,
+			ErrorRate:   0.05,
+			StatusCodes: map[string]int64{"200": 190, "502": 10},
+			TopPaths:    []dto.PathRequestCount{{Path: "/api", Requests: 150}},
+			LatencyMs:   dto.LatencyPercentiles{P50: 12, P95: 80, P99: 250},
+		},
+	}
+
+	mockService.On("GetAccessLogAnalytics", mock.Anything, "nginx-1", "24h").Return(expected, nil)
+
+	router := gin.New()
+	router.GET("/monitoring/nginx/:instance_id/analytics", handler.GetAccessLogAnalytics)
+
+	req, _ := http.NewRequest("GET", "/monitoring/nginx/nginx-1/analytics?range=24h", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response dto.APIResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.True(t, response.Success)
+	assert.Equal(t, "SUCCESS", response.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestGetAccessLogAnalytics_InvalidRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := new(MockMetricsService)
+	mockRedis := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	handler := NewMonitoringHandler(mockService, mockRedis)
+
+	mockService.On("GetAccessLogAnalytics", mock.Anything, "nginx-1", "2y").
+		Return(nil, fmt.Errorf("%w %q", services.ErrInvalidTimeRange, "2y"))
+
+	router := gin.New()
+	router.GET("/monitoring/nginx/:instance_id/analytics", handler.GetAccessLogAnalytics)
+
+	req, _ := http.NewRequest("GET", "/monitoring/nginx/nginx-1/analytics?range=2y", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mockService.AssertExpectations(t)
+}
@@ -44,6 +44,35 @@ type NginxMetricsResponse struct {
 	RequestsPerSecond float64 `json:"requests_per_second,omitempty"`
 }
 
+type NginxAccessAnalyticsResponse struct {
+	InstanceID   string                 `json:"instance_id"`
+	TimeRange    string                 `json:"time_range"`
+	Overall      NginxAccessAnalytics   `json:"overall"`
+	ServerBlocks []NginxAccessAnalytics `json:"server_blocks"`
+}
+
+// NginxAccessAnalytics summarises the requests of one server block, or all of them
+// when ServerName is empty. ErrorRate is the share of 5xx responses.
+type NginxAccessAnalytics struct {
+	ServerName  string             `json:"server_name,omitempty"`
+	Requests    int64              `json:"requests"`
+	ErrorRate   float64            `json:"error_rate"`
+	StatusCodes map[string]int64   `json:"status_codes"`
+	TopPaths    []PathRequestCount `json:"top_paths"`
+	LatencyMs   LatencyPercentiles `json:"latency_ms"`
+}
+
+type PathRequestCount struct {
+	Path     string `json:"path"`
+	Requests int64  `json:"requests"`
+}
+
+type LatencyPercentiles struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+}
+
 type AggregatedMetricsResponse struct {
 	InstanceID    string                   `json:"instance_id"`
 	TimeRange     string                   `json:"time_range"`
@@ -0,0 +1,256 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"go.uber.org/zap"
+)
+
+const accessLogTopPaths = 10
+
+// AccessLogEntry is one request served by an Nginx instance or cluster node
+type AccessLogEntry struct {
+	InstanceID     string    `json:"instance_id"`
+	Timestamp      time.Time `json:"timestamp"`
+	Node           string    `json:"node,omitempty"`
+	ServerName     string    `json:"server_name"`
+	Host           string    `json:"host"`
+	ClientIP       string    `json:"client_ip"`
+	Method         string    `json:"method"`
+	Path           string    `json:"path"`
+	Status         int       `json:"status"`
+	BytesSent      int64     `json:"bytes_sent"`
+	RequestTimeMs  float64   `json:"request_time_ms"`
+	UpstreamTimeMs float64   `json:"upstream_time_ms"`
+	UpstreamAddr   string    `json:"upstream_addr,omitempty"`
+	UserAgent      string    `json:"user_agent,omitempty"`
+}
+
+// AccessLogStats summarises requests overall and per server block
+type AccessLogStats struct {
+	Overall      AccessLogBucket
+	ServerBlocks []AccessLogBucket
+}
+
+type AccessLogBucket struct {
+	ServerName  string
+	Requests    int64
+	Errors      int64 // responses with a 5xx status
+	StatusCodes map[string]int64
+	TopPaths    []AccessLogPathCount
+	LatencyP50  float64
+	LatencyP95  float64
+	LatencyP99  float64
+}
+
+type AccessLogPathCount struct {
+	Path     string
+	Requests int64
+}
+
+// IndexAccessLogs bulk-indexes entries into the daily nginx-access index of their timestamp
+func (es *elasticsearchClient) IndexAccessLogs(ctx context.Context, entries []AccessLogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	for _, entry := range entries {
+		if entry.Timestamp.IsZero() {
+			entry.Timestamp = time.Now()
+		}
+		meta := fmt.Sprintf(`{"index":{"_index":"nginx-access-%s"}}`, entry.Timestamp.UTC().Format("2006.01.02"))
+		data, err := json.Marshal(entry)
+		if err != nil {
+			es.logger.Error("failed to marshal access log entry", zap.Error(err))
+			return err
+		}
+		body.WriteString(meta)
+		body.WriteByte('\n')
+		body.Write(data)
+		body.WriteByte('\n')
+	}
+
+	req := esapi.BulkRequest{Body: &body}
+	res, err := req.Do(ctx, es.client)
+	if err != nil {
+		es.logger.Error("failed to index access logs", zap.Error(err))
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		es.logger.Error("elasticsearch error", zap.String("status", res.Status()))
+		return fmt.Errorf("elasticsearch error: %s", res.Status())
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err == nil && result.Errors {
+		es.logger.Warn("some access log entries were rejected", zap.Int("entries", len(entries)))
+	}
+
+	es.logger.Debug("access logs indexed successfully", zap.Int("entries", len(entries)))
+	return nil
+}
+
+// QueryAccessLogStats aggregates the requests of an instance since the given time
+func (es *elasticsearchClient) QueryAccessLogStats(ctx context.Context, instanceID string, since time.Time) (*AccessLogStats, error) {
+	queryBytes, err := json.Marshal(accessLogStatsQuery(instanceID, since))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := es.client.Search(
+		es.client.Search.WithContext(ctx),
+		es.client.Search.WithIndex("nginx-access-*"),
+		es.client.Search.WithBody(bytes.NewReader(queryBytes)),
+		es.client.Search.WithIgnoreUnavailable(true),
+	)
+	if err != nil {
+		es.logger.Error("failed to search access logs", zap.Error(err))
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch error: %s", res.Status())
+	}
+
+	return parseAccessLogStats(res.Body)
+}
+
+func accessLogStatsQuery(instanceID string, since time.Time) map[string]interface{} {
+	breakdown := map[string]interface{}{
+		"status_codes": map[string]interface{}{
+			"terms": map[string]interface{}{"field": "status", "size": 100},
+		},
+		"top_paths": map[string]interface{}{
+			"terms": map[string]interface{}{"field": "path.keyword", "size": accessLogTopPaths},
+		},
+		"latency": map[string]interface{}{
+			"percentiles": map[string]interface{}{"field": "request_time_ms", "percents": []float64{50, 95, 99}},
+		},
+		"errors": map[string]interface{}{
+			"filter": map[string]interface{}{"range": map[string]interface{}{"status": map[string]interface{}{"gte": 500}}},
+		},
+	}
+
+	aggs := map[string]interface{}{
+		"server_blocks": map[string]interface{}{
+			"terms": map[string]interface{}{"field": "server_name.keyword", "size": 50},
+			"aggs":  breakdown,
+		},
+	}
+	for name, agg := range breakdown {
+		aggs[name] = agg
+	}
+
+	return map[string]interface{}{
+		"size":             0,
+		"track_total_hits": true,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []map[string]interface{}{
+					{"term": map[string]interface{}{"instance_id.keyword": instanceID}},
+					{"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": since.UTC().Format(time.RFC3339)}}},
+				},
+			},
+		},
+		"aggs": aggs,
+	}
+}
+
+type termsAggregation struct {
+	Buckets []struct {
+		Key      json.RawMessage `json:"key"`
+		DocCount int64           `json:"doc_count"`
+	} `json:"buckets"`
+}
+
+type accessLogAggregations struct {
+	StatusCodes termsAggregation `json:"status_codes"`
+	TopPaths    termsAggregation `json:"top_paths"`
+	Latency     struct {
+		Values map[string]*float64 `json:"values"`
+	} `json:"latency"`
+	Errors struct {
+		DocCount int64 `json:"doc_count"`
+	} `json:"errors"`
+}
+
+func (a accessLogAggregations) bucket(serverName string, requests int64) AccessLogBucket {
+	bucket := AccessLogBucket{
+		ServerName:  serverName,
+		Requests:    requests,
+		Errors:      a.Errors.DocCount,
+		StatusCodes: make(map[string]int64, len(a.StatusCodes.Buckets)),
+		TopPaths:    make([]AccessLogPathCount, 0, len(a.TopPaths.Buckets)),
+	}
+	for _, b := range a.StatusCodes.Buckets {
+		bucket.StatusCodes[bucketKey(b.Key)] = b.DocCount
+	}
+	for _, b := range a.TopPaths.Buckets {
+		bucket.TopPaths = append(bucket.TopPaths, AccessLogPathCount{Path: bucketKey(b.Key), Requests: b.DocCount})
+	}
+	percentile := func(key string) float64 {
+		if value := a.Latency.Values[key]; value != nil {
+			return *value
+		}
+		return 0
+	}
+	bucket.LatencyP50 = percentile("50.0")
+	bucket.LatencyP95 = percentile("95.0")
+	bucket.LatencyP99 = percentile("99.0")
+	return bucket
+}
+
+// bucketKey renders a terms bucket key, which is a JSON string or number
+func bucketKey(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return strings.TrimSuffix(string(raw), ".0")
+}
+
+func parseAccessLogStats(body io.Reader) (*AccessLogStats, error) {
+	var result struct {
+		Hits struct {
+			Total struct {
+				Value int64 `json:"value"`
+			} `json:"total"`
+		} `json:"hits"`
+		Aggregations struct {
+			accessLogAggregations
+			ServerBlocks struct {
+				Buckets []struct {
+					accessLogAggregations
+					Key      string `json:"key"`
+					DocCount int64  `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"server_blocks"`
+		} `json:"aggregations"`
+	}
+	if err := json.NewDecoder(body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	aggs := result.Aggregations
+	stats := &AccessLogStats{
+		Overall:      aggs.accessLogAggregations.bucket("", result.Hits.Total.Value),
+		ServerBlocks: make([]AccessLogBucket, 0, len(aggs.ServerBlocks.Buckets)),
+	}
+	for _, b := range aggs.ServerBlocks.Buckets {
+		stats.ServerBlocks = append(stats.ServerBlocks, b.accessLogAggregations.bucket(b.Key, b.DocCount))
+	}
+	return stats, nil
+}
@@ -0,0 +1,41 @@
+package elasticsearch
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAccessLogStats(t *testing.T) {
+	body := `{
+		"hits": {"total": {"value": 120}},
+		"aggregations": {
+			"status_codes": {"buckets": [{"key": 200, "doc_count": 110}, {"key": 502, "doc_count": 10}]},
+			"top_paths": {"buckets": [{"key": "/api", "doc_count": 90}]},
+			"latency": {"values": {"50.0": 12.5, "95.0": 80, "99.0": 250}},
+			"errors": {"doc_count": 10},
+			"server_blocks": {"buckets": [{
+				"key": "example.com", "doc_count": 20,
+				"status_codes": {"buckets": [{"key": 200, "doc_count": 20}]},
+				"top_paths": {"buckets": []},
+				"latency": {"values": {"50.0": null, "95.0": null, "99.0": null}},
+				"errors": {"doc_count": 0}
+			}]}
+		}
+	}`
+
+	stats, err := parseAccessLogStats(strings.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(120), stats.Overall.Requests)
+	assert.Equal(t, int64(10), stats.Overall.Errors)
+	assert.Equal(t, map[string]int64{"200": 110, "502": 10}, stats.Overall.StatusCodes)
+	assert.Equal(t, []AccessLogPathCount{{Path: "/api", Requests: 90}}, stats.Overall.TopPaths)
+	assert.Equal(t, 12.5, stats.Overall.LatencyP50)
+	assert.Equal(t, 250.0, stats.Overall.LatencyP99)
+
+	assert.Len(t, stats.ServerBlocks, 1)
+	assert.Equal(t, "example.com", stats.ServerBlocks[0].ServerName)
+	assert.Equal(t, int64(20), stats.ServerBlocks[0].Requests)
+	assert.Zero(t, stats.ServerBlocks[0].LatencyP95)
+}
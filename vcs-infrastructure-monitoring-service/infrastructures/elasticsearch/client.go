@@ -19,6 +19,8 @@ type IElasticsearchClient interface {
 	IndexMetric(ctx context.Context, metric MetricEntry) error
 	QueryLogs(ctx context.Context, instanceID string, from, size int) ([]LogEntry, error)
 	QueryMetrics(ctx context.Context, instanceID string, from, size int) ([]MetricEntry, error)
+	IndexAccessLogs(ctx context.Context, entries []AccessLogEntry) error
+	QueryAccessLogStats(ctx context.Context, instanceID string, since time.Time) (*AccessLogStats, error)
 }
 
 type LogEntry struct {
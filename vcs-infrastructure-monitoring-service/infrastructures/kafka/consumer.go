@@ -26,6 +26,13 @@ type InfrastructureEvent struct {
 	Metadata   map[string]interface{} `json:"metadata"`
 }
 
+const (
+	// nginxMetricsAction events carry stub_status counters scraped by the provisioning service
+	nginxMetricsAction = "nginx.metrics"
+	// nginxAccessLogAction events carry a batch of parsed Nginx access log entries
+	nginxAccessLogAction = "nginx.access_log"
+)
+
 type kafkaConsumer struct {
 	readers  []*kafka.Reader
 	esClient elasticsearch.IElasticsearchClient
@@ -88,13 +95,32 @@ func (kc *kafkaConsumer) consumeMessages(ctx context.Context, reader *kafka.Read
 				zap.String("instance_id", event.InstanceID),
 				zap.String("action", event.Action))
 
+			if event.Action == nginxAccessLogAction {
+				entries, err := accessLogEntries(event)
+				if err != nil {
+					kc.logger.Error("failed to decode access log entries", zap.Error(err))
+					continue
+				}
+				if err := kc.esClient.IndexAccessLogs(ctx, entries); err != nil {
+					kc.logger.Error("failed to index access logs", zap.Error(err))
+				}
+				continue
+			}
+
+			if event.Action == nginxMetricsAction {
+				if err := kc.esClient.IndexMetric(ctx, nginxMetricEntry(event)); err != nil {
+					kc.logger.Error("failed to index nginx metric", zap.Error(err))
+				}
+				continue
+			}
+
 			logEntry := elasticsearch.LogEntry{
 				InstanceID: event.InstanceID,
 				UserID:     event.UserID,
 				Type:       event.Type,
 				Action:     event.Action,
 				Message:    fmt.Sprintf("%s %s", event.Type, event.Action),
-				Level:      "info",
+				Level:      eventLevel(event),
 				Metadata:   event.Metadata,
 			}
 
@@ -109,6 +135,49 @@ func (kc *kafkaConsumer) consumeMessages(ctx context.Context, reader *kafka.Read
 	}
 }
 
+// nginxMetricEntry stores the scraped counters in the metric index next to container stats
+func nginxMetricEntry(event InfrastructureEvent) elasticsearch.MetricEntry {
+	metadata := make(map[string]interface{}, len(event.Metadata)+1)
+	for key, value := range event.Metadata {
+		metadata[key] = value
+	}
+	metadata["source"] = event.Type
+	return elasticsearch.MetricEntry{
+		InstanceID: event.InstanceID,
+		Metadata:   metadata,
+	}
+}
+
+// accessLogEntries decodes the entries of an access log event and tags them with its instance
+func accessLogEntries(event InfrastructureEvent) ([]elasticsearch.AccessLogEntry, error) {
+	data, err := json.Marshal(event.Metadata["entries"])
+	if err != nil {
+		return nil, err
+	}
+	var entries []elasticsearch.AccessLogEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].InstanceID = event.InstanceID
+	}
+	return entries, nil
+}
+
+// eventLevel raises events that need operator attention above info so they can be alerted on
+func eventLevel(event InfrastructureEvent) string {
+	switch event.Action {
+	case "certificate.expiring":
+		if expired, _ := event.Metadata["expired"].(bool); expired {
+			return "error"
+		}
+		return "warning"
+	case "waf.blocked", "waf.detected", "docker_service.unhealthy", "docker_service.scale_failed":
+		return "warning"
+	}
+	return "info"
+}
+
 func (kc *kafkaConsumer) Close() error {
 	for _, reader := range kc.readers {
 		if err := reader.Close(); err != nil {
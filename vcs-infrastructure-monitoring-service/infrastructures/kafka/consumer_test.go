@@ -37,6 +37,19 @@ func (m *MockElasticsearchClient) QueryMetrics(ctx context.Context, instanceID s
 	return args.Get(0).([]elasticsearch.MetricEntry), args.Error(1)
 }
 
+func (m *MockElasticsearchClient) IndexAccessLogs(ctx context.Context, entries []elasticsearch.AccessLogEntry) error {
+	args := m.Called(ctx, entries)
+	return args.Error(0)
+}
+
+func (m *MockElasticsearchClient) QueryAccessLogStats(ctx context.Context, instanceID string, since time.Time) (*elasticsearch.AccessLogStats, error) {
+	args := m.Called(ctx, instanceID, since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*elasticsearch.AccessLogStats), args.Error(1)
+}
+
 type MockLogger struct{}
 
 func (m *MockLogger) Debug(msg string, fields ...zap.Field)                  {}
@@ -108,3 +121,62 @@ func TestInfrastructureEvent_Structure(t *testing.T) {
 	assert.NotNil(t, event.Metadata)
 }
 
+
+func TestNginxMetricEntry(t *testing.T) {
+	event := InfrastructureEvent{
+		InstanceID: "nginx-1",
+		Type:       "nginx",
+		Action:     nginxMetricsAction,
+		Metadata: map[string]interface{}{
+			"active_connections":  float64(3),
+			"requests":            float64(120),
+			"requests_per_second": 2.5,
+		},
+	}
+
+	entry := nginxMetricEntry(event)
+	assert.Equal(t, "nginx-1", entry.InstanceID)
+	assert.Equal(t, float64(3), entry.Metadata["active_connections"])
+	assert.Equal(t, 2.5, entry.Metadata["requests_per_second"])
+	assert.Equal(t, "nginx", entry.Metadata["source"])
+	assert.NotContains(t, event.Metadata, "source")
+}
+
+func TestAccessLogEntries(t *testing.T) {
+	event := InfrastructureEvent{
+		InstanceID: "nginx-1",
+		Action:     nginxAccessLogAction,
+		Metadata: map[string]interface{}{
+			"entries": []interface{}{
+				map[string]interface{}{
+					"timestamp":       "2025-03-01T10:00:00.5Z",
+					"server_name":     "example.com",
+					"path":            "/api",
+					"status":          float64(502),
+					"request_time_ms": 12.5,
+				},
+			},
+		},
+	}
+
+	entries, err := accessLogEntries(event)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "nginx-1", entries[0].InstanceID)
+	assert.Equal(t, "example.com", entries[0].ServerName)
+	assert.Equal(t, 502, entries[0].Status)
+	assert.Equal(t, 12.5, entries[0].RequestTimeMs)
+	assert.Equal(t, time.Date(2025, 3, 1, 10, 0, 0, 500000000, time.UTC), entries[0].Timestamp)
+}
+
+func TestEventLevel(t *testing.T) {
+	assert.Equal(t, "info", eventLevel(InfrastructureEvent{Action: "created"}))
+	assert.Equal(t, "warning", eventLevel(InfrastructureEvent{Action: "waf.blocked"}))
+	assert.Equal(t, "warning", eventLevel(InfrastructureEvent{Action: "waf.detected"}))
+	assert.Equal(t, "warning", eventLevel(InfrastructureEvent{Action: "docker_service.unhealthy"}))
+	assert.Equal(t, "info", eventLevel(InfrastructureEvent{Action: "docker_service.healthy"}))
+	assert.Equal(t, "warning", eventLevel(InfrastructureEvent{Action: "docker_service.scale_failed"}))
+	assert.Equal(t, "info", eventLevel(InfrastructureEvent{Action: "docker_service.scaled"}))
+	assert.Equal(t, "warning", eventLevel(InfrastructureEvent{Action: "certificate.expiring"}))
+	assert.Equal(t, "error", eventLevel(InfrastructureEvent{Action: "certificate.expiring", Metadata: map[string]interface{}{"expired": true}}))
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-monitoring-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-monitoring-service/infrastructures/elasticsearch"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidTimeRange is returned for a time range outside accessLogRanges
+var ErrInvalidTimeRange = errors.New("invalid time range")
+
+var accessLogRanges = map[string]time.Duration{
+	"15m": 15 * time.Minute,
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
+// GetAccessLogAnalytics reports top paths, status codes, latency percentiles and error
+// rate of an Nginx instance or cluster, overall and per server block
+func (ms *metricsService) GetAccessLogAnalytics(ctx context.Context, instanceID string, timeRange string) (*dto.NginxAccessAnalyticsResponse, error) {
+	if timeRange == "" {
+		timeRange = "1h"
+	}
+	window, ok := accessLogRanges[timeRange]
+	if !ok {
+		return nil, fmt.Errorf("%w %q, use 15m, 1h, 24h or 7d", ErrInvalidTimeRange, timeRange)
+	}
+
+	stats, err := ms.esClient.QueryAccessLogStats(ctx, instanceID, time.Now().Add(-window))
+	if err != nil {
+		ms.logger.Error("failed to query access log stats", zap.Error(err))
+		return nil, err
+	}
+
+	resp := &dto.NginxAccessAnalyticsResponse{
+		InstanceID:   instanceID,
+		TimeRange:    timeRange,
+		Overall:      toAccessAnalytics(stats.Overall),
+		ServerBlocks: make([]dto.NginxAccessAnalytics, 0, len(stats.ServerBlocks)),
+	}
+	for _, block := range stats.ServerBlocks {
+		resp.ServerBlocks = append(resp.ServerBlocks, toAccessAnalytics(block))
+	}
+	return resp, nil
+}
+
+func toAccessAnalytics(bucket elasticsearch.AccessLogBucket) dto.NginxAccessAnalytics {
+	analytics := dto.NginxAccessAnalytics{
+		ServerName:  bucket.ServerName,
+		Requests:    bucket.Requests,
+		StatusCodes: bucket.StatusCodes,
+		TopPaths:    make([]dto.PathRequestCount, 0, len(bucket.TopPaths)),
+		LatencyMs: dto.LatencyPercentiles{
+			P50: bucket.LatencyP50,
+			P95: bucket.LatencyP95,
+			P99: bucket.LatencyP99,
+		},
+	}
+	if bucket.Requests > 0 {
+		analytics.ErrorRate = float64(bucket.Errors) / float64(bucket.Requests)
+	}
+	for _, path := range bucket.TopPaths {
+		analytics.TopPaths = append(analytics.TopPaths, dto.PathRequestCount{Path: path.Path, Requests: path.Requests})
+	}
+	return analytics
+}
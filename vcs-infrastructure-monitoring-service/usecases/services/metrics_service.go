@@ -14,6 +14,7 @@ type IMetricsService interface {
 	GetHistoricalMetrics(ctx context.Context, instanceID string, from, size int) ([]dto.MetricsResponse, error)
 	GetLogs(ctx context.Context, instanceID string, from, size int) ([]dto.LogsResponse, error)
 	AggregateMetrics(ctx context.Context, instanceID string, timeRange string) (*dto.AggregatedMetricsResponse, error)
+	GetAccessLogAnalytics(ctx context.Context, instanceID string, timeRange string) (*dto.NginxAccessAnalyticsResponse, error)
 }
 
 type metricsService struct {
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/services"
+	"github.com/gin-gonic/gin"
+)
+
+type CertificateHandler struct {
+	inventoryService services.ICertificateInventoryService
+}
+
+func NewCertificateHandler(inventoryService services.ICertificateInventoryService) *CertificateHandler {
+	return &CertificateHandler{inventoryService: inventoryService}
+}
+
+func (h *CertificateHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("/nginx/certificates", h.ListCertificates)
+}
+
+// ListCertificates returns the certificate inventory of the user's Nginx resources
+// @Summary List Certificates
+// @Tags Nginx
+// @Param expiring_within_days query int false "Expiry window in days"
+// @Param expiring_only query bool false "Only return expiring or expired certificates"
+// @Success 200 {object} dto.APIResponse{data=dto.CertificateInventoryResponse}
+// @Router /api/v1/nginx/certificates [get]
+func (h *CertificateHandler) ListCertificates(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, dto.APIResponse{
+			Success: false,
+			Code:    "UNAUTHORIZED",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	days := 0
+	if value := c.Query("expiring_within_days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, dto.APIResponse{
+				Success: false,
+				Code:    "BAD_REQUEST",
+				Message: "Invalid expiring_within_days",
+			})
+			return
+		}
+		days = parsed
+	}
+	expiringOnly, _ := strconv.ParseBool(c.Query("expiring_only"))
+
+	inventory, err := h.inventoryService.ListCertificates(c.Request.Context(), userID, days, expiringOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to list certificates",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Certificates retrieved successfully",
+		Data:    inventory,
+	})
+}
@@ -0,0 +1,592 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/services"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type DockerServiceHandler struct {
+	dockerService services.IDockerServiceService
+	autoscaler    services.IDockerAutoscalerService
+	logger        logger.ILogger
+}
+
+func NewDockerServiceHandler(dockerService services.IDockerServiceService, autoscaler services.IDockerAutoscalerService, logger logger.ILogger) *DockerServiceHandler {
+	return &DockerServiceHandler{
+		dockerService: dockerService,
+		autoscaler:    autoscaler,
+		logger:        logger,
+	}
+}
+
+func (h *DockerServiceHandler) RegisterRoutes(r *gin.RouterGroup) {
+	dockerServices := r.Group("/docker-services", h.requireUser)
+	{
+		dockerServices.POST("", h.CreateDockerService)
+		dockerServices.GET("", h.ListDockerServices)
+
+		// Every route below acts on one service and is limited to its owner
+		service := dockerServices.Group("/:id", h.requireOwner)
+		service.GET("", h.GetDockerService)
+		service.PUT("", h.UpdateDockerService)
+		service.DELETE("", h.DeleteDockerService)
+		service.POST("/start", h.StartDockerService)
+		service.POST("/stop", h.StopDockerService)
+		service.POST("/restart", h.RestartDockerService)
+		service.PUT("/env", h.UpdateEnvVars)
+		service.PUT("/replicas", h.ScaleDockerService)
+		service.POST("/rollout", h.RollingUpdateDockerService)
+		service.POST("/volumes", h.AttachVolume)
+		service.DELETE("/volumes/:mountId", h.DetachVolume)
+		service.PUT("/autoscaling", h.SetAutoscaling)
+		service.GET("/autoscaling", h.GetAutoscaling)
+		service.DELETE("/autoscaling", h.DeleteAutoscaling)
+		service.GET("/logs", h.GetServiceLogs)
+	}
+}
+
+// requireUser rejects requests without an authenticated user
+func (h *DockerServiceHandler) requireUser(c *gin.Context) {
+	if c.GetString("user_id") == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, dto.APIResponse{
+			Success: false,
+			Code:    "UNAUTHORIZED",
+			Message: "User not authenticated",
+		})
+		return
+	}
+	c.Next()
+}
+
+// requireOwner answers 404 for unknown services and 403 for services of another user
+func (h *DockerServiceHandler) requireOwner(c *gin.Context) {
+	err := h.dockerService.AuthorizeDockerService(c.Request.Context(), c.GetString("user_id"), c.Param("id"))
+	if errors.Is(err, services.ErrDockerServiceForbidden) {
+		c.AbortWithStatusJSON(http.StatusForbidden, dto.APIResponse{
+			Success: false,
+			Code:    "FORBIDDEN",
+			Message: "Docker service belongs to another user",
+		})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Docker service not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+	c.Next()
+}
+
+// dockerServiceErrorStatus maps errors of the docker service layer to a status and code:
+// 400 for specs that cannot be run, 409 while the service is being scaled or rolled out
+func dockerServiceErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidDockerService),
+		errors.Is(err, services.ErrInvalidDockerServiceUpdate),
+		errors.Is(err, services.ErrInvalidVolumeMount),
+		errors.Is(err, services.ErrRegistryCredentialNotFound):
+		return http.StatusBadRequest, "INVALID_REQUEST"
+	case errors.Is(err, services.ErrDockerVolumeMountNotFound):
+		return http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, services.ErrDockerServiceBusy):
+		return http.StatusConflict, "CONFLICT"
+	}
+	return http.StatusInternalServerError, "INTERNAL_SERVER_ERROR"
+}
+
+// CreateDockerService creates a standalone Docker service
+// @Summary Create Docker Service
+// @Description Run a single application container outside of a stack
+// @Tags DockerService
+// @Accept json
+// @Produce json
+// @Param request body dto.CreateDockerServiceRequest true "Service configuration"
+// @Success 201 {object} dto.APIResponse
+// @Failure 400 {object} dto.APIResponse
+// @Failure 500 {object} dto.APIResponse
+// @Router /docker-services [post]
+func (h *DockerServiceHandler) CreateDockerService(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req dto.CreateDockerServiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	h.logger.Info("creating docker service",
+		zap.String("name", req.Name),
+		zap.String("image", req.Image),
+		zap.String("user_id", userID))
+
+	service, err := h.dockerService.CreateDockerService(c.Request.Context(), userID, req)
+	if err != nil {
+		h.logger.Error("failed to create docker service", zap.Error(err))
+		status, code := dockerServiceErrorStatus(err)
+		c.JSON(status, dto.APIResponse{
+			Success: false,
+			Code:    code,
+			Message: "Failed to create docker service",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Docker service created successfully",
+		Data:    service,
+	})
+}
+
+// ListDockerServices lists the user's Docker services, filtered by status, service_type, name, image or
+// health, e.g. health=unhealthy
+func (h *DockerServiceHandler) ListDockerServices(c *gin.Context) {
+	var req dto.ListDockerServicesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid query parameters",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.dockerService.ListDockerServices(c.Request.Context(), c.GetString("user_id"), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to list docker services",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Docker services retrieved successfully",
+		Data:    result,
+	})
+}
+
+// GetDockerService gets a Docker service by service ID or infrastructure ID
+func (h *DockerServiceHandler) GetDockerService(c *gin.Context) {
+	service, err := h.dockerService.GetDockerService(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to get docker service",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Docker service retrieved successfully",
+		Data:    service,
+	})
+}
+
+func (h *DockerServiceHandler) StartDockerService(c *gin.Context) {
+	if err := h.dockerService.StartDockerService(c.Request.Context(), c.Param("id")); err != nil {
+		status, code := dockerServiceErrorStatus(err)
+		c.JSON(status, dto.APIResponse{
+			Success: false,
+			Code:    code,
+			Message: "Failed to start docker service",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Docker service started successfully",
+	})
+}
+
+func (h *DockerServiceHandler) StopDockerService(c *gin.Context) {
+	if err := h.dockerService.StopDockerService(c.Request.Context(), c.Param("id")); err != nil {
+		status, code := dockerServiceErrorStatus(err)
+		c.JSON(status, dto.APIResponse{
+			Success: false,
+			Code:    code,
+			Message: "Failed to stop docker service",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Docker service stopped successfully",
+	})
+}
+
+func (h *DockerServiceHandler) RestartDockerService(c *gin.Context) {
+	if err := h.dockerService.RestartDockerService(c.Request.Context(), c.Param("id")); err != nil {
+		status, code := dockerServiceErrorStatus(err)
+		c.JSON(status, dto.APIResponse{
+			Success: false,
+			Code:    code,
+			Message: "Failed to restart docker service",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Docker service restarted successfully",
+	})
+}
+
+func (h *DockerServiceHandler) DeleteDockerService(c *gin.Context) {
+	if err := h.dockerService.DeleteDockerService(c.Request.Context(), c.Param("id")); err != nil {
+		status, code := dockerServiceErrorStatus(err)
+		c.JSON(status, dto.APIResponse{
+			Success: false,
+			Code:    code,
+			Message: "Failed to delete docker service",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Docker service deleted successfully",
+	})
+}
+
+// UpdateEnvVars replaces the environment variables through a rolling update of the replicas
+func (h *DockerServiceHandler) UpdateEnvVars(c *gin.Context) {
+	var req dto.UpdateDockerEnvRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err := h.dockerService.UpdateEnvVars(c.Request.Context(), c.Param("id"), req); err != nil {
+		status, code := dockerServiceErrorStatus(err)
+		c.JSON(status, dto.APIResponse{
+			Success: false,
+			Code:    code,
+			Message: "Failed to update environment variables",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Environment variable rollout started",
+	})
+}
+
+// ScaleDockerService sets the number of replicas running behind the service alias
+func (h *DockerServiceHandler) ScaleDockerService(c *gin.Context) {
+	var req dto.ScaleDockerServiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	service, err := h.dockerService.ScaleDockerService(c.Request.Context(), c.Param("id"), req.Replicas)
+	if err != nil {
+		status, code := dockerServiceErrorStatus(err)
+		c.JSON(status, dto.APIResponse{
+			Success: false,
+			Code:    code,
+			Message: "Failed to scale docker service",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Docker service scaled successfully",
+		Data:    service,
+	})
+}
+
+// RollingUpdateDockerService starts a health-gated rolling update to a new image tag or env vars.
+// Progress and automatic rollbacks are reported in rollout_status of the service.
+func (h *DockerServiceHandler) RollingUpdateDockerService(c *gin.Context) {
+	var req dto.RollingUpdateDockerServiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	service, err := h.dockerService.RollingUpdateDockerService(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		status, code := dockerServiceErrorStatus(err)
+		c.JSON(status, dto.APIResponse{
+			Success: false,
+			Code:    code,
+			Message: "Failed to start rollout",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Rollout started",
+		Data:    service,
+	})
+}
+
+// UpdateDockerService recreates the replicas with a new image tag, plan, ports or command and
+// answers with the changes being rolled out
+func (h *DockerServiceHandler) UpdateDockerService(c *gin.Context) {
+	var req dto.UpdateDockerServiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	update, err := h.dockerService.UpdateDockerService(c.Request.Context(), c.Param("id"), req)
+	if errors.Is(err, services.ErrDockerServiceUnchanged) {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "NO_CHANGES",
+			Message: "Nothing to update",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		status, code := dockerServiceErrorStatus(err)
+		c.JSON(status, dto.APIResponse{
+			Success: false,
+			Code:    code,
+			Message: "Failed to update docker service",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Update started",
+		Data:    update,
+	})
+}
+
+// AttachVolume mounts a named volume or bind directory and rolls the replicas out with it
+func (h *DockerServiceHandler) AttachVolume(c *gin.Context) {
+	var req dto.VolumeMountInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	service, err := h.dockerService.AttachVolume(c.Request.Context(), c.GetString("user_id"), c.Param("id"), req)
+	if err != nil {
+		status, code := dockerServiceErrorStatus(err)
+		c.JSON(status, dto.APIResponse{
+			Success: false,
+			Code:    code,
+			Message: "Failed to attach volume",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Volume attach rollout started",
+		Data:    service,
+	})
+}
+
+// DetachVolume removes a mount and rolls the replicas out without it; the volume is kept
+func (h *DockerServiceHandler) DetachVolume(c *gin.Context) {
+	service, err := h.dockerService.DetachVolume(c.Request.Context(), c.Param("id"), c.Param("mountId"))
+	if err != nil {
+		status, code := dockerServiceErrorStatus(err)
+		c.JSON(status, dto.APIResponse{
+			Success: false,
+			Code:    code,
+			Message: "Failed to detach volume",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Volume detach rollout started",
+		Data:    service,
+	})
+}
+
+// SetAutoscaling creates or replaces the autoscaling policy of the service. Scaling decisions
+// are listed with the policy and fronting nginx upstreams follow the replicas.
+func (h *DockerServiceHandler) SetAutoscaling(c *gin.Context) {
+	var req dto.DockerAutoscalingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	autoscaling, err := h.autoscaler.SetAutoscaling(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Failed to set autoscaling",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Autoscaling updated successfully",
+		Data:    autoscaling,
+	})
+}
+
+// GetAutoscaling returns the autoscaling policy of the service with its latest scaling events
+func (h *DockerServiceHandler) GetAutoscaling(c *gin.Context) {
+	autoscaling, err := h.autoscaler.GetAutoscaling(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.autoscalingError(c, err, "Failed to get autoscaling")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Autoscaling retrieved successfully",
+		Data:    autoscaling,
+	})
+}
+
+// DeleteAutoscaling turns autoscaling off, leaving the service at its current replicas
+func (h *DockerServiceHandler) DeleteAutoscaling(c *gin.Context) {
+	if err := h.autoscaler.DeleteAutoscaling(c.Request.Context(), c.Param("id")); err != nil {
+		h.autoscalingError(c, err, "Failed to delete autoscaling")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Autoscaling deleted successfully",
+	})
+}
+
+func (h *DockerServiceHandler) autoscalingError(c *gin.Context, err error, message string) {
+	status, code := http.StatusInternalServerError, "INTERNAL_SERVER_ERROR"
+	if errors.Is(err, services.ErrDockerAutoscalingNotFound) {
+		status, code = http.StatusNotFound, "NOT_FOUND"
+	}
+	c.JSON(status, dto.APIResponse{
+		Success: false,
+		Code:    code,
+		Message: message,
+		Error:   err.Error(),
+	})
+}
+
+func (h *DockerServiceHandler) GetServiceLogs(c *gin.Context) {
+	var req dto.DockerServiceLogsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid query parameters",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if req.Tail <= 0 {
+		req.Tail = 100
+	}
+
+	logs, err := h.dockerService.GetServiceLogs(c.Request.Context(), c.Param("id"), req.Tail)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to get logs",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Logs retrieved successfully",
+		Data:    dto.DockerServiceLogsResponse{Logs: logs},
+	})
+}
@@ -0,0 +1,209 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockDockerServiceService mocks the calls the tests below make; others panic
+type MockDockerServiceService struct {
+	services.IDockerServiceService
+	mock.Mock
+}
+
+func (m *MockDockerServiceService) AuthorizeDockerService(ctx context.Context, userID, serviceID string) error {
+	args := m.Called(ctx, userID, serviceID)
+	return args.Error(0)
+}
+
+func (m *MockDockerServiceService) ListDockerServices(ctx context.Context, userID string, req dto.ListDockerServicesRequest) (*dto.DockerServiceListResponse, error) {
+	args := m.Called(ctx, userID, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dto.DockerServiceListResponse), args.Error(1)
+}
+
+func (m *MockDockerServiceService) StopDockerService(ctx context.Context, serviceID string) error {
+	args := m.Called(ctx, serviceID)
+	return args.Error(0)
+}
+
+func (m *MockDockerServiceService) UpdateDockerService(ctx context.Context, serviceID string, req dto.UpdateDockerServiceRequest) (*dto.UpdateDockerServiceResponse, error) {
+	args := m.Called(ctx, serviceID, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dto.UpdateDockerServiceResponse), args.Error(1)
+}
+
+func (m *MockDockerServiceService) ScaleDockerService(ctx context.Context, serviceID string, replicas int) (*dto.DockerServiceInfo, error) {
+	args := m.Called(ctx, serviceID, replicas)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dto.DockerServiceInfo), args.Error(1)
+}
+
+func (m *MockDockerServiceService) AttachVolume(ctx context.Context, userID, serviceID string, req dto.VolumeMountInput) (*dto.DockerServiceInfo, error) {
+	args := m.Called(ctx, userID, serviceID, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dto.DockerServiceInfo), args.Error(1)
+}
+
+func newDockerServiceRouter(handler *DockerServiceHandler, userID string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api := router.Group("/api/v1", func(c *gin.Context) {
+		if userID != "" {
+			c.Set("user_id", userID)
+		}
+	})
+	handler.RegisterRoutes(api)
+	return router
+}
+
+func TestListDockerServices_Filter(t *testing.T) {
+	mockService := new(MockDockerServiceService)
+	router := newDockerServiceRouter(NewDockerServiceHandler(mockService, nil, nil), "user-123")
+
+	expected := dto.ListDockerServicesRequest{Status: "running", Name: "api", Page: 2}
+	mockService.On("ListDockerServices", mock.Anything, "user-123", expected).
+		Return(&dto.DockerServiceListResponse{Services: []dto.DockerServiceInfo{{ID: "svc-1"}}, TotalCount: 1, Page: 2, PageSize: 20}, nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/docker-services?status=running&name=api&page=2", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestDockerServiceRoutes_Unauthenticated(t *testing.T) {
+	mockService := new(MockDockerServiceService)
+	router := newDockerServiceRouter(NewDockerServiceHandler(mockService, nil, nil), "")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/docker-services", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestDockerServiceRoutes_Ownership(t *testing.T) {
+	mockService := new(MockDockerServiceService)
+	router := newDockerServiceRouter(NewDockerServiceHandler(mockService, nil, nil), "user-123")
+
+	mockService.On("AuthorizeDockerService", mock.Anything, "user-123", "mine").Return(nil)
+	mockService.On("AuthorizeDockerService", mock.Anything, "user-123", "theirs").Return(services.ErrDockerServiceForbidden)
+	mockService.On("AuthorizeDockerService", mock.Anything, "user-123", "missing").Return(errors.New("record not found"))
+	mockService.On("StopDockerService", mock.Anything, "mine").Return(nil)
+
+	cases := map[string]int{
+		"mine":    http.StatusOK,
+		"theirs":  http.StatusForbidden,
+		"missing": http.StatusNotFound,
+	}
+	for id, status := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/docker-services/"+id+"/stop", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, status, w.Code, id)
+		var response dto.APIResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, status == http.StatusOK, response.Success, id)
+	}
+
+	mockService.AssertNotCalled(t, "StopDockerService", mock.Anything, "theirs")
+	mockService.AssertExpectations(t)
+}
+
+func TestUpdateDockerService_Errors(t *testing.T) {
+	mockService := new(MockDockerServiceService)
+	router := newDockerServiceRouter(NewDockerServiceHandler(mockService, nil, nil), "user-123")
+
+	mockService.On("AuthorizeDockerService", mock.Anything, "user-123", mock.Anything).Return(nil)
+	mockService.On("UpdateDockerService", mock.Anything, "invalid", mock.Anything).
+		Return(nil, fmt.Errorf("%w: replicated services cannot publish host ports", services.ErrInvalidDockerServiceUpdate))
+	mockService.On("UpdateDockerService", mock.Anything, "unchanged", mock.Anything).Return(nil, services.ErrDockerServiceUnchanged)
+	mockService.On("UpdateDockerService", mock.Anything, "busy", mock.Anything).Return(nil, fmt.Errorf("%w: busy", services.ErrDockerServiceBusy))
+	mockService.On("UpdateDockerService", mock.Anything, "broken", mock.Anything).Return(nil, errors.New("database is down"))
+
+	cases := map[string]int{
+		"invalid":   http.StatusBadRequest,
+		"unchanged": http.StatusBadRequest,
+		"busy":      http.StatusConflict,
+		"broken":    http.StatusInternalServerError,
+	}
+	for id, status := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/docker-services/"+id, strings.NewReader(`{"image_tag":"1.27"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, status, w.Code, id)
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestScaleDockerService_Errors(t *testing.T) {
+	mockService := new(MockDockerServiceService)
+	router := newDockerServiceRouter(NewDockerServiceHandler(mockService, nil, nil), "user-123")
+
+	mockService.On("AuthorizeDockerService", mock.Anything, "user-123", mock.Anything).Return(nil)
+	mockService.On("ScaleDockerService", mock.Anything, "invalid", 3).
+		Return(nil, fmt.Errorf("%w: replicated services cannot publish host ports", services.ErrInvalidDockerService))
+	mockService.On("ScaleDockerService", mock.Anything, "busy", 3).Return(nil, fmt.Errorf("%w: busy", services.ErrDockerServiceBusy))
+	mockService.On("ScaleDockerService", mock.Anything, "broken", 3).Return(nil, errors.New("database is down"))
+
+	cases := map[string]int{
+		"invalid": http.StatusBadRequest,
+		"busy":    http.StatusConflict,
+		"broken":  http.StatusInternalServerError,
+	}
+	for id, status := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/docker-services/"+id+"/replicas", strings.NewReader(`{"replicas":3}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, status, w.Code, id)
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestAttachVolume_Errors(t *testing.T) {
+	mockService := new(MockDockerServiceService)
+	router := newDockerServiceRouter(NewDockerServiceHandler(mockService, nil, nil), "user-123")
+
+	mockService.On("AuthorizeDockerService", mock.Anything, "user-123", mock.Anything).Return(nil)
+	mockService.On("AttachVolume", mock.Anything, "user-123", "invalid", mock.Anything).
+		Return(nil, fmt.Errorf("%w: two mounts target /data", services.ErrInvalidVolumeMount))
+	mockService.On("AttachVolume", mock.Anything, "user-123", "broken", mock.Anything).Return(nil, errors.New("docker is down"))
+
+	cases := map[string]int{
+		"invalid": http.StatusBadRequest,
+		"broken":  http.StatusInternalServerError,
+	}
+	for id, status := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/docker-services/"+id+"/volumes", strings.NewReader(`{"volume":"data","target":"/data"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, status, w.Code, id)
+	}
+	mockService.AssertExpectations(t)
+}
@@ -0,0 +1,211 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/services"
+	"github.com/gin-gonic/gin"
+)
+
+type DockerVolumeHandler struct {
+	volumeService services.IDockerVolumeService
+}
+
+func NewDockerVolumeHandler(volumeService services.IDockerVolumeService) *DockerVolumeHandler {
+	return &DockerVolumeHandler{volumeService: volumeService}
+}
+
+func (h *DockerVolumeHandler) RegisterRoutes(r *gin.RouterGroup) {
+	// Volumes are looked up within the authenticated user, by ID or name
+	volumes := r.Group("/volumes", h.requireUser)
+	volumes.POST("", h.CreateVolume)
+	volumes.GET("", h.ListVolumes)
+	volumes.GET("/:id", h.GetVolume)
+	volumes.DELETE("/:id", h.DeleteVolume)
+	volumes.POST("/:id/snapshots", h.CreateSnapshot)
+	volumes.GET("/:id/snapshots", h.ListSnapshots)
+	volumes.POST("/:id/snapshots/:snapshotId/restore", h.RestoreSnapshot)
+	volumes.DELETE("/:id/snapshots/:snapshotId", h.DeleteSnapshot)
+}
+
+// requireUser rejects requests without an authenticated user
+func (h *DockerVolumeHandler) requireUser(c *gin.Context) {
+	if c.GetString("user_id") == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, dto.APIResponse{
+			Success: false,
+			Code:    "UNAUTHORIZED",
+			Message: "User not authenticated",
+		})
+		return
+	}
+	c.Next()
+}
+
+// CreateVolume creates an empty named volume
+// @Summary Create Volume
+// @Tags Volumes
+// @Param request body dto.CreateDockerVolumeRequest true "Volume name"
+// @Success 201 {object} dto.APIResponse{data=dto.DockerVolumeInfo}
+// @Failure 409 {object} dto.APIResponse
+// @Router /api/v1/volumes [post]
+func (h *DockerVolumeHandler) CreateVolume(c *gin.Context) {
+	var req dto.CreateDockerVolumeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	volume, err := h.volumeService.CreateVolume(c.Request.Context(), c.GetString("user_id"), req)
+	if err != nil {
+		h.volumeError(c, err, "Failed to create volume")
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Volume created successfully",
+		Data:    volume,
+	})
+}
+
+// ListVolumes lists the user's volumes with their size and attachments
+func (h *DockerVolumeHandler) ListVolumes(c *gin.Context) {
+	volumes, err := h.volumeService.ListVolumes(c.Request.Context(), c.GetString("user_id"))
+	if err != nil {
+		h.volumeError(c, err, "Failed to list volumes")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Volumes retrieved successfully",
+		Data:    volumes,
+	})
+}
+
+func (h *DockerVolumeHandler) GetVolume(c *gin.Context) {
+	volume, err := h.volumeService.GetVolume(c.Request.Context(), c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		h.volumeError(c, err, "Failed to get volume")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Volume retrieved successfully",
+		Data:    volume,
+	})
+}
+
+// DeleteVolume deletes a volume no Docker service mounts, with its snapshots
+func (h *DockerVolumeHandler) DeleteVolume(c *gin.Context) {
+	if err := h.volumeService.DeleteVolume(c.Request.Context(), c.GetString("user_id"), c.Param("id")); err != nil {
+		h.volumeError(c, err, "Failed to delete volume")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Volume deleted successfully",
+	})
+}
+
+// CreateSnapshot archives the volume content through a helper container
+func (h *DockerVolumeHandler) CreateSnapshot(c *gin.Context) {
+	var req dto.CreateVolumeSnapshotRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.APIResponse{
+				Success: false,
+				Code:    "INVALID_REQUEST",
+				Message: "Invalid request body",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	snapshot, err := h.volumeService.CreateSnapshot(c.Request.Context(), c.GetString("user_id"), c.Param("id"), req)
+	if err != nil {
+		h.volumeError(c, err, "Failed to snapshot volume")
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Volume snapshot created successfully",
+		Data:    snapshot,
+	})
+}
+
+func (h *DockerVolumeHandler) ListSnapshots(c *gin.Context) {
+	snapshots, err := h.volumeService.ListSnapshots(c.Request.Context(), c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		h.volumeError(c, err, "Failed to list volume snapshots")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Volume snapshots retrieved successfully",
+		Data:    snapshots,
+	})
+}
+
+// RestoreSnapshot replaces the volume content with a snapshot; services mounting it must be stopped
+func (h *DockerVolumeHandler) RestoreSnapshot(c *gin.Context) {
+	snapshot, err := h.volumeService.RestoreSnapshot(c.Request.Context(), c.GetString("user_id"), c.Param("id"), c.Param("snapshotId"))
+	if err != nil {
+		h.volumeError(c, err, "Failed to restore volume")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Volume restored successfully",
+		Data:    snapshot,
+	})
+}
+
+func (h *DockerVolumeHandler) DeleteSnapshot(c *gin.Context) {
+	if err := h.volumeService.DeleteSnapshot(c.Request.Context(), c.GetString("user_id"), c.Param("id"), c.Param("snapshotId")); err != nil {
+		h.volumeError(c, err, "Failed to delete volume snapshot")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Volume snapshot deleted successfully",
+	})
+}
+
+func (h *DockerVolumeHandler) volumeError(c *gin.Context, err error, message string) {
+	status, code := http.StatusInternalServerError, "INTERNAL_SERVER_ERROR"
+	switch {
+	case errors.Is(err, services.ErrDockerVolumeNotFound), errors.Is(err, services.ErrDockerSnapshotNotFound):
+		status, code = http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, services.ErrDockerVolumeExists), errors.Is(err, services.ErrDockerVolumeInUse):
+		status, code = http.StatusConflict, "CONFLICT"
+	}
+	c.JSON(status, dto.APIResponse{
+		Success: false,
+		Code:    code,
+		Message: message,
+		Error:   err.Error(),
+	})
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/middlewares"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/secrets"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/services"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -293,6 +295,16 @@ func (h *K8sClusterHandler) GetConnectionInfo(c *gin.Context) {
 func (h *K8sClusterHandler) GetKubeconfig(c *gin.Context) {
 	clusterID := c.Param("id")
 
+	// The kubeconfig carries admin credentials and is never served masked
+	if !secrets.CanReveal(c.Request.Context()) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"code":    "FORBIDDEN",
+			"message": "Downloading a kubeconfig requires the " + middlewares.ScopeSecretsReveal + " scope",
+		})
+		return
+	}
+
 	ctx := context.WithValue(c.Request.Context(), "include_kubeconfig", true)
 	cluster, err := h.k8sService.GetClusterInfo(ctx, clusterID)
 	if err != nil {
@@ -2,6 +2,7 @@ package http
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -14,13 +15,15 @@ import (
 // NginxClusterHandler handles HTTP requests for Nginx cluster operations
 type NginxClusterHandler struct {
 	clusterService services.INginxClusterService
+	acmeService    services.IAcmeService
 	logger         logger.ILogger
 }
 
 // NewNginxClusterHandler creates a new Nginx cluster handler
-func NewNginxClusterHandler(clusterService services.INginxClusterService, logger logger.ILogger) *NginxClusterHandler {
+func NewNginxClusterHandler(clusterService services.INginxClusterService, acmeService services.IAcmeService, logger logger.ILogger) *NginxClusterHandler {
 	return &NginxClusterHandler{
 		clusterService: clusterService,
+		acmeService:    acmeService,
 		logger:         logger,
 	}
 }
@@ -45,6 +48,10 @@ func (h *NginxClusterHandler) RegisterRoutes(r *gin.RouterGroup) {
 		// Configuration
 		clusterGroup.PUT("/:id/config", h.UpdateClusterConfig)
 		clusterGroup.POST("/:id/sync-config", h.SyncConfig)
+		clusterGroup.GET("/:id/config/revisions", h.ListConfigRevisions)
+		clusterGroup.GET("/:id/config/revisions/:revision", h.GetConfigRevision)
+		clusterGroup.GET("/:id/config/revisions/:revision/diff", h.DiffConfigRevisions)
+		clusterGroup.POST("/:id/config/revisions/:revision/rollback", h.RollbackConfig)
 
 		// Upstreams
 		clusterGroup.GET("/:id/upstreams", h.ListUpstreams)
@@ -56,6 +63,7 @@ func (h *NginxClusterHandler) RegisterRoutes(r *gin.RouterGroup) {
 		clusterGroup.GET("/:id/server-blocks", h.ListServerBlocks)
 		clusterGroup.POST("/:id/server-blocks", h.AddServerBlock)
 		clusterGroup.DELETE("/:id/server-blocks/:blockId", h.DeleteServerBlock)
+		clusterGroup.POST("/:id/server-blocks/:blockId/certificate/acme", h.IssueAcmeCertificate)
 
 		// Health & Monitoring
 		clusterGroup.GET("/:id/health", h.GetClusterHealth)
@@ -66,6 +74,13 @@ func (h *NginxClusterHandler) RegisterRoutes(r *gin.RouterGroup) {
 		// Failover
 		clusterGroup.POST("/:id/failover", h.TriggerFailover)
 		clusterGroup.GET("/:id/failover-history", h.GetFailoverHistory)
+
+		// Web application firewall
+		clusterGroup.GET("/:id/waf", h.GetWAFPolicy)
+		clusterGroup.PUT("/:id/waf", h.SetWAFMode)
+		clusterGroup.PUT("/:id/server-blocks/:blockId/waf", h.SetServerBlockWAFMode)
+		clusterGroup.POST("/:id/waf/exclusions", h.AddWAFExclusion)
+		clusterGroup.DELETE("/:id/waf/exclusions/:exclusionId", h.DeleteWAFExclusion)
 	}
 }
 
@@ -382,14 +397,9 @@ func (h *NginxClusterHandler) UpdateClusterConfig(c *gin.Context) {
 		return
 	}
 
-	if err := h.clusterService.UpdateClusterConfig(c.Request.Context(), clusterID, req); err != nil {
+	if err := h.clusterService.UpdateClusterConfig(configContext(c), clusterID, req); err != nil {
 		h.logger.Error("failed to update config", zap.String("cluster_id", clusterID), zap.Error(err))
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
-			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to update config",
-			Error:   err.Error(),
-		})
+		respondNginxError(c, "Failed to update config", err)
 		return
 	}
 
@@ -409,14 +419,9 @@ func (h *NginxClusterHandler) UpdateClusterConfig(c *gin.Context) {
 func (h *NginxClusterHandler) SyncConfig(c *gin.Context) {
 	clusterID := c.Param("id")
 
-	if err := h.clusterService.SyncConfig(c.Request.Context(), clusterID); err != nil {
+	if err := h.clusterService.SyncConfig(configContext(c), clusterID); err != nil {
 		h.logger.Error("failed to sync config", zap.String("cluster_id", clusterID), zap.Error(err))
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
-			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to sync config",
-			Error:   err.Error(),
-		})
+		respondNginxError(c, "Failed to sync config", err)
 		return
 	}
 
@@ -636,6 +641,38 @@ func (h *NginxClusterHandler) AddServerBlock(c *gin.Context) {
 	})
 }
 
+// IssueAcmeCertificate orders a certificate for a server block over ACME HTTP-01
+// @Summary Issue ACME Certificate
+// @Tags Nginx Cluster
+// @Accept json
+// @Param id path string true "Cluster ID"
+// @Param blockId path string true "Block ID"
+// @Param request body dto.IssueAcmeCertificateRequest false "Issue certificate request"
+// @Success 200 {object} dto.APIResponse{data=dto.CertificateInfo}
+// @Router /api/v1/nginx/cluster/{id}/server-blocks/{blockId}/certificate/acme [post]
+func (h *NginxClusterHandler) IssueAcmeCertificate(c *gin.Context) {
+	clusterID := c.Param("id")
+	blockID := c.Param("blockId")
+	req, ok := acmeRequest(c)
+	if !ok {
+		return
+	}
+
+	cert, err := h.acmeService.IssueServerBlockCertificate(c.Request.Context(), clusterID, blockID, req)
+	if err != nil {
+		h.logger.Error("failed to issue server block certificate", zap.String("cluster_id", clusterID), zap.Error(err))
+		respondNginxError(c, "Failed to issue certificate", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Certificate issued successfully",
+		Data:    cert,
+	})
+}
+
 // DeleteServerBlock deletes a server block
 // @Summary Delete Server Block
 // @Tags Nginx Cluster
@@ -852,3 +889,300 @@ func (h *NginxClusterHandler) GetFailoverHistory(c *gin.Context) {
 		Data:    result,
 	})
 }
+
+// ListConfigRevisions lists the config history of a cluster
+// @Summary List Config Revisions
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Success 200 {array} dto.NginxConfigRevisionInfo
+// @Router /api/v1/nginx/cluster/{id}/config/revisions [get]
+func (h *NginxClusterHandler) ListConfigRevisions(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	result, err := h.clusterService.ListConfigRevisions(c.Request.Context(), clusterID)
+	if err != nil {
+		h.logger.Error("failed to list config revisions", zap.String("cluster_id", clusterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to list config revisions",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Data:    result,
+	})
+}
+
+// GetConfigRevision returns a config revision with its full config and diff
+// @Summary Get Config Revision
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param revision path int true "Revision number"
+// @Success 200 {object} dto.NginxConfigRevisionInfo
+// @Router /api/v1/nginx/cluster/{id}/config/revisions/{revision} [get]
+func (h *NginxClusterHandler) GetConfigRevision(c *gin.Context) {
+	clusterID := c.Param("id")
+	revision, ok := revisionParam(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.clusterService.GetConfigRevision(c.Request.Context(), clusterID, revision)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Config revision not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Data:    result,
+	})
+}
+
+// DiffConfigRevisions diffs a revision against another one, by default its predecessor
+// @Summary Diff Config Revisions
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param revision path int true "Revision number"
+// @Param from query int false "Revision to diff against"
+// @Success 200 {object} dto.NginxConfigDiffResponse
+// @Router /api/v1/nginx/cluster/{id}/config/revisions/{revision}/diff [get]
+func (h *NginxClusterHandler) DiffConfigRevisions(c *gin.Context) {
+	clusterID := c.Param("id")
+	revision, ok := revisionParam(c)
+	if !ok {
+		return
+	}
+	from, _ := strconv.Atoi(c.Query("from"))
+
+	result, err := h.clusterService.DiffConfigRevisions(c.Request.Context(), clusterID, from, revision)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Failed to diff config revisions",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Data:    result,
+	})
+}
+
+// RollbackConfig re-applies the config of an earlier revision to all nodes
+// @Summary Roll Back Config
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param revision path int true "Revision number"
+// @Success 200 {object} dto.NginxConfigRevisionInfo
+// @Router /api/v1/nginx/cluster/{id}/config/revisions/{revision}/rollback [post]
+func (h *NginxClusterHandler) RollbackConfig(c *gin.Context) {
+	clusterID := c.Param("id")
+	revision, ok := revisionParam(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.clusterService.RollbackConfig(configContext(c), clusterID, revision)
+	if err != nil {
+		h.logger.Error("failed to roll back config", zap.String("cluster_id", clusterID), zap.Int("revision", revision), zap.Error(err))
+		respondNginxError(c, "Failed to roll back config", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Config rolled back successfully",
+		Data:    result,
+	})
+}
+
+// GetWAFPolicy returns the WAF mode and rule exclusions of the cluster
+// @Summary Get WAF Policy
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Success 200 {object} dto.WAFPolicyInfo
+// @Router /api/v1/nginx/cluster/{id}/waf [get]
+func (h *NginxClusterHandler) GetWAFPolicy(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	policy, err := h.clusterService.GetWAFPolicy(c.Request.Context(), clusterID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Failed to get WAF policy",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Data:    policy,
+	})
+}
+
+// SetWAFMode switches the WAF of the cluster default server off, to detection only or to blocking
+// @Summary Set WAF Mode
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param request body dto.SetWAFModeRequest true "WAF mode"
+// @Success 200 {object} dto.WAFPolicyInfo
+// @Router /api/v1/nginx/cluster/{id}/waf [put]
+func (h *NginxClusterHandler) SetWAFMode(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	var req dto.SetWAFModeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	policy, err := h.clusterService.SetWAFMode(configContext(c), clusterID, req)
+	if err != nil {
+		h.logger.Error("failed to set waf mode", zap.String("cluster_id", clusterID), zap.Error(err))
+		respondNginxError(c, "Failed to set WAF mode", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "WAF mode set successfully",
+		Data:    policy,
+	})
+}
+
+// SetServerBlockWAFMode overrides the WAF mode of one server block, or makes it follow the
+// cluster mode again when the mode is empty
+// @Summary Set Server Block WAF Mode
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param blockId path string true "Block ID"
+// @Param request body dto.SetServerBlockWAFModeRequest true "WAF mode"
+// @Success 200 {object} dto.ServerBlockInfo
+// @Router /api/v1/nginx/cluster/{id}/server-blocks/{blockId}/waf [put]
+func (h *NginxClusterHandler) SetServerBlockWAFMode(c *gin.Context) {
+	clusterID := c.Param("id")
+	blockID := c.Param("blockId")
+
+	var req dto.SetServerBlockWAFModeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	block, err := h.clusterService.SetServerBlockWAFMode(configContext(c), clusterID, blockID, req)
+	if err != nil {
+		h.logger.Error("failed to set server block waf mode", zap.String("cluster_id", clusterID), zap.String("block_id", blockID), zap.Error(err))
+		respondNginxError(c, "Failed to set WAF mode", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "WAF mode set successfully",
+		Data:    block,
+	})
+}
+
+// AddWAFExclusion disables an OWASP CRS rule, or one of its targets, on the cluster
+// @Summary Add WAF Exclusion
+// @Tags Nginx Cluster
+// @Accept json
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param request body dto.AddWAFExclusionRequest true "Rule exclusion"
+// @Success 201 {object} dto.WAFExclusionInfo
+// @Router /api/v1/nginx/cluster/{id}/waf/exclusions [post]
+func (h *NginxClusterHandler) AddWAFExclusion(c *gin.Context) {
+	clusterID := c.Param("id")
+
+	var req dto.AddWAFExclusionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	exclusion, err := h.clusterService.AddWAFExclusion(configContext(c), clusterID, req)
+	if err != nil {
+		h.logger.Error("failed to add waf exclusion", zap.String("cluster_id", clusterID), zap.Error(err))
+		respondNginxError(c, "Failed to add WAF exclusion", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "WAF exclusion added successfully",
+		Data:    exclusion,
+	})
+}
+
+// DeleteWAFExclusion removes a rule exclusion from the cluster
+// @Summary Delete WAF Exclusion
+// @Tags Nginx Cluster
+// @Produce json
+// @Param id path string true "Cluster ID"
+// @Param exclusionId path string true "Exclusion ID"
+// @Success 200 {object} dto.APIResponse
+// @Router /api/v1/nginx/cluster/{id}/waf/exclusions/{exclusionId} [delete]
+func (h *NginxClusterHandler) DeleteWAFExclusion(c *gin.Context) {
+	clusterID := c.Param("id")
+	exclusionID := c.Param("exclusionId")
+
+	if err := h.clusterService.DeleteWAFExclusion(configContext(c), clusterID, exclusionID); err != nil {
+		h.logger.Error("failed to delete waf exclusion", zap.String("cluster_id", clusterID), zap.Error(err))
+		respondNginxError(c, "Failed to delete WAF exclusion", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "WAF exclusion deleted successfully",
+	})
+}
@@ -1,7 +1,10 @@
 package http
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
@@ -10,10 +13,11 @@ import (
 
 type NginxHandler struct {
 	nginxService services.INginxService
+	acmeService  services.IAcmeService
 }
 
-func NewNginxHandler(nginxService services.INginxService) *NginxHandler {
-	return &NginxHandler{nginxService: nginxService}
+func NewNginxHandler(nginxService services.INginxService, acmeService services.IAcmeService) *NginxHandler {
+	return &NginxHandler{nginxService: nginxService, acmeService: acmeService}
 }
 
 func (h *NginxHandler) RegisterRoutes(r *gin.RouterGroup) {
@@ -32,16 +36,30 @@ func (h *NginxHandler) RegisterRoutes(r *gin.RouterGroup) {
 		nginx.POST("/:id/routes", h.AddRoute)
 		nginx.PUT("/:id/routes/:route_id", h.UpdateRoute)
 		nginx.DELETE("/:id/routes/:route_id", h.DeleteRoute)
+		nginx.PUT("/:id/routes/:route_id/canary", h.SetRouteCanary)
+		nginx.POST("/:id/routes/:route_id/canary/shift", h.ShiftRouteCanary)
+		nginx.POST("/:id/routes/:route_id/canary/promote", h.PromoteRouteCanary)
+		nginx.DELETE("/:id/routes/:route_id/canary", h.AbortRouteCanary)
 		nginx.POST("/:id/certificate", h.UploadCertificate)
 		nginx.GET("/:id/certificate", h.GetCertificate)
+		nginx.POST("/:id/certificate/acme", h.IssueAcmeCertificate)
 		nginx.PUT("/:id/upstreams", h.UpdateUpstreams)
 		nginx.GET("/:id/upstreams", h.GetUpstreams)
 		nginx.POST("/:id/security", h.SetSecurityPolicy)
 		nginx.GET("/:id/security", h.GetSecurityPolicy)
 		nginx.DELETE("/:id/security", h.DeleteSecurityPolicy)
+		nginx.GET("/:id/waf", h.GetWAFPolicy)
+		nginx.PUT("/:id/waf", h.SetWAFMode)
+		nginx.POST("/:id/waf/exclusions", h.AddWAFExclusion)
+		nginx.DELETE("/:id/waf/exclusions/:exclusion_id", h.DeleteWAFExclusion)
 		nginx.GET("/:id/logs", h.GetLogs)
 		nginx.GET("/:id/metrics", h.GetMetrics)
 		nginx.GET("/:id/stats", h.GetStats)
+
+		nginx.GET("/:id/config/revisions", h.ListConfigRevisions)
+		nginx.GET("/:id/config/revisions/:revision", h.GetConfigRevision)
+		nginx.GET("/:id/config/revisions/:revision/diff", h.DiffConfigRevisions)
+		nginx.POST("/:id/config/revisions/:revision/rollback", h.RollbackConfig)
 	}
 }
 
@@ -111,13 +129,8 @@ func (h *NginxHandler) GetNginxInfo(c *gin.Context) {
 func (h *NginxHandler) StartNginx(c *gin.Context) {
 	id := c.Param("id")
 
-	if err := h.nginxService.StartNginx(c.Request.Context(), id); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
-			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to start Nginx instance",
-			Error:   err.Error(),
-		})
+	if err := h.nginxService.StartNginx(configContext(c), id); err != nil {
+		respondNginxError(c, "Failed to start Nginx instance", err)
 		return
 	}
 
@@ -202,13 +215,8 @@ func (h *NginxHandler) UpdateNginxConfig(c *gin.Context) {
 		return
 	}
 
-	if err := h.nginxService.UpdateNginxConfig(c.Request.Context(), id, req); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
-			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to update Nginx config",
-			Error:   err.Error(),
-		})
+	if err := h.nginxService.UpdateNginxConfig(configContext(c), id, req); err != nil {
+		respondNginxError(c, "Failed to update Nginx config", err)
 		return
 	}
 
@@ -232,13 +240,8 @@ func (h *NginxHandler) AddDomain(c *gin.Context) {
 		return
 	}
 
-	if err := h.nginxService.AddDomain(c.Request.Context(), id, req); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
-			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to add domain",
-			Error:   err.Error(),
-		})
+	if err := h.nginxService.AddDomain(configContext(c), id, req); err != nil {
+		respondNginxError(c, "Failed to add domain", err)
 		return
 	}
 
@@ -253,13 +256,8 @@ func (h *NginxHandler) DeleteDomain(c *gin.Context) {
 	id := c.Param("id")
 	domain := c.Param("domain")
 
-	if err := h.nginxService.DeleteDomain(c.Request.Context(), id, domain); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
-			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to delete domain",
-			Error:   err.Error(),
-		})
+	if err := h.nginxService.DeleteDomain(configContext(c), id, domain); err != nil {
+		respondNginxError(c, "Failed to delete domain", err)
 		return
 	}
 
@@ -283,14 +281,9 @@ func (h *NginxHandler) AddRoute(c *gin.Context) {
 		return
 	}
 
-	route, err := h.nginxService.AddRoute(c.Request.Context(), id, req)
+	route, err := h.nginxService.AddRoute(configContext(c), id, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
-			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to add route",
-			Error:   err.Error(),
-		})
+		respondNginxError(c, "Failed to add route", err)
 		return
 	}
 
@@ -316,13 +309,8 @@ func (h *NginxHandler) UpdateRoute(c *gin.Context) {
 		return
 	}
 
-	if err := h.nginxService.UpdateRoute(c.Request.Context(), id, routeID, req); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
-			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to update route",
-			Error:   err.Error(),
-		})
+	if err := h.nginxService.UpdateRoute(configContext(c), id, routeID, req); err != nil {
+		respondNginxError(c, "Failed to update route", err)
 		return
 	}
 
@@ -337,26 +325,50 @@ func (h *NginxHandler) DeleteRoute(c *gin.Context) {
 	id := c.Param("id")
 	routeID := c.Param("route_id")
 
-	if err := h.nginxService.DeleteRoute(c.Request.Context(), id, routeID); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+	if err := h.nginxService.DeleteRoute(configContext(c), id, routeID); err != nil {
+		respondNginxError(c, "Failed to delete route", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Route deleted successfully",
+	})
+}
+
+func (h *NginxHandler) SetRouteCanary(c *gin.Context) {
+	id := c.Param("id")
+	routeID := c.Param("route_id")
+	var req dto.SetRouteCanaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
 			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to delete route",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
 			Error:   err.Error(),
 		})
 		return
 	}
 
+	route, err := h.nginxService.SetRouteCanary(configContext(c), id, routeID, req)
+	if err != nil {
+		respondNginxError(c, "Failed to set route canary", err)
+		return
+	}
+
 	c.JSON(http.StatusOK, dto.APIResponse{
 		Success: true,
 		Code:    "SUCCESS",
-		Message: "Route deleted successfully",
+		Message: "Route canary set successfully",
+		Data:    route,
 	})
 }
 
-func (h *NginxHandler) UploadCertificate(c *gin.Context) {
+func (h *NginxHandler) ShiftRouteCanary(c *gin.Context) {
 	id := c.Param("id")
-	var req dto.UploadCertificateRequest
+	routeID := c.Param("route_id")
+	var req dto.ShiftRouteCanaryRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, dto.APIResponse{
 			Success: false,
@@ -367,16 +379,74 @@ func (h *NginxHandler) UploadCertificate(c *gin.Context) {
 		return
 	}
 
-	if err := h.nginxService.UploadCertificate(c.Request.Context(), id, req); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+	route, err := h.nginxService.ShiftRouteCanary(configContext(c), id, routeID, req)
+	if err != nil {
+		respondNginxError(c, "Failed to shift route canary", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Route canary shifted successfully",
+		Data:    route,
+	})
+}
+
+func (h *NginxHandler) PromoteRouteCanary(c *gin.Context) {
+	id := c.Param("id")
+	routeID := c.Param("route_id")
+
+	route, err := h.nginxService.PromoteRouteCanary(configContext(c), id, routeID)
+	if err != nil {
+		respondNginxError(c, "Failed to promote route canary", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Route canary promoted successfully",
+		Data:    route,
+	})
+}
+
+func (h *NginxHandler) AbortRouteCanary(c *gin.Context) {
+	id := c.Param("id")
+	routeID := c.Param("route_id")
+
+	route, err := h.nginxService.AbortRouteCanary(configContext(c), id, routeID)
+	if err != nil {
+		respondNginxError(c, "Failed to abort route canary", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Route canary aborted successfully",
+		Data:    route,
+	})
+}
+
+func (h *NginxHandler) UploadCertificate(c *gin.Context) {
+	id := c.Param("id")
+	var req dto.UploadCertificateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
 			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to upload certificate",
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
 			Error:   err.Error(),
 		})
 		return
 	}
 
+	if err := h.nginxService.UploadCertificate(configContext(c), id, req); err != nil {
+		respondNginxError(c, "Failed to upload certificate", err)
+		return
+	}
+
 	c.JSON(http.StatusOK, dto.APIResponse{
 		Success: true,
 		Code:    "SUCCESS",
@@ -384,6 +454,27 @@ func (h *NginxHandler) UploadCertificate(c *gin.Context) {
 	})
 }
 
+func (h *NginxHandler) IssueAcmeCertificate(c *gin.Context) {
+	id := c.Param("id")
+	req, ok := acmeRequest(c)
+	if !ok {
+		return
+	}
+
+	cert, err := h.acmeService.IssueNginxCertificate(configContext(c), id, req)
+	if err != nil {
+		respondNginxError(c, "Failed to issue certificate", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Certificate issued successfully",
+		Data:    cert,
+	})
+}
+
 func (h *NginxHandler) GetCertificate(c *gin.Context) {
 	id := c.Param("id")
 
@@ -419,13 +510,8 @@ func (h *NginxHandler) UpdateUpstreams(c *gin.Context) {
 		return
 	}
 
-	if err := h.nginxService.UpdateUpstreams(c.Request.Context(), id, req); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
-			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to update upstreams",
-			Error:   err.Error(),
-		})
+	if err := h.nginxService.UpdateUpstreams(configContext(c), id, req); err != nil {
+		respondNginxError(c, "Failed to update upstreams", err)
 		return
 	}
 
@@ -471,13 +557,8 @@ func (h *NginxHandler) SetSecurityPolicy(c *gin.Context) {
 		return
 	}
 
-	if err := h.nginxService.SetSecurityPolicy(c.Request.Context(), id, req); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
-			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to set security policy",
-			Error:   err.Error(),
-		})
+	if err := h.nginxService.SetSecurityPolicy(configContext(c), id, req); err != nil {
+		respondNginxError(c, "Failed to set security policy", err)
 		return
 	}
 
@@ -513,11 +594,27 @@ func (h *NginxHandler) GetSecurityPolicy(c *gin.Context) {
 func (h *NginxHandler) DeleteSecurityPolicy(c *gin.Context) {
 	id := c.Param("id")
 
-	if err := h.nginxService.DeleteSecurityPolicy(c.Request.Context(), id); err != nil {
+	if err := h.nginxService.DeleteSecurityPolicy(configContext(c), id); err != nil {
+		respondNginxError(c, "Failed to delete security policy", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Security policy deleted successfully",
+	})
+}
+
+func (h *NginxHandler) GetWAFPolicy(c *gin.Context) {
+	id := c.Param("id")
+
+	policy, err := h.nginxService.GetWAFPolicy(c.Request.Context(), id)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.APIResponse{
 			Success: false,
 			Code:    "INTERNAL_SERVER_ERROR",
-			Message: "Failed to delete security policy",
+			Message: "Failed to get WAF policy",
 			Error:   err.Error(),
 		})
 		return
@@ -526,7 +623,78 @@ func (h *NginxHandler) DeleteSecurityPolicy(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.APIResponse{
 		Success: true,
 		Code:    "SUCCESS",
-		Message: "Security policy deleted successfully",
+		Message: "WAF policy retrieved successfully",
+		Data:    policy,
+	})
+}
+
+func (h *NginxHandler) SetWAFMode(c *gin.Context) {
+	id := c.Param("id")
+	var req dto.SetWAFModeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	policy, err := h.nginxService.SetWAFMode(configContext(c), id, req)
+	if err != nil {
+		respondNginxError(c, "Failed to set WAF mode", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "WAF mode set successfully",
+		Data:    policy,
+	})
+}
+
+func (h *NginxHandler) AddWAFExclusion(c *gin.Context) {
+	id := c.Param("id")
+	var req dto.AddWAFExclusionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	exclusion, err := h.nginxService.AddWAFExclusion(configContext(c), id, req)
+	if err != nil {
+		respondNginxError(c, "Failed to add WAF exclusion", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "WAF exclusion added successfully",
+		Data:    exclusion,
+	})
+}
+
+func (h *NginxHandler) DeleteWAFExclusion(c *gin.Context) {
+	id := c.Param("id")
+	exclusionID := c.Param("exclusion_id")
+
+	if err := h.nginxService.DeleteWAFExclusion(configContext(c), id, exclusionID); err != nil {
+		respondNginxError(c, "Failed to delete WAF exclusion", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "WAF exclusion deleted successfully",
 	})
 }
 
@@ -601,3 +769,158 @@ func (h *NginxHandler) GetStats(c *gin.Context) {
 		Data:    stats,
 	})
 }
+
+// configContext attributes config revisions created by the request to the calling user
+func configContext(c *gin.Context) context.Context {
+	return services.WithConfigAuthor(c.Request.Context(), c.GetString("user_id"))
+}
+
+// respondNginxError answers 422 with the issues nginx -t reported when a config was
+// rejected, and 500 for any other failure
+func respondNginxError(c *gin.Context, message string, err error) {
+	var configErr *services.NginxConfigError
+	if errors.As(err, &configErr) {
+		c.JSON(http.StatusUnprocessableEntity, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_NGINX_CONFIG",
+			Message: message,
+			Data:    configErr.Issues,
+			Error:   err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, dto.APIResponse{
+		Success: false,
+		Code:    "INTERNAL_SERVER_ERROR",
+		Message: message,
+		Error:   err.Error(),
+	})
+}
+
+// acmeRequest binds the optional ACME issue request body, answering 400 when it is invalid
+func acmeRequest(c *gin.Context) (dto.IssueAcmeCertificateRequest, bool) {
+	var req dto.IssueAcmeCertificateRequest
+	if c.Request.ContentLength == 0 {
+		return req, true
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid request data",
+			Error:   err.Error(),
+		})
+		return req, false
+	}
+	return req, true
+}
+
+// revisionParam parses the :revision path parameter, answering 400 when it is invalid
+func revisionParam(c *gin.Context) (int, bool) {
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil || revision < 1 {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "BAD_REQUEST",
+			Message: "Invalid revision number",
+		})
+		return 0, false
+	}
+	return revision, true
+}
+
+func (h *NginxHandler) ListConfigRevisions(c *gin.Context) {
+	id := c.Param("id")
+
+	revisions, err := h.nginxService.ListConfigRevisions(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to list config revisions",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Config revisions retrieved successfully",
+		Data:    revisions,
+	})
+}
+
+func (h *NginxHandler) GetConfigRevision(c *gin.Context) {
+	id := c.Param("id")
+	revision, ok := revisionParam(c)
+	if !ok {
+		return
+	}
+
+	rev, err := h.nginxService.GetConfigRevision(c.Request.Context(), id, revision)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Config revision not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Config revision retrieved successfully",
+		Data:    rev,
+	})
+}
+
+func (h *NginxHandler) DiffConfigRevisions(c *gin.Context) {
+	id := c.Param("id")
+	revision, ok := revisionParam(c)
+	if !ok {
+		return
+	}
+	from, _ := strconv.Atoi(c.Query("from"))
+
+	diff, err := h.nginxService.DiffConfigRevisions(c.Request.Context(), id, from, revision)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Failed to diff config revisions",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Config diff retrieved successfully",
+		Data:    diff,
+	})
+}
+
+func (h *NginxHandler) RollbackConfig(c *gin.Context) {
+	id := c.Param("id")
+	revision, ok := revisionParam(c)
+	if !ok {
+		return
+	}
+
+	rev, err := h.nginxService.RollbackConfig(configContext(c), id, revision)
+	if err != nil {
+		respondNginxError(c, "Failed to roll back Nginx config", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Nginx config rolled back successfully",
+		Data:    rev,
+	})
+}
@@ -0,0 +1,174 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/services"
+	"github.com/gin-gonic/gin"
+)
+
+type RegistryCredentialHandler struct {
+	registryService services.IRegistryCredentialService
+}
+
+func NewRegistryCredentialHandler(registryService services.IRegistryCredentialService) *RegistryCredentialHandler {
+	return &RegistryCredentialHandler{registryService: registryService}
+}
+
+func (h *RegistryCredentialHandler) RegisterRoutes(r *gin.RouterGroup) {
+	// Credentials are looked up within the authenticated user, by ID or name
+	credentials := r.Group("/registry-credentials", h.requireUser)
+	credentials.POST("", h.CreateCredential)
+	credentials.GET("", h.ListCredentials)
+	credentials.GET("/:id", h.GetCredential)
+	credentials.PUT("/:id", h.UpdateCredential)
+	credentials.DELETE("/:id", h.DeleteCredential)
+}
+
+// requireUser rejects requests without an authenticated user
+func (h *RegistryCredentialHandler) requireUser(c *gin.Context) {
+	if c.GetString("user_id") == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, dto.APIResponse{
+			Success: false,
+			Code:    "UNAUTHORIZED",
+			Message: "User not authenticated",
+		})
+		return
+	}
+	c.Next()
+}
+
+// CreateCredential stores a private registry login for the user
+// @Summary Create Registry Credential
+// @Tags RegistryCredentials
+// @Param request body dto.CreateRegistryCredentialRequest true "Registry login"
+// @Success 201 {object} dto.APIResponse{data=dto.RegistryCredentialInfo}
+// @Failure 409 {object} dto.APIResponse
+// @Router /api/v1/registry-credentials [post]
+func (h *RegistryCredentialHandler) CreateCredential(c *gin.Context) {
+	var req dto.CreateRegistryCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	credential, err := h.registryService.CreateCredential(c.Request.Context(), c.GetString("user_id"), req)
+	if err != nil {
+		h.credentialError(c, err, "Failed to create registry credential")
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Registry credential created successfully",
+		Data:    credential,
+	})
+}
+
+// ListCredentials lists the user's registry credentials, optionally of one project_id
+func (h *RegistryCredentialHandler) ListCredentials(c *gin.Context) {
+	var req dto.ListRegistryCredentialsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid query parameters",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	credentials, err := h.registryService.ListCredentials(c.Request.Context(), c.GetString("user_id"), req)
+	if err != nil {
+		h.credentialError(c, err, "Failed to list registry credentials")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Registry credentials retrieved successfully",
+		Data:    credentials,
+	})
+}
+
+func (h *RegistryCredentialHandler) GetCredential(c *gin.Context) {
+	credential, err := h.registryService.GetCredential(c.Request.Context(), c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		h.credentialError(c, err, "Failed to get registry credential")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Registry credential retrieved successfully",
+		Data:    credential,
+	})
+}
+
+// UpdateCredential changes the server, username, password or project of a credential. Services
+// pulling with it use the new values on their next pull.
+func (h *RegistryCredentialHandler) UpdateCredential(c *gin.Context) {
+	var req dto.UpdateRegistryCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	credential, err := h.registryService.UpdateCredential(c.Request.Context(), c.GetString("user_id"), c.Param("id"), req)
+	if err != nil {
+		h.credentialError(c, err, "Failed to update registry credential")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Registry credential updated successfully",
+		Data:    credential,
+	})
+}
+
+// DeleteCredential removes a credential no Docker service or DinD environment uses
+func (h *RegistryCredentialHandler) DeleteCredential(c *gin.Context) {
+	if err := h.registryService.DeleteCredential(c.Request.Context(), c.GetString("user_id"), c.Param("id")); err != nil {
+		h.credentialError(c, err, "Failed to delete registry credential")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Registry credential deleted successfully",
+	})
+}
+
+func (h *RegistryCredentialHandler) credentialError(c *gin.Context, err error, message string) {
+	status, code := http.StatusInternalServerError, "INTERNAL_SERVER_ERROR"
+	switch {
+	case errors.Is(err, services.ErrRegistryCredentialNotFound):
+		status, code = http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, services.ErrRegistryCredentialExists), errors.Is(err, services.ErrRegistryCredentialInUse):
+		status, code = http.StatusConflict, "CONFLICT"
+	}
+	c.JSON(status, dto.APIResponse{
+		Success: false,
+		Code:    code,
+		Message: message,
+		Error:   err.Error(),
+	})
+}
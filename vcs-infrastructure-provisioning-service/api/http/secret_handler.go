@@ -0,0 +1,68 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/middlewares"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/services"
+	"github.com/gin-gonic/gin"
+)
+
+type SecretHandler struct {
+	secretService services.ISecretService
+}
+
+func NewSecretHandler(secretService services.ISecretService) *SecretHandler {
+	return &SecretHandler{secretService: secretService}
+}
+
+func (h *SecretHandler) RegisterRoutes(r *gin.RouterGroup) {
+	secrets := r.Group("/secrets", middlewares.RequireScope(middlewares.ScopeSecretsRotate))
+	secrets.POST("/rotate", h.RotateSecrets)
+}
+
+// RotateSecrets re-encrypts stored secrets under the current master key
+// @Summary Rotate Secrets
+// @Tags Secrets
+// @Param request body dto.RotateSecretsRequest false "Rotation options"
+// @Success 200 {object} dto.APIResponse{data=dto.SecretRotationResult}
+// @Failure 409 {object} dto.APIResponse
+// @Router /api/v1/secrets/rotate [post]
+func (h *SecretHandler) RotateSecrets(c *gin.Context) {
+	var req dto.RotateSecretsRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.APIResponse{
+				Success: false,
+				Code:    "BAD_REQUEST",
+				Message: "Invalid request body",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	result, err := h.secretService.RotateSecrets(c.Request.Context(), req.RotateDataKeys)
+	if err != nil {
+		status, code := http.StatusInternalServerError, "INTERNAL_SERVER_ERROR"
+		if errors.Is(err, services.ErrSecretRotationRunning) {
+			status, code = http.StatusConflict, "CONFLICT"
+		}
+		c.JSON(status, dto.APIResponse{
+			Success: false,
+			Code:    code,
+			Message: "Failed to rotate secrets",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Secrets rotated successfully",
+		Data:    result,
+	})
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -10,11 +11,13 @@ import (
 )
 
 type StackHandler struct {
-	stackService services.IStackService
+	stackService  services.IStackService
+	driftService  services.IStackDriftService
+	healthService services.IStackHealthService
 }
 
-func NewStackHandler(stackService services.IStackService) *StackHandler {
-	return &StackHandler{stackService: stackService}
+func NewStackHandler(stackService services.IStackService, driftService services.IStackDriftService, healthService services.IStackHealthService) *StackHandler {
+	return &StackHandler{stackService: stackService, driftService: driftService, healthService: healthService}
 }
 
 func (h *StackHandler) RegisterRoutes(r *gin.RouterGroup) {
@@ -28,6 +31,12 @@ func (h *StackHandler) RegisterRoutes(r *gin.RouterGroup) {
 		stacks.POST("/:id/start", h.StartStack)
 		stacks.POST("/:id/stop", h.StopStack)
 		stacks.POST("/:id/restart", h.RestartStack)
+		stacks.GET("/:id/operations", h.ListOperations)
+		stacks.GET("/:id/operations/:operationId", h.GetOperation)
+		stacks.POST("/:id/operations/:operationId/cancel", h.CancelOperation)
+		stacks.GET("/:id/health", h.GetStackHealth)
+		stacks.GET("/:id/drift", h.DetectDrift)
+		stacks.POST("/:id/reconcile", h.ReconcileStack)
 		stacks.POST("/clone", h.CloneStack)
 	}
 
@@ -36,6 +45,10 @@ func (h *StackHandler) RegisterRoutes(r *gin.RouterGroup) {
 		templates.POST("", h.CreateTemplate)
 		templates.GET("", h.ListPublicTemplates)
 		templates.GET("/:id", h.GetTemplate)
+		templates.POST("/:id/versions", h.PublishTemplateVersion)
+		templates.GET("/:id/versions", h.ListTemplateVersions)
+		templates.GET("/:id/versions/:version", h.GetTemplateVersion)
+		templates.POST("/:id/instantiate", h.InstantiateTemplate)
 	}
 }
 
@@ -61,22 +74,23 @@ func (h *StackHandler) CreateStack(c *gin.Context) {
 		return
 	}
 
-	stack, err := h.stackService.CreateStack(c.Request.Context(), userID, req)
+	operation, err := h.stackService.CreateStack(c.Request.Context(), userID, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+		status, code := stackTemplateErrorStatus(err)
+		c.JSON(status, dto.APIResponse{
 			Success: false,
-			Code:    "INTERNAL_SERVER_ERROR",
+			Code:    code,
 			Message: "Failed to create stack",
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusCreated, dto.APIResponse{
+	c.JSON(http.StatusAccepted, dto.APIResponse{
 		Success: true,
 		Code:    "SUCCESS",
-		Message: "Stack created successfully",
-		Data:    stack,
+		Message: "Stack creation started",
+		Data:    operation,
 	})
 }
 
@@ -116,7 +130,19 @@ func (h *StackHandler) ListStacks(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
 
-	result, err := h.stackService.ListStacks(c.Request.Context(), userID, page, pageSize)
+	health := c.Query("health")
+	switch health {
+	case "", dto.StackHealthHealthy, dto.StackHealthDegraded, dto.StackHealthDown, dto.StackHealthUnknown:
+	default:
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "health must be one of healthy, degraded, down, unknown",
+		})
+		return
+	}
+
+	result, err := h.stackService.ListStacks(c.Request.Context(), userID, health, page, pageSize)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.APIResponse{
 			Success: false,
@@ -171,7 +197,8 @@ func (h *StackHandler) UpdateStack(c *gin.Context) {
 func (h *StackHandler) DeleteStack(c *gin.Context) {
 	stackID := c.Param("id")
 
-	if err := h.stackService.DeleteStack(c.Request.Context(), stackID); err != nil {
+	operation, err := h.stackService.DeleteStack(c.Request.Context(), c.GetString("user_id"), stackID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.APIResponse{
 			Success: false,
 			Code:    "INTERNAL_SERVER_ERROR",
@@ -181,10 +208,11 @@ func (h *StackHandler) DeleteStack(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.APIResponse{
+	c.JSON(http.StatusAccepted, dto.APIResponse{
 		Success: true,
 		Code:    "SUCCESS",
-		Message: "Stack deleted successfully",
+		Message: "Stack deletion started",
+		Data:    operation,
 	})
 }
 
@@ -208,6 +236,70 @@ func (h *StackHandler) StartStack(c *gin.Context) {
 	})
 }
 
+func (h *StackHandler) GetStackHealth(c *gin.Context) {
+	health, err := h.healthService.EvaluateStack(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to evaluate stack health",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Stack health evaluated successfully",
+		Data:    health,
+	})
+}
+
+func (h *StackHandler) DetectDrift(c *gin.Context) {
+	stackID := c.Param("id")
+
+	report, err := h.driftService.DetectDrift(c.Request.Context(), stackID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to detect stack drift",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Stack drift detected successfully",
+		Data:    report,
+	})
+}
+
+func (h *StackHandler) ReconcileStack(c *gin.Context) {
+	stackID := c.Param("id")
+
+	result, err := h.driftService.ReconcileStack(c.Request.Context(), stackID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to reconcile stack",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Stack reconciled successfully",
+		Data:    result,
+	})
+}
+
 func (h *StackHandler) StopStack(c *gin.Context) {
 	stackID := c.Param("id")
 
@@ -231,7 +323,8 @@ func (h *StackHandler) StopStack(c *gin.Context) {
 func (h *StackHandler) RestartStack(c *gin.Context) {
 	stackID := c.Param("id")
 
-	if err := h.stackService.RestartStack(c.Request.Context(), stackID); err != nil {
+	operation, err := h.stackService.RestartStack(c.Request.Context(), c.GetString("user_id"), stackID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.APIResponse{
 			Success: false,
 			Code:    "INTERNAL_SERVER_ERROR",
@@ -241,10 +334,71 @@ func (h *StackHandler) RestartStack(c *gin.Context) {
 		return
 	}
 
+	c.JSON(http.StatusAccepted, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Stack restart started",
+		Data:    operation,
+	})
+}
+
+func (h *StackHandler) ListOperations(c *gin.Context) {
+	operations, err := h.stackService.ListOperations(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.APIResponse{
+			Success: false,
+			Code:    "INTERNAL_SERVER_ERROR",
+			Message: "Failed to list stack operations",
+			Error:   err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, dto.APIResponse{
 		Success: true,
 		Code:    "SUCCESS",
-		Message: "Stack restarted successfully",
+		Message: "Stack operations retrieved successfully",
+		Data:    operations,
+	})
+}
+
+func (h *StackHandler) GetOperation(c *gin.Context) {
+	operation, err := h.stackService.GetOperation(c.Request.Context(), c.Param("id"), c.Param("operationId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Stack operation not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Stack operation retrieved successfully",
+		Data:    operation,
+	})
+}
+
+func (h *StackHandler) CancelOperation(c *gin.Context) {
+	operation, err := h.stackService.CancelOperation(c.Request.Context(), c.Param("id"), c.Param("operationId"))
+	if err != nil {
+		c.JSON(http.StatusConflict, dto.APIResponse{
+			Success: false,
+			Code:    "CONFLICT",
+			Message: "Failed to cancel stack operation",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Stack operation cancellation requested",
+		Data:    operation,
 	})
 }
 
@@ -371,3 +525,148 @@ func (h *StackHandler) ListPublicTemplates(c *gin.Context) {
 		Data:    templates,
 	})
 }
+
+func (h *StackHandler) PublishTemplateVersion(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, dto.APIResponse{
+			Success: false,
+			Code:    "UNAUTHORIZED",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	var req dto.PublishTemplateVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	template, err := h.stackService.PublishTemplateVersion(c.Request.Context(), userID, c.Param("id"), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "PUBLISH_FAILED",
+			Message: "Failed to publish template version",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Template version published successfully",
+		Data:    template,
+	})
+}
+
+func (h *StackHandler) ListTemplateVersions(c *gin.Context) {
+	versions, err := h.stackService.ListTemplateVersions(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Template not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Template versions retrieved successfully",
+		Data:    versions,
+	})
+}
+
+func (h *StackHandler) GetTemplateVersion(c *gin.Context) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid template version",
+		})
+		return
+	}
+
+	templateVersion, err := h.stackService.GetTemplateVersion(c.Request.Context(), c.Param("id"), version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.APIResponse{
+			Success: false,
+			Code:    "NOT_FOUND",
+			Message: "Template version not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Template version retrieved successfully",
+		Data:    templateVersion,
+	})
+}
+
+func (h *StackHandler) InstantiateTemplate(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, dto.APIResponse{
+			Success: false,
+			Code:    "UNAUTHORIZED",
+			Message: "User not authenticated",
+		})
+		return
+	}
+
+	var req dto.InstantiateTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.APIResponse{
+			Success: false,
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	operation, err := h.stackService.InstantiateTemplate(c.Request.Context(), userID, c.Param("id"), req)
+	if err != nil {
+		status, code := stackTemplateErrorStatus(err)
+		c.JSON(status, dto.APIResponse{
+			Success: false,
+			Code:    code,
+			Message: "Failed to instantiate template",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.APIResponse{
+		Success: true,
+		Code:    "SUCCESS",
+		Message: "Stack creation from template started",
+		Data:    operation,
+	})
+}
+
+// stackTemplateErrorStatus maps errors of creating a stack from a template to a status and
+// code: 404 for unknown templates and versions, 400 for parameter values the template rejects
+func stackTemplateErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrTemplateNotFound):
+		return http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, services.ErrInvalidTemplateParameters):
+		return http.StatusBadRequest, "INVALID_REQUEST"
+	}
+	return http.StatusInternalServerError, "INTERNAL_SERVER_ERROR"
+}
@@ -18,7 +18,7 @@ var upgrader = websocket.Upgrader{
 
 type WebSocketHandler struct {
 	clients    map[*websocket.Conn]bool
-	broadcast  chan dto.InfrastructureStatusUpdate
+	broadcast  chan interface{}
 	register   chan *websocket.Conn
 	unregister chan *websocket.Conn
 	mu         sync.RWMutex
@@ -34,7 +34,7 @@ func NewWebSocketHandler(logger interface {
 }) *WebSocketHandler {
 	return &WebSocketHandler{
 		clients:    make(map[*websocket.Conn]bool),
-		broadcast:  make(chan dto.InfrastructureStatusUpdate, 256),
+		broadcast:  make(chan interface{}, 256),
 		register:   make(chan *websocket.Conn),
 		unregister: make(chan *websocket.Conn),
 		logger:     logger,
@@ -94,6 +94,30 @@ func (h *WebSocketHandler) BroadcastUpdate(update dto.InfrastructureStatusUpdate
 	}
 }
 
+func (h *WebSocketHandler) BroadcastStackOperation(update dto.StackOperationUpdate) {
+	select {
+	case h.broadcast <- update:
+	default:
+		h.logger.Error("broadcast channel full, dropping message")
+	}
+}
+
+func (h *WebSocketHandler) BroadcastNginxClusterUpdate(update dto.NginxClusterUpdate) {
+	select {
+	case h.broadcast <- update:
+	default:
+		h.logger.Error("broadcast channel full, dropping message")
+	}
+}
+
+func (h *WebSocketHandler) BroadcastDockerServiceHealth(update dto.DockerServiceHealthUpdate) {
+	select {
+	case h.broadcast <- update:
+	default:
+		h.logger.Error("broadcast channel full, dropping message")
+	}
+}
+
 func (h *WebSocketHandler) readPump(conn *websocket.Conn) {
 	defer func() {
 		h.unregister <- conn
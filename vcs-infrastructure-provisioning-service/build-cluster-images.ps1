@@ -19,5 +19,13 @@ Set-Location docker\etcd
 docker build -t iaas-etcd:v3.5.11 .
 Set-Location ..\..
 
+# Build Nginx cluster node images with keepalived
+Write-Host "`nBuilding iaas-nginx-keepalived:alpine..." -ForegroundColor Cyan
+Set-Location docker\nginx-keepalived
+docker build -t iaas-nginx-keepalived:alpine .
+Write-Host "`nBuilding iaas-nginx-keepalived:waf..." -ForegroundColor Cyan
+docker build --build-arg BASE_IMAGE=owasp/modsecurity-crs:nginx-alpine -t iaas-nginx-keepalived:waf .
+Set-Location ..\..
+
 Write-Host "`n=== All images built successfully! ===" -ForegroundColor Green
 docker images | Select-String iaas
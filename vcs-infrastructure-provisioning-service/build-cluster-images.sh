@@ -21,5 +21,13 @@ cd docker/etcd
 docker build -t iaas-etcd:v3.5.11 .
 cd ../..
 
+# Build Nginx cluster node images with keepalived
+echo "Building iaas-nginx-keepalived:alpine..."
+cd docker/nginx-keepalived
+docker build -t iaas-nginx-keepalived:alpine .
+echo "Building iaas-nginx-keepalived:waf..."
+docker build --build-arg BASE_IMAGE=owasp/modsecurity-crs:nginx-alpine -t iaas-nginx-keepalived:waf .
+cd ../..
+
 echo "=== All images built successfully! ==="
 docker images | grep iaas
@@ -17,6 +17,7 @@ import (
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/env"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/middlewares"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/secrets"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/services"
 	"github.com/gin-contrib/cors"
@@ -36,6 +37,12 @@ func main() {
 	}
 	defer logger.Sync()
 
+	keyring, err := secrets.LoadKeyring(envConfig.SecretsEnv)
+	if err != nil {
+		log.Fatalf("Failed to load secrets keyring: %v", err)
+	}
+	secrets.SetDefault(keyring)
+
 	postgresDb, err := databases.ConnectPostgresDb(envConfig.PostgresEnv)
 	if err != nil {
 		log.Fatalf("Failed to connect to postgres: %v", err)
@@ -62,9 +69,17 @@ func main() {
 		&entities.DockerPort{},
 		&entities.DockerNetwork{},
 		&entities.DockerHealthCheck{},
+		&entities.DockerServiceReplica{},
+		&entities.DockerAutoscalePolicy{},
+		&entities.DockerScalingEvent{},
+		&entities.RegistryCredential{},
+		&entities.DockerVolume{},
+		&entities.DockerVolumeMount{},
+		&entities.DockerVolumeSnapshot{},
 		&entities.Stack{},
 		&entities.StackResource{},
 		&entities.StackTemplate{},
+		&entities.StackTemplateVersion{},
 		&entities.StackOperation{},
 		// Nginx Cluster entities
 		&entities.NginxCluster{},
@@ -74,6 +89,9 @@ func main() {
 		&entities.NginxServerBlock{},
 		&entities.NginxLocation{},
 		&entities.NginxFailoverEvent{},
+		&entities.NginxConfigRevision{},
+		&entities.NginxWAFExclusion{},
+		&entities.AcmeAccount{},
 		// K8s Cluster entities
 		&entities.K8sCluster{},
 		&entities.K8sNode{},
@@ -100,21 +118,45 @@ func main() {
 	nginxRepo := repositories.NewNginxRepository(postgresDb)
 	clusterRepo := repositories.NewPostgreSQLClusterRepository(postgresDb)
 	nginxClusterRepo := repositories.NewNginxClusterRepository(postgresDb)
+	nginxRevisionRepo := repositories.NewNginxConfigRevisionRepository(postgresDb)
+	nginxWAFRepo := repositories.NewNginxWAFRepository(postgresDb)
+	acmeAccountRepo := repositories.NewAcmeAccountRepository(postgresDb)
 	k8sClusterRepo := repositories.NewK8sClusterRepository(postgresDb)
 	pgDatabaseRepo := repositories.NewPostgresDatabaseRepository(postgresDb)
 	dockerRepo := repositories.NewDockerServiceRepository(postgresDb)
 	stackRepo := repositories.NewStackRepository(postgresDb)
 	dinDRepo := repositories.NewDinDRepository(postgresDb)
+	secretRepo := repositories.NewSecretRepository(postgresDb)
+	dockerAutoscaleRepo := repositories.NewDockerAutoscaleRepository(postgresDb)
+	registryRepo := repositories.NewRegistryCredentialRepository(postgresDb)
+	volumeRepo := repositories.NewDockerVolumeRepository(postgresDb)
 
 	cacheService := services.NewCacheService(redisClient)
+	secretService := services.NewSecretService(secretRepo, keyring, logger)
 	pgService := services.NewPostgreSQLService(infraRepo, pgRepo, dockerService, kafkaProducer, logger)
-	nginxService := services.NewNginxService(infraRepo, nginxRepo, dockerService, kafkaProducer, logger)
+	nginxService := services.NewNginxService(infraRepo, nginxRepo, nginxRevisionRepo, nginxWAFRepo, dockerService, kafkaProducer, logger)
 	clusterService := services.NewPostgreSQLClusterService(infraRepo, clusterRepo, dockerService, kafkaProducer, cacheService, logger)
-	nginxClusterService := services.NewNginxClusterService(infraRepo, nginxClusterRepo, dockerService, kafkaProducer, logger)
+	nginxClusterService := services.NewNginxClusterService(infraRepo, nginxClusterRepo, nginxRepo, nginxRevisionRepo, nginxWAFRepo, dockerService, kafkaProducer, logger)
+	certInventoryService := services.NewCertificateInventoryService(envConfig.CertEnv, nginxRepo, nginxClusterRepo, kafkaProducer, logger)
+	acmeService := services.NewAcmeService(envConfig.AcmeEnv, acmeAccountRepo, nginxRepo, nginxClusterRepo, nginxService, nginxClusterService, dockerService, kafkaProducer, logger)
 	k8sClusterService := services.NewK8sClusterService(k8sClusterRepo, infraRepo, dockerService, kafkaProducer, logger)
 	pgDatabaseService := services.NewPostgresDatabaseService(pgDatabaseRepo, pgRepo, dockerService)
-	dockerSvcService := services.NewDockerServiceService(dockerRepo, infraRepo, dockerService)
-	dinDService := services.NewDinDService(dinDRepo, infraRepo, dockerService, kafkaProducer, logger)
+	dockerSvcService := services.NewDockerServiceService(dockerRepo, infraRepo, registryRepo, volumeRepo, dockerService)
+	dinDService := services.NewDinDService(dinDRepo, infraRepo, registryRepo, dockerService, kafkaProducer, logger)
+	registryService := services.NewRegistryCredentialService(registryRepo)
+	volumeService := services.NewDockerVolumeService(volumeRepo, dockerRepo, dockerService, logger)
+	dockerAutoscaler := services.NewDockerAutoscalerService(
+		dockerAutoscaleRepo,
+		dockerRepo,
+		infraRepo,
+		dockerSvcService,
+		dockerService,
+		[]services.DockerBackendSyncer{nginxService, nginxClusterService},
+		kafkaProducer,
+		logger,
+	)
+	nginxService.SetUpstreamRequestRecorder(dockerAutoscaler)
+	nginxClusterService.SetUpstreamRequestRecorder(dockerAutoscaler)
 	stackService := services.NewStackService(
 		stackRepo,
 		infraRepo,
@@ -122,12 +164,37 @@ func main() {
 		pgService,
 		clusterService,
 		clusterRepo,
+		pgRepo,
+		pgDatabaseRepo,
 		pgDatabaseService,
 		dockerSvcService,
 		nginxClusterService,
 		nginxClusterRepo,
 		dinDService,
 	)
+	stackHealthService := services.NewStackHealthService(
+		stackRepo,
+		pgRepo,
+		pgDatabaseRepo,
+		nginxRepo,
+		dockerRepo,
+		clusterRepo,
+		nginxClusterRepo,
+		dinDRepo,
+		dockerService,
+		logger,
+	)
+	stackDriftService := services.NewStackDriftService(
+		stackRepo,
+		pgRepo,
+		nginxRepo,
+		dockerRepo,
+		clusterRepo,
+		nginxClusterRepo,
+		dinDRepo,
+		dockerService,
+		logger,
+	)
 
 	kafkaConsumer := kafka.NewEventConsumer(envConfig.KafkaEnv, cacheService, logger)
 	defer kafkaConsumer.Close()
@@ -144,24 +211,47 @@ func main() {
 		dockerService,
 		kafkaProducer,
 		infraRepo,
+		dockerRepo,
 		logger,
 	)
 	eventListenerService.SetWebSocketHandler(wsHandler)
+	eventListenerService.SetStackHealthService(stackHealthService)
+	stackService.SetWebSocketHandler(wsHandler)
+	nginxClusterService.SetWebSocketHandler(wsHandler)
+	if err := stackService.StartOperationWorker(ctx); err != nil {
+		logger.Error("failed to start stack operation worker", zap.Error(err))
+	}
 	if err := eventListenerService.Start(ctx); err != nil {
 		logger.Error("failed to start docker event listener", zap.Error(err))
 	}
 	defer eventListenerService.Stop()
+	stackHealthService.Start(ctx)
+	secretService.Start(ctx)
+	acmeService.Start(ctx)
+	certInventoryService.Start(ctx)
+	nginxClusterService.StartHealthMonitor(ctx)
+	nginxService.StartUpstreamHealthMonitor(ctx)
+	nginxService.StartMetricsCollector(ctx)
+	nginxClusterService.StartMetricsCollector(ctx)
+	nginxService.StartAccessLogCollector(ctx)
+	nginxClusterService.StartAccessLogCollector(ctx)
+	dockerAutoscaler.Start(ctx)
 
 	jwtMiddleware := middlewares.NewJWTMiddleware(envConfig.AuthEnv.JWTSecret)
 
 	pgHandler := httpHandler.NewPostgreSQLHandler(pgService)
-	nginxHandler := httpHandler.NewNginxHandler(nginxService)
+	nginxHandler := httpHandler.NewNginxHandler(nginxService, acmeService)
 	clusterHandler := httpHandler.NewPostgreSQLClusterHandler(clusterService, logger)
-	nginxClusterHandler := httpHandler.NewNginxClusterHandler(nginxClusterService, logger)
+	nginxClusterHandler := httpHandler.NewNginxClusterHandler(nginxClusterService, acmeService, logger)
 	k8sClusterHandler := httpHandler.NewK8sClusterHandler(k8sClusterService, logger)
 	pgDatabaseHandler := httpHandler.NewPostgresDatabaseHandler(pgDatabaseService)
-	stackHandler := httpHandler.NewStackHandler(stackService)
+	stackHandler := httpHandler.NewStackHandler(stackService, stackDriftService, stackHealthService)
 	dinDHandler := httpHandler.NewDinDHandler(dinDService, logger)
+	certificateHandler := httpHandler.NewCertificateHandler(certInventoryService)
+	dockerServiceHandler := httpHandler.NewDockerServiceHandler(dockerSvcService, dockerAutoscaler, logger)
+	secretHandler := httpHandler.NewSecretHandler(secretService)
+	registryHandler := httpHandler.NewRegistryCredentialHandler(registryService)
+	volumeHandler := httpHandler.NewDockerVolumeHandler(volumeService)
 
 	r := gin.Default()
 	r.Use(cors.New(cors.Config{
@@ -187,6 +277,11 @@ func main() {
 	pgDatabaseHandler.RegisterRoutes(apiV1)
 	stackHandler.RegisterRoutes(apiV1)
 	dinDHandler.RegisterRoutes(apiV1)
+	certificateHandler.RegisterRoutes(apiV1)
+	dockerServiceHandler.RegisterRoutes(apiV1)
+	secretHandler.RegisterRoutes(apiV1)
+	registryHandler.RegisterRoutes(apiV1)
+	volumeHandler.RegisterRoutes(apiV1)
 
 	// PostgreSQL Cluster routes
 	clusterGroup := apiV1.Group("/postgres/cluster")
@@ -7,26 +7,29 @@ type CreateDinDEnvironmentRequest struct {
 	Description  string `json:"description"`                     // Mô tả
 	AutoCleanup  bool   `json:"auto_cleanup"`                    // Tự động xóa sau TTL
 	TTLHours     int    `json:"ttl_hours"`                       // Thời gian sống (giờ)
+	// RegistryCredentialID - credential (ID hoặc tên) để docker login trong environment
+	RegistryCredentialID string `json:"registry_credential_id"`
 }
 
 // DinDEnvironmentInfo - Thông tin môi trường DinD
 type DinDEnvironmentInfo struct {
-	ID               string `json:"id"`
-	InfrastructureID string `json:"infrastructure_id"`
-	Name             string `json:"name"`
-	ContainerID      string `json:"container_id"`
-	Status           string `json:"status"` // creating, running, stopped, failed
-	DockerHost       string `json:"docker_host"`
-	IPAddress        string `json:"ip_address"`
-	ResourcePlan     string `json:"resource_plan"`
-	CPULimit         string `json:"cpu_limit"`
-	MemoryLimit      string `json:"memory_limit"`
-	Description      string `json:"description"`
-	AutoCleanup      bool   `json:"auto_cleanup"`
-	TTLHours         int    `json:"ttl_hours"`
-	CreatedAt        string `json:"created_at"`
-	UpdatedAt        string `json:"updated_at"`
-	ExpiresAt        string `json:"expires_at,omitempty"`
+	ID                   string `json:"id"`
+	InfrastructureID     string `json:"infrastructure_id"`
+	Name                 string `json:"name"`
+	ContainerID          string `json:"container_id"`
+	Status               string `json:"status"` // creating, running, stopped, failed
+	DockerHost           string `json:"docker_host"`
+	IPAddress            string `json:"ip_address"`
+	ResourcePlan         string `json:"resource_plan"`
+	CPULimit             string `json:"cpu_limit"`
+	MemoryLimit          string `json:"memory_limit"`
+	Description          string `json:"description"`
+	AutoCleanup          bool   `json:"auto_cleanup"`
+	TTLHours             int    `json:"ttl_hours"`
+	RegistryCredentialID string `json:"registry_credential_id,omitempty"`
+	CreatedAt            string `json:"created_at"`
+	UpdatedAt            string `json:"updated_at"`
+	ExpiresAt            string `json:"expires_at,omitempty"`
 }
 
 // ExecCommandRequest - Chạy docker command trong DinD environment
@@ -141,6 +144,8 @@ type PullImageRequest struct {
 	Image    string `json:"image" binding:"required"` // Image name (e.g., nginx:latest)
 	Username string `json:"username"`                 // Registry username (optional)
 	Password string `json:"password"`                 // Registry password (optional)
+	// RegistryCredentialID - dùng credential đã lưu (ID hoặc tên) thay cho username/password
+	RegistryCredentialID string `json:"registry_credential_id"`
 }
 
 // PullImageResponse - Kết quả pull image
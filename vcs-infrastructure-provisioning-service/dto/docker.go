@@ -1,19 +1,27 @@
 package dto
 
 type CreateDockerServiceRequest struct {
-	Name          string            `json:"name" binding:"required"`
-	Image         string            `json:"image" binding:"required"`
-	ImageTag      string            `json:"image_tag" binding:"required"`
-	ServiceType   string            `json:"service_type"`
-	Command       string            `json:"command"`
-	Args          string            `json:"args"`
-	EnvVars       []EnvVarInput     `json:"env_vars"`
-	Ports         []PortInput       `json:"ports" binding:"required"`
-	Networks      []NetworkInput    `json:"networks"`
-	Dependencies  []string          `json:"dependencies"`
-	HealthCheck   *HealthCheckInput `json:"health_check"`
-	RestartPolicy string            `json:"restart_policy"`
-	Plan          string            `json:"plan"`
+	Name          string             `json:"name" binding:"required"`
+	Image         string             `json:"image" binding:"required"`
+	ImageTag      string             `json:"image_tag" binding:"required"`
+	ServiceType   string             `json:"service_type"`
+	Command       string             `json:"command"`
+	Args          string             `json:"args"`
+	EnvVars       []EnvVarInput      `json:"env_vars"`
+	Ports         []PortInput        `json:"ports" binding:"required"`
+	Networks      []NetworkInput     `json:"networks"`
+	Volumes       []VolumeMountInput `json:"volumes" binding:"omitempty,dive"`
+	Dependencies  []string           `json:"dependencies"`
+	HealthCheck   *HealthCheckInput  `json:"health_check"`
+	RestartPolicy string             `json:"restart_policy"`
+	Plan          string             `json:"plan"`
+	// Replicas > 1 runs several containers behind the service alias; they cannot publish host ports
+	Replicas       int  `json:"replicas" binding:"omitempty,min=1,max=20"`
+	MaxSurge       *int `json:"max_surge" binding:"omitempty,min=0"`
+	MaxUnavailable *int `json:"max_unavailable" binding:"omitempty,min=0"`
+	// RegistryCredentialID names a registry credential of the user, by ID or name, to pull a private image
+	RegistryCredentialID string `json:"registry_credential_id"`
+	PullPolicy           string `json:"pull_policy" binding:"omitempty,oneof=always if-not-present never"`
 }
 
 type EnvVarInput struct {
@@ -27,6 +35,16 @@ type NetworkInput struct {
 	Alias     string `json:"alias"`
 }
 
+// VolumeMountInput mounts a named volume, or for type bind a directory under the user's bind
+// root, into every replica
+type VolumeMountInput struct {
+	Type     string `json:"type" binding:"omitempty,oneof=volume bind"` // volume (default) or bind
+	Volume   string `json:"volume"`                                     // volume ID or name, created when the name is new
+	Source   string `json:"source"`                                     // bind mounts: directory name under the user's bind root, e.g. uploads
+	Target   string `json:"target" binding:"required"`
+	ReadOnly bool   `json:"read_only"`
+}
+
 type PortInput struct {
 	ContainerPort int    `json:"container_port" binding:"required"`
 	HostPort      int    `json:"host_port"`
@@ -45,25 +63,46 @@ type HealthCheckInput struct {
 }
 
 type DockerServiceInfo struct {
-	ID               string           `json:"id"`
-	InfrastructureID string           `json:"infrastructure_id"`
-	Name             string           `json:"name"`
-	Image            string           `json:"image"`
-	ImageTag         string           `json:"image_tag"`
-	ServiceType      string           `json:"service_type"`
-	ContainerID      string           `json:"container_id"`
-	Status           string           `json:"status"`
-	IPAddress        string           `json:"ip_address"`
-	InternalEndpoint string           `json:"internal_endpoint"`
-	EnvVars          []EnvVarInfo     `json:"env_vars"`
-	Ports            []PortInfo       `json:"ports"`
-	Networks         []NetworkInfo    `json:"networks"`
-	HealthCheck      *HealthCheckInfo `json:"health_check"`
-	RestartPolicy    string           `json:"restart_policy"`
-	CPULimit         int64            `json:"cpu_limit"`
-	MemoryLimit      int64            `json:"memory_limit"`
-	CreatedAt        string           `json:"created_at"`
-	UpdatedAt        string           `json:"updated_at"`
+	ID                   string            `json:"id"`
+	InfrastructureID     string            `json:"infrastructure_id"`
+	Name                 string            `json:"name"`
+	Image                string            `json:"image"`
+	ImageTag             string            `json:"image_tag"`
+	ImageDigest          string            `json:"image_digest,omitempty"`
+	PullPolicy           string            `json:"pull_policy"`
+	ServiceType          string            `json:"service_type"`
+	ContainerID          string            `json:"container_id"`
+	Status               string            `json:"status"`
+	IPAddress            string            `json:"ip_address"`
+	InternalEndpoint     string            `json:"internal_endpoint"`
+	EnvVars              []EnvVarInfo      `json:"env_vars"`
+	Ports                []PortInfo        `json:"ports"`
+	Networks             []NetworkInfo     `json:"networks"`
+	Volumes              []VolumeMountInfo `json:"volumes"`
+	HealthCheck          *HealthCheckInfo  `json:"health_check"`
+	RestartPolicy        string            `json:"restart_policy"`
+	RegistryCredentialID string            `json:"registry_credential_id,omitempty"`
+	CPULimit             int64             `json:"cpu_limit"`
+	MemoryLimit          int64             `json:"memory_limit"`
+	Replicas             int               `json:"replicas"`
+	ServiceAlias         string            `json:"service_alias"`
+	MaxSurge             int               `json:"max_surge"`
+	MaxUnavailable       int               `json:"max_unavailable"`
+	RolloutStatus        string            `json:"rollout_status,omitempty"`
+	RolloutMessage       string            `json:"rollout_message,omitempty"`
+	Containers           []ReplicaInfo     `json:"containers"`
+	CreatedAt            string            `json:"created_at"`
+	UpdatedAt            string            `json:"updated_at"`
+}
+
+type ReplicaInfo struct {
+	ContainerID   string `json:"container_id"`
+	ContainerName string `json:"container_name"`
+	ImageTag      string `json:"image_tag"`
+	Status        string `json:"status"`
+	Health        string `json:"health,omitempty"`
+	IPAddress     string `json:"ip_address"`
+	CreatedAt     string `json:"created_at"`
 }
 
 type EnvVarInfo struct {
@@ -72,6 +111,15 @@ type EnvVarInfo struct {
 	IsSecret bool   `json:"is_secret"`
 }
 
+type VolumeMountInfo struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	VolumeID string `json:"volume_id,omitempty"`
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"read_only"`
+}
+
 type PortInfo struct {
 	ContainerPort int    `json:"container_port"`
 	HostPort      int    `json:"host_port"`
@@ -100,10 +148,47 @@ type UpdateDockerEnvRequest struct {
 	EnvVars []EnvVarInput `json:"env_vars" binding:"required"`
 }
 
+// UpdateDockerServiceRequest changes the spec of a Docker service in place. Omitted fields keep
+// their current value; ports, when present, replaces every port and command "" clears it.
+type UpdateDockerServiceRequest struct {
+	ImageTag string       `json:"image_tag"`
+	Plan     string       `json:"plan" binding:"omitempty,oneof=small medium large"`
+	Ports    *[]PortInput `json:"ports" binding:"omitempty,dive"`
+	Command  *string      `json:"command"`
+}
+
+// UpdateDockerServiceResponse lists what an update changes. Strategy is "surge" when the previous
+// replicas keep serving until the new ones are healthy, or "replace" when they publish the same
+// host ports and must stop first.
+type UpdateDockerServiceResponse struct {
+	Service  *DockerServiceInfo    `json:"service"`
+	Strategy string                `json:"strategy"`
+	Changes  []DockerServiceChange `json:"changes"`
+}
+
+type DockerServiceChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
 type UpdateDockerHealthCheckRequest struct {
 	HealthCheck HealthCheckInput `json:"health_check" binding:"required"`
 }
 
+type ScaleDockerServiceRequest struct {
+	Replicas int `json:"replicas" binding:"required,min=1,max=20"`
+}
+
+// RollingUpdateDockerServiceRequest replaces replicas batch by batch. Omitted fields keep
+// their current value; env_vars, when present, replaces every variable.
+type RollingUpdateDockerServiceRequest struct {
+	ImageTag       string        `json:"image_tag"`
+	EnvVars        []EnvVarInput `json:"env_vars"`
+	MaxSurge       *int          `json:"max_surge" binding:"omitempty,min=0"`
+	MaxUnavailable *int          `json:"max_unavailable" binding:"omitempty,min=0"`
+}
+
 type DockerServiceLogsRequest struct {
 	Tail       int  `form:"tail"`
 	Follow     bool `form:"follow"`
@@ -113,3 +198,79 @@ type DockerServiceLogsRequest struct {
 type DockerServiceLogsResponse struct {
 	Logs []string `json:"logs"`
 }
+
+type ListDockerServicesRequest struct {
+	Status      string `form:"status"`
+	ServiceType string `form:"service_type"`
+	Name        string `form:"name"`
+	Image       string `form:"image"`
+	Health      string `form:"health" binding:"omitempty,oneof=unknown starting healthy unhealthy"`
+	Page        int    `form:"page"`
+	PageSize    int    `form:"page_size"`
+}
+
+type DockerServiceListResponse struct {
+	Services   []DockerServiceInfo `json:"services"`
+	TotalCount int                 `json:"total_count"`
+	Page       int                 `json:"page"`
+	PageSize   int                 `json:"page_size"`
+}
+
+// DockerServiceHealthUpdate is pushed over WebSocket when a replica of a Docker service changes health
+type DockerServiceHealthUpdate struct {
+	Type             string `json:"type"` // docker_service_health
+	ServiceID        string `json:"service_id"`
+	InfrastructureID string `json:"infrastructure_id"`
+	ServiceName      string `json:"service_name"`
+	ContainerID      string `json:"container_id"`
+	ContainerName    string `json:"container_name"`
+	ReplicaHealth    string `json:"replica_health"`
+	ServiceHealth    string `json:"service_health"`
+	Timestamp        string `json:"timestamp"`
+}
+
+// DockerAutoscalingRequest sets the autoscaling policy of a Docker service. Thresholds are
+// percents for cpu and memory and requests per second per replica for requests, which are
+// counted from the access logs of the nginx instances and clusters proxying to the replicas.
+type DockerAutoscalingRequest struct {
+	Enabled            *bool   `json:"enabled"`
+	MinReplicas        int     `json:"min_replicas" binding:"required,min=1,max=20"`
+	MaxReplicas        int     `json:"max_replicas" binding:"required,min=1,max=20,gtefield=MinReplicas"`
+	Metric             string  `json:"metric" binding:"required,oneof=cpu memory requests"`
+	ScaleUpThreshold   float64 `json:"scale_up_threshold" binding:"required,gt=0"`
+	ScaleDownThreshold float64 `json:"scale_down_threshold" binding:"min=0,ltfield=ScaleUpThreshold"`
+	Evaluations        int     `json:"evaluations" binding:"omitempty,min=1,max=20"`
+	ScaleUpCooldown    *int    `json:"scale_up_cooldown" binding:"omitempty,min=0"`   // seconds, default 60
+	ScaleDownCooldown  *int    `json:"scale_down_cooldown" binding:"omitempty,min=0"` // seconds, default 300
+}
+
+type DockerAutoscalingInfo struct {
+	ServiceID          string                   `json:"service_id"`
+	Enabled            bool                     `json:"enabled"`
+	MinReplicas        int                      `json:"min_replicas"`
+	MaxReplicas        int                      `json:"max_replicas"`
+	Metric             string                   `json:"metric"`
+	ScaleUpThreshold   float64                  `json:"scale_up_threshold"`
+	ScaleDownThreshold float64                  `json:"scale_down_threshold"`
+	Evaluations        int                      `json:"evaluations"`
+	ScaleUpCooldown    int                      `json:"scale_up_cooldown"`
+	ScaleDownCooldown  int                      `json:"scale_down_cooldown"`
+	CurrentReplicas    int                      `json:"current_replicas"`
+	LastValue          float64                  `json:"last_value"`
+	LastEvaluatedAt    string                   `json:"last_evaluated_at,omitempty"`
+	LastScaledAt       string                   `json:"last_scaled_at,omitempty"`
+	Events             []DockerScalingEventInfo `json:"events"`
+}
+
+type DockerScalingEventInfo struct {
+	FromReplicas     int     `json:"from_replicas"`
+	ToReplicas       int     `json:"to_replicas"`
+	Metric           string  `json:"metric"`
+	Value            float64 `json:"value"`
+	Threshold        float64 `json:"threshold"`
+	Reason           string  `json:"reason"`
+	Status           string  `json:"status"`
+	Error            string  `json:"error,omitempty"`
+	UpstreamsUpdated int     `json:"upstreams_updated"`
+	CreatedAt        string  `json:"created_at"`
+}
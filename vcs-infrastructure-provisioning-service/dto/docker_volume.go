@@ -0,0 +1,41 @@
+package dto
+
+type CreateDockerVolumeRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// DockerVolumeInfo describes a named volume. SizeBytes is -1 when Docker cannot measure it.
+type DockerVolumeInfo struct {
+	ID            string                     `json:"id"`
+	Name          string                     `json:"name"`
+	DockerName    string                     `json:"docker_name"`
+	Driver        string                     `json:"driver"`
+	SizeBytes     int64                      `json:"size_bytes"`
+	SizeCheckedAt string                     `json:"size_checked_at,omitempty"`
+	Orphaned      bool                       `json:"orphaned"` // mounted by no Docker service
+	Attachments   []DockerVolumeAttachment   `json:"attachments"`
+	Snapshots     []DockerVolumeSnapshotInfo `json:"snapshots,omitempty"`
+	CreatedAt     string                     `json:"created_at"`
+}
+
+type DockerVolumeAttachment struct {
+	ServiceID string `json:"service_id"`
+	MountID   string `json:"mount_id"`
+	Target    string `json:"target"`
+	ReadOnly  bool   `json:"read_only"`
+}
+
+type CreateVolumeSnapshotRequest struct {
+	Name string `json:"name" binding:"max=100"`
+}
+
+type DockerVolumeSnapshotInfo struct {
+	ID         string `json:"id"`
+	VolumeID   string `json:"volume_id"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	SizeBytes  int64  `json:"size_bytes"`
+	RestoredAt string `json:"restored_at,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
@@ -8,27 +8,34 @@ type CreateNginxRequest struct {
 	Upstreams   map[string]string `json:"upstreams"`
 	CPULimit    int64             `json:"cpu_limit"`
 	MemoryLimit int64             `json:"memory_limit"`
+	WAFEnabled  bool              `json:"waf_enabled"` // run the ModSecurity image so the WAF can be switched on
 }
 
 type NginxInfoResponse struct {
-	ID          string           `json:"id"`
-	Name        string           `json:"name"`
-	Status      string           `json:"status"`
-	ContainerID string           `json:"container_id"`
-	Port        int              `json:"port"`
-	SSLPort     int              `json:"ssl_port"`
-	Config      string           `json:"config"`
-	Domains     []string         `json:"domains"`
-	Routes      []RouteInfo      `json:"routes"`
-	Upstreams   []UpstreamInfo   `json:"upstreams"`
-	Certificate *CertificateInfo `json:"certificate,omitempty"`
-	Security    *SecurityPolicy  `json:"security,omitempty"`
-	CPULimit    int64            `json:"cpu_limit"`
-	MemoryLimit int64            `json:"memory_limit"`
-	CreatedAt   string           `json:"created_at"`
-	UpdatedAt   string           `json:"updated_at"`
+	ID               string           `json:"id"`
+	Name             string           `json:"name"`
+	Status           string           `json:"status"`
+	ContainerID      string           `json:"container_id"`
+	Port             int              `json:"port"`
+	SSLPort          int              `json:"ssl_port"`
+	Config           string           `json:"config"`                      // as given at creation, not applied
+	CustomDirectives string           `json:"custom_directives,omitempty"` // set by UpdateNginxConfigRequest
+	Domains          []string         `json:"domains"`
+	Routes           []RouteInfo      `json:"routes"`
+	Upstreams        []UpstreamInfo   `json:"upstreams"`
+	Certificate      *CertificateInfo `json:"certificate,omitempty"`
+	Security         *SecurityPolicy  `json:"security,omitempty"`
+	WAF              *WAFPolicyInfo   `json:"waf,omitempty"`
+	CPULimit         int64            `json:"cpu_limit"`
+	MemoryLimit      int64            `json:"memory_limit"`
+	CreatedAt        string           `json:"created_at"`
+	UpdatedAt        string           `json:"updated_at"`
 }
 
+// UpdateNginxConfigRequest sets the extra directives rendered inside the generated server
+// block, e.g. "client_max_body_size 20m;". The rest of the config is rendered from the
+// domains, routes, upstreams, certificate and security policy, so Config no longer replaces
+// it and must not hold server or http blocks.
 type UpdateNginxConfigRequest struct {
 	Config string `json:"config" binding:"required"`
 }
@@ -49,10 +56,36 @@ type UpdateRouteRequest struct {
 }
 
 type RouteInfo struct {
-	ID       string `json:"id"`
-	Path     string `json:"path"`
-	Backend  string `json:"backend"`
-	Priority int    `json:"priority"`
+	ID       string           `json:"id"`
+	Path     string           `json:"path"`
+	Backend  string           `json:"backend"`
+	Priority int              `json:"priority"`
+	Canary   *RouteCanaryInfo `json:"canary,omitempty"`
+}
+
+// RouteCanaryInfo describes how a route splits traffic between its backend and a canary
+type RouteCanaryInfo struct {
+	Backend    string `json:"backend"`
+	Weight     int    `json:"weight"`
+	Header     string `json:"header,omitempty"`
+	Cookie     string `json:"cookie,omitempty"`
+	MatchValue string `json:"match_value,omitempty"`
+}
+
+// SetRouteCanaryRequest sends Weight percent of clients to Backend. Requests whose Header
+// or Cookie equals MatchValue (any value when empty) always go to Backend.
+type SetRouteCanaryRequest struct {
+	Backend    string `json:"backend" binding:"required"`
+	Weight     int    `json:"weight" binding:"min=0,max=100"`
+	Header     string `json:"header"`
+	Cookie     string `json:"cookie"`
+	MatchValue string `json:"match_value"`
+}
+
+// ShiftRouteCanaryRequest sets the canary weight, or moves it by Step when Weight is omitted
+type ShiftRouteCanaryRequest struct {
+	Weight *int `json:"weight" binding:"omitempty,min=0,max=100"`
+	Step   int  `json:"step"`
 }
 
 type UploadCertificateRequest struct {
@@ -62,10 +95,21 @@ type UploadCertificateRequest struct {
 }
 
 type CertificateInfo struct {
-	Domain    string `json:"domain"`
-	Status    string `json:"status"`
-	ExpiresAt string `json:"expires_at"`
-	Issuer    string `json:"issuer"`
+	Domain        string `json:"domain"`
+	Status        string `json:"status"`
+	ExpiresAt     string `json:"expires_at"`
+	Issuer        string `json:"issuer"`
+	Source        string `json:"source,omitempty"`
+	AutoRenew     bool   `json:"auto_renew"`
+	LastRenewalAt string `json:"last_renewal_at,omitempty"`
+	RenewalError  string `json:"renewal_error,omitempty"`
+}
+
+// IssueAcmeCertificateRequest orders a certificate over ACME HTTP-01. Domains default to
+// the instance's domains or the server block's server_name.
+type IssueAcmeCertificateRequest struct {
+	Domains          []string `json:"domains"`
+	DisableAutoRenew bool     `json:"disable_auto_renew"`
 }
 
 type UpdateUpstreamsRequest struct {
@@ -76,6 +120,9 @@ type UpdateUpstreamsRequest struct {
 type BackendServer struct {
 	Address string `json:"address" binding:"required"`
 	Weight  int    `json:"weight"`
+	// Links the backend to a Docker service of the same owner; the autoscaler re-points
+	// linked backends at the service's replicas as it scales
+	DockerServiceID string `json:"docker_service_id,omitempty"`
 }
 
 type UpstreamInfo struct {
@@ -113,6 +160,41 @@ type SecurityPolicy struct {
 	BasicAuth *BasicAuthConfig `json:"basic_auth,omitempty"`
 }
 
+// WAFPolicyInfo is the web application firewall setup of an Nginx instance or cluster
+type WAFPolicyInfo struct {
+	Enabled    bool               `json:"enabled"` // false when created without the ModSecurity image
+	Mode       string             `json:"mode"`    // off, detection_only, blocking
+	Exclusions []WAFExclusionInfo `json:"exclusions"`
+}
+
+type WAFExclusionInfo struct {
+	ID         string `json:"id"`
+	RuleID     int    `json:"rule_id"`
+	Target     string `json:"target,omitempty"`
+	PathPrefix string `json:"path_prefix,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
+
+type SetWAFModeRequest struct {
+	Mode string `json:"mode" binding:"required,oneof=off detection_only blocking"`
+}
+
+// SetServerBlockWAFModeRequest sets the WAF mode of one cluster server block; an empty
+// mode makes it follow the cluster mode
+type SetServerBlockWAFModeRequest struct {
+	Mode string `json:"mode" binding:"omitempty,oneof=off detection_only blocking"`
+}
+
+// AddWAFExclusionRequest disables a CRS rule, or only its Target (e.g. ARGS:password),
+// for requests below PathPrefix or for every request when it is empty
+type AddWAFExclusionRequest struct {
+	RuleID     int    `json:"rule_id" binding:"required,min=1"`
+	Target     string `json:"target"`
+	PathPrefix string `json:"path_prefix"`
+	Comment    string `json:"comment"`
+}
+
 type NginxLogsResponse struct {
 	InstanceID string   `json:"instance_id"`
 	Logs       []string `json:"logs"`
@@ -121,8 +203,14 @@ type NginxLogsResponse struct {
 
 type NginxMetricsResponse struct {
 	InstanceID     string  `json:"instance_id"`
+	ActiveConns    int64   `json:"active_connections"`
+	Accepts        int64   `json:"accepts"`
+	Handled        int64   `json:"handled"`
 	TotalRequests  int64   `json:"total_requests"`
 	RequestsPerSec float64 `json:"requests_per_sec"`
+	Reading        int64   `json:"reading"`
+	Writing        int64   `json:"writing"`
+	Waiting        int64   `json:"waiting"`
 	Status2xx      int64   `json:"status_2xx"`
 	Status4xx      int64   `json:"status_4xx"`
 	Status5xx      int64   `json:"status_5xx"`
@@ -140,7 +228,71 @@ type NginxStatsResponse struct {
 }
 
 type UpstreamHealth struct {
-	Name    string `json:"name"`
-	Healthy bool   `json:"healthy"`
-	Address string `json:"address"`
+	Name        string `json:"name"`
+	Healthy     bool   `json:"healthy"`
+	Address     string `json:"address"`
+	LatencyMs   int64  `json:"latency_ms"`
+	LastError   string `json:"last_error,omitempty"`
+	LastChecked string `json:"last_checked,omitempty"`
+}
+
+type NginxConfigRevisionInfo struct {
+	Revision         int    `json:"revision"`
+	Action           string `json:"action"`
+	Author           string `json:"author"`
+	ValidationStatus string `json:"validation_status"`
+	ValidationOutput string `json:"validation_output,omitempty"`
+	RollbackOf       int    `json:"rollback_of,omitempty"`
+	Diff             string `json:"diff,omitempty"`
+	Config           string `json:"config,omitempty"`
+	CreatedAt        string `json:"created_at"`
+}
+
+type NginxConfigDiffResponse struct {
+	FromRevision int    `json:"from_revision"`
+	ToRevision   int    `json:"to_revision"`
+	Diff         string `json:"diff"`
+}
+
+// NginxConfigIssue is a problem nginx -t reported, located by file and line
+type NginxConfigIssue struct {
+	Level   string `json:"level"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+	Text    string `json:"text,omitempty"` // Offending line of the config
+}
+
+// CertificateInventoryItem describes one stored certificate as parsed from its PEM
+type CertificateInventoryItem struct {
+	ResourceType  string   `json:"resource_type"` // nginx, nginx_cluster, nginx_server_block
+	ResourceID    string   `json:"resource_id"`   // infrastructure ID of the instance or cluster
+	ResourceName  string   `json:"resource_name,omitempty"`
+	OwnerID       string   `json:"owner_id"`
+	Domain        string   `json:"domain,omitempty"`
+	CommonName    string   `json:"common_name,omitempty"`
+	SANs          []string `json:"sans,omitempty"`
+	Issuer        string   `json:"issuer,omitempty"`
+	SerialNumber  string   `json:"serial_number,omitempty"`
+	KeyType       string   `json:"key_type,omitempty"`
+	NotBefore     string   `json:"not_before,omitempty"`
+	NotAfter      string   `json:"not_after,omitempty"`
+	DaysRemaining int      `json:"days_remaining"`
+	ChainLength   int      `json:"chain_length"`
+	ChainValid    bool     `json:"chain_valid"`
+	Trusted       bool     `json:"trusted"`
+	KeyMatches    bool     `json:"key_matches"`
+	Source        string   `json:"source,omitempty"`
+	AutoRenew     bool     `json:"auto_renew"`
+	Status        string   `json:"status"` // valid, expiring, expired, invalid
+	Problems      []string `json:"problems,omitempty"`
+}
+
+type CertificateInventoryResponse struct {
+	ExpiringWithinDays int                        `json:"expiring_within_days"`
+	Total              int                        `json:"total"`
+	Expiring           int                        `json:"expiring"`
+	Expired            int                        `json:"expired"`
+	Invalid            int                        `json:"invalid"`
+	Certificates       []CertificateInventoryItem `json:"certificates"`
 }
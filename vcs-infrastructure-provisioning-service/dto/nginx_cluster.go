@@ -41,6 +41,9 @@ type CreateNginxClusterRequest struct {
 	AccessLogEnabled bool   `json:"access_log_enabled"` // Enable access logging
 	ErrorLogLevel    string `json:"error_log_level"`    // error, warn, info, debug
 
+	// Web Application Firewall
+	WAFEnabled bool `json:"waf_enabled"` // Run nodes from the ModSecurity image with the OWASP CRS
+
 	// Caching Configuration
 	CacheEnabled bool   `json:"cache_enabled"`
 	CachePath    string `json:"cache_path"`
@@ -78,6 +81,9 @@ type CreateUpstreamServerRequest struct {
 	MaxFails    int    `json:"max_fails"`
 	FailTimeout int    `json:"fail_timeout"`
 	IsBackup    bool   `json:"is_backup"`
+	// Links the server to a Docker service of the same owner; the autoscaler re-points
+	// linked servers at the service's replicas as it scales
+	DockerServiceID string `json:"docker_service_id,omitempty"`
 }
 
 // CreateServerBlockRequest defines a virtual host
@@ -86,6 +92,7 @@ type CreateServerBlockRequest struct {
 	ListenPort int                     `json:"listen_port"`
 	SSLEnabled bool                    `json:"ssl_enabled"`
 	RootPath   string                  `json:"root_path"`
+	WAFMode    string                  `json:"waf_mode" binding:"omitempty,oneof=off detection_only blocking"`
 	Locations  []CreateLocationRequest `json:"locations"`
 }
 
@@ -114,6 +121,8 @@ type NginxClusterInfoResponse struct {
 	HTTPSPort        int               `json:"https_port,omitempty"`
 	LoadBalanceMode  string            `json:"load_balance_mode"`
 	SSLEnabled       bool              `json:"ssl_enabled"`
+	WAFEnabled       bool              `json:"waf_enabled"`
+	WAFMode          string            `json:"waf_mode,omitempty"`
 	Upstreams        []UpstreamInfo    `json:"upstreams,omitempty"`
 	ServerBlocks     []ServerBlockInfo `json:"server_blocks,omitempty"`
 	Endpoints        NginxEndpoints    `json:"endpoints"`
@@ -150,6 +159,7 @@ type ServerBlockInfo struct {
 	ServerName string         `json:"server_name"`
 	ListenPort int            `json:"listen_port"`
 	SSLEnabled bool           `json:"ssl_enabled"`
+	WAFMode    string         `json:"waf_mode,omitempty"`
 	Locations  []LocationInfo `json:"locations,omitempty"`
 }
 
@@ -199,6 +209,7 @@ type AddNginxServerBlockRequest struct {
 	ListenPort int                     `json:"listen_port"`
 	SSLEnabled bool                    `json:"ssl_enabled"`
 	RootPath   string                  `json:"root_path"`
+	WAFMode    string                  `json:"waf_mode" binding:"omitempty,oneof=off detection_only blocking"` // empty follows the cluster mode
 	Locations  []CreateLocationRequest `json:"locations"`
 }
 
@@ -239,10 +250,11 @@ type NodeHealthInfo struct {
 
 // UpstreamHealthInfo upstream health status
 type UpstreamHealthInfo struct {
-	Name           string   `json:"name"`
-	HealthyServers int      `json:"healthy_servers"`
-	TotalServers   int      `json:"total_servers"`
-	UnhealthyList  []string `json:"unhealthy_list,omitempty"`
+	Name           string           `json:"name"`
+	HealthyServers int              `json:"healthy_servers"`
+	TotalServers   int              `json:"total_servers"`
+	UnhealthyList  []string         `json:"unhealthy_list,omitempty"`
+	Servers        []UpstreamHealth `json:"servers,omitempty"`
 }
 
 // ================== Failover ==================
@@ -282,6 +294,17 @@ type NginxFailoverEvent struct {
 	OccurredAt    string `json:"occurred_at"`
 }
 
+// NginxClusterUpdate is pushed over WebSocket when a node changes health or the cluster fails over
+type NginxClusterUpdate struct {
+	Type             string              `json:"type"` // nginx_node_health, nginx_cluster_failover
+	ClusterID        string              `json:"cluster_id"`
+	InfrastructureID string              `json:"infrastructure_id"`
+	ClusterName      string              `json:"cluster_name"`
+	Node             *NodeHealthInfo     `json:"node,omitempty"`
+	Failover         *NginxFailoverEvent `json:"failover,omitempty"`
+	Timestamp        string              `json:"timestamp"`
+}
+
 // ================== Metrics & Stats ==================
 
 // NginxClusterMetricsResponse cluster-wide metrics
@@ -305,6 +328,11 @@ type NginxNodeMetrics struct {
 	TotalRequests  int64   `json:"total_requests"`
 	RequestsPerSec float64 `json:"requests_per_sec"`
 	ActiveConns    int     `json:"active_connections"`
+	Accepts        int64   `json:"accepts"`
+	Handled        int64   `json:"handled"`
+	Reading        int64   `json:"reading"`
+	Writing        int64   `json:"writing"`
+	Waiting        int64   `json:"waiting"`
 	Status2xx      int64   `json:"status_2xx"`
 	Status4xx      int64   `json:"status_4xx"`
 	Status5xx      int64   `json:"status_5xx"`
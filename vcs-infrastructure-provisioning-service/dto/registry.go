@@ -0,0 +1,34 @@
+package dto
+
+// CreateRegistryCredentialRequest stores a login for a private container registry
+type CreateRegistryCredentialRequest struct {
+	Name          string `json:"name" binding:"required,max=100"`
+	ProjectID     string `json:"project_id"`
+	ServerAddress string `json:"server_address" binding:"required"` // e.g. ghcr.io or registry.example.com:5000
+	Username      string `json:"username" binding:"required"`
+	Password      string `json:"password" binding:"required"` // password or access token
+}
+
+// UpdateRegistryCredentialRequest changes a stored credential. Omitted fields keep their value.
+type UpdateRegistryCredentialRequest struct {
+	ProjectID     *string `json:"project_id"`
+	ServerAddress string  `json:"server_address"`
+	Username      string  `json:"username"`
+	Password      string  `json:"password"`
+}
+
+type ListRegistryCredentialsRequest struct {
+	ProjectID string `form:"project_id"`
+}
+
+// RegistryCredentialInfo describes a credential; the password is masked without the reveal scope
+type RegistryCredentialInfo struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	ProjectID     string `json:"project_id,omitempty"`
+	ServerAddress string `json:"server_address"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+}
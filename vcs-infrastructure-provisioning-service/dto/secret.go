@@ -0,0 +1,23 @@
+package dto
+
+// RotateSecretsRequest re-encrypts stored secrets under the current master key
+type RotateSecretsRequest struct {
+	RotateDataKeys bool `json:"rotate_data_keys"` // also replace the per-record data keys, not only rewrap them
+}
+
+// SecretRotationResult summarises a rotation pass
+type SecretRotationResult struct {
+	KeyID   string                 `json:"key_id"`
+	Scanned int                    `json:"scanned"`
+	Rotated int                    `json:"rotated"`
+	Failed  int                    `json:"failed"`
+	Columns []SecretColumnRotation `json:"columns"`
+}
+
+type SecretColumnRotation struct {
+	Table   string `json:"table"`
+	Column  string `json:"column"`
+	Scanned int    `json:"scanned"`
+	Rotated int    `json:"rotated"`
+	Failed  int    `json:"failed"`
+}
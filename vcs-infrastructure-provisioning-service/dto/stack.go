@@ -9,8 +9,11 @@ type CreateStackRequest struct {
 	ProjectID    string                     `json:"project_id"`
 	TenantID     string                     `json:"tenant_id"`
 	Tags         []string                   `json:"tags"`
-	Resources    []CreateStackResourceInput `json:"resources" binding:"required"`
-	FromTemplate string                     `json:"from_template"` // Optional template ID
+	Resources    []CreateStackResourceInput `json:"resources"`
+	FromTemplate string                     `json:"from_template"` // Optional template ID, replaces resources
+	// Template instantiation inputs, only used together with FromTemplate
+	TemplateVersion int                    `json:"template_version"` // 0 means latest
+	Parameters      map[string]interface{} `json:"parameters"`
 }
 
 type CreateStackResourceInput struct {
@@ -53,10 +56,17 @@ type StackInfo struct {
 	TenantID    string              `json:"tenant_id"`
 	UserID      string              `json:"user_id"`
 	Status      string              `json:"status"`
+	Health      string              `json:"health"`
 	Tags        []string            `json:"tags"`
 	Resources   []StackResourceInfo `json:"resources"`
 	CreatedAt   time.Time           `json:"created_at"`
 	UpdatedAt   time.Time           `json:"updated_at"`
+
+	TemplateID      string                 `json:"template_id,omitempty"`
+	TemplateVersion int                    `json:"template_version,omitempty"`
+	TemplateParams  map[string]interface{} `json:"template_params,omitempty"`
+
+	HealthCheckedAt *time.Time `json:"health_checked_at,omitempty"`
 }
 
 type StackResourceInfo struct {
@@ -67,6 +77,8 @@ type StackResourceInfo struct {
 	ResourceName     string                 `json:"resource_name"`
 	Role             string                 `json:"role"`
 	Status           string                 `json:"status"`
+	Health           string                 `json:"health"`
+	HealthMessage    string                 `json:"health_message,omitempty"`
 	DependsOn        []string               `json:"depends_on"`
 	Order            int                    `json:"order"`
 	Outputs          map[string]interface{} `json:"outputs"` // Connection strings, endpoints, etc.
@@ -85,6 +97,7 @@ type StackSummary struct {
 	Name          string              `json:"name"`
 	Environment   string              `json:"environment"`
 	Status        string              `json:"status"`
+	Health        string              `json:"health"`
 	ResourceCount int                 `json:"resource_count"`
 	Resources     []StackResourceInfo `json:"resources,omitempty"`
 	Tags          []string            `json:"tags"`
@@ -92,20 +105,86 @@ type StackSummary struct {
 	UpdatedAt     time.Time           `json:"updated_at"`
 }
 
+// Stack health values
+const (
+	StackHealthUnknown  = "unknown"
+	StackHealthHealthy  = "healthy"
+	StackHealthDegraded = "degraded"
+	StackHealthDown     = "down"
+)
+
+// StackHealthInfo is the result of evaluating a stack's health
+type StackHealthInfo struct {
+	StackID   string               `json:"stack_id"`
+	Health    string               `json:"health"`
+	CheckedAt time.Time            `json:"checked_at"`
+	Resources []ResourceHealthInfo `json:"resources"`
+}
+
+type ResourceHealthInfo struct {
+	InfrastructureID string `json:"infrastructure_id"`
+	ResourceType     string `json:"resource_type"`
+	ResourceName     string `json:"resource_name"`
+	Health           string `json:"health"`
+	Message          string `json:"message,omitempty"`
+}
+
 // StackOperationRequest for start/stop/restart stack
 type StackOperationRequest struct {
 	Operation string `json:"operation" binding:"required"` // start, stop, restart
 }
 
+// Template parameter types
+const (
+	TemplateParamString = "string"
+	TemplateParamInt    = "int"
+	TemplateParamEnum   = "enum"
+	TemplateParamSecret = "secret"
+)
+
+// TemplateParameter declares a typed input referenced as ${params.<name>} in resource specs
+type TemplateParameter struct {
+	Name          string      `json:"name" binding:"required"`
+	Type          string      `json:"type" binding:"required"` // string, int, enum, secret
+	Description   string      `json:"description"`
+	Required      bool        `json:"required"`
+	Default       interface{} `json:"default,omitempty"`
+	AllowedValues []string    `json:"allowed_values,omitempty"` // enum only
+	Pattern       string      `json:"pattern,omitempty"`        // regexp for string/secret
+	Min           *int        `json:"min,omitempty"`            // int only
+	Max           *int        `json:"max,omitempty"`            // int only
+}
+
 // CreateStackTemplateRequest creates a reusable template
 type CreateStackTemplateRequest struct {
 	Name        string                     `json:"name" binding:"required"`
 	Description string                     `json:"description"`
 	Category    string                     `json:"category"` // web-app, microservice, data-pipeline
 	IsPublic    bool                       `json:"is_public"`
+	Parameters  []TemplateParameter        `json:"parameters"`
 	Resources   []CreateStackResourceInput `json:"resources" binding:"required"`
 }
 
+// PublishTemplateVersionRequest publishes a new immutable version of a template
+type PublishTemplateVersionRequest struct {
+	Description string                     `json:"description"`
+	Changelog   string                     `json:"changelog"`
+	Parameters  []TemplateParameter        `json:"parameters"`
+	Resources   []CreateStackResourceInput `json:"resources" binding:"required"`
+}
+
+// InstantiateTemplateRequest renders a template with parameter values and creates a stack
+type InstantiateTemplateRequest struct {
+	Name        string                 `json:"name" binding:"required"`
+	Description string                 `json:"description"`
+	Environment string                 `json:"environment"`
+	ProjectID   string                 `json:"project_id"`
+	TenantID    string                 `json:"tenant_id"`
+	Tags        []string               `json:"tags"`
+	Version     int                    `json:"version"` // 0 means latest
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
 // StackTemplateInfo represents a template
 type StackTemplateInfo struct {
 	ID          string                     `json:"id"`
@@ -114,19 +193,135 @@ type StackTemplateInfo struct {
 	Category    string                     `json:"category"`
 	IsPublic    bool                       `json:"is_public"`
 	UserID      string                     `json:"user_id"`
+	Version     int                        `json:"version"`
+	Parameters  []TemplateParameter        `json:"parameters"`
 	Resources   []CreateStackResourceInput `json:"resources"`
 	CreatedAt   time.Time                  `json:"created_at"`
+	UpdatedAt   time.Time                  `json:"updated_at"`
+}
+
+// StackTemplateVersionInfo represents one published version of a template
+type StackTemplateVersionInfo struct {
+	TemplateID string                     `json:"template_id"`
+	Version    int                        `json:"version"`
+	Changelog  string                     `json:"changelog,omitempty"`
+	CreatedBy  string                     `json:"created_by"`
+	Parameters []TemplateParameter        `json:"parameters"`
+	Resources  []CreateStackResourceInput `json:"resources"`
+	CreatedAt  time.Time                  `json:"created_at"`
 }
 
 // StackOperationInfo represents an operation on a stack
 type StackOperationInfo struct {
-	ID            string     `json:"id"`
-	StackID       string     `json:"stack_id"`
-	OperationType string     `json:"operation_type"`
-	Status        string     `json:"status"`
-	UserID        string     `json:"user_id"`
-	StartedAt     time.Time  `json:"started_at"`
-	CompletedAt   *time.Time `json:"completed_at,omitempty"`
-	ErrorMessage  string     `json:"error_message,omitempty"`
-	Details       string     `json:"details,omitempty"`
+	ID            string                 `json:"id"`
+	StackID       string                 `json:"stack_id"`
+	OperationType string                 `json:"operation_type"`
+	Status        string                 `json:"status"`
+	UserID        string                 `json:"user_id"`
+	StartedAt     time.Time              `json:"started_at"`
+	CompletedAt   *time.Time             `json:"completed_at,omitempty"`
+	ErrorMessage  string                 `json:"error_message,omitempty"`
+	Details       *StackOperationDetails `json:"details,omitempty"`
+}
+
+// Step statuses within a stack operation
+const (
+	StepPending    = "pending"
+	StepInProgress = "in_progress"
+	StepCompleted  = "completed"
+	StepFailed     = "failed"
+	StepCancelled  = "cancelled"
+)
+
+// StackOperationDetails is the per-resource progress stored with an operation
+type StackOperationDetails struct {
+	TotalSteps     int                  `json:"total_steps"`
+	CompletedSteps int                  `json:"completed_steps"`
+	Progress       int                  `json:"progress"` // percent
+	Steps          []StackOperationStep `json:"steps"`
+}
+
+// StackOperationStep is one resource action of a stack operation
+type StackOperationStep struct {
+	Action           string     `json:"action"` // create, delete, stop, start
+	ResourceName     string     `json:"resource_name,omitempty"`
+	ResourceType     string     `json:"resource_type"`
+	InfrastructureID string     `json:"infrastructure_id,omitempty"`
+	Status           string     `json:"status"`
+	Error            string     `json:"error,omitempty"`
+	StartedAt        *time.Time `json:"started_at,omitempty"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+}
+
+// StackOperationUpdate is pushed over the WebSocket hub whenever an operation progresses
+type StackOperationUpdate struct {
+	Type      string             `json:"type"` // always "stack_operation"
+	Operation StackOperationInfo `json:"operation"`
+	Timestamp string             `json:"timestamp"`
+}
+
+// Drift kinds reported when a container no longer matches its stored definition
+const (
+	DriftMissing        = "missing"
+	DriftStopped        = "stopped"
+	DriftImageMismatch  = "image_mismatch"
+	DriftEnvMismatch    = "env_mismatch"
+	DriftPortMismatch   = "port_mismatch"
+	DriftNetworkMissing = "network_missing"
+	DriftVolumeMissing  = "volume_missing"
+)
+
+// StackDriftReport compares stack records with the containers that actually exist
+type StackDriftReport struct {
+	StackID   string          `json:"stack_id"`
+	StackName string          `json:"stack_name"`
+	Drifted   bool            `json:"drifted"`
+	CheckedAt time.Time       `json:"checked_at"`
+	Resources []ResourceDrift `json:"resources"`
+}
+
+// ResourceDrift lists the containers of one stack resource and their differences
+type ResourceDrift struct {
+	InfrastructureID string           `json:"infrastructure_id"`
+	ResourceType     string           `json:"resource_type"`
+	ResourceName     string           `json:"resource_name"`
+	Drifted          bool             `json:"drifted"`
+	Reconcilable     bool             `json:"reconcilable"` // container can be recreated from stored spec
+	Containers       []ContainerDrift `json:"containers"`
+}
+
+// ContainerDrift describes the actual state of one expected container
+type ContainerDrift struct {
+	ContainerID   string            `json:"container_id"`
+	ContainerName string            `json:"container_name"`
+	Role          string            `json:"role,omitempty"`
+	State         string            `json:"state"` // running, stopped, missing
+	Differences   []DriftDifference `json:"differences,omitempty"`
+}
+
+// DriftDifference is a single mismatch between desired and actual state.
+// Env values are never included, only the variable name.
+type DriftDifference struct {
+	Kind     string `json:"kind"`
+	Field    string `json:"field,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+// StackReconcileResult reports what reconcile did for every drifted container
+type StackReconcileResult struct {
+	StackID string            `json:"stack_id"`
+	Actions []ReconcileAction `json:"actions"`
+	Report  *StackDriftReport `json:"report"` // drift after reconciliation
+}
+
+// ReconcileAction is one corrective step taken by reconcile
+type ReconcileAction struct {
+	InfrastructureID string `json:"infrastructure_id"`
+	ResourceType     string `json:"resource_type"`
+	ContainerName    string `json:"container_name"`
+	Action           string `json:"action"` // restarted, recreated, skipped
+	NewContainerID   string `json:"new_container_id,omitempty"`
+	Reason           string `json:"reason,omitempty"`
+	Error            string `json:"error,omitempty"`
 }
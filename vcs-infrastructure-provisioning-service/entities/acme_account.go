@@ -0,0 +1,21 @@
+package entities
+
+import (
+	"time"
+)
+
+// AcmeAccount is the account registered with an ACME directory. One account is kept
+// per directory URL so switching between Let's Encrypt and Pebble needs no cleanup.
+type AcmeAccount struct {
+	ID           string    `gorm:"primaryKey;type:varchar(36)"`
+	DirectoryURL string    `gorm:"type:varchar(255);not null;uniqueIndex"`
+	Email        string    `gorm:"type:varchar(255)"`
+	URI          string    `gorm:"type:varchar(255)"`
+	PrivateKey   string    `gorm:"type:text;not null;serializer:secret"` // PEM encoded EC key
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+}
+
+func (AcmeAccount) TableName() string {
+	return "acme_accounts"
+}
@@ -6,26 +6,27 @@ import (
 
 // DinDEnvironment - Docker-in-Docker environment entity
 type DinDEnvironment struct {
-	ID               string    `gorm:"primaryKey;type:varchar(36)"`
-	InfrastructureID string    `gorm:"type:varchar(36);not null;index"`
-	Name             string    `gorm:"type:varchar(255);not null"`
-	ContainerID      string    `gorm:"type:varchar(100)"`
-	ContainerName    string    `gorm:"type:varchar(255)"`
-	Status           string    `gorm:"type:varchar(50);default:'creating'"` // creating, running, stopped, failed
-	DockerHost       string    `gorm:"type:varchar(255)"`                   // Docker host endpoint inside DinD
-	IPAddress        string    `gorm:"type:varchar(50)"`
-	ResourcePlan     string    `gorm:"type:varchar(20);default:'medium'"` // small, medium, large
-	CPULimit         string    `gorm:"type:varchar(20)"`
-	MemoryLimit      string    `gorm:"type:varchar(20)"`
-	StorageDriver    string    `gorm:"type:varchar(50);default:'overlay2'"`
-	NetworkID        string    `gorm:"type:varchar(100)"`
-	Description      string    `gorm:"type:text"`
-	AutoCleanup      bool      `gorm:"default:false"`
-	TTLHours         int       `gorm:"default:0"` // 0 = no expiration
-	ExpiresAt        time.Time `gorm:"index"`
-	UserID           string    `gorm:"type:varchar(36);index"`
-	CreatedAt        time.Time `gorm:"autoCreateTime"`
-	UpdatedAt        time.Time `gorm:"autoUpdateTime"`
+	ID                   string    `gorm:"primaryKey;type:varchar(36)"`
+	InfrastructureID     string    `gorm:"type:varchar(36);not null;index"`
+	Name                 string    `gorm:"type:varchar(255);not null"`
+	ContainerID          string    `gorm:"type:varchar(100)"`
+	ContainerName        string    `gorm:"type:varchar(255)"`
+	Status               string    `gorm:"type:varchar(50);default:'creating'"` // creating, running, stopped, failed
+	DockerHost           string    `gorm:"type:varchar(255)"`                   // Docker host endpoint inside DinD
+	IPAddress            string    `gorm:"type:varchar(50)"`
+	ResourcePlan         string    `gorm:"type:varchar(20);default:'medium'"` // small, medium, large
+	CPULimit             string    `gorm:"type:varchar(20)"`
+	MemoryLimit          string    `gorm:"type:varchar(20)"`
+	StorageDriver        string    `gorm:"type:varchar(50);default:'overlay2'"`
+	NetworkID            string    `gorm:"type:varchar(100)"`
+	Description          string    `gorm:"type:text"`
+	AutoCleanup          bool      `gorm:"default:false"`
+	TTLHours             int       `gorm:"default:0"` // 0 = no expiration
+	ExpiresAt            time.Time `gorm:"index"`
+	UserID               string    `gorm:"type:varchar(36);index"`
+	RegistryCredentialID string    `gorm:"type:varchar(36)"` // logged in to inside the environment on create and start
+	CreatedAt            time.Time `gorm:"autoCreateTime"`
+	UpdatedAt            time.Time `gorm:"autoUpdateTime"`
 }
 
 // TableName - Tên bảng trong database
@@ -48,4 +49,3 @@ type DinDCommandHistory struct {
 func (DinDCommandHistory) TableName() string {
 	return "dind_command_history"
 }
-
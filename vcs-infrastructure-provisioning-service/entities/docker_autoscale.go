@@ -0,0 +1,65 @@
+package entities
+
+import "time"
+
+// Docker service autoscaling metrics
+const (
+	DockerAutoscaleCPU      = "cpu"      // average CPU percent of the replica limit, or of one core without a limit
+	DockerAutoscaleMemory   = "memory"   // average memory percent of the replica limit
+	DockerAutoscaleRequests = "requests" // requests per second per replica, from fronting nginx access logs
+)
+
+// Scaling event statuses
+const (
+	DockerScalingSucceeded = "succeeded"
+	DockerScalingFailed    = "failed"
+)
+
+// DockerAutoscalePolicy scales a Docker service between MinReplicas and MaxReplicas. The
+// gap between ScaleDownThreshold and ScaleUpThreshold is the hysteresis band; a threshold
+// must be crossed Evaluations times in a row, and not within the cooldown of the previous
+// scaling, before replicas change.
+type DockerAutoscalePolicy struct {
+	ID                 string  `gorm:"primaryKey;type:varchar(36)"`
+	ServiceID          string  `gorm:"type:varchar(36);not null;uniqueIndex"`
+	Enabled            bool    `gorm:"default:true"`
+	MinReplicas        int     `gorm:"default:1"`
+	MaxReplicas        int     `gorm:"default:1"`
+	Metric             string  `gorm:"type:varchar(20);not null"`
+	ScaleUpThreshold   float64 `gorm:"not null"`
+	ScaleDownThreshold float64 `gorm:"not null"`
+	Evaluations        int     `gorm:"default:3"`
+	ScaleUpCooldown    int     `gorm:"default:60"`  // seconds
+	ScaleDownCooldown  int     `gorm:"default:300"` // seconds
+
+	LastValue       float64
+	LastEvaluatedAt *time.Time
+	LastScaledAt    *time.Time
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+func (DockerAutoscalePolicy) TableName() string {
+	return "docker_autoscale_policies"
+}
+
+// DockerScalingEvent records a replica change decided by the autoscaler
+type DockerScalingEvent struct {
+	ID               string `gorm:"primaryKey;type:varchar(36)"`
+	ServiceID        string `gorm:"type:varchar(36);not null;index"`
+	FromReplicas     int    `gorm:"not null"`
+	ToReplicas       int    `gorm:"not null"`
+	Metric           string `gorm:"type:varchar(20)"`
+	Value            float64
+	Threshold        float64
+	Reason           string    `gorm:"type:varchar(500)"`
+	Status           string    `gorm:"type:varchar(20)"`
+	Error            string    `gorm:"type:text"`
+	UpstreamsUpdated int       `gorm:"default:0"` // fronting nginx upstreams re-pointed at the new replicas
+	CreatedAt        time.Time `gorm:"autoCreateTime;index"`
+}
+
+func (DockerScalingEvent) TableName() string {
+	return "docker_scaling_events"
+}
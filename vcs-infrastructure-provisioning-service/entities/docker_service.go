@@ -5,37 +5,90 @@ import (
 )
 
 type DockerService struct {
-	ID               string             `gorm:"primaryKey;type:varchar(36)"`
-	InfrastructureID string             `gorm:"type:varchar(36);not null;index"`
-	Infrastructure   Infrastructure     `gorm:"foreignKey:InfrastructureID"`
-	Name             string             `gorm:"type:varchar(255);not null"`
-	Image            string             `gorm:"type:varchar(500);not null"`
-	ImageTag         string             `gorm:"type:varchar(100);not null"`
-	ServiceType      string             `gorm:"type:varchar(50);default:'web'"`
-	ContainerID      string             `gorm:"type:varchar(100)"`
-	ContainerName    string             `gorm:"type:varchar(255)"`
-	Command          string             `gorm:"type:text"`
-	Args             string             `gorm:"type:text"`
-	EnvVars          []DockerEnvVar     `gorm:"foreignKey:ServiceID"`
-	Ports            []DockerPort       `gorm:"foreignKey:ServiceID"`
-	Networks         []DockerNetwork    `gorm:"foreignKey:ServiceID"`
-	HealthCheck      *DockerHealthCheck `gorm:"foreignKey:ServiceID"`
-	RestartPolicy    string             `gorm:"type:varchar(50);default:'unless-stopped'"`
-	MaxRetries       int                `gorm:"default:3"`
-	CPULimit         int64              `gorm:"default:0"`
-	MemoryLimit      int64              `gorm:"default:0"`
-	Status           string             `gorm:"type:varchar(50);default:'creating'"`
-	IPAddress        string             `gorm:"type:varchar(50)"`
-	InternalEndpoint string             `gorm:"type:varchar(255)"`
-	CreatedAt        time.Time          `gorm:"autoCreateTime"`
-	UpdatedAt        time.Time          `gorm:"autoUpdateTime"`
+	ID                   string                 `gorm:"primaryKey;type:varchar(36)"`
+	InfrastructureID     string                 `gorm:"type:varchar(36);not null;index"`
+	Infrastructure       Infrastructure         `gorm:"foreignKey:InfrastructureID"`
+	Name                 string                 `gorm:"type:varchar(255);not null"`
+	Image                string                 `gorm:"type:varchar(500);not null"`
+	ImageTag             string                 `gorm:"type:varchar(100);not null"`
+	ImageDigest          string                 `gorm:"type:varchar(100)"` // sha256 digest ImageTag resolved to, replicas run image@digest
+	PullPolicy           string                 `gorm:"type:varchar(20);default:'if-not-present'"`
+	RegistryCredentialID string                 `gorm:"type:varchar(36);index"`
+	ServiceType          string                 `gorm:"type:varchar(50);default:'web'"`
+	ContainerID          string                 `gorm:"type:varchar(100)"`
+	ContainerName        string                 `gorm:"type:varchar(255)"`
+	Command              string                 `gorm:"type:text"`
+	Args                 string                 `gorm:"type:text"`
+	EnvVars              []DockerEnvVar         `gorm:"foreignKey:ServiceID"`
+	Ports                []DockerPort           `gorm:"foreignKey:ServiceID"`
+	Networks             []DockerNetwork        `gorm:"foreignKey:ServiceID"`
+	Volumes              []DockerVolumeMount    `gorm:"foreignKey:ServiceID"`
+	HealthCheck          *DockerHealthCheck     `gorm:"foreignKey:ServiceID"`
+	RestartPolicy        string                 `gorm:"type:varchar(50);default:'unless-stopped'"`
+	MaxRetries           int                    `gorm:"default:3"`
+	CPULimit             int64                  `gorm:"default:0"`
+	MemoryLimit          int64                  `gorm:"default:0"`
+	Status               string                 `gorm:"type:varchar(50);default:'creating'"`
+	IPAddress            string                 `gorm:"type:varchar(50)"`
+	InternalEndpoint     string                 `gorm:"type:varchar(255)"`
+	Replicas             int                    `gorm:"default:1"`
+	ServiceAlias         string                 `gorm:"type:varchar(255)"` // DNS alias shared by every replica
+	MaxSurge             int                    `gorm:"default:1"`
+	MaxUnavailable       int                    `gorm:"default:0"`
+	RolloutStatus        string                 `gorm:"type:varchar(50)"`
+	RolloutMessage       string                 `gorm:"type:text"`
+	Containers           []DockerServiceReplica `gorm:"foreignKey:ServiceID"`
+	CreatedAt            time.Time              `gorm:"autoCreateTime"`
+	UpdatedAt            time.Time              `gorm:"autoUpdateTime"`
+}
+
+// Docker service rollout statuses
+const (
+	DockerRolloutInProgress = "in_progress"
+	DockerRolloutCompleted  = "completed"
+	DockerRolloutRolledBack = "rolled_back"
+	DockerRolloutFailed     = "failed" // the rollback itself did not restore every replica
+)
+
+// Docker service health check types
+const (
+	DockerHealthCheckHTTP    = "http"
+	DockerHealthCheckTCP     = "tcp"
+	DockerHealthCheckCommand = "command"
+)
+
+// Docker health statuses of replicas and DockerHealthCheck.Status
+const (
+	DockerHealthUnknown   = "unknown"
+	DockerHealthStarting  = "starting"
+	DockerHealthHealthy   = "healthy"
+	DockerHealthUnhealthy = "unhealthy"
+)
+
+// DockerServiceReplica is one of the containers running a Docker service. ContainerID on
+// the service mirrors the oldest replica.
+type DockerServiceReplica struct {
+	ID            string    `gorm:"primaryKey;type:varchar(36)"`
+	ServiceID     string    `gorm:"type:varchar(36);not null;index"`
+	ContainerID   string    `gorm:"type:varchar(100)"`
+	ContainerName string    `gorm:"type:varchar(255)"`
+	ImageTag      string    `gorm:"type:varchar(100)"`
+	Status        string    `gorm:"type:varchar(50);default:'creating'"`
+	Health        string    `gorm:"type:varchar(20)"` // from Docker health_status events, empty without a health check
+	IPAddress     string    `gorm:"type:varchar(50)"`
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime"`
+}
+
+func (DockerServiceReplica) TableName() string {
+	return "docker_service_replicas"
 }
 
 type DockerEnvVar struct {
 	ID        string    `gorm:"primaryKey;type:varchar(36)"`
 	ServiceID string    `gorm:"type:varchar(36);not null;index"`
 	Key       string    `gorm:"type:varchar(255);not null"`
-	Value     string    `gorm:"type:text"`
+	Value     string    `gorm:"type:text;serializer:secret"` // encrypted at rest, IsSecret only controls masking
 	IsSecret  bool      `gorm:"default:false"`
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 }
@@ -0,0 +1,69 @@
+package entities
+
+import "time"
+
+// DockerVolume is a named Docker volume owned by a user. Docker services mount it through
+// DockerVolumeMount and it outlives them; DockerName derives from the ID so volumes of
+// different users never clash.
+type DockerVolume struct {
+	ID            string `gorm:"primaryKey;type:varchar(36)"`
+	UserID        string `gorm:"type:varchar(36);not null;uniqueIndex:idx_docker_volumes_user_name"`
+	Name          string `gorm:"type:varchar(100);not null;uniqueIndex:idx_docker_volumes_user_name"`
+	DockerName    string `gorm:"type:varchar(255);not null;uniqueIndex"`
+	Driver        string `gorm:"type:varchar(50);default:'local'"`
+	SizeBytes     int64  `gorm:"default:-1"` // last size reported by Docker, -1 when unknown
+	SizeCheckedAt time.Time
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime"`
+}
+
+func (DockerVolume) TableName() string {
+	return "docker_volumes"
+}
+
+// Docker volume mount types
+const (
+	DockerMountVolume = "volume"
+	DockerMountBind   = "bind"
+)
+
+// DockerVolumeMount mounts a volume or a host directory into every replica of a Docker service
+type DockerVolumeMount struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)"`
+	ServiceID string    `gorm:"type:varchar(36);not null;index"`
+	Type      string    `gorm:"type:varchar(10);not null"`
+	VolumeID  string    `gorm:"type:varchar(36);index"`     // volume mounts only
+	Source    string    `gorm:"type:varchar(500);not null"` // Docker volume name, or host directory of a bind mount
+	Target    string    `gorm:"type:varchar(500);not null"`
+	ReadOnly  bool      `gorm:"default:false"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (DockerVolumeMount) TableName() string {
+	return "docker_volume_mounts"
+}
+
+// Docker volume snapshot statuses
+const (
+	DockerSnapshotCreating = "creating"
+	DockerSnapshotReady    = "ready"
+	DockerSnapshotFailed   = "failed"
+)
+
+// DockerVolumeSnapshot is a gzipped tar archive of a volume, kept in the snapshot volume
+type DockerVolumeSnapshot struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)"`
+	VolumeID   string    `gorm:"type:varchar(36);not null;index"`
+	Name       string    `gorm:"type:varchar(100)"`
+	Archive    string    `gorm:"type:varchar(255);not null"` // file name within the snapshot volume
+	SizeBytes  int64     `gorm:"default:0"`
+	Status     string    `gorm:"type:varchar(20);default:'creating'"`
+	Error      string    `gorm:"type:text"`
+	RestoredAt time.Time // last time the volume was restored from it
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+}
+
+func (DockerVolumeSnapshot) TableName() string {
+	return "docker_volume_snapshots"
+}
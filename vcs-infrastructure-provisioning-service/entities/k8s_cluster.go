@@ -27,12 +27,12 @@ type K8sCluster struct {
 	MemoryLimit      string         `gorm:"type:varchar(50)" json:"memory_limit"`  // e.g., "2Gi"
 	
 	// Kubeconfig
-	Kubeconfig       string         `gorm:"type:text" json:"kubeconfig"`
+	Kubeconfig       string         `gorm:"type:text;serializer:secret" json:"kubeconfig"`
 	
 	// Dashboard
 	DashboardEnabled bool           `gorm:"default:true" json:"dashboard_enabled"`
 	DashboardPort    int            `gorm:"default:0" json:"dashboard_port"`
-	DashboardToken   string         `gorm:"type:text" json:"dashboard_token"`
+	DashboardToken   string         `gorm:"type:text;serializer:secret" json:"dashboard_token"`
 	
 	// Addons
 	IngressEnabled   bool           `gorm:"default:false" json:"ingress_enabled"`
@@ -17,6 +17,8 @@ type NginxCluster struct {
 	VirtualIP           string `gorm:"type:varchar(45)"` // VIP managed by Keepalived
 	VRRPInterface       string `gorm:"type:varchar(20);default:'eth0'"`
 	VRRPRouterID        int    `gorm:"default:51"`
+	VRRPAuthPass        string `gorm:"type:text;serializer:secret"` // keepalived PASS auth uses at most 8 characters
+	VRRPSubnet          string `gorm:"type:varchar(43)"`            // subnet of the cluster network the VIP lives on
 	HealthCheckEnabled  bool   `gorm:"default:true"`
 	HealthCheckPath     string `gorm:"type:varchar(255);default:'/health'"`
 	HealthCheckInterval int    `gorm:"default:5"`
@@ -32,7 +34,7 @@ type NginxCluster struct {
 	// SSL/TLS
 	SSLEnabled        bool   `gorm:"default:false"`
 	SSLCertificate    string `gorm:"type:text"`
-	SSLPrivateKey     string `gorm:"type:text"`
+	SSLPrivateKey     string `gorm:"type:text;serializer:secret"`
 	SSLProtocols      string `gorm:"type:varchar(100);default:'TLSv1.2 TLSv1.3'"`
 	SSLSessionTimeout string `gorm:"type:varchar(20);default:'1d'"`
 
@@ -46,6 +48,10 @@ type NginxCluster struct {
 	AccessLogEnabled bool   `gorm:"default:true"`
 	ErrorLogLevel    string `gorm:"type:varchar(20);default:'warn'"`
 
+	// Web application firewall (ModSecurity with the OWASP Core Rule Set)
+	WAFEnabled bool   `gorm:"default:false"` // nodes run the ModSecurity image
+	WAFMode    string `gorm:"type:varchar(20);default:'off'"`
+
 	// Caching
 	CacheEnabled bool   `gorm:"default:false"`
 	CachePath    string `gorm:"type:varchar(255)"`
@@ -128,8 +134,16 @@ type NginxUpstreamServer struct {
 	FailTimeout int                  `gorm:"default:30"` // seconds
 	IsBackup    bool                 `gorm:"default:false"`
 	IsDown      bool                 `gorm:"default:false"`
-	CreatedAt   time.Time            `gorm:"autoCreateTime"`
-	UpdatedAt   time.Time            `gorm:"autoUpdateTime"`
+	// Set when the server points at a replica of a Docker service, kept in sync as it scales
+	DockerServiceID string `gorm:"type:varchar(36);index"`
+
+	// Last active health check
+	LastCheckedAt *time.Time
+	LatencyMs     int64
+	LastError     string `gorm:"type:varchar(500)"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 }
 
 func (NginxUpstreamServer) TableName() string {
@@ -147,6 +161,7 @@ type NginxServerBlock struct {
 	SSLCertID  string       `gorm:"type:varchar(36)"`
 	RootPath   string       `gorm:"type:varchar(255)"`
 	IndexFiles string       `gorm:"type:varchar(255);default:'index.html index.htm'"`
+	WAFMode    string       `gorm:"type:varchar(20)"` // off, detection_only, blocking; empty follows the cluster
 	CreatedAt  time.Time    `gorm:"autoCreateTime"`
 	UpdatedAt  time.Time    `gorm:"autoUpdateTime"`
 }
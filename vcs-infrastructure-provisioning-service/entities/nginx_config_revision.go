@@ -0,0 +1,40 @@
+package entities
+
+import (
+	"time"
+)
+
+// Nginx config revision resource types
+const (
+	NginxRevisionInstance = "instance"
+	NginxRevisionCluster  = "cluster"
+)
+
+// Nginx config revision validation results
+const (
+	NginxRevisionValid     = "valid"
+	NginxRevisionInvalid   = "invalid"
+	NginxRevisionUnhealthy = "unhealthy"
+	NginxRevisionPending   = "pending" // stored while the container was stopped, validated on start
+)
+
+// NginxConfigRevision is an immutable record of a config applied to an Nginx instance or cluster
+type NginxConfigRevision struct {
+	ID               string    `gorm:"primaryKey;type:varchar(36)"`
+	ResourceType     string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_nginx_config_revision"`
+	ResourceID       string    `gorm:"type:varchar(36);not null;uniqueIndex:idx_nginx_config_revision"`
+	Revision         int       `gorm:"not null;uniqueIndex:idx_nginx_config_revision"`
+	Config           string    `gorm:"type:text"`                   // Rendered config as written to the container
+	Snapshot         string    `gorm:"type:text;serializer:secret"` // Entities the config was rendered from, used for rollback; holds keys and passwords
+	Diff             string    `gorm:"type:text"`                   // Unified diff against the previous revision
+	Action           string    `gorm:"type:varchar(50)"`
+	Author           string    `gorm:"type:varchar(36)"`
+	ValidationStatus string    `gorm:"type:varchar(20)"`
+	ValidationOutput string    `gorm:"type:text"`
+	RollbackOf       int       `gorm:"default:0"` // Revision restored by this one, 0 if not a rollback
+	CreatedAt        time.Time `gorm:"autoCreateTime"`
+}
+
+func (NginxConfigRevision) TableName() string {
+	return "nginx_config_revisions"
+}
@@ -11,15 +11,18 @@ type NginxInstance struct {
 	ContainerID      string            `gorm:"type:varchar(100)"`
 	Port             int               `gorm:"not null"`
 	SSLPort          int               `gorm:"default:0"`
-	Config           string            `gorm:"type:text"`
+	Config           string            `gorm:"type:text"` // as given at creation, stored but never rendered
+	CustomDirectives string            `gorm:"type:text"` // server-level directives rendered into the generated server block
 	VolumeID         string            `gorm:"type:varchar(255)"`
 	NetworkID        string            `gorm:"type:varchar(255)"`
 	CPULimit         int64             `gorm:"default:0"`
 	MemoryLimit      int64             `gorm:"default:0"`
+	WAFEnabled       bool              `gorm:"default:false"`                  // created from the ModSecurity image
+	WAFMode          string            `gorm:"type:varchar(20);default:'off'"` // off, detection_only, blocking
 	Domains          []NginxDomain     `gorm:"foreignKey:NginxID"`
 	Routes           []NginxRoute      `gorm:"foreignKey:NginxID"`
 	Upstreams        []NginxUpstream   `gorm:"foreignKey:NginxID"`
-	Certificate      *NginxCertificate `gorm:"foreignKey:NginxID"`
+	Certificate      *NginxCertificate `gorm:"foreignKey:NginxID;constraint:-"` // certificates may also belong to cluster server blocks
 	SecurityPolicy   *NginxSecurity    `gorm:"foreignKey:NginxID"`
 	CreatedAt        time.Time         `gorm:"autoCreateTime"`
 	UpdatedAt        time.Time         `gorm:"autoUpdateTime"`
@@ -33,11 +36,20 @@ type NginxDomain struct {
 }
 
 type NginxRoute struct {
-	ID        string    `gorm:"primaryKey;type:varchar(36)"`
-	NginxID   string    `gorm:"type:varchar(36);not null;index"`
-	Path      string    `gorm:"type:varchar(255);not null"`
-	Backend   string    `gorm:"type:varchar(255);not null"`
-	Priority  int       `gorm:"default:0"`
+	ID       string `gorm:"primaryKey;type:varchar(36)"`
+	NginxID  string `gorm:"type:varchar(36);not null;index"`
+	Path     string `gorm:"type:varchar(255);not null"`
+	Backend  string `gorm:"type:varchar(255);not null"`
+	Priority int    `gorm:"default:0"`
+
+	// Canary: a second backend receiving CanaryWeight percent of clients, plus every
+	// request whose CanaryHeader or CanaryCookie equals CanaryMatchValue
+	CanaryBackend    string `gorm:"type:varchar(255)"`
+	CanaryWeight     int    `gorm:"default:0"`
+	CanaryHeader     string `gorm:"type:varchar(100)"`
+	CanaryCookie     string `gorm:"type:varchar(100)"`
+	CanaryMatchValue string `gorm:"type:varchar(255)"`
+
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 }
@@ -53,24 +65,50 @@ type NginxUpstream struct {
 }
 
 type NginxUpstreamBackend struct {
-	ID         string    `gorm:"primaryKey;type:varchar(36)"`
-	UpstreamID string    `gorm:"type:varchar(36);not null;index"`
-	Address    string    `gorm:"type:varchar(255);not null"`
-	Weight     int       `gorm:"default:1"`
-	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	ID         string `gorm:"primaryKey;type:varchar(36)"`
+	UpstreamID string `gorm:"type:varchar(36);not null;index"`
+	Address    string `gorm:"type:varchar(255);not null"`
+	Weight     int    `gorm:"default:1"`
+	IsDown     bool   `gorm:"default:false"` // failed active health checks, left out of the config
+	// Set when the backend points at a replica of a Docker service, kept in sync as it scales
+	DockerServiceID string `gorm:"type:varchar(36);index"`
+
+	// Last active health check
+	LastCheckedAt *time.Time
+	LatencyMs     int64
+	LastError     string `gorm:"type:varchar(500)"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
 }
 
+// Certificate sources
+const (
+	CertificateSourceManual = "manual"
+	CertificateSourceAcme   = "acme"
+)
+
+// Certificate owners. NginxID holds the instance ID or the cluster server block ID.
+const (
+	CertificateOwnerInstance    = "instance"
+	CertificateOwnerServerBlock = "server_block"
+)
+
 type NginxCertificate struct {
-	ID          string `gorm:"primaryKey;type:varchar(36)"`
-	NginxID     string `gorm:"type:varchar(36);not null;index;unique"`
-	Domain      string `gorm:"type:varchar(255);not null"`
-	Certificate string `gorm:"type:text;not null"`
-	PrivateKey  string `gorm:"type:text;not null"`
-	Status      string `gorm:"type:varchar(50);default:'valid'"`
-	ExpiresAt   time.Time
-	Issuer      string    `gorm:"type:varchar(255)"`
-	CreatedAt   time.Time `gorm:"autoCreateTime"`
-	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+	ID            string `gorm:"primaryKey;type:varchar(36)"`
+	NginxID       string `gorm:"type:varchar(36);not null;index;unique"`
+	OwnerType     string `gorm:"type:varchar(20);default:'instance'"`
+	Domain        string `gorm:"type:varchar(255);not null"` // comma separated for multi-domain certificates
+	Certificate   string `gorm:"type:text;not null"`
+	PrivateKey    string `gorm:"type:text;not null;serializer:secret"`
+	Status        string `gorm:"type:varchar(50);default:'valid'"`
+	ExpiresAt     time.Time
+	Issuer        string `gorm:"type:varchar(255)"`
+	Source        string `gorm:"type:varchar(20);default:'manual'"`
+	AutoRenew     bool   `gorm:"default:false"`
+	LastRenewalAt *time.Time
+	RenewalError  string    `gorm:"type:text"`
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime"`
 }
 
 type NginxSecurity struct {
@@ -82,7 +120,7 @@ type NginxSecurity struct {
 	AllowIPs          string    `gorm:"type:text"`
 	DenyIPs           string    `gorm:"type:text"`
 	BasicAuthUsername string    `gorm:"type:varchar(255)"`
-	BasicAuthPassword string    `gorm:"type:varchar(255)"`
+	BasicAuthPassword string    `gorm:"type:text;serializer:secret"`
 	BasicAuthRealm    string    `gorm:"type:varchar(255)"`
 	CreatedAt         time.Time `gorm:"autoCreateTime"`
 	UpdatedAt         time.Time `gorm:"autoUpdateTime"`
@@ -0,0 +1,29 @@
+package entities
+
+import (
+	"time"
+)
+
+// Nginx WAF modes
+const (
+	NginxWAFOff           = "off"
+	NginxWAFDetectionOnly = "detection_only" // rules are evaluated and logged, nothing is blocked
+	NginxWAFBlocking      = "blocking"
+)
+
+// NginxWAFExclusion turns off an OWASP CRS rule for an Nginx instance or cluster, either
+// entirely or for one target, optionally only below a path prefix
+type NginxWAFExclusion struct {
+	ID           string    `gorm:"primaryKey;type:varchar(36)"`
+	ResourceType string    `gorm:"type:varchar(20);not null;index:idx_nginx_waf_exclusion_resource"` // NginxRevisionInstance or NginxRevisionCluster
+	ResourceID   string    `gorm:"type:varchar(36);not null;index:idx_nginx_waf_exclusion_resource"`
+	RuleID       int       `gorm:"not null"`
+	Target       string    `gorm:"type:varchar(255)"` // e.g. ARGS:password, empty for the whole rule
+	PathPrefix   string    `gorm:"type:varchar(255)"` // empty for every request
+	Comment      string    `gorm:"type:varchar(500)"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+func (NginxWAFExclusion) TableName() string {
+	return "nginx_waf_exclusions"
+}
@@ -14,7 +14,7 @@ type PostgreSQLCluster struct {
 	Version            string         `gorm:"type:varchar(20);not null"`
 	DatabaseName       string         `gorm:"type:varchar(100);not null"`
 	Username           string         `gorm:"type:varchar(100);not null"`
-	Password           string         `gorm:"type:varchar(255);not null"`
+	Password           string         `gorm:"type:text;not null;serializer:secret"`
 	ReplicationMode    string         `gorm:"type:varchar(10);default:'async'"` // async or sync
 	HAProxyPort        int            `gorm:"not null"`
 	NetworkID          string         `gorm:"type:varchar(255)"`
@@ -8,7 +8,7 @@ type PostgresDatabase struct {
 	Instance       PostgreSQLInstance `gorm:"foreignKey:InstanceID;references:ID"`
 	DBName         string             `gorm:"type:varchar(100);not null;uniqueIndex:idx_instance_dbname"`
 	OwnerUsername  string             `gorm:"type:varchar(100);not null"`
-	OwnerPassword  string             `gorm:"type:varchar(255);not null"`
+	OwnerPassword  string             `gorm:"type:text;not null;serializer:secret"`
 	ProjectID      string             `gorm:"type:varchar(100);index"`
 	TenantID       string             `gorm:"type:varchar(100);index"`
 	EnvironmentID  string             `gorm:"type:varchar(100)"`
@@ -13,7 +13,7 @@ type PostgreSQLInstance struct {
 	Port             int            `gorm:"not null"`
 	DatabaseName     string         `gorm:"type:varchar(100);not null"`
 	Username         string         `gorm:"type:varchar(100);not null"`
-	Password         string         `gorm:"type:varchar(255);not null"`
+	Password         string         `gorm:"type:text;not null;serializer:secret"`
 	CPULimit         int64          `gorm:"default:0"`
 	MemoryLimit      int64          `gorm:"default:0"`
 	StorageSize      int64          `gorm:"default:10737418240"`
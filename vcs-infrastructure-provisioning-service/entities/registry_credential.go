@@ -0,0 +1,21 @@
+package entities
+
+import "time"
+
+// RegistryCredential logs in to a private container registry. It belongs to a user and may be
+// labelled with a project; Docker services and DinD environments reference it by ID or name.
+type RegistryCredential struct {
+	ID            string    `gorm:"primaryKey;type:varchar(36)"`
+	UserID        string    `gorm:"type:varchar(36);not null;uniqueIndex:idx_registry_credentials_user_name"`
+	ProjectID     string    `gorm:"type:varchar(36);index"`
+	Name          string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_registry_credentials_user_name"`
+	ServerAddress string    `gorm:"type:varchar(255);not null"` // e.g. ghcr.io or registry.example.com:5000
+	Username      string    `gorm:"type:varchar(255);not null"`
+	Password      string    `gorm:"type:text;serializer:secret"` // password or access token
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime"`
+}
+
+func (RegistryCredential) TableName() string {
+	return "registry_credentials"
+}
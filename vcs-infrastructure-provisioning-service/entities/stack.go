@@ -16,6 +16,16 @@ const (
 	StackStatusDeleted  StackStatus = "deleted"
 )
 
+// StackHealth is rolled up from the live state of a stack's resources
+type StackHealth string
+
+const (
+	StackHealthUnknown  StackHealth = "unknown"
+	StackHealthHealthy  StackHealth = "healthy"
+	StackHealthDegraded StackHealth = "degraded"
+	StackHealthDown     StackHealth = "down"
+)
+
 // Stack represents a logical grouping of infrastructure resources
 // Examples: "tenant-123-prod", "project-abc-staging"
 type Stack struct {
@@ -31,6 +41,14 @@ type Stack struct {
 	CreatedAt   time.Time   `gorm:"autoCreateTime"`
 	UpdatedAt   time.Time   `gorm:"autoUpdateTime"`
 
+	// Template provenance (empty when the stack was created from raw resources)
+	TemplateID      string `gorm:"type:varchar(36);index"`
+	TemplateVersion int    `gorm:"default:0"`
+	TemplateParams  string `gorm:"type:jsonb"` // JSON object of parameter values, secrets masked
+
+	Health          StackHealth `gorm:"type:varchar(20);default:'unknown';index"`
+	HealthCheckedAt *time.Time
+
 	// Relations
 	Resources []StackResource `gorm:"foreignKey:StackID"`
 }
@@ -44,6 +62,8 @@ type StackResource struct {
 	Role             string    `gorm:"type:varchar(50)"`          // gateway, database, app, cache, queue
 	DependsOn        string    `gorm:"type:jsonb"`                // JSON array of resource IDs this depends on
 	Order            int       `gorm:"type:int;default:0"`        // Creation order (lower first)
+	Health           string    `gorm:"type:varchar(20);default:'unknown'"`
+	HealthMessage    string    `gorm:"type:text"`
 	CreatedAt        time.Time `gorm:"autoCreateTime"`
 	UpdatedAt        time.Time `gorm:"autoUpdateTime"`
 
@@ -60,22 +80,49 @@ type StackTemplate struct {
 	Category    string    `gorm:"type:varchar(50);index"` // web-app, microservice, data-pipeline
 	IsPublic    bool      `gorm:"default:false"`
 	UserID      string    `gorm:"type:varchar(36);index"`
-	Spec        string    `gorm:"type:jsonb;not null"` // JSON template specification
+	Spec        string    `gorm:"type:jsonb;not null"` // JSON template specification (latest version)
+	Parameters  string    `gorm:"type:jsonb"`          // JSON array of parameter definitions (latest version)
+	Version     int       `gorm:"default:1"`           // Latest published version
 	CreatedAt   time.Time `gorm:"autoCreateTime"`
 	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+
+	// Relations
+	Versions []StackTemplateVersion `gorm:"foreignKey:TemplateID"`
+}
+
+// StackTemplateVersion is an immutable snapshot of a template's parameters and spec
+type StackTemplateVersion struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)"`
+	TemplateID string    `gorm:"type:varchar(36);not null;uniqueIndex:idx_template_version"`
+	Version    int       `gorm:"not null;uniqueIndex:idx_template_version"`
+	Parameters string    `gorm:"type:jsonb"`          // JSON array of parameter definitions
+	Spec       string    `gorm:"type:jsonb;not null"` // JSON array of resource inputs with ${params.*} placeholders
+	Changelog  string    `gorm:"type:text"`
+	CreatedBy  string    `gorm:"type:varchar(36)"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
 }
 
+// Stack operation statuses
+const (
+	StackOperationPending    = "PENDING"
+	StackOperationInProgress = "IN_PROGRESS"
+	StackOperationCompleted  = "COMPLETED"
+	StackOperationFailed     = "FAILED"
+	StackOperationCancelled  = "CANCELLED"
+)
+
 // StackOperation tracks operations performed on stacks
 type StackOperation struct {
 	ID            string    `gorm:"primaryKey;type:varchar(36)"`
 	StackID       string    `gorm:"type:varchar(36);not null;index"`
-	OperationType string    `gorm:"type:varchar(50);not null"` // CREATE, UPDATE, DELETE, CLONE, START, STOP
-	Status        string    `gorm:"type:varchar(50);not null"` // PENDING, IN_PROGRESS, COMPLETED, FAILED
+	OperationType string    `gorm:"type:varchar(50);not null"` // CREATE, UPDATE, DELETE, CLONE, START, STOP, RESTART
+	Status        string    `gorm:"type:varchar(50);not null"` // PENDING, IN_PROGRESS, COMPLETED, FAILED, CANCELLED
 	UserID        string    `gorm:"type:varchar(36);not null"`
 	StartedAt     time.Time `gorm:"autoCreateTime"`
 	CompletedAt   *time.Time
 	ErrorMessage  string `gorm:"type:text"`
-	Details       string `gorm:"type:jsonb"` // JSON details about the operation
+	Details       string `gorm:"type:jsonb"`                  // JSON step progress of the operation
+	Request       string `gorm:"type:text;serializer:secret"` // JSON input needed to resume the operation, cleared once it finishes; may hold passwords
 
 	// Relations
 	Stack Stack `gorm:"foreignKey:StackID"`
@@ -0,0 +1,33 @@
+-- Migration: 008_stack_template_versions.sql
+-- Description: Parameterised, versioned stack templates
+
+ALTER TABLE stack_templates ADD COLUMN IF NOT EXISTS parameters JSONB;
+ALTER TABLE stack_templates ADD COLUMN IF NOT EXISTS version INT DEFAULT 1;
+
+-- Immutable snapshots of every published template version
+CREATE TABLE IF NOT EXISTS stack_template_versions (
+    id VARCHAR(36) PRIMARY KEY,
+    template_id VARCHAR(36) NOT NULL,
+    version INT NOT NULL,
+    parameters JSONB,
+    spec JSONB NOT NULL,
+    changelog TEXT,
+    created_by VARCHAR(36),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (template_id) REFERENCES stack_templates(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_template_version ON stack_template_versions(template_id, version);
+
+-- Backfill version 1 for templates created before versioning
+INSERT INTO stack_template_versions (id, template_id, version, parameters, spec, changelog, created_by, created_at)
+SELECT id, id, 1, COALESCE(parameters, '[]'::jsonb), spec, 'Initial version', user_id, created_at
+FROM stack_templates
+ON CONFLICT DO NOTHING;
+
+-- Record which template version a stack was instantiated from
+ALTER TABLE stacks ADD COLUMN IF NOT EXISTS template_id VARCHAR(36);
+ALTER TABLE stacks ADD COLUMN IF NOT EXISTS template_version INT DEFAULT 0;
+ALTER TABLE stacks ADD COLUMN IF NOT EXISTS template_params JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_stacks_template_id ON stacks(template_id);
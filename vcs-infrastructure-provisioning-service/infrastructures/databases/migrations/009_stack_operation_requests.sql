@@ -0,0 +1,5 @@
+-- Migration: 009_stack_operation_requests.sql
+-- Description: Asynchronous stack operations that can be resumed after a restart
+
+-- Input needed to resume a queued or interrupted operation, cleared once it finishes
+ALTER TABLE stack_operations ADD COLUMN IF NOT EXISTS request JSONB;
@@ -0,0 +1,10 @@
+-- Migration: 010_stack_health.sql
+-- Description: Stack health rolled up from the live state of its resources
+
+ALTER TABLE stacks ADD COLUMN IF NOT EXISTS health VARCHAR(20) DEFAULT 'unknown';
+ALTER TABLE stacks ADD COLUMN IF NOT EXISTS health_checked_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_stacks_health ON stacks(health);
+
+ALTER TABLE stack_resources ADD COLUMN IF NOT EXISTS health VARCHAR(20) DEFAULT 'unknown';
+ALTER TABLE stack_resources ADD COLUMN IF NOT EXISTS health_message TEXT;
@@ -0,0 +1,20 @@
+-- Migration: 011_nginx_config_revisions.sql
+-- Description: Immutable history of configs applied to Nginx instances and clusters
+
+CREATE TABLE IF NOT EXISTS nginx_config_revisions (
+    id VARCHAR(36) PRIMARY KEY,
+    resource_type VARCHAR(20) NOT NULL,
+    resource_id VARCHAR(36) NOT NULL,
+    revision INT NOT NULL,
+    config TEXT,
+    snapshot TEXT,
+    diff TEXT,
+    action VARCHAR(50),
+    author VARCHAR(36),
+    validation_status VARCHAR(20),
+    validation_output TEXT,
+    rollback_of INT DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_nginx_config_revision ON nginx_config_revisions(resource_type, resource_id, revision);
@@ -0,0 +1,25 @@
+-- Migration: 012_acme_certificates.sql
+-- Description: ACME accounts and automatic renewal tracking for Nginx certificates
+
+CREATE TABLE IF NOT EXISTS acme_accounts (
+    id VARCHAR(36) PRIMARY KEY,
+    directory_url VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    uri VARCHAR(255),
+    private_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_acme_accounts_directory_url ON acme_accounts(directory_url);
+
+-- Certificates can now belong to cluster server blocks, so nginx_id no longer references nginx_instances
+ALTER TABLE nginx_certificates DROP CONSTRAINT IF EXISTS nginx_certificates_nginx_id_fkey;
+ALTER TABLE nginx_certificates DROP CONSTRAINT IF EXISTS fk_nginx_instances_certificate;
+ALTER TABLE nginx_certificates ADD COLUMN IF NOT EXISTS owner_type VARCHAR(20) DEFAULT 'instance';
+ALTER TABLE nginx_certificates ADD COLUMN IF NOT EXISTS source VARCHAR(20) DEFAULT 'manual';
+ALTER TABLE nginx_certificates ADD COLUMN IF NOT EXISTS auto_renew BOOLEAN DEFAULT FALSE;
+ALTER TABLE nginx_certificates ADD COLUMN IF NOT EXISTS last_renewal_at TIMESTAMP;
+ALTER TABLE nginx_certificates ADD COLUMN IF NOT EXISTS renewal_error TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_nginx_certificates_renewal ON nginx_certificates(auto_renew, expires_at);
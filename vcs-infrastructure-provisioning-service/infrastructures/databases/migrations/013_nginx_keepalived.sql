@@ -0,0 +1,5 @@
+-- Migration: 013_nginx_keepalived.sql
+-- Description: VRRP authentication and VIP subnet for keepalived on Nginx cluster nodes
+
+ALTER TABLE nginx_clusters ADD COLUMN IF NOT EXISTS vrrp_auth_pass VARCHAR(8);
+ALTER TABLE nginx_clusters ADD COLUMN IF NOT EXISTS vrrp_subnet VARCHAR(43);
@@ -0,0 +1,11 @@
+-- Migration: 014_upstream_health.sql
+-- Description: Active health check results for Nginx instance backends and cluster upstream servers
+
+ALTER TABLE nginx_upstream_backends ADD COLUMN IF NOT EXISTS is_down BOOLEAN DEFAULT false;
+ALTER TABLE nginx_upstream_backends ADD COLUMN IF NOT EXISTS last_checked_at TIMESTAMP;
+ALTER TABLE nginx_upstream_backends ADD COLUMN IF NOT EXISTS latency_ms BIGINT DEFAULT 0;
+ALTER TABLE nginx_upstream_backends ADD COLUMN IF NOT EXISTS last_error VARCHAR(500);
+
+ALTER TABLE nginx_upstream_servers ADD COLUMN IF NOT EXISTS last_checked_at TIMESTAMP;
+ALTER TABLE nginx_upstream_servers ADD COLUMN IF NOT EXISTS latency_ms BIGINT DEFAULT 0;
+ALTER TABLE nginx_upstream_servers ADD COLUMN IF NOT EXISTS last_error VARCHAR(500);
@@ -0,0 +1,8 @@
+-- Migration: 015_nginx_route_canary.sql
+-- Description: Canary and blue/green traffic splitting on Nginx routes
+
+ALTER TABLE nginx_routes ADD COLUMN IF NOT EXISTS canary_backend VARCHAR(255);
+ALTER TABLE nginx_routes ADD COLUMN IF NOT EXISTS canary_weight INT DEFAULT 0;
+ALTER TABLE nginx_routes ADD COLUMN IF NOT EXISTS canary_header VARCHAR(100);
+ALTER TABLE nginx_routes ADD COLUMN IF NOT EXISTS canary_cookie VARCHAR(100);
+ALTER TABLE nginx_routes ADD COLUMN IF NOT EXISTS canary_match_value VARCHAR(255);
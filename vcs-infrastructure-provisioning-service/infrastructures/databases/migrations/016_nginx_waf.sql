@@ -0,0 +1,20 @@
+-- Migration: 016_nginx_waf.sql
+-- Description: ModSecurity/OWASP CRS web application firewall for Nginx instances and clusters
+
+ALTER TABLE nginx_instances ADD COLUMN IF NOT EXISTS waf_enabled BOOLEAN DEFAULT FALSE;
+ALTER TABLE nginx_instances ADD COLUMN IF NOT EXISTS waf_mode VARCHAR(20) DEFAULT 'off';
+ALTER TABLE nginx_clusters ADD COLUMN IF NOT EXISTS waf_enabled BOOLEAN DEFAULT FALSE;
+ALTER TABLE nginx_clusters ADD COLUMN IF NOT EXISTS waf_mode VARCHAR(20) DEFAULT 'off';
+
+CREATE TABLE IF NOT EXISTS nginx_waf_exclusions (
+    id VARCHAR(36) PRIMARY KEY,
+    resource_type VARCHAR(20) NOT NULL,
+    resource_id VARCHAR(36) NOT NULL,
+    rule_id INT NOT NULL,
+    target VARCHAR(255),
+    path_prefix VARCHAR(255),
+    comment VARCHAR(500),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_nginx_waf_exclusion_resource ON nginx_waf_exclusions(resource_type, resource_id);
@@ -0,0 +1,23 @@
+-- Migration: 017_docker_service_replicas.sql
+-- Description: Replicated Docker services with rolling updates
+
+ALTER TABLE docker_services ADD COLUMN IF NOT EXISTS replicas INT DEFAULT 1;
+ALTER TABLE docker_services ADD COLUMN IF NOT EXISTS service_alias VARCHAR(255);
+ALTER TABLE docker_services ADD COLUMN IF NOT EXISTS max_surge INT DEFAULT 1;
+ALTER TABLE docker_services ADD COLUMN IF NOT EXISTS max_unavailable INT DEFAULT 0;
+ALTER TABLE docker_services ADD COLUMN IF NOT EXISTS rollout_status VARCHAR(50);
+ALTER TABLE docker_services ADD COLUMN IF NOT EXISTS rollout_message TEXT;
+
+CREATE TABLE IF NOT EXISTS docker_service_replicas (
+    id VARCHAR(36) PRIMARY KEY,
+    service_id VARCHAR(36) NOT NULL,
+    container_id VARCHAR(100),
+    container_name VARCHAR(255),
+    image_tag VARCHAR(100),
+    status VARCHAR(50) DEFAULT 'creating',
+    ip_address VARCHAR(50),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_docker_service_replicas_service_id ON docker_service_replicas(service_id);
@@ -0,0 +1,6 @@
+-- Migration: 018_docker_service_health.sql
+-- Description: Docker health status of Docker service replicas
+
+ALTER TABLE docker_service_replicas ADD COLUMN IF NOT EXISTS health VARCHAR(20);
+
+CREATE INDEX IF NOT EXISTS idx_docker_health_checks_status ON docker_health_checks(status);
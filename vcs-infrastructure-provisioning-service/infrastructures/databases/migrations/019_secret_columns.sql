@@ -0,0 +1,8 @@
+-- Migration: 019_secret_columns.sql
+-- Description: Widen password columns to hold envelope encrypted values.
+-- Existing plaintext values are encrypted by the rotation pass on startup.
+
+ALTER TABLE postgre_sql_instances ALTER COLUMN password TYPE TEXT;
+ALTER TABLE postgre_sql_clusters ALTER COLUMN password TYPE TEXT;
+ALTER TABLE postgres_databases ALTER COLUMN owner_password TYPE TEXT;
+ALTER TABLE nginx_securities ALTER COLUMN basic_auth_password TYPE TEXT;
@@ -0,0 +1,44 @@
+-- Migration: 020_docker_autoscaling.sql
+-- Description: Horizontal autoscaling of Docker services and nginx upstreams that follow their replicas
+
+CREATE TABLE IF NOT EXISTS docker_autoscale_policies (
+    id VARCHAR(36) PRIMARY KEY,
+    service_id VARCHAR(36) NOT NULL UNIQUE,
+    enabled BOOLEAN DEFAULT TRUE,
+    min_replicas INT DEFAULT 1,
+    max_replicas INT DEFAULT 1,
+    metric VARCHAR(20) NOT NULL,
+    scale_up_threshold DOUBLE PRECISION NOT NULL,
+    scale_down_threshold DOUBLE PRECISION NOT NULL,
+    evaluations INT DEFAULT 3,
+    scale_up_cooldown INT DEFAULT 60,
+    scale_down_cooldown INT DEFAULT 300,
+    last_value DOUBLE PRECISION,
+    last_evaluated_at TIMESTAMP,
+    last_scaled_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS docker_scaling_events (
+    id VARCHAR(36) PRIMARY KEY,
+    service_id VARCHAR(36) NOT NULL,
+    from_replicas INT NOT NULL,
+    to_replicas INT NOT NULL,
+    metric VARCHAR(20),
+    value DOUBLE PRECISION,
+    threshold DOUBLE PRECISION,
+    reason VARCHAR(500),
+    status VARCHAR(20),
+    error TEXT,
+    upstreams_updated INT DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_docker_scaling_events_service_id ON docker_scaling_events(service_id);
+CREATE INDEX IF NOT EXISTS idx_docker_scaling_events_created_at ON docker_scaling_events(created_at);
+
+ALTER TABLE nginx_upstream_backends ADD COLUMN IF NOT EXISTS docker_service_id VARCHAR(36);
+ALTER TABLE nginx_upstream_servers ADD COLUMN IF NOT EXISTS docker_service_id VARCHAR(36);
+CREATE INDEX IF NOT EXISTS idx_nginx_upstream_backends_docker_service_id ON nginx_upstream_backends(docker_service_id);
+CREATE INDEX IF NOT EXISTS idx_nginx_upstream_servers_docker_service_id ON nginx_upstream_servers(docker_service_id);
@@ -0,0 +1,24 @@
+-- Migration: 021_registry_credentials.sql
+-- Description: Private registry credentials, image pull policies and pinned image digests
+
+CREATE TABLE IF NOT EXISTS registry_credentials (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    project_id VARCHAR(36),
+    name VARCHAR(100) NOT NULL,
+    server_address VARCHAR(255) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    password TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_registry_credentials_user_name ON registry_credentials(user_id, name);
+CREATE INDEX IF NOT EXISTS idx_registry_credentials_project_id ON registry_credentials(project_id);
+
+ALTER TABLE docker_services ADD COLUMN IF NOT EXISTS registry_credential_id VARCHAR(36);
+ALTER TABLE docker_services ADD COLUMN IF NOT EXISTS pull_policy VARCHAR(20) DEFAULT 'if-not-present';
+ALTER TABLE docker_services ADD COLUMN IF NOT EXISTS image_digest VARCHAR(100);
+CREATE INDEX IF NOT EXISTS idx_docker_services_registry_credential_id ON docker_services(registry_credential_id);
+
+ALTER TABLE dind_environments ADD COLUMN IF NOT EXISTS registry_credential_id VARCHAR(36);
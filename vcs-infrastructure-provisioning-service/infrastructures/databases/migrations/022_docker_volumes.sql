@@ -0,0 +1,47 @@
+-- Migration: 022_docker_volumes.sql
+-- Description: Named volumes and bind mounts of Docker services, with volume snapshots
+
+CREATE TABLE IF NOT EXISTS docker_volumes (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    docker_name VARCHAR(255) NOT NULL,
+    driver VARCHAR(50) DEFAULT 'local',
+    size_bytes BIGINT DEFAULT -1,
+    size_checked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_docker_volumes_user_name ON docker_volumes(user_id, name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_docker_volumes_docker_name ON docker_volumes(docker_name);
+
+CREATE TABLE IF NOT EXISTS docker_volume_mounts (
+    id VARCHAR(36) PRIMARY KEY,
+    service_id VARCHAR(36) NOT NULL,
+    type VARCHAR(10) NOT NULL,
+    volume_id VARCHAR(36),
+    source VARCHAR(500) NOT NULL,
+    target VARCHAR(500) NOT NULL,
+    read_only BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (service_id) REFERENCES docker_services(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_docker_volume_mounts_service_id ON docker_volume_mounts(service_id);
+CREATE INDEX IF NOT EXISTS idx_docker_volume_mounts_volume_id ON docker_volume_mounts(volume_id);
+
+CREATE TABLE IF NOT EXISTS docker_volume_snapshots (
+    id VARCHAR(36) PRIMARY KEY,
+    volume_id VARCHAR(36) NOT NULL,
+    name VARCHAR(100),
+    archive VARCHAR(255) NOT NULL,
+    size_bytes BIGINT DEFAULT 0,
+    status VARCHAR(20) DEFAULT 'creating',
+    error TEXT,
+    restored_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_docker_volume_snapshots_volume_id ON docker_volume_snapshots(volume_id);
@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
@@ -30,12 +32,21 @@ type IDockerService interface {
 	RemoveContainer(ctx context.Context, containerID string) error
 	GetContainerStats(ctx context.Context, containerID string) (types.ContainerStats, error)
 	GetContainerLogs(ctx context.Context, containerID string, tail int) ([]string, error)
+	GetContainerLogsSince(ctx context.Context, containerID string, since time.Time) ([]string, error)
 	ExecCommand(ctx context.Context, containerID string, cmd []string) (string, error)
+	ExecCommandWithInput(ctx context.Context, containerID string, cmd []string, input []byte) (string, error)
+	WriteFiles(ctx context.Context, containerID string, files []ContainerFile) error
 	InspectContainer(ctx context.Context, containerID string) (*types.ContainerJSON, error)
+	EnsureImage(ctx context.Context, image, pullPolicy string, auth *RegistryAuth) error
+	ImageDigest(ctx context.Context, image string) (string, error)
 	CreateNetwork(ctx context.Context, networkName string) (string, error)
+	CreateNetworkWithSubnet(ctx context.Context, networkName, subnet, ipRange string) (string, error)
+	InspectNetwork(ctx context.Context, networkID string) (*types.NetworkResource, error)
 	RemoveNetwork(ctx context.Context, networkID string) error
 	CreateVolume(ctx context.Context, volumeName string) error
 	RemoveVolume(ctx context.Context, volumeName string) error
+	VolumeSizes(ctx context.Context) (map[string]int64, error)
+	RunContainer(ctx context.Context, config ContainerConfig) (string, error)
 	ListenToEvents(ctx context.Context, eventChan chan<- events.Message) error
 }
 
@@ -49,7 +60,42 @@ type ContainerConfig struct {
 	NetworkAlias string
 	Cmd          []string
 	Resources    ResourceConfig
-	Privileged   bool // For Docker-in-Docker containers
+	Privileged   bool     // For Docker-in-Docker containers
+	CapAdd       []string // Extra kernel capabilities, e.g. NET_ADMIN for keepalived
+	User         string   // Overrides the image user, e.g. root for images that default to an unprivileged one
+	HealthCheck  *HealthCheckConfig
+	PullPolicy   string        // PullAlways, PullIfNotPresent (default) or PullNever
+	RegistryAuth *RegistryAuth // Credentials for pulling from a private registry
+}
+
+// ContainerFile is written into a container by WriteFiles. Missing parent
+// directories are created.
+type ContainerFile struct {
+	Path    string // absolute path inside the container
+	Content []byte
+	Mode    int64 // defaults to 0644
+}
+
+// Image pull policies
+const (
+	PullAlways       = "always"
+	PullIfNotPresent = "if-not-present"
+	PullNever        = "never"
+)
+
+// RegistryAuth logs in to a private registry for a pull
+type RegistryAuth struct {
+	ServerAddress string
+	Username      string
+	Password      string
+}
+
+// HealthCheckConfig becomes the HEALTHCHECK of the container
+type HealthCheckConfig struct {
+	Test     []string // e.g. CMD-SHELL followed by the shell command
+	Interval time.Duration
+	Timeout  time.Duration
+	Retries  int
 }
 
 type ResourceConfig struct {
@@ -75,20 +121,8 @@ func NewDockerService(logger logger.ILogger) (IDockerService, error) {
 }
 
 func (ds *dockerService) CreateContainer(ctx context.Context, config ContainerConfig) (string, error) {
-	// Check if image exists locally first
-	_, _, err := ds.client.ImageInspectWithRaw(ctx, config.Image)
-	if err != nil {
-		// Image not found locally, try to pull
-		ds.logger.Info("pulling image", zap.String("image", config.Image))
-		reader, pullErr := ds.client.ImagePull(ctx, config.Image, types.ImagePullOptions{})
-		if pullErr != nil {
-			ds.logger.Error("failed to pull image", zap.Error(pullErr))
-			return "", pullErr
-		}
-		defer reader.Close()
-		io.Copy(io.Discard, reader)
-	} else {
-		ds.logger.Info("using local image", zap.String("image", config.Image))
+	if err := ds.EnsureImage(ctx, config.Image, config.PullPolicy, config.RegistryAuth); err != nil {
+		return "", err
 	}
 
 	portBindings := nat.PortMap{}
@@ -112,6 +146,15 @@ func (ds *dockerService) CreateContainer(ctx context.Context, config ContainerCo
 		Env:          config.Env,
 		ExposedPorts: exposedPorts,
 		Cmd:          config.Cmd,
+		User:         config.User,
+	}
+	if config.HealthCheck != nil {
+		containerConfig.Healthcheck = &container.HealthConfig{
+			Test:     config.HealthCheck.Test,
+			Interval: config.HealthCheck.Interval,
+			Timeout:  config.HealthCheck.Timeout,
+			Retries:  config.HealthCheck.Retries,
+		}
 	}
 
 	hostConfig := &container.HostConfig{
@@ -124,6 +167,7 @@ func (ds *dockerService) CreateContainer(ctx context.Context, config ContainerCo
 		RestartPolicy: container.RestartPolicy{
 			Name: "unless-stopped",
 		},
+		CapAdd: config.CapAdd,
 	}
 
 	networkConfig := &network.NetworkingConfig{}
@@ -145,22 +189,48 @@ func (ds *dockerService) CreateContainer(ctx context.Context, config ContainerCo
 	return resp.ID, nil
 }
 
+// EnsureImage makes image available locally according to pullPolicy, pulling it with auth
+// when set
+func (ds *dockerService) EnsureImage(ctx context.Context, image, pullPolicy string, auth *RegistryAuth) error {
+	if pullPolicy != PullAlways {
+		_, _, err := ds.client.ImageInspectWithRaw(ctx, image)
+		if err == nil {
+			ds.logger.Info("using local image", zap.String("image", image))
+			return nil
+		}
+		if pullPolicy == PullNever {
+			return fmt.Errorf("image %s is not present locally and pull_policy is never", image)
+		}
+	}
+
+	options := types.ImagePullOptions{}
+	if auth != nil {
+		encoded, err := registry.EncodeAuthConfig(registry.AuthConfig{
+			ServerAddress: auth.ServerAddress,
+			Username:      auth.Username,
+			Password:      auth.Password,
+		})
+		if err != nil {
+			return err
+		}
+		options.RegistryAuth = encoded
+	}
+
+	ds.logger.Info("pulling image", zap.String("image", image), zap.Bool("authenticated", auth != nil))
+	reader, err := ds.client.ImagePull(ctx, image, options)
+	if err != nil {
+		ds.logger.Error("failed to pull image", zap.String("image", image), zap.Error(err))
+		return err
+	}
+	defer reader.Close()
+	io.Copy(io.Discard, reader)
+	return nil
+}
+
 // CreateDinDContainer creates a Docker-in-Docker container with privileged mode
 func (ds *dockerService) CreateDinDContainer(ctx context.Context, config ContainerConfig) (string, error) {
-	// Check if image exists locally first
-	_, _, err := ds.client.ImageInspectWithRaw(ctx, config.Image)
-	if err != nil {
-		// Image not found locally, try to pull
-		ds.logger.Info("pulling DinD image", zap.String("image", config.Image))
-		reader, pullErr := ds.client.ImagePull(ctx, config.Image, types.ImagePullOptions{})
-		if pullErr != nil {
-			ds.logger.Error("failed to pull DinD image", zap.Error(pullErr))
-			return "", pullErr
-		}
-		defer reader.Close()
-		io.Copy(io.Discard, reader)
-	} else {
-		ds.logger.Info("using local DinD image", zap.String("image", config.Image))
+	if err := ds.EnsureImage(ctx, config.Image, config.PullPolicy, config.RegistryAuth); err != nil {
+		return "", err
 	}
 
 	portBindings := nat.PortMap{}
@@ -311,8 +381,49 @@ func (ds *dockerService) GetContainerLogs(ctx context.Context, containerID strin
 	return result, nil
 }
 
+// GetContainerLogsSince returns stdout lines written after since, each prefixed with its
+// RFC3339Nano timestamp and a space
+func (ds *dockerService) GetContainerLogsSince(ctx context.Context, containerID string, since time.Time) ([]string, error) {
+	options := container.LogsOptions{
+		ShowStdout: true,
+		Since:      since.Format(time.RFC3339Nano),
+		Timestamps: true,
+	}
+
+	logs, err := ds.client.ContainerLogs(ctx, containerID, options)
+	if err != nil {
+		ds.logger.Error("failed to get container logs", zap.String("container_id", containerID), zap.Error(err))
+		return nil, err
+	}
+	defer logs.Close()
+
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, logs); err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+	return result, nil
+}
+
 func (ds *dockerService) ExecCommand(ctx context.Context, containerID string, cmd []string) (string, error) {
+	return ds.exec(ctx, containerID, cmd, nil)
+}
+
+// ExecCommandWithInput runs cmd with input on its stdin, for values such as passwords that
+// must not appear in the process list
+func (ds *dockerService) ExecCommandWithInput(ctx context.Context, containerID string, cmd []string, input []byte) (string, error) {
+	return ds.exec(ctx, containerID, cmd, input)
+}
+
+func (ds *dockerService) exec(ctx context.Context, containerID string, cmd []string, input []byte) (string, error) {
 	execConfig := types.ExecConfig{
+		AttachStdin:  input != nil,
 		AttachStdout: true,
 		AttachStderr: true,
 		Cmd:          cmd,
@@ -331,6 +442,15 @@ func (ds *dockerService) ExecCommand(ctx context.Context, containerID string, cm
 	}
 	defer attachResp.Close()
 
+	if input != nil {
+		if _, err := attachResp.Conn.Write(input); err != nil {
+			return "", err
+		}
+		if err := attachResp.CloseWrite(); err != nil {
+			return "", err
+		}
+	}
+
 	// Use stdcopy to properly demux the docker stream (removes header bytes)
 	var stdout, stderr bytes.Buffer
 	_, err = stdcopy.StdCopy(&stdout, &stderr, attachResp.Reader)
@@ -346,6 +466,43 @@ func (ds *dockerService) ExecCommand(ctx context.Context, containerID string, cm
 	return output, nil
 }
 
+// WriteFiles copies files into a container as a tar stream, so their content never
+// passes through a shell
+func (ds *dockerService) WriteFiles(ctx context.Context, containerID string, files []ContainerFile) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, file := range files {
+		if !strings.HasPrefix(file.Path, "/") {
+			return fmt.Errorf("container file path must be absolute: %s", file.Path)
+		}
+		mode := file.Mode
+		if mode == 0 {
+			mode = 0644
+		}
+		header := &tar.Header{
+			Name:    strings.TrimPrefix(file.Path, "/"),
+			Mode:    mode,
+			Size:    int64(len(file.Content)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.Content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	if err := ds.client.CopyToContainer(ctx, containerID, "/", &buf, types.CopyToContainerOptions{}); err != nil {
+		ds.logger.Error("failed to copy files to container", zap.String("container_id", containerID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
 func (ds *dockerService) InspectContainer(ctx context.Context, containerID string) (*types.ContainerJSON, error) {
 	inspect, err := ds.client.ContainerInspect(ctx, containerID)
 	if err != nil {
@@ -355,6 +512,35 @@ func (ds *dockerService) InspectContainer(ctx context.Context, containerID strin
 	return &inspect, nil
 }
 
+// ImageDigest returns the registry digest (sha256:...) of a local image, or "" for images that
+// were never pulled from or pushed to a registry
+func (ds *dockerService) ImageDigest(ctx context.Context, image string) (string, error) {
+	inspect, _, err := ds.client.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	repo := image
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo = repo[:i]
+	} else if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+	digest := ""
+	for _, repoDigest := range inspect.RepoDigests {
+		name, value, ok := strings.Cut(repoDigest, "@")
+		if !ok {
+			continue
+		}
+		if name == repo || strings.HasSuffix(name, "/"+repo) {
+			return value, nil
+		}
+		if digest == "" {
+			digest = value
+		}
+	}
+	return digest, nil
+}
+
 func (ds *dockerService) CreateNetwork(ctx context.Context, networkName string) (string, error) {
 	filter := filters.NewArgs()
 	filter.Add("name", networkName)
@@ -380,6 +566,44 @@ func (ds *dockerService) CreateNetwork(ctx context.Context, networkName string)
 	return resp.ID, nil
 }
 
+// CreateNetworkWithSubnet creates a bridge network on a fixed subnet. Docker only hands out
+// container addresses from ipRange, leaving the rest of the subnet free for virtual IPs.
+func (ds *dockerService) CreateNetworkWithSubnet(ctx context.Context, networkName, subnet, ipRange string) (string, error) {
+	filter := filters.NewArgs()
+	filter.Add("name", networkName)
+	networks, err := ds.client.NetworkList(ctx, types.NetworkListOptions{Filters: filter})
+	if err != nil {
+		return "", err
+	}
+
+	if len(networks) > 0 {
+		ds.logger.Info("network already exists", zap.String("network", networkName))
+		return networks[0].ID, nil
+	}
+
+	resp, err := ds.client.NetworkCreate(ctx, networkName, types.NetworkCreate{
+		Driver: "bridge",
+		IPAM: &network.IPAM{
+			Config: []network.IPAMConfig{{Subnet: subnet, IPRange: ipRange}},
+		},
+	})
+	if err != nil {
+		ds.logger.Error("failed to create network", zap.String("network", networkName), zap.String("subnet", subnet), zap.Error(err))
+		return "", err
+	}
+
+	ds.logger.Info("network created", zap.String("network_id", resp.ID), zap.String("network", networkName), zap.String("subnet", subnet))
+	return resp.ID, nil
+}
+
+func (ds *dockerService) InspectNetwork(ctx context.Context, networkID string) (*types.NetworkResource, error) {
+	resource, err := ds.client.NetworkInspect(ctx, networkID, types.NetworkInspectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &resource, nil
+}
+
 func (ds *dockerService) RemoveNetwork(ctx context.Context, networkID string) error {
 	if err := ds.client.NetworkRemove(ctx, networkID); err != nil {
 		ds.logger.Error("failed to remove network", zap.String("network_id", networkID), zap.Error(err))
@@ -423,6 +647,70 @@ func (ds *dockerService) RemoveVolume(ctx context.Context, volumeName string) er
 	return nil
 }
 
+// VolumeSizes returns the disk usage of every local volume by name; Docker reports -1 for
+// volumes whose size it cannot compute
+func (ds *dockerService) VolumeSizes(ctx context.Context) (map[string]int64, error) {
+	usage, err := ds.client.DiskUsage(ctx, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.VolumeObject}})
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[string]int64, len(usage.Volumes))
+	for _, v := range usage.Volumes {
+		size := int64(-1)
+		if v.UsageData != nil {
+			size = v.UsageData.Size
+		}
+		sizes[v.Name] = size
+	}
+	return sizes, nil
+}
+
+// RunContainer runs a one-off container to completion and removes it, returning its output.
+// It fails when the command exits non-zero.
+func (ds *dockerService) RunContainer(ctx context.Context, config ContainerConfig) (string, error) {
+	if err := ds.EnsureImage(ctx, config.Image, config.PullPolicy, config.RegistryAuth); err != nil {
+		return "", err
+	}
+
+	binds := []string{}
+	for hostPath, containerPath := range config.Volumes {
+		binds = append(binds, fmt.Sprintf("%s:%s", hostPath, containerPath))
+	}
+	resp, err := ds.client.ContainerCreate(ctx,
+		&container.Config{Image: config.Image, Env: config.Env, Cmd: config.Cmd, User: config.User},
+		&container.HostConfig{Binds: binds},
+		nil, nil, config.Name)
+	if err != nil {
+		ds.logger.Error("failed to create container", zap.String("name", config.Name), zap.Error(err))
+		return "", err
+	}
+	// The container is gone once the run ends, whether the caller gave up or not
+	defer ds.client.ContainerRemove(context.WithoutCancel(ctx), resp.ID, container.RemoveOptions{Force: true})
+
+	statusCh, errCh := ds.client.ContainerWait(ctx, resp.ID, container.WaitConditionNextExit)
+	if err := ds.client.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return "", err
+	}
+
+	var exitCode int64
+	select {
+	case err := <-errCh:
+		return "", err
+	case status := <-statusCh:
+		exitCode = status.StatusCode
+	}
+
+	lines, err := ds.GetContainerLogs(ctx, resp.ID, 0)
+	if err != nil {
+		return "", err
+	}
+	output := strings.Join(lines, "\n")
+	if exitCode != 0 {
+		return output, fmt.Errorf("container %s exited with code %d: %s", config.Name, exitCode, strings.TrimSpace(output))
+	}
+	return output, nil
+}
+
 // ListenToEvents listens to Docker events and sends them to the provided channel
 func (ds *dockerService) ListenToEvents(ctx context.Context, eventChan chan<- events.Message) error {
 	// Filter to only listen to container events
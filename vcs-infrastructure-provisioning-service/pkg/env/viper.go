@@ -12,12 +12,40 @@ type Env struct {
 	GRPCEnv     GRPCEnv
 	HTTPEnv     HTTPEnv
 	AuthEnv     AuthEnv
+	AcmeEnv     AcmeEnv
+	CertEnv     CertEnv
+	SecretsEnv  SecretsEnv
 }
 
 type AuthEnv struct {
 	JWTSecret string
 }
 
+// AcmeEnv configures the ACME client used for automatic TLS. DirectoryURL can point
+// at a local Pebble instance for testing; CACertFile trusts its self-signed root.
+type AcmeEnv struct {
+	DirectoryURL       string
+	Email              string
+	CACertFile         string
+	InsecureSkipVerify bool
+	RenewBeforeDays    int
+	RenewCheckInterval string
+}
+
+// CertEnv configures certificate expiry alerting
+type CertEnv struct {
+	ExpiryAlertDays int
+}
+
+// SecretsEnv configures envelope encryption of stored secrets. MasterKey is a base64
+// encoded 32 byte key; PreviousMasterKeys lists id:key pairs still accepted for reading
+// while values are rewrapped under MasterKeyID.
+type SecretsEnv struct {
+	MasterKey          string
+	MasterKeyID        string
+	PreviousMasterKeys string
+}
+
 type PostgresEnv struct {
 	PostgresHost     string
 	PostgresPort     string
@@ -96,6 +124,22 @@ func LoadEnv() (*Env, error) {
 		AuthEnv: AuthEnv{
 			JWTSecret: viper.GetString("JWT_SECRET"),
 		},
+		AcmeEnv: AcmeEnv{
+			DirectoryURL:       viper.GetString("ACME_DIRECTORY_URL"),
+			Email:              viper.GetString("ACME_EMAIL"),
+			CACertFile:         viper.GetString("ACME_CA_CERT_FILE"),
+			InsecureSkipVerify: viper.GetBool("ACME_INSECURE_SKIP_VERIFY"),
+			RenewBeforeDays:    viper.GetInt("ACME_RENEW_BEFORE_DAYS"),
+			RenewCheckInterval: viper.GetString("ACME_RENEW_CHECK_INTERVAL"),
+		},
+		CertEnv: CertEnv{
+			ExpiryAlertDays: viper.GetInt("CERT_EXPIRY_ALERT_DAYS"),
+		},
+		SecretsEnv: SecretsEnv{
+			MasterKey:          viper.GetString("SECRETS_MASTER_KEY"),
+			MasterKeyID:        viper.GetString("SECRETS_MASTER_KEY_ID"),
+			PreviousMasterKeys: viper.GetString("SECRETS_PREVIOUS_MASTER_KEYS"),
+		},
 	}, nil
 }
 
@@ -5,10 +5,17 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/secrets"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Token scopes understood by this service
+const (
+	ScopeSecretsReveal = "secrets:reveal" // return stored passwords, keys and tokens unmasked
+	ScopeSecretsRotate = "secrets:rotate" // trigger re-encryption of stored secrets
+)
+
 type JWTMiddleware struct {
 	jwtSecret []byte
 }
@@ -67,9 +74,58 @@ func (m *JWTMiddleware) CheckBearerAuth() gin.HandlerFunc {
 			if userID, ok := claims["sub"].(string); ok {
 				c.Set("user_id", userID)
 			}
+			scopes := tokenScopes(claims)
+			c.Set("scopes", scopes)
+			if containsScope(scopes, ScopeSecretsReveal) {
+				c.Request = c.Request.WithContext(secrets.WithReveal(c.Request.Context()))
+			}
 		}
 
 		c.Next()
 	}
 }
 
+
+// RequireScope rejects requests whose token does not carry scope
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasScope(c, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing required scope " + scope})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// HasScope reports whether the request token carries scope
+func HasScope(c *gin.Context, scope string) bool {
+	scopes, _ := c.Get("scopes")
+	list, _ := scopes.([]string)
+	return containsScope(list, scope)
+}
+
+// tokenScopes reads the scope claim, issued either as a list or a space separated string
+func tokenScopes(claims jwt.MapClaims) []string {
+	scopes := []string{}
+	switch v := claims["scope"].(type) {
+	case []interface{}:
+		for _, scope := range v {
+			if s, ok := scope.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+	case string:
+		scopes = append(scopes, strings.Fields(v)...)
+	}
+	return scopes
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
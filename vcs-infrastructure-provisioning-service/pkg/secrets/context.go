@@ -0,0 +1,16 @@
+package secrets
+
+import "context"
+
+type revealKey struct{}
+
+// WithReveal marks ctx as allowed to see secret values in plaintext
+func WithReveal(ctx context.Context) context.Context {
+	return context.WithValue(ctx, revealKey{}, true)
+}
+
+// CanReveal reports whether secrets may be returned unmasked for ctx
+func CanReveal(ctx context.Context) bool {
+	reveal, _ := ctx.Value(revealKey{}).(bool)
+	return reveal
+}
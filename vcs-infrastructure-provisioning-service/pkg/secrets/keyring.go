@@ -0,0 +1,239 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/env"
+)
+
+// Sealed values look like enc:v1:<master key id>:<wrapped data key>:<ciphertext>, both
+// parts being base64url encoded nonce||ciphertext. Anything else is legacy plaintext.
+const (
+	sealedPrefix = "enc:v1:"
+	keySize      = 32
+)
+
+var (
+	ErrMissingMasterKey = errors.New("secrets master key is not configured")
+	ErrUnknownKey       = errors.New("secret is sealed with an unknown master key")
+	ErrMalformed        = errors.New("malformed sealed secret")
+)
+
+// Keyring holds the master keys that wrap the per-record data keys. New values are
+// always sealed under the current key; previous keys only open values until they are
+// rewrapped.
+type Keyring struct {
+	currentID string
+	keys      map[string]cipher.AEAD
+}
+
+// NewKeyring builds a keyring from raw 32 byte AES keys indexed by key ID
+func NewKeyring(currentID string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[currentID]; !ok {
+		return nil, ErrMissingMasterKey
+	}
+
+	keyring := &Keyring{currentID: currentID, keys: map[string]cipher.AEAD{}}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid master key id %q", id)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("master key %q: %w", id, err)
+		}
+		keyring.keys[id] = aead
+	}
+	return keyring, nil
+}
+
+// LoadKeyring reads the master keys from config. Keys are base64 encoded; previous keys
+// are a comma separated list of id:key pairs kept while values are being rewrapped.
+func LoadKeyring(cfg env.SecretsEnv) (*Keyring, error) {
+	if cfg.MasterKey == "" {
+		return nil, ErrMissingMasterKey
+	}
+	currentID := cfg.MasterKeyID
+	if currentID == "" {
+		currentID = "default"
+	}
+
+	keys := map[string][]byte{}
+	key, err := base64.StdEncoding.DecodeString(cfg.MasterKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode master key: %w", err)
+	}
+	keys[currentID] = key
+
+	for _, entry := range strings.Split(cfg.PreviousMasterKeys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("previous master key %q must be id:key", entry)
+		}
+		if _, exists := keys[id]; exists {
+			return nil, fmt.Errorf("duplicate master key id %q", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("decode master key %q: %w", id, err)
+		}
+		keys[id] = key
+	}
+	return NewKeyring(currentID, keys)
+}
+
+// CurrentKeyID returns the ID of the master key new values are sealed under
+func (k *Keyring) CurrentKeyID() string {
+	return k.currentID
+}
+
+// Encrypt seals plaintext under a fresh data key wrapped by the current master key.
+// Empty values stay empty so "is it set" checks keep working.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(aead, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	return k.wrap(dataKey, ciphertext)
+}
+
+// Decrypt opens a sealed value. Legacy plaintext is returned unchanged so existing rows
+// stay readable until the rotation pass encrypts them.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	_, dataKey, ciphertext, err := k.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports whether value is plaintext or wrapped by a previous master key
+func (k *Keyring) NeedsRotation(value string) bool {
+	if value == "" {
+		return false
+	}
+	if !IsEncrypted(value) {
+		return true
+	}
+	keyID, _, _ := strings.Cut(strings.TrimPrefix(value, sealedPrefix), ":")
+	return keyID != k.currentID
+}
+
+// Rewrap re-wraps the data key of value under the current master key without touching
+// the ciphertext. Plaintext values are encrypted.
+func (k *Keyring) Rewrap(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return k.Encrypt(value)
+	}
+
+	_, dataKey, ciphertext, err := k.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+	return k.wrap(dataKey, ciphertext)
+}
+
+// IsEncrypted reports whether value was sealed by a keyring
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+func (k *Keyring) wrap(dataKey, ciphertext []byte) (string, error) {
+	wrapped, err := seal(k.keys[k.currentID], dataKey, []byte(k.currentID))
+	if err != nil {
+		return "", err
+	}
+	return sealedPrefix + k.currentID + ":" +
+		base64.RawURLEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawURLEncoding.EncodeToString(ciphertext), nil
+}
+
+func (k *Keyring) unwrap(value string) (keyID string, dataKey, ciphertext []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, sealedPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, ErrMalformed
+	}
+	keyID = parts[0]
+	master, ok := k.keys[keyID]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	if ciphertext, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	if dataKey, err = open(master, wrapped, []byte(keyID)); err != nil {
+		return "", nil, nil, err
+	}
+	return keyID, dataKey, ciphertext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", keySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns nonce||ciphertext
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("open sealed secret: %w", err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,137 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, keySize)
+}
+
+func TestKeyringEncryptDecrypt(t *testing.T) {
+	keyring, err := NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	assert.NoError(t, err)
+
+	sealed, err := keyring.Encrypt("s3cret")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, "enc:v1:k1:"))
+	assert.NotContains(t, sealed, "s3cret")
+
+	// Every value gets its own data key and nonce
+	again, err := keyring.Encrypt("s3cret")
+	assert.NoError(t, err)
+	assert.NotEqual(t, sealed, again)
+
+	plaintext, err := keyring.Decrypt(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", plaintext)
+
+	empty, err := keyring.Encrypt("")
+	assert.NoError(t, err)
+	assert.Empty(t, empty)
+
+	// Legacy plaintext is readable until it is rotated
+	plaintext, err = keyring.Decrypt("legacy-password")
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy-password", plaintext)
+	assert.True(t, keyring.NeedsRotation("legacy-password"))
+	assert.False(t, keyring.NeedsRotation(sealed))
+	assert.False(t, keyring.NeedsRotation(""))
+}
+
+func TestKeyringRejectsTampering(t *testing.T) {
+	keyring, err := NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	assert.NoError(t, err)
+	sealed, err := keyring.Encrypt("s3cret")
+	assert.NoError(t, err)
+
+	parts := strings.Split(sealed, ":")
+	ciphertext, _ := base64.RawURLEncoding.DecodeString(parts[4])
+	ciphertext[len(ciphertext)-1] ^= 0xff
+	parts[4] = base64.RawURLEncoding.EncodeToString(ciphertext)
+	_, err = keyring.Decrypt(strings.Join(parts, ":"))
+	assert.Error(t, err)
+
+	// The key ID is bound to the wrapped data key
+	other, err := NewKeyring("k2", map[string][]byte{"k2": testKey(1)})
+	assert.NoError(t, err)
+	_, err = other.Decrypt(strings.Replace(sealed, ":k1:", ":k2:", 1))
+	assert.Error(t, err)
+
+	_, err = other.Decrypt(sealed)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	_, err = keyring.Decrypt("enc:v1:k1:garbage")
+	assert.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestKeyringRewrap(t *testing.T) {
+	old, err := NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	assert.NoError(t, err)
+	sealed, err := old.Encrypt("s3cret")
+	assert.NoError(t, err)
+
+	rotated, err := NewKeyring("k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+	assert.NoError(t, err)
+	assert.True(t, rotated.NeedsRotation(sealed))
+
+	rewrapped, err := rotated.Rewrap(sealed)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(rewrapped, "enc:v1:k2:"))
+	assert.False(t, rotated.NeedsRotation(rewrapped))
+	// Only the data key is rewrapped, the ciphertext is kept
+	assert.Equal(t, strings.Split(sealed, ":")[4], strings.Split(rewrapped, ":")[4])
+
+	plaintext, err := rotated.Decrypt(rewrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", plaintext)
+
+	// Once the old key is dropped only rewrapped values open
+	current, err := NewKeyring("k2", map[string][]byte{"k2": testKey(2)})
+	assert.NoError(t, err)
+	_, err = current.Decrypt(sealed)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	plaintext, err = current.Decrypt(rewrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", plaintext)
+
+	encrypted, err := current.Rewrap("legacy")
+	assert.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+}
+
+func TestLoadKeyring(t *testing.T) {
+	k1 := base64.StdEncoding.EncodeToString(testKey(1))
+	k2 := base64.StdEncoding.EncodeToString(testKey(2))
+
+	keyring, err := LoadKeyring(env.SecretsEnv{MasterKey: k2, MasterKeyID: "k2", PreviousMasterKeys: "k1:" + k1})
+	assert.NoError(t, err)
+	assert.Equal(t, "k2", keyring.CurrentKeyID())
+	assert.Len(t, keyring.keys, 2)
+
+	keyring, err = LoadKeyring(env.SecretsEnv{MasterKey: k1})
+	assert.NoError(t, err)
+	assert.Equal(t, "default", keyring.CurrentKeyID())
+
+	_, err = LoadKeyring(env.SecretsEnv{})
+	assert.ErrorIs(t, err, ErrMissingMasterKey)
+	_, err = LoadKeyring(env.SecretsEnv{MasterKey: base64.StdEncoding.EncodeToString([]byte("short"))})
+	assert.Error(t, err)
+	_, err = LoadKeyring(env.SecretsEnv{MasterKey: k1, PreviousMasterKeys: k2})
+	assert.Error(t, err)
+	_, err = LoadKeyring(env.SecretsEnv{MasterKey: k1, MasterKeyID: "k1", PreviousMasterKeys: "k1:" + k2})
+	assert.Error(t, err)
+}
+
+func TestReveal(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, CanReveal(ctx))
+	assert.True(t, CanReveal(WithReveal(ctx)))
+}
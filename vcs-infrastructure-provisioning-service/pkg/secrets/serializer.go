@@ -0,0 +1,74 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	"gorm.io/gorm/schema"
+)
+
+// SerializerName is the gorm serializer encrypting string fields at rest, used as
+// `gorm:"serializer:secret"`
+const SerializerName = "secret"
+
+var defaultKeyring atomic.Pointer[Keyring]
+
+func init() {
+	schema.RegisterSerializer(SerializerName, Serializer{})
+}
+
+// SetDefault installs the keyring used by the gorm serializer
+func SetDefault(keyring *Keyring) {
+	defaultKeyring.Store(keyring)
+}
+
+// Default returns the keyring used by the gorm serializer, nil until SetDefault is called
+func Default() *Keyring {
+	return defaultKeyring.Load()
+}
+
+// Serializer seals string fields on write and opens them on read, so services keep
+// working with plaintext while the database only holds ciphertext.
+type Serializer struct{}
+
+// Scan implements schema.SerializerInterface
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("secret field %s: unsupported database type %T", field.Name, dbValue)
+	}
+
+	plaintext := stored
+	if IsEncrypted(stored) {
+		keyring := Default()
+		if keyring == nil {
+			return fmt.Errorf("secret field %s: %w", field.Name, ErrMissingMasterKey)
+		}
+		var err error
+		if plaintext, err = keyring.Decrypt(stored); err != nil {
+			return fmt.Errorf("secret field %s: %w", field.Name, err)
+		}
+	}
+	return field.Set(ctx, dst, plaintext)
+}
+
+// Value implements schema.SerializerValuerInterface
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plaintext, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("secret field %s must be a string, got %T", field.Name, fieldValue)
+	}
+	keyring := Default()
+	if keyring == nil {
+		return nil, fmt.Errorf("secret field %s: %w", field.Name, ErrMissingMasterKey)
+	}
+	return keyring.Encrypt(plaintext)
+}
@@ -0,0 +1,38 @@
+package repositories
+
+import (
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"gorm.io/gorm"
+)
+
+// IAcmeAccountRepository stores ACME account registrations per directory
+type IAcmeAccountRepository interface {
+	FindByDirectory(directoryURL string) (*entities.AcmeAccount, error)
+	Create(account *entities.AcmeAccount) error
+	Update(account *entities.AcmeAccount) error
+}
+
+type acmeAccountRepository struct {
+	db *gorm.DB
+}
+
+// NewAcmeAccountRepository creates a new ACME account repository
+func NewAcmeAccountRepository(db *gorm.DB) IAcmeAccountRepository {
+	return &acmeAccountRepository{db: db}
+}
+
+func (r *acmeAccountRepository) FindByDirectory(directoryURL string) (*entities.AcmeAccount, error) {
+	var account entities.AcmeAccount
+	if err := r.db.First(&account, "directory_url = ?", directoryURL).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *acmeAccountRepository) Create(account *entities.AcmeAccount) error {
+	return r.db.Create(account).Error
+}
+
+func (r *acmeAccountRepository) Update(account *entities.AcmeAccount) error {
+	return r.db.Save(account).Error
+}
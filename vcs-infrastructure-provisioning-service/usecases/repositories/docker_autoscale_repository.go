@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"gorm.io/gorm"
+)
+
+// IDockerAutoscaleRepository stores autoscaling policies of Docker services and their scaling history
+type IDockerAutoscaleRepository interface {
+	FindPolicy(serviceID string) (*entities.DockerAutoscalePolicy, error)
+	SavePolicy(policy *entities.DockerAutoscalePolicy) error
+	RecordEvaluation(policy *entities.DockerAutoscalePolicy) error
+	DeletePolicy(serviceID string) error
+	ListEnabledPolicies() ([]entities.DockerAutoscalePolicy, error)
+	CreateScalingEvent(event *entities.DockerScalingEvent) error
+	ListScalingEvents(serviceID string, limit int) ([]entities.DockerScalingEvent, error)
+}
+
+type dockerAutoscaleRepository struct {
+	db *gorm.DB
+}
+
+func NewDockerAutoscaleRepository(db *gorm.DB) IDockerAutoscaleRepository {
+	return &dockerAutoscaleRepository{db: db}
+}
+
+func (r *dockerAutoscaleRepository) FindPolicy(serviceID string) (*entities.DockerAutoscalePolicy, error) {
+	var policy entities.DockerAutoscalePolicy
+	if err := r.db.First(&policy, "service_id = ?", serviceID).Error; err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *dockerAutoscaleRepository) SavePolicy(policy *entities.DockerAutoscalePolicy) error {
+	return r.db.Save(policy).Error
+}
+
+// RecordEvaluation stores only the outcome of an evaluation, so a policy changed or deleted
+// while it was being evaluated is left as it is
+func (r *dockerAutoscaleRepository) RecordEvaluation(policy *entities.DockerAutoscalePolicy) error {
+	return r.db.Model(&entities.DockerAutoscalePolicy{}).Where("id = ?", policy.ID).Updates(map[string]interface{}{
+		"last_value":        policy.LastValue,
+		"last_evaluated_at": policy.LastEvaluatedAt,
+		"last_scaled_at":    policy.LastScaledAt,
+	}).Error
+}
+
+func (r *dockerAutoscaleRepository) DeletePolicy(serviceID string) error {
+	return r.db.Where("service_id = ?", serviceID).Delete(&entities.DockerAutoscalePolicy{}).Error
+}
+
+func (r *dockerAutoscaleRepository) ListEnabledPolicies() ([]entities.DockerAutoscalePolicy, error) {
+	var policies []entities.DockerAutoscalePolicy
+	err := r.db.Where("enabled = ?", true).Find(&policies).Error
+	return policies, err
+}
+
+func (r *dockerAutoscaleRepository) CreateScalingEvent(event *entities.DockerScalingEvent) error {
+	return r.db.Create(event).Error
+}
+
+// ListScalingEvents returns the latest scaling events of a service, newest first
+func (r *dockerAutoscaleRepository) ListScalingEvents(serviceID string, limit int) ([]entities.DockerScalingEvent, error) {
+	var events []entities.DockerScalingEvent
+	err := r.db.Where("service_id = ?", serviceID).Order("created_at DESC").Limit(limit).Find(&events).Error
+	return events, err
+}
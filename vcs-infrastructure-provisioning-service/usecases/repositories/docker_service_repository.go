@@ -9,16 +9,35 @@ type IDockerServiceRepository interface {
 	Create(service *entities.DockerService) error
 	FindByID(id string) (*entities.DockerService, error)
 	FindByInfrastructureID(infraID string) (*entities.DockerService, error)
+	FindByUserID(userID string, filter DockerServiceFilter, limit, offset int) ([]entities.DockerService, int64, error)
+	FindByContainerID(containerID string) (*entities.DockerService, error)
+	ListRunningByHealthCheckType(types ...string) ([]entities.DockerService, error)
 	Update(service *entities.DockerService) error
 	Delete(id string) error
 	CreateEnvVar(envVar *entities.DockerEnvVar) error
 	UpdateEnvVars(serviceID string, envVars []entities.DockerEnvVar) error
 	DeleteEnvVarsByServiceID(serviceID string) error
 	CreatePort(port *entities.DockerPort) error
+	UpdatePorts(serviceID string, ports []entities.DockerPort) error
 	CreateNetwork(network *entities.DockerNetwork) error
+	CreateVolumeMount(mount *entities.DockerVolumeMount) error
+	UpdateVolumeMounts(serviceID string, mounts []entities.DockerVolumeMount) error
 	CreateHealthCheck(healthCheck *entities.DockerHealthCheck) error
 	UpdateHealthCheck(healthCheck *entities.DockerHealthCheck) error
 	FindHealthCheckByServiceID(serviceID string) (*entities.DockerHealthCheck, error)
+	CreateReplica(replica *entities.DockerServiceReplica) error
+	UpdateReplica(replica *entities.DockerServiceReplica) error
+	DeleteReplica(id string) error
+	DeleteReplicasByServiceID(serviceID string) error
+}
+
+// DockerServiceFilter narrows a Docker service listing; empty fields match everything
+type DockerServiceFilter struct {
+	Status      string
+	ServiceType string
+	Name        string // case-insensitive substring
+	Image       string
+	Health      string // status of the service health check
 }
 
 type dockerServiceRepository struct {
@@ -29,24 +48,90 @@ func NewDockerServiceRepository(db *gorm.DB) IDockerServiceRepository {
 	return &dockerServiceRepository{db: db}
 }
 
+// preload loads the associations of a Docker service, replicas oldest first
+func (r *dockerServiceRepository) preload(db *gorm.DB) *gorm.DB {
+	return db.Preload("EnvVars").Preload("Ports").Preload("Networks").Preload("Volumes").Preload("HealthCheck").
+		Preload("Containers", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at")
+		})
+}
+
 func (r *dockerServiceRepository) Create(service *entities.DockerService) error {
 	return r.db.Create(service).Error
 }
 
 func (r *dockerServiceRepository) FindByID(id string) (*entities.DockerService, error) {
 	var service entities.DockerService
-	err := r.db.Preload("EnvVars").Preload("Ports").Preload("Networks").Preload("HealthCheck").First(&service, "id = ?", id).Error
+	err := r.preload(r.db).First(&service, "id = ?", id).Error
 	return &service, err
 }
 
 func (r *dockerServiceRepository) FindByInfrastructureID(infraID string) (*entities.DockerService, error) {
 	var service entities.DockerService
-	err := r.db.Preload("EnvVars").Preload("Ports").Preload("Networks").Preload("HealthCheck").First(&service, "infrastructure_id = ?", infraID).Error
+	err := r.preload(r.db).First(&service, "infrastructure_id = ?", infraID).Error
+	return &service, err
+}
+
+func (r *dockerServiceRepository) FindByUserID(userID string, filter DockerServiceFilter, limit, offset int) ([]entities.DockerService, int64, error) {
+	var services []entities.DockerService
+	var count int64
+
+	query := r.db.Model(&entities.DockerService{}).
+		Joins("JOIN infrastructures ON infrastructures.id = docker_services.infrastructure_id").
+		Where("infrastructures.user_id = ? AND infrastructures.status <> ?", userID, entities.StatusDeleted)
+	if filter.Status != "" {
+		query = query.Where("docker_services.status = ?", filter.Status)
+	}
+	if filter.ServiceType != "" {
+		query = query.Where("docker_services.service_type = ?", filter.ServiceType)
+	}
+	if filter.Name != "" {
+		query = query.Where("docker_services.name ILIKE ?", "%"+filter.Name+"%")
+	}
+	if filter.Image != "" {
+		query = query.Where("docker_services.image = ?", filter.Image)
+	}
+	if filter.Health != "" {
+		query = query.Joins("JOIN docker_health_checks ON docker_health_checks.service_id = docker_services.id").
+			Where("docker_health_checks.status = ?", filter.Health)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := r.preload(query).
+		Order("docker_services.created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&services).Error
+	return services, count, err
+}
+
+// FindByContainerID finds the service running a container, through its replicas or, for services
+// created before replication, its own container ID
+func (r *dockerServiceRepository) FindByContainerID(containerID string) (*entities.DockerService, error) {
+	var replica entities.DockerServiceReplica
+	if err := r.db.First(&replica, "container_id = ?", containerID).Error; err == nil {
+		return r.FindByID(replica.ServiceID)
+	}
+	var service entities.DockerService
+	err := r.preload(r.db).First(&service, "container_id = ?", containerID).Error
 	return &service, err
 }
 
+// ListRunningByHealthCheckType returns the running services whose health check has one of types
+func (r *dockerServiceRepository) ListRunningByHealthCheckType(types ...string) ([]entities.DockerService, error) {
+	var services []entities.DockerService
+	err := r.preload(r.db).
+		Where("status = ?", "running").
+		Where("id IN (?)", r.db.Model(&entities.DockerHealthCheck{}).Select("service_id").Where("type IN ?", types)).
+		Find(&services).Error
+	return services, err
+}
+
+// Update saves the service; replicas and volume mounts are only written through their own methods
 func (r *dockerServiceRepository) Update(service *entities.DockerService) error {
-	return r.db.Save(service).Error
+	return r.db.Omit("Containers", "Volumes").Save(service).Error
 }
 
 func (r *dockerServiceRepository) Delete(id string) error {
@@ -79,10 +164,44 @@ func (r *dockerServiceRepository) CreatePort(port *entities.DockerPort) error {
 	return r.db.Create(port).Error
 }
 
+// UpdatePorts replaces every port of a service
+func (r *dockerServiceRepository) UpdatePorts(serviceID string, ports []entities.DockerPort) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("service_id = ?", serviceID).Delete(&entities.DockerPort{}).Error; err != nil {
+			return err
+		}
+		if len(ports) > 0 {
+			if err := tx.Create(&ports).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (r *dockerServiceRepository) CreateNetwork(network *entities.DockerNetwork) error {
 	return r.db.Create(network).Error
 }
 
+func (r *dockerServiceRepository) CreateVolumeMount(mount *entities.DockerVolumeMount) error {
+	return r.db.Create(mount).Error
+}
+
+// UpdateVolumeMounts replaces every mount of a service
+func (r *dockerServiceRepository) UpdateVolumeMounts(serviceID string, mounts []entities.DockerVolumeMount) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("service_id = ?", serviceID).Delete(&entities.DockerVolumeMount{}).Error; err != nil {
+			return err
+		}
+		if len(mounts) > 0 {
+			if err := tx.Create(&mounts).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (r *dockerServiceRepository) CreateHealthCheck(healthCheck *entities.DockerHealthCheck) error {
 	return r.db.Create(healthCheck).Error
 }
@@ -96,3 +215,19 @@ func (r *dockerServiceRepository) FindHealthCheckByServiceID(serviceID string) (
 	err := r.db.First(&healthCheck, "service_id = ?", serviceID).Error
 	return &healthCheck, err
 }
+
+func (r *dockerServiceRepository) CreateReplica(replica *entities.DockerServiceReplica) error {
+	return r.db.Create(replica).Error
+}
+
+func (r *dockerServiceRepository) UpdateReplica(replica *entities.DockerServiceReplica) error {
+	return r.db.Save(replica).Error
+}
+
+func (r *dockerServiceRepository) DeleteReplica(id string) error {
+	return r.db.Delete(&entities.DockerServiceReplica{}, "id = ?", id).Error
+}
+
+func (r *dockerServiceRepository) DeleteReplicasByServiceID(serviceID string) error {
+	return r.db.Where("service_id = ?", serviceID).Delete(&entities.DockerServiceReplica{}).Error
+}
@@ -0,0 +1,104 @@
+package repositories
+
+import (
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"gorm.io/gorm"
+)
+
+// IDockerVolumeRepository stores the named volumes of users and their snapshots
+type IDockerVolumeRepository interface {
+	Create(volume *entities.DockerVolume) error
+	Update(volume *entities.DockerVolume) error
+	Delete(id string) error
+	FindByID(id string) (*entities.DockerVolume, error)
+	FindByUserAndName(userID, name string) (*entities.DockerVolume, error)
+	ListByUser(userID string) ([]entities.DockerVolume, error)
+	ListMounts(volumeID string) ([]entities.DockerVolumeMount, error)
+	CreateSnapshot(snapshot *entities.DockerVolumeSnapshot) error
+	UpdateSnapshot(snapshot *entities.DockerVolumeSnapshot) error
+	DeleteSnapshot(id string) error
+	FindSnapshot(volumeID, id string) (*entities.DockerVolumeSnapshot, error)
+	ListSnapshots(volumeID string) ([]entities.DockerVolumeSnapshot, error)
+}
+
+type dockerVolumeRepository struct {
+	db *gorm.DB
+}
+
+func NewDockerVolumeRepository(db *gorm.DB) IDockerVolumeRepository {
+	return &dockerVolumeRepository{db: db}
+}
+
+func (r *dockerVolumeRepository) Create(volume *entities.DockerVolume) error {
+	return r.db.Create(volume).Error
+}
+
+func (r *dockerVolumeRepository) Update(volume *entities.DockerVolume) error {
+	return r.db.Save(volume).Error
+}
+
+// Delete removes a volume with its snapshot records
+func (r *dockerVolumeRepository) Delete(id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("volume_id = ?", id).Delete(&entities.DockerVolumeSnapshot{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&entities.DockerVolume{}, "id = ?", id).Error
+	})
+}
+
+func (r *dockerVolumeRepository) FindByID(id string) (*entities.DockerVolume, error) {
+	var volume entities.DockerVolume
+	if err := r.db.First(&volume, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &volume, nil
+}
+
+func (r *dockerVolumeRepository) FindByUserAndName(userID, name string) (*entities.DockerVolume, error) {
+	var volume entities.DockerVolume
+	if err := r.db.First(&volume, "user_id = ? AND name = ?", userID, name).Error; err != nil {
+		return nil, err
+	}
+	return &volume, nil
+}
+
+func (r *dockerVolumeRepository) ListByUser(userID string) ([]entities.DockerVolume, error) {
+	var volumes []entities.DockerVolume
+	err := r.db.Where("user_id = ?", userID).Order("name").Find(&volumes).Error
+	return volumes, err
+}
+
+// ListMounts returns the Docker service mounts of a volume
+func (r *dockerVolumeRepository) ListMounts(volumeID string) ([]entities.DockerVolumeMount, error) {
+	var mounts []entities.DockerVolumeMount
+	err := r.db.Where("volume_id = ?", volumeID).Order("created_at").Find(&mounts).Error
+	return mounts, err
+}
+
+func (r *dockerVolumeRepository) CreateSnapshot(snapshot *entities.DockerVolumeSnapshot) error {
+	return r.db.Create(snapshot).Error
+}
+
+func (r *dockerVolumeRepository) UpdateSnapshot(snapshot *entities.DockerVolumeSnapshot) error {
+	return r.db.Save(snapshot).Error
+}
+
+func (r *dockerVolumeRepository) DeleteSnapshot(id string) error {
+	return r.db.Delete(&entities.DockerVolumeSnapshot{}, "id = ?", id).Error
+}
+
+func (r *dockerVolumeRepository) FindSnapshot(volumeID, id string) (*entities.DockerVolumeSnapshot, error) {
+	var snapshot entities.DockerVolumeSnapshot
+	if err := r.db.First(&snapshot, "volume_id = ? AND id = ?", volumeID, id).Error; err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// ListSnapshots returns the snapshots of a volume, newest first
+func (r *dockerVolumeRepository) ListSnapshots(volumeID string) ([]entities.DockerVolumeSnapshot, error) {
+	var snapshots []entities.DockerVolumeSnapshot
+	err := r.db.Where("volume_id = ?", volumeID).Order("created_at DESC").Find(&snapshots).Error
+	return snapshots, err
+}
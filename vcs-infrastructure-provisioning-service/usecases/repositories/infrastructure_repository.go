@@ -96,5 +96,22 @@ func (r *infrastructureRepository) FindByContainerID(ctx context.Context, contai
 		}
 	}
 
+	var nginxNode entities.NginxNode
+	if err := r.db.Where("container_id = ?", containerID).First(&nginxNode).Error; err == nil {
+		var cluster entities.NginxCluster
+		if err := r.db.Where("id = ?", nginxNode.ClusterID).First(&cluster).Error; err == nil {
+			if err := r.db.Where("id = ?", cluster.InfrastructureID).First(&infra).Error; err == nil {
+				return &infra, nil
+			}
+		}
+	}
+
+	var dindEnv entities.DinDEnvironment
+	if err := r.db.Where("container_id = ?", containerID).First(&dindEnv).Error; err == nil {
+		if err := r.db.Where("id = ?", dindEnv.InfrastructureID).First(&infra).Error; err == nil {
+			return &infra, nil
+		}
+	}
+
 	return nil, gorm.ErrRecordNotFound
 }
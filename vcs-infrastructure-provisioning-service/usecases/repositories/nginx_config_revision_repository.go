@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"gorm.io/gorm"
+)
+
+// INginxConfigRevisionRepository stores the config history of Nginx instances and clusters
+type INginxConfigRevisionRepository interface {
+	Create(revision *entities.NginxConfigRevision) error
+	Find(resourceType, resourceID string, revision int) (*entities.NginxConfigRevision, error)
+	FindLatest(resourceType, resourceID string) (*entities.NginxConfigRevision, error)
+	FindLatestByStatus(resourceType, resourceID, status string) (*entities.NginxConfigRevision, error)
+	List(resourceType, resourceID string) ([]entities.NginxConfigRevision, error)
+	DeleteByResource(resourceType, resourceID string) error
+}
+
+type nginxConfigRevisionRepository struct {
+	db *gorm.DB
+}
+
+// NewNginxConfigRevisionRepository creates a new nginx config revision repository
+func NewNginxConfigRevisionRepository(db *gorm.DB) INginxConfigRevisionRepository {
+	return &nginxConfigRevisionRepository{db: db}
+}
+
+func (r *nginxConfigRevisionRepository) Create(revision *entities.NginxConfigRevision) error {
+	return r.db.Create(revision).Error
+}
+
+func (r *nginxConfigRevisionRepository) Find(resourceType, resourceID string, revision int) (*entities.NginxConfigRevision, error) {
+	var rev entities.NginxConfigRevision
+	err := r.db.First(&rev, "resource_type = ? AND resource_id = ? AND revision = ?", resourceType, resourceID, revision).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+func (r *nginxConfigRevisionRepository) FindLatest(resourceType, resourceID string) (*entities.NginxConfigRevision, error) {
+	var rev entities.NginxConfigRevision
+	err := r.db.Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+		Order("revision DESC").First(&rev).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+func (r *nginxConfigRevisionRepository) FindLatestByStatus(resourceType, resourceID, status string) (*entities.NginxConfigRevision, error) {
+	var rev entities.NginxConfigRevision
+	err := r.db.Where("resource_type = ? AND resource_id = ? AND validation_status = ?", resourceType, resourceID, status).
+		Order("revision DESC").First(&rev).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+func (r *nginxConfigRevisionRepository) List(resourceType, resourceID string) ([]entities.NginxConfigRevision, error) {
+	var revisions []entities.NginxConfigRevision
+	err := r.db.Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+		Order("revision DESC").Find(&revisions).Error
+	return revisions, err
+}
+
+func (r *nginxConfigRevisionRepository) DeleteByResource(resourceType, resourceID string) error {
+	return r.db.Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+		Delete(&entities.NginxConfigRevision{}).Error
+}
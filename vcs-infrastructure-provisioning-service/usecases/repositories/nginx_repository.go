@@ -1,6 +1,8 @@
 package repositories
 
 import (
+	"time"
+
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
 	"gorm.io/gorm"
 )
@@ -23,13 +25,21 @@ type INginxRepository interface {
 	ListRoutes(nginxID string) ([]entities.NginxRoute, error)
 	CreateOrUpdateCertificate(cert *entities.NginxCertificate) error
 	GetCertificate(nginxID string) (*entities.NginxCertificate, error)
+	DeleteCertificate(nginxID string) error
+	ListCertificates() ([]entities.NginxCertificate, error)
+	ListRenewableCertificates(expiresBefore time.Time) ([]entities.NginxCertificate, error)
 	CreateOrUpdateUpstream(upstream *entities.NginxUpstream) error
 	DeleteUpstreamBackends(upstreamID string) error
 	CreateUpstreamBackend(backend *entities.NginxUpstreamBackend) error
 	ListUpstreams(nginxID string) ([]entities.NginxUpstream, error)
+	UpdateUpstreamBackend(backend *entities.NginxUpstreamBackend) error
+	ListWithUpstreams() ([]entities.NginxInstance, error)
+	ListAll() ([]entities.NginxInstance, error)
 	CreateOrUpdateSecurity(security *entities.NginxSecurity) error
 	GetSecurity(nginxID string) (*entities.NginxSecurity, error)
 	DeleteSecurity(nginxID string) error
+	ReplaceConfigState(instance *entities.NginxInstance, domains []entities.NginxDomain, routes []entities.NginxRoute,
+		upstreams []entities.NginxUpstream, cert *entities.NginxCertificate, security *entities.NginxSecurity) error
 }
 
 type nginxRepository struct {
@@ -133,6 +143,23 @@ func (r *nginxRepository) GetCertificate(nginxID string) (*entities.NginxCertifi
 	return &cert, nil
 }
 
+func (r *nginxRepository) DeleteCertificate(nginxID string) error {
+	return r.db.Where("nginx_id = ?", nginxID).Delete(&entities.NginxCertificate{}).Error
+}
+
+func (r *nginxRepository) ListCertificates() ([]entities.NginxCertificate, error) {
+	var certs []entities.NginxCertificate
+	err := r.db.Order("expires_at").Find(&certs).Error
+	return certs, err
+}
+
+// ListRenewableCertificates returns auto-renewing certificates that expire before the given time
+func (r *nginxRepository) ListRenewableCertificates(expiresBefore time.Time) ([]entities.NginxCertificate, error) {
+	var certs []entities.NginxCertificate
+	err := r.db.Where("auto_renew = ? AND expires_at < ?", true, expiresBefore).Order("expires_at").Find(&certs).Error
+	return certs, err
+}
+
 func (r *nginxRepository) CreateOrUpdateUpstream(upstream *entities.NginxUpstream) error {
 	var existing entities.NginxUpstream
 	if err := r.db.Where("nginx_id = ? AND name = ?", upstream.NginxID, upstream.Name).First(&existing).Error; err == nil {
@@ -158,6 +185,25 @@ func (r *nginxRepository) ListUpstreams(nginxID string) ([]entities.NginxUpstrea
 	return upstreams, nil
 }
 
+func (r *nginxRepository) UpdateUpstreamBackend(backend *entities.NginxUpstreamBackend) error {
+	return r.db.Save(backend).Error
+}
+
+// ListWithUpstreams returns the instances that have at least one upstream defined
+func (r *nginxRepository) ListWithUpstreams() ([]entities.NginxInstance, error) {
+	var instances []entities.NginxInstance
+	err := r.db.Preload("Infrastructure").
+		Where("id IN (?)", r.db.Model(&entities.NginxUpstream{}).Select("nginx_id")).
+		Find(&instances).Error
+	return instances, err
+}
+
+func (r *nginxRepository) ListAll() ([]entities.NginxInstance, error) {
+	var instances []entities.NginxInstance
+	err := r.db.Preload("Infrastructure").Find(&instances).Error
+	return instances, err
+}
+
 func (r *nginxRepository) CreateOrUpdateSecurity(security *entities.NginxSecurity) error {
 	var existing entities.NginxSecurity
 	if err := r.db.Where("nginx_id = ?", security.NginxID).First(&existing).Error; err == nil {
@@ -178,3 +224,64 @@ func (r *nginxRepository) GetSecurity(nginxID string) (*entities.NginxSecurity,
 func (r *nginxRepository) DeleteSecurity(nginxID string) error {
 	return r.db.Where("nginx_id = ?", nginxID).Delete(&entities.NginxSecurity{}).Error
 }
+
+// ReplaceConfigState overwrites everything an instance's config is rendered from in one transaction
+func (r *nginxRepository) ReplaceConfigState(instance *entities.NginxInstance, domains []entities.NginxDomain, routes []entities.NginxRoute,
+	upstreams []entities.NginxUpstream, cert *entities.NginxCertificate, security *entities.NginxSecurity) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(instance).Updates(map[string]interface{}{"config": instance.Config, "waf_mode": instance.WAFMode}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("nginx_id = ?", instance.ID).Delete(&entities.NginxDomain{}).Error; err != nil {
+			return err
+		}
+		for i := range domains {
+			if err := tx.Create(&domains[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("nginx_id = ?", instance.ID).Delete(&entities.NginxRoute{}).Error; err != nil {
+			return err
+		}
+		for i := range routes {
+			if err := tx.Create(&routes[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		upstreamIDs := tx.Model(&entities.NginxUpstream{}).Select("id").Where("nginx_id = ?", instance.ID)
+		if err := tx.Where("upstream_id IN (?)", upstreamIDs).Delete(&entities.NginxUpstreamBackend{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("nginx_id = ?", instance.ID).Delete(&entities.NginxUpstream{}).Error; err != nil {
+			return err
+		}
+		for i := range upstreams {
+			// Backends are created through the association
+			if err := tx.Create(&upstreams[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("nginx_id = ?", instance.ID).Delete(&entities.NginxCertificate{}).Error; err != nil {
+			return err
+		}
+		if cert != nil {
+			if err := tx.Create(cert).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("nginx_id = ?", instance.ID).Delete(&entities.NginxSecurity{}).Error; err != nil {
+			return err
+		}
+		if security != nil {
+			if err := tx.Create(security).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
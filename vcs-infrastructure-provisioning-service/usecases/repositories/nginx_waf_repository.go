@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"gorm.io/gorm"
+)
+
+// INginxWAFRepository stores the WAF rule exclusions of Nginx instances and clusters
+type INginxWAFRepository interface {
+	CreateExclusion(exclusion *entities.NginxWAFExclusion) error
+	FindExclusion(resourceType, resourceID, id string) (*entities.NginxWAFExclusion, error)
+	ListExclusions(resourceType, resourceID string) ([]entities.NginxWAFExclusion, error)
+	DeleteExclusion(id string) error
+	ReplaceExclusions(resourceType, resourceID string, exclusions []entities.NginxWAFExclusion) error
+	DeleteByResource(resourceType, resourceID string) error
+}
+
+type nginxWAFRepository struct {
+	db *gorm.DB
+}
+
+// NewNginxWAFRepository creates a new nginx WAF repository
+func NewNginxWAFRepository(db *gorm.DB) INginxWAFRepository {
+	return &nginxWAFRepository{db: db}
+}
+
+func (r *nginxWAFRepository) CreateExclusion(exclusion *entities.NginxWAFExclusion) error {
+	return r.db.Create(exclusion).Error
+}
+
+func (r *nginxWAFRepository) FindExclusion(resourceType, resourceID, id string) (*entities.NginxWAFExclusion, error) {
+	var exclusion entities.NginxWAFExclusion
+	err := r.db.First(&exclusion, "resource_type = ? AND resource_id = ? AND id = ?", resourceType, resourceID, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &exclusion, nil
+}
+
+func (r *nginxWAFRepository) ListExclusions(resourceType, resourceID string) ([]entities.NginxWAFExclusion, error) {
+	var exclusions []entities.NginxWAFExclusion
+	err := r.db.Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+		Order("created_at ASC").Find(&exclusions).Error
+	return exclusions, err
+}
+
+func (r *nginxWAFRepository) DeleteExclusion(id string) error {
+	return r.db.Delete(&entities.NginxWAFExclusion{}, "id = ?", id).Error
+}
+
+// ReplaceExclusions swaps the exclusions of a resource for the given set, used on rollback
+func (r *nginxWAFRepository) ReplaceExclusions(resourceType, resourceID string, exclusions []entities.NginxWAFExclusion) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+			Delete(&entities.NginxWAFExclusion{}).Error; err != nil {
+			return err
+		}
+		if len(exclusions) == 0 {
+			return nil
+		}
+		return tx.Create(&exclusions).Error
+	})
+}
+
+func (r *nginxWAFRepository) DeleteByResource(resourceType, resourceID string) error {
+	return r.db.Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+		Delete(&entities.NginxWAFExclusion{}).Error
+}
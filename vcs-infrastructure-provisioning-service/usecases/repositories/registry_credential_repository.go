@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"gorm.io/gorm"
+)
+
+// IRegistryCredentialRepository stores the private registry credentials of users
+type IRegistryCredentialRepository interface {
+	Create(credential *entities.RegistryCredential) error
+	Update(credential *entities.RegistryCredential) error
+	Delete(id string) error
+	FindByID(id string) (*entities.RegistryCredential, error)
+	FindByUserAndName(userID, name string) (*entities.RegistryCredential, error)
+	ListByUser(userID, projectID string) ([]entities.RegistryCredential, error)
+	CountReferences(id string) (int64, error)
+}
+
+type registryCredentialRepository struct {
+	db *gorm.DB
+}
+
+func NewRegistryCredentialRepository(db *gorm.DB) IRegistryCredentialRepository {
+	return &registryCredentialRepository{db: db}
+}
+
+func (r *registryCredentialRepository) Create(credential *entities.RegistryCredential) error {
+	return r.db.Create(credential).Error
+}
+
+func (r *registryCredentialRepository) Update(credential *entities.RegistryCredential) error {
+	return r.db.Save(credential).Error
+}
+
+func (r *registryCredentialRepository) Delete(id string) error {
+	return r.db.Delete(&entities.RegistryCredential{}, "id = ?", id).Error
+}
+
+func (r *registryCredentialRepository) FindByID(id string) (*entities.RegistryCredential, error) {
+	var credential entities.RegistryCredential
+	if err := r.db.First(&credential, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+func (r *registryCredentialRepository) FindByUserAndName(userID, name string) (*entities.RegistryCredential, error) {
+	var credential entities.RegistryCredential
+	if err := r.db.First(&credential, "user_id = ? AND name = ?", userID, name).Error; err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// ListByUser returns the credentials of a user ordered by name, only those of projectID when set
+func (r *registryCredentialRepository) ListByUser(userID, projectID string) ([]entities.RegistryCredential, error) {
+	var credentials []entities.RegistryCredential
+	query := r.db.Where("user_id = ?", userID)
+	if projectID != "" {
+		query = query.Where("project_id = ?", projectID)
+	}
+	err := query.Order("name").Find(&credentials).Error
+	return credentials, err
+}
+
+// CountReferences counts the Docker services and DinD environments pulling with a credential
+func (r *registryCredentialRepository) CountReferences(id string) (int64, error) {
+	var services, environments int64
+	if err := r.db.Model(&entities.DockerService{}).Where("registry_credential_id = ?", id).Count(&services).Error; err != nil {
+		return 0, err
+	}
+	if err := r.db.Model(&entities.DinDEnvironment{}).Where("registry_credential_id = ?", id).Count(&environments).Error; err != nil {
+		return 0, err
+	}
+	return services + environments, nil
+}
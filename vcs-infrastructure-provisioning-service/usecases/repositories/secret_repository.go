@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/secrets"
+	"gorm.io/gorm"
+)
+
+// SecretColumn is a column stored through the secret serializer
+type SecretColumn struct {
+	Table  string
+	Column string
+}
+
+// SecretValue is the raw, still sealed, value of a secret column
+type SecretValue struct {
+	ID    string
+	Value string
+}
+
+// ISecretRepository reads and writes sealed secret columns directly, bypassing the
+// serializer, so values can be re-encrypted without loading whole entities
+type ISecretRepository interface {
+	SecretColumns(model interface{}) ([]SecretColumn, error)
+	ListValues(column SecretColumn, afterID string, limit int) ([]SecretValue, error)
+	UpdateValue(column SecretColumn, id, oldValue, newValue string) (bool, error)
+}
+
+type secretRepository struct {
+	db *gorm.DB
+}
+
+// NewSecretRepository creates a new secret repository
+func NewSecretRepository(db *gorm.DB) ISecretRepository {
+	return &secretRepository{db: db}
+}
+
+// SecretColumns lists the columns of model tagged with the secret serializer
+func (r *secretRepository) SecretColumns(model interface{}) ([]SecretColumn, error) {
+	stmt := &gorm.Statement{DB: r.db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+
+	columns := []SecretColumn{}
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName != "" && field.TagSettings["SERIALIZER"] == secrets.SerializerName {
+			columns = append(columns, SecretColumn{Table: stmt.Schema.Table, Column: field.DBName})
+		}
+	}
+	return columns, nil
+}
+
+func (r *secretRepository) ListValues(column SecretColumn, afterID string, limit int) ([]SecretValue, error) {
+	// IDs are compared as text since some tables key on uuid
+	var values []SecretValue
+	err := r.db.Table(column.Table).
+		Select("CAST(id AS TEXT) AS id, "+column.Column+" AS value").
+		Where("CAST(id AS TEXT) > ? AND "+column.Column+" IS NOT NULL AND "+column.Column+" <> ''", afterID).
+		Order("CAST(id AS TEXT)").
+		Limit(limit).
+		Scan(&values).Error
+	return values, err
+}
+
+// UpdateValue swaps the sealed value only if it is unchanged since it was read
+func (r *secretRepository) UpdateValue(column SecretColumn, id, oldValue, newValue string) (bool, error) {
+	result := r.db.Table(column.Table).
+		Where("id = ? AND "+column.Column+" = ?", id, oldValue).
+		UpdateColumn(column.Column, newValue)
+	return result.RowsAffected > 0, result.Error
+}
@@ -1,22 +1,28 @@
 package repositories
 
 import (
+	"time"
+
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type IStackRepository interface {
 	// Stack CRUD
 	Create(stack *entities.Stack) error
 	FindByID(id string) (*entities.Stack, error)
-	FindByUserID(userID string, limit, offset int) ([]entities.Stack, int64, error)
+	FindByUserID(userID, health string, limit, offset int) ([]entities.Stack, int64, error)
+	FindActive() ([]entities.Stack, error)
 	Update(stack *entities.Stack) error
+	UpdateHealth(stackID string, health entities.StackHealth, checkedAt time.Time) error
 	Delete(id string) error
 
 	// Stack Resources
 	CreateResource(resource *entities.StackResource) error
 	FindResourcesByStackID(stackID string) ([]entities.StackResource, error)
 	FindResourceByInfrastructureID(infraID string) (*entities.StackResource, error)
+	UpdateResourceHealth(id, health, message string) error
 	DeleteResource(id string) error
 	DeleteResourcesByStackID(stackID string) error
 
@@ -25,12 +31,18 @@ type IStackRepository interface {
 	FindTemplateByID(id string) (*entities.StackTemplate, error)
 	FindTemplatesByCategory(category string) ([]entities.StackTemplate, error)
 	FindPublicTemplates() ([]entities.StackTemplate, error)
+	UpdateTemplate(template *entities.StackTemplate) error
+	CreateTemplateVersion(version *entities.StackTemplateVersion) error
+	FindTemplateVersion(templateID string, version int) (*entities.StackTemplateVersion, error)
+	FindTemplateVersions(templateID string) ([]entities.StackTemplateVersion, error)
 
 	// Stack Operations
-	CreateOperation(operation *entities.StackOperation) error
+	CreateOperationIfIdle(operation *entities.StackOperation) (*entities.StackOperation, error)
 	FindOperationByID(id string) (*entities.StackOperation, error)
 	FindOperationsByStackID(stackID string) ([]entities.StackOperation, error)
+	FindOperationsByStatus(statuses []string) ([]entities.StackOperation, error)
 	UpdateOperation(operation *entities.StackOperation) error
+	TransitionOperation(id, from, to string) (bool, error)
 	DeleteOperationsByStackID(stackID string) error
 }
 
@@ -53,11 +65,14 @@ func (r *stackRepository) FindByID(id string) (*entities.Stack, error) {
 	return &stack, err
 }
 
-func (r *stackRepository) FindByUserID(userID string, limit, offset int) ([]entities.Stack, int64, error) {
+func (r *stackRepository) FindByUserID(userID, health string, limit, offset int) ([]entities.Stack, int64, error) {
 	var stacks []entities.Stack
 	var count int64
 
 	query := r.db.Model(&entities.Stack{}).Where("user_id = ?", userID)
+	if health != "" {
+		query = query.Where("health = ?", health)
+	}
 	query.Count(&count)
 
 	err := query.Preload("Resources").
@@ -69,10 +84,26 @@ func (r *stackRepository) FindByUserID(userID string, limit, offset int) ([]enti
 	return stacks, count, err
 }
 
+// FindActive returns stacks whose resources exist and can be health checked
+func (r *stackRepository) FindActive() ([]entities.Stack, error) {
+	var stacks []entities.Stack
+	err := r.db.Where("status NOT IN ?", []entities.StackStatus{
+		entities.StackStatusCreating,
+		entities.StackStatusDeleting,
+		entities.StackStatusDeleted,
+	}).Find(&stacks).Error
+	return stacks, err
+}
+
 func (r *stackRepository) Update(stack *entities.Stack) error {
 	return r.db.Save(stack).Error
 }
 
+func (r *stackRepository) UpdateHealth(stackID string, health entities.StackHealth, checkedAt time.Time) error {
+	return r.db.Model(&entities.Stack{}).Where("id = ?", stackID).
+		Updates(map[string]interface{}{"health": health, "health_checked_at": checkedAt}).Error
+}
+
 func (r *stackRepository) Delete(id string) error {
 	return r.db.Delete(&entities.Stack{}, "id = ?", id).Error
 }
@@ -97,6 +128,11 @@ func (r *stackRepository) FindResourceByInfrastructureID(infraID string) (*entit
 	return &resource, err
 }
 
+func (r *stackRepository) UpdateResourceHealth(id, health, message string) error {
+	return r.db.Model(&entities.StackResource{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"health": health, "health_message": message}).Error
+}
+
 func (r *stackRepository) DeleteResource(id string) error {
 	return r.db.Delete(&entities.StackResource{}, "id = ?", id).Error
 }
@@ -128,9 +164,53 @@ func (r *stackRepository) FindPublicTemplates() ([]entities.StackTemplate, error
 	return templates, err
 }
 
+func (r *stackRepository) UpdateTemplate(template *entities.StackTemplate) error {
+	return r.db.Save(template).Error
+}
+
+func (r *stackRepository) CreateTemplateVersion(version *entities.StackTemplateVersion) error {
+	return r.db.Create(version).Error
+}
+
+func (r *stackRepository) FindTemplateVersion(templateID string, version int) (*entities.StackTemplateVersion, error) {
+	var templateVersion entities.StackTemplateVersion
+	err := r.db.First(&templateVersion, "template_id = ? AND version = ?", templateID, version).Error
+	return &templateVersion, err
+}
+
+func (r *stackRepository) FindTemplateVersions(templateID string) ([]entities.StackTemplateVersion, error) {
+	var versions []entities.StackTemplateVersion
+	err := r.db.Where("template_id = ?", templateID).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
 // Stack Operations
-func (r *stackRepository) CreateOperation(operation *entities.StackOperation) error {
-	return r.db.Create(operation).Error
+
+// CreateOperationIfIdle records the operation unless the stack already has a pending
+// or in-progress one, which is returned instead. The stack row is locked so two
+// concurrent requests cannot both start an operation.
+func (r *stackRepository) CreateOperationIfIdle(operation *entities.StackOperation) (*entities.StackOperation, error) {
+	var active *entities.StackOperation
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var stack entities.Stack
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&stack, "id = ?", operation.StackID).Error; err != nil {
+			return err
+		}
+
+		var existing []entities.StackOperation
+		if err := tx.Where("stack_id = ? AND status IN ?", operation.StackID, []string{
+			entities.StackOperationPending,
+			entities.StackOperationInProgress,
+		}).Limit(1).Find(&existing).Error; err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			active = &existing[0]
+			return nil
+		}
+		return tx.Create(operation).Error
+	})
+	return active, err
 }
 
 func (r *stackRepository) FindOperationByID(id string) (*entities.StackOperation, error) {
@@ -145,10 +225,25 @@ func (r *stackRepository) FindOperationsByStackID(stackID string) ([]entities.St
 	return operations, err
 }
 
+func (r *stackRepository) FindOperationsByStatus(statuses []string) ([]entities.StackOperation, error) {
+	var operations []entities.StackOperation
+	err := r.db.Where("status IN ?", statuses).Order("started_at ASC").Find(&operations).Error
+	return operations, err
+}
+
 func (r *stackRepository) UpdateOperation(operation *entities.StackOperation) error {
 	return r.db.Save(operation).Error
 }
 
+// TransitionOperation moves the operation from status from to status to and reports whether
+// it did; false means another writer changed the status first
+func (r *stackRepository) TransitionOperation(id, from, to string) (bool, error) {
+	result := r.db.Model(&entities.StackOperation{}).
+		Where("id = ? AND status = ?", id, from).
+		Update("status", to)
+	return result.RowsAffected > 0, result.Error
+}
+
 func (r *stackRepository) DeleteOperationsByStackID(stackID string) error {
 	return r.db.Where("stack_id = ?", stackID).Delete(&entities.StackOperation{}).Error
 }
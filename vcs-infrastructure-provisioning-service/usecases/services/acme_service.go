@@ -0,0 +1,586 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/kafka"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/env"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme"
+	"gorm.io/gorm"
+)
+
+const (
+	acmeDefaultRenewBefore   = 30 * 24 * time.Hour
+	acmeDefaultCheckInterval = 12 * time.Hour
+	acmeOrderTimeout         = 5 * time.Minute
+
+	// Cluster server block certificates are installed per server block on every node
+	nginxClusterCertDir = "/etc/nginx/ssl"
+)
+
+// HTTP-01 cannot validate wildcards, so only plain host names are accepted
+var acmeDomainPattern = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)+$`)
+
+// ACME tokens are base64url; anything else is refused before it reaches a shell
+var acmeTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// IAcmeService issues and renews certificates over ACME for Nginx instances and cluster server blocks
+type IAcmeService interface {
+	IssueNginxCertificate(ctx context.Context, id string, req dto.IssueAcmeCertificateRequest) (*dto.CertificateInfo, error)
+	IssueServerBlockCertificate(ctx context.Context, clusterID, blockID string, req dto.IssueAcmeCertificateRequest) (*dto.CertificateInfo, error)
+	RenewDueCertificates(ctx context.Context)
+	Start(ctx context.Context)
+}
+
+type acmeService struct {
+	env           env.AcmeEnv
+	accountRepo   repositories.IAcmeAccountRepository
+	nginxRepo     repositories.INginxRepository
+	clusterRepo   repositories.INginxClusterRepository
+	nginxService  INginxService
+	clusterSvc    INginxClusterService
+	dockerSvc     docker.IDockerService
+	kafkaProducer kafka.IKafkaProducer
+	logger        logger.ILogger
+
+	// Orders are serialized so renewals and API requests never race on the same owner
+	mu     sync.Mutex
+	client *acme.Client
+}
+
+// issuedCertificate is a freshly ordered certificate chain and its key, PEM encoded
+type issuedCertificate struct {
+	certificate string
+	privateKey  string
+	leaf        *x509.Certificate
+}
+
+func NewAcmeService(
+	acmeEnv env.AcmeEnv,
+	accountRepo repositories.IAcmeAccountRepository,
+	nginxRepo repositories.INginxRepository,
+	clusterRepo repositories.INginxClusterRepository,
+	nginxService INginxService,
+	clusterSvc INginxClusterService,
+	dockerSvc docker.IDockerService,
+	kafkaProducer kafka.IKafkaProducer,
+	logger logger.ILogger,
+) IAcmeService {
+	if acmeEnv.DirectoryURL == "" {
+		acmeEnv.DirectoryURL = acme.LetsEncryptURL
+	}
+	return &acmeService{
+		env:           acmeEnv,
+		accountRepo:   accountRepo,
+		nginxRepo:     nginxRepo,
+		clusterRepo:   clusterRepo,
+		nginxService:  nginxService,
+		clusterSvc:    clusterSvc,
+		dockerSvc:     dockerSvc,
+		kafkaProducer: kafkaProducer,
+		logger:        logger,
+	}
+}
+
+// Start runs the renewal check in the background until ctx is cancelled
+func (s *acmeService) Start(ctx context.Context) {
+	interval := acmeDefaultCheckInterval
+	if d, err := time.ParseDuration(s.env.RenewCheckInterval); err == nil && d > 0 {
+		interval = d
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			s.RenewDueCertificates(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RenewDueCertificates re-orders every auto-renewing certificate inside the renewal window.
+// Failures are kept on the certificate and retried on the next check.
+func (s *acmeService) RenewDueCertificates(ctx context.Context) {
+	certs, err := s.nginxRepo.ListRenewableCertificates(time.Now().Add(s.renewBefore()))
+	if err != nil {
+		s.logger.Error("failed to list certificates due for renewal", zap.Error(err))
+		return
+	}
+
+	for i := range certs {
+		if ctx.Err() != nil {
+			return
+		}
+		cert := &certs[i]
+		req := dto.IssueAcmeCertificateRequest{Domains: splitList(cert.Domain)}
+
+		var renewErr error
+		if cert.OwnerType == entities.CertificateOwnerServerBlock {
+			block, err := s.clusterRepo.FindServerBlockByID(cert.NginxID)
+			if err != nil {
+				renewErr = err
+			} else {
+				_, renewErr = s.IssueServerBlockCertificate(ctx, block.ClusterID, block.ID, req)
+			}
+		} else {
+			instance, err := s.nginxRepo.FindByID(cert.NginxID)
+			if err != nil {
+				renewErr = err
+			} else {
+				_, renewErr = s.IssueNginxCertificate(ctx, instance.InfrastructureID, req)
+			}
+		}
+
+		// The owner was deleted, so there is nothing left to renew for
+		if errors.Is(renewErr, gorm.ErrRecordNotFound) {
+			if err := s.nginxRepo.DeleteCertificate(cert.NginxID); err != nil {
+				s.logger.Error("failed to delete orphaned certificate", zap.String("owner_id", cert.NginxID), zap.Error(err))
+			}
+			continue
+		}
+		if renewErr != nil {
+			s.logger.Error("failed to renew certificate", zap.String("owner_id", cert.NginxID),
+				zap.String("domain", cert.Domain), zap.Error(renewErr))
+			cert.RenewalError = renewErr.Error()
+			if err := s.nginxRepo.CreateOrUpdateCertificate(cert); err != nil {
+				s.logger.Error("failed to record renewal error", zap.Error(err))
+			}
+		}
+	}
+}
+
+// IssueNginxCertificate orders a certificate for a standalone instance and installs it
+// through the regular certificate upload path, so it is validated and versioned like any other change
+func (s *acmeService) IssueNginxCertificate(ctx context.Context, id string, req dto.IssueAcmeCertificateRequest) (*dto.CertificateInfo, error) {
+	instance, err := s.nginxRepo.FindByInfrastructureID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	domains := req.Domains
+	if len(domains) == 0 {
+		existing, err := s.nginxRepo.ListDomains(instance.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range existing {
+			domains = append(domains, d.Domain)
+		}
+	}
+	if err := validateAcmeDomains(domains); err != nil {
+		return nil, err
+	}
+	if instance.ContainerID == "" {
+		return nil, fmt.Errorf("nginx instance has no running container to answer ACME challenges")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issued, err := s.obtainCertificate(ctx, domains, []string{instance.ContainerID})
+	if err != nil {
+		return nil, err
+	}
+
+	upload := dto.UploadCertificateRequest{
+		Certificate: issued.certificate,
+		PrivateKey:  issued.privateKey,
+		Domain:      strings.Join(domains, ","),
+	}
+	if err := s.nginxService.UploadCertificate(ctx, id, upload); err != nil {
+		return nil, fmt.Errorf("failed to install certificate: %w", err)
+	}
+
+	cert, err := s.nginxRepo.GetCertificate(instance.ID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	cert.Source = entities.CertificateSourceAcme
+	cert.AutoRenew = !req.DisableAutoRenew
+	cert.LastRenewalAt = &now
+	cert.RenewalError = ""
+	if err := s.nginxRepo.CreateOrUpdateCertificate(cert); err != nil {
+		return nil, err
+	}
+
+	s.publishEvent(ctx, instance.InfrastructureID, "nginx", cert)
+	return toCertificateInfo(cert), nil
+}
+
+// IssueServerBlockCertificate orders a certificate for a cluster server block, stores it and
+// re-renders the cluster config, which writes it to every node since the virtual IP can move
+// to any of them
+func (s *acmeService) IssueServerBlockCertificate(ctx context.Context, clusterID, blockID string, req dto.IssueAcmeCertificateRequest) (*dto.CertificateInfo, error) {
+	block, err := s.clusterRepo.FindServerBlockByID(blockID)
+	if err != nil {
+		return nil, err
+	}
+	if block.ClusterID != clusterID {
+		return nil, fmt.Errorf("server block %s does not belong to cluster %s", blockID, clusterID)
+	}
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	domains := req.Domains
+	if len(domains) == 0 {
+		domains = strings.Fields(block.ServerName)
+	}
+	if err := validateAcmeDomains(domains); err != nil {
+		return nil, err
+	}
+
+	nodes, err := s.clusterRepo.ListNodes(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	containerIDs := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if node.ContainerID != "" {
+			containerIDs = append(containerIDs, node.ContainerID)
+		}
+	}
+	if len(containerIDs) == 0 {
+		return nil, fmt.Errorf("cluster has no nodes to answer ACME challenges")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issued, err := s.obtainCertificate(ctx, domains, containerIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	cert := &entities.NginxCertificate{
+		ID:            uuid.New().String(),
+		NginxID:       block.ID,
+		OwnerType:     entities.CertificateOwnerServerBlock,
+		Domain:        strings.Join(domains, ","),
+		Certificate:   issued.certificate,
+		PrivateKey:    issued.privateKey,
+		Status:        "valid",
+		ExpiresAt:     issued.leaf.NotAfter,
+		Issuer:        issued.leaf.Issuer.String(),
+		Source:        entities.CertificateSourceAcme,
+		AutoRenew:     !req.DisableAutoRenew,
+		LastRenewalAt: &now,
+	}
+	if err := s.nginxRepo.CreateOrUpdateCertificate(cert); err != nil {
+		return nil, err
+	}
+
+	block.SSLEnabled = true
+	block.SSLCertID = cert.ID
+	if err := s.clusterRepo.UpdateServerBlock(block); err != nil {
+		return nil, err
+	}
+	if err := s.clusterSvc.RefreshServerBlocks(ctx, clusterID); err != nil {
+		return nil, fmt.Errorf("certificate stored but not applied: %w", err)
+	}
+
+	s.publishEvent(ctx, cluster.InfrastructureID, "nginx_cluster", cert)
+	return toCertificateInfo(cert), nil
+}
+
+// obtainCertificate runs a full ACME order, answering HTTP-01 challenges from the given containers
+func (s *acmeService) obtainCertificate(ctx context.Context, domains []string, containerIDs []string) (*issuedCertificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, acmeOrderTimeout)
+	defer cancel()
+
+	client, err := s.acmeClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domains...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ACME order: %w", err)
+	}
+
+	var tokens []string
+	defer func() {
+		// The order context may already be done, cleanup still has to run
+		for _, token := range tokens {
+			s.removeChallenge(context.Background(), containerIDs, token)
+		}
+	}()
+
+	for _, authzURL := range order.AuthzURLs {
+		authz, err := client.GetAuthorization(ctx, authzURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ACME authorization: %w", err)
+		}
+		if authz.Status == acme.StatusValid {
+			continue
+		}
+
+		var challenge *acme.Challenge
+		for _, c := range authz.Challenges {
+			if c.Type == "http-01" {
+				challenge = c
+				break
+			}
+		}
+		if challenge == nil {
+			return nil, fmt.Errorf("ACME server offered no http-01 challenge for %s", authz.Identifier.Value)
+		}
+
+		keyAuth, err := client.HTTP01ChallengeResponse(challenge.Token)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.presentChallenge(ctx, containerIDs, challenge.Token, keyAuth); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, challenge.Token)
+
+		if _, err := client.Accept(ctx, challenge); err != nil {
+			return nil, fmt.Errorf("failed to accept ACME challenge for %s: %w", authz.Identifier.Value, err)
+		}
+		if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+			return nil, fmt.Errorf("ACME authorization for %s failed: %w", authz.Identifier.Value, err)
+		}
+	}
+
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, fmt.Errorf("ACME order failed: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to finalize ACME order: %w", err)
+	}
+	return encodeIssuedCertificate(chain, key)
+}
+
+// presentChallenge publishes the key authorization on every container serving the domains
+func (s *acmeService) presentChallenge(ctx context.Context, containerIDs []string, token, keyAuth string) error {
+	if !acmeTokenPattern.MatchString(token) {
+		return fmt.Errorf("invalid ACME challenge token %q", token)
+	}
+	dir := nginxAcmeWebroot + nginxAcmeChallengePath
+	script := fmt.Sprintf("mkdir -p %s && printf '%%s' '%s' > %s%s", dir, keyAuth, dir, token)
+	for _, containerID := range containerIDs {
+		if _, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", script}); err != nil {
+			return fmt.Errorf("failed to publish ACME challenge: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *acmeService) removeChallenge(ctx context.Context, containerIDs []string, token string) {
+	file := nginxAcmeWebroot + nginxAcmeChallengePath + token
+	for _, containerID := range containerIDs {
+		if _, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"rm", "-f", file}); err != nil {
+			s.logger.Warn("failed to remove ACME challenge", zap.String("container_id", containerID), zap.Error(err))
+		}
+	}
+}
+
+// acmeClient returns a client bound to the stored account, registering one on first use
+func (s *acmeService) acmeClient(ctx context.Context) (*acme.Client, error) {
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	httpClient, err := s.httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := s.accountRepo.FindByDirectory(s.env.DirectoryURL)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var key *ecdsa.PrivateKey
+	if account != nil {
+		if key, err = parseAcmeAccountKey(account.PrivateKey); err != nil {
+			return nil, err
+		}
+	} else {
+		if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		account = &entities.AcmeAccount{
+			ID:           uuid.New().String(),
+			DirectoryURL: s.env.DirectoryURL,
+			Email:        s.env.Email,
+			PrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})),
+		}
+		// The key is stored before registering so a failed registration never orphans an account
+		if err := s.accountRepo.Create(account); err != nil {
+			return nil, err
+		}
+	}
+
+	client := &acme.Client{
+		Key:          key,
+		DirectoryURL: s.env.DirectoryURL,
+		HTTPClient:   httpClient,
+		UserAgent:    "iaas-provisioning-service",
+	}
+
+	if account.URI == "" {
+		registration := &acme.Account{}
+		if s.env.Email != "" {
+			registration.Contact = []string{"mailto:" + s.env.Email}
+		}
+		registered, err := client.Register(ctx, registration, acme.AcceptTOS)
+		if errors.Is(err, acme.ErrAccountAlreadyExists) {
+			registered, err = client.GetReg(ctx, "")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to register ACME account: %w", err)
+		}
+		account.URI = registered.URI
+		if err := s.accountRepo.Update(account); err != nil {
+			return nil, err
+		}
+		s.logger.Info("registered ACME account", zap.String("directory", s.env.DirectoryURL), zap.String("uri", account.URI))
+	}
+
+	s.client = client
+	return client, nil
+}
+
+// httpClient trusts ACME_CA_CERT_FILE in addition to the system roots, which is what
+// a local Pebble directory needs
+func (s *acmeService) httpClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: s.env.InsecureSkipVerify}
+	if s.env.CACertFile != "" {
+		caPEM, err := os.ReadFile(s.env.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ACME CA certificate: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", s.env.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport, Timeout: 30 * time.Second}, nil
+}
+
+func (s *acmeService) renewBefore() time.Duration {
+	if s.env.RenewBeforeDays > 0 {
+		return time.Duration(s.env.RenewBeforeDays) * 24 * time.Hour
+	}
+	return acmeDefaultRenewBefore
+}
+
+func (s *acmeService) publishEvent(ctx context.Context, infraID, infraType string, cert *entities.NginxCertificate) {
+	event := kafka.InfrastructureEvent{
+		InstanceID: infraID,
+		Type:       infraType,
+		Action:     "certificate_issued",
+		Timestamp:  time.Now(),
+		Metadata: map[string]interface{}{
+			"domain":     cert.Domain,
+			"owner_type": cert.OwnerType,
+			"expires_at": cert.ExpiresAt,
+			"auto_renew": cert.AutoRenew,
+		},
+	}
+	s.kafkaProducer.PublishEvent(ctx, event)
+}
+
+func validateAcmeDomains(domains []string) error {
+	if len(domains) == 0 {
+		return fmt.Errorf("no domains to issue a certificate for")
+	}
+	for _, domain := range domains {
+		if !acmeDomainPattern.MatchString(domain) {
+			return fmt.Errorf("domain %q cannot be validated over HTTP-01", domain)
+		}
+	}
+	return nil
+}
+
+func parseAcmeAccountKey(keyPEM string) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("invalid ACME account key")
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// encodeIssuedCertificate PEM encodes the DER chain returned by the CA, leaf first
+func encodeIssuedCertificate(chain [][]byte, key *ecdsa.PrivateKey) (*issuedCertificate, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("ACME server returned an empty certificate chain")
+	}
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var certPEM strings.Builder
+	for _, der := range chain {
+		certPEM.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &issuedCertificate{
+		certificate: certPEM.String(),
+		privateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+		leaf:        leaf,
+	}, nil
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAcmeDomains(t *testing.T) {
+	assert.NoError(t, validateAcmeDomains([]string{"example.com", "www.example.com"}))
+	assert.Error(t, validateAcmeDomains(nil))
+	assert.Error(t, validateAcmeDomains([]string{"*.example.com"}))
+	assert.Error(t, validateAcmeDomains([]string{"localhost"}))
+	assert.Error(t, validateAcmeDomains([]string{"example.com; rm -rf /"}))
+}
+
+func TestEncodeIssuedCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	issued, err := encodeIssuedCertificate([][]byte{der, der}, key)
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", issued.leaf.Subject.CommonName)
+
+	block, rest := pem.Decode([]byte(issued.certificate))
+	assert.Equal(t, "CERTIFICATE", block.Type)
+	block, _ = pem.Decode(rest)
+	assert.Equal(t, "CERTIFICATE", block.Type)
+
+	parsed, err := parseAcmeAccountKey(issued.privateKey)
+	assert.NoError(t, err)
+	assert.True(t, key.Equal(parsed))
+
+	_, err = encodeIssuedCertificate(nil, key)
+	assert.Error(t, err)
+}
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/kafka"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/env"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"go.uber.org/zap"
+)
+
+const (
+	certificateExpiryAlertDays     = 30
+	certificateExpiryCheckInterval = 24 * time.Hour
+	certificateExpiringAction      = "certificate.expiring"
+)
+
+// Certificate inventory statuses
+const (
+	certStatusValid    = "valid"
+	certStatusExpiring = "expiring"
+	certStatusExpired  = "expired"
+	certStatusInvalid  = "invalid"
+)
+
+// Certificate inventory resource types
+const (
+	certResourceNginx       = "nginx"
+	certResourceCluster     = "nginx_cluster"
+	certResourceServerBlock = "nginx_server_block"
+)
+
+// ICertificateInventoryService reports on every certificate stored for Nginx resources
+type ICertificateInventoryService interface {
+	ListCertificates(ctx context.Context, userID string, expiringWithinDays int, expiringOnly bool) (*dto.CertificateInventoryResponse, error)
+	PublishExpiring(ctx context.Context) error
+	Start(ctx context.Context)
+}
+
+type certificateInventoryService struct {
+	nginxRepo     repositories.INginxRepository
+	clusterRepo   repositories.INginxClusterRepository
+	kafkaProducer kafka.IKafkaProducer
+	alertDays     int
+	logger        logger.ILogger
+}
+
+// inventoryEntry keeps the owning user next to the item so expiry events can be attributed
+type inventoryEntry struct {
+	item   dto.CertificateInventoryItem
+	userID string
+}
+
+func NewCertificateInventoryService(
+	certEnv env.CertEnv,
+	nginxRepo repositories.INginxRepository,
+	clusterRepo repositories.INginxClusterRepository,
+	kafkaProducer kafka.IKafkaProducer,
+	logger logger.ILogger,
+) ICertificateInventoryService {
+	alertDays := certEnv.ExpiryAlertDays
+	if alertDays <= 0 {
+		alertDays = certificateExpiryAlertDays
+	}
+	return &certificateInventoryService{
+		nginxRepo:     nginxRepo,
+		clusterRepo:   clusterRepo,
+		kafkaProducer: kafkaProducer,
+		alertDays:     alertDays,
+		logger:        logger,
+	}
+}
+
+// Start publishes expiry events once at startup and then daily until ctx is cancelled
+func (s *certificateInventoryService) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(certificateExpiryCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.PublishExpiring(ctx); err != nil {
+				s.logger.Error("failed to check certificate expiry", zap.Error(err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ListCertificates returns the certificates of the user's resources, counting those that
+// expire within the given number of days
+func (s *certificateInventoryService) ListCertificates(ctx context.Context, userID string, expiringWithinDays int, expiringOnly bool) (*dto.CertificateInventoryResponse, error) {
+	if expiringWithinDays <= 0 {
+		expiringWithinDays = s.alertDays
+	}
+	entries, err := s.collect(expiringWithinDays)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &dto.CertificateInventoryResponse{
+		ExpiringWithinDays: expiringWithinDays,
+		Certificates:       make([]dto.CertificateInventoryItem, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		if entry.userID != userID {
+			continue
+		}
+		resp.Total++
+		switch entry.item.Status {
+		case certStatusExpiring:
+			resp.Expiring++
+		case certStatusExpired:
+			resp.Expired++
+		case certStatusInvalid:
+			resp.Invalid++
+		}
+		if expiringOnly && entry.item.Status != certStatusExpiring && entry.item.Status != certStatusExpired {
+			continue
+		}
+		resp.Certificates = append(resp.Certificates, entry.item)
+	}
+	return resp, nil
+}
+
+// PublishExpiring emits a certificate.expiring event for every certificate that is
+// expired or inside the alert window
+func (s *certificateInventoryService) PublishExpiring(ctx context.Context) error {
+	entries, err := s.collect(s.alertDays)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		item := entry.item
+		if item.Status != certStatusExpiring && item.Status != certStatusExpired {
+			continue
+		}
+		event := kafka.InfrastructureEvent{
+			InstanceID: item.ResourceID,
+			UserID:     entry.userID,
+			Type:       item.ResourceType,
+			Action:     certificateExpiringAction,
+			Metadata: map[string]interface{}{
+				"owner_id":       item.OwnerID,
+				"domain":         item.Domain,
+				"common_name":    item.CommonName,
+				"sans":           item.SANs,
+				"issuer":         item.Issuer,
+				"not_after":      item.NotAfter,
+				"days_remaining": item.DaysRemaining,
+				"expired":        item.Status == certStatusExpired,
+				"auto_renew":     item.AutoRenew,
+			},
+		}
+		if err := s.kafkaProducer.PublishEvent(ctx, event); err != nil {
+			s.logger.Error("failed to publish certificate expiry event", zap.String("owner_id", item.OwnerID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// collect inspects instance and server block certificates plus cluster-wide certificates
+func (s *certificateInventoryService) collect(expiringWithinDays int) ([]inventoryEntry, error) {
+	now := time.Now()
+
+	certs, err := s.nginxRepo.ListCertificates()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]inventoryEntry, 0, len(certs))
+	for _, cert := range certs {
+		entry := inventoryEntry{item: inspectCertificate(cert.Certificate, cert.PrivateKey, now, expiringWithinDays)}
+		entry.item.OwnerID = cert.NginxID
+		entry.item.Domain = cert.Domain
+		entry.item.Source = cert.Source
+		entry.item.AutoRenew = cert.AutoRenew
+
+		if cert.OwnerType == entities.CertificateOwnerServerBlock {
+			entry.item.ResourceType = certResourceServerBlock
+			if block, err := s.clusterRepo.FindServerBlockByID(cert.NginxID); err == nil {
+				entry.item.ResourceName = block.ServerName
+				if cluster, err := s.clusterRepo.FindByID(block.ClusterID); err == nil {
+					entry.item.ResourceID = cluster.InfrastructureID
+					entry.userID = cluster.Infrastructure.UserID
+				}
+			}
+		} else {
+			entry.item.ResourceType = certResourceNginx
+			if instance, err := s.nginxRepo.FindByID(cert.NginxID); err == nil {
+				entry.item.ResourceID = instance.InfrastructureID
+				entry.item.ResourceName = instance.Infrastructure.Name
+				entry.userID = instance.Infrastructure.UserID
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	clusters, err := s.clusterRepo.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, cluster := range clusters {
+		if cluster.SSLCertificate == "" || cluster.Infrastructure.Status == entities.StatusDeleted {
+			continue
+		}
+		entry := inventoryEntry{
+			item:   inspectCertificate(cluster.SSLCertificate, cluster.SSLPrivateKey, now, expiringWithinDays),
+			userID: cluster.Infrastructure.UserID,
+		}
+		entry.item.ResourceType = certResourceCluster
+		entry.item.ResourceID = cluster.InfrastructureID
+		entry.item.ResourceName = cluster.ClusterName
+		entry.item.OwnerID = cluster.ID
+		entry.item.Source = entities.CertificateSourceManual
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// inspectCertificate parses a PEM bundle (leaf first) and checks its chain, key and expiry
+func inspectCertificate(certPEM, keyPEM string, now time.Time, expiringWithinDays int) dto.CertificateInventoryItem {
+	var item dto.CertificateInventoryItem
+
+	var chain []*x509.Certificate
+	rest := []byte(certPEM)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			item.Problems = append(item.Problems, fmt.Sprintf("failed to parse certificate %d: %v", len(chain)+1, err))
+			continue
+		}
+		chain = append(chain, cert)
+	}
+	item.ChainLength = len(chain)
+	if len(chain) == 0 {
+		item.Status = certStatusInvalid
+		item.Problems = append(item.Problems, "no certificate found in PEM")
+		return item
+	}
+
+	leaf := chain[0]
+	item.CommonName = leaf.Subject.CommonName
+	item.SANs = append(item.SANs, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		item.SANs = append(item.SANs, ip.String())
+	}
+	item.Issuer = leaf.Issuer.String()
+	item.SerialNumber = leaf.SerialNumber.Text(16)
+	item.KeyType = certificateKeyType(leaf.PublicKey)
+	item.NotBefore = leaf.NotBefore.Format(time.RFC3339)
+	item.NotAfter = leaf.NotAfter.Format(time.RFC3339)
+	item.DaysRemaining = int(math.Floor(leaf.NotAfter.Sub(now).Hours() / 24))
+
+	// The bundle is valid when each certificate is signed by the next and none has lapsed
+	item.ChainValid = len(item.Problems) == 0
+	for i := 0; i < len(chain)-1; i++ {
+		if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			item.ChainValid = false
+			item.Problems = append(item.Problems, fmt.Sprintf("certificate %d is not signed by certificate %d: %v", i+1, i+2, err))
+		}
+	}
+	for i, cert := range chain[1:] {
+		if now.After(cert.NotAfter) {
+			item.ChainValid = false
+			item.Problems = append(item.Problems, fmt.Sprintf("chain certificate %d (%s) expired", i+2, cert.Subject.CommonName))
+		}
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{Intermediates: intermediates, CurrentTime: now})
+	item.Trusted = err == nil
+
+	if keyPEM == "" {
+		item.Problems = append(item.Problems, "no private key stored")
+	} else if _, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM)); err != nil {
+		item.Problems = append(item.Problems, fmt.Sprintf("private key does not match certificate: %v", err))
+	} else {
+		item.KeyMatches = true
+	}
+
+	switch {
+	case !item.KeyMatches || !item.ChainValid || now.Before(leaf.NotBefore):
+		item.Status = certStatusInvalid
+	case now.After(leaf.NotAfter):
+		item.Status = certStatusExpired
+	case leaf.NotAfter.Before(now.AddDate(0, 0, expiringWithinDays)):
+		item.Status = certStatusExpiring
+	default:
+		item.Status = certStatusValid
+	}
+	if now.Before(leaf.NotBefore) {
+		item.Problems = append(item.Problems, "certificate is not valid yet")
+	}
+	return item
+}
+
+func certificateKeyType(publicKey interface{}) string {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return "unknown"
+	}
+}
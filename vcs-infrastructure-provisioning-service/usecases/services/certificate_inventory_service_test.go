@@ -0,0 +1,86 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testCertificatePEM(t *testing.T, template, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) (string, *x509.Certificate) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), cert
+}
+
+func testKeyPEM(t *testing.T, key *ecdsa.PrivateKey) string {
+	der, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+}
+
+func TestInspectCertificate(t *testing.T) {
+	now := time.Now()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leafKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caPEM, caCert := testCertificatePEM(t, caTemplate, caTemplate, caKey, caKey)
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com", "www.example.com"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(10*24*time.Hour + time.Hour),
+	}
+	leafPEM, _ := testCertificatePEM(t, leafTemplate, caCert, leafKey, caKey)
+
+	item := inspectCertificate(leafPEM+caPEM, testKeyPEM(t, leafKey), now, 30)
+	assert.Equal(t, certStatusExpiring, item.Status)
+	assert.Equal(t, "example.com", item.CommonName)
+	assert.Equal(t, []string{"example.com", "www.example.com"}, item.SANs)
+	assert.Equal(t, "ECDSA P-256", item.KeyType)
+	assert.Equal(t, 10, item.DaysRemaining)
+	assert.Equal(t, 2, item.ChainLength)
+	assert.True(t, item.ChainValid)
+	assert.True(t, item.KeyMatches)
+	assert.False(t, item.Trusted)
+	assert.Empty(t, item.Problems)
+
+	assert.Equal(t, certStatusValid, inspectCertificate(leafPEM+caPEM, testKeyPEM(t, leafKey), now, 7).Status)
+
+	item = inspectCertificate(leafPEM, testKeyPEM(t, caKey), now, 30)
+	assert.Equal(t, certStatusInvalid, item.Status)
+	assert.False(t, item.KeyMatches)
+
+	// A chain in the wrong order does not link up
+	item = inspectCertificate(leafPEM+leafPEM, testKeyPEM(t, leafKey), now, 30)
+	assert.False(t, item.ChainValid)
+	assert.Equal(t, certStatusInvalid, item.Status)
+
+	leafTemplate.NotAfter = now.Add(-time.Minute)
+	expiredPEM, _ := testCertificatePEM(t, leafTemplate, caCert, leafKey, caKey)
+	assert.Equal(t, certStatusExpired, inspectCertificate(expiredPEM, testKeyPEM(t, leafKey), now, 30).Status)
+
+	item = inspectCertificate("not a certificate", "", now, 30)
+	assert.Equal(t, certStatusInvalid, item.Status)
+	assert.Equal(t, 0, item.ChainLength)
+}
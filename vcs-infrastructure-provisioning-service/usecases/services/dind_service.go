@@ -42,6 +42,7 @@ type IDinDService interface {
 type dinDService struct {
 	dinDRepo      repositories.IDinDRepository
 	infraRepo     repositories.IInfrastructureRepository
+	registryRepo  repositories.IRegistryCredentialRepository
 	dockerSvc     docker.IDockerService
 	kafkaProducer kafka.IKafkaProducer
 	logger        logger.ILogger
@@ -50,6 +51,7 @@ type dinDService struct {
 func NewDinDService(
 	dinDRepo repositories.IDinDRepository,
 	infraRepo repositories.IInfrastructureRepository,
+	registryRepo repositories.IRegistryCredentialRepository,
 	dockerSvc docker.IDockerService,
 	kafkaProducer kafka.IKafkaProducer,
 	logger logger.ILogger,
@@ -57,6 +59,7 @@ func NewDinDService(
 	return &dinDService{
 		dinDRepo:      dinDRepo,
 		infraRepo:     infraRepo,
+		registryRepo:  registryRepo,
 		dockerSvc:     dockerSvc,
 		kafkaProducer: kafkaProducer,
 		logger:        logger,
@@ -77,6 +80,15 @@ func (s *dinDService) getResourceLimits(plan string) (string, string) {
 
 // CreateEnvironment creates a new Docker-in-Docker environment
 func (s *dinDService) CreateEnvironment(ctx context.Context, userID string, req dto.CreateDinDEnvironmentRequest) (*dto.DinDEnvironmentInfo, error) {
+	credentialID := ""
+	if req.RegistryCredentialID != "" {
+		credential, err := resolveRegistryCredential(s.registryRepo, userID, req.RegistryCredentialID)
+		if err != nil {
+			return nil, err
+		}
+		credentialID = credential.ID
+	}
+
 	infraID := uuid.New().String()
 	envID := uuid.New().String()
 
@@ -105,18 +117,19 @@ func (s *dinDService) CreateEnvironment(ctx context.Context, userID string, req
 
 	// Create DinD environment record
 	env := &entities.DinDEnvironment{
-		ID:               envID,
-		InfrastructureID: infraID,
-		Name:             req.Name,
-		Status:           "creating",
-		ResourcePlan:     req.ResourcePlan,
-		CPULimit:         cpuLimit,
-		MemoryLimit:      memoryLimit,
-		StorageDriver:    "overlay2",
-		Description:      req.Description,
-		AutoCleanup:      req.AutoCleanup,
-		TTLHours:         req.TTLHours,
-		UserID:           userID,
+		ID:                   envID,
+		InfrastructureID:     infraID,
+		Name:                 req.Name,
+		Status:               "creating",
+		ResourcePlan:         req.ResourcePlan,
+		CPULimit:             cpuLimit,
+		MemoryLimit:          memoryLimit,
+		StorageDriver:        "overlay2",
+		Description:          req.Description,
+		AutoCleanup:          req.AutoCleanup,
+		TTLHours:             req.TTLHours,
+		UserID:               userID,
+		RegistryCredentialID: credentialID,
 	}
 
 	if req.AutoCleanup && req.TTLHours > 0 {
@@ -202,6 +215,7 @@ func (s *dinDService) CreateEnvironment(ctx context.Context, userID string, req
 	if err := s.waitForDinDReady(ctx, containerID, 30*time.Second); err != nil {
 		s.logger.Warn("Docker daemon may not be fully ready", zap.Error(err))
 	}
+	s.loginEnvironment(ctx, env)
 
 	// Get container IP
 	if containerInfo, err := s.dockerSvc.InspectContainer(ctx, containerID); err == nil {
@@ -333,6 +347,12 @@ func (s *dinDService) StartEnvironment(ctx context.Context, id string) error {
 	if err := s.dockerSvc.StartContainer(ctx, env.ContainerID); err != nil {
 		return err
 	}
+	if env.RegistryCredentialID != "" {
+		if err := s.waitForDinDReady(ctx, env.ContainerID, 30*time.Second); err != nil {
+			s.logger.Warn("Docker daemon may not be fully ready", zap.Error(err))
+		}
+		s.loginEnvironment(ctx, env)
+	}
 
 	env.Status = "running"
 	s.dinDRepo.Update(env)
@@ -539,13 +559,31 @@ func (s *dinDService) PullImage(ctx context.Context, id string, req dto.PullImag
 		return nil, fmt.Errorf("environment is not running")
 	}
 
+	var auth *docker.RegistryAuth
+	if req.RegistryCredentialID != "" {
+		credential, err := resolveRegistryCredential(s.registryRepo, env.UserID, req.RegistryCredentialID)
+		if err != nil {
+			return nil, err
+		}
+		auth = &docker.RegistryAuth{ServerAddress: credential.ServerAddress, Username: credential.Username, Password: credential.Password}
+	} else if req.Username != "" {
+		auth = &docker.RegistryAuth{ServerAddress: imageRegistry(req.Image), Username: req.Username, Password: req.Password}
+	}
+	if auth != nil {
+		if err := s.registryLogin(ctx, env.ContainerID, auth); err != nil {
+			return nil, err
+		}
+	}
+
 	cmd := []string{"docker", "pull", req.Image}
-	_, err = s.dockerSvc.ExecCommand(ctx, env.ContainerID, cmd)
+	output, err := s.dockerSvc.ExecCommand(ctx, env.ContainerID, cmd)
 
-	success := err == nil
+	// ExecCommand does not report exit codes, so only the status line proves the pull worked
+	success := err == nil && dockerPullSucceeded(output)
 	status := "pulled"
 	if !success {
 		status = "failed"
+		s.logger.Warn("docker pull failed in dind environment", zap.String("env_id", env.ID), zap.String("image", req.Image), zap.String("output", strings.TrimSpace(output)), zap.Error(err))
 	}
 
 	// Get digest
@@ -719,24 +757,78 @@ func (s *dinDService) waitForDinDReady(ctx context.Context, containerID string,
 	return fmt.Errorf("timeout waiting for Docker daemon to be ready")
 }
 
+// loginEnvironment logs the Docker daemon of env in to its registry credential, if any. A failed
+// login is only logged: the environment still works with public images.
+func (s *dinDService) loginEnvironment(ctx context.Context, env *entities.DinDEnvironment) {
+	auth, err := registryAuth(s.registryRepo, env.RegistryCredentialID)
+	if err == nil && auth != nil {
+		err = s.registryLogin(ctx, env.ContainerID, auth)
+	}
+	if err != nil {
+		s.logger.Warn("failed to log DinD environment in to registry",
+			zap.String("id", env.ID),
+			zap.String("registry_credential_id", env.RegistryCredentialID),
+			zap.Error(err))
+	}
+}
+
+// registryLogin runs docker login inside a DinD container. The password is written to the
+// exec's stdin, so it is neither part of the command line nor of the process list.
+func (s *dinDService) registryLogin(ctx context.Context, containerID string, auth *docker.RegistryAuth) error {
+	cmd := []string{"docker", "login", "-u", auth.Username, "--password-stdin"}
+	if auth.ServerAddress != "" {
+		cmd = append(cmd, auth.ServerAddress)
+	}
+	output, err := s.dockerSvc.ExecCommandWithInput(ctx, containerID, cmd, []byte(auth.Password))
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(output, "Login Succeeded") {
+		return fmt.Errorf("docker login failed: %s", strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// dockerPullSucceeded reports whether docker pull output ends with the status line printed
+// once the image is available locally
+func dockerPullSucceeded(output string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Status: Downloaded newer image for ") || strings.HasPrefix(line, "Status: Image is up to date for ") {
+			return true
+		}
+	}
+	return false
+}
+
+// imageRegistry returns the registry host of an image reference, "" for Docker Hub
+func imageRegistry(image string) string {
+	host, _, found := strings.Cut(image, "/")
+	if !found || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		return ""
+	}
+	return host
+}
+
 // toDTO converts entity to DTO
 func (s *dinDService) toDTO(env *entities.DinDEnvironment) *dto.DinDEnvironmentInfo {
 	info := &dto.DinDEnvironmentInfo{
-		ID:               env.ID,
-		InfrastructureID: env.InfrastructureID,
-		Name:             env.Name,
-		ContainerID:      env.ContainerID,
-		Status:           env.Status,
-		DockerHost:       env.DockerHost,
-		IPAddress:        env.IPAddress,
-		ResourcePlan:     env.ResourcePlan,
-		CPULimit:         env.CPULimit,
-		MemoryLimit:      env.MemoryLimit,
-		Description:      env.Description,
-		AutoCleanup:      env.AutoCleanup,
-		TTLHours:         env.TTLHours,
-		CreatedAt:        env.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:        env.UpdatedAt.Format(time.RFC3339),
+		ID:                   env.ID,
+		InfrastructureID:     env.InfrastructureID,
+		Name:                 env.Name,
+		ContainerID:          env.ContainerID,
+		Status:               env.Status,
+		DockerHost:           env.DockerHost,
+		IPAddress:            env.IPAddress,
+		ResourcePlan:         env.ResourcePlan,
+		CPULimit:             env.CPULimit,
+		MemoryLimit:          env.MemoryLimit,
+		Description:          env.Description,
+		AutoCleanup:          env.AutoCleanup,
+		TTLHours:             env.TTLHours,
+		RegistryCredentialID: env.RegistryCredentialID,
+		CreatedAt:            env.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:            env.UpdatedAt.Format(time.RFC3339),
 	}
 
 	if !env.ExpiresAt.IsZero() {
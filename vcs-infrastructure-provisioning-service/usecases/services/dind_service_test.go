@@ -0,0 +1,20 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDockerPullSucceeded(t *testing.T) {
+	assert.True(t, dockerPullSucceeded("latest: Pulling from library/nginx\n"+
+		"Digest: sha256:abc\n"+
+		"Status: Downloaded newer image for nginx:latest\n"+
+		"docker.io/library/nginx:latest\n"))
+	assert.True(t, dockerPullSucceeded("Status: Image is up to date for nginx:latest\r\n"))
+
+	// docker pull exits non-zero on these, which ExecCommand does not report
+	assert.False(t, dockerPullSucceeded("Error response from daemon: manifest for nginx:nope not found: manifest unknown\n"))
+	assert.False(t, dockerPullSucceeded("latest: Pulling from library/nginx\nfailed to register layer: no space left on device\n"))
+	assert.False(t, dockerPullSucceeded(""))
+}
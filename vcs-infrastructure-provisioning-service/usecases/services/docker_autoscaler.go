@@ -0,0 +1,573 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/kafka"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	dockerAutoscaleInterval      = 30 * time.Second
+	dockerAutoscaleRequestWindow = time.Minute
+	dockerAutoscaleEventLimit    = 20
+	dockerServiceScaled          = "docker_service.scaled"
+	dockerServiceScaleFailed     = "docker_service.scale_failed"
+)
+
+// ErrDockerAutoscalingNotFound is returned when a Docker service has no autoscaling policy
+var ErrDockerAutoscalingNotFound = errors.New("autoscaling is not configured for this docker service")
+
+// DockerBackendSyncer re-points the nginx upstreams fronting a Docker service at its replicas
+type DockerBackendSyncer interface {
+	SyncDockerServiceBackends(ctx context.Context, service *entities.DockerService) (int, error)
+}
+
+type IDockerAutoscalerService interface {
+	SetAutoscaling(ctx context.Context, serviceID string, req dto.DockerAutoscalingRequest) (*dto.DockerAutoscalingInfo, error)
+	GetAutoscaling(ctx context.Context, serviceID string) (*dto.DockerAutoscalingInfo, error)
+	DeleteAutoscaling(ctx context.Context, serviceID string) error
+	RecordUpstreamRequests(counts map[string]int, at time.Time)
+	Start(ctx context.Context)
+}
+
+// dockerScaleStreak counts consecutive evaluations above the scale up and below the scale
+// down threshold of a policy
+type dockerScaleStreak struct {
+	up   int
+	down int
+}
+
+func (s *dockerScaleStreak) observe(policy *entities.DockerAutoscalePolicy, value float64) {
+	switch {
+	case value > policy.ScaleUpThreshold:
+		s.up, s.down = s.up+1, 0
+	case value < policy.ScaleDownThreshold:
+		s.up, s.down = 0, s.down+1
+	default:
+		s.up, s.down = 0, 0
+	}
+}
+
+// dockerScaleDecision is the replica count an evaluation settled on and why
+type dockerScaleDecision struct {
+	replicas  int
+	threshold float64
+	reason    string
+}
+
+// decideDockerScale returns the replicas a service should run. Replicas outside the policy
+// bounds are brought back at once. Otherwise a threshold must have been crossed on
+// policy.Evaluations checks in a row, outside the cooldown since the last scaling. Scaling up
+// sizes the service so the value would fall back to the threshold; scaling down removes one
+// replica at a time and only when the remaining ones would stay under the scale up threshold.
+func decideDockerScale(policy *entities.DockerAutoscalePolicy, current int, value float64, streak dockerScaleStreak, now time.Time) dockerScaleDecision {
+	hold := dockerScaleDecision{replicas: current}
+	switch {
+	case current < policy.MinReplicas:
+		return dockerScaleDecision{replicas: policy.MinReplicas, reason: fmt.Sprintf("below min_replicas %d", policy.MinReplicas)}
+	case current > policy.MaxReplicas:
+		return dockerScaleDecision{replicas: policy.MaxReplicas, reason: fmt.Sprintf("above max_replicas %d", policy.MaxReplicas)}
+	}
+	cooling := func(seconds int) bool {
+		return policy.LastScaledAt != nil && now.Sub(*policy.LastScaledAt) < time.Duration(seconds)*time.Second
+	}
+
+	if streak.up >= policy.Evaluations && current < policy.MaxReplicas {
+		if cooling(policy.ScaleUpCooldown) {
+			return hold
+		}
+		target := int(math.Ceil(float64(current) * value / policy.ScaleUpThreshold))
+		return dockerScaleDecision{
+			replicas:  min(max(target, current+1), policy.MaxReplicas),
+			threshold: policy.ScaleUpThreshold,
+			reason: fmt.Sprintf("%s %.2f above %.2f for %d checks",
+				policy.Metric, value, policy.ScaleUpThreshold, streak.up),
+		}
+	}
+
+	if streak.down >= policy.Evaluations && current > policy.MinReplicas {
+		if cooling(policy.ScaleDownCooldown) || value*float64(current)/float64(current-1) >= policy.ScaleUpThreshold {
+			return hold
+		}
+		return dockerScaleDecision{
+			replicas:  current - 1,
+			threshold: policy.ScaleDownThreshold,
+			reason: fmt.Sprintf("%s %.2f below %.2f for %d checks",
+				policy.Metric, value, policy.ScaleDownThreshold, streak.down),
+		}
+	}
+	return hold
+}
+
+// dockerStatsUsage reads one stats sample and returns the CPU use as a percent of cpuLimit
+// nano CPUs, or of one core without a limit, and the memory use as a percent of the limit
+func dockerStatsUsage(body io.Reader, cpuLimit int64) (float64, float64, error) {
+	var stats struct {
+		CPUStats struct {
+			CPUUsage struct {
+				TotalUsage uint64 `json:"total_usage"`
+			} `json:"cpu_usage"`
+			SystemCPUUsage uint64 `json:"system_cpu_usage"`
+			OnlineCPUs     uint64 `json:"online_cpus"`
+		} `json:"cpu_stats"`
+		PreCPUStats struct {
+			CPUUsage struct {
+				TotalUsage uint64 `json:"total_usage"`
+			} `json:"cpu_usage"`
+			SystemCPUUsage uint64 `json:"system_cpu_usage"`
+		} `json:"precpu_stats"`
+		MemoryStats struct {
+			Usage uint64 `json:"usage"`
+			Limit uint64 `json:"limit"`
+		} `json:"memory_stats"`
+	}
+	if err := json.NewDecoder(body).Decode(&stats); err != nil {
+		return 0, 0, err
+	}
+
+	cpuPercent := 0.0
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemCPUUsage) - float64(stats.PreCPUStats.SystemCPUUsage)
+	if cpuDelta > 0 && systemDelta > 0 {
+		cores := cpuDelta / systemDelta * float64(max(stats.CPUStats.OnlineCPUs, 1))
+		limit := 1.0
+		if cpuLimit > 0 {
+			limit = float64(cpuLimit) / 1e9
+		}
+		cpuPercent = cores / limit * 100
+	}
+
+	memoryPercent := 0.0
+	if stats.MemoryStats.Limit > 0 {
+		memoryPercent = float64(stats.MemoryStats.Usage) / float64(stats.MemoryStats.Limit) * 100
+	}
+	return cpuPercent, memoryPercent, nil
+}
+
+// upstreamRequestSample is the number of requests nginx proxied to each upstream host in one
+// batch of access logs
+type upstreamRequestSample struct {
+	at     time.Time
+	counts map[string]int
+}
+
+type dockerAutoscalerService struct {
+	autoscaleRepo  repositories.IDockerAutoscaleRepository
+	dockerRepo     repositories.IDockerServiceRepository
+	infraRepo      repositories.IInfrastructureRepository
+	dockerServices IDockerServiceService
+	dockerSvc      docker.IDockerService
+	syncers        []DockerBackendSyncer
+	kafkaProducer  kafka.IKafkaProducer
+	logger         logger.ILogger
+
+	mu            sync.Mutex
+	streaks       map[string]*dockerScaleStreak
+	requests      []upstreamRequestSample
+	requestsSince time.Time
+}
+
+func NewDockerAutoscalerService(
+	autoscaleRepo repositories.IDockerAutoscaleRepository,
+	dockerRepo repositories.IDockerServiceRepository,
+	infraRepo repositories.IInfrastructureRepository,
+	dockerServices IDockerServiceService,
+	dockerSvc docker.IDockerService,
+	syncers []DockerBackendSyncer,
+	kafkaProducer kafka.IKafkaProducer,
+	logger logger.ILogger,
+) IDockerAutoscalerService {
+	return &dockerAutoscalerService{
+		autoscaleRepo:  autoscaleRepo,
+		dockerRepo:     dockerRepo,
+		infraRepo:      infraRepo,
+		dockerServices: dockerServices,
+		dockerSvc:      dockerSvc,
+		syncers:        syncers,
+		kafkaProducer:  kafkaProducer,
+		logger:         logger,
+		streaks:        make(map[string]*dockerScaleStreak),
+	}
+}
+
+// SetAutoscaling creates or replaces the autoscaling policy of a service
+func (s *dockerAutoscalerService) SetAutoscaling(ctx context.Context, serviceID string, req dto.DockerAutoscalingRequest) (*dto.DockerAutoscalingInfo, error) {
+	service, err := findDockerService(s.dockerRepo, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if req.MaxReplicas > 1 && publishesHostPorts(service.Ports) {
+		return nil, fmt.Errorf("replicated services cannot publish host ports, reach them through the service alias")
+	}
+
+	policy, err := s.autoscaleRepo.FindPolicy(service.ID)
+	if err != nil {
+		policy = &entities.DockerAutoscalePolicy{ID: uuid.New().String(), ServiceID: service.ID}
+	}
+	policy.Enabled = req.Enabled == nil || *req.Enabled
+	policy.MinReplicas, policy.MaxReplicas = req.MinReplicas, req.MaxReplicas
+	policy.Metric = req.Metric
+	policy.ScaleUpThreshold, policy.ScaleDownThreshold = req.ScaleUpThreshold, req.ScaleDownThreshold
+	policy.Evaluations, policy.ScaleUpCooldown, policy.ScaleDownCooldown = 3, 60, 300
+	if req.Evaluations > 0 {
+		policy.Evaluations = req.Evaluations
+	}
+	if req.ScaleUpCooldown != nil {
+		policy.ScaleUpCooldown = *req.ScaleUpCooldown
+	}
+	if req.ScaleDownCooldown != nil {
+		policy.ScaleDownCooldown = *req.ScaleDownCooldown
+	}
+	if err := s.autoscaleRepo.SavePolicy(policy); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	delete(s.streaks, service.ID)
+	s.mu.Unlock()
+	return s.autoscalingInfo(service, policy)
+}
+
+func (s *dockerAutoscalerService) GetAutoscaling(ctx context.Context, serviceID string) (*dto.DockerAutoscalingInfo, error) {
+	service, err := findDockerService(s.dockerRepo, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := s.autoscaleRepo.FindPolicy(service.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDockerAutoscalingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.autoscalingInfo(service, policy)
+}
+
+// DeleteAutoscaling removes the policy of a service and leaves its replicas as they are
+func (s *dockerAutoscalerService) DeleteAutoscaling(ctx context.Context, serviceID string) error {
+	service, err := findDockerService(s.dockerRepo, serviceID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.autoscaleRepo.FindPolicy(service.ID); err != nil {
+		return ErrDockerAutoscalingNotFound
+	}
+
+	s.mu.Lock()
+	delete(s.streaks, service.ID)
+	s.mu.Unlock()
+	return s.autoscaleRepo.DeletePolicy(service.ID)
+}
+
+func (s *dockerAutoscalerService) autoscalingInfo(service *entities.DockerService, policy *entities.DockerAutoscalePolicy) (*dto.DockerAutoscalingInfo, error) {
+	events, err := s.autoscaleRepo.ListScalingEvents(service.ID, dockerAutoscaleEventLimit)
+	if err != nil {
+		return nil, err
+	}
+	info := &dto.DockerAutoscalingInfo{
+		ServiceID:          service.ID,
+		Enabled:            policy.Enabled,
+		MinReplicas:        policy.MinReplicas,
+		MaxReplicas:        policy.MaxReplicas,
+		Metric:             policy.Metric,
+		ScaleUpThreshold:   policy.ScaleUpThreshold,
+		ScaleDownThreshold: policy.ScaleDownThreshold,
+		Evaluations:        policy.Evaluations,
+		ScaleUpCooldown:    policy.ScaleUpCooldown,
+		ScaleDownCooldown:  policy.ScaleDownCooldown,
+		CurrentReplicas:    service.Replicas,
+		LastValue:          policy.LastValue,
+		Events:             make([]dto.DockerScalingEventInfo, 0, len(events)),
+	}
+	if policy.LastEvaluatedAt != nil {
+		info.LastEvaluatedAt = policy.LastEvaluatedAt.Format("2006-01-02T15:04:05Z")
+	}
+	if policy.LastScaledAt != nil {
+		info.LastScaledAt = policy.LastScaledAt.Format("2006-01-02T15:04:05Z")
+	}
+	for _, event := range events {
+		info.Events = append(info.Events, dto.DockerScalingEventInfo{
+			FromReplicas:     event.FromReplicas,
+			ToReplicas:       event.ToReplicas,
+			Metric:           event.Metric,
+			Value:            event.Value,
+			Threshold:        event.Threshold,
+			Reason:           event.Reason,
+			Status:           event.Status,
+			Error:            event.Error,
+			UpstreamsUpdated: event.UpstreamsUpdated,
+			CreatedAt:        event.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		})
+	}
+	return info, nil
+}
+
+// RecordUpstreamRequests keeps the request counts reported by the nginx access log
+// collectors for dockerAutoscaleRequestWindow
+func (s *dockerAutoscalerService) RecordUpstreamRequests(counts map[string]int, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.requestsSince.IsZero() {
+		s.requestsSince = at
+	}
+	kept := s.requests[:0]
+	for _, sample := range s.requests {
+		if at.Sub(sample.at) <= dockerAutoscaleRequestWindow {
+			kept = append(kept, sample)
+		}
+	}
+	s.requests = kept
+	if len(counts) > 0 {
+		s.requests = append(s.requests, upstreamRequestSample{at: at, counts: counts})
+	}
+}
+
+// requestRate returns the requests per second per replica proxied to the replicas over the
+// last dockerAutoscaleRequestWindow
+func (s *dockerAutoscalerService) requestRate(replicas []entities.DockerServiceReplica, now time.Time) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span := now.Sub(s.requestsSince)
+	if span > dockerAutoscaleRequestWindow {
+		span = dockerAutoscaleRequestWindow
+	}
+	if s.requestsSince.IsZero() || span < nginxAccessLogInterval {
+		return 0, fmt.Errorf("no nginx access logs collected yet")
+	}
+	total, counted := 0, 0
+	for _, replica := range replicas {
+		if replica.IPAddress == "" {
+			continue
+		}
+		counted++
+		for _, sample := range s.requests {
+			if now.Sub(sample.at) <= dockerAutoscaleRequestWindow {
+				total += sample.counts[replica.IPAddress]
+			}
+		}
+	}
+	if counted == 0 {
+		return 0, fmt.Errorf("no replica has an IP address")
+	}
+	return float64(total) / span.Seconds() / float64(counted), nil
+}
+
+// measure returns the value of metric averaged over the replicas of a service
+func (s *dockerAutoscalerService) measure(ctx context.Context, service *entities.DockerService, metric string) (float64, error) {
+	replicas := dockerServiceReplicas(service)
+	if metric == entities.DockerAutoscaleRequests {
+		return s.requestRate(replicas, time.Now())
+	}
+
+	total, sampled := 0.0, 0
+	for _, replica := range replicas {
+		if replica.ContainerID == "" {
+			continue
+		}
+		stats, err := s.dockerSvc.GetContainerStats(ctx, replica.ContainerID)
+		if err != nil {
+			continue
+		}
+		cpuPercent, memoryPercent, err := dockerStatsUsage(stats.Body, service.CPULimit)
+		stats.Body.Close()
+		if err != nil {
+			continue
+		}
+		if metric == entities.DockerAutoscaleMemory {
+			total += memoryPercent
+		} else {
+			total += cpuPercent
+		}
+		sampled++
+	}
+	if sampled == 0 {
+		return 0, fmt.Errorf("no replica reported stats")
+	}
+	return total / float64(sampled), nil
+}
+
+// Start evaluates every enabled policy on dockerAutoscaleInterval until ctx is cancelled
+func (s *dockerAutoscalerService) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(dockerAutoscaleInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.evaluate(ctx)
+			}
+		}
+	}()
+}
+
+func (s *dockerAutoscalerService) evaluate(ctx context.Context) {
+	policies, err := s.autoscaleRepo.ListEnabledPolicies()
+	if err != nil {
+		s.logger.Error("failed to list docker autoscale policies", zap.Error(err))
+		return
+	}
+	active := make(map[string]bool, len(policies))
+	for i := range policies {
+		active[policies[i].ServiceID] = true
+		s.evaluatePolicy(ctx, &policies[i])
+	}
+
+	s.mu.Lock()
+	for serviceID := range s.streaks {
+		if !active[serviceID] {
+			delete(s.streaks, serviceID)
+		}
+	}
+	s.mu.Unlock()
+}
+
+func (s *dockerAutoscalerService) evaluatePolicy(ctx context.Context, policy *entities.DockerAutoscalePolicy) {
+	service, err := s.dockerRepo.FindByID(policy.ServiceID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		s.autoscaleRepo.DeletePolicy(policy.ServiceID)
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed to load autoscaled docker service", zap.String("service_id", policy.ServiceID), zap.Error(err))
+		return
+	}
+	if service.Status != "running" || service.RolloutStatus == entities.DockerRolloutInProgress {
+		return
+	}
+
+	value, err := s.measure(ctx, service, policy.Metric)
+	if err != nil {
+		s.logger.Debug("skipping docker autoscale evaluation", zap.String("service_id", service.ID), zap.Error(err))
+		return
+	}
+	now := time.Now()
+	policy.LastValue, policy.LastEvaluatedAt = value, &now
+
+	s.mu.Lock()
+	streak, ok := s.streaks[service.ID]
+	if !ok {
+		streak = &dockerScaleStreak{}
+		s.streaks[service.ID] = streak
+	}
+	streak.observe(policy, value)
+	decision := decideDockerScale(policy, service.Replicas, value, *streak, now)
+	if decision.replicas != service.Replicas {
+		*streak = dockerScaleStreak{}
+	}
+	s.mu.Unlock()
+
+	if decision.replicas != service.Replicas {
+		s.scale(ctx, service, policy, decision, value, now)
+	} else if _, err := s.syncBackends(ctx, service); err != nil {
+		// Replica addresses also change on restarts and rollouts, so upstreams are kept in sync every tick
+		s.logger.Warn("failed to sync nginx upstreams with docker service replicas", zap.String("service_id", service.ID), zap.Error(err))
+	}
+
+	if err := s.autoscaleRepo.RecordEvaluation(policy); err != nil {
+		s.logger.Error("failed to record docker autoscale evaluation", zap.String("service_id", service.ID), zap.Error(err))
+	}
+}
+
+// scale applies a decision, re-points the fronting upstreams and records the outcome. Failed
+// attempts also start the cooldown so a broken service is not retried on every tick.
+func (s *dockerAutoscalerService) scale(ctx context.Context, service *entities.DockerService, policy *entities.DockerAutoscalePolicy, decision dockerScaleDecision, value float64, now time.Time) {
+	event := &entities.DockerScalingEvent{
+		ID:           uuid.New().String(),
+		ServiceID:    service.ID,
+		FromReplicas: service.Replicas,
+		ToReplicas:   decision.replicas,
+		Metric:       policy.Metric,
+		Value:        value,
+		Threshold:    decision.threshold,
+		Reason:       decision.reason,
+		Status:       entities.DockerScalingSucceeded,
+	}
+	policy.LastScaledAt = &now
+
+	if _, err := s.dockerServices.ScaleDockerService(ctx, service.ID, decision.replicas); err != nil {
+		event.Status, event.Error = entities.DockerScalingFailed, err.Error()
+	} else if scaled, err := s.dockerRepo.FindByID(service.ID); err == nil {
+		upstreams, err := s.syncBackends(ctx, scaled)
+		event.UpstreamsUpdated = upstreams
+		if err != nil {
+			event.Error = "updating nginx upstreams: " + err.Error()
+		}
+	}
+
+	s.logger.Info("docker service autoscaled",
+		zap.String("service_id", service.ID), zap.Int("from", event.FromReplicas), zap.Int("to", event.ToReplicas),
+		zap.String("reason", event.Reason), zap.String("status", event.Status), zap.String("error", event.Error))
+	if err := s.autoscaleRepo.CreateScalingEvent(event); err != nil {
+		s.logger.Error("failed to record docker scaling event", zap.String("service_id", service.ID), zap.Error(err))
+	}
+	s.publishScalingEvent(ctx, service, event)
+}
+
+func (s *dockerAutoscalerService) syncBackends(ctx context.Context, service *entities.DockerService) (int, error) {
+	updated := 0
+	var errs []error
+	for _, syncer := range s.syncers {
+		n, err := syncer.SyncDockerServiceBackends(ctx, service)
+		updated += n
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return updated, errors.Join(errs...)
+}
+
+func (s *dockerAutoscalerService) publishScalingEvent(ctx context.Context, service *entities.DockerService, event *entities.DockerScalingEvent) {
+	if s.kafkaProducer == nil {
+		return
+	}
+	infra, err := s.infraRepo.FindByID(service.InfrastructureID)
+	if err != nil {
+		return
+	}
+	action := dockerServiceScaled
+	if event.Status == entities.DockerScalingFailed {
+		action = dockerServiceScaleFailed
+	}
+	kafkaEvent := kafka.InfrastructureEvent{
+		InstanceID: infra.ID,
+		UserID:     infra.UserID,
+		Type:       string(infra.Type),
+		Action:     action,
+		Timestamp:  time.Now(),
+		Metadata: map[string]interface{}{
+			"service_id":        service.ID,
+			"service_name":      service.Name,
+			"from_replicas":     event.FromReplicas,
+			"to_replicas":       event.ToReplicas,
+			"metric":            event.Metric,
+			"value":             event.Value,
+			"threshold":         event.Threshold,
+			"reason":            event.Reason,
+			"upstreams_updated": event.UpstreamsUpdated,
+			"error":             event.Error,
+		},
+	}
+	if err := s.kafkaProducer.PublishEvent(ctx, kafkaEvent); err != nil {
+		s.logger.Error("failed to publish event to kafka", zap.String("infrastructure_id", infra.ID), zap.Error(err))
+	}
+}
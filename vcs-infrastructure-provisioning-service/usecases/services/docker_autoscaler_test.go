@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAutoscalePolicy() *entities.DockerAutoscalePolicy {
+	return &entities.DockerAutoscalePolicy{
+		MinReplicas:        1,
+		MaxReplicas:        6,
+		Metric:             entities.DockerAutoscaleCPU,
+		ScaleUpThreshold:   70,
+		ScaleDownThreshold: 30,
+		Evaluations:        3,
+		ScaleUpCooldown:    60,
+		ScaleDownCooldown:  300,
+	}
+}
+
+func TestDockerScaleStreak(t *testing.T) {
+	policy := testAutoscalePolicy()
+	streak := dockerScaleStreak{}
+	for _, value := range []float64{80, 90, 75} {
+		streak.observe(policy, value)
+	}
+	assert.Equal(t, dockerScaleStreak{up: 3}, streak)
+
+	// Values inside the hysteresis band reset both streaks
+	streak.observe(policy, 50)
+	assert.Equal(t, dockerScaleStreak{}, streak)
+
+	streak.observe(policy, 10)
+	streak.observe(policy, 20)
+	assert.Equal(t, dockerScaleStreak{down: 2}, streak)
+	streak.observe(policy, 95)
+	assert.Equal(t, dockerScaleStreak{up: 1}, streak)
+}
+
+func TestDecideDockerScale(t *testing.T) {
+	now := time.Now()
+	policy := testAutoscalePolicy()
+
+	// Not enough consecutive breaches yet
+	assert.Equal(t, 2, decideDockerScale(policy, 2, 90, dockerScaleStreak{up: 2}, now).replicas)
+
+	// Scaling up sizes the service back under the threshold, within max_replicas
+	decision := decideDockerScale(policy, 2, 140, dockerScaleStreak{up: 3}, now)
+	assert.Equal(t, 4, decision.replicas)
+	assert.Equal(t, 70.0, decision.threshold)
+	assert.True(t, strings.HasPrefix(decision.reason, "cpu 140.00 above 70.00"))
+	assert.Equal(t, 3, decideDockerScale(policy, 2, 71, dockerScaleStreak{up: 3}, now).replicas)
+	assert.Equal(t, 6, decideDockerScale(policy, 5, 500, dockerScaleStreak{up: 3}, now).replicas)
+	assert.Equal(t, 6, decideDockerScale(policy, 6, 500, dockerScaleStreak{up: 3}, now).replicas)
+
+	// Scaling down removes one replica at a time
+	decision = decideDockerScale(policy, 4, 10, dockerScaleStreak{down: 3}, now)
+	assert.Equal(t, 3, decision.replicas)
+	assert.Equal(t, 30.0, decision.threshold)
+	assert.Equal(t, 1, decideDockerScale(policy, 1, 0, dockerScaleStreak{down: 3}, now).replicas)
+
+	// ... unless the remaining replicas would cross the scale up threshold
+	policy.ScaleDownThreshold = 40
+	assert.Equal(t, 2, decideDockerScale(policy, 2, 39, dockerScaleStreak{down: 3}, now).replicas)
+	policy.ScaleDownThreshold = 30
+
+	// Cooldowns are separate for both directions
+	scaledAt := now.Add(-2 * time.Minute)
+	policy.LastScaledAt = &scaledAt
+	assert.Equal(t, 3, decideDockerScale(policy, 2, 90, dockerScaleStreak{up: 3}, now).replicas)
+	assert.Equal(t, 4, decideDockerScale(policy, 4, 10, dockerScaleStreak{down: 3}, now).replicas)
+
+	// Replicas outside the bounds are brought back regardless of streaks and cooldowns
+	policy.MinReplicas = 3
+	assert.Equal(t, 3, decideDockerScale(policy, 1, 50, dockerScaleStreak{}, now).replicas)
+	assert.Equal(t, 6, decideDockerScale(policy, 9, 50, dockerScaleStreak{}, now).replicas)
+}
+
+func TestDockerStatsUsage(t *testing.T) {
+	stats := `{
+		"cpu_stats": {"cpu_usage": {"total_usage": 3000}, "system_cpu_usage": 20000, "online_cpus": 4},
+		"precpu_stats": {"cpu_usage": {"total_usage": 1000}, "system_cpu_usage": 10000},
+		"memory_stats": {"usage": 256, "limit": 1024}
+	}`
+
+	// 2000/10000 of 4 CPUs is 0.8 cores
+	cpu, memory, err := dockerStatsUsage(strings.NewReader(stats), 0)
+	assert.NoError(t, err)
+	assert.InDelta(t, 80, cpu, 0.001)
+	assert.InDelta(t, 25, memory, 0.001)
+
+	cpu, _, err = dockerStatsUsage(strings.NewReader(stats), 2000000000)
+	assert.NoError(t, err)
+	assert.InDelta(t, 40, cpu, 0.001)
+
+	// The first sample of a container has no previous reading
+	cpu, memory, err = dockerStatsUsage(strings.NewReader(`{"cpu_stats": {"cpu_usage": {"total_usage": 5}}}`), 0)
+	assert.NoError(t, err)
+	assert.Zero(t, cpu)
+	assert.Zero(t, memory)
+
+	_, _, err = dockerStatsUsage(strings.NewReader("not json"), 0)
+	assert.Error(t, err)
+}
+
+func TestDockerAutoscalerRequestRate(t *testing.T) {
+	s := &dockerAutoscalerService{streaks: make(map[string]*dockerScaleStreak)}
+	replicas := []entities.DockerServiceReplica{{IPAddress: "172.18.0.5"}, {IPAddress: "172.18.0.6"}}
+	start := time.Now()
+
+	_, err := s.requestRate(replicas, start)
+	assert.Error(t, err)
+
+	s.RecordUpstreamRequests(map[string]int{"172.18.0.5": 300, "172.18.0.9": 50}, start)
+	s.RecordUpstreamRequests(map[string]int{"172.18.0.6": 300}, start.Add(30*time.Second))
+	rate, err := s.requestRate(replicas, start.Add(30*time.Second))
+	assert.NoError(t, err)
+	assert.InDelta(t, 10, rate, 0.001)
+
+	// Samples older than the window are dropped
+	s.RecordUpstreamRequests(map[string]int{}, start.Add(80*time.Second))
+	rate, err = s.requestRate(replicas, start.Add(80*time.Second))
+	assert.NoError(t, err)
+	assert.InDelta(t, 2.5, rate, 0.001)
+	assert.Len(t, s.requests, 1)
+
+	_, err = s.requestRate([]entities.DockerServiceReplica{{ContainerID: "c1"}}, start.Add(80*time.Second))
+	assert.Error(t, err)
+}
+
+// evaluationRepo records the evaluations written by the autoscaler; other calls, SavePolicy
+// included, panic
+type evaluationRepo struct {
+	repositories.IDockerAutoscaleRepository
+	recorded []entities.DockerAutoscalePolicy
+}
+
+func (r *evaluationRepo) RecordEvaluation(policy *entities.DockerAutoscalePolicy) error {
+	r.recorded = append(r.recorded, *policy)
+	return nil
+}
+
+func TestEvaluatePolicyRecordsOnlyTheEvaluation(t *testing.T) {
+	service := &entities.DockerService{ID: "svc-1", Status: "running", Replicas: 1, Containers: []entities.DockerServiceReplica{{IPAddress: "172.18.0.5"}}}
+	repo := &evaluationRepo{}
+	s := &dockerAutoscalerService{dockerRepo: serviceRepo{service: service}, autoscaleRepo: repo, streaks: make(map[string]*dockerScaleStreak), logger: discardLogger{}}
+	s.RecordUpstreamRequests(map[string]int{"172.18.0.5": 600}, time.Now().Add(-30*time.Second))
+
+	policy := testAutoscalePolicy()
+	policy.ID, policy.ServiceID, policy.Metric = "policy-1", "svc-1", entities.DockerAutoscaleRequests
+	s.evaluatePolicy(context.Background(), policy)
+
+	// A SetAutoscaling racing with the tick keeps its settings, the tick only adds its outcome
+	require.Len(t, repo.recorded, 1)
+	assert.Greater(t, repo.recorded[0].LastValue, 0.0)
+	assert.NotNil(t, repo.recorded[0].LastEvaluatedAt)
+	assert.Nil(t, repo.recorded[0].LastScaledAt)
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
@@ -18,27 +19,33 @@ type IDockerEventListenerService interface {
 	Start(ctx context.Context) error
 	Stop()
 	SetWebSocketHandler(handler WebSocketBroadcaster)
+	SetStackHealthService(stackHealth IStackHealthService)
 }
 
 type WebSocketBroadcaster interface {
 	BroadcastUpdate(update dto.InfrastructureStatusUpdate)
+	BroadcastDockerServiceHealth(update dto.DockerServiceHealthUpdate)
 }
 
 type dockerEventListenerService struct {
 	dockerService docker.IDockerService
 	kafkaProducer kafka.IKafkaProducer
 	infraRepo     repositories.IInfrastructureRepository
+	dockerRepo    repositories.IDockerServiceRepository
 	logger        logger.ILogger
 	eventChan     chan events.Message
 	ctx           context.Context
 	cancel        context.CancelFunc
 	wsBroadcaster WebSocketBroadcaster
+	stackHealth   IStackHealthService
+	probes        map[string]*dockerProbeState // container ID -> HTTP and TCP check results, probe loop only
 }
 
 func NewDockerEventListenerService(
 	dockerService docker.IDockerService,
 	kafkaProducer kafka.IKafkaProducer,
 	infraRepo repositories.IInfrastructureRepository,
+	dockerRepo repositories.IDockerServiceRepository,
 	logger logger.ILogger,
 ) IDockerEventListenerService {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -46,8 +53,10 @@ func NewDockerEventListenerService(
 		dockerService: dockerService,
 		kafkaProducer: kafkaProducer,
 		infraRepo:     infraRepo,
+		dockerRepo:    dockerRepo,
 		logger:        logger,
 		eventChan:     make(chan events.Message, 100),
+		probes:        make(map[string]*dockerProbeState),
 		ctx:           ctx,
 		cancel:        cancel,
 	}
@@ -57,6 +66,10 @@ func (s *dockerEventListenerService) SetWebSocketHandler(handler WebSocketBroadc
 	s.wsBroadcaster = handler
 }
 
+func (s *dockerEventListenerService) SetStackHealthService(stackHealth IStackHealthService) {
+	s.stackHealth = stackHealth
+}
+
 func (s *dockerEventListenerService) Start(ctx context.Context) error {
 	// Start listening to Docker events
 	if err := s.dockerService.ListenToEvents(ctx, s.eventChan); err != nil {
@@ -67,6 +80,7 @@ func (s *dockerEventListenerService) Start(ctx context.Context) error {
 	s.logger.Info("docker event listener started")
 
 	go s.processEvents(ctx)
+	go s.probeHealthChecks(ctx)
 
 	return nil
 }
@@ -101,6 +115,11 @@ func (s *dockerEventListenerService) handleEvent(ctx context.Context, event even
 		zap.String("container_id", containerID),
 		zap.String("container_name", containerName))
 
+	if strings.HasPrefix(action, string(events.ActionHealthStatus)) {
+		s.handleHealthEvent(ctx, event)
+		return
+	}
+
 	var status entities.InfrastructureStatus
 	switch event.Action {
 	case events.ActionStart:
@@ -162,6 +181,10 @@ func (s *dockerEventListenerService) handleEvent(ctx context.Context, event even
 			zap.Error(err))
 	}
 
+	if s.stackHealth != nil {
+		s.stackHealth.ScheduleRefreshForInfrastructure(infra.ID)
+	}
+
 	// Broadcast via WebSocket if handler is set
 	if s.wsBroadcaster != nil {
 		update := dto.InfrastructureStatusUpdate{
@@ -174,3 +197,98 @@ func (s *dockerEventListenerService) handleEvent(ctx context.Context, event even
 		s.wsBroadcaster.BroadcastUpdate(update)
 	}
 }
+
+// handleHealthEvent records a health_status event of a Docker service container
+func (s *dockerEventListenerService) handleHealthEvent(ctx context.Context, event events.Message) {
+	service, err := s.dockerRepo.FindByContainerID(event.ID)
+	if err != nil {
+		// Health checks of other resources are read from the container state when needed
+		return
+	}
+	s.recordReplicaHealth(ctx, service, event.ID, event.Actor.Attributes["name"], dockerReplicaHealth(string(event.Action)))
+}
+
+// recordReplicaHealth records the health of a container on its replica and the health check
+// of service, and reports services turning healthy or unhealthy
+func (s *dockerEventListenerService) recordReplicaHealth(ctx context.Context, service *entities.DockerService, containerID, containerName, health string) {
+	replicas := dockerServiceReplicas(service)
+	replica := entities.DockerServiceReplica{ContainerID: containerID, ContainerName: containerName}
+	for i := range replicas {
+		if replicas[i].ContainerID != containerID {
+			continue
+		}
+		replicas[i].Health = health
+		replica = replicas[i]
+		if replica.ID != "" {
+			if err := s.dockerRepo.UpdateReplica(&replica); err != nil {
+				s.logger.Error("failed to update replica health", zap.String("replica_id", replica.ID), zap.Error(err))
+			}
+		}
+	}
+
+	serviceHealth := aggregateDockerHealth(replicas)
+	previous := entities.DockerHealthUnknown
+	if service.HealthCheck != nil {
+		previous = service.HealthCheck.Status
+		service.HealthCheck.Status = serviceHealth
+		service.HealthCheck.LastCheck = time.Now()
+		if err := s.dockerRepo.UpdateHealthCheck(service.HealthCheck); err != nil {
+			s.logger.Error("failed to update docker service health", zap.String("service_id", service.ID), zap.Error(err))
+		}
+	}
+
+	s.logger.Info("docker service health changed",
+		zap.String("service_id", service.ID),
+		zap.String("container_id", containerID),
+		zap.String("replica_health", health),
+		zap.String("service_health", serviceHealth))
+
+	infra, err := s.infraRepo.FindByID(service.InfrastructureID)
+	if err != nil {
+		return
+	}
+
+	if serviceHealth != previous && (serviceHealth == entities.DockerHealthHealthy || serviceHealth == entities.DockerHealthUnhealthy) {
+		action := dockerServiceHealthy
+		if serviceHealth == entities.DockerHealthUnhealthy {
+			action = dockerServiceUnhealthy
+		}
+		kafkaEvent := kafka.InfrastructureEvent{
+			InstanceID: infra.ID,
+			UserID:     infra.UserID,
+			Type:       string(infra.Type),
+			Action:     action,
+			Timestamp:  time.Now(),
+			Metadata: map[string]interface{}{
+				"service_id":     service.ID,
+				"service_name":   service.Name,
+				"container_id":   containerID,
+				"replica_health": health,
+				"health":         serviceHealth,
+			},
+		}
+		if err := s.kafkaProducer.PublishEvent(ctx, kafkaEvent); err != nil {
+			s.logger.Error("failed to publish event to kafka",
+				zap.String("infrastructure_id", infra.ID),
+				zap.Error(err))
+		}
+	}
+
+	if s.stackHealth != nil {
+		s.stackHealth.ScheduleRefreshForInfrastructure(infra.ID)
+	}
+
+	if s.wsBroadcaster != nil {
+		s.wsBroadcaster.BroadcastDockerServiceHealth(dto.DockerServiceHealthUpdate{
+			Type:             dockerServiceHealthUpdate,
+			ServiceID:        service.ID,
+			InfrastructureID: infra.ID,
+			ServiceName:      service.Name,
+			ContainerID:      containerID,
+			ContainerName:    replica.ContainerName,
+			ReplicaHealth:    health,
+			ServiceHealth:    serviceHealth,
+			Timestamp:        time.Now().Format(time.RFC3339),
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+)
+
+const (
+	dockerServiceHealthUpdate = "docker_service_health"
+	dockerServiceHealthy      = "docker_service.healthy"
+	dockerServiceUnhealthy    = "docker_service.unhealthy"
+)
+
+// dockerHealthCheckConfig translates a stored command health check into the container
+// HEALTHCHECK; Retries is the unhealthy threshold since Docker turns healthy on one success.
+// HTTP and TCP checks get none: distroless, scratch and slim images ship no curl, wget, nc or
+// bash to run them, so they are probed from outside by probeDockerReplica instead.
+func dockerHealthCheckConfig(hc *entities.DockerHealthCheck) *docker.HealthCheckConfig {
+	if hc == nil || hc.Type != entities.DockerHealthCheckCommand || strings.TrimSpace(hc.Command) == "" {
+		return nil
+	}
+
+	interval, timeout, retries := hc.Interval, hc.Timeout, hc.UnhealthyThreshold
+	if interval <= 0 {
+		interval = 30
+	}
+	if timeout <= 0 {
+		timeout = 10
+	}
+	if retries <= 0 {
+		retries = 3
+	}
+	return &docker.HealthCheckConfig{
+		Test:     []string{"CMD-SHELL", hc.Command},
+		Interval: time.Duration(interval) * time.Second,
+		Timeout:  time.Duration(timeout) * time.Second,
+		Retries:  retries,
+	}
+}
+
+// shellQuote wraps s in single quotes for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// dockerReplicaHealth maps a health_status event action to a replica health
+func dockerReplicaHealth(action string) string {
+	status := strings.TrimSpace(strings.TrimPrefix(action, "health_status:"))
+	switch status {
+	case entities.DockerHealthHealthy, entities.DockerHealthUnhealthy:
+		return status
+	}
+	return entities.DockerHealthStarting
+}
+
+// aggregateDockerHealth rolls replica health up to the service: one unhealthy replica makes the
+// service unhealthy, and it is healthy only once every replica is
+func aggregateDockerHealth(replicas []entities.DockerServiceReplica) string {
+	if len(replicas) == 0 {
+		return entities.DockerHealthUnknown
+	}
+	health := entities.DockerHealthHealthy
+	for _, replica := range replicas {
+		switch replica.Health {
+		case entities.DockerHealthUnhealthy:
+			return entities.DockerHealthUnhealthy
+		case entities.DockerHealthHealthy:
+		default:
+			health = entities.DockerHealthStarting
+		}
+	}
+	return health
+}
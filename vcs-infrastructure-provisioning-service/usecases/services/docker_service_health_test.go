@@ -0,0 +1,50 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDockerHealthCheckConfig(t *testing.T) {
+	config := dockerHealthCheckConfig(&entities.DockerHealthCheck{Type: entities.DockerHealthCheckCommand, Command: "pg_isready", Interval: 15, Timeout: 5, UnhealthyThreshold: 2})
+	assert.Equal(t, []string{"CMD-SHELL", "pg_isready"}, config.Test)
+	assert.Equal(t, 15*time.Second, config.Interval)
+	assert.Equal(t, 5*time.Second, config.Timeout)
+	assert.Equal(t, 2, config.Retries)
+
+	config = dockerHealthCheckConfig(&entities.DockerHealthCheck{Type: entities.DockerHealthCheckCommand, Command: "pg_isready"})
+	assert.Equal(t, 30*time.Second, config.Interval)
+	assert.Equal(t, 3, config.Retries)
+
+	// HTTP and TCP checks are probed from outside, the image may have no tool to run them
+	assert.Nil(t, dockerHealthCheckConfig(&entities.DockerHealthCheck{Type: entities.DockerHealthCheckHTTP, HTTPPath: "/healthz"}))
+	assert.Nil(t, dockerHealthCheckConfig(&entities.DockerHealthCheck{Type: entities.DockerHealthCheckTCP, Port: 5432}))
+
+	assert.Nil(t, dockerHealthCheckConfig(nil))
+	assert.Nil(t, dockerHealthCheckConfig(&entities.DockerHealthCheck{Type: entities.DockerHealthCheckCommand}))
+	assert.Nil(t, dockerHealthCheckConfig(&entities.DockerHealthCheck{Type: "grpc"}))
+}
+
+func TestDockerReplicaHealth(t *testing.T) {
+	assert.Equal(t, entities.DockerHealthHealthy, dockerReplicaHealth("health_status: healthy"))
+	assert.Equal(t, entities.DockerHealthUnhealthy, dockerReplicaHealth("health_status: unhealthy"))
+	assert.Equal(t, entities.DockerHealthStarting, dockerReplicaHealth("health_status: running"))
+}
+
+func TestAggregateDockerHealth(t *testing.T) {
+	replicas := func(health ...string) []entities.DockerServiceReplica {
+		list := []entities.DockerServiceReplica{}
+		for _, h := range health {
+			list = append(list, entities.DockerServiceReplica{Health: h})
+		}
+		return list
+	}
+
+	assert.Equal(t, entities.DockerHealthUnknown, aggregateDockerHealth(nil))
+	assert.Equal(t, entities.DockerHealthHealthy, aggregateDockerHealth(replicas("healthy", "healthy")))
+	assert.Equal(t, entities.DockerHealthStarting, aggregateDockerHealth(replicas("healthy", "")))
+	assert.Equal(t, entities.DockerHealthUnhealthy, aggregateDockerHealth(replicas("healthy", "unhealthy", "")))
+}
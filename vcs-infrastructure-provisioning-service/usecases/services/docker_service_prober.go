@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"go.uber.org/zap"
+)
+
+// dockerProbeTick is how often the prober looks for HTTP and TCP checks that are due
+const dockerProbeTick = 5 * time.Second
+
+// dockerProbeState holds the consecutive results of the HTTP or TCP check of one replica
+type dockerProbeState struct {
+	lastProbe time.Time
+	successes int
+	failures  int
+}
+
+// next counts one probe result and returns the health it leads to: healthy after
+// HealthyThreshold successes in a row, unhealthy after UnhealthyThreshold failures, current
+// until either is reached
+func (p *dockerProbeState) next(hc *entities.DockerHealthCheck, current string, err error) string {
+	healthy, unhealthy := hc.HealthyThreshold, hc.UnhealthyThreshold
+	if healthy <= 0 {
+		healthy = 3
+	}
+	if unhealthy <= 0 {
+		unhealthy = 3
+	}
+
+	if err == nil {
+		p.successes, p.failures = p.successes+1, 0
+		if p.successes >= healthy {
+			return entities.DockerHealthHealthy
+		}
+	} else {
+		p.successes, p.failures = 0, p.failures+1
+		if p.failures >= unhealthy {
+			return entities.DockerHealthUnhealthy
+		}
+	}
+	if current == "" {
+		return entities.DockerHealthStarting
+	}
+	return current
+}
+
+// probeHealthChecks runs the HTTP and TCP checks of running Docker services from outside the
+// containers, which carry no HEALTHCHECK for them, and records the results as health events do
+func (s *dockerEventListenerService) probeHealthChecks(ctx context.Context) {
+	ticker := time.NewTicker(dockerProbeTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.probeDue(ctx, time.Now())
+		}
+	}
+}
+
+// probeDue probes every running replica whose check interval has passed since its last probe
+func (s *dockerEventListenerService) probeDue(ctx context.Context, now time.Time) {
+	services, err := s.dockerRepo.ListRunningByHealthCheckType(entities.DockerHealthCheckHTTP, entities.DockerHealthCheckTCP)
+	if err != nil {
+		s.logger.Error("failed to list docker services to probe", zap.Error(err))
+		return
+	}
+
+	seen := make(map[string]bool)
+	for i := range services {
+		service := &services[i]
+		hc := service.HealthCheck
+		if hc == nil {
+			continue
+		}
+		interval := time.Duration(hc.Interval) * time.Second
+		if interval <= 0 {
+			interval = 30 * time.Second
+		}
+
+		for _, replica := range dockerServiceReplicas(service) {
+			if replica.Status != "running" || replica.ContainerID == "" {
+				continue
+			}
+			seen[replica.ContainerID] = true
+			probe := s.probes[replica.ContainerID]
+			if probe == nil {
+				probe = &dockerProbeState{}
+				s.probes[replica.ContainerID] = probe
+			}
+			if now.Sub(probe.lastProbe) < interval {
+				continue
+			}
+			probe.lastProbe = now
+
+			err := probeDockerReplica(ctx, s.dockerService, service, replica.ContainerID, replica.IPAddress)
+			if health := probe.next(hc, replica.Health, err); health != replica.Health {
+				if err != nil {
+					s.logger.Debug("docker service health check failed",
+						zap.String("service_id", service.ID), zap.String("container_id", replica.ContainerID), zap.Error(err))
+				}
+				s.recordReplicaHealth(ctx, service, replica.ContainerID, replica.ContainerName, health)
+			}
+		}
+	}
+
+	// Forget replicas that were retired or stopped
+	for containerID := range s.probes {
+		if !seen[containerID] {
+			delete(s.probes, containerID)
+		}
+	}
+}
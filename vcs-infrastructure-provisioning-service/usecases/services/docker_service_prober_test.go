@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerProbeStateThresholds(t *testing.T) {
+	hc := &entities.DockerHealthCheck{HealthyThreshold: 2, UnhealthyThreshold: 3}
+	probe := &dockerProbeState{}
+	failed := errors.New("connection refused")
+
+	assert.Equal(t, entities.DockerHealthStarting, probe.next(hc, "", nil))
+	assert.Equal(t, entities.DockerHealthHealthy, probe.next(hc, entities.DockerHealthStarting, nil))
+
+	// A single failure does not flip a healthy replica
+	assert.Equal(t, entities.DockerHealthHealthy, probe.next(hc, entities.DockerHealthHealthy, failed))
+	assert.Equal(t, entities.DockerHealthHealthy, probe.next(hc, entities.DockerHealthHealthy, failed))
+	assert.Equal(t, entities.DockerHealthUnhealthy, probe.next(hc, entities.DockerHealthHealthy, failed))
+
+	// Successes start counting again after a failure
+	assert.Equal(t, entities.DockerHealthUnhealthy, probe.next(hc, entities.DockerHealthUnhealthy, nil))
+	assert.Equal(t, entities.DockerHealthHealthy, probe.next(hc, entities.DockerHealthUnhealthy, nil))
+}
+
+// probedServiceRepo lists one service to probe and records health updates; other calls panic
+type probedServiceRepo struct {
+	repositories.IDockerServiceRepository
+	service *entities.DockerService
+}
+
+func (r *probedServiceRepo) ListRunningByHealthCheckType(types ...string) ([]entities.DockerService, error) {
+	return []entities.DockerService{*r.service}, nil
+}
+
+func (r *probedServiceRepo) UpdateReplica(replica *entities.DockerServiceReplica) error {
+	for i := range r.service.Containers {
+		if r.service.Containers[i].ID == replica.ID {
+			r.service.Containers[i] = *replica
+		}
+	}
+	return nil
+}
+
+func (r *probedServiceRepo) UpdateHealthCheck(hc *entities.DockerHealthCheck) error {
+	copied := *hc
+	r.service.HealthCheck = &copied
+	return nil
+}
+
+func TestProbeDueRecordsHTTPHealth(t *testing.T) {
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() || r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	portNumber, _ := strconv.Atoi(port)
+
+	repo := &probedServiceRepo{service: &entities.DockerService{
+		ID: "svc-1", InfrastructureID: "infra-1", Status: "running",
+		HealthCheck: &entities.DockerHealthCheck{
+			Type: entities.DockerHealthCheckHTTP, HTTPPath: "healthz", Port: portNumber, Interval: 10,
+			HealthyThreshold: 1, UnhealthyThreshold: 2, Status: entities.DockerHealthUnknown,
+		},
+		Containers: []entities.DockerServiceReplica{{ID: "r-1", ContainerID: "c1", IPAddress: host, Status: "running"}},
+	}}
+	// The infrastructure is unknown, so nothing is published
+	listener := &dockerEventListenerService{
+		dockerRepo: repo, infraRepo: &memoryInfraRepo{}, logger: discardLogger{},
+		ctx: context.Background(), probes: map[string]*dockerProbeState{},
+	}
+	now := time.Now()
+
+	listener.probeDue(context.Background(), now)
+	assert.Equal(t, entities.DockerHealthHealthy, repo.service.Containers[0].Health)
+	assert.Equal(t, entities.DockerHealthHealthy, repo.service.HealthCheck.Status)
+
+	// Not probed again before the interval has passed
+	failing.Store(true)
+	listener.probeDue(context.Background(), now.Add(5*time.Second))
+	assert.Equal(t, 0, listener.probes["c1"].failures)
+
+	listener.probeDue(context.Background(), now.Add(10*time.Second))
+	assert.Equal(t, entities.DockerHealthHealthy, repo.service.HealthCheck.Status)
+	listener.probeDue(context.Background(), now.Add(20*time.Second))
+	assert.Equal(t, entities.DockerHealthUnhealthy, repo.service.Containers[0].Health)
+	assert.Equal(t, entities.DockerHealthUnhealthy, repo.service.HealthCheck.Status)
+
+	// Retired replicas are forgotten
+	repo.service.Containers = nil
+	listener.probeDue(context.Background(), now.Add(30*time.Second))
+	assert.Empty(t, listener.probes)
+}
@@ -0,0 +1,665 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/google/uuid"
+)
+
+const (
+	dockerMaxReplicas          = 20
+	dockerRolloutHealthTimeout = 2 * time.Minute
+	dockerRolloutProbeInterval = 2 * time.Second
+	dockerRolloutStableChecks  = 3 // checks a replica without health check must stay running
+	dockerHealthyMarker        = "__iaas_healthy__"
+)
+
+// dockerRolloutStep is one batch of a rolling update
+type dockerRolloutStep struct {
+	RemoveBefore int // old replicas retired before the batch starts
+	Start        int // new replicas started and health checked
+	RemoveAfter  int // old replicas retired once the batch is healthy
+}
+
+// planDockerRollout splits replacing every replica into batches that never run more than
+// replicas+maxSurge containers nor keep fewer than replicas-maxUnavailable healthy ones
+func planDockerRollout(replicas, maxSurge, maxUnavailable int) []dockerRolloutStep {
+	steps := []dockerRolloutStep{}
+	old, started := replicas, 0
+	for started < replicas {
+		step := dockerRolloutStep{RemoveBefore: min(maxUnavailable, old)}
+		old -= step.RemoveBefore
+		step.Start = min(maxSurge+step.RemoveBefore, replicas-started)
+		started += step.Start
+		step.RemoveAfter = old + started - replicas
+		old -= step.RemoveAfter
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+func validateDockerReplicas(replicas, maxSurge, maxUnavailable int, hostPorts bool) error {
+	if replicas < 1 || replicas > dockerMaxReplicas {
+		return fmt.Errorf("%w: replicas must be between 1 and %d", ErrInvalidDockerService, dockerMaxReplicas)
+	}
+	if maxSurge < 0 || maxUnavailable < 0 {
+		return fmt.Errorf("%w: max_surge and max_unavailable cannot be negative", ErrInvalidDockerService)
+	}
+	if maxSurge+maxUnavailable == 0 {
+		return fmt.Errorf("%w: max_surge and max_unavailable cannot both be 0", ErrInvalidDockerService)
+	}
+	if hostPorts && replicas > 1 {
+		return fmt.Errorf("%w: replicated services cannot publish host ports, reach them through the service alias", ErrInvalidDockerService)
+	}
+	if hostPorts && maxSurge > 0 {
+		return fmt.Errorf("%w: services publishing host ports must use max_surge 0", ErrInvalidDockerService)
+	}
+	return nil
+}
+
+func publishesHostPorts(ports []entities.DockerPort) bool {
+	for _, port := range ports {
+		if port.HostPort > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// dockerServiceReplicas returns the replicas of a service, treating the container of a
+// service created before replication as its only replica
+func dockerServiceReplicas(service *entities.DockerService) []entities.DockerServiceReplica {
+	if len(service.Containers) > 0 || service.ContainerID == "" {
+		return service.Containers
+	}
+	return []entities.DockerServiceReplica{{
+		ServiceID:     service.ID,
+		ContainerID:   service.ContainerID,
+		ContainerName: service.ContainerName,
+		ImageTag:      service.ImageTag,
+		Status:        service.Status,
+		IPAddress:     service.IPAddress,
+		CreatedAt:     service.CreatedAt,
+	}}
+}
+
+// replicasOf is dockerServiceReplicas, recording the container of a service created before
+// replication as a replica so it can be managed like the others
+func (s *dockerServiceService) replicasOf(service *entities.DockerService) []entities.DockerServiceReplica {
+	replicas := dockerServiceReplicas(service)
+	if len(service.Containers) == 0 && len(replicas) == 1 {
+		replicas[0].ID = uuid.New().String()
+		if err := s.dockerRepo.CreateReplica(&replicas[0]); err == nil {
+			service.Containers = replicas
+		}
+	}
+	return replicas
+}
+
+// syncPrimary points the container fields of the service at its oldest replica
+func syncPrimary(service *entities.DockerService) {
+	service.ContainerID, service.ContainerName, service.IPAddress = "", "", ""
+	if len(service.Containers) > 0 {
+		primary := service.Containers[0]
+		service.ContainerID = primary.ContainerID
+		service.ContainerName = primary.ContainerName
+		service.IPAddress = primary.IPAddress
+	}
+
+	service.InternalEndpoint = ""
+	if len(service.Ports) > 0 {
+		host := service.ServiceAlias
+		if host == "" {
+			host = service.IPAddress
+		}
+		if host != "" {
+			service.InternalEndpoint = fmt.Sprintf("%s:%d", host, service.Ports[0].ContainerPort)
+		}
+	}
+}
+
+// addReplica starts a container built from spec and records it as a replica of service. A replica
+// whose container was created but failed to start is still returned so the caller can retire it.
+func (s *dockerServiceService) addReplica(ctx context.Context, service, spec *entities.DockerService, containerName string) (*entities.DockerServiceReplica, error) {
+	if containerName == "" {
+		containerName = fmt.Sprintf("iaas-docker-%s-%s", service.ID, uuid.New().String()[:8])
+	}
+
+	config := dockerReplicaContainerConfig(spec, containerName)
+	auth, err := registryAuth(s.registryRepo, spec.RegistryCredentialID)
+	if err != nil {
+		return nil, err
+	}
+	config.RegistryAuth = auth
+
+	containerID, err := s.dockerSvc.CreateContainer(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	replica := &entities.DockerServiceReplica{
+		ID:            uuid.New().String(),
+		ServiceID:     service.ID,
+		ContainerID:   containerID,
+		ContainerName: containerName,
+		ImageTag:      spec.ImageTag,
+		Status:        "creating",
+	}
+	if err := s.dockerRepo.CreateReplica(replica); err != nil {
+		s.dockerSvc.RemoveContainer(ctx, containerID)
+		return nil, err
+	}
+	service.Containers = append(service.Containers, *replica)
+
+	startErr := s.dockerSvc.StartContainer(ctx, containerID)
+	if startErr != nil {
+		replica.Status = "failed"
+	} else {
+		replica.Status = "running"
+		if ip, err := s.getContainerIP(ctx, containerID); err == nil {
+			replica.IPAddress = ip
+		}
+	}
+	s.dockerRepo.UpdateReplica(replica)
+	service.Containers[len(service.Containers)-1] = *replica
+	syncPrimary(service)
+	s.dockerRepo.Update(service)
+
+	return replica, startErr
+}
+
+// pinImage resolves the tag of spec to the digest it currently points at, pulling it as the pull
+// policy requires, and records it on spec. Images without a registry digest, e.g. built
+// locally, stay referenced by tag.
+func (s *dockerServiceService) pinImage(ctx context.Context, spec *entities.DockerService) error {
+	if spec.ImageDigest != "" {
+		return nil
+	}
+	auth, err := registryAuth(s.registryRepo, spec.RegistryCredentialID)
+	if err != nil {
+		return err
+	}
+	image := fmt.Sprintf("%s:%s", spec.Image, spec.ImageTag)
+	if err := s.dockerSvc.EnsureImage(ctx, image, spec.PullPolicy, auth); err != nil {
+		return err
+	}
+	digest, err := s.dockerSvc.ImageDigest(ctx, image)
+	if err != nil {
+		return err
+	}
+	spec.ImageDigest = digest
+	return nil
+}
+
+// retireReplica drops a replica from the service before removing its container, so the events
+// of the container no longer resolve to the service
+func (s *dockerServiceService) retireReplica(ctx context.Context, service *entities.DockerService, replica entities.DockerServiceReplica) {
+	s.dockerRepo.DeleteReplica(replica.ID)
+	remaining := []entities.DockerServiceReplica{}
+	for _, r := range service.Containers {
+		if r.ID != replica.ID {
+			remaining = append(remaining, r)
+		}
+	}
+	service.Containers = remaining
+	syncPrimary(service)
+	s.dockerRepo.Update(service)
+
+	if replica.ContainerID != "" {
+		s.dockerSvc.StopContainer(ctx, replica.ContainerID)
+		s.dockerSvc.RemoveContainer(ctx, replica.ContainerID)
+	}
+}
+
+// parkReplica stops the container of a replica that makes room for a new one without removing
+// it, so a failed rollout can start it again. The replica leaves the service first, so the stop
+// event of its container no longer resolves to the service.
+func (s *dockerServiceService) parkReplica(ctx context.Context, service *entities.DockerService, replica *entities.DockerServiceReplica) {
+	remaining := []entities.DockerServiceReplica{}
+	for _, r := range service.Containers {
+		if r.ID != replica.ID {
+			remaining = append(remaining, r)
+		}
+	}
+	service.Containers = remaining
+	syncPrimary(service)
+	s.dockerRepo.Update(service)
+
+	replica.Status = "stopped"
+	s.dockerRepo.UpdateReplica(replica)
+	if replica.ContainerID != "" {
+		s.dockerSvc.StopContainer(ctx, replica.ContainerID)
+	}
+}
+
+// restoreReplica starts the container of a parked replica again and returns it to the service
+func (s *dockerServiceService) restoreReplica(ctx context.Context, service *entities.DockerService, replica entities.DockerServiceReplica) error {
+	service.Containers = append(service.Containers, replica)
+	syncPrimary(service)
+	s.dockerRepo.Update(service)
+
+	if err := s.dockerSvc.StartContainer(ctx, replica.ContainerID); err != nil {
+		return err
+	}
+	replica.Status = "running"
+	if ip, err := s.getContainerIP(ctx, replica.ContainerID); err == nil {
+		replica.IPAddress = ip
+	}
+	s.dockerRepo.UpdateReplica(&replica)
+	service.Containers[len(service.Containers)-1] = replica
+	syncPrimary(service)
+	s.dockerRepo.Update(service)
+	return nil
+}
+
+// waitReplicaHealthy waits until Docker reports the replica healthy. Containers created without a
+// HEALTHCHECK, as for HTTP and TCP checks, must pass the service health check HealthyThreshold
+// times in a row, or stay running for a few checks when the service has none.
+func (s *dockerServiceService) waitReplicaHealthy(ctx context.Context, spec *entities.DockerService, replica *entities.DockerServiceReplica) error {
+	threshold := dockerRolloutStableChecks
+	timeout := dockerRolloutHealthTimeout
+	if hc := spec.HealthCheck; hc != nil {
+		if hc.HealthyThreshold > 0 {
+			threshold = hc.HealthyThreshold
+		}
+		// Leave Docker time to run enough checks to call the replica unhealthy
+		if config := dockerHealthCheckConfig(hc); config != nil {
+			timeout = max(timeout, config.Interval*time.Duration(config.Retries+1)+config.Timeout)
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	successes := 0
+	lastErr := fmt.Errorf("no check completed")
+	for time.Now().Before(deadline) {
+		info, err := s.dockerSvc.InspectContainer(ctx, replica.ContainerID)
+		if err != nil || info.State == nil {
+			return fmt.Errorf("replica %s: container not found", replica.ContainerName)
+		}
+		if !info.State.Running {
+			return fmt.Errorf("replica %s exited with code %d", replica.ContainerName, info.State.ExitCode)
+		}
+
+		if health := info.State.Health; health != nil {
+			switch health.Status {
+			case entities.DockerHealthHealthy:
+				return nil
+			case entities.DockerHealthUnhealthy:
+				output := ""
+				if len(health.Log) > 0 {
+					output = strings.TrimSpace(health.Log[len(health.Log)-1].Output)
+				}
+				return fmt.Errorf("replica %s is unhealthy: %s", replica.ContainerName, output)
+			}
+			lastErr = fmt.Errorf("health is %s", health.Status)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(dockerRolloutProbeInterval):
+			}
+			continue
+		}
+
+		ip := info.NetworkSettings.IPAddress
+		for _, endpoint := range info.NetworkSettings.Networks {
+			if ip == "" && endpoint.IPAddress != "" {
+				ip = endpoint.IPAddress
+			}
+		}
+		if lastErr = probeDockerReplica(ctx, s.dockerSvc, spec, replica.ContainerID, ip); lastErr == nil {
+			successes++
+			if successes >= threshold {
+				return nil
+			}
+		} else {
+			successes = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(dockerRolloutProbeInterval):
+		}
+	}
+	return fmt.Errorf("replica %s did not become healthy within %s: %v", replica.ContainerName, timeout, lastErr)
+}
+
+// probeDockerReplica runs the service health check once against a replica. HTTP and TCP
+// checks connect to the replica address, command checks run inside the container.
+func probeDockerReplica(ctx context.Context, dockerSvc docker.IDockerService, spec *entities.DockerService, containerID, ip string) error {
+	hc := spec.HealthCheck
+	if hc == nil {
+		return nil
+	}
+
+	timeout := time.Duration(hc.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	port := hc.Port
+	if port == 0 && len(spec.Ports) > 0 {
+		port = spec.Ports[0].ContainerPort
+	}
+
+	switch hc.Type {
+	case entities.DockerHealthCheckHTTP:
+		if ip == "" {
+			return fmt.Errorf("replica has no IP address yet")
+		}
+		path := hc.HTTPPath
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		client := &http.Client{Timeout: timeout}
+		resp, err := client.Get(fmt.Sprintf("http://%s%s", net.JoinHostPort(ip, strconv.Itoa(port)), path))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("health check returned HTTP %d", resp.StatusCode)
+		}
+
+	case entities.DockerHealthCheckTCP:
+		if ip == "" {
+			return fmt.Errorf("replica has no IP address yet")
+		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(port)), timeout)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+
+	case entities.DockerHealthCheckCommand:
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		output, err := dockerSvc.ExecCommand(probeCtx, containerID, []string{"sh", "-c", hc.Command + " && echo " + dockerHealthyMarker})
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(output, dockerHealthyMarker) {
+			return fmt.Errorf("health check command failed: %s", strings.TrimSpace(output))
+		}
+	}
+	return nil
+}
+
+// claimService keeps other scales, rollouts and lifecycle actions off the service until it is
+// removed from s.rollouts, so none of them works on replicas another one is replacing
+func (s *dockerServiceService) claimService(serviceID string) error {
+	if _, busy := s.rollouts.LoadOrStore(serviceID, struct{}{}); busy {
+		return fmt.Errorf("%w: %s", ErrDockerServiceBusy, serviceID)
+	}
+	return nil
+}
+
+// ScaleDockerService starts or retires replicas, newest first, until the service runs replicas containers
+func (s *dockerServiceService) ScaleDockerService(ctx context.Context, serviceID string, replicas int) (*dto.DockerServiceInfo, error) {
+	service, err := s.findService(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateDockerReplicas(replicas, service.MaxSurge, service.MaxUnavailable, publishesHostPorts(service.Ports)); err != nil {
+		return nil, err
+	}
+	if err := s.claimService(service.ID); err != nil {
+		return nil, err
+	}
+	defer s.rollouts.Delete(service.ID)
+
+	s.replicasOf(service)
+	for len(service.Containers) < replicas {
+		replica, err := s.addReplica(ctx, service, service, "")
+		if err != nil {
+			if replica != nil {
+				s.retireReplica(ctx, service, *replica)
+			}
+			return nil, err
+		}
+	}
+	for len(service.Containers) > replicas {
+		s.retireReplica(ctx, service, service.Containers[len(service.Containers)-1])
+	}
+
+	service.Replicas = replicas
+	if err := s.dockerRepo.Update(service); err != nil {
+		return nil, err
+	}
+	return s.GetDockerService(ctx, service.ID)
+}
+
+// RollingUpdateDockerService replaces the replicas with the new image tag or env vars in the
+// background. Each batch must pass the health check before old replicas are retired; when one
+// fails, the new replicas are removed and the previous spec is restored.
+func (s *dockerServiceService) RollingUpdateDockerService(ctx context.Context, serviceID string, req dto.RollingUpdateDockerServiceRequest) (*dto.DockerServiceInfo, error) {
+	service, err := s.findService(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if req.ImageTag == "" && req.EnvVars == nil {
+		return nil, fmt.Errorf("%w: nothing to roll out, set image_tag or env_vars", ErrInvalidDockerService)
+	}
+
+	maxSurge, maxUnavailable := service.MaxSurge, service.MaxUnavailable
+	if req.MaxSurge != nil {
+		maxSurge = *req.MaxSurge
+	}
+	if req.MaxUnavailable != nil {
+		maxUnavailable = *req.MaxUnavailable
+	}
+	if err := validateDockerReplicas(service.Replicas, maxSurge, maxUnavailable, publishesHostPorts(service.Ports)); err != nil {
+		return nil, err
+	}
+
+	next := *service
+	if req.ImageTag != "" {
+		next.ImageTag = req.ImageTag
+	}
+	// Re-resolve the tag for a new tag, or on every rollout when the image is always pulled
+	if req.ImageTag != "" || next.PullPolicy == docker.PullAlways {
+		next.ImageDigest = ""
+	}
+	if req.EnvVars != nil {
+		next.EnvVars = []entities.DockerEnvVar{}
+		for _, env := range req.EnvVars {
+			next.EnvVars = append(next.EnvVars, entities.DockerEnvVar{
+				ID:        uuid.New().String(),
+				ServiceID: service.ID,
+				Key:       env.Key,
+				Value:     env.Value,
+				IsSecret:  env.IsSecret,
+			})
+		}
+	}
+
+	service.MaxSurge, service.MaxUnavailable = maxSurge, maxUnavailable
+	next.MaxSurge, next.MaxUnavailable = maxSurge, maxUnavailable
+	return s.startRollout(ctx, service, &next, dockerSpecChange{envVars: req.EnvVars != nil},
+		fmt.Sprintf("rolling out %s:%s", next.Image, next.ImageTag))
+}
+
+// AttachVolume mounts a volume or bind directory into the service, rolling its replicas out
+// with the new mount. Stopped services are started by the rollout.
+func (s *dockerServiceService) AttachVolume(ctx context.Context, userID, serviceID string, req dto.VolumeMountInput) (*dto.DockerServiceInfo, error) {
+	service, err := s.findService(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	mount, err := dockerVolumeMount(ctx, s.volumeRepo, s.dockerSvc, userID, req)
+	if err != nil {
+		return nil, err
+	}
+	mount.ServiceID = service.ID
+
+	next := *service
+	next.Volumes = append(append([]entities.DockerVolumeMount{}, service.Volumes...), *mount)
+	if err := validateServiceMounts(next.Volumes); err != nil {
+		return nil, err
+	}
+	return s.startRollout(ctx, service, &next, dockerSpecChange{volumes: true}, fmt.Sprintf("mounting %s at %s", mount.Source, mount.Target))
+}
+
+// DetachVolume removes a mount from the service, rolling its replicas out without it. The
+// volume itself is kept.
+func (s *dockerServiceService) DetachVolume(ctx context.Context, serviceID, mountID string) (*dto.DockerServiceInfo, error) {
+	service, err := s.findService(serviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	next := *service
+	next.Volumes = []entities.DockerVolumeMount{}
+	var detached *entities.DockerVolumeMount
+	for i, mount := range service.Volumes {
+		if mount.ID == mountID {
+			detached = &service.Volumes[i]
+			continue
+		}
+		next.Volumes = append(next.Volumes, mount)
+	}
+	if detached == nil {
+		return nil, fmt.Errorf("%w: %s", ErrDockerVolumeMountNotFound, mountID)
+	}
+	return s.startRollout(ctx, service, &next, dockerSpecChange{volumes: true}, fmt.Sprintf("unmounting %s from %s", detached.Source, detached.Target))
+}
+
+// dockerSpecChange lists what a rollout changes besides the image, to store once it completes
+type dockerSpecChange struct {
+	envVars bool
+	volumes bool
+	ports   bool
+	spec    bool // command and resource limits
+}
+
+// startRollout marks the service as rolling out and replaces its replicas with ones built
+// from next in the background, in batches sized by the max surge and unavailable of next
+func (s *dockerServiceService) startRollout(ctx context.Context, service, next *entities.DockerService, change dockerSpecChange, message string) (*dto.DockerServiceInfo, error) {
+	if err := s.claimService(service.ID); err != nil {
+		return nil, err
+	}
+
+	service.RolloutStatus = entities.DockerRolloutInProgress
+	service.RolloutMessage = message
+	if err := s.dockerRepo.Update(service); err != nil {
+		s.rollouts.Delete(service.ID)
+		return nil, err
+	}
+
+	go s.runRollout(context.Background(), service, next, change)
+	return toDockerServiceInfo(ctx, service), nil
+}
+
+func (s *dockerServiceService) runRollout(ctx context.Context, service, next *entities.DockerService, change dockerSpecChange) {
+	defer s.rollouts.Delete(service.ID)
+
+	old := append([]entities.DockerServiceReplica{}, s.replicasOf(service)...)
+	started := []entities.DockerServiceReplica{}
+	// Replicas stopped to make room for a batch are only removed once it is healthy
+	parked := []entities.DockerServiceReplica{}
+	if err := s.pinImage(ctx, next); err != nil {
+		s.rollBack(ctx, service, started, parked, err)
+		return
+	}
+	retireOld := func(n int) {
+		for ; n > 0 && len(old) > 0; n-- {
+			s.retireReplica(ctx, service, old[0])
+			old = old[1:]
+		}
+	}
+
+	for _, step := range planDockerRollout(service.Replicas, next.MaxSurge, next.MaxUnavailable) {
+		for n := step.RemoveBefore; n > 0 && len(old) > 0; n-- {
+			s.parkReplica(ctx, service, &old[0])
+			parked = append(parked, old[0])
+			old = old[1:]
+		}
+
+		batch := []*entities.DockerServiceReplica{}
+		for i := 0; i < step.Start; i++ {
+			replica, err := s.addReplica(ctx, service, next, "")
+			if replica != nil {
+				started = append(started, *replica)
+			}
+			if err != nil {
+				s.rollBack(ctx, service, started, parked, err)
+				return
+			}
+			batch = append(batch, replica)
+		}
+		for _, replica := range batch {
+			if err := s.waitReplicaHealthy(ctx, next, replica); err != nil {
+				s.rollBack(ctx, service, started, parked, err)
+				return
+			}
+		}
+
+		for _, replica := range parked {
+			s.retireReplica(ctx, service, replica)
+		}
+		parked = parked[:0]
+		retireOld(step.RemoveAfter)
+	}
+	retireOld(len(old))
+
+	service.ImageTag, service.ImageDigest = next.ImageTag, next.ImageDigest
+	if change.envVars {
+		if err := s.dockerRepo.UpdateEnvVars(service.ID, next.EnvVars); err == nil {
+			service.EnvVars = next.EnvVars
+		}
+	}
+	if change.volumes {
+		if err := s.dockerRepo.UpdateVolumeMounts(service.ID, next.Volumes); err == nil {
+			service.Volumes = next.Volumes
+		}
+	}
+	if change.ports {
+		if err := s.dockerRepo.UpdatePorts(service.ID, next.Ports); err == nil {
+			service.Ports = next.Ports
+			syncPrimary(service)
+		}
+	}
+	if change.spec {
+		service.Command = next.Command
+		service.CPULimit, service.MemoryLimit = next.CPULimit, next.MemoryLimit
+	}
+	service.Status = "running"
+	service.RolloutStatus = entities.DockerRolloutCompleted
+	service.RolloutMessage = fmt.Sprintf("updated to %s:%s", service.Image, service.ImageTag)
+	s.dockerRepo.Update(service)
+}
+
+// rollBack retires the replicas a failed rollout started, starts the parked ones it stopped
+// again and brings the service back to its replica count with the previous image and env vars
+func (s *dockerServiceService) rollBack(ctx context.Context, service *entities.DockerService, started, parked []entities.DockerServiceReplica, cause error) {
+	for _, replica := range started {
+		s.retireReplica(ctx, service, replica)
+	}
+	for _, replica := range parked {
+		if err := s.restoreReplica(ctx, service, replica); err != nil {
+			s.retireReplica(ctx, service, replica)
+		}
+	}
+
+	service.RolloutStatus = entities.DockerRolloutRolledBack
+	service.RolloutMessage = fmt.Sprintf("rolled back to %s:%s: %v", service.Image, service.ImageTag, cause)
+	for len(service.Containers) < service.Replicas {
+		replica, err := s.addReplica(ctx, service, service, "")
+		if err != nil {
+			if replica != nil {
+				s.retireReplica(ctx, service, *replica)
+			}
+			service.RolloutStatus = entities.DockerRolloutFailed
+			service.RolloutMessage = fmt.Sprintf("rollback to %s:%s failed: %v (rollout error: %v)", service.Image, service.ImageTag, err, cause)
+			break
+		}
+	}
+	s.dockerRepo.Update(service)
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestPlanDockerRollout(t *testing.T) {
+	// Surge only: one new replica at a time, old ones retired after it is healthy
+	assert.Equal(t, []dockerRolloutStep{
+		{Start: 1, RemoveAfter: 1},
+		{Start: 1, RemoveAfter: 1},
+		{Start: 1, RemoveAfter: 1},
+	}, planDockerRollout(3, 1, 0))
+
+	// Replace in place, as for services publishing host ports
+	assert.Equal(t, []dockerRolloutStep{{RemoveBefore: 1, Start: 1}}, planDockerRollout(1, 0, 1))
+
+	assert.Equal(t, []dockerRolloutStep{
+		{RemoveBefore: 1, Start: 3, RemoveAfter: 2},
+		{RemoveBefore: 1, Start: 1},
+	}, planDockerRollout(4, 2, 1))
+
+	for _, c := range [][3]int{{1, 1, 0}, {5, 1, 0}, {5, 0, 2}, {5, 3, 1}, {3, 10, 10}, {20, 4, 4}} {
+		replicas, maxSurge, maxUnavailable := c[0], c[1], c[2]
+		running, started := replicas, 0
+		for _, step := range planDockerRollout(replicas, maxSurge, maxUnavailable) {
+			running -= step.RemoveBefore
+			assert.GreaterOrEqual(t, running, replicas-maxUnavailable, "%v", c)
+			running += step.Start
+			assert.LessOrEqual(t, running, replicas+maxSurge, "%v", c)
+			running -= step.RemoveAfter
+			started += step.Start
+		}
+		assert.Equal(t, replicas, started, "%v", c)
+		assert.Equal(t, replicas, running, "%v", c)
+	}
+}
+
+func TestValidateDockerReplicas(t *testing.T) {
+	assert.NoError(t, validateDockerReplicas(3, 1, 0, false))
+	assert.NoError(t, validateDockerReplicas(1, 0, 1, true))
+
+	assert.Error(t, validateDockerReplicas(0, 1, 0, false))
+	assert.Error(t, validateDockerReplicas(dockerMaxReplicas+1, 1, 0, false))
+	assert.ErrorIs(t, validateDockerReplicas(2, 0, 0, false), ErrInvalidDockerService)
+	assert.Error(t, validateDockerReplicas(2, -1, 1, false))
+	assert.Error(t, validateDockerReplicas(2, 0, 1, true))
+	assert.Error(t, validateDockerReplicas(1, 1, 0, true))
+}
+
+func TestSyncPrimary(t *testing.T) {
+	service := &entities.DockerService{
+		ID:           "svc-1",
+		ServiceAlias: "api",
+		Ports:        []entities.DockerPort{{ContainerPort: 8080}},
+		Containers: []entities.DockerServiceReplica{
+			{ContainerID: "c1", ContainerName: "iaas-docker-svc-1", IPAddress: "172.18.0.5"},
+			{ContainerID: "c2", ContainerName: "iaas-docker-svc-1-ab12cd34", IPAddress: "172.18.0.6"},
+		},
+	}
+
+	syncPrimary(service)
+	assert.Equal(t, "c1", service.ContainerID)
+	assert.Equal(t, "172.18.0.5", service.IPAddress)
+	assert.Equal(t, "api:8080", service.InternalEndpoint)
+
+	service.Containers = service.Containers[1:]
+	service.ServiceAlias = ""
+	syncPrimary(service)
+	assert.Equal(t, "c2", service.ContainerID)
+	assert.Equal(t, "172.18.0.6:8080", service.InternalEndpoint)
+
+	service.Containers = nil
+	syncPrimary(service)
+	assert.Empty(t, service.ContainerID)
+	assert.Empty(t, service.InternalEndpoint)
+}
+
+func TestDockerServiceReplicasLegacy(t *testing.T) {
+	service := &entities.DockerService{ID: "svc-1", ContainerID: "c1", ContainerName: "iaas-docker-svc-1", ImageTag: "1.0", Status: "running"}
+
+	replicas := dockerServiceReplicas(service)
+	assert.Len(t, replicas, 1)
+	assert.Equal(t, "c1", replicas[0].ContainerID)
+	assert.Equal(t, "1.0", replicas[0].ImageTag)
+
+	service.ContainerID = ""
+	assert.Empty(t, dockerServiceReplicas(service))
+}
+
+// surgeDocker runs any number of containers side by side, as services without host ports do.
+// Images with "bad" in their reference turn unhealthy.
+type surgeDocker struct {
+	*hostPortDocker
+}
+
+func (d surgeDocker) StartContainer(ctx context.Context, containerID string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.removed[containerID] {
+		return fmt.Errorf("container %s was removed", containerID)
+	}
+	d.running[containerID] = true
+	return nil
+}
+
+func TestSurgeRolloutRollsBackUnhealthyBatch(t *testing.T) {
+	dockerSvc := surgeDocker{newHostPortDocker()}
+	replicas := []entities.DockerServiceReplica{
+		{ID: "r-1", ServiceID: "svc-1", ContainerID: "old-1", ContainerName: "api-1", ImageTag: "1.25", Status: "running"},
+		{ID: "r-2", ServiceID: "svc-1", ContainerID: "old-2", ContainerName: "api-2", ImageTag: "1.25", Status: "running"},
+	}
+	repo := &memoryReplicaRepo{replicas: map[string]entities.DockerServiceReplica{}}
+	for _, replica := range replicas {
+		dockerSvc.images[replica.ContainerID] = "nginx@sha256:old"
+		dockerSvc.running[replica.ContainerID] = true
+		repo.replicas[replica.ID] = replica
+	}
+	service := &entities.DockerService{
+		ID: "svc-1", Image: "nginx", ImageTag: "1.25", ImageDigest: "sha256:old", Replicas: 2, MaxSurge: 1,
+		Containers: replicas,
+	}
+	next, _, _, _ := planDockerServiceUpdate(service, dto.UpdateDockerServiceRequest{ImageTag: "bad"}, 0, 0)
+	next.ImageDigest = "sha256:bad"
+	svc := &dockerServiceService{dockerRepo: repo, dockerSvc: dockerSvc}
+
+	svc.runRollout(context.Background(), service, next, dockerSpecChange{spec: true})
+	assert.Equal(t, entities.DockerRolloutRolledBack, service.RolloutStatus, service.RolloutMessage)
+	assert.Contains(t, service.RolloutMessage, "unhealthy")
+
+	// The surged replica is removed and the old ones were never touched
+	assert.Equal(t, 1, dockerSvc.next)
+	assert.True(t, dockerSvc.removed["new-1"])
+	assert.NotContains(t, repo.replicas, "new-1")
+	for _, id := range []string{"old-1", "old-2"} {
+		assert.True(t, dockerSvc.running[id], id)
+		assert.False(t, dockerSvc.removed[id], id)
+	}
+	require.Len(t, service.Containers, 2)
+	assert.Equal(t, "1.25", service.ImageTag)
+	assert.Len(t, repo.replicas, 2)
+
+	_, busy := svc.rollouts.Load(service.ID)
+	assert.False(t, busy)
+}
+
+// serviceRepo finds a single service by ID; other calls panic
+type serviceRepo struct {
+	repositories.IDockerServiceRepository
+	service *entities.DockerService
+}
+
+func (r serviceRepo) FindByID(id string) (*entities.DockerService, error) {
+	if id != r.service.ID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return r.service, nil
+}
+
+func TestLifecycleActionsWaitForRollout(t *testing.T) {
+	service := &entities.DockerService{
+		ID: "svc-1", Replicas: 1, MaxSurge: 1,
+		Containers: []entities.DockerServiceReplica{{ID: "r-1", ServiceID: "svc-1", ContainerID: "old-1", Status: "running"}},
+	}
+	// Docker and the other repository calls panic, nothing may touch the replicas
+	svc := &dockerServiceService{dockerRepo: serviceRepo{service: service}}
+	svc.rollouts.Store(service.ID, struct{}{})
+
+	assert.ErrorIs(t, svc.StopDockerService(context.Background(), service.ID), ErrDockerServiceBusy)
+	assert.ErrorIs(t, svc.DeleteDockerService(context.Background(), service.ID), ErrDockerServiceBusy)
+	_, err := svc.ScaleDockerService(context.Background(), service.ID, 2)
+	assert.ErrorIs(t, err, ErrDockerServiceBusy)
+
+	// The rollout still holds the service
+	_, busy := svc.rollouts.Load(service.ID)
+	assert.True(t, busy)
+}
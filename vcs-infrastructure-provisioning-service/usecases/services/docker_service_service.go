@@ -2,8 +2,10 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
@@ -12,36 +14,112 @@ import (
 	"github.com/google/uuid"
 )
 
+// ErrDockerServiceForbidden is returned when a Docker service belongs to another user
+var ErrDockerServiceForbidden = errors.New("docker service belongs to another user")
+
+// ErrInvalidDockerService is returned when a requested replica, rollout or pull setting cannot be run
+var ErrInvalidDockerService = errors.New("invalid docker service")
+
+// ErrDockerServiceBusy is returned while a Docker service is being scaled or rolled out
+var ErrDockerServiceBusy = errors.New("docker service is being scaled or rolled out")
+
 type IDockerServiceService interface {
 	CreateDockerService(ctx context.Context, userID string, req dto.CreateDockerServiceRequest) (*dto.DockerServiceInfo, error)
 	GetDockerService(ctx context.Context, serviceID string) (*dto.DockerServiceInfo, error)
+	ListDockerServices(ctx context.Context, userID string, req dto.ListDockerServicesRequest) (*dto.DockerServiceListResponse, error)
+	AuthorizeDockerService(ctx context.Context, userID, serviceID string) error
 	StartDockerService(ctx context.Context, serviceID string) error
 	StopDockerService(ctx context.Context, serviceID string) error
 	RestartDockerService(ctx context.Context, serviceID string) error
 	DeleteDockerService(ctx context.Context, serviceID string) error
 	UpdateEnvVars(ctx context.Context, serviceID string, req dto.UpdateDockerEnvRequest) error
+	ScaleDockerService(ctx context.Context, serviceID string, replicas int) (*dto.DockerServiceInfo, error)
+	RollingUpdateDockerService(ctx context.Context, serviceID string, req dto.RollingUpdateDockerServiceRequest) (*dto.DockerServiceInfo, error)
+	UpdateDockerService(ctx context.Context, serviceID string, req dto.UpdateDockerServiceRequest) (*dto.UpdateDockerServiceResponse, error)
+	AttachVolume(ctx context.Context, userID, serviceID string, req dto.VolumeMountInput) (*dto.DockerServiceInfo, error)
+	DetachVolume(ctx context.Context, serviceID, mountID string) (*dto.DockerServiceInfo, error)
 	GetServiceLogs(ctx context.Context, serviceID string, tail int) ([]string, error)
 }
 
 type dockerServiceService struct {
-	dockerRepo repositories.IDockerServiceRepository
-	infraRepo  repositories.IInfrastructureRepository
-	dockerSvc  docker.IDockerService
+	dockerRepo   repositories.IDockerServiceRepository
+	infraRepo    repositories.IInfrastructureRepository
+	registryRepo repositories.IRegistryCredentialRepository
+	volumeRepo   repositories.IDockerVolumeRepository
+	dockerSvc    docker.IDockerService
+	rollouts     sync.Map // IDs of services being scaled, rolled out, stopped or deleted
 }
 
 func NewDockerServiceService(
 	dockerRepo repositories.IDockerServiceRepository,
 	infraRepo repositories.IInfrastructureRepository,
+	registryRepo repositories.IRegistryCredentialRepository,
+	volumeRepo repositories.IDockerVolumeRepository,
 	dockerSvc docker.IDockerService,
 ) IDockerServiceService {
 	return &dockerServiceService{
-		dockerRepo: dockerRepo,
-		infraRepo:  infraRepo,
-		dockerSvc:  dockerSvc,
+		dockerRepo:   dockerRepo,
+		infraRepo:    infraRepo,
+		registryRepo: registryRepo,
+		volumeRepo:   volumeRepo,
+		dockerSvc:    dockerSvc,
 	}
 }
 
 func (s *dockerServiceService) CreateDockerService(ctx context.Context, userID string, req dto.CreateDockerServiceRequest) (*dto.DockerServiceInfo, error) {
+	hostPorts := false
+	for _, port := range req.Ports {
+		hostPorts = hostPorts || port.HostPort > 0
+	}
+	replicas := req.Replicas
+	if replicas == 0 {
+		replicas = 1
+	}
+	// Replicas publishing host ports cannot overlap, so those services replace in place by default
+	maxSurge, maxUnavailable := 1, 0
+	if hostPorts {
+		maxSurge, maxUnavailable = 0, 1
+	}
+	if req.MaxSurge != nil {
+		maxSurge = *req.MaxSurge
+	}
+	if req.MaxUnavailable != nil {
+		maxUnavailable = *req.MaxUnavailable
+	}
+	if err := validateDockerReplicas(replicas, maxSurge, maxUnavailable, hostPorts); err != nil {
+		return nil, err
+	}
+
+	credentialID := ""
+	if req.RegistryCredentialID != "" {
+		credential, err := resolveRegistryCredential(s.registryRepo, userID, req.RegistryCredentialID)
+		if err != nil {
+			return nil, err
+		}
+		credentialID = credential.ID
+	}
+	pullPolicy := req.PullPolicy
+	switch pullPolicy {
+	case "":
+		pullPolicy = docker.PullIfNotPresent
+	case docker.PullAlways, docker.PullIfNotPresent, docker.PullNever:
+	default:
+		// Stack specs reach here without request binding
+		return nil, fmt.Errorf("%w: pull_policy must be one of %s, %s or %s", ErrInvalidDockerService, docker.PullAlways, docker.PullIfNotPresent, docker.PullNever)
+	}
+
+	mounts := []entities.DockerVolumeMount{}
+	for _, input := range req.Volumes {
+		mount, err := dockerVolumeMount(ctx, s.volumeRepo, s.dockerSvc, userID, input)
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, *mount)
+	}
+	if err := validateServiceMounts(mounts); err != nil {
+		return nil, err
+	}
+
 	infraID := uuid.New().String()
 	serviceID := uuid.New().String()
 
@@ -59,18 +137,27 @@ func (s *dockerServiceService) CreateDockerService(ctx context.Context, userID s
 	cpuLimit, memoryLimit := s.getPlanResources(req.Plan)
 
 	service := &entities.DockerService{
-		ID:               serviceID,
-		InfrastructureID: infraID,
-		Name:             req.Name,
-		Image:            req.Image,
-		ImageTag:         req.ImageTag,
-		ServiceType:      req.ServiceType,
-		Command:          req.Command,
-		Args:             req.Args,
-		RestartPolicy:    req.RestartPolicy,
-		CPULimit:         cpuLimit,
-		MemoryLimit:      memoryLimit,
-		Status:           "creating",
+		ID:                   serviceID,
+		InfrastructureID:     infraID,
+		Name:                 req.Name,
+		Image:                req.Image,
+		ImageTag:             req.ImageTag,
+		ServiceType:          req.ServiceType,
+		Command:              req.Command,
+		Args:                 req.Args,
+		RestartPolicy:        req.RestartPolicy,
+		CPULimit:             cpuLimit,
+		MemoryLimit:          memoryLimit,
+		Status:               "creating",
+		Replicas:             replicas,
+		ServiceAlias:         fmt.Sprintf("docker-%s", serviceID),
+		MaxSurge:             maxSurge,
+		MaxUnavailable:       maxUnavailable,
+		PullPolicy:           pullPolicy,
+		RegistryCredentialID: credentialID,
+	}
+	if len(req.Networks) > 0 && req.Networks[0].Alias != "" {
+		service.ServiceAlias = req.Networks[0].Alias
 	}
 
 	if service.ServiceType == "" {
@@ -121,6 +208,11 @@ func (s *dockerServiceService) CreateDockerService(ctx context.Context, userID s
 		}
 	}
 
+	for i := range mounts {
+		mounts[i].ServiceID = serviceID
+		s.dockerRepo.CreateVolumeMount(&mounts[i])
+	}
+
 	if req.HealthCheck != nil {
 		healthCheck := &entities.DockerHealthCheck{
 			ID:                 uuid.New().String(),
@@ -144,57 +236,13 @@ func (s *dockerServiceService) CreateDockerService(ctx context.Context, userID s
 		s.dockerRepo.CreateHealthCheck(healthCheck)
 	}
 
-	envVars := []string{}
-	for _, env := range req.EnvVars {
-		envVars = append(envVars, fmt.Sprintf("%s=%s", env.Key, env.Value))
-	}
-
-	ports := map[string]string{}
-	for _, port := range req.Ports {
-		containerPortStr := fmt.Sprintf("%d", port.ContainerPort)
-		if port.HostPort > 0 {
-			ports[containerPortStr] = fmt.Sprintf("%d", port.HostPort)
-		}
-	}
-
-	networks := []string{"iaas_iaas-network"}
-	if len(req.Networks) > 0 {
-		networks = []string{}
-		for _, network := range req.Networks {
-			networks = append(networks, network.NetworkID)
-		}
-	}
-
-	containerName := fmt.Sprintf("iaas-docker-%s", serviceID)
-	containerConfig := docker.ContainerConfig{
-		Name:    containerName,
-		Image:   fmt.Sprintf("%s:%s", req.Image, req.ImageTag),
-		Env:     envVars,
-		Ports:   ports,
-		Network: networks[0],
-		Resources: docker.ResourceConfig{
-			CPULimit:    cpuLimit,
-			MemoryLimit: memoryLimit,
-		},
-	}
-
-	if req.Command != "" {
-		containerConfig.Cmd = strings.Split(req.Command, " ")
-	}
-
-	containerID, err := s.dockerSvc.CreateContainer(ctx, containerConfig)
+	// Reload so the replicas are built from the stored definition
+	service, err := s.dockerRepo.FindByID(serviceID)
 	if err != nil {
-		infra.Status = entities.StatusFailed
-		s.infraRepo.Update(infra)
-		service.Status = "failed"
-		s.dockerRepo.Update(service)
 		return nil, err
 	}
 
-	service.ContainerID = containerID
-	service.ContainerName = containerName
-
-	if err := s.dockerSvc.StartContainer(ctx, containerID); err != nil {
+	if err := s.pinImage(ctx, service); err != nil {
 		infra.Status = entities.StatusFailed
 		s.infraRepo.Update(infra)
 		service.Status = "failed"
@@ -202,11 +250,18 @@ func (s *dockerServiceService) CreateDockerService(ctx context.Context, userID s
 		return nil, err
 	}
 
-	containerIP, err := s.getContainerIP(ctx, containerID)
-	if err == nil {
-		service.IPAddress = containerIP
-		if len(req.Ports) > 0 {
-			service.InternalEndpoint = fmt.Sprintf("%s:%d", containerIP, req.Ports[0].ContainerPort)
+	for i := 0; i < service.Replicas; i++ {
+		// The first replica keeps the container name of single-container services
+		name := ""
+		if i == 0 {
+			name = fmt.Sprintf("iaas-docker-%s", serviceID)
+		}
+		if _, err := s.addReplica(ctx, service, service, name); err != nil {
+			infra.Status = entities.StatusFailed
+			s.infraRepo.Update(infra)
+			service.Status = "failed"
+			s.dockerRepo.Update(service)
+			return nil, err
 		}
 	}
 
@@ -220,7 +275,7 @@ func (s *dockerServiceService) CreateDockerService(ctx context.Context, userID s
 }
 
 func (s *dockerServiceService) GetDockerService(ctx context.Context, serviceID string) (*dto.DockerServiceInfo, error) {
-	service, err := s.dockerRepo.FindByID(serviceID)
+	service, err := s.findService(serviceID)
 	if err != nil {
 		return nil, err
 	}
@@ -259,130 +314,145 @@ func (s *dockerServiceService) GetDockerService(ctx context.Context, serviceID s
 		}
 	}
 
-	envVars := []dto.EnvVarInfo{}
-	for _, env := range service.EnvVars {
-		envInfo := dto.EnvVarInfo{
-			Key:      env.Key,
-			IsSecret: env.IsSecret,
-		}
-		if !env.IsSecret {
-			envInfo.Value = env.Value
-		}
-		envVars = append(envVars, envInfo)
-	}
+	return toDockerServiceInfo(ctx, service), nil
+}
 
-	ports := []dto.PortInfo{}
-	for _, port := range service.Ports {
-		ports = append(ports, dto.PortInfo{
-			ContainerPort: port.ContainerPort,
-			HostPort:      port.HostPort,
-			Protocol:      port.Protocol,
-		})
+func (s *dockerServiceService) ListDockerServices(ctx context.Context, userID string, req dto.ListDockerServicesRequest) (*dto.DockerServiceListResponse, error) {
+	page, pageSize := req.Page, req.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
 	}
 
-	networks := []dto.NetworkInfo{}
-	for _, network := range service.Networks {
-		networks = append(networks, dto.NetworkInfo{
-			NetworkID: network.NetworkID,
-			Alias:     network.Alias,
-		})
+	filter := repositories.DockerServiceFilter{
+		Status:      req.Status,
+		ServiceType: req.ServiceType,
+		Name:        req.Name,
+		Image:       req.Image,
+		Health:      req.Health,
+	}
+	services, total, err := s.dockerRepo.FindByUserID(userID, filter, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
 	}
 
-	var healthCheck *dto.HealthCheckInfo
-	if service.HealthCheck != nil {
-		healthCheck = &dto.HealthCheckInfo{
-			Type:               service.HealthCheck.Type,
-			HTTPPath:           service.HealthCheck.HTTPPath,
-			Port:               service.HealthCheck.Port,
-			Command:            service.HealthCheck.Command,
-			Interval:           service.HealthCheck.Interval,
-			Timeout:            service.HealthCheck.Timeout,
-			HealthyThreshold:   service.HealthCheck.HealthyThreshold,
-			UnhealthyThreshold: service.HealthCheck.UnhealthyThreshold,
-			Status:             service.HealthCheck.Status,
-		}
-		if !service.HealthCheck.LastCheck.IsZero() {
-			healthCheck.LastCheck = service.HealthCheck.LastCheck.Format("2006-01-02T15:04:05Z")
-		}
+	infos := []dto.DockerServiceInfo{}
+	for i := range services {
+		infos = append(infos, *toDockerServiceInfo(ctx, &services[i]))
 	}
 
-	return &dto.DockerServiceInfo{
-		ID:               service.ID,
-		InfrastructureID: service.InfrastructureID,
-		Name:             service.Name,
-		Image:            service.Image,
-		ImageTag:         service.ImageTag,
-		ServiceType:      service.ServiceType,
-		ContainerID:      service.ContainerID,
-		Status:           service.Status,
-		IPAddress:        service.IPAddress,
-		InternalEndpoint: service.InternalEndpoint,
-		EnvVars:          envVars,
-		Ports:            ports,
-		Networks:         networks,
-		HealthCheck:      healthCheck,
-		RestartPolicy:    service.RestartPolicy,
-		CPULimit:         service.CPULimit,
-		MemoryLimit:      service.MemoryLimit,
-		CreatedAt:        service.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		UpdatedAt:        service.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+	return &dto.DockerServiceListResponse{
+		Services:   infos,
+		TotalCount: int(total),
+		Page:       page,
+		PageSize:   pageSize,
 	}, nil
 }
 
-func (s *dockerServiceService) StartDockerService(ctx context.Context, serviceID string) error {
-	service, err := s.dockerRepo.FindByID(serviceID)
+// AuthorizeDockerService checks that the Docker service, looked up by service or infrastructure ID,
+// belongs to userID
+func (s *dockerServiceService) AuthorizeDockerService(ctx context.Context, userID, serviceID string) error {
+	service, err := s.findService(serviceID)
+	if err != nil {
+		return err
+	}
+	infra, err := s.infraRepo.FindByID(service.InfrastructureID)
 	if err != nil {
 		return err
 	}
+	if infra.UserID != userID {
+		return ErrDockerServiceForbidden
+	}
+	return nil
+}
 
-	if err := s.dockerSvc.StartContainer(ctx, service.ContainerID); err != nil {
+func (s *dockerServiceService) StartDockerService(ctx context.Context, serviceID string) error {
+	service, err := s.findService(serviceID)
+	if err != nil {
+		return err
+	}
+	if err := s.claimService(service.ID); err != nil {
 		return err
 	}
+	defer s.rollouts.Delete(service.ID)
+
+	for _, replica := range s.replicasOf(service) {
+		if err := s.dockerSvc.StartContainer(ctx, replica.ContainerID); err != nil {
+			return err
+		}
+		replica.Status = "running"
+		s.dockerRepo.UpdateReplica(&replica)
+	}
 
 	service.Status = "running"
 	return s.dockerRepo.Update(service)
 }
 
 func (s *dockerServiceService) StopDockerService(ctx context.Context, serviceID string) error {
-	service, err := s.dockerRepo.FindByID(serviceID)
+	service, err := s.findService(serviceID)
 	if err != nil {
 		return err
 	}
-
-	if err := s.dockerSvc.StopContainer(ctx, service.ContainerID); err != nil {
+	if err := s.claimService(service.ID); err != nil {
 		return err
 	}
+	defer s.rollouts.Delete(service.ID)
+
+	for _, replica := range s.replicasOf(service) {
+		if err := s.dockerSvc.StopContainer(ctx, replica.ContainerID); err != nil {
+			return err
+		}
+		replica.Status = "stopped"
+		s.dockerRepo.UpdateReplica(&replica)
+	}
 
 	service.Status = "stopped"
 	return s.dockerRepo.Update(service)
 }
 
 func (s *dockerServiceService) RestartDockerService(ctx context.Context, serviceID string) error {
-	service, err := s.dockerRepo.FindByID(serviceID)
+	service, err := s.findService(serviceID)
 	if err != nil {
 		return err
 	}
-
-	if err := s.dockerSvc.RestartContainer(ctx, service.ContainerID); err != nil {
+	if err := s.claimService(service.ID); err != nil {
 		return err
 	}
+	defer s.rollouts.Delete(service.ID)
+
+	for _, replica := range s.replicasOf(service) {
+		if err := s.dockerSvc.RestartContainer(ctx, replica.ContainerID); err != nil {
+			return err
+		}
+		replica.Status = "running"
+		s.dockerRepo.UpdateReplica(&replica)
+	}
 
 	service.Status = "running"
 	return s.dockerRepo.Update(service)
 }
 
 func (s *dockerServiceService) DeleteDockerService(ctx context.Context, serviceID string) error {
-	service, err := s.dockerRepo.FindByID(serviceID)
+	service, err := s.findService(serviceID)
 	if err != nil {
 		return err
 	}
+	if err := s.claimService(service.ID); err != nil {
+		return err
+	}
+	defer s.rollouts.Delete(service.ID)
 
-	if service.ContainerID != "" {
-		s.dockerSvc.StopContainer(ctx, service.ContainerID)
-		s.dockerSvc.RemoveContainer(ctx, service.ContainerID)
+	for _, replica := range s.replicasOf(service) {
+		s.dockerSvc.StopContainer(ctx, replica.ContainerID)
+		s.dockerSvc.RemoveContainer(ctx, replica.ContainerID)
 	}
+	s.dockerRepo.DeleteReplicasByServiceID(service.ID)
+	// Named volumes outlive the service, only its mounts go
+	s.dockerRepo.UpdateVolumeMounts(service.ID, nil)
 
-	if err := s.dockerRepo.Delete(serviceID); err != nil {
+	if err := s.dockerRepo.Delete(service.ID); err != nil {
 		return err
 	}
 
@@ -395,88 +465,242 @@ func (s *dockerServiceService) DeleteDockerService(ctx context.Context, serviceI
 	return nil
 }
 
+// UpdateEnvVars replaces the environment variables through a rolling update
 func (s *dockerServiceService) UpdateEnvVars(ctx context.Context, serviceID string, req dto.UpdateDockerEnvRequest) error {
-	service, err := s.dockerRepo.FindByID(serviceID)
+	envVars := req.EnvVars
+	if envVars == nil {
+		envVars = []dto.EnvVarInput{}
+	}
+	_, err := s.RollingUpdateDockerService(ctx, serviceID, dto.RollingUpdateDockerServiceRequest{EnvVars: envVars})
+	return err
+}
+
+func (s *dockerServiceService) GetServiceLogs(ctx context.Context, serviceID string, tail int) ([]string, error) {
+	service, err := s.findService(serviceID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	envVars := []entities.DockerEnvVar{}
-	for _, env := range req.EnvVars {
-		envVars = append(envVars, entities.DockerEnvVar{
-			ID:        uuid.New().String(),
-			ServiceID: serviceID,
-			Key:       env.Key,
-			Value:     env.Value,
-			IsSecret:  env.IsSecret,
-		})
+	replicas := s.replicasOf(service)
+	if len(replicas) == 0 {
+		return []string{}, nil
+	}
+	if len(replicas) == 1 {
+		return s.dockerSvc.GetContainerLogs(ctx, replicas[0].ContainerID, tail)
 	}
 
-	if err := s.dockerRepo.UpdateEnvVars(serviceID, envVars); err != nil {
-		return err
+	// Prefix lines with the replica they come from
+	logs := []string{}
+	for _, replica := range replicas {
+		lines, err := s.dockerSvc.GetContainerLogs(ctx, replica.ContainerID, tail)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range lines {
+			logs = append(logs, fmt.Sprintf("[%s] %s", replica.ContainerName, line))
+		}
 	}
+	return logs, nil
+}
 
-	if service.ContainerID != "" {
-		s.dockerSvc.StopContainer(ctx, service.ContainerID)
-		s.dockerSvc.RemoveContainer(ctx, service.ContainerID)
+func (s *dockerServiceService) findService(id string) (*entities.DockerService, error) {
+	return findDockerService(s.dockerRepo, id)
+}
 
-		envStrings := []string{}
-		for _, env := range req.EnvVars {
-			envStrings = append(envStrings, fmt.Sprintf("%s=%s", env.Key, env.Value))
-		}
+// findDockerService accepts either a Docker service ID or the ID of its infrastructure,
+// since stacks reference services by infrastructure ID
+func findDockerService(dockerRepo repositories.IDockerServiceRepository, id string) (*entities.DockerService, error) {
+	service, err := dockerRepo.FindByID(id)
+	if err == nil {
+		return service, nil
+	}
+	if byInfra, infraErr := dockerRepo.FindByInfrastructureID(id); infraErr == nil {
+		return byInfra, nil
+	}
+	return nil, err
+}
 
-		ports := map[string]string{}
-		for _, port := range service.Ports {
-			containerPortStr := fmt.Sprintf("%d", port.ContainerPort)
-			if port.HostPort > 0 {
-				ports[containerPortStr] = fmt.Sprintf("%d", port.HostPort)
-			}
-		}
+// dockerServiceContainerConfig builds the container spec of a Docker service from its stored definition
+func dockerServiceContainerConfig(service *entities.DockerService) docker.ContainerConfig {
+	containerName := service.ContainerName
+	if containerName == "" {
+		containerName = fmt.Sprintf("iaas-docker-%s", service.ID)
+	}
+	return dockerReplicaContainerConfig(service, containerName)
+}
+
+// dockerReplicaContainerConfig builds the spec of one replica; replicas share the service alias
+func dockerReplicaContainerConfig(service *entities.DockerService, containerName string) docker.ContainerConfig {
+	envVars := []string{}
+	for _, env := range service.EnvVars {
+		envVars = append(envVars, fmt.Sprintf("%s=%s", env.Key, env.Value))
+	}
 
-		containerConfig := docker.ContainerConfig{
-			Name:    service.ContainerName,
-			Image:   fmt.Sprintf("%s:%s", service.Image, service.ImageTag),
-			Env:     envStrings,
-			Ports:   ports,
-			Network: "iaas_iaas-network",
-			Resources: docker.ResourceConfig{
-				CPULimit:    service.CPULimit,
-				MemoryLimit: service.MemoryLimit,
-			},
+	ports := map[string]string{}
+	for _, port := range service.Ports {
+		if port.HostPort > 0 {
+			ports[fmt.Sprintf("%d", port.ContainerPort)] = fmt.Sprintf("%d", port.HostPort)
 		}
+	}
 
-		containerID, err := s.dockerSvc.CreateContainer(ctx, containerConfig)
-		if err != nil {
-			return err
+	volumes := map[string]string{}
+	for _, mount := range service.Volumes {
+		target := mount.Target
+		if mount.ReadOnly {
+			target += ":ro"
 		}
+		volumes[mount.Source] = target
+	}
 
-		service.ContainerID = containerID
-		s.dockerRepo.Update(service)
+	network := "iaas_iaas-network"
+	if len(service.Networks) > 0 {
+		network = service.Networks[0].NetworkID
+	}
 
-		if err := s.dockerSvc.StartContainer(ctx, containerID); err != nil {
-			return err
-		}
+	pullPolicy := service.PullPolicy
+	if service.ImageDigest != "" && pullPolicy == docker.PullAlways {
+		// A digest always names the same image, pulling it again cannot change it
+		pullPolicy = docker.PullIfNotPresent
 	}
 
-	return nil
+	config := docker.ContainerConfig{
+		Name:         containerName,
+		Image:        dockerImageRef(service),
+		PullPolicy:   pullPolicy,
+		Env:          envVars,
+		Ports:        ports,
+		Volumes:      volumes,
+		Network:      network,
+		NetworkAlias: service.ServiceAlias,
+		Resources: docker.ResourceConfig{
+			CPULimit:    service.CPULimit,
+			MemoryLimit: service.MemoryLimit,
+		},
+		HealthCheck: dockerHealthCheckConfig(service.HealthCheck),
+	}
+	if service.Command != "" {
+		config.Cmd = strings.Split(service.Command, " ")
+	}
+	return config
 }
 
-func (s *dockerServiceService) GetServiceLogs(ctx context.Context, serviceID string, tail int) ([]string, error) {
-	service, err := s.dockerRepo.FindByID(serviceID)
-	if err != nil {
-		return nil, err
+// dockerImageRef is the image replicas of service run: pinned to the recorded digest when there
+// is one, so a tag moved in the registry does not change what new replicas run
+func dockerImageRef(service *entities.DockerService) string {
+	if service.ImageDigest != "" {
+		return fmt.Sprintf("%s@%s", service.Image, service.ImageDigest)
 	}
+	return fmt.Sprintf("%s:%s", service.Image, service.ImageTag)
+}
 
-	if service.ContainerID == "" {
-		return []string{}, nil
+// toDockerServiceInfo converts a stored Docker service into its API representation, with
+// secret values masked unless ctx may reveal them
+func toDockerServiceInfo(ctx context.Context, service *entities.DockerService) *dto.DockerServiceInfo {
+	envVars := []dto.EnvVarInfo{}
+	for _, env := range service.EnvVars {
+		envInfo := dto.EnvVarInfo{
+			Key:      env.Key,
+			Value:    env.Value,
+			IsSecret: env.IsSecret,
+		}
+		if env.IsSecret {
+			envInfo.Value = revealSecret(ctx, env.Value)
+		}
+		envVars = append(envVars, envInfo)
 	}
 
-	logs, err := s.dockerSvc.GetContainerLogs(ctx, service.ContainerID, tail)
-	if err != nil {
-		return nil, err
+	ports := []dto.PortInfo{}
+	for _, port := range service.Ports {
+		ports = append(ports, dto.PortInfo{
+			ContainerPort: port.ContainerPort,
+			HostPort:      port.HostPort,
+			Protocol:      port.Protocol,
+		})
 	}
 
-	return logs, nil
+	networks := []dto.NetworkInfo{}
+	for _, network := range service.Networks {
+		networks = append(networks, dto.NetworkInfo{
+			NetworkID: network.NetworkID,
+			Alias:     network.Alias,
+		})
+	}
+
+	volumes := []dto.VolumeMountInfo{}
+	for _, mount := range service.Volumes {
+		volumes = append(volumes, dto.VolumeMountInfo{
+			ID:       mount.ID,
+			Type:     mount.Type,
+			VolumeID: mount.VolumeID,
+			Source:   mount.Source,
+			Target:   mount.Target,
+			ReadOnly: mount.ReadOnly,
+		})
+	}
+
+	var healthCheck *dto.HealthCheckInfo
+	if service.HealthCheck != nil {
+		healthCheck = &dto.HealthCheckInfo{
+			Type:               service.HealthCheck.Type,
+			HTTPPath:           service.HealthCheck.HTTPPath,
+			Port:               service.HealthCheck.Port,
+			Command:            service.HealthCheck.Command,
+			Interval:           service.HealthCheck.Interval,
+			Timeout:            service.HealthCheck.Timeout,
+			HealthyThreshold:   service.HealthCheck.HealthyThreshold,
+			UnhealthyThreshold: service.HealthCheck.UnhealthyThreshold,
+			Status:             service.HealthCheck.Status,
+		}
+		if !service.HealthCheck.LastCheck.IsZero() {
+			healthCheck.LastCheck = service.HealthCheck.LastCheck.Format("2006-01-02T15:04:05Z")
+		}
+	}
+
+	containers := []dto.ReplicaInfo{}
+	for _, replica := range dockerServiceReplicas(service) {
+		containers = append(containers, dto.ReplicaInfo{
+			ContainerID:   replica.ContainerID,
+			ContainerName: replica.ContainerName,
+			ImageTag:      replica.ImageTag,
+			Status:        replica.Status,
+			Health:        replica.Health,
+			IPAddress:     replica.IPAddress,
+			CreatedAt:     replica.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		})
+	}
+
+	return &dto.DockerServiceInfo{
+		ID:                   service.ID,
+		InfrastructureID:     service.InfrastructureID,
+		Name:                 service.Name,
+		Image:                service.Image,
+		ImageTag:             service.ImageTag,
+		ImageDigest:          service.ImageDigest,
+		PullPolicy:           service.PullPolicy,
+		ServiceType:          service.ServiceType,
+		ContainerID:          service.ContainerID,
+		Status:               service.Status,
+		IPAddress:            service.IPAddress,
+		InternalEndpoint:     service.InternalEndpoint,
+		EnvVars:              envVars,
+		Ports:                ports,
+		Networks:             networks,
+		Volumes:              volumes,
+		HealthCheck:          healthCheck,
+		RestartPolicy:        service.RestartPolicy,
+		RegistryCredentialID: service.RegistryCredentialID,
+		CPULimit:             service.CPULimit,
+		MemoryLimit:          service.MemoryLimit,
+		Replicas:             service.Replicas,
+		ServiceAlias:         service.ServiceAlias,
+		MaxSurge:             service.MaxSurge,
+		MaxUnavailable:       service.MaxUnavailable,
+		RolloutStatus:        service.RolloutStatus,
+		RolloutMessage:       service.RolloutMessage,
+		Containers:           containers,
+		CreatedAt:            service.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt:            service.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+	}
 }
 
 func (s *dockerServiceService) getPlanResources(plan string) (int64, int64) {
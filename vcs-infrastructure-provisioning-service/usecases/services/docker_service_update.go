@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/google/uuid"
+)
+
+// Strategies of an in-place Docker service update
+const (
+	DockerUpdateSurge   = "surge"   // new replicas start next to the previous ones
+	DockerUpdateReplace = "replace" // previous replicas stop first, they hold host ports the new ones need, and are removed once those are healthy
+)
+
+var (
+	// ErrDockerServiceUnchanged is returned when an update would not change the service
+	ErrDockerServiceUnchanged = errors.New("docker service already runs this spec")
+	// ErrInvalidDockerServiceUpdate is returned when the requested spec cannot be run
+	ErrInvalidDockerServiceUpdate = errors.New("invalid docker service update")
+)
+
+// planDockerServiceUpdate builds the spec service is updated to and lists what differs from the
+// current one. The update surges unless the new replicas publish a host port the current ones hold.
+func planDockerServiceUpdate(service *entities.DockerService, req dto.UpdateDockerServiceRequest, cpuLimit, memoryLimit int64) (*entities.DockerService, []dto.DockerServiceChange, string, error) {
+	next := *service
+	changes := []dto.DockerServiceChange{}
+	change := func(field, from, to string) {
+		if from != to {
+			changes = append(changes, dto.DockerServiceChange{Field: field, From: from, To: to})
+		}
+	}
+
+	if req.ImageTag != "" {
+		next.ImageTag = req.ImageTag
+		change("image_tag", service.ImageTag, next.ImageTag)
+	}
+	if req.Plan != "" {
+		next.CPULimit, next.MemoryLimit = cpuLimit, memoryLimit
+		change("cpu_limit", strconv.FormatInt(service.CPULimit, 10), strconv.FormatInt(next.CPULimit, 10))
+		change("memory_limit", strconv.FormatInt(service.MemoryLimit, 10), strconv.FormatInt(next.MemoryLimit, 10))
+	}
+	if req.Ports != nil {
+		next.Ports = []entities.DockerPort{}
+		for _, port := range *req.Ports {
+			dockerPort := entities.DockerPort{
+				ID:            uuid.New().String(),
+				ServiceID:     service.ID,
+				ContainerPort: port.ContainerPort,
+				HostPort:      port.HostPort,
+				Protocol:      port.Protocol,
+			}
+			if dockerPort.Protocol == "" {
+				dockerPort.Protocol = "tcp"
+			}
+			next.Ports = append(next.Ports, dockerPort)
+		}
+		change("ports", formatDockerPorts(service.Ports), formatDockerPorts(next.Ports))
+		if publishesHostPorts(next.Ports) && service.Replicas > 1 {
+			return nil, nil, "", fmt.Errorf("%w: replicated services cannot publish host ports, reach them through the service alias", ErrInvalidDockerServiceUpdate)
+		}
+	}
+	if req.Command != nil {
+		next.Command = strings.TrimSpace(*req.Command)
+		change("command", service.Command, next.Command)
+	}
+	if len(changes) == 0 {
+		return nil, nil, "", ErrDockerServiceUnchanged
+	}
+
+	// Re-resolve the tag when it changes, the digest pins the previous one
+	if next.ImageTag != service.ImageTag {
+		next.ImageDigest = ""
+	}
+
+	strategy := DockerUpdateSurge
+	next.MaxSurge, next.MaxUnavailable = max(service.MaxSurge, 1), 0
+	if sharesHostPort(service.Ports, next.Ports) {
+		strategy = DockerUpdateReplace
+		next.MaxSurge, next.MaxUnavailable = 0, 1
+	}
+	return &next, changes, strategy, nil
+}
+
+// sharesHostPort reports whether both port lists publish the same host port and protocol
+func sharesHostPort(current, next []entities.DockerPort) bool {
+	held := map[string]bool{}
+	for _, port := range current {
+		if port.HostPort > 0 {
+			held[fmt.Sprintf("%d/%s", port.HostPort, port.Protocol)] = true
+		}
+	}
+	for _, port := range next {
+		if port.HostPort > 0 && held[fmt.Sprintf("%d/%s", port.HostPort, port.Protocol)] {
+			return true
+		}
+	}
+	return false
+}
+
+// formatDockerPorts renders ports as "host:container/protocol", or "container/protocol" for
+// ports only reachable inside the network
+func formatDockerPorts(ports []entities.DockerPort) string {
+	parts := []string{}
+	for _, port := range ports {
+		part := fmt.Sprintf("%d/%s", port.ContainerPort, port.Protocol)
+		if port.HostPort > 0 {
+			part = fmt.Sprintf("%d:%s", port.HostPort, part)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ",")
+}
+
+// UpdateDockerService recreates the replicas with a new image tag, plan, ports or command in the
+// background, keeping the service and infrastructure IDs. Previous replicas keep serving until the
+// new ones pass their health check, except those holding a host port the new ones publish: they
+// are stopped first, removed once the new ones are healthy and started again if they are not.
+func (s *dockerServiceService) UpdateDockerService(ctx context.Context, serviceID string, req dto.UpdateDockerServiceRequest) (*dto.UpdateDockerServiceResponse, error) {
+	service, err := s.findService(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	cpuLimit, memoryLimit := s.getPlanResources(req.Plan)
+	next, changes, strategy, err := planDockerServiceUpdate(service, req, cpuLimit, memoryLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []string{}
+	for _, change := range changes {
+		fields = append(fields, change.Field)
+	}
+	info, err := s.startRollout(ctx, service, next, dockerSpecChange{spec: true, ports: req.Ports != nil},
+		fmt.Sprintf("updating %s (%s)", strings.Join(fields, ", "), strategy))
+	if err != nil {
+		return nil, err
+	}
+	return &dto.UpdateDockerServiceResponse{Service: info, Strategy: strategy, Changes: changes}, nil
+}
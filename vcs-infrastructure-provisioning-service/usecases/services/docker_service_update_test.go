@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanDockerServiceUpdate(t *testing.T) {
+	service := &entities.DockerService{
+		ID:          "svc-1",
+		Image:       "nginx",
+		ImageTag:    "1.25",
+		ImageDigest: "sha256:abc",
+		Command:     "nginx -g daemon off;",
+		CPULimit:    1000000000,
+		MemoryLimit: 1073741824,
+		Replicas:    1,
+		MaxSurge:    0,
+		Ports:       []entities.DockerPort{{ContainerPort: 80, HostPort: 8080, Protocol: "tcp"}},
+	}
+
+	_, _, _, err := planDockerServiceUpdate(service, dto.UpdateDockerServiceRequest{ImageTag: "1.25"}, 0, 0)
+	assert.ErrorIs(t, err, ErrDockerServiceUnchanged)
+
+	// A new tag drops the pinned digest; the current container holds host port 8080 and stops first
+	next, changes, strategy, err := planDockerServiceUpdate(service, dto.UpdateDockerServiceRequest{ImageTag: "1.27", Plan: "small"}, 500000000, 536870912)
+	assert.NoError(t, err)
+	assert.Equal(t, DockerUpdateReplace, strategy)
+	assert.Equal(t, 0, next.MaxSurge)
+	assert.Equal(t, 1, next.MaxUnavailable)
+	assert.Empty(t, next.ImageDigest)
+	assert.Equal(t, []dto.DockerServiceChange{
+		{Field: "image_tag", From: "1.25", To: "1.27"},
+		{Field: "cpu_limit", From: "1000000000", To: "500000000"},
+		{Field: "memory_limit", From: "1073741824", To: "536870912"},
+	}, changes)
+	assert.Equal(t, "1.25", service.ImageTag)
+
+	ports := []dto.PortInput{{ContainerPort: 8000, HostPort: 8080}}
+	next, changes, strategy, err = planDockerServiceUpdate(service, dto.UpdateDockerServiceRequest{Ports: &ports}, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, DockerUpdateReplace, strategy)
+	assert.Equal(t, 0, next.MaxSurge)
+	assert.Equal(t, 1, next.MaxUnavailable)
+	assert.Equal(t, "sha256:abc", next.ImageDigest)
+	assert.Equal(t, []dto.DockerServiceChange{{Field: "ports", From: "8080:80/tcp", To: "8080:8000/tcp"}}, changes)
+
+	// Moving to host port 9090 lets the new container start next to the current one
+	command := ""
+	ports = []dto.PortInput{{ContainerPort: 80, HostPort: 9090, Protocol: "tcp"}, {ContainerPort: 9100}}
+	next, changes, strategy, err = planDockerServiceUpdate(service, dto.UpdateDockerServiceRequest{Ports: &ports, Command: &command}, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, DockerUpdateSurge, strategy)
+	assert.Equal(t, 1, next.MaxSurge)
+	assert.Equal(t, 0, next.MaxUnavailable)
+	assert.Empty(t, next.Command)
+	assert.Equal(t, "svc-1", next.Ports[1].ServiceID)
+	assert.Equal(t, []dto.DockerServiceChange{
+		{Field: "ports", From: "8080:80/tcp", To: "9090:80/tcp,9100/tcp"},
+		{Field: "command", From: "nginx -g daemon off;", To: ""},
+	}, changes)
+
+	replicated := *service
+	replicated.Replicas = 3
+	_, _, _, err = planDockerServiceUpdate(&replicated, dto.UpdateDockerServiceRequest{Ports: &ports}, 0, 0)
+	assert.ErrorIs(t, err, ErrInvalidDockerServiceUpdate)
+}
+
+// hostPortDocker runs containers that all publish the same host port, so only one of them can
+// be running at a time. Images with "bad" in their reference turn unhealthy.
+type hostPortDocker struct {
+	docker.IDockerService
+
+	mu      sync.Mutex
+	next    int
+	images  map[string]string
+	running map[string]bool
+	removed map[string]bool
+}
+
+func newHostPortDocker() *hostPortDocker {
+	return &hostPortDocker{images: map[string]string{}, running: map[string]bool{}, removed: map[string]bool{}}
+}
+
+func (d *hostPortDocker) CreateContainer(ctx context.Context, config docker.ContainerConfig) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.next++
+	id := fmt.Sprintf("new-%d", d.next)
+	d.images[id] = config.Image
+	return id, nil
+}
+
+func (d *hostPortDocker) StartContainer(ctx context.Context, containerID string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, running := range d.running {
+		if running && id != containerID {
+			return fmt.Errorf("host port 8080 is held by %s", id)
+		}
+	}
+	if d.removed[containerID] {
+		return fmt.Errorf("container %s was removed", containerID)
+	}
+	d.running[containerID] = true
+	return nil
+}
+
+func (d *hostPortDocker) StopContainer(ctx context.Context, containerID string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.running[containerID] = false
+	return nil
+}
+
+func (d *hostPortDocker) RemoveContainer(ctx context.Context, containerID string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.running[containerID] = false
+	d.removed[containerID] = true
+	return nil
+}
+
+func (d *hostPortDocker) InspectContainer(ctx context.Context, containerID string) (*types.ContainerJSON, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	health := entities.DockerHealthHealthy
+	if strings.Contains(d.images[containerID], "bad") {
+		health = entities.DockerHealthUnhealthy
+	}
+	return &types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{State: &types.ContainerState{
+			Running: d.running[containerID],
+			Health:  &types.Health{Status: health},
+		}},
+		NetworkSettings: &types.NetworkSettings{DefaultNetworkSettings: types.DefaultNetworkSettings{IPAddress: "172.20.0.9"}},
+	}, nil
+}
+
+// memoryReplicaRepo keeps the replicas of a service in memory; other calls panic
+type memoryReplicaRepo struct {
+	repositories.IDockerServiceRepository
+	replicas map[string]entities.DockerServiceReplica
+}
+
+func (r *memoryReplicaRepo) Update(*entities.DockerService) error { return nil }
+
+func (r *memoryReplicaRepo) CreateReplica(replica *entities.DockerServiceReplica) error {
+	r.replicas[replica.ID] = *replica
+	return nil
+}
+
+func (r *memoryReplicaRepo) UpdateReplica(replica *entities.DockerServiceReplica) error {
+	r.replicas[replica.ID] = *replica
+	return nil
+}
+
+func (r *memoryReplicaRepo) DeleteReplica(id string) error {
+	delete(r.replicas, id)
+	return nil
+}
+
+// newHostPortRollout returns a single replica service holding host port 8080 and the spec
+// an update to tag moves it to
+func newHostPortRollout(tag string) (*dockerServiceService, *hostPortDocker, *memoryReplicaRepo, *entities.DockerService, *entities.DockerService) {
+	dockerSvc := newHostPortDocker()
+	dockerSvc.images["old-1"] = "nginx@sha256:old"
+	dockerSvc.running["old-1"] = true
+	original := entities.DockerServiceReplica{ID: "r-old", ServiceID: "svc-1", ContainerID: "old-1", ContainerName: "api-old", ImageTag: "1.25", Status: "running"}
+	repo := &memoryReplicaRepo{replicas: map[string]entities.DockerServiceReplica{original.ID: original}}
+
+	service := &entities.DockerService{
+		ID: "svc-1", Image: "nginx", ImageTag: "1.25", ImageDigest: "sha256:old", Replicas: 1, MaxSurge: 1,
+		Ports:      []entities.DockerPort{{ContainerPort: 80, HostPort: 8080, Protocol: "tcp"}},
+		Containers: []entities.DockerServiceReplica{original},
+	}
+	next, _, _, _ := planDockerServiceUpdate(service, dto.UpdateDockerServiceRequest{ImageTag: tag}, 0, 0)
+	next.ImageDigest = "sha256:" + tag
+	svc := &dockerServiceService{dockerRepo: repo, dockerSvc: dockerSvc}
+	return svc, dockerSvc, repo, service, next
+}
+
+func TestReplaceRolloutRemovesOldContainerOnceHealthy(t *testing.T) {
+	svc, dockerSvc, repo, service, next := newHostPortRollout("1.27")
+
+	svc.runRollout(context.Background(), service, next, dockerSpecChange{spec: true})
+	assert.Equal(t, entities.DockerRolloutCompleted, service.RolloutStatus, service.RolloutMessage)
+	assert.True(t, dockerSvc.removed["old-1"])
+	require.Len(t, service.Containers, 1)
+	assert.Equal(t, "new-1", service.ContainerID)
+	assert.True(t, dockerSvc.running["new-1"])
+	assert.NotContains(t, repo.replicas, "r-old")
+}
+
+func TestReplaceRolloutRestartsOriginalContainer(t *testing.T) {
+	svc, dockerSvc, repo, service, next := newHostPortRollout("bad")
+
+	svc.runRollout(context.Background(), service, next, dockerSpecChange{spec: true})
+	assert.Equal(t, entities.DockerRolloutRolledBack, service.RolloutStatus, service.RolloutMessage)
+
+	// The original container is started again rather than replaced by a fresh one
+	assert.False(t, dockerSvc.removed["old-1"])
+	assert.True(t, dockerSvc.running["old-1"])
+	assert.True(t, dockerSvc.removed["new-1"])
+	assert.Equal(t, 1, dockerSvc.next)
+	require.Len(t, service.Containers, 1)
+	assert.Equal(t, "old-1", service.ContainerID)
+	assert.Equal(t, "running", repo.replicas["r-old"].Status)
+}
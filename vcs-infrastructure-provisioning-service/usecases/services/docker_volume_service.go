@@ -0,0 +1,494 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	dockerBindRoot            = "/var/lib/iaas/binds"   // host directory holding a directory of bind mounts per user
+	dockerVolumeSnapshotStore = "iaas-volume-snapshots" // Docker volume holding the snapshot archives
+	dockerVolumeHelperImage   = "alpine:3.20"
+	dockerVolumeHelperTimeout = 30 * time.Minute
+)
+
+var (
+	ErrDockerVolumeNotFound      = errors.New("docker volume not found")
+	ErrDockerVolumeExists        = errors.New("docker volume with this name already exists")
+	ErrDockerVolumeInUse         = errors.New("docker volume is mounted by docker services")
+	ErrDockerSnapshotNotFound    = errors.New("volume snapshot not found")
+	ErrDockerVolumeMountNotFound = errors.New("volume mount not found")
+	ErrInvalidVolumeMount        = errors.New("invalid volume mount")
+)
+
+// bindSourcePattern limits bind mounts to one directory level below the user's bind root. No
+// container mounts the user directory itself, so none can plant a symlink that a later bind
+// source would follow out of the root.
+var bindSourcePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,99}$`)
+
+// reservedMountTargets cannot be mounted over, nor anything below them
+var reservedMountTargets = []string{"/proc", "/sys", "/dev"}
+
+// IDockerVolumeService manages the named volumes of users and their snapshots
+type IDockerVolumeService interface {
+	CreateVolume(ctx context.Context, userID string, req dto.CreateDockerVolumeRequest) (*dto.DockerVolumeInfo, error)
+	ListVolumes(ctx context.Context, userID string) ([]dto.DockerVolumeInfo, error)
+	GetVolume(ctx context.Context, userID, ref string) (*dto.DockerVolumeInfo, error)
+	DeleteVolume(ctx context.Context, userID, ref string) error
+	CreateSnapshot(ctx context.Context, userID, ref string, req dto.CreateVolumeSnapshotRequest) (*dto.DockerVolumeSnapshotInfo, error)
+	ListSnapshots(ctx context.Context, userID, ref string) ([]dto.DockerVolumeSnapshotInfo, error)
+	RestoreSnapshot(ctx context.Context, userID, ref, snapshotID string) (*dto.DockerVolumeSnapshotInfo, error)
+	DeleteSnapshot(ctx context.Context, userID, ref, snapshotID string) error
+}
+
+type dockerVolumeService struct {
+	volumeRepo repositories.IDockerVolumeRepository
+	dockerRepo repositories.IDockerServiceRepository
+	dockerSvc  docker.IDockerService
+	logger     logger.ILogger
+}
+
+func NewDockerVolumeService(
+	volumeRepo repositories.IDockerVolumeRepository,
+	dockerRepo repositories.IDockerServiceRepository,
+	dockerSvc docker.IDockerService,
+	logger logger.ILogger,
+) IDockerVolumeService {
+	return &dockerVolumeService{
+		volumeRepo: volumeRepo,
+		dockerRepo: dockerRepo,
+		dockerSvc:  dockerSvc,
+		logger:     logger,
+	}
+}
+
+func (s *dockerVolumeService) CreateVolume(ctx context.Context, userID string, req dto.CreateDockerVolumeRequest) (*dto.DockerVolumeInfo, error) {
+	if _, err := s.volumeRepo.FindByUserAndName(userID, req.Name); err == nil {
+		return nil, ErrDockerVolumeExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	volume, err := createDockerVolume(ctx, s.volumeRepo, s.dockerSvc, userID, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return toDockerVolumeInfo(volume, nil), nil
+}
+
+// ListVolumes lists the volumes of a user with their size and the services mounting them
+func (s *dockerVolumeService) ListVolumes(ctx context.Context, userID string) ([]dto.DockerVolumeInfo, error) {
+	volumes, err := s.volumeRepo.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	s.refreshSizes(ctx, volumes)
+
+	infos := make([]dto.DockerVolumeInfo, 0, len(volumes))
+	for i := range volumes {
+		mounts, err := s.volumeRepo.ListMounts(volumes[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, *toDockerVolumeInfo(&volumes[i], mounts))
+	}
+	return infos, nil
+}
+
+// GetVolume returns a volume with its size, attachments and snapshots
+func (s *dockerVolumeService) GetVolume(ctx context.Context, userID, ref string) (*dto.DockerVolumeInfo, error) {
+	volume, err := resolveDockerVolume(s.volumeRepo, userID, ref)
+	if err != nil {
+		return nil, err
+	}
+	volumes := []entities.DockerVolume{*volume}
+	s.refreshSizes(ctx, volumes)
+
+	mounts, err := s.volumeRepo.ListMounts(volume.ID)
+	if err != nil {
+		return nil, err
+	}
+	info := toDockerVolumeInfo(&volumes[0], mounts)
+	if info.Snapshots, err = s.ListSnapshots(ctx, userID, volume.ID); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// DeleteVolume removes a volume no Docker service mounts anymore, with its snapshots
+func (s *dockerVolumeService) DeleteVolume(ctx context.Context, userID, ref string) error {
+	volume, err := resolveDockerVolume(s.volumeRepo, userID, ref)
+	if err != nil {
+		return err
+	}
+	mounts, err := s.volumeRepo.ListMounts(volume.ID)
+	if err != nil {
+		return err
+	}
+	if len(mounts) > 0 {
+		return fmt.Errorf("%w: detach it from %d service(s) first", ErrDockerVolumeInUse, len(mounts))
+	}
+
+	snapshots, err := s.volumeRepo.ListSnapshots(volume.ID)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) > 0 {
+		archives := []string{}
+		for _, snapshot := range snapshots {
+			archives = append(archives, shellQuote("/snapshots/"+snapshot.Archive))
+		}
+		if _, err := s.runHelper(ctx, "delete-"+volume.ID, map[string]string{dockerVolumeSnapshotStore: "/snapshots"},
+			"rm -f "+strings.Join(archives, " ")); err != nil {
+			return fmt.Errorf("failed to delete snapshots of volume %s: %w", volume.Name, err)
+		}
+	}
+
+	if err := s.dockerSvc.RemoveVolume(ctx, volume.DockerName); err != nil && !strings.Contains(strings.ToLower(err.Error()), "no such volume") {
+		return err
+	}
+	return s.volumeRepo.Delete(volume.ID)
+}
+
+// CreateSnapshot archives the content of a volume into the snapshot store. Services may keep
+// writing to it meanwhile; stop them first for a consistent copy.
+func (s *dockerVolumeService) CreateSnapshot(ctx context.Context, userID, ref string, req dto.CreateVolumeSnapshotRequest) (*dto.DockerVolumeSnapshotInfo, error) {
+	volume, err := resolveDockerVolume(s.volumeRepo, userID, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &entities.DockerVolumeSnapshot{
+		ID:       uuid.New().String(),
+		VolumeID: volume.ID,
+		Name:     req.Name,
+		Status:   entities.DockerSnapshotCreating,
+	}
+	snapshot.Archive = snapshot.ID + ".tar.gz"
+	if snapshot.Name == "" {
+		snapshot.Name = fmt.Sprintf("%s-%s", volume.Name, time.Now().UTC().Format("20060102-150405"))
+	}
+	if err := s.volumeRepo.CreateSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+
+	archive := shellQuote("/snapshots/" + snapshot.Archive)
+	output, err := s.runHelper(ctx, "snapshot-"+snapshot.ID,
+		map[string]string{volume.DockerName: "/volume:ro", dockerVolumeSnapshotStore: "/snapshots"},
+		fmt.Sprintf("tar czf %s -C /volume . && stat -c %%s %s", archive, archive))
+	if err == nil {
+		snapshot.SizeBytes, err = lastLineInt(output)
+	}
+	if err != nil {
+		snapshot.Status = entities.DockerSnapshotFailed
+		snapshot.Error = err.Error()
+		s.volumeRepo.UpdateSnapshot(snapshot)
+		s.logger.Error("volume snapshot failed", zap.String("volume_id", volume.ID), zap.String("snapshot_id", snapshot.ID), zap.Error(err))
+		return nil, err
+	}
+
+	snapshot.Status = entities.DockerSnapshotReady
+	if err := s.volumeRepo.UpdateSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+	s.logger.Info("volume snapshot created", zap.String("volume_id", volume.ID), zap.String("snapshot_id", snapshot.ID), zap.Int64("size_bytes", snapshot.SizeBytes))
+	return toDockerVolumeSnapshotInfo(snapshot), nil
+}
+
+func (s *dockerVolumeService) ListSnapshots(ctx context.Context, userID, ref string) ([]dto.DockerVolumeSnapshotInfo, error) {
+	volume, err := resolveDockerVolume(s.volumeRepo, userID, ref)
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := s.volumeRepo.ListSnapshots(volume.ID)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]dto.DockerVolumeSnapshotInfo, 0, len(snapshots))
+	for i := range snapshots {
+		infos = append(infos, *toDockerVolumeSnapshotInfo(&snapshots[i]))
+	}
+	return infos, nil
+}
+
+// RestoreSnapshot replaces the content of a volume with a snapshot. Every service mounting
+// the volume must be stopped so none sees the volume half restored.
+func (s *dockerVolumeService) RestoreSnapshot(ctx context.Context, userID, ref, snapshotID string) (*dto.DockerVolumeSnapshotInfo, error) {
+	volume, err := resolveDockerVolume(s.volumeRepo, userID, ref)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := s.findSnapshot(volume.ID, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.Status != entities.DockerSnapshotReady {
+		return nil, fmt.Errorf("snapshot %s is %s, only ready snapshots can be restored", snapshot.ID, snapshot.Status)
+	}
+
+	mounts, err := s.volumeRepo.ListMounts(volume.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, mount := range mounts {
+		service, err := s.dockerRepo.FindByID(mount.ServiceID)
+		if err == nil && service.Status != "stopped" {
+			return nil, fmt.Errorf("%w: stop docker service %s before restoring", ErrDockerVolumeInUse, service.Name)
+		}
+	}
+
+	archive := shellQuote("/snapshots/" + snapshot.Archive)
+	if _, err := s.runHelper(ctx, "restore-"+snapshot.ID,
+		map[string]string{volume.DockerName: "/volume", dockerVolumeSnapshotStore: "/snapshots:ro"},
+		fmt.Sprintf("test -f %s && find /volume -mindepth 1 -delete && tar xzf %s -C /volume", archive, archive)); err != nil {
+		s.logger.Error("volume restore failed", zap.String("volume_id", volume.ID), zap.String("snapshot_id", snapshot.ID), zap.Error(err))
+		return nil, err
+	}
+
+	snapshot.RestoredAt = time.Now()
+	s.volumeRepo.UpdateSnapshot(snapshot)
+	s.logger.Info("volume restored from snapshot", zap.String("volume_id", volume.ID), zap.String("snapshot_id", snapshot.ID))
+	return toDockerVolumeSnapshotInfo(snapshot), nil
+}
+
+func (s *dockerVolumeService) DeleteSnapshot(ctx context.Context, userID, ref, snapshotID string) error {
+	volume, err := resolveDockerVolume(s.volumeRepo, userID, ref)
+	if err != nil {
+		return err
+	}
+	snapshot, err := s.findSnapshot(volume.ID, snapshotID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.runHelper(ctx, "delete-"+snapshot.ID, map[string]string{dockerVolumeSnapshotStore: "/snapshots"},
+		"rm -f "+shellQuote("/snapshots/"+snapshot.Archive)); err != nil {
+		return err
+	}
+	return s.volumeRepo.DeleteSnapshot(snapshot.ID)
+}
+
+func (s *dockerVolumeService) findSnapshot(volumeID, snapshotID string) (*entities.DockerVolumeSnapshot, error) {
+	snapshot, err := s.volumeRepo.FindSnapshot(volumeID, snapshotID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDockerSnapshotNotFound
+	}
+	return snapshot, err
+}
+
+// runHelper runs script in a throwaway container with volumes mounted. It is not cancelled
+// with ctx, so an archive is never left half written because a client went away.
+func (s *dockerVolumeService) runHelper(ctx context.Context, name string, volumes map[string]string, script string) (string, error) {
+	if err := s.dockerSvc.CreateVolume(ctx, dockerVolumeSnapshotStore); err != nil {
+		return "", err
+	}
+	helperCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), dockerVolumeHelperTimeout)
+	defer cancel()
+	return s.dockerSvc.RunContainer(helperCtx, docker.ContainerConfig{
+		Name:    "iaas-volume-" + name,
+		Image:   dockerVolumeHelperImage,
+		Cmd:     []string{"sh", "-c", script},
+		Volumes: volumes,
+	})
+}
+
+// refreshSizes records the sizes Docker currently reports for volumes
+func (s *dockerVolumeService) refreshSizes(ctx context.Context, volumes []entities.DockerVolume) {
+	if len(volumes) == 0 {
+		return
+	}
+	sizes, err := s.dockerSvc.VolumeSizes(ctx)
+	if err != nil {
+		s.logger.Warn("failed to read docker volume sizes", zap.Error(err))
+		return
+	}
+	now := time.Now()
+	for i := range volumes {
+		if size, ok := sizes[volumes[i].DockerName]; ok {
+			volumes[i].SizeBytes, volumes[i].SizeCheckedAt = size, now
+			s.volumeRepo.Update(&volumes[i])
+		}
+	}
+}
+
+// resolveDockerVolume finds a volume of userID by ID or by name. Volumes of other users are
+// reported as not found.
+func resolveDockerVolume(volumeRepo repositories.IDockerVolumeRepository, userID, ref string) (*entities.DockerVolume, error) {
+	volume, err := volumeRepo.FindByID(ref)
+	if err == nil && volume.UserID == userID {
+		return volume, nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	volume, err = volumeRepo.FindByUserAndName(userID, ref)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrDockerVolumeNotFound, ref)
+	}
+	return volume, err
+}
+
+func createDockerVolume(ctx context.Context, volumeRepo repositories.IDockerVolumeRepository, dockerSvc docker.IDockerService, userID, name string) (*entities.DockerVolume, error) {
+	id := uuid.New().String()
+	volume := &entities.DockerVolume{
+		ID:         id,
+		UserID:     userID,
+		Name:       name,
+		DockerName: "iaas-vol-" + id,
+		Driver:     "local",
+		SizeBytes:  -1,
+	}
+	if err := dockerSvc.CreateVolume(ctx, volume.DockerName); err != nil {
+		return nil, err
+	}
+	if err := volumeRepo.Create(volume); err != nil {
+		dockerSvc.RemoveVolume(ctx, volume.DockerName)
+		return nil, err
+	}
+	return volume, nil
+}
+
+// dockerVolumeMount validates a mount requested for a Docker service of userID and resolves its
+// source. A volume named but not found is created.
+func dockerVolumeMount(ctx context.Context, volumeRepo repositories.IDockerVolumeRepository, dockerSvc docker.IDockerService, userID string, input dto.VolumeMountInput) (*entities.DockerVolumeMount, error) {
+	target, err := validateMountTarget(input.Target)
+	if err != nil {
+		return nil, err
+	}
+	mount := &entities.DockerVolumeMount{
+		ID:       uuid.New().String(),
+		Type:     input.Type,
+		Target:   target,
+		ReadOnly: input.ReadOnly,
+	}
+	if mount.Type == "" {
+		mount.Type = entities.DockerMountVolume
+	}
+
+	switch mount.Type {
+	case entities.DockerMountVolume:
+		if input.Volume == "" {
+			return nil, fmt.Errorf("%w: volume mounts need a volume", ErrInvalidVolumeMount)
+		}
+		volume, err := resolveDockerVolume(volumeRepo, userID, input.Volume)
+		if errors.Is(err, ErrDockerVolumeNotFound) {
+			volume, err = createDockerVolume(ctx, volumeRepo, dockerSvc, userID, input.Volume)
+		}
+		if err != nil {
+			return nil, err
+		}
+		mount.VolumeID, mount.Source = volume.ID, volume.DockerName
+
+	case entities.DockerMountBind:
+		if mount.Source, err = bindMountSource(userID, input.Source); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("%w: unknown mount type %q, use volume or bind", ErrInvalidVolumeMount, mount.Type)
+	}
+	return mount, nil
+}
+
+// validateMountTarget requires an absolute container path outside the kernel filesystems
+func validateMountTarget(target string) (string, error) {
+	if !path.IsAbs(target) {
+		return "", fmt.Errorf("%w: mount target %q must be an absolute path", ErrInvalidVolumeMount, target)
+	}
+	target = path.Clean(target)
+	if target == "/" || strings.ContainsAny(target, ":,") {
+		return "", fmt.Errorf("%w: mount target %q is not allowed", ErrInvalidVolumeMount, target)
+	}
+	for _, reserved := range reservedMountTargets {
+		if target == reserved || strings.HasPrefix(target, reserved+"/") {
+			return "", fmt.Errorf("%w: mount target %q is not allowed", ErrInvalidVolumeMount, target)
+		}
+	}
+	return target, nil
+}
+
+// bindMountSource returns the host directory of a bind mount: a single directory name under the
+// bind root of userID, so binds never reach the Docker socket, host files or other users' data
+func bindMountSource(userID, source string) (string, error) {
+	if !bindSourcePattern.MatchString(source) || source == "." || source == ".." {
+		return "", fmt.Errorf("%w: bind source %q must be a directory name of letters, digits, '.', '_' or '-'", ErrInvalidVolumeMount, source)
+	}
+	if userID == "" || !bindSourcePattern.MatchString(userID) {
+		return "", fmt.Errorf("%w: bind mounts need an authenticated user", ErrInvalidVolumeMount)
+	}
+	return path.Join(dockerBindRoot, userID, source), nil
+}
+
+// validateServiceMounts rejects mounts sharing a source or a target, which Docker cannot apply
+func validateServiceMounts(mounts []entities.DockerVolumeMount) error {
+	sources, targets := map[string]bool{}, map[string]bool{}
+	for _, mount := range mounts {
+		if sources[mount.Source] {
+			return fmt.Errorf("%w: %s is mounted twice", ErrInvalidVolumeMount, mount.Source)
+		}
+		if targets[mount.Target] {
+			return fmt.Errorf("%w: two mounts target %s", ErrInvalidVolumeMount, mount.Target)
+		}
+		sources[mount.Source], targets[mount.Target] = true, true
+	}
+	return nil
+}
+
+func lastLineInt(output string) (int64, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strconv.ParseInt(strings.TrimSpace(lines[len(lines)-1]), 10, 64)
+}
+
+func toDockerVolumeInfo(volume *entities.DockerVolume, mounts []entities.DockerVolumeMount) *dto.DockerVolumeInfo {
+	info := &dto.DockerVolumeInfo{
+		ID:          volume.ID,
+		Name:        volume.Name,
+		DockerName:  volume.DockerName,
+		Driver:      volume.Driver,
+		SizeBytes:   volume.SizeBytes,
+		Orphaned:    len(mounts) == 0,
+		Attachments: []dto.DockerVolumeAttachment{},
+		CreatedAt:   volume.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if !volume.SizeCheckedAt.IsZero() {
+		info.SizeCheckedAt = volume.SizeCheckedAt.Format("2006-01-02T15:04:05Z")
+	}
+	for _, mount := range mounts {
+		info.Attachments = append(info.Attachments, dto.DockerVolumeAttachment{
+			ServiceID: mount.ServiceID,
+			MountID:   mount.ID,
+			Target:    mount.Target,
+			ReadOnly:  mount.ReadOnly,
+		})
+	}
+	return info
+}
+
+func toDockerVolumeSnapshotInfo(snapshot *entities.DockerVolumeSnapshot) *dto.DockerVolumeSnapshotInfo {
+	info := &dto.DockerVolumeSnapshotInfo{
+		ID:        snapshot.ID,
+		VolumeID:  snapshot.VolumeID,
+		Name:      snapshot.Name,
+		Status:    snapshot.Status,
+		Error:     snapshot.Error,
+		SizeBytes: snapshot.SizeBytes,
+		CreatedAt: snapshot.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if !snapshot.RestoredAt.IsZero() {
+		info.RestoredAt = snapshot.RestoredAt.Format("2006-01-02T15:04:05Z")
+	}
+	return info
+}
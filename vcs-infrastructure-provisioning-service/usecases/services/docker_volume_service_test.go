@@ -0,0 +1,71 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMountTarget(t *testing.T) {
+	target, err := validateMountTarget("/var/lib/app/../data/")
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/lib/data", target)
+
+	for _, bad := range []string{"data", "", "/", "/proc", "/sys/fs", "/dev/shm", "/data:rw", "/a,b"} {
+		_, err := validateMountTarget(bad)
+		assert.Error(t, err, bad)
+	}
+	_, err = validateMountTarget("/devices")
+	assert.NoError(t, err)
+}
+
+func TestBindMountSource(t *testing.T) {
+	source, err := bindMountSource("user-1", "uploads")
+	assert.NoError(t, err)
+	assert.Equal(t, dockerBindRoot+"/user-1/uploads", source)
+
+	for _, bad := range []string{"", ".", "..", "../other", "/etc", "a/b", "uploads:ro", ".hidden", "var/run/docker.sock"} {
+		_, err := bindMountSource("user-1", bad)
+		assert.Error(t, err, bad)
+	}
+	_, err = bindMountSource("../root", "uploads")
+	assert.Error(t, err)
+	_, err = bindMountSource("", "uploads")
+	assert.Error(t, err)
+}
+
+func TestValidateServiceMounts(t *testing.T) {
+	mounts := []entities.DockerVolumeMount{
+		{Source: "iaas-vol-1", Target: "/data"},
+		{Source: dockerBindRoot + "/user-1/uploads", Target: "/uploads"},
+	}
+	assert.NoError(t, validateServiceMounts(mounts))
+	assert.Error(t, validateServiceMounts(append(mounts, entities.DockerVolumeMount{Source: "iaas-vol-1", Target: "/backup"})))
+	assert.ErrorIs(t, validateServiceMounts(append(mounts, entities.DockerVolumeMount{Source: "iaas-vol-2", Target: "/data"})), ErrInvalidVolumeMount)
+}
+
+func TestDockerReplicaContainerConfigVolumes(t *testing.T) {
+	service := &entities.DockerService{
+		ID: "svc-1", Image: "postgres", ImageTag: "16",
+		Volumes: []entities.DockerVolumeMount{
+			{Type: entities.DockerMountVolume, Source: "iaas-vol-1", Target: "/var/lib/postgresql/data"},
+			{Type: entities.DockerMountBind, Source: dockerBindRoot + "/user-1/init", Target: "/docker-entrypoint-initdb.d", ReadOnly: true},
+		},
+	}
+
+	config := dockerReplicaContainerConfig(service, "db-1")
+	assert.Equal(t, map[string]string{
+		"iaas-vol-1":                    "/var/lib/postgresql/data",
+		dockerBindRoot + "/user-1/init": "/docker-entrypoint-initdb.d:ro",
+	}, config.Volumes)
+}
+
+func TestLastLineInt(t *testing.T) {
+	size, err := lastLineInt("tar: removing leading '/'\n20480\n")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20480), size)
+
+	_, err = lastLineInt("")
+	assert.Error(t, err)
+}
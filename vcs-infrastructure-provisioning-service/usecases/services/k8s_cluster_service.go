@@ -395,12 +395,12 @@ func (s *k8sClusterService) GetClusterInfo(ctx context.Context, clusterID string
 
 	if cluster.DashboardEnabled && cluster.DashboardToken != "" {
 		response.DashboardURL = fmt.Sprintf("http://localhost:%d/api/v1/namespaces/kubernetes-dashboard/services/https:kubernetes-dashboard:/proxy/", cluster.APIServerPort)
-		response.DashboardToken = cluster.DashboardToken
+		response.DashboardToken = revealSecret(ctx, cluster.DashboardToken)
 	}
 
 	// Only include kubeconfig if explicitly requested (check context)
 	if ctx.Value("include_kubeconfig") == true {
-		response.Kubeconfig = cluster.Kubeconfig
+		response.Kubeconfig = revealSecret(ctx, cluster.Kubeconfig)
 	}
 
 	return response, nil
@@ -578,12 +578,12 @@ func (s *k8sClusterService) GetConnectionInfo(ctx context.Context, clusterID str
 		ClusterID:    cluster.ID,
 		ClusterName:  cluster.ClusterName,
 		APIServerURL: fmt.Sprintf("https://localhost:%d", cluster.APIServerPort),
-		Kubeconfig:   base64.StdEncoding.EncodeToString([]byte(cluster.Kubeconfig)),
+		Kubeconfig:   revealSecret(ctx, base64.StdEncoding.EncodeToString([]byte(cluster.Kubeconfig))),
 	}
 
 	if cluster.DashboardEnabled {
 		response.DashboardURL = fmt.Sprintf("http://localhost:%d/api/v1/namespaces/kubernetes-dashboard/services/https:kubernetes-dashboard:/proxy/", cluster.APIServerPort)
-		response.DashboardToken = cluster.DashboardToken
+		response.DashboardToken = revealSecret(ctx, cluster.DashboardToken)
 	}
 
 	// Kubectl commands
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/kafka"
+	"go.uber.org/zap"
+)
+
+const (
+	nginxAccessLogFormatName = "iaas_json"
+	nginxAccessLogPath       = "/var/log/nginx/access.log" // linked to stdout in the nginx image
+	nginxAccessLogInterval   = 10 * time.Second
+	nginxAccessLogAction     = "nginx.access_log"
+	nginxAccessLogBatchSize  = 500
+)
+
+// nginxAccessLogFormat writes one JSON object per request. It is declared in http context
+// by both the instance and the cluster configs.
+const nginxAccessLogFormat = "log_format " + nginxAccessLogFormatName + ` escape=json '{"time":"$time_iso8601",` +
+	`"server_name":"$server_name","host":"$host","client_ip":"$remote_addr",` +
+	`"method":"$request_method","path":"$uri","status":$status,"bytes":$body_bytes_sent,` +
+	`"request_time":$request_time,"upstream_time":"$upstream_response_time",` +
+	`"upstream_addr":"$upstream_addr","user_agent":"$http_user_agent"}';`
+
+// accessLogLine is one line written with nginxAccessLogFormat
+type accessLogLine struct {
+	ServerName   string  `json:"server_name"`
+	Host         string  `json:"host"`
+	ClientIP     string  `json:"client_ip"`
+	Method       string  `json:"method"`
+	Path         string  `json:"path"`
+	Status       int     `json:"status"`
+	Bytes        int64   `json:"bytes"`
+	RequestTime  float64 `json:"request_time"`
+	UpstreamTime string  `json:"upstream_time"`
+	UpstreamAddr string  `json:"upstream_addr"`
+	UserAgent    string  `json:"user_agent"`
+}
+
+// accessLogEntry is a parsed request as shipped to the monitoring service
+type accessLogEntry struct {
+	Timestamp      time.Time `json:"timestamp"`
+	Node           string    `json:"node,omitempty"`
+	ServerName     string    `json:"server_name"`
+	Host           string    `json:"host"`
+	ClientIP       string    `json:"client_ip"`
+	Method         string    `json:"method"`
+	Path           string    `json:"path"`
+	Status         int       `json:"status"`
+	BytesSent      int64     `json:"bytes_sent"`
+	RequestTimeMs  float64   `json:"request_time_ms"`
+	UpstreamTimeMs float64   `json:"upstream_time_ms"`
+	UpstreamAddr   string    `json:"upstream_addr,omitempty"`
+	UserAgent      string    `json:"user_agent,omitempty"`
+}
+
+// parseAccessLogLine parses a timestamped container log line. The timestamp is returned
+// whenever it can be read so the caller can move past lines that are not access logs.
+func parseAccessLogLine(line string) (accessLogEntry, time.Time, bool) {
+	stamp, rest, found := strings.Cut(line, " ")
+	if !found {
+		return accessLogEntry{}, time.Time{}, false
+	}
+	at, err := time.Parse(time.RFC3339Nano, stamp)
+	if err != nil {
+		return accessLogEntry{}, time.Time{}, false
+	}
+	if !strings.HasPrefix(rest, "{") {
+		return accessLogEntry{}, at, false
+	}
+	var parsed accessLogLine
+	if err := json.Unmarshal([]byte(rest), &parsed); err != nil || parsed.Status == 0 {
+		return accessLogEntry{}, at, false
+	}
+
+	return accessLogEntry{
+		Timestamp:      at,
+		ServerName:     parsed.ServerName,
+		Host:           parsed.Host,
+		ClientIP:       parsed.ClientIP,
+		Method:         parsed.Method,
+		Path:           parsed.Path,
+		Status:         parsed.Status,
+		BytesSent:      parsed.Bytes,
+		RequestTimeMs:  parsed.RequestTime * 1000,
+		UpstreamTimeMs: upstreamTimeSeconds(parsed.UpstreamTime) * 1000,
+		UpstreamAddr:   parsed.UpstreamAddr,
+		UserAgent:      parsed.UserAgent,
+	}, at, true
+}
+
+// upstreamTimeSeconds adds up $upstream_response_time, which lists one time per upstream
+// tried (", ") and per internal redirect (" : "), with "-" for requests never proxied
+func upstreamTimeSeconds(value string) float64 {
+	total := 0.0
+	for _, part := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ':' || r == ' ' }) {
+		if seconds, err := strconv.ParseFloat(part, 64); err == nil {
+			total += seconds
+		}
+	}
+	return total
+}
+
+// accessLogCursor remembers per container up to where logs have been collected
+type accessLogCursor struct {
+	mu    sync.Mutex
+	since map[string]time.Time
+}
+
+func newAccessLogCursor() *accessLogCursor {
+	return &accessLogCursor{since: make(map[string]time.Time)}
+}
+
+// get returns where to resume a container; new containers start one interval back
+// rather than replaying their whole history
+func (c *accessLogCursor) get(containerID string, now time.Time) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if since, ok := c.since[containerID]; ok {
+		return since
+	}
+	return now.Add(-nginxAccessLogInterval)
+}
+
+func (c *accessLogCursor) set(containerID string, since time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.since[containerID] = since
+}
+
+// retain forgets containers that were not collected in the last round
+func (c *accessLogCursor) retain(containerIDs map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id := range c.since {
+		if !containerIDs[id] {
+			delete(c.since, id)
+		}
+	}
+}
+
+// readAccessLogs returns the requests a container logged since the previous read, along
+// with the ModSecurity audit records written to the same stream
+func readAccessLogs(ctx context.Context, dockerSvc docker.IDockerService, cursor *accessLogCursor, containerID string) ([]accessLogEntry, []wafEvent, error) {
+	lines, err := dockerSvc.GetContainerLogsSince(ctx, containerID, cursor.get(containerID, time.Now()))
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []accessLogEntry
+	var wafEvents []wafEvent
+	var last time.Time
+	for _, line := range lines {
+		entry, at, ok := parseAccessLogLine(line)
+		if at.After(last) {
+			last = at
+		}
+		if ok {
+			entries = append(entries, entry)
+			continue
+		}
+		if _, body, found := strings.Cut(line, " "); found && strings.HasPrefix(body, `{"transaction"`) {
+			if event, ok := parseWAFAuditLine(body, at); ok {
+				wafEvents = append(wafEvents, event)
+			}
+		}
+	}
+	if !last.IsZero() {
+		// Docker includes lines stamped exactly at since
+		cursor.set(containerID, last.Add(time.Nanosecond))
+	}
+	return entries, wafEvents, nil
+}
+
+// publishAccessLogs ships entries to the monitoring service in batches
+func publishAccessLogs(ctx context.Context, producer kafka.IKafkaProducer, event kafka.InfrastructureEvent, entries []accessLogEntry) {
+	for start := 0; start < len(entries); start += nginxAccessLogBatchSize {
+		end := min(start+nginxAccessLogBatchSize, len(entries))
+		event.Action = nginxAccessLogAction
+		event.Metadata = map[string]interface{}{"entries": entries[start:end]}
+		producer.PublishEvent(ctx, event)
+	}
+}
+
+// StartAccessLogCollector ships the access logs of every running instance on
+// nginxAccessLogInterval until ctx is cancelled
+func (s *nginxService) StartAccessLogCollector(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(nginxAccessLogInterval)
+		defer ticker.Stop()
+
+		for {
+			s.collectAccessLogs(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *nginxService) collectAccessLogs(ctx context.Context) {
+	instances, err := s.nginxRepo.ListAll()
+	if err != nil {
+		s.logger.Error("failed to list nginx instances for access logs", zap.Error(err))
+		return
+	}
+	seen := make(map[string]bool)
+	for i := range instances {
+		instance := &instances[i]
+		if instance.ContainerID == "" || instance.Infrastructure.Status != entities.StatusRunning {
+			continue
+		}
+		seen[instance.ContainerID] = true
+		entries, wafEvents, err := readAccessLogs(ctx, s.dockerSvc, s.accessLogs, instance.ContainerID)
+		if err != nil {
+			s.logger.Debug("failed to read nginx access logs", zap.String("instance_id", instance.ID), zap.Error(err))
+			continue
+		}
+		event := kafka.InfrastructureEvent{
+			InstanceID: instance.InfrastructureID,
+			UserID:     instance.Infrastructure.UserID,
+			Type:       "nginx",
+		}
+		publishAccessLogs(ctx, s.kafkaProducer, event, entries)
+		if s.requestRecorder != nil {
+			s.requestRecorder.RecordUpstreamRequests(countUpstreamRequests(entries), time.Now())
+		}
+		if instance.WAFEnabled {
+			publishWAFEvents(ctx, s.kafkaProducer, event, instance.WAFMode, wafEvents)
+		}
+	}
+	s.accessLogs.retain(seen)
+}
+
+// StartAccessLogCollector ships the access logs and WAF events of every node of running
+// clusters that have access logging or the WAF enabled on nginxAccessLogInterval until
+// ctx is cancelled
+func (s *nginxClusterService) StartAccessLogCollector(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(nginxAccessLogInterval)
+		defer ticker.Stop()
+
+		for {
+			s.collectAccessLogs(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *nginxClusterService) collectAccessLogs(ctx context.Context) {
+	if s.kafkaProducer == nil {
+		return
+	}
+	clusters, err := s.clusterRepo.ListAll()
+	if err != nil {
+		s.logger.Error("failed to list nginx clusters for access logs", zap.Error(err))
+		return
+	}
+	seen := make(map[string]bool)
+	for i := range clusters {
+		cluster := &clusters[i]
+		if (!cluster.AccessLogEnabled && !cluster.WAFEnabled) || cluster.Infrastructure.Status != entities.StatusRunning {
+			continue
+		}
+		nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+		if err != nil {
+			s.logger.Error("failed to list nginx nodes", zap.String("cluster_id", cluster.ID), zap.Error(err))
+			continue
+		}
+		var entries []accessLogEntry
+		var wafEvents []wafEvent
+		for j := range nodes {
+			node := &nodes[j]
+			if node.ContainerID == "" {
+				continue
+			}
+			seen[node.ContainerID] = true
+			nodeEntries, nodeWAFEvents, err := readAccessLogs(ctx, s.dockerSvc, s.accessLogs, node.ContainerID)
+			if err != nil {
+				s.logger.Debug("failed to read nginx node access logs", zap.String("node_id", node.ID), zap.Error(err))
+				continue
+			}
+			for k := range nodeEntries {
+				nodeEntries[k].Node = node.Name
+			}
+			for k := range nodeWAFEvents {
+				nodeWAFEvents[k].Node = node.Name
+			}
+			entries = append(entries, nodeEntries...)
+			wafEvents = append(wafEvents, nodeWAFEvents...)
+		}
+		event := kafka.InfrastructureEvent{
+			InstanceID: cluster.ID,
+			UserID:     cluster.Infrastructure.UserID,
+			Type:       "nginx_cluster",
+		}
+		publishAccessLogs(ctx, s.kafkaProducer, event, entries)
+		if s.requestRecorder != nil {
+			s.requestRecorder.RecordUpstreamRequests(countUpstreamRequests(entries), time.Now())
+		}
+		if cluster.WAFEnabled {
+			publishWAFEvents(ctx, s.kafkaProducer, event, cluster.WAFMode, wafEvents)
+		}
+	}
+	s.accessLogs.retain(seen)
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAccessLogLine(t *testing.T) {
+	line := `2025-03-01T10:00:00.123456789Z {"time":"2025-03-01T10:00:00+00:00","server_name":"example.com","host":"example.com",` +
+		`"client_ip":"10.0.0.7","method":"GET","path":"/api/users","status":502,"bytes":157,"request_time":0.250,` +
+		`"upstream_time":"0.100, 0.120","upstream_addr":"10.0.0.1:80, 10.0.0.2:80","user_agent":"curl/8.0"}`
+
+	entry, at, ok := parseAccessLogLine(line)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2025, 3, 1, 10, 0, 0, 123456789, time.UTC), at)
+	assert.Equal(t, at, entry.Timestamp)
+	assert.Equal(t, "example.com", entry.ServerName)
+	assert.Equal(t, "10.0.0.7", entry.ClientIP)
+	assert.Equal(t, "/api/users", entry.Path)
+	assert.Equal(t, 502, entry.Status)
+	assert.Equal(t, int64(157), entry.BytesSent)
+	assert.InDelta(t, 250, entry.RequestTimeMs, 0.001)
+	assert.InDelta(t, 220, entry.UpstreamTimeMs, 0.001)
+
+	// Other output still moves the cursor forward
+	_, at, ok = parseAccessLogLine("2025-03-01T10:00:01Z /docker-entrypoint.sh: Configuration complete")
+	assert.False(t, ok)
+	assert.False(t, at.IsZero())
+
+	_, at, ok = parseAccessLogLine("no timestamp")
+	assert.False(t, ok)
+	assert.True(t, at.IsZero())
+}
+
+func TestUpstreamTimeSeconds(t *testing.T) {
+	assert.Zero(t, upstreamTimeSeconds("-"))
+	assert.InDelta(t, 0.004, upstreamTimeSeconds("0.004"), 1e-9)
+	assert.InDelta(t, 0.6, upstreamTimeSeconds("0.1, 0.2 : 0.3"), 1e-9)
+}
+
+func TestAccessLogCursor(t *testing.T) {
+	cursor := newAccessLogCursor()
+	now := time.Now()
+
+	assert.Equal(t, now.Add(-nginxAccessLogInterval), cursor.get("c1", now))
+	cursor.set("c1", now)
+	assert.Equal(t, now, cursor.get("c1", now.Add(time.Minute)))
+
+	cursor.retain(map[string]bool{"c2": true})
+	assert.Equal(t, now.Add(-nginxAccessLogInterval), cursor.get("c1", now))
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+)
+
+var (
+	canaryHeaderPattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+	canaryCookiePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+// renderCanaryRoutes writes the http-level blocks that pick a backend for every route with
+// a canary and returns the proxy_pass target of each such route, keyed by route ID.
+// Clients are split with split_clients on address and user agent so each client sticks to
+// one side; a matching header or cookie always selects the canary. Both sides are rendered
+// as upstream groups so proxy_pass can take a variable without a resolver.
+func renderCanaryRoutes(b *strings.Builder, routes []entities.NginxRoute, upstreamNames map[string]bool, upstreams []entities.NginxUpstream) map[string]string {
+	targets := make(map[string]string)
+	for _, route := range routes {
+		if route.CanaryBackend == "" {
+			continue
+		}
+		key := strings.ReplaceAll(route.ID, "-", "")
+		stable, ok := canaryUpstream(b, route.Backend, "iaas_"+key+"_stable", upstreamNames, upstreams)
+		if !ok {
+			continue
+		}
+		canary, ok := canaryUpstream(b, route.CanaryBackend, "iaas_"+key+"_canary", upstreamNames, upstreams)
+		if !ok {
+			// Nothing to send canary traffic to; the route keeps using its stable backend
+			continue
+		}
+
+		fmt.Fprintf(b, "# Canary for %s: %d%% to %s\n", route.Path, route.CanaryWeight, route.CanaryBackend)
+		selected := stable
+		switch {
+		case route.CanaryWeight >= 100:
+			selected = canary
+		case route.CanaryWeight > 0:
+			selected = "$iaas_split_" + key
+			fmt.Fprintf(b, "split_clients \"${remote_addr}${http_user_agent}\" %s {\n", selected)
+			fmt.Fprintf(b, "    %d%% %s;\n", route.CanaryWeight, canary)
+			fmt.Fprintf(b, "    * %s;\n", stable)
+			b.WriteString("}\n")
+		}
+
+		match := "~."
+		if route.CanaryMatchValue != "" {
+			match = route.CanaryMatchValue
+		}
+		if route.CanaryCookie != "" {
+			variable := "$iaas_cookie_" + key
+			fmt.Fprintf(b, "map $cookie_%s %s {\n    default %s;\n    \"%s\" %s;\n}\n", route.CanaryCookie, variable, selected, match, canary)
+			selected = variable
+		}
+		if route.CanaryHeader != "" {
+			variable := "$iaas_header_" + key
+			header := strings.ToLower(strings.ReplaceAll(route.CanaryHeader, "-", "_"))
+			fmt.Fprintf(b, "map $http_%s %s {\n    default %s;\n    \"%s\" %s;\n}\n", header, variable, selected, match, canary)
+			selected = variable
+		}
+		b.WriteString("\n")
+
+		targets[route.ID] = "http://" + selected
+	}
+	return targets
+}
+
+// canaryUpstream returns the upstream group a canary route side proxies to. Bare host:port
+// backends get a single-server upstream of their own; upstreams without live backends and
+// URLs cannot be used.
+func canaryUpstream(b *strings.Builder, backend, name string, upstreamNames map[string]bool, upstreams []entities.NginxUpstream) (string, bool) {
+	if upstreamNames[backend] {
+		return backend, true
+	}
+	for _, upstream := range upstreams {
+		if upstream.Name == backend {
+			return "", false
+		}
+	}
+	if strings.Contains(backend, "/") {
+		return "", false
+	}
+	fmt.Fprintf(b, "upstream %s {\n    server %s;\n}\n\n", name, backend)
+	return name, true
+}
+
+// validateCanary checks a route's canary settings before they are rendered
+func validateCanary(route *entities.NginxRoute) error {
+	if strings.Contains(route.Backend, "/") {
+		return fmt.Errorf("canary needs the route backend to be an upstream name or host:port, not %q", route.Backend)
+	}
+	if err := validateNginxValue("canary backend", route.CanaryBackend); err != nil {
+		return err
+	}
+	if strings.Contains(route.CanaryBackend, "/") {
+		return fmt.Errorf("canary backend must be an upstream name or host:port, not %q", route.CanaryBackend)
+	}
+	if route.CanaryBackend == route.Backend {
+		return fmt.Errorf("canary backend must differ from the route backend")
+	}
+	if route.CanaryWeight < 0 || route.CanaryWeight > 100 {
+		return fmt.Errorf("canary weight must be between 0 and 100, got %d", route.CanaryWeight)
+	}
+	if route.CanaryHeader != "" && !canaryHeaderPattern.MatchString(route.CanaryHeader) {
+		return fmt.Errorf("canary header %q may only contain letters, digits and dashes", route.CanaryHeader)
+	}
+	if route.CanaryCookie != "" && !canaryCookiePattern.MatchString(route.CanaryCookie) {
+		return fmt.Errorf("canary cookie %q may only contain letters, digits and underscores", route.CanaryCookie)
+	}
+	if route.CanaryMatchValue != "" {
+		if err := validateNginxValue("canary match value", route.CanaryMatchValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func clearCanary(route *entities.NginxRoute) {
+	route.CanaryBackend = ""
+	route.CanaryWeight = 0
+	route.CanaryHeader = ""
+	route.CanaryCookie = ""
+	route.CanaryMatchValue = ""
+}
+
+func toRouteInfo(route *entities.NginxRoute) dto.RouteInfo {
+	info := dto.RouteInfo{ID: route.ID, Path: route.Path, Backend: route.Backend, Priority: route.Priority}
+	if route.CanaryBackend != "" {
+		info.Canary = &dto.RouteCanaryInfo{
+			Backend:    route.CanaryBackend,
+			Weight:     route.CanaryWeight,
+			Header:     route.CanaryHeader,
+			Cookie:     route.CanaryCookie,
+			MatchValue: route.CanaryMatchValue,
+		}
+	}
+	return info
+}
+
+// SetRouteCanary starts a canary on a route or replaces its settings
+func (s *nginxService) SetRouteCanary(ctx context.Context, id, routeID string, req dto.SetRouteCanaryRequest) (*dto.RouteInfo, error) {
+	return s.changeRouteCanary(ctx, id, routeID, "canary_set", func(route *entities.NginxRoute) error {
+		route.CanaryBackend = req.Backend
+		route.CanaryWeight = req.Weight
+		route.CanaryHeader = req.Header
+		route.CanaryCookie = req.Cookie
+		route.CanaryMatchValue = req.MatchValue
+		return validateCanary(route)
+	})
+}
+
+// ShiftRouteCanary moves the canary to an absolute weight or by a step
+func (s *nginxService) ShiftRouteCanary(ctx context.Context, id, routeID string, req dto.ShiftRouteCanaryRequest) (*dto.RouteInfo, error) {
+	return s.changeRouteCanary(ctx, id, routeID, "canary_shifted", func(route *entities.NginxRoute) error {
+		if route.CanaryBackend == "" {
+			return fmt.Errorf("route has no canary")
+		}
+		switch {
+		case req.Weight != nil:
+			route.CanaryWeight = *req.Weight
+		case req.Step != 0:
+			route.CanaryWeight += req.Step
+		default:
+			return fmt.Errorf("either weight or step is required")
+		}
+		return validateCanary(route)
+	})
+}
+
+// PromoteRouteCanary makes the canary backend the route backend and ends the canary
+func (s *nginxService) PromoteRouteCanary(ctx context.Context, id, routeID string) (*dto.RouteInfo, error) {
+	return s.changeRouteCanary(ctx, id, routeID, "canary_promoted", func(route *entities.NginxRoute) error {
+		if route.CanaryBackend == "" {
+			return fmt.Errorf("route has no canary")
+		}
+		route.Backend = route.CanaryBackend
+		clearCanary(route)
+		return nil
+	})
+}
+
+// AbortRouteCanary sends all traffic back to the route backend and ends the canary
+func (s *nginxService) AbortRouteCanary(ctx context.Context, id, routeID string) (*dto.RouteInfo, error) {
+	return s.changeRouteCanary(ctx, id, routeID, "canary_aborted", func(route *entities.NginxRoute) error {
+		if route.CanaryBackend == "" {
+			return fmt.Errorf("route has no canary")
+		}
+		clearCanary(route)
+		return nil
+	})
+}
+
+// changeRouteCanary applies a canary change to a route through config validation and
+// reload, and stores the route only when the new config was accepted
+func (s *nginxService) changeRouteCanary(ctx context.Context, id, routeID, action string, change func(route *entities.NginxRoute) error) (*dto.RouteInfo, error) {
+	instance, err := s.nginxRepo.FindByInfrastructureID(id)
+	if err != nil {
+		return nil, err
+	}
+	route, err := s.nginxRepo.GetRoute(routeID)
+	if err != nil {
+		return nil, err
+	}
+	if route.NginxID != instance.ID {
+		return nil, fmt.Errorf("route does not belong to this nginx instance")
+	}
+	if err := change(route); err != nil {
+		return nil, err
+	}
+
+	state, err := s.loadConfigState(instance)
+	if err != nil {
+		return nil, err
+	}
+	for i := range state.routes {
+		if state.routes[i].ID == route.ID {
+			state.routes[i] = *route
+		}
+	}
+	if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: action}); err != nil {
+		return nil, err
+	}
+	if err := s.nginxRepo.UpdateRoute(route); err != nil {
+		return nil, err
+	}
+	info := toRouteInfo(route)
+	return &info, nil
+}
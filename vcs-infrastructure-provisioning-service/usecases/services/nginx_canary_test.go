@@ -0,0 +1,68 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderNginxConfigCanary(t *testing.T) {
+	state := &nginxConfigState{
+		instance: &entities.NginxInstance{ID: "nginx-1"},
+		routes: []entities.NginxRoute{{
+			ID: "r-1", Path: "/api", Backend: "blue",
+			CanaryBackend: "10.0.0.9:80", CanaryWeight: 20, CanaryHeader: "X-Canary",
+		}},
+		upstreams: []entities.NginxUpstream{{
+			Name:     "blue",
+			Backends: []entities.NginxUpstreamBackend{{Address: "10.0.0.1:80", Weight: 1}},
+		}},
+	}
+
+	files, err := renderNginxConfig(state)
+	assert.NoError(t, err)
+	conf := files[nginxServerConfPath]
+	assert.Contains(t, conf, "upstream iaas_r1_canary {\n    server 10.0.0.9:80;\n}")
+	assert.Contains(t, conf, "split_clients \"${remote_addr}${http_user_agent}\" $iaas_split_r1 {\n    20% iaas_r1_canary;\n    * blue;\n}")
+	assert.Contains(t, conf, "map $http_x_canary $iaas_header_r1 {\n    default $iaas_split_r1;\n    \"~.\" iaas_r1_canary;\n}")
+	assert.Contains(t, conf, "proxy_pass http://$iaas_header_r1;")
+
+	// Full weight with no match rules sends everything to the canary directly
+	state.routes[0].CanaryWeight = 100
+	state.routes[0].CanaryHeader = ""
+	files, err = renderNginxConfig(state)
+	assert.NoError(t, err)
+	conf = files[nginxServerConfPath]
+	assert.NotContains(t, conf, "split_clients")
+	assert.Contains(t, conf, "proxy_pass http://iaas_r1_canary;")
+
+	// A canary upstream without live backends leaves the route on its stable backend
+	state.routes[0].CanaryBackend = "green"
+	state.upstreams = append(state.upstreams, entities.NginxUpstream{Name: "green"})
+	files, err = renderNginxConfig(state)
+	assert.NoError(t, err)
+	conf = files[nginxServerConfPath]
+	assert.NotContains(t, conf, "Canary for")
+	assert.Contains(t, conf, "proxy_pass http://blue;")
+}
+
+func TestValidateCanary(t *testing.T) {
+	route := entities.NginxRoute{Backend: "blue", CanaryBackend: "green", CanaryWeight: 10, CanaryCookie: "canary_user", CanaryMatchValue: "1"}
+	assert.NoError(t, validateCanary(&route))
+
+	invalid := []func(r *entities.NginxRoute){
+		func(r *entities.NginxRoute) { r.Backend = "http://blue:80" },
+		func(r *entities.NginxRoute) { r.CanaryBackend = "http://green" },
+		func(r *entities.NginxRoute) { r.CanaryBackend = "blue" },
+		func(r *entities.NginxRoute) { r.CanaryWeight = 101 },
+		func(r *entities.NginxRoute) { r.CanaryHeader = "X Canary" },
+		func(r *entities.NginxRoute) { r.CanaryCookie = "a-b" },
+		func(r *entities.NginxRoute) { r.CanaryMatchValue = "x;" },
+	}
+	for _, mutate := range invalid {
+		r := route
+		mutate(&r)
+		assert.Error(t, validateCanary(&r))
+	}
+}
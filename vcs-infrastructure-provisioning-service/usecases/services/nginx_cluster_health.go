@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"go.uber.org/zap"
+)
+
+const (
+	nginxHealthMonitorTick  = time.Second
+	nginxFailoverThreshold  = 3 // consecutive failed probes of the master before it is replaced
+	nginxFailoverReason     = "node_failure"
+	nginxFailoverSystem     = "system"
+	nginxNodeHealthUpdate   = "nginx_node_health"
+	nginxClusterFailoverMsg = "nginx_cluster_failover"
+)
+
+// NginxClusterBroadcaster pushes node health changes and failovers to connected clients
+type NginxClusterBroadcaster interface {
+	BroadcastNginxClusterUpdate(update dto.NginxClusterUpdate)
+}
+
+// nginxHealthState keeps probe bookkeeping between monitor ticks
+type nginxHealthState struct {
+	mu        sync.Mutex
+	failures  map[string]int       // node ID -> consecutive failed probes
+	lastProbe map[string]time.Time // cluster ID -> last probe round
+}
+
+func newNginxHealthState() *nginxHealthState {
+	return &nginxHealthState{
+		failures:  make(map[string]int),
+		lastProbe: make(map[string]time.Time),
+	}
+}
+
+// recordProbe updates the failure streak of a node and returns its new length
+func (h *nginxHealthState) recordProbe(nodeID string, healthy bool) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if healthy {
+		delete(h.failures, nodeID)
+		return 0
+	}
+	h.failures[nodeID]++
+	return h.failures[nodeID]
+}
+
+func (h *nginxHealthState) resetNode(nodeID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.failures, nodeID)
+}
+
+// due reports whether a cluster's health check interval has elapsed and marks it probed
+func (h *nginxHealthState) due(clusterID string, interval time.Duration, now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if last, ok := h.lastProbe[clusterID]; ok && now.Sub(last) < interval {
+		return false
+	}
+	h.lastProbe[clusterID] = now
+	return true
+}
+
+func (s *nginxClusterService) SetWebSocketHandler(handler NginxClusterBroadcaster) {
+	s.broadcaster = handler
+}
+
+// StartHealthMonitor probes every running cluster's nodes on its health check interval
+// until ctx is cancelled
+func (s *nginxClusterService) StartHealthMonitor(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(nginxHealthMonitorTick)
+		defer ticker.Stop()
+
+		for {
+			s.checkClusters(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *nginxClusterService) checkClusters(ctx context.Context) {
+	clusters, err := s.clusterRepo.ListAll()
+	if err != nil {
+		s.logger.Error("failed to list nginx clusters for health check", zap.Error(err))
+		return
+	}
+
+	now := time.Now()
+	for i := range clusters {
+		cluster := &clusters[i]
+		if !cluster.HealthCheckEnabled || cluster.Infrastructure.Status != entities.StatusRunning {
+			continue
+		}
+		interval := time.Duration(cluster.HealthCheckInterval) * time.Second
+		if interval <= 0 {
+			interval = 5 * time.Second
+		}
+		if !s.health.due(cluster.ID, interval, now) {
+			continue
+		}
+		s.checkCluster(ctx, cluster)
+	}
+}
+
+// checkCluster probes each node, stores the result and promotes the highest-priority
+// healthy backup once the master has failed nginxFailoverThreshold probes in a row
+func (s *nginxClusterService) checkCluster(ctx context.Context, cluster *entities.NginxCluster) {
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		s.logger.Error("failed to list nginx nodes", zap.String("cluster_id", cluster.ID), zap.Error(err))
+		return
+	}
+
+	var master, candidate *entities.NginxNode
+	masterFailures := 0
+	for i := range nodes {
+		node := &nodes[i]
+		healthy := s.probeNode(ctx, cluster, node)
+		failures := s.health.recordProbe(node.ID, healthy)
+
+		changed := node.IsHealthy != healthy
+		node.IsHealthy = healthy
+		node.LastHealthAt = time.Now()
+		if err := s.clusterRepo.UpdateNode(node); err != nil {
+			s.logger.Error("failed to save node health", zap.String("node_id", node.ID), zap.Error(err))
+		}
+		if changed {
+			s.logger.Info("nginx node health changed", zap.String("node", node.Name), zap.Bool("healthy", healthy))
+			s.broadcastNodeHealth(cluster, node)
+		}
+
+		if node.ID == cluster.MasterNodeID {
+			master = node
+			masterFailures = failures
+		} else if healthy && (candidate == nil || node.Priority > candidate.Priority) {
+			candidate = node
+		}
+	}
+
+	// Upstreams are probed from a node that is still serving, preferring the master
+	prober := candidate
+	if master != nil && master.IsHealthy {
+		prober = master
+	}
+	if prober != nil {
+		s.checkClusterUpstreams(ctx, cluster, prober)
+	}
+
+	if master == nil || masterFailures < nginxFailoverThreshold {
+		return
+	}
+	if candidate == nil {
+		s.logger.Warn("nginx master is down and no healthy backup is available",
+			zap.String("cluster_id", cluster.ID), zap.String("master", master.Name))
+		return
+	}
+
+	s.logger.Warn("nginx master failed health checks, promoting backup",
+		zap.String("cluster_id", cluster.ID), zap.String("master", master.Name),
+		zap.String("new_master", candidate.Name), zap.Int("failures", masterFailures))
+	if _, err := s.failover(ctx, cluster, candidate, nginxFailoverReason, nginxFailoverSystem); err != nil {
+		s.logger.Error("automatic failover failed", zap.String("cluster_id", cluster.ID), zap.Error(err))
+		return
+	}
+	s.health.resetNode(master.ID)
+}
+
+// probeNode requests the cluster's health check path from inside the node container
+func (s *nginxClusterService) probeNode(ctx context.Context, cluster *entities.NginxCluster, node *entities.NginxNode) bool {
+	if !s.checkNodeHealth(ctx, node) {
+		return false
+	}
+	if !cluster.HealthCheckEnabled || cluster.HealthCheckPath == "" {
+		return true
+	}
+	output, err := s.dockerSvc.ExecCommand(ctx, node.ContainerID, healthCheckCommand(cluster.HealthCheckPath))
+	return err == nil && strings.Contains(output, nginxHealthyMarker)
+}
+
+func (s *nginxClusterService) broadcastNodeHealth(cluster *entities.NginxCluster, node *entities.NginxNode) {
+	if s.broadcaster == nil {
+		return
+	}
+	s.broadcaster.BroadcastNginxClusterUpdate(dto.NginxClusterUpdate{
+		Type:             nginxNodeHealthUpdate,
+		ClusterID:        cluster.ID,
+		InfrastructureID: cluster.InfrastructureID,
+		ClusterName:      cluster.ClusterName,
+		Node: &dto.NodeHealthInfo{
+			NodeID:      node.ID,
+			NodeName:    node.Name,
+			Role:        node.Role,
+			IsHealthy:   node.IsHealthy,
+			NginxStatus: node.Status,
+			LastCheck:   node.LastHealthAt.Format(time.RFC3339),
+		},
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+}
+
+func (s *nginxClusterService) broadcastFailover(cluster *entities.NginxCluster, event *entities.NginxFailoverEvent) {
+	if s.broadcaster == nil {
+		return
+	}
+	s.broadcaster.BroadcastNginxClusterUpdate(dto.NginxClusterUpdate{
+		Type:             nginxClusterFailoverMsg,
+		ClusterID:        cluster.ID,
+		InfrastructureID: cluster.InfrastructureID,
+		ClusterName:      cluster.ClusterName,
+		Failover: &dto.NginxFailoverEvent{
+			ID:            event.ID,
+			OldMasterID:   event.OldMasterID,
+			OldMasterName: event.OldMasterName,
+			NewMasterID:   event.NewMasterID,
+			NewMasterName: event.NewMasterName,
+			Reason:        event.Reason,
+			TriggeredBy:   event.TriggeredBy,
+			OccurredAt:    event.OccurredAt.Format(time.RFC3339),
+		},
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNginxHealthStateRecordProbe(t *testing.T) {
+	state := newNginxHealthState()
+
+	assert.Equal(t, 1, state.recordProbe("n1", false))
+	assert.Equal(t, 2, state.recordProbe("n1", false))
+	assert.Equal(t, 1, state.recordProbe("n2", false))
+	assert.Equal(t, 0, state.recordProbe("n1", true))
+	assert.Equal(t, 1, state.recordProbe("n1", false))
+
+	state.resetNode("n2")
+	assert.Equal(t, 1, state.recordProbe("n2", false))
+}
+
+func TestNginxHealthStateDue(t *testing.T) {
+	state := newNginxHealthState()
+	now := time.Now()
+
+	assert.True(t, state.due("c1", 5*time.Second, now))
+	assert.False(t, state.due("c1", 5*time.Second, now.Add(2*time.Second)))
+	assert.True(t, state.due("c2", 5*time.Second, now.Add(2*time.Second)))
+	assert.True(t, state.due("c1", 5*time.Second, now.Add(5*time.Second)))
+}
+
+// memoryFailoverRepo keeps one cluster with its nodes and failover events; other calls panic
+type memoryFailoverRepo struct {
+	repositories.INginxClusterRepository
+
+	cluster entities.NginxCluster
+	nodes   []entities.NginxNode
+	events  []entities.NginxFailoverEvent
+}
+
+func (r *memoryFailoverRepo) Update(cluster *entities.NginxCluster) error {
+	r.cluster = *cluster
+	return nil
+}
+
+func (r *memoryFailoverRepo) ListNodes(string) ([]entities.NginxNode, error) {
+	return append([]entities.NginxNode(nil), r.nodes...), nil
+}
+
+func (r *memoryFailoverRepo) FindNodeByID(nodeID string) (*entities.NginxNode, error) {
+	for _, node := range r.nodes {
+		if node.ID == nodeID {
+			return &node, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryFailoverRepo) UpdateNode(node *entities.NginxNode) error {
+	for i := range r.nodes {
+		if r.nodes[i].ID == node.ID {
+			r.nodes[i] = *node
+		}
+	}
+	return nil
+}
+
+func (r *memoryFailoverRepo) ListUpstreams(string) ([]entities.NginxClusterUpstream, error) {
+	return nil, nil
+}
+
+func (r *memoryFailoverRepo) CreateFailoverEvent(event *entities.NginxFailoverEvent) error {
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func (r *memoryFailoverRepo) node(id string) entities.NginxNode {
+	node, _ := r.FindNodeByID(id)
+	return *node
+}
+
+const failoverTestVIP = "172.30.5.200"
+
+// newFailoverTestService runs a four node cluster with c1 as master. Containers in down
+// fail the health probe and vipHolder is the container keepalived assigned the VIP to.
+func newFailoverTestService(down map[string]bool, vipHolder *string) (*nginxClusterService, *memoryFailoverRepo, *scriptedDocker) {
+	repo := &memoryFailoverRepo{
+		cluster: entities.NginxCluster{
+			ID: "cluster-1", ClusterName: "web", MasterNodeID: "n1",
+			VirtualIP: failoverTestVIP, VRRPSubnet: "172.30.5.0/24", VRRPInterface: "eth0", VRRPRouterID: 51, VRRPAuthPass: "s3cretPw",
+			HealthCheckEnabled: true, HealthCheckPath: "/health", HealthCheckInterval: 1,
+		},
+		nodes: []entities.NginxNode{
+			{ID: "n1", Name: "web-nginx-1", ContainerID: "c1", Role: "master", Priority: keepalivedMasterPriority, IPAddress: "172.30.5.2", IsHealthy: true},
+			{ID: "n2", Name: "web-nginx-2", ContainerID: "c2", Role: "backup", Priority: 98, IPAddress: "172.30.5.3", IsHealthy: true},
+			{ID: "n3", Name: "web-nginx-3", ContainerID: "c3", Role: "backup", Priority: 99, IPAddress: "172.30.5.4", IsHealthy: true},
+			{ID: "n4", Name: "web-nginx-4", ContainerID: "c4", Role: "backup", Priority: 100, IPAddress: "172.30.5.5", IsHealthy: true},
+		},
+	}
+	dockerSvc := newScriptedDocker(func(containerID string, cmd []string) string {
+		joined := strings.Join(cmd, " ")
+		switch {
+		case strings.HasPrefix(joined, "ip -4"):
+			if containerID == *vipHolder {
+				return "2: eth0    inet " + failoverTestVIP + "/24 scope global eth0"
+			}
+		case strings.Contains(joined, nginxHealthyMarker) && !down[containerID]:
+			return nginxHealthyMarker
+		}
+		return ""
+	})
+	svc := &nginxClusterService{clusterRepo: repo, dockerSvc: dockerSvc, logger: discardLogger{}, health: newNginxHealthState()}
+	return svc, repo, dockerSvc
+}
+
+func TestCheckClusterPromotesHighestPriorityHealthyBackup(t *testing.T) {
+	// n4 outranks the other backups but is down too, so n3 is next in line
+	vipHolder := "c3"
+	svc, repo, _ := newFailoverTestService(map[string]bool{"c1": true, "c4": true}, &vipHolder)
+
+	for i := 1; i < nginxFailoverThreshold; i++ {
+		svc.checkCluster(context.Background(), &repo.cluster)
+		assert.Empty(t, repo.events, "failover after %d failed probes", i)
+		assert.Equal(t, "n1", repo.cluster.MasterNodeID)
+	}
+	assert.False(t, repo.node("n1").IsHealthy)
+
+	svc.checkCluster(context.Background(), &repo.cluster)
+	require.Len(t, repo.events, 1)
+	event := repo.events[0]
+	assert.Equal(t, "n1", event.OldMasterID)
+	assert.Equal(t, "n3", event.NewMasterID)
+	assert.Equal(t, nginxFailoverReason, event.Reason)
+	assert.Equal(t, nginxFailoverSystem, event.TriggeredBy)
+
+	assert.Equal(t, "n3", repo.cluster.MasterNodeID)
+	assert.Equal(t, "master", repo.node("n3").Role)
+	assert.Equal(t, keepalivedMasterPriority, repo.node("n3").Priority)
+	assert.Equal(t, "backup", repo.node("n1").Role)
+	assert.Less(t, repo.node("n1").Priority, keepalivedMasterPriority)
+}
+
+func TestCheckClusterSkipsFailoverWithoutHealthyBackup(t *testing.T) {
+	vipHolder := "c1"
+	svc, repo, _ := newFailoverTestService(map[string]bool{"c1": true, "c2": true, "c3": true, "c4": true}, &vipHolder)
+
+	for i := 0; i < nginxFailoverThreshold+2; i++ {
+		svc.checkCluster(context.Background(), &repo.cluster)
+	}
+	assert.Empty(t, repo.events)
+	assert.Equal(t, "n1", repo.cluster.MasterNodeID)
+	assert.Equal(t, "master", repo.node("n1").Role)
+}
+
+func TestFailoverRevertsWhenVIPDoesNotMove(t *testing.T) {
+	// keepalived never hands the VIP over, so it stays on the old master
+	vipHolder := "c1"
+	svc, repo, dockerSvc := newFailoverTestService(nil, &vipHolder)
+	before := append([]entities.NginxNode(nil), repo.nodes...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	target := repo.node("n2")
+	_, err := svc.failover(ctx, &repo.cluster, &target, "manual", "user")
+	require.Error(t, err)
+
+	assert.Empty(t, repo.events)
+	assert.Equal(t, "n1", repo.cluster.MasterNodeID)
+	assert.Equal(t, before, repo.nodes)
+	assert.Equal(t, "backup", target.Role)
+
+	// keepalived is put back on the original priorities as well
+	assert.Contains(t, dockerSvc.file("c1", keepalivedConfPath), "state MASTER")
+	assert.Contains(t, dockerSvc.file("c2", keepalivedConfPath), "state BACKUP")
+}
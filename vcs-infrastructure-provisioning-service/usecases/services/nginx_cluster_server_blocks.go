@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"go.uber.org/zap"
+)
+
+const (
+	nginxServerBlocksBeginLine = "# BEGIN iaas-server-blocks"
+	nginxServerBlocksEndLine   = "# END iaas-server-blocks"
+	nginxActionServerBlocks    = "server_blocks_updated"
+)
+
+// clusterServerBlockCertDir is where a server block's certificate lives on every node
+func clusterServerBlockCertDir(blockID string) string {
+	return path.Join(nginxClusterCertDir, blockID)
+}
+
+// clusterServerBlocks is what the server block section of a cluster config is rendered from
+type clusterServerBlocks struct {
+	blocks    []entities.NginxServerBlock
+	locations map[string][]entities.NginxLocation
+	certs     map[string]*entities.NginxCertificate
+
+	// wafMode is the cluster mode blocks without one of their own follow; it is empty when
+	// the nodes run without the ModSecurity module
+	wafMode       string
+	wafExclusions []entities.NginxWAFExclusion
+}
+
+// renderClusterServerBlocks renders the stored server blocks of a cluster between marker
+// lines so the section can be replaced in place. Blocks with a stored certificate also
+// listen on 443 and serve the files written by clusterCertificateFiles.
+func renderClusterServerBlocks(state clusterServerBlocks) string {
+	var b strings.Builder
+	b.WriteString("    " + nginxServerBlocksBeginLine + " (managed through the server block API)\n")
+	for _, block := range state.blocks {
+		if !validNginxWords("server name", block.ServerName) {
+			continue
+		}
+		port := block.ListenPort
+		if port == 0 {
+			port = 80
+		}
+		cert := state.certs[block.ID]
+
+		b.WriteString("    server {\n")
+		if port != 443 || cert == nil {
+			fmt.Fprintf(&b, "        listen %d;\n", port)
+		}
+		if cert != nil {
+			certDir := clusterServerBlockCertDir(block.ID)
+			b.WriteString("        listen 443 ssl;\n")
+			fmt.Fprintf(&b, "        ssl_certificate %s/fullchain.pem;\n", certDir)
+			fmt.Fprintf(&b, "        ssl_certificate_key %s/privkey.pem;\n", certDir)
+		}
+		fmt.Fprintf(&b, "        server_name %s;\n", strings.Join(strings.Fields(block.ServerName), " "))
+		if block.RootPath != "" && validateNginxValue("root path", block.RootPath) == nil {
+			fmt.Fprintf(&b, "        root %s;\n", block.RootPath)
+			if validNginxWords("index files", block.IndexFiles) {
+				fmt.Fprintf(&b, "        index %s;\n", strings.Join(strings.Fields(block.IndexFiles), " "))
+			}
+		}
+		if state.wafMode != "" {
+			mode := state.wafMode
+			if validWAFMode(block.WAFMode) {
+				mode = block.WAFMode
+			}
+			b.WriteString(renderWAFDirectives(mode, state.wafExclusions, "        "))
+		}
+
+		// Renewals are answered on the block's own host name
+		fmt.Fprintf(&b, "\n        location ^~ %s {\n", nginxAcmeChallengePath)
+		b.WriteString("            access_log off;\n")
+		fmt.Fprintf(&b, "            root %s;\n", nginxAcmeWebroot)
+		b.WriteString("            default_type text/plain;\n")
+		b.WriteString("        }\n")
+
+		for _, location := range state.locations[block.ID] {
+			if validateNginxValue("location path", location.Path) != nil {
+				continue
+			}
+			if location.ProxyPass != "" && validateNginxValue("proxy pass", location.ProxyPass) != nil {
+				continue
+			}
+			fmt.Fprintf(&b, "\n        location %s {\n", location.Path)
+			if location.ProxyPass != "" {
+				target := location.ProxyPass
+				if !strings.Contains(target, "://") {
+					target = "http://" + target
+				}
+				fmt.Fprintf(&b, "            proxy_pass %s;\n", target)
+			}
+			b.WriteString("        }\n")
+		}
+		b.WriteString("    }\n\n")
+	}
+	b.WriteString("    " + nginxServerBlocksEndLine + "\n")
+	return b.String()
+}
+
+// validNginxWords reports whether a space separated list, such as server names, is
+// non-empty and safe to render
+func validNginxWords(field, value string) bool {
+	words := strings.Fields(value)
+	for _, word := range words {
+		if validateNginxValue(field, word) != nil {
+			return false
+		}
+	}
+	return len(words) > 0
+}
+
+// setClusterServerBlocks replaces the server block section of a cluster config, or adds
+// it in front of the default server when the config has none
+func setClusterServerBlocks(config, section string) (string, error) {
+	lines := strings.SplitAfter(config, "\n")
+	begin, end := -1, -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if begin < 0 && strings.HasPrefix(trimmed, nginxServerBlocksBeginLine) {
+			begin = i
+		} else if begin >= 0 && trimmed == nginxServerBlocksEndLine {
+			end = i
+			break
+		}
+	}
+	if begin >= 0 && end >= 0 {
+		return strings.Join(lines[:begin], "") + section + strings.Join(lines[end+1:], ""), nil
+	}
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "# Default Server" {
+			return strings.Join(lines[:i], "") + section + "\n" + strings.Join(lines[i:], ""), nil
+		}
+	}
+	return "", fmt.Errorf("cluster config has no server block section or default server to add one before")
+}
+
+// loadClusterServerBlocks reads the server blocks of a cluster with their locations and certificates
+func (s *nginxClusterService) loadClusterServerBlocks(clusterID string) clusterServerBlocks {
+	blocks, err := s.clusterRepo.ListServerBlocks(clusterID)
+	if err != nil {
+		s.logger.Error("failed to list server blocks", zap.String("cluster_id", clusterID), zap.Error(err))
+		return clusterServerBlocks{}
+	}
+	state := clusterServerBlocks{
+		blocks:    blocks,
+		locations: make(map[string][]entities.NginxLocation, len(blocks)),
+		certs:     make(map[string]*entities.NginxCertificate),
+	}
+	for _, block := range blocks {
+		state.locations[block.ID], _ = s.clusterRepo.ListLocations(block.ID)
+		if !block.SSLEnabled {
+			continue
+		}
+		if cert, err := s.nginxRepo.GetCertificate(block.ID); err == nil {
+			state.certs[block.ID] = cert
+		}
+	}
+	return state
+}
+
+// renderServerBlockSection renders the server blocks of cluster, applying wafMode and
+// wafExclusions to the blocks that follow the cluster WAF mode
+func (s *nginxClusterService) renderServerBlockSection(cluster *entities.NginxCluster, wafMode string, wafExclusions []entities.NginxWAFExclusion) string {
+	state := s.loadClusterServerBlocks(cluster.ID)
+	if cluster.WAFEnabled {
+		state.wafMode = wafMode
+		if state.wafMode == "" {
+			state.wafMode = entities.NginxWAFOff
+		}
+		state.wafExclusions = wafExclusions
+	}
+	return renderClusterServerBlocks(state)
+}
+
+// clusterWAFExclusions returns the WAF exclusions of a cluster, or none when it runs without WAF
+func (s *nginxClusterService) clusterWAFExclusions(cluster *entities.NginxCluster) []entities.NginxWAFExclusion {
+	if !cluster.WAFEnabled {
+		return nil
+	}
+	exclusions, err := s.wafRepo.ListExclusions(entities.NginxRevisionCluster, cluster.ID)
+	if err != nil {
+		s.logger.Error("failed to list waf exclusions", zap.String("cluster_id", cluster.ID), zap.Error(err))
+	}
+	return exclusions
+}
+
+// clusterCertificateFiles returns the certificate files of every TLS server block. They are
+// written on each config sync, so new and recreated nodes get them too.
+func (s *nginxClusterService) clusterCertificateFiles(clusterID string) []docker.ContainerFile {
+	state := s.loadClusterServerBlocks(clusterID)
+	var files []docker.ContainerFile
+	for _, block := range state.blocks {
+		cert, ok := state.certs[block.ID]
+		if !ok {
+			continue
+		}
+		certDir := clusterServerBlockCertDir(block.ID)
+		files = append(files,
+			docker.ContainerFile{Path: certDir + "/fullchain.pem", Content: []byte(cert.Certificate)},
+			docker.ContainerFile{Path: certDir + "/privkey.pem", Content: []byte(cert.PrivateKey), Mode: 0600},
+		)
+	}
+	return files
+}
+
+// RefreshServerBlocks re-renders the server block section of the cluster config from the
+// stored blocks and certificates and syncs it to every node
+func (s *nginxClusterService) RefreshServerBlocks(ctx context.Context, clusterID string) error {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return fmt.Errorf("cluster not found: %w", err)
+	}
+	section := s.renderServerBlockSection(cluster, cluster.WAFMode, s.clusterWAFExclusions(cluster))
+	config, err := setClusterServerBlocks(cluster.NginxConfig, section)
+	if err != nil {
+		return err
+	}
+	if config == cluster.NginxConfig {
+		return s.applyClusterConfig(ctx, cluster, nginxConfigChange{action: "synced"})
+	}
+	cluster.NginxConfig = config
+	return s.applyClusterConfig(ctx, cluster, nginxConfigChange{action: nginxActionServerBlocks})
+}
+
+// SetServerBlockWAFMode sets the WAF mode of one server block; an empty mode makes the
+// block follow the cluster mode again
+func (s *nginxClusterService) SetServerBlockWAFMode(ctx context.Context, clusterID, blockID string, req dto.SetServerBlockWAFModeRequest) (*dto.ServerBlockInfo, error) {
+	if req.Mode != "" && !validWAFMode(req.Mode) {
+		return nil, fmt.Errorf("unknown waf mode %q", req.Mode)
+	}
+	cluster, err := s.findWAFCluster(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	block, err := s.clusterRepo.FindServerBlockByID(blockID)
+	if err != nil || block.ClusterID != cluster.ID {
+		return nil, fmt.Errorf("server block not found")
+	}
+
+	previousMode := block.WAFMode
+	block.WAFMode = req.Mode
+	if err := s.clusterRepo.UpdateServerBlock(block); err != nil {
+		return nil, err
+	}
+	if err := s.RefreshServerBlocks(ctx, clusterID); err != nil {
+		block.WAFMode = previousMode
+		s.clusterRepo.UpdateServerBlock(block)
+		return nil, err
+	}
+	s.publishEvent(ctx, "nginx_cluster."+nginxWAFModeAction, cluster.InfrastructureID, clusterID, string(entities.StatusRunning))
+	return &dto.ServerBlockInfo{
+		ID:         block.ID,
+		ServerName: block.ServerName,
+		ListenPort: block.ListenPort,
+		SSLEnabled: block.SSLEnabled,
+		WAFMode:    block.WAFMode,
+	}, nil
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// serverBlockClusterRepo serves one TLS server block on a two node cluster; other calls panic
+type serverBlockClusterRepo struct {
+	repositories.INginxClusterRepository
+}
+
+func (serverBlockClusterRepo) ListUpstreams(string) ([]entities.NginxClusterUpstream, error) {
+	return nil, nil
+}
+
+func (serverBlockClusterRepo) ListServerBlocks(string) ([]entities.NginxServerBlock, error) {
+	return []entities.NginxServerBlock{
+		{ID: "sb-1", ServerName: "shop.example.com", ListenPort: 443, SSLEnabled: true},
+		{ID: "sb-2", ServerName: "plain.example.com", ListenPort: 80},
+	}, nil
+}
+
+func (serverBlockClusterRepo) ListLocations(serverBlockID string) ([]entities.NginxLocation, error) {
+	if serverBlockID != "sb-1" {
+		return nil, nil
+	}
+	return []entities.NginxLocation{{ID: "loc-1", ServerBlockID: "sb-1", Path: "/api", ProxyPass: "backend:8080"}}, nil
+}
+
+func (serverBlockClusterRepo) ListNodes(string) ([]entities.NginxNode, error) {
+	return []entities.NginxNode{
+		{ID: "node-1", Name: "edge-1", ContainerID: "c1", Role: "master"},
+		{ID: "node-2", Name: "edge-2", ContainerID: "c2", Role: "backup"},
+	}, nil
+}
+
+// certificateNginxRepo holds the certificate of server block sb-1; other calls panic
+type certificateNginxRepo struct {
+	repositories.INginxRepository
+}
+
+func (certificateNginxRepo) GetCertificate(nginxID string) (*entities.NginxCertificate, error) {
+	if nginxID != "sb-1" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &entities.NginxCertificate{NginxID: "sb-1", OwnerType: "server_block", Certificate: "CERT", PrivateKey: "KEY"}, nil
+}
+
+func TestGenerateClusterConfigServerBlockCertificates(t *testing.T) {
+	svc := &nginxClusterService{clusterRepo: serverBlockClusterRepo{}, nginxRepo: certificateNginxRepo{}, logger: discardLogger{}}
+	config := svc.generateNginxConfig(&entities.NginxCluster{ID: "cluster-1", ClusterName: "edge", WorkerConnections: 1024})
+
+	assert.Contains(t, config, nginxServerBlocksBeginLine)
+	assert.Contains(t, config, "        listen 443 ssl;\n"+
+		"        ssl_certificate /etc/nginx/ssl/sb-1/fullchain.pem;\n"+
+		"        ssl_certificate_key /etc/nginx/ssl/sb-1/privkey.pem;\n"+
+		"        server_name shop.example.com;\n")
+	assert.Contains(t, config, "            proxy_pass http://backend:8080;\n")
+	assert.Contains(t, config, "        listen 80;\n        server_name plain.example.com;\n")
+	assert.NotContains(t, config, "/etc/nginx/ssl/sb-2/")
+	assert.NotContains(t, config, "listen 443;\n")
+}
+
+func TestSetClusterServerBlocks(t *testing.T) {
+	base := "http {\n    # Default Server\n    server {\n    }\n}\n"
+	first := renderClusterServerBlocks(clusterServerBlocks{blocks: []entities.NginxServerBlock{{ID: "sb-1", ServerName: "a.example.com"}}})
+
+	config, err := setClusterServerBlocks(base, first)
+	require.NoError(t, err)
+	assert.Contains(t, config, first+"\n    # Default Server\n")
+
+	// A second render replaces the section instead of adding another one
+	second := renderClusterServerBlocks(clusterServerBlocks{blocks: []entities.NginxServerBlock{{ID: "sb-2", ServerName: "b.example.com"}}})
+	config, err = setClusterServerBlocks(config, second)
+	require.NoError(t, err)
+	assert.NotContains(t, config, "a.example.com")
+	assert.Contains(t, config, "server_name b.example.com;")
+	assert.Equal(t, 1, strings.Count(config, nginxServerBlocksEndLine))
+
+	_, err = setClusterServerBlocks("events {}\n", first)
+	assert.Error(t, err)
+}
+
+func TestRenderClusterServerBlocksWAFMode(t *testing.T) {
+	state := clusterServerBlocks{
+		blocks: []entities.NginxServerBlock{
+			{ID: "sb-1", ServerName: "shop.example.com"},
+			{ID: "sb-2", ServerName: "admin.example.com", WAFMode: entities.NginxWAFOff},
+			{ID: "sb-3", ServerName: "api.example.com", WAFMode: entities.NginxWAFDetectionOnly},
+		},
+		wafMode:       entities.NginxWAFBlocking,
+		wafExclusions: []entities.NginxWAFExclusion{{RuleID: 942100}},
+	}
+	section := renderClusterServerBlocks(state)
+	blocks := strings.Split(section, "    server {\n")
+	require.Len(t, blocks, 4)
+
+	// Blocks without a mode of their own follow the cluster, exclusions included
+	assert.Contains(t, blocks[1], "server_name shop.example.com;\n        modsecurity on;\n")
+	assert.Contains(t, blocks[1], "SecRuleEngine On")
+	assert.Contains(t, blocks[1], "SecRuleRemoveById 942100")
+	assert.Contains(t, blocks[2], "server_name admin.example.com;\n        modsecurity off;\n")
+	assert.NotContains(t, blocks[2], "SecRuleEngine")
+	assert.Contains(t, blocks[3], "SecRuleEngine DetectionOnly")
+
+	// Without the ModSecurity module nothing is rendered, whatever the block asks for
+	state.wafMode = ""
+	assert.NotContains(t, renderClusterServerBlocks(state), "modsecurity")
+}
+
+func TestGenerateClusterConfigServerBlockWAFMode(t *testing.T) {
+	svc := &nginxClusterService{clusterRepo: wafServerBlockClusterRepo{}, nginxRepo: certificateNginxRepo{}, logger: discardLogger{}}
+	cluster := &entities.NginxCluster{ID: "cluster-1", ClusterName: "edge", WAFEnabled: true, WAFMode: entities.NginxWAFDetectionOnly, WorkerConnections: 1024}
+
+	config := svc.generateNginxConfig(cluster)
+	section := config[strings.Index(config, nginxServerBlocksBeginLine):strings.Index(config, nginxServerBlocksEndLine)]
+	assert.Contains(t, section, "server_name waf.example.com;\n        modsecurity on;\n")
+	assert.Contains(t, section, "SecRuleEngine On")
+	assert.Contains(t, section, "server_name follow.example.com;\n        modsecurity on;\n")
+	assert.Contains(t, section, "SecRuleEngine DetectionOnly")
+
+	cluster.WAFEnabled = false
+	assert.NotContains(t, svc.generateNginxConfig(cluster), "modsecurity")
+}
+
+// wafServerBlockClusterRepo serves one block that overrides the cluster WAF mode and one
+// that follows it; other calls panic
+type wafServerBlockClusterRepo struct {
+	noUpstreamsClusterRepo
+}
+
+func (wafServerBlockClusterRepo) ListServerBlocks(string) ([]entities.NginxServerBlock, error) {
+	return []entities.NginxServerBlock{
+		{ID: "sb-1", ServerName: "waf.example.com", WAFMode: entities.NginxWAFBlocking},
+		{ID: "sb-2", ServerName: "follow.example.com"},
+	}, nil
+}
+
+func (wafServerBlockClusterRepo) ListLocations(string) ([]entities.NginxLocation, error) {
+	return nil, nil
+}
+
+func TestSyncConfigWritesServerBlockCertificates(t *testing.T) {
+	dockerSvc := newScriptedDocker(healthyNginx)
+	svc := &nginxClusterService{clusterRepo: serverBlockClusterRepo{}, nginxRepo: certificateNginxRepo{}, dockerSvc: dockerSvc, logger: discardLogger{}}
+
+	success, _, err := svc.syncConfigToNodes(context.Background(), "cluster-1", "events {}\n")
+	require.NoError(t, err)
+	assert.True(t, success)
+
+	// Every node gets the files, not only the one the certificate was issued on
+	for _, containerID := range []string{"c1", "c2"} {
+		assert.Equal(t, "CERT", dockerSvc.file(containerID, "/etc/nginx/ssl/sb-1/fullchain.pem"))
+		assert.Equal(t, "KEY", dockerSvc.file(containerID, "/etc/nginx/ssl/sb-1/privkey.pem"))
+	}
+
+	files := svc.clusterCertificateFiles("cluster-1")
+	require.Len(t, files, 2)
+	assert.Equal(t, int64(0600), files[1].Mode)
+}
@@ -49,6 +49,8 @@ type INginxClusterService interface {
 	AddServerBlock(ctx context.Context, clusterID string, req dto.AddNginxServerBlockRequest) error
 	DeleteServerBlock(ctx context.Context, clusterID, blockID string) error
 	ListServerBlocks(ctx context.Context, clusterID string) ([]dto.ServerBlockInfo, error)
+	RefreshServerBlocks(ctx context.Context, clusterID string) error
+	SetServerBlockWAFMode(ctx context.Context, clusterID, blockID string, req dto.SetServerBlockWAFModeRequest) (*dto.ServerBlockInfo, error)
 
 	// Health & Monitoring
 	GetClusterHealth(ctx context.Context, clusterID string) (*dto.NginxClusterHealthResponse, error)
@@ -59,20 +61,55 @@ type INginxClusterService interface {
 	// Failover
 	TriggerFailover(ctx context.Context, clusterID string, req dto.TriggerNginxFailoverRequest) (*dto.NginxFailoverResponse, error)
 	GetFailoverHistory(ctx context.Context, clusterID string) (*dto.NginxFailoverHistoryResponse, error)
+
+	// Config revisions
+	ListConfigRevisions(ctx context.Context, clusterID string) ([]dto.NginxConfigRevisionInfo, error)
+	GetConfigRevision(ctx context.Context, clusterID string, revision int) (*dto.NginxConfigRevisionInfo, error)
+	DiffConfigRevisions(ctx context.Context, clusterID string, from, to int) (*dto.NginxConfigDiffResponse, error)
+	RollbackConfig(ctx context.Context, clusterID string, revision int) (*dto.NginxConfigRevisionInfo, error)
+
+	// Web application firewall
+	GetWAFPolicy(ctx context.Context, clusterID string) (*dto.WAFPolicyInfo, error)
+	SetWAFMode(ctx context.Context, clusterID string, req dto.SetWAFModeRequest) (*dto.WAFPolicyInfo, error)
+	AddWAFExclusion(ctx context.Context, clusterID string, req dto.AddWAFExclusionRequest) (*dto.WAFExclusionInfo, error)
+	DeleteWAFExclusion(ctx context.Context, clusterID, exclusionID string) error
+
+	// Health monitoring
+	SetWebSocketHandler(handler NginxClusterBroadcaster)
+	StartHealthMonitor(ctx context.Context)
+	StartMetricsCollector(ctx context.Context)
+	StartAccessLogCollector(ctx context.Context)
+
+	// Docker service replicas
+	SetUpstreamRequestRecorder(recorder UpstreamRequestRecorder)
+	SyncDockerServiceBackends(ctx context.Context, service *entities.DockerService) (int, error)
 }
 
 type nginxClusterService struct {
 	infraRepo     repositories.IInfrastructureRepository
 	clusterRepo   repositories.INginxClusterRepository
+	nginxRepo     repositories.INginxRepository // server block certificates
+	revisionRepo  repositories.INginxConfigRevisionRepository
+	wafRepo       repositories.INginxWAFRepository
 	dockerSvc     docker.IDockerService
 	kafkaProducer kafka.IKafkaProducer
 	logger        logger.ILogger
+	broadcaster    NginxClusterBroadcaster
+	health         *nginxHealthState
+	upstreamHealth *upstreamHealthTracker
+	requestRates   *requestRateTracker
+	accessLogs     *accessLogCursor
+
+	requestRecorder UpstreamRequestRecorder
 }
 
 // NewNginxClusterService creates a new Nginx cluster service
 func NewNginxClusterService(
 	infraRepo repositories.IInfrastructureRepository,
 	clusterRepo repositories.INginxClusterRepository,
+	nginxRepo repositories.INginxRepository,
+	revisionRepo repositories.INginxConfigRevisionRepository,
+	wafRepo repositories.INginxWAFRepository,
 	dockerSvc docker.IDockerService,
 	kafkaProducer kafka.IKafkaProducer,
 	logger logger.ILogger,
@@ -80,9 +117,16 @@ func NewNginxClusterService(
 	return &nginxClusterService{
 		infraRepo:     infraRepo,
 		clusterRepo:   clusterRepo,
+		nginxRepo:     nginxRepo,
+		revisionRepo:  revisionRepo,
+		wafRepo:       wafRepo,
 		dockerSvc:     dockerSvc,
 		kafkaProducer: kafkaProducer,
 		logger:        logger,
+		health:         newNginxHealthState(),
+		upstreamHealth: newUpstreamHealthTracker(),
+		requestRates:   newRequestRateTracker(),
+		accessLogs:     newAccessLogCursor(),
 	}
 }
 
@@ -188,6 +232,10 @@ func (s *nginxClusterService) CreateCluster(ctx context.Context, userID string,
 		AccessLogEnabled: req.AccessLogEnabled,
 		ErrorLogLevel:    req.ErrorLogLevel,
 
+		// WAF
+		WAFEnabled: req.WAFEnabled,
+		WAFMode:    entities.NginxWAFOff,
+
 		// Caching
 		CacheEnabled: req.CacheEnabled,
 		CachePath:    req.CachePath,
@@ -214,12 +262,20 @@ func (s *nginxClusterService) CreateCluster(ctx context.Context, userID string,
 
 	// Create dedicated network
 	networkName := fmt.Sprintf("nginx-cluster-%s", clusterID[:8])
-	networkID, err := s.dockerSvc.CreateNetwork(ctx, networkName)
+	networkID, virtualIP, subnet, err := s.createClusterNetwork(ctx, networkName, req.VirtualIP)
 	if err != nil {
 		s.updateInfraStatus(infraID, entities.StatusFailed)
 		return nil, fmt.Errorf("failed to create network: %w", err)
 	}
+	authPass, err := generateVRRPPassword()
+	if err != nil {
+		s.updateInfraStatus(infraID, entities.StatusFailed)
+		return nil, fmt.Errorf("failed to generate VRRP password: %w", err)
+	}
 	cluster.NetworkID = networkID
+	cluster.VirtualIP = virtualIP
+	cluster.VRRPSubnet = subnet
+	cluster.VRRPAuthPass = authPass
 	s.clusterRepo.Update(cluster)
 
 	// Create Nginx nodes
@@ -229,6 +285,7 @@ func (s *nginxClusterService) CreateCluster(ctx context.Context, userID string,
 		role := "backup"
 		if i == 0 {
 			role = "master"
+			priority = keepalivedMasterPriority
 		}
 
 		node, err := s.createNginxNode(ctx, cluster, req, i, networkName, role, priority)
@@ -249,6 +306,13 @@ func (s *nginxClusterService) CreateCluster(ctx context.Context, userID string,
 		}
 	}
 
+	// Start VRRP now that every node address is known; without it the VIP never comes up
+	if err := s.configureKeepalived(ctx, cluster); err != nil {
+		s.logger.Error("failed to configure keepalived", zap.Error(err))
+		s.cleanup(ctx, cluster, networkID)
+		return nil, err
+	}
+
 	// Create upstreams if provided
 	for _, upstream := range req.Upstreams {
 		if err := s.createUpstream(ctx, clusterID, upstream); err != nil {
@@ -289,7 +353,7 @@ func (s *nginxClusterService) createNginxNode(ctx context.Context, cluster *enti
 		fmt.Sprintf("NGINX_NODE_ROLE=%s", role),
 		fmt.Sprintf("KEEPALIVED_STATE=%s", strings.ToUpper(role)),
 		fmt.Sprintf("KEEPALIVED_PRIORITY=%d", priority),
-		"KEEPALIVED_INTERFACE=eth0",
+		fmt.Sprintf("KEEPALIVED_INTERFACE=%s", cluster.VRRPInterface),
 		fmt.Sprintf("KEEPALIVED_ROUTER_ID=%d", cluster.VRRPRouterID),
 		fmt.Sprintf("VIRTUAL_IP=%s", cluster.VirtualIP),
 		fmt.Sprintf("HTTP_PORT=%d", cluster.HTTPPort),
@@ -302,13 +366,23 @@ func (s *nginxClusterService) createNginxNode(ctx context.Context, cluster *enti
 		ports["443"] = fmt.Sprintf("%d", httpsPort)
 	}
 
+	image, user := keepalivedNodeImage, ""
+	if cluster.WAFEnabled {
+		// keepalived needs root to use the node's capabilities
+		image, user = keepalivedWAFNodeImage, nginxWAFUser
+		env = append(env, nginxWAFEnv...)
+	}
+
 	containerID, err := s.dockerSvc.CreateContainer(ctx, docker.ContainerConfig{
 		Name:         nodeName,
-		Image:        "nginx:alpine",
+		Image:        image,
 		Network:      networkName,
 		NetworkAlias: nodeName,
 		Env:          env,
 		Ports:        ports,
+		Cmd:          keepalivedNodeCmd,
+		CapAdd:       keepalivedCapabilities,
+		User:         user,
 		Resources: docker.ResourceConfig{
 			CPULimit:    cluster.CPULimit,
 			MemoryLimit: cluster.MemoryLimit,
@@ -322,12 +396,17 @@ func (s *nginxClusterService) createNginxNode(ctx context.Context, cluster *enti
 	if err := s.dockerSvc.StartContainer(ctx, containerID); err != nil {
 		return nil, fmt.Errorf("failed to start container: %w", err)
 	}
+	if err := s.checkKeepalived(ctx, containerID); err != nil {
+		s.dockerSvc.StopContainer(ctx, containerID)
+		s.dockerSvc.RemoveContainer(ctx, containerID)
+		return nil, fmt.Errorf("node %s cannot hold the virtual IP: %w", nodeName, err)
+	}
 
 	// Get container IP
 	containerInfo, err := s.dockerSvc.InspectContainer(ctx, containerID)
 	ipAddress := ""
-	if err == nil && containerInfo != nil && containerInfo.NetworkSettings != nil {
-		ipAddress = containerInfo.NetworkSettings.IPAddress
+	if err == nil {
+		ipAddress = containerNetworkIP(containerInfo, networkName)
 	}
 
 	// Create node record
@@ -464,6 +543,8 @@ func (s *nginxClusterService) GetClusterInfo(ctx context.Context, clusterID stri
 		HTTPSPort:        cluster.HTTPSPort,
 		LoadBalanceMode:  cluster.LoadBalanceMode,
 		SSLEnabled:       cluster.SSLEnabled,
+		WAFEnabled:       cluster.WAFEnabled,
+		WAFMode:          cluster.WAFMode,
 		Upstreams:        upstreams,
 		ServerBlocks:     serverBlocks,
 		Endpoints:        endpoints,
@@ -495,6 +576,8 @@ func (s *nginxClusterService) DeleteCluster(ctx context.Context, clusterID strin
 	}
 
 	// Delete cluster and infrastructure
+	s.revisionRepo.DeleteByResource(entities.NginxRevisionCluster, clusterID)
+	s.wafRepo.DeleteByResource(entities.NginxRevisionCluster, clusterID)
 	s.clusterRepo.Delete(clusterID)
 	s.infraRepo.Delete(cluster.InfrastructureID)
 
@@ -575,6 +658,22 @@ func (s *nginxClusterService) AddNode(ctx context.Context, clusterID string, req
 	cluster.NodeCount++
 	s.clusterRepo.Update(cluster)
 
+	// The new node starts from the image's config; give it the cluster's config and certificates
+	if cluster.NginxConfig != "" {
+		err := s.writeClusterFiles(ctx, node.ContainerID, s.clusterCertificateFiles(clusterID))
+		if err == nil {
+			err = s.syncConfigToNode(ctx, node, cluster.NginxConfig)
+		}
+		if err != nil {
+			s.logger.Warn("failed to sync config to new node", zap.String("node", node.Name), zap.Error(err))
+		}
+	}
+
+	// Existing nodes need the new node as a unicast peer
+	if err := s.configureKeepalived(ctx, cluster); err != nil {
+		s.logger.Warn("failed to configure keepalived", zap.Error(err))
+	}
+
 	return &dto.NginxNodeInfo{
 		ID:          node.ID,
 		Name:        node.Name,
@@ -613,6 +712,10 @@ func (s *nginxClusterService) RemoveNode(ctx context.Context, clusterID, nodeID
 	cluster.NodeCount--
 	s.clusterRepo.Update(cluster)
 
+	if err := s.configureKeepalived(ctx, cluster); err != nil {
+		s.logger.Warn("failed to configure keepalived", zap.Error(err))
+	}
+
 	return nil
 }
 
@@ -646,12 +749,15 @@ func (s *nginxClusterService) UpdateClusterConfig(ctx context.Context, clusterID
 	}
 
 	cluster.NginxConfig = req.NginxConfig
-	s.clusterRepo.Update(cluster)
+	change := nginxConfigChange{action: "config_updated"}
 
-	if req.ReloadAll {
-		return s.SyncConfig(ctx, clusterID)
+	if !req.ReloadAll {
+		// Stored only; validated and applied on the next sync
+		s.clusterRepo.Update(cluster)
+		s.recordClusterRevision(ctx, cluster, change, entities.NginxRevisionPending, "")
+		return nil
 	}
-	return nil
+	return s.applyClusterConfig(ctx, cluster, change)
 }
 
 // SyncConfig synchronizes configuration to all nodes following NGINX best practices
@@ -661,19 +767,70 @@ func (s *nginxClusterService) SyncConfig(ctx context.Context, clusterID string)
 	if err != nil {
 		return fmt.Errorf("cluster not found: %w", err)
 	}
+	return s.applyClusterConfig(ctx, cluster, nginxConfigChange{action: "synced"})
+}
+
+// applyClusterConfig syncs cluster.NginxConfig to every node and records it as a revision.
+// When validation, the sync or the post-reload health check fails, the last valid
+// revision is synced back and stored as the cluster config again.
+func (s *nginxClusterService) applyClusterConfig(ctx context.Context, cluster *entities.NginxCluster, change nginxConfigChange) error {
+	previous, _ := s.revisionRepo.FindLatestByStatus(entities.NginxRevisionCluster, cluster.ID, entities.NginxRevisionValid)
+
+	status := entities.NginxRevisionValid
+	applied, output, err := s.syncConfigToNodes(ctx, cluster.ID, cluster.NginxConfig)
+	if err != nil {
+		status = entities.NginxRevisionInvalid
+	} else if unhealthy := s.unhealthyNodesAfterReload(ctx, cluster); len(unhealthy) > 0 {
+		status = entities.NginxRevisionUnhealthy
+		err = fmt.Errorf("nodes failed health check after reload: %v", unhealthy)
+	}
+
+	if err == nil {
+		s.clusterRepo.Update(cluster)
+		s.recordClusterRevision(ctx, cluster, change, status, output)
+		return nil
+	}
+
+	s.recordClusterRevision(ctx, cluster, change, status, err.Error())
+	if previous == nil {
+		s.clusterRepo.Update(cluster)
+		return err
+	}
+
+	cluster.NginxConfig = previous.Config
+	s.clusterRepo.Update(cluster)
+	if applied {
+		s.logger.Warn("restoring last valid nginx cluster config",
+			zap.String("cluster_id", cluster.ID), zap.Int("revision", previous.Revision))
+		if _, _, restoreErr := s.syncConfigToNodes(ctx, cluster.ID, previous.Config); restoreErr != nil {
+			return fmt.Errorf("%w; restoring revision %d also failed: %v", err, previous.Revision, restoreErr)
+		}
+	}
+	return fmt.Errorf("%w; restored revision %d", err, previous.Revision)
+}
 
+// syncConfigToNodes validates config on the master, then writes and reloads it on every node.
+// applied reports whether any node may be running the new config.
+func (s *nginxClusterService) syncConfigToNodes(ctx context.Context, clusterID, config string) (bool, string, error) {
 	s.logger.Info("starting config synchronization", zap.String("cluster_id", clusterID))
 
 	// Step 1: Validate config on primary (master) node first
 	masterNode, err := s.getMasterNode(clusterID)
 	if err != nil {
-		return fmt.Errorf("failed to get master node: %w", err)
+		return false, "", fmt.Errorf("failed to get master node: %w", err)
+	}
+
+	// Certificates referenced by server blocks have to be in place before nginx -t
+	certFiles := s.clusterCertificateFiles(clusterID)
+	if err := s.writeClusterFiles(ctx, masterNode.ContainerID, certFiles); err != nil {
+		return false, "", fmt.Errorf("failed to write certificates on master: %w", err)
 	}
 
 	// Validate on master
-	if err := s.validateNginxConfig(ctx, masterNode.ContainerID, cluster.NginxConfig); err != nil {
+	output, err := s.validateNginxConfig(ctx, masterNode.ContainerID, config)
+	if err != nil {
 		s.logger.Error("config validation failed on master", zap.Error(err))
-		return fmt.Errorf("config validation failed on master: %w", err)
+		return false, output, fmt.Errorf("config validation failed on master: %w", err)
 	}
 
 	s.logger.Info("config validated on master node", zap.String("master_node", masterNode.Name))
@@ -686,7 +843,7 @@ func (s *nginxClusterService) SyncConfig(ctx context.Context, clusterID string)
 	for _, node := range nodes {
 		if node.ID == masterNode.ID {
 			// Master already validated, just apply
-			if err := s.applyConfigToNode(ctx, node.ContainerID, cluster.NginxConfig); err != nil {
+			if err := s.applyConfigToNode(ctx, node.ContainerID, config); err != nil {
 				s.logger.Error("failed to apply config to master", zap.String("node_id", node.ID), zap.Error(err))
 				failedNodes = append(failedNodes, node.Name)
 			} else {
@@ -696,7 +853,11 @@ func (s *nginxClusterService) SyncConfig(ctx context.Context, clusterID string)
 		}
 
 		// For peer nodes: backup -> validate -> apply -> reload
-		if err := s.syncConfigToNode(ctx, &node, cluster.NginxConfig); err != nil {
+		err := s.writeClusterFiles(ctx, node.ContainerID, certFiles)
+		if err == nil {
+			err = s.syncConfigToNode(ctx, &node, config)
+		}
+		if err != nil {
 			s.logger.Error("failed to sync config to peer", zap.String("node_id", node.ID), zap.Error(err))
 			failedNodes = append(failedNodes, node.Name)
 		} else {
@@ -710,15 +871,67 @@ func (s *nginxClusterService) SyncConfig(ctx context.Context, clusterID string)
 		zap.Strings("failed_nodes", failedNodes))
 
 	if len(failedNodes) > 0 {
-		return fmt.Errorf("config sync failed on %d nodes: %v", len(failedNodes), failedNodes)
+		return successCount > 0, output, fmt.Errorf("config sync failed on %d nodes: %v", len(failedNodes), failedNodes)
 	}
 
-	return nil
+	return true, output, nil
+}
+
+func (s *nginxClusterService) writeClusterFiles(ctx context.Context, containerID string, files []docker.ContainerFile) error {
+	if len(files) == 0 {
+		return nil
+	}
+	return s.dockerSvc.WriteFiles(ctx, containerID, files)
+}
+
+// unhealthyNodesAfterReload probes the health check path on every running node
+func (s *nginxClusterService) unhealthyNodesAfterReload(ctx context.Context, cluster *entities.NginxCluster) []string {
+	if !cluster.HealthCheckEnabled || cluster.HealthCheckPath == "" {
+		return nil
+	}
+	nodes, _ := s.clusterRepo.ListNodes(cluster.ID)
+	var unhealthy []string
+	for _, node := range nodes {
+		if !s.checkNodeHealth(ctx, &node) {
+			continue
+		}
+		if !probeNginxHealth(ctx, s.dockerSvc, node.ContainerID, cluster.HealthCheckPath) {
+			unhealthy = append(unhealthy, node.Name)
+		}
+	}
+	return unhealthy
+}
+
+// recordClusterRevision stores the cluster's current NginxConfig as a new revision
+func (s *nginxClusterService) recordClusterRevision(ctx context.Context, cluster *entities.NginxCluster, change nginxConfigChange, status, output string) {
+	revision := &entities.NginxConfigRevision{
+		ID:               uuid.New().String(),
+		ResourceType:     entities.NginxRevisionCluster,
+		ResourceID:       cluster.ID,
+		Revision:         1,
+		Config:           cluster.NginxConfig,
+		Action:           change.action,
+		Author:           configAuthor(ctx),
+		ValidationStatus: status,
+		ValidationOutput: output,
+		RollbackOf:       change.rollbackOf,
+	}
+	if latest, err := s.revisionRepo.FindLatest(entities.NginxRevisionCluster, cluster.ID); err == nil {
+		revision.Revision = latest.Revision + 1
+		revision.Diff = diffConfig(fmt.Sprintf("revision %d", latest.Revision), fmt.Sprintf("revision %d", revision.Revision), latest.Config, cluster.NginxConfig)
+	} else {
+		revision.Diff = diffConfig("/dev/null", "revision 1", "", cluster.NginxConfig)
+	}
+	if err := s.revisionRepo.Create(revision); err != nil {
+		s.logger.Error("failed to record nginx cluster config revision", zap.String("cluster_id", cluster.ID), zap.Error(err))
+	}
 }
 
 // syncConfigToNode syncs config to a single peer node with backup and rollback
 func (s *nginxClusterService) syncConfigToNode(ctx context.Context, node *entities.NginxNode, config string) error {
 	containerID := node.ContainerID
+	current, _ := s.dockerSvc.ExecCommand(ctx, containerID, []string{"cat", "/etc/nginx/nginx.conf"})
+	restart := listenPortsChanged(current, config)
 
 	// Step 1: Backup current config
 	backupPath := fmt.Sprintf("/etc/nginx/nginx.conf.backup.%d", time.Now().Unix())
@@ -730,13 +943,12 @@ func (s *nginxClusterService) syncConfigToNode(ctx context.Context, node *entiti
 	s.logger.Info("config backed up", zap.String("node", node.Name), zap.String("backup_path", backupPath))
 
 	// Step 2: Write new config
-	writeCmd := fmt.Sprintf("cat > /etc/nginx/nginx.conf << 'EOF'\n%s\nEOF", config)
-	if _, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", writeCmd}); err != nil {
+	if err := s.dockerSvc.WriteFiles(ctx, containerID, []docker.ContainerFile{{Path: "/etc/nginx/nginx.conf", Content: []byte(config)}}); err != nil {
 		return fmt.Errorf("failed to write config: %w", err)
 	}
 
 	// Step 3: Validate new config
-	if err := s.validateNginxConfig(ctx, containerID, config); err != nil {
+	if _, err := s.validateNginxConfig(ctx, containerID, config); err != nil {
 		// Rollback on validation failure
 		s.logger.Warn("validation failed, rolling back", zap.String("node", node.Name))
 		rollbackCmd := fmt.Sprintf("cp %s /etc/nginx/nginx.conf", backupPath)
@@ -744,12 +956,13 @@ func (s *nginxClusterService) syncConfigToNode(ctx context.Context, node *entiti
 		return fmt.Errorf("config validation failed, rolled back: %w", err)
 	}
 
-	// Step 4: Reload nginx
-	if _, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"nginx", "-s", "reload"}); err != nil {
+	// Step 4: Reload nginx, restarting only when the listen ports changed
+	if _, err := reloadNginx(ctx, s.dockerSvc, containerID, restart); err != nil {
 		// Rollback on reload failure
 		s.logger.Warn("reload failed, rolling back", zap.String("node", node.Name))
-		rollbackCmd := fmt.Sprintf("cp %s /etc/nginx/nginx.conf && nginx -s reload", backupPath)
+		rollbackCmd := fmt.Sprintf("cp %s /etc/nginx/nginx.conf", backupPath)
 		s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", rollbackCmd})
+		reloadNginx(ctx, s.dockerSvc, containerID, restart)
 		return fmt.Errorf("nginx reload failed, rolled back: %w", err)
 	}
 
@@ -757,26 +970,40 @@ func (s *nginxClusterService) syncConfigToNode(ctx context.Context, node *entiti
 	return nil
 }
 
-// validateNginxConfig validates nginx configuration
-func (s *nginxClusterService) validateNginxConfig(ctx context.Context, containerID string, config string) error {
+// validateNginxConfig validates nginx configuration and returns the nginx -t output
+func (s *nginxClusterService) validateNginxConfig(ctx context.Context, containerID string, config string) (string, error) {
 	// Write config to temp file and test
-	testCmd := fmt.Sprintf("cat > /tmp/nginx.conf.test << 'EOF'\n%s\nEOF && nginx -t -c /tmp/nginx.conf.test", config)
-	output, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", testCmd})
+	if err := s.dockerSvc.WriteFiles(ctx, containerID, []docker.ContainerFile{{Path: "/tmp/nginx.conf.test", Content: []byte(config)}}); err != nil {
+		return "", fmt.Errorf("failed to write config for nginx -t: %w", err)
+	}
+	output, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"nginx", "-t", "-c", "/tmp/nginx.conf.test"})
+	output = strings.TrimSpace(output)
 	if err != nil {
-		return fmt.Errorf("nginx -t failed: %w, output: %s", err, output)
+		return output, fmt.Errorf("nginx -t failed: %w, output: %s", err, output)
+	}
+	// Exec does not report the exit code, so rely on nginx's own verdict
+	if !strings.Contains(output, "test is successful") {
+		configErr := newNginxConfigError(output, map[string]string{"/tmp/nginx.conf.test": config})
+		for i := range configErr.Issues {
+			if configErr.Issues[i].File == "/tmp/nginx.conf.test" {
+				configErr.Issues[i].File = "nginx.conf"
+			}
+		}
+		return output, configErr
 	}
-	return nil
+	return output, nil
 }
 
 // applyConfigToNode applies config without validation (already validated)
 func (s *nginxClusterService) applyConfigToNode(ctx context.Context, containerID string, config string) error {
-	writeCmd := fmt.Sprintf("cat > /etc/nginx/nginx.conf << 'EOF'\n%s\nEOF", config)
-	if _, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", writeCmd}); err != nil {
+	current, _ := s.dockerSvc.ExecCommand(ctx, containerID, []string{"cat", "/etc/nginx/nginx.conf"})
+
+	if err := s.dockerSvc.WriteFiles(ctx, containerID, []docker.ContainerFile{{Path: "/etc/nginx/nginx.conf", Content: []byte(config)}}); err != nil {
 		return fmt.Errorf("failed to write config: %w", err)
 	}
 
-	if _, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"nginx", "-s", "reload"}); err != nil {
-		return fmt.Errorf("nginx reload failed: %w", err)
+	if _, err := reloadNginx(ctx, s.dockerSvc, containerID, listenPortsChanged(current, config)); err != nil {
+		return err
 	}
 
 	return nil
@@ -800,11 +1027,8 @@ func (s *nginxClusterService) getMasterNode(clusterID string) (*entities.NginxNo
 
 // generateAndApplyConfig generates default nginx config and applies to all nodes
 func (s *nginxClusterService) generateAndApplyConfig(ctx context.Context, cluster *entities.NginxCluster) error {
-	config := s.generateNginxConfig(cluster)
-	cluster.NginxConfig = config
-	s.clusterRepo.Update(cluster)
-
-	return s.SyncConfig(ctx, cluster.ID)
+	cluster.NginxConfig = s.generateNginxConfig(cluster)
+	return s.applyClusterConfig(ctx, cluster, nginxConfigChange{action: nginxActionCreated})
 }
 
 // generateNginxConfig generates nginx configuration from cluster settings
@@ -814,12 +1038,20 @@ func (s *nginxClusterService) generateNginxConfig(cluster *entities.NginxCluster
 		workerProcesses = fmt.Sprintf("%d", cluster.WorkerProcesses)
 	}
 
+	// The ModSecurity module is dynamic and has to be loaded before anything else
+	loadModules := ""
+	wafOff := ""
+	if cluster.WAFEnabled {
+		loadModules = "load_module " + nginxWAFModule + ";\n"
+		wafOff = "            modsecurity off;\n"
+	}
+
 	// Build configuration
 	config := fmt.Sprintf(`# Nginx Configuration - Generated by IaaS Platform
 # Cluster: %s
 # Generated at: %s
 
-worker_processes %s;
+%sworker_processes %s;
 error_log /var/log/nginx/error.log %s;
 pid /var/run/nginx.pid;
 
@@ -842,14 +1074,16 @@ http {
 `,
 		cluster.ClusterName,
 		time.Now().Format(time.RFC3339),
+		loadModules,
 		workerProcesses,
 		cluster.ErrorLogLevel,
 		cluster.WorkerConnections,
 	)
 
-	// Access log
+	// Access log, written as JSON lines for the access log collector
+	config += "    " + nginxAccessLogFormat + "\n"
 	if cluster.AccessLogEnabled {
-		config += "    access_log /var/log/nginx/access.log main;\n"
+		config += "    access_log " + nginxAccessLogPath + " " + nginxAccessLogFormatName + ";\n"
 	} else {
 		config += "    access_log off;\n"
 	}
@@ -925,24 +1159,41 @@ http {
 
 `
 
+	// Upstreams managed through the API; servers taken out by health checks are marked down
+	config += s.renderClusterUpstreams(cluster.ID)
+
+	// Server blocks managed through the API, with their certificates
+	config += s.renderServerBlockSection(cluster, cluster.WAFMode, nil) + "\n"
+
 	// Default server block
 	config += `    # Default Server
     server {
         listen 80 default_server;
         server_name _;
-
+`
+	if cluster.WAFEnabled {
+		config += "\n" + clusterWAFBlock(cluster.WAFMode, nil)
+	}
+	config += `
         # Health check endpoint
         location /health {
             access_log off;
-            return 200 "{\"status\":\"healthy\",\"cluster\":\"` + cluster.ClusterName + `\"}";
+` + wafOff + `            return 200 "{\"status\":\"healthy\",\"cluster\":\"` + cluster.ClusterName + `\"}";
             add_header Content-Type application/json;
         }
 
+        # ACME HTTP-01 challenges
+        location ^~ ` + nginxAcmeChallengePath + ` {
+            access_log off;
+` + wafOff + `            root ` + nginxAcmeWebroot + `;
+            default_type text/plain;
+        }
+
         # Nginx status for monitoring
-        location /nginx_status {
+        location ` + nginxStatusPath + ` {
             stub_status on;
             access_log off;
-            allow 127.0.0.1;
+` + wafOff + `            allow 127.0.0.1;
             allow 10.0.0.0/8;
             allow 172.16.0.0/12;
             allow 192.168.0.0/16;
@@ -988,13 +1239,14 @@ func (s *nginxClusterService) createUpstream(ctx context.Context, clusterID stri
 
 	for _, srv := range req.Servers {
 		server := &entities.NginxUpstreamServer{
-			ID:          uuid.New().String(),
-			UpstreamID:  upstreamID,
-			Address:     srv.Address,
-			Weight:      srv.Weight,
-			MaxFails:    srv.MaxFails,
-			FailTimeout: srv.FailTimeout,
-			IsBackup:    srv.IsBackup,
+			ID:              uuid.New().String(),
+			UpstreamID:      upstreamID,
+			Address:         srv.Address,
+			Weight:          srv.Weight,
+			MaxFails:        srv.MaxFails,
+			FailTimeout:     srv.FailTimeout,
+			IsBackup:        srv.IsBackup,
+			DockerServiceID: srv.DockerServiceID,
 		}
 		s.clusterRepo.CreateUpstreamServer(server)
 	}
@@ -1011,6 +1263,7 @@ func (s *nginxClusterService) createServerBlock(ctx context.Context, clusterID s
 		ListenPort: req.ListenPort,
 		SSLEnabled: req.SSLEnabled,
 		RootPath:   req.RootPath,
+		WAFMode:    req.WAFMode,
 	}
 	if err := s.clusterRepo.CreateServerBlock(block); err != nil {
 		return err
@@ -1064,13 +1317,14 @@ func (s *nginxClusterService) UpdateUpstream(ctx context.Context, clusterID, ups
 		s.clusterRepo.DeleteUpstreamServersByUpstreamID(upstreamID)
 		for _, srv := range req.Servers {
 			server := &entities.NginxUpstreamServer{
-				ID:          uuid.New().String(),
-				UpstreamID:  upstreamID,
-				Address:     srv.Address,
-				Weight:      srv.Weight,
-				MaxFails:    srv.MaxFails,
-				FailTimeout: srv.FailTimeout,
-				IsBackup:    srv.IsBackup,
+				ID:              uuid.New().String(),
+				UpstreamID:      upstreamID,
+				Address:         srv.Address,
+				Weight:          srv.Weight,
+				MaxFails:        srv.MaxFails,
+				FailTimeout:     srv.FailTimeout,
+				IsBackup:        srv.IsBackup,
+				DockerServiceID: srv.DockerServiceID,
 			}
 			s.clusterRepo.CreateUpstreamServer(server)
 		}
@@ -1097,8 +1351,9 @@ func (s *nginxClusterService) ListUpstreams(ctx context.Context, clusterID strin
 		backends := make([]dto.BackendServer, 0, len(servers))
 		for _, srv := range servers {
 			backends = append(backends, dto.BackendServer{
-				Address: srv.Address,
-				Weight:  srv.Weight,
+				Address:         srv.Address,
+				Weight:          srv.Weight,
+				DockerServiceID: srv.DockerServiceID,
 			})
 		}
 		result = append(result, dto.UpstreamInfo{
@@ -1110,21 +1365,36 @@ func (s *nginxClusterService) ListUpstreams(ctx context.Context, clusterID strin
 	return result, nil
 }
 
-// AddServerBlock adds a server block
+// AddServerBlock adds a server block and renders it on every node
 func (s *nginxClusterService) AddServerBlock(ctx context.Context, clusterID string, req dto.AddNginxServerBlockRequest) error {
-	return s.createServerBlock(ctx, clusterID, dto.CreateServerBlockRequest{
+	if req.WAFMode != "" {
+		if !validWAFMode(req.WAFMode) {
+			return fmt.Errorf("unknown waf mode %q", req.WAFMode)
+		}
+		if _, err := s.findWAFCluster(clusterID); err != nil {
+			return err
+		}
+	}
+	if err := s.createServerBlock(ctx, clusterID, dto.CreateServerBlockRequest{
 		ServerName: req.ServerName,
 		ListenPort: req.ListenPort,
 		SSLEnabled: req.SSLEnabled,
 		RootPath:   req.RootPath,
+		WAFMode:    req.WAFMode,
 		Locations:  req.Locations,
-	})
+	}); err != nil {
+		return err
+	}
+	return s.RefreshServerBlocks(ctx, clusterID)
 }
 
-// DeleteServerBlock deletes a server block
+// DeleteServerBlock deletes a server block and removes it from every node
 func (s *nginxClusterService) DeleteServerBlock(ctx context.Context, clusterID, blockID string) error {
 	s.clusterRepo.DeleteLocationsByServerBlockID(blockID)
-	return s.clusterRepo.DeleteServerBlock(blockID)
+	if err := s.clusterRepo.DeleteServerBlock(blockID); err != nil {
+		return err
+	}
+	return s.RefreshServerBlocks(ctx, clusterID)
 }
 
 // ListServerBlocks lists all server blocks
@@ -1155,6 +1425,7 @@ func (s *nginxClusterService) ListServerBlocks(ctx context.Context, clusterID st
 			ServerName: b.ServerName,
 			ListenPort: b.ListenPort,
 			SSLEnabled: b.SSLEnabled,
+			WAFMode:    b.WAFMode,
 			Locations:  locInfos,
 		})
 	}
@@ -1172,15 +1443,19 @@ func (s *nginxClusterService) GetClusterHealth(ctx context.Context, clusterID st
 	healthyCount := 0
 	nodeHealth := make([]dto.NodeHealthInfo, 0, len(nodes))
 	masterName := ""
+	vipActive := false
 
 	for _, node := range nodes {
-		healthy := s.checkNodeHealth(ctx, &node)
+		healthy := s.probeNode(ctx, cluster, &node)
 		if healthy {
 			healthyCount++
 		}
 		if node.Role == "master" {
 			masterName = node.Name
 		}
+		if cluster.VirtualIP != "" && !vipActive && node.ContainerID != "" {
+			vipActive = s.nodeHoldsVIP(ctx, cluster, &node)
+		}
 
 		nodeHealth = append(nodeHealth, dto.NodeHealthInfo{
 			NodeID:           node.ID,
@@ -1188,7 +1463,7 @@ func (s *nginxClusterService) GetClusterHealth(ctx context.Context, clusterID st
 			Role:             node.Role,
 			IsHealthy:        healthy,
 			NginxStatus:      node.Status,
-			KeepalivedStatus: "running",
+			KeepalivedStatus: s.keepalivedStatus(ctx, &node),
 			LastCheck:        time.Now().Format(time.RFC3339),
 		})
 	}
@@ -1201,14 +1476,15 @@ func (s *nginxClusterService) GetClusterHealth(ctx context.Context, clusterID st
 	}
 
 	return &dto.NginxClusterHealthResponse{
-		ClusterID:    clusterID,
-		ClusterName:  cluster.ClusterName,
-		Status:       status,
-		HealthyNodes: healthyCount,
-		TotalNodes:   len(nodes),
-		MasterNode:   masterName,
-		VIPActive:    cluster.VirtualIP != "",
-		NodeHealth:   nodeHealth,
+		ClusterID:      clusterID,
+		ClusterName:    cluster.ClusterName,
+		Status:         status,
+		HealthyNodes:   healthyCount,
+		TotalNodes:     len(nodes),
+		MasterNode:     masterName,
+		VIPActive:      vipActive,
+		NodeHealth:     nodeHealth,
+		UpstreamHealth: s.upstreamHealthInfo(clusterID),
 	}, nil
 }
 
@@ -1236,6 +1512,7 @@ func (s *nginxClusterService) GetClusterMetrics(ctx context.Context, clusterID s
 	nodeMetrics := make([]dto.NginxNodeMetrics, 0, len(nodes))
 	var totalRequests int64
 	var totalActiveConns int
+	var totalRate float64
 
 	for _, node := range nodes {
 		// Get nginx stub_status metrics
@@ -1243,26 +1520,18 @@ func (s *nginxClusterService) GetClusterMetrics(ctx context.Context, clusterID s
 		nodeMetrics = append(nodeMetrics, metrics)
 		totalRequests += metrics.TotalRequests
 		totalActiveConns += metrics.ActiveConns
+		totalRate += metrics.RequestsPerSec
 	}
 
 	return &dto.NginxClusterMetricsResponse{
-		ClusterID:     clusterID,
-		TotalRequests: totalRequests,
-		ActiveConns:   totalActiveConns,
-		NodeMetrics:   nodeMetrics,
+		ClusterID:      clusterID,
+		TotalRequests:  totalRequests,
+		RequestsPerSec: totalRate,
+		ActiveConns:    totalActiveConns,
+		NodeMetrics:    nodeMetrics,
 	}, nil
 }
 
-// getNginxMetrics gets metrics from a single node
-func (s *nginxClusterService) getNginxMetrics(ctx context.Context, node *entities.NginxNode) dto.NginxNodeMetrics {
-	return dto.NginxNodeMetrics{
-		NodeID:      node.ID,
-		NodeName:    node.Name,
-		Role:        node.Role,
-		ActiveConns: 0,
-	}
-}
-
 // TestConnection tests connection to the cluster
 func (s *nginxClusterService) TestConnection(ctx context.Context, clusterID string) (*dto.TestNginxConnectionResponse, error) {
 	cluster, err := s.clusterRepo.FindByID(clusterID)
@@ -1381,37 +1650,78 @@ func (s *nginxClusterService) TriggerFailover(ctx context.Context, clusterID str
 		return nil, fmt.Errorf("target node not found: %w", err)
 	}
 
+	if targetNode.ClusterID != clusterID {
+		return nil, fmt.Errorf("target node does not belong to this cluster")
+	}
+
+	return s.failover(ctx, cluster, targetNode, req.Reason, "user")
+}
+
+// failover promotes targetNode to master, moves the VIP to it and records the event
+func (s *nginxClusterService) failover(ctx context.Context, cluster *entities.NginxCluster, targetNode *entities.NginxNode, reason, triggeredBy string) (*dto.NginxFailoverResponse, error) {
 	oldMaster, _ := s.clusterRepo.FindNodeByID(cluster.MasterNodeID)
+	if oldMaster == nil {
+		oldMaster = &entities.NginxNode{}
+	}
 
 	start := time.Now()
 
-	// Demote old master
-	if oldMaster != nil {
-		oldMaster.Role = "backup"
-		oldMaster.Priority = 50
-		s.clusterRepo.UpdateNode(oldMaster)
+	// Rewrite priorities so the target outranks every other node, then let VRRP move the VIP
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	previousNodes := append([]entities.NginxNode(nil), nodes...)
+	previousMasterID := cluster.MasterNodeID
+	backupPriority := 100
+	for i := range nodes {
+		node := &nodes[i]
+		if node.ID == targetNode.ID {
+			node.Role = "master"
+			node.Priority = keepalivedMasterPriority
+		} else {
+			node.Role = "backup"
+			node.Priority = backupPriority
+			backupPriority--
+		}
+		s.clusterRepo.UpdateNode(node)
 	}
-
-	// Promote new master
 	targetNode.Role = "master"
-	targetNode.Priority = 100
-	s.clusterRepo.UpdateNode(targetNode)
+	targetNode.Priority = keepalivedMasterPriority
 
 	cluster.MasterNodeID = targetNode.ID
 	s.clusterRepo.Update(cluster)
 
+	if cluster.VirtualIP != "" {
+		// A failed old master may not accept the new config; the VIP landing on the
+		// target is what decides whether the failover worked
+		if err := s.configureKeepalived(ctx, cluster); err != nil {
+			s.logger.Warn("failed to reload keepalived on every node", zap.String("cluster_id", cluster.ID), zap.Error(err))
+		}
+		if err := s.waitForVIP(ctx, cluster, targetNode); err != nil {
+			s.revertFailover(ctx, cluster, targetNode, previousNodes, previousMasterID)
+			return nil, err
+		}
+	}
+
 	// Record failover event
 	event := &entities.NginxFailoverEvent{
 		ID:            uuid.New().String(),
-		ClusterID:     clusterID,
+		ClusterID:     cluster.ID,
 		OldMasterID:   oldMaster.ID,
 		OldMasterName: oldMaster.Name,
 		NewMasterID:   targetNode.ID,
 		NewMasterName: targetNode.Name,
-		Reason:        req.Reason,
-		TriggeredBy:   "user",
+		Reason:        reason,
+		TriggeredBy:   triggeredBy,
 	}
 	s.clusterRepo.CreateFailoverEvent(event)
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	s.publishEvent(ctx, "nginx_cluster.failover", cluster.InfrastructureID, cluster.ID, targetNode.Name)
+	s.broadcastFailover(cluster, event)
 
 	duration := time.Since(start)
 
@@ -1426,6 +1736,27 @@ func (s *nginxClusterService) TriggerFailover(ctx context.Context, clusterID str
 	}, nil
 }
 
+// revertFailover restores the roles, priorities and master of a failover whose VIP never
+// moved, so the stored cluster matches the node keepalived still treats as master
+func (s *nginxClusterService) revertFailover(ctx context.Context, cluster *entities.NginxCluster, targetNode *entities.NginxNode, nodes []entities.NginxNode, masterNodeID string) {
+	ctx = context.WithoutCancel(ctx)
+	for i := range nodes {
+		if nodes[i].ID == targetNode.ID {
+			targetNode.Role, targetNode.Priority = nodes[i].Role, nodes[i].Priority
+		}
+		if err := s.clusterRepo.UpdateNode(&nodes[i]); err != nil {
+			s.logger.Error("failed to restore node after failover", zap.String("node_id", nodes[i].ID), zap.Error(err))
+		}
+	}
+	cluster.MasterNodeID = masterNodeID
+	if err := s.clusterRepo.Update(cluster); err != nil {
+		s.logger.Error("failed to restore cluster master after failover", zap.String("cluster_id", cluster.ID), zap.Error(err))
+	}
+	if err := s.configureKeepalived(ctx, cluster); err != nil {
+		s.logger.Warn("failed to restore keepalived priorities", zap.String("cluster_id", cluster.ID), zap.Error(err))
+	}
+}
+
 // GetFailoverHistory returns failover history
 func (s *nginxClusterService) GetFailoverHistory(ctx context.Context, clusterID string) (*dto.NginxFailoverHistoryResponse, error) {
 	events, err := s.clusterRepo.ListFailoverEvents(clusterID)
@@ -1541,3 +1872,81 @@ func (s *nginxClusterService) isPortAvailable(port int) bool {
 	listener.Close()
 	return true
 }
+
+// ListConfigRevisions lists the config history of a cluster, newest first
+func (s *nginxClusterService) ListConfigRevisions(ctx context.Context, clusterID string) ([]dto.NginxConfigRevisionInfo, error) {
+	if _, err := s.clusterRepo.FindByID(clusterID); err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	revisions, err := s.revisionRepo.List(entities.NginxRevisionCluster, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]dto.NginxConfigRevisionInfo, 0, len(revisions))
+	for i := range revisions {
+		result = append(result, toConfigRevisionInfo(&revisions[i], false))
+	}
+	return result, nil
+}
+
+// GetConfigRevision returns a single revision including its config and diff
+func (s *nginxClusterService) GetConfigRevision(ctx context.Context, clusterID string, revision int) (*dto.NginxConfigRevisionInfo, error) {
+	rev, err := s.revisionRepo.Find(entities.NginxRevisionCluster, clusterID, revision)
+	if err != nil {
+		return nil, fmt.Errorf("revision %d not found: %w", revision, err)
+	}
+	info := toConfigRevisionInfo(rev, true)
+	return &info, nil
+}
+
+// DiffConfigRevisions diffs two revisions; from defaults to the revision before to
+func (s *nginxClusterService) DiffConfigRevisions(ctx context.Context, clusterID string, from, to int) (*dto.NginxConfigDiffResponse, error) {
+	if from == 0 {
+		from = to - 1
+	}
+	fromRev, err := s.revisionRepo.Find(entities.NginxRevisionCluster, clusterID, from)
+	if err != nil {
+		return nil, fmt.Errorf("revision %d not found: %w", from, err)
+	}
+	toRev, err := s.revisionRepo.Find(entities.NginxRevisionCluster, clusterID, to)
+	if err != nil {
+		return nil, fmt.Errorf("revision %d not found: %w", to, err)
+	}
+	return &dto.NginxConfigDiffResponse{
+		FromRevision: from,
+		ToRevision:   to,
+		Diff:         diffConfig(fmt.Sprintf("revision %d", from), fmt.Sprintf("revision %d", to), fromRev.Config, toRev.Config),
+	}, nil
+}
+
+// RollbackConfig syncs the config of an earlier revision to all nodes as a new revision
+func (s *nginxClusterService) RollbackConfig(ctx context.Context, clusterID string, revision int) (*dto.NginxConfigRevisionInfo, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	target, err := s.revisionRepo.Find(entities.NginxRevisionCluster, clusterID, revision)
+	if err != nil {
+		return nil, fmt.Errorf("revision %d not found: %w", revision, err)
+	}
+	if err := restorableRevision(target); err != nil {
+		return nil, err
+	}
+
+	cluster.NginxConfig = target.Config
+	if cluster.WAFEnabled {
+		// Exclusions stay as stored and are rendered again on the next WAF change
+		cluster.WAFMode = clusterWAFMode(target.Config)
+	}
+	if err := s.applyClusterConfig(ctx, cluster, nginxConfigChange{action: nginxActionRollback, rollbackOf: revision}); err != nil {
+		return nil, err
+	}
+	s.publishEvent(ctx, "nginx_cluster.config_rolled_back", cluster.InfrastructureID, clusterID, string(entities.StatusRunning))
+
+	latest, err := s.revisionRepo.FindLatest(entities.NginxRevisionCluster, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	info := toConfigRevisionInfo(latest, true)
+	return &info, nil
+}
@@ -0,0 +1,633 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Rendered files live on the instance's conf.d volume so they survive container recreation
+const (
+	nginxConfDir        = "/etc/nginx/conf.d"
+	nginxServerConfPath = nginxConfDir + "/default.conf"
+	nginxCertPath       = nginxConfDir + "/ssl/server.crt"
+	nginxKeyPath        = nginxConfDir + "/ssl/server.key"
+	nginxHtpasswdPath   = nginxConfDir + "/.htpasswd"
+	nginxRateLimitZone  = "iaas_rate_limit"
+
+	// ACME HTTP-01 tokens are written below the webroot by the ACME service
+	nginxAcmeWebroot       = "/usr/share/nginx/acme"
+	nginxAcmeChallengePath = "/.well-known/acme-challenge/"
+)
+
+// nginxConfigState is everything the config of a single Nginx instance is rendered from
+type nginxConfigState struct {
+	instance    *entities.NginxInstance
+	domains     []entities.NginxDomain
+	routes      []entities.NginxRoute
+	upstreams   []entities.NginxUpstream
+	certificate *entities.NginxCertificate
+	security    *entities.NginxSecurity
+
+	wafExclusions   []entities.NginxWAFExclusion
+	wafFromSnapshot bool // restored from a revision that recorded the WAF setup
+}
+
+func (s *nginxService) loadConfigState(instance *entities.NginxInstance) (*nginxConfigState, error) {
+	state := &nginxConfigState{instance: instance}
+
+	var err error
+	if state.domains, err = s.nginxRepo.ListDomains(instance.ID); err != nil {
+		return nil, err
+	}
+	if state.routes, err = s.nginxRepo.ListRoutes(instance.ID); err != nil {
+		return nil, err
+	}
+	if state.upstreams, err = s.nginxRepo.ListUpstreams(instance.ID); err != nil {
+		return nil, err
+	}
+	if cert, err := s.nginxRepo.GetCertificate(instance.ID); err == nil {
+		state.certificate = cert
+	}
+	if security, err := s.nginxRepo.GetSecurity(instance.ID); err == nil {
+		state.security = security
+	}
+	if instance.WAFEnabled {
+		if state.wafExclusions, err = s.wafRepo.ListExclusions(entities.NginxRevisionInstance, instance.ID); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// validateNginxValue rejects values that could break out of the directive they are rendered into
+func validateNginxValue(field, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s must not be empty", field)
+	}
+	if strings.ContainsAny(value, " \t\r\n;{}\"'$\\") {
+		return fmt.Errorf("%s %q contains characters not allowed in nginx config", field, value)
+	}
+	return nil
+}
+
+// renderNginxConfig builds the server config and the files it references.
+// The returned map is keyed by absolute path inside the container.
+func renderNginxConfig(state *nginxConfigState) (map[string]string, error) {
+	files := make(map[string]string)
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Generated by IaaS Platform for nginx instance %s. Manual edits are overwritten.\n\n", state.instance.ID)
+	b.WriteString(nginxAccessLogFormat + "\n\n")
+
+	security := state.security
+	if security != nil && security.RateLimitRPS > 0 {
+		fmt.Fprintf(&b, "limit_req_zone $binary_remote_addr zone=%s:10m rate=%dr/s;\n\n", nginxRateLimitZone, security.RateLimitRPS)
+	}
+
+	upstreamNames := make(map[string]bool)
+	for _, upstream := range state.upstreams {
+		backends := liveBackends(upstream.Backends)
+		if len(backends) == 0 {
+			continue
+		}
+		upstreamNames[upstream.Name] = true
+
+		fmt.Fprintf(&b, "upstream %s {\n", upstream.Name)
+		switch upstream.Policy {
+		case "least_conn":
+			b.WriteString("    least_conn;\n")
+		case "ip_hash":
+			b.WriteString("    ip_hash;\n")
+		}
+		for _, backend := range backends {
+			weight := backend.Weight
+			if weight < 1 {
+				weight = 1
+			}
+			fmt.Fprintf(&b, "    server %s weight=%d;\n", backend.Address, weight)
+		}
+		b.WriteString("}\n\n")
+	}
+
+	canaryTargets := renderCanaryRoutes(&b, state.routes, upstreamNames, state.upstreams)
+
+	b.WriteString("server {\n")
+	b.WriteString("    listen 80 default_server;\n")
+	if state.certificate != nil {
+		b.WriteString("    listen 443 ssl default_server;\n")
+	}
+
+	serverNames := make([]string, 0, len(state.domains))
+	for _, domain := range state.domains {
+		serverNames = append(serverNames, domain.Domain)
+	}
+	if len(serverNames) == 0 {
+		serverNames = append(serverNames, "_")
+	}
+	fmt.Fprintf(&b, "    server_name %s;\n", strings.Join(serverNames, " "))
+	fmt.Fprintf(&b, "    access_log %s %s;\n\n", nginxAccessLogPath, nginxAccessLogFormatName)
+
+	// The modsecurity directives only exist in the ModSecurity image
+	wafOff := ""
+	if state.instance.WAFEnabled {
+		b.WriteString(renderWAFDirectives(state.instance.WAFMode, state.wafExclusions, "    "))
+		b.WriteString("\n")
+		wafOff = "        modsecurity off;\n"
+	}
+
+	if state.certificate != nil {
+		files[nginxCertPath] = state.certificate.Certificate
+		files[nginxKeyPath] = state.certificate.PrivateKey
+		fmt.Fprintf(&b, "    ssl_certificate %s;\n", nginxCertPath)
+		fmt.Fprintf(&b, "    ssl_certificate_key %s;\n", nginxKeyPath)
+		b.WriteString("    ssl_protocols TLSv1.2 TLSv1.3;\n")
+		b.WriteString("    ssl_session_cache shared:SSL:10m;\n\n")
+	}
+
+	rateLimit := ""
+	serverRateLimit := false
+	if security != nil {
+		if security.RateLimitRPS > 0 {
+			rateLimit = fmt.Sprintf("limit_req zone=%s burst=%d nodelay;", nginxRateLimitZone, security.RateLimitBurst)
+			serverRateLimit = security.RateLimitPath == "" || security.RateLimitPath == "/"
+		}
+
+		for _, ip := range splitList(security.DenyIPs) {
+			fmt.Fprintf(&b, "    deny %s;\n", ip)
+		}
+		allowIPs := splitList(security.AllowIPs)
+		for _, ip := range allowIPs {
+			fmt.Fprintf(&b, "    allow %s;\n", ip)
+		}
+		if len(allowIPs) > 0 {
+			b.WriteString("    deny all;\n")
+		}
+
+		if security.BasicAuthUsername != "" {
+			entry, err := htpasswdEntry(security.BasicAuthUsername, security.BasicAuthPassword)
+			if err != nil {
+				return nil, err
+			}
+			files[nginxHtpasswdPath] = entry
+			realm := security.BasicAuthRealm
+			if realm == "" {
+				realm = "Restricted"
+			}
+			fmt.Fprintf(&b, "    auth_basic %q;\n", realm)
+			fmt.Fprintf(&b, "    auth_basic_user_file %s;\n", nginxHtpasswdPath)
+		}
+		if serverRateLimit {
+			fmt.Fprintf(&b, "    %s\n", rateLimit)
+		}
+		b.WriteString("\n")
+	}
+
+	// Health endpoint stays reachable for probes regardless of access rules
+	b.WriteString("    location = /health {\n")
+	b.WriteString("        access_log off;\n")
+	b.WriteString(wafOff)
+	b.WriteString("        auth_basic off;\n")
+	b.WriteString("        allow all;\n")
+	b.WriteString("        default_type text/plain;\n")
+	b.WriteString("        return 200 \"healthy\\n\";\n")
+	b.WriteString("    }\n\n")
+
+	// ACME HTTP-01 challenges must be answerable before a certificate exists
+	fmt.Fprintf(&b, "    location ^~ %s {\n", nginxAcmeChallengePath)
+	b.WriteString("        access_log off;\n")
+	b.WriteString(wafOff)
+	b.WriteString("        auth_basic off;\n")
+	b.WriteString("        allow all;\n")
+	fmt.Fprintf(&b, "        root %s;\n", nginxAcmeWebroot)
+	b.WriteString("        default_type text/plain;\n")
+	b.WriteString("    }\n\n")
+
+	// Connection counters for the metrics collector, which reads them from inside the container
+	fmt.Fprintf(&b, "    location = %s {\n", nginxStatusPath)
+	b.WriteString("        stub_status;\n")
+	b.WriteString("        access_log off;\n")
+	b.WriteString(wafOff)
+	b.WriteString("        auth_basic off;\n")
+	b.WriteString("        allow 127.0.0.1;\n")
+	b.WriteString("        deny all;\n")
+	b.WriteString("    }\n\n")
+
+	routes := make([]entities.NginxRoute, len(state.routes))
+	copy(routes, state.routes)
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Priority != routes[j].Priority {
+			return routes[i].Priority > routes[j].Priority
+		}
+		return routes[i].Path < routes[j].Path
+	})
+
+	hasRoot := false
+	for _, route := range routes {
+		if route.Path == "/" {
+			hasRoot = true
+		}
+		fmt.Fprintf(&b, "    location %s {\n", route.Path)
+		if rateLimit != "" && !serverRateLimit && strings.HasPrefix(route.Path, security.RateLimitPath) {
+			fmt.Fprintf(&b, "        %s\n", rateLimit)
+		}
+		target, ok := nginxProxyTarget(route.Backend, upstreamNames, state.upstreams)
+		if canary, found := canaryTargets[route.ID]; found {
+			target = canary
+		}
+		if !ok {
+			// Upstream exists but has no live backends; nginx rejects empty upstream blocks
+			b.WriteString("        return 502;\n")
+		} else {
+			fmt.Fprintf(&b, "        proxy_pass %s;\n", target)
+			b.WriteString("        proxy_http_version 1.1;\n")
+			b.WriteString("        proxy_set_header Host $host;\n")
+			b.WriteString("        proxy_set_header X-Real-IP $remote_addr;\n")
+			b.WriteString("        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;\n")
+			b.WriteString("        proxy_set_header X-Forwarded-Proto $scheme;\n")
+		}
+		b.WriteString("    }\n\n")
+	}
+
+	if !hasRoot {
+		b.WriteString("    location / {\n")
+		b.WriteString("        root /usr/share/nginx/html;\n")
+		b.WriteString("        index index.html index.htm;\n")
+		b.WriteString("    }\n")
+	}
+
+	// Directives set through UpdateNginxConfig. Config given at creation predates the rendered
+	// config and often holds a whole server or http block, so it is never rendered.
+	if custom := strings.TrimSpace(state.instance.CustomDirectives); custom != "" {
+		b.WriteString("\n    # Custom directives\n")
+		for _, line := range strings.Split(custom, "\n") {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+
+	b.WriteString("}\n")
+
+	files[nginxServerConfPath] = b.String()
+	return files, nil
+}
+
+// liveBackends drops backends that active health checks have taken out
+func liveBackends(backends []entities.NginxUpstreamBackend) []entities.NginxUpstreamBackend {
+	live := make([]entities.NginxUpstreamBackend, 0, len(backends))
+	for _, backend := range backends {
+		if !backend.IsDown {
+			live = append(live, backend)
+		}
+	}
+	return live
+}
+
+// nginxProxyTarget resolves a route backend to a proxy_pass target: an upstream
+// name, a URL, or a bare host:port. It returns false for upstreams without live backends.
+func nginxProxyTarget(backend string, upstreamNames map[string]bool, upstreams []entities.NginxUpstream) (string, bool) {
+	if upstreamNames[backend] {
+		return "http://" + backend, true
+	}
+	for _, upstream := range upstreams {
+		if upstream.Name == backend {
+			return "", false
+		}
+	}
+	if strings.HasPrefix(backend, "http://") || strings.HasPrefix(backend, "https://") {
+		return backend, true
+	}
+	return "http://" + backend, true
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// htpasswdEntry hashes a password with salted SHA-1, a scheme nginx reads natively
+func htpasswdEntry(username, password string) (string, error) {
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(append([]byte(password), salt...))
+	hash := base64.StdEncoding.EncodeToString(append(sum[:], salt...))
+	return fmt.Sprintf("%s:{SSHA}%s\n", username, hash), nil
+}
+
+// nginxConfigChange describes why a config is applied; it is recorded on the revision
+type nginxConfigChange struct {
+	action     string
+	rollbackOf int
+}
+
+// nginxConfigSnapshot is the stored form of an nginxConfigState, enough to restore it on rollback
+type nginxConfigSnapshot struct {
+	Config           string                     `json:"config"`
+	CustomDirectives string                     `json:"custom_directives,omitempty"`
+	Domains     []entities.NginxDomain     `json:"domains"`
+	Routes      []entities.NginxRoute      `json:"routes"`
+	Upstreams   []entities.NginxUpstream   `json:"upstreams"`
+	Certificate *entities.NginxCertificate `json:"certificate,omitempty"`
+	Security    *entities.NginxSecurity    `json:"security,omitempty"`
+	WAF         *nginxWAFSnapshot          `json:"waf,omitempty"`
+}
+
+// nginxWAFSnapshot is only recorded for instances created with the WAF
+type nginxWAFSnapshot struct {
+	Mode       string                       `json:"mode"`
+	Exclusions []entities.NginxWAFExclusion `json:"exclusions"`
+}
+
+func (state *nginxConfigState) snapshot() (string, error) {
+	snapshot := nginxConfigSnapshot{
+		Config:           state.instance.Config,
+		CustomDirectives: state.instance.CustomDirectives,
+		Domains:          state.domains,
+		Routes:           state.routes,
+		Upstreams:        state.upstreams,
+		Certificate:      state.certificate,
+		Security:         state.security,
+	}
+	if state.instance.WAFEnabled {
+		snapshot.WAF = &nginxWAFSnapshot{Mode: state.instance.WAFMode, Exclusions: state.wafExclusions}
+	}
+	data, err := json.Marshal(snapshot)
+	return string(data), err
+}
+
+func stateFromSnapshot(instance *entities.NginxInstance, data string) (*nginxConfigState, error) {
+	var snapshot nginxConfigSnapshot
+	if err := json.Unmarshal([]byte(data), &snapshot); err != nil {
+		return nil, fmt.Errorf("invalid revision snapshot: %w", err)
+	}
+	restored := *instance
+	restored.Config, restored.CustomDirectives = snapshot.Config, snapshot.CustomDirectives
+	state := &nginxConfigState{
+		instance:    &restored,
+		domains:     snapshot.Domains,
+		routes:      snapshot.Routes,
+		upstreams:   snapshot.Upstreams,
+		certificate: snapshot.Certificate,
+		security:    snapshot.Security,
+	}
+	if snapshot.WAF != nil {
+		restored.WAFMode = snapshot.WAF.Mode
+		state.wafExclusions = snapshot.WAF.Exclusions
+		state.wafFromSnapshot = true
+	}
+	return state, nil
+}
+
+// applyNginxConfig renders the config, writes it into the running container and
+// records the attempt as a config revision. A stopped container is left alone and
+// the revision stays pending; its config is rendered again when it starts.
+func (s *nginxService) applyNginxConfig(ctx context.Context, state *nginxConfigState, change nginxConfigChange) error {
+	files, err := renderNginxConfig(state)
+	if err != nil {
+		return err
+	}
+	snapshot, err := state.snapshot()
+	if err != nil {
+		return err
+	}
+
+	latest, _ := s.revisionRepo.FindLatest(entities.NginxRevisionInstance, state.instance.ID)
+	config := files[nginxServerConfPath]
+
+	status, output, applyErr := s.writeNginxConfig(ctx, state.instance, files)
+
+	// Re-applying an unchanged config on start is not a new revision
+	if change.action == nginxActionReapplied && latest != nil && latest.Config == config &&
+		latest.ValidationStatus == entities.NginxRevisionValid && status == entities.NginxRevisionValid {
+		return applyErr
+	}
+
+	revision := &entities.NginxConfigRevision{
+		ID:               uuid.New().String(),
+		ResourceType:     entities.NginxRevisionInstance,
+		ResourceID:       state.instance.ID,
+		Revision:         1,
+		Config:           config,
+		Snapshot:         snapshot,
+		Action:           change.action,
+		Author:           configAuthor(ctx),
+		ValidationStatus: status,
+		ValidationOutput: output,
+		RollbackOf:       change.rollbackOf,
+	}
+	if latest != nil {
+		revision.Revision = latest.Revision + 1
+		revision.Diff = diffConfig(fmt.Sprintf("revision %d", latest.Revision), fmt.Sprintf("revision %d", revision.Revision), latest.Config, config)
+	} else {
+		revision.Diff = diffConfig("/dev/null", "revision 1", "", config)
+	}
+	if err := s.revisionRepo.Create(revision); err != nil {
+		s.logger.Error("failed to record nginx config revision", zap.String("instance_id", state.instance.ID), zap.Error(err))
+	}
+
+	return applyErr
+}
+
+// writeNginxConfig writes rendered files into the running container, validates them
+// with nginx -t, reloads and probes /health. Files are restored when any step fails.
+// The container is only restarted when the listen ports change.
+// It returns the revision validation status and the nginx output.
+func (s *nginxService) writeNginxConfig(ctx context.Context, instance *entities.NginxInstance, files map[string]string) (string, string, error) {
+	containerID := instance.ContainerID
+	if containerID == "" {
+		return entities.NginxRevisionPending, "", nil
+	}
+	if info, err := s.dockerSvc.InspectContainer(ctx, containerID); err != nil || info.State == nil || !info.State.Running {
+		return entities.NginxRevisionPending, "", nil
+	}
+
+	managed := []string{nginxServerConfPath, nginxCertPath, nginxKeyPath, nginxHtpasswdPath}
+
+	current, _ := s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", "cat " + nginxServerConfPath + " 2>/dev/null"})
+	restart := listenPortsChanged(current, files[nginxServerConfPath])
+
+	// Paths are fixed; content is copied in as a tar stream and never reaches the shell
+	var script strings.Builder
+	var writes []docker.ContainerFile
+	for _, p := range managed {
+		fmt.Fprintf(&script, "if [ -f %[1]s ]; then cp %[1]s %[1]s.bak; else rm -f %[1]s.bak; fi\n", p)
+	}
+	for _, p := range managed {
+		content, ok := files[p]
+		if !ok {
+			fmt.Fprintf(&script, "rm -f %s\n", p)
+			continue
+		}
+		mode := int64(0644)
+		if p == nginxKeyPath {
+			mode = 0600
+		}
+		writes = append(writes, docker.ContainerFile{Path: p, Content: []byte(content), Mode: mode})
+	}
+
+	if _, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", script.String()}); err != nil {
+		return entities.NginxRevisionInvalid, err.Error(), fmt.Errorf("failed to write nginx config: %w", err)
+	}
+
+	var restore strings.Builder
+	for _, p := range managed {
+		fmt.Fprintf(&restore, "if [ -f %[1]s.bak ]; then mv %[1]s.bak %[1]s; else rm -f %[1]s; fi\n", p)
+	}
+
+	if err := s.dockerSvc.WriteFiles(ctx, containerID, writes); err != nil {
+		s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", restore.String()})
+		return entities.NginxRevisionInvalid, err.Error(), fmt.Errorf("failed to write nginx config: %w", err)
+	}
+
+	output, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"nginx", "-t"})
+	output = strings.TrimSpace(output)
+	if err != nil || !strings.Contains(output, "test is successful") {
+		s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", restore.String()})
+		return entities.NginxRevisionInvalid, output, newNginxConfigError(output, map[string]string{nginxServerConfPath: files[nginxServerConfPath]})
+	}
+
+	if reloadOutput, err := reloadNginx(ctx, s.dockerSvc, containerID, restart); err != nil {
+		s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", restore.String()})
+		reloadNginx(ctx, s.dockerSvc, containerID, restart)
+		return entities.NginxRevisionInvalid, reloadOutput, err
+	}
+
+	if !probeNginxHealth(ctx, s.dockerSvc, containerID, "/health") {
+		s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", restore.String()})
+		reloadNginx(ctx, s.dockerSvc, containerID, restart)
+		s.logger.Warn("nginx failed health check after reload, previous config restored", zap.String("instance_id", instance.ID))
+		return entities.NginxRevisionUnhealthy, output, fmt.Errorf("nginx failed health check after reload, previous config restored")
+	}
+
+	var cleanup strings.Builder
+	for _, p := range managed {
+		fmt.Fprintf(&cleanup, "rm -f %s.bak\n", p)
+	}
+	s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", cleanup.String()})
+
+	return entities.NginxRevisionValid, output, nil
+}
+
+// probeNginxHealth gives a reloaded nginx a few seconds to answer on the health path
+func probeNginxHealth(ctx context.Context, dockerSvc docker.IDockerService, containerID, healthPath string) bool {
+	for attempt := 0; attempt < nginxHealthCheckRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Second)
+		}
+		output, err := dockerSvc.ExecCommand(ctx, containerID, healthCheckCommand(healthPath))
+		if err == nil && strings.Contains(output, nginxHealthyMarker) {
+			return true
+		}
+	}
+	return false
+}
+
+// NginxConfigError is returned when nginx -t rejects a config. Issues carry the file
+// and line nginx reported so callers can point at the offending directive.
+type NginxConfigError struct {
+	Issues []dto.NginxConfigIssue
+	Output string
+}
+
+func (e *NginxConfigError) Error() string {
+	if len(e.Issues) == 0 {
+		return "nginx config validation failed: " + e.Output
+	}
+	parts := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		if issue.Line > 0 {
+			parts = append(parts, fmt.Sprintf("%s:%d: %s", issue.File, issue.Line, issue.Message))
+		} else {
+			parts = append(parts, issue.Message)
+		}
+	}
+	return "nginx config validation failed: " + strings.Join(parts, "; ")
+}
+
+var nginxTestIssuePattern = regexp.MustCompile(`\[(emerg|alert|crit|error|warn)\] (.*?)(?: in (\S+):(\d+))?$`)
+
+// newNginxConfigError parses nginx -t output. sources maps config paths to their
+// content so the offending line can be quoted.
+func newNginxConfigError(output string, sources map[string]string) *NginxConfigError {
+	configErr := &NginxConfigError{Output: strings.TrimSpace(output)}
+	for _, line := range strings.Split(output, "\n") {
+		match := nginxTestIssuePattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		issue := dto.NginxConfigIssue{Level: match[1], Message: match[2], File: match[3]}
+		if match[4] != "" {
+			issue.Line, _ = strconv.Atoi(match[4])
+			if lines := strings.Split(sources[issue.File], "\n"); issue.Line > 0 && issue.Line <= len(lines) && sources[issue.File] != "" {
+				issue.Text = strings.TrimSpace(lines[issue.Line-1])
+			}
+		}
+		configErr.Issues = append(configErr.Issues, issue)
+	}
+	return configErr
+}
+
+var nginxListenPattern = regexp.MustCompile(`(?m)^\s*listen\s+([^\s;]+)`)
+
+// nginxListenPorts returns the sorted, de-duplicated listen addresses of a config
+func nginxListenPorts(config string) []string {
+	seen := make(map[string]bool)
+	var ports []string
+	for _, match := range nginxListenPattern.FindAllStringSubmatch(config, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			ports = append(ports, match[1])
+		}
+	}
+	sort.Strings(ports)
+	return ports
+}
+
+// listenPortsChanged reports whether moving from current to next changes the listen
+// sockets. An unknown current config is treated as unchanged.
+func listenPortsChanged(current, next string) bool {
+	if strings.TrimSpace(current) == "" {
+		return false
+	}
+	return strings.Join(nginxListenPorts(current), ",") != strings.Join(nginxListenPorts(next), ",")
+}
+
+// reloadNginx makes a running nginx pick up a validated config with a graceful reload,
+// which keeps in-flight connections. Listen changes restart the container instead.
+func reloadNginx(ctx context.Context, dockerSvc docker.IDockerService, containerID string, restart bool) (string, error) {
+	if restart {
+		if err := dockerSvc.RestartContainer(ctx, containerID); err != nil {
+			return "", fmt.Errorf("failed to restart nginx: %w", err)
+		}
+		return "", nil
+	}
+	output, err := dockerSvc.ExecCommand(ctx, containerID, []string{"nginx", "-s", "reload"})
+	output = strings.TrimSpace(output)
+	if err != nil {
+		return output, fmt.Errorf("nginx reload failed: %w", err)
+	}
+	if strings.Contains(output, "[emerg]") || strings.Contains(output, "[error]") {
+		return output, fmt.Errorf("nginx reload failed: %s", output)
+	}
+	return output, nil
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+)
+
+// Actions recorded on config revisions
+const (
+	nginxActionCreated      = "created"
+	nginxActionReapplied    = "reapplied"
+	nginxActionRollback     = "rollback"
+	nginxConfigDiffContext  = 3
+	nginxHealthCheckRetries = 3
+	nginxHealthyMarker      = "IAAS_HEALTHY"
+)
+
+type configAuthorKey struct{}
+
+// WithConfigAuthor tags ctx with the user a config revision is attributed to
+func WithConfigAuthor(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, configAuthorKey{}, userID)
+}
+
+func configAuthor(ctx context.Context) string {
+	if author, ok := ctx.Value(configAuthorKey{}).(string); ok && author != "" {
+		return author
+	}
+	return "system"
+}
+
+func toConfigRevisionInfo(rev *entities.NginxConfigRevision, includeConfig bool) dto.NginxConfigRevisionInfo {
+	info := dto.NginxConfigRevisionInfo{
+		Revision:         rev.Revision,
+		Action:           rev.Action,
+		Author:           rev.Author,
+		ValidationStatus: rev.ValidationStatus,
+		ValidationOutput: rev.ValidationOutput,
+		RollbackOf:       rev.RollbackOf,
+		CreatedAt:        rev.CreatedAt.Format(time.RFC3339),
+	}
+	if includeConfig {
+		info.Config = rev.Config
+		info.Diff = rev.Diff
+	}
+	return info
+}
+
+// restorableRevision rejects revisions that never ran successfully
+func restorableRevision(rev *entities.NginxConfigRevision) error {
+	switch rev.ValidationStatus {
+	case entities.NginxRevisionInvalid, entities.NginxRevisionUnhealthy:
+		return fmt.Errorf("revision %d was %s and cannot be restored", rev.Revision, rev.ValidationStatus)
+	}
+	return nil
+}
+
+// healthCheckCommand probes a path inside an nginx container with whichever HTTP client
+// the image ships. Exec does not report exit codes, so success prints nginxHealthyMarker.
+func healthCheckCommand(path string) []string {
+	url := "http://127.0.0.1" + path
+	return []string{"sh", "-c", fmt.Sprintf(
+		"(curl -fsS -o /dev/null --max-time 3 %[1]s 2>/dev/null || wget -q -T 3 -O /dev/null %[1]s) && echo %[2]s", url, nginxHealthyMarker)}
+}
+
+// diffConfig returns a unified diff between two configs, or "" when they are equal
+func diffConfig(fromName, toName, from, to string) string {
+	a := splitConfigLines(from)
+	b := splitConfigLines(to)
+
+	// Longest common subsequence table, filled from the end
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type diffLine struct {
+		kind byte
+		text string
+		from int // index in a of the line, or of the next line for insertions
+		to   int // index in b of the line, or of the next line for deletions
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i], i, j})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	var out strings.Builder
+	for start := 0; start < len(lines); {
+		if lines[start].kind == ' ' {
+			start++
+			continue
+		}
+
+		// Extend the hunk while the next change is within twice the context
+		end := start
+		for k := start; k < len(lines); k++ {
+			if lines[k].kind != ' ' {
+				end = k
+			} else if k-end > 2*nginxConfigDiffContext {
+				break
+			}
+		}
+		first := start - nginxConfigDiffContext
+		if first < 0 {
+			first = 0
+		}
+		last := end + nginxConfigDiffContext
+		if last >= len(lines) {
+			last = len(lines) - 1
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fromCount, toCount := 0, 0
+		for _, line := range lines[first : last+1] {
+			if line.kind != '+' {
+				fromCount++
+			}
+			if line.kind != '-' {
+				toCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(lines[first].from, fromCount), hunkRange(lines[first].to, toCount))
+		for _, line := range lines[first : last+1] {
+			fmt.Fprintf(&out, "%c%s\n", line.kind, line.text)
+		}
+		start = last + 1
+	}
+	return out.String()
+}
+
+func hunkRange(index, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", index)
+	}
+	return fmt.Sprintf("%d,%d", index+1, count)
+}
+
+func splitConfigLines(config string) []string {
+	config = strings.TrimRight(config, "\n")
+	if config == "" {
+		return nil
+	}
+	return strings.Split(config, "\n")
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffConfig(t *testing.T) {
+	assert.Empty(t, diffConfig("a", "b", "same\nlines\n", "same\nlines\n"))
+
+	diff := diffConfig("revision 1", "revision 2",
+		"server {\n    listen 80;\n    server_name a.com;\n}\n",
+		"server {\n    listen 80;\n    server_name b.com;\n}\n")
+	assert.Equal(t, "--- revision 1\n+++ revision 2\n"+
+		"@@ -1,4 +1,4 @@\n"+
+		" server {\n"+
+		"     listen 80;\n"+
+		"-    server_name a.com;\n"+
+		"+    server_name b.com;\n"+
+		" }\n", diff)
+
+	diff = diffConfig("/dev/null", "revision 1", "", "one\ntwo\n")
+	assert.Equal(t, "--- /dev/null\n+++ revision 1\n@@ -0,0 +1,2 @@\n+one\n+two\n", diff)
+}
+
+func TestDiffConfigSeparateHunks(t *testing.T) {
+	from := "a\n1\n2\n3\n4\n5\n6\n7\n8\n9\nb\n"
+	to := "A\n1\n2\n3\n4\n5\n6\n7\n8\n9\nB\n"
+
+	diff := diffConfig("x", "y", from, to)
+	assert.Contains(t, diff, "@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n")
+	assert.Contains(t, diff, "@@ -8,4 +8,4 @@\n 7\n 8\n 9\n-b\n+B\n")
+}
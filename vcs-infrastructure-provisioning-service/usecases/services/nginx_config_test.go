@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedDocker answers exec calls through a handler and keeps written files in
+// memory; other calls panic
+type scriptedDocker struct {
+	docker.IDockerService
+
+	mu    sync.Mutex
+	exec  func(containerID string, cmd []string) string
+	execs [][]string
+	files map[string]string // "container:path" -> content
+}
+
+func newScriptedDocker(exec func(containerID string, cmd []string) string) *scriptedDocker {
+	return &scriptedDocker{exec: exec, files: map[string]string{}}
+}
+
+func (d *scriptedDocker) InspectContainer(ctx context.Context, containerID string) (*types.ContainerJSON, error) {
+	return &types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{State: &types.ContainerState{Running: true}}}, nil
+}
+
+func (d *scriptedDocker) ExecCommand(ctx context.Context, containerID string, cmd []string) (string, error) {
+	d.mu.Lock()
+	d.execs = append(d.execs, cmd)
+	d.mu.Unlock()
+	if d.exec == nil {
+		return "", nil
+	}
+	return d.exec(containerID, cmd), nil
+}
+
+func (d *scriptedDocker) WriteFiles(ctx context.Context, containerID string, files []docker.ContainerFile) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, file := range files {
+		d.files[containerID+":"+file.Path] = string(file.Content)
+	}
+	return nil
+}
+
+func (d *scriptedDocker) file(containerID, path string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.files[containerID+":"+path]
+}
+
+// healthyNginx passes nginx -t and the health probe
+func healthyNginx(containerID string, cmd []string) string {
+	joined := strings.Join(cmd, " ")
+	switch {
+	case strings.HasPrefix(joined, "nginx -t"):
+		return "nginx: configuration file /etc/nginx/nginx.conf test is successful"
+	case strings.Contains(joined, nginxHealthyMarker):
+		return nginxHealthyMarker
+	}
+	return ""
+}
+
+func TestRenderNginxConfig(t *testing.T) {
+	state := &nginxConfigState{
+		instance: &entities.NginxInstance{ID: "nginx-1"},
+		domains:  []entities.NginxDomain{{Domain: "example.com"}},
+		routes: []entities.NginxRoute{
+			{Path: "/api", Backend: "backend", Priority: 10},
+			{Path: "/static", Backend: "10.0.0.5:8080"},
+		},
+		upstreams: []entities.NginxUpstream{{
+			Name:     "backend",
+			Policy:   "least_conn",
+			Backends: []entities.NginxUpstreamBackend{{Address: "10.0.0.1:80", Weight: 2}},
+		}},
+		certificate: &entities.NginxCertificate{Certificate: "CERT", PrivateKey: "KEY"},
+		security: &entities.NginxSecurity{
+			RateLimitRPS: 5, RateLimitBurst: 10, RateLimitPath: "/api",
+			AllowIPs: "10.0.0.0/8", BasicAuthUsername: "admin", BasicAuthPassword: "secret",
+		},
+	}
+
+	files, err := renderNginxConfig(state)
+	assert.NoError(t, err)
+
+	conf := files[nginxServerConfPath]
+	assert.Contains(t, conf, "limit_req_zone $binary_remote_addr zone=iaas_rate_limit:10m rate=5r/s;")
+	assert.Contains(t, conf, "upstream backend {\n    least_conn;\n    server 10.0.0.1:80 weight=2;\n}")
+	assert.Contains(t, conf, "server_name example.com;\n    access_log "+nginxAccessLogPath+" "+nginxAccessLogFormatName+";")
+	assert.Contains(t, conf, "log_format "+nginxAccessLogFormatName+" escape=json")
+	assert.Contains(t, conf, "listen 443 ssl default_server;")
+	assert.Contains(t, conf, "allow 10.0.0.0/8;\n    deny all;")
+	assert.Contains(t, conf, "auth_basic_user_file "+nginxHtpasswdPath+";")
+	assert.Contains(t, conf, "location /api {\n        limit_req zone=iaas_rate_limit burst=10 nodelay;\n        proxy_pass http://backend;")
+	assert.Contains(t, conf, "proxy_pass http://10.0.0.5:8080;")
+	assert.Contains(t, conf, "location / {\n        root /usr/share/nginx/html;")
+	assert.Contains(t, conf, "location = "+nginxStatusPath+" {\n        stub_status;\n        access_log off;\n        auth_basic off;\n        allow 127.0.0.1;\n        deny all;")
+	assert.Contains(t, conf, "location ^~ /.well-known/acme-challenge/ {\n        access_log off;\n        auth_basic off;\n        allow all;\n        root "+nginxAcmeWebroot+";")
+
+	assert.Equal(t, "CERT", files[nginxCertPath])
+	assert.Equal(t, "KEY", files[nginxKeyPath])
+	assert.Contains(t, files[nginxHtpasswdPath], "admin:{SSHA}")
+}
+
+func TestRenderNginxConfigEmptyUpstream(t *testing.T) {
+	state := &nginxConfigState{
+		instance:  &entities.NginxInstance{ID: "nginx-1"},
+		routes:    []entities.NginxRoute{{Path: "/", Backend: "backend"}},
+		upstreams: []entities.NginxUpstream{{Name: "backend"}},
+	}
+
+	files, err := renderNginxConfig(state)
+	assert.NoError(t, err)
+
+	conf := files[nginxServerConfPath]
+	assert.NotContains(t, conf, "upstream backend")
+	assert.Contains(t, conf, "location / {\n        return 502;")
+	assert.Contains(t, conf, "server_name _;")
+}
+
+func TestRenderNginxConfigCustomDirectives(t *testing.T) {
+	// Configs given at creation often hold a whole server block and were never applied
+	state := &nginxConfigState{instance: &entities.NginxInstance{
+		ID:     "nginx-1",
+		Config: "server {\n    listen 80;\n    location /legacy { return 418; }\n}",
+	}}
+	files, err := renderNginxConfig(state)
+	require.NoError(t, err)
+	assert.NotContains(t, files[nginxServerConfPath], "/legacy")
+	assert.NotContains(t, files[nginxServerConfPath], "# Custom directives")
+
+	state.instance.CustomDirectives = "client_max_body_size 20m;\nadd_header X-Frame-Options DENY;"
+	files, err = renderNginxConfig(state)
+	require.NoError(t, err)
+	assert.Contains(t, files[nginxServerConfPath], "    # Custom directives\n"+
+		"    client_max_body_size 20m;\n"+
+		"    add_header X-Frame-Options DENY;\n}\n")
+	assert.NotContains(t, files[nginxServerConfPath], "/legacy")
+
+	// Rollbacks restore the directives of the revision
+	snapshot, err := state.snapshot()
+	require.NoError(t, err)
+	restored, err := stateFromSnapshot(&entities.NginxInstance{ID: "nginx-1"}, snapshot)
+	require.NoError(t, err)
+	assert.Equal(t, state.instance.CustomDirectives, restored.instance.CustomDirectives)
+}
+
+func TestRenderNginxConfigDownBackends(t *testing.T) {
+	state := &nginxConfigState{
+		instance: &entities.NginxInstance{ID: "nginx-1"},
+		routes:   []entities.NginxRoute{{Path: "/", Backend: "backend"}},
+		upstreams: []entities.NginxUpstream{{Name: "backend", Backends: []entities.NginxUpstreamBackend{
+			{Address: "10.0.0.1:80", Weight: 1},
+			{Address: "10.0.0.2:80", Weight: 1, IsDown: true},
+		}}},
+	}
+
+	files, err := renderNginxConfig(state)
+	assert.NoError(t, err)
+	conf := files[nginxServerConfPath]
+	assert.Contains(t, conf, "server 10.0.0.1:80 weight=1;")
+	assert.NotContains(t, conf, "10.0.0.2:80")
+
+	state.upstreams[0].Backends[0].IsDown = true
+	files, err = renderNginxConfig(state)
+	assert.NoError(t, err)
+	conf = files[nginxServerConfPath]
+	assert.NotContains(t, conf, "upstream backend")
+	assert.Contains(t, conf, "location / {\n        return 502;")
+}
+
+func TestValidateNginxValue(t *testing.T) {
+	assert.NoError(t, validateNginxValue("domain", "example.com"))
+	assert.Error(t, validateNginxValue("domain", ""))
+	assert.Error(t, validateNginxValue("domain", "example.com; include /etc/passwd"))
+	assert.Error(t, validateNginxValue("path", "/a{b}"))
+}
+
+func TestNewNginxConfigError(t *testing.T) {
+	config := "server {\n    listen 80;\n    foo bar;\n}\n"
+	output := "nginx: [emerg] unknown directive \"foo\" in /etc/nginx/conf.d/default.conf:3\n" +
+		"nginx: configuration file /etc/nginx/nginx.conf test failed\n"
+
+	err := newNginxConfigError(output, map[string]string{nginxServerConfPath: config})
+	assert.Len(t, err.Issues, 1)
+	assert.Equal(t, "emerg", err.Issues[0].Level)
+	assert.Equal(t, nginxServerConfPath, err.Issues[0].File)
+	assert.Equal(t, 3, err.Issues[0].Line)
+	assert.Equal(t, `unknown directive "foo"`, err.Issues[0].Message)
+	assert.Equal(t, "foo bar;", err.Issues[0].Text)
+	assert.Contains(t, err.Error(), "default.conf:3: unknown directive")
+
+	err = newNginxConfigError("nginx: [emerg] no \"events\" section in configuration\n", nil)
+	assert.Len(t, err.Issues, 1)
+	assert.Zero(t, err.Issues[0].Line)
+	assert.Equal(t, `no "events" section in configuration`, err.Issues[0].Message)
+}
+
+func TestListenPortsChanged(t *testing.T) {
+	current := "server {\n    listen 80 default_server;\n    # listen 8080;\n}\n"
+
+	assert.Equal(t, []string{"80"}, nginxListenPorts(current))
+	assert.False(t, listenPortsChanged(current, "server {\n    listen 80;\n    server_name a.com;\n}\n"))
+	assert.True(t, listenPortsChanged(current, "server {\n    listen 80;\n    listen 443 ssl;\n}\n"))
+	assert.False(t, listenPortsChanged("", "server {\n    listen 443 ssl;\n}\n"))
+}
+
+func TestWriteNginxConfigKeepsContentOutOfShell(t *testing.T) {
+	injected := "add_header X-Test 1;\nIAAS_NGINX_EOF\ntouch /tmp/pwned\nEOF\nrm -rf /etc/nginx"
+	state := &nginxConfigState{
+		instance:    &entities.NginxInstance{ID: "nginx-1", ContainerID: "c1", CustomDirectives: injected},
+		certificate: &entities.NginxCertificate{Certificate: "CERT\nIAAS_NGINX_EOF", PrivateKey: "KEY"},
+	}
+	files, err := renderNginxConfig(state)
+	require.NoError(t, err)
+
+	dockerSvc := newScriptedDocker(healthyNginx)
+	svc := &nginxService{dockerSvc: dockerSvc}
+	status, _, err := svc.writeNginxConfig(context.Background(), state.instance, files)
+	require.NoError(t, err)
+	assert.Equal(t, entities.NginxRevisionValid, status)
+
+	// The files arrive verbatim, and no shell command carries their content
+	assert.Equal(t, files[nginxServerConfPath], dockerSvc.file("c1", nginxServerConfPath))
+	assert.Contains(t, dockerSvc.file("c1", nginxServerConfPath), "    IAAS_NGINX_EOF\n    touch /tmp/pwned\n")
+	assert.Equal(t, "CERT\nIAAS_NGINX_EOF", dockerSvc.file("c1", nginxCertPath))
+	for _, cmd := range dockerSvc.execs {
+		joined := strings.Join(cmd, " ")
+		assert.NotContains(t, joined, "pwned")
+		assert.NotContains(t, joined, "IAAS_NGINX_EOF")
+		assert.NotContains(t, joined, "CERT")
+	}
+}
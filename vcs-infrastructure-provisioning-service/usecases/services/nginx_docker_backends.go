@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const nginxActionDockerReplicas = "docker_replicas_synced"
+
+// UpstreamRequestRecorder receives how many requests nginx proxied to each upstream host
+// in the access logs read at a time
+type UpstreamRequestRecorder interface {
+	RecordUpstreamRequests(counts map[string]int, at time.Time)
+}
+
+// countUpstreamRequests counts the requests of entries per upstream host. $upstream_addr lists
+// every server tried, separated by ", " within an upstream and " : " across redirects.
+func countUpstreamRequests(entries []accessLogEntry) map[string]int {
+	counts := make(map[string]int)
+	for _, entry := range entries {
+		for _, group := range strings.Split(entry.UpstreamAddr, " : ") {
+			for _, addr := range strings.Split(group, ",") {
+				addr = strings.TrimSpace(addr)
+				if addr == "" || addr == "-" || strings.HasPrefix(addr, "unix:") {
+					continue
+				}
+				if host, _, err := net.SplitHostPort(addr); err == nil {
+					addr = host
+				}
+				counts[addr]++
+			}
+		}
+	}
+	return counts
+}
+
+// serviceBackend is one server of an upstream as seen by planServiceBackends
+type serviceBackend struct {
+	address string
+	linked  bool // recorded as pointing at the service
+}
+
+// planServiceBackends finds the backends of an upstream linked to service and returns the
+// replica addresses that should replace them: every replica on every port the linked backends
+// used. Backends that merely share an address with a replica are left alone, container IPs
+// are recycled across owners. changed is false when no backend is linked, the service has no
+// replica with an IP yet, or the upstream already points at exactly its replicas.
+func planServiceBackends(service *entities.DockerService, backends []serviceBackend) (fronting []bool, addresses []string, changed bool) {
+	var ips []string
+	for _, replica := range dockerServiceReplicas(service) {
+		if replica.IPAddress != "" {
+			ips = append(ips, replica.IPAddress)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, nil, false
+	}
+
+	fronting = make([]bool, len(backends))
+	var ports, current []string
+	for i, backend := range backends {
+		if !backend.linked {
+			continue
+		}
+		_, port, err := net.SplitHostPort(backend.address)
+		if err != nil {
+			port = "80"
+		}
+		fronting[i] = true
+		current = append(current, backend.address)
+		if !containsString(ports, port) {
+			ports = append(ports, port)
+		}
+	}
+	if len(current) == 0 {
+		return nil, nil, false
+	}
+
+	for _, port := range ports {
+		for _, ip := range ips {
+			addresses = append(addresses, net.JoinHostPort(ip, port))
+		}
+	}
+	sort.Strings(current)
+	want := append([]string{}, addresses...)
+	sort.Strings(want)
+	return fronting, addresses, strings.Join(current, ",") != strings.Join(want, ",")
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceUpstreamBlock swaps the "upstream name { ... }" block of config for block. config is
+// returned unchanged when it has no such block.
+func replaceUpstreamBlock(config, name, block string) string {
+	lines := strings.Split(config, "\n")
+	start := -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if start < 0 {
+			if strings.HasPrefix(trimmed, "upstream ") && strings.HasSuffix(trimmed, "{") &&
+				strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(trimmed, "upstream "), "{")) == name {
+				start = i
+			}
+			continue
+		}
+		if trimmed == "}" {
+			out := append([]string{}, lines[:start]...)
+			out = append(out, strings.Split(strings.TrimRight(block, "\n"), "\n")...)
+			return strings.Join(append(out, lines[i+1:]...), "\n")
+		}
+	}
+	return config
+}
+
+// SetUpstreamRequestRecorder makes the access log collector report requests per upstream host
+func (s *nginxService) SetUpstreamRequestRecorder(recorder UpstreamRequestRecorder) {
+	s.requestRecorder = recorder
+}
+
+// dockerServiceOwner returns the user that owns service
+func dockerServiceOwner(infraRepo repositories.IInfrastructureRepository, service *entities.DockerService) (string, error) {
+	if service.Infrastructure.UserID != "" {
+		return service.Infrastructure.UserID, nil
+	}
+	infra, err := infraRepo.FindByID(service.InfrastructureID)
+	if err != nil {
+		return "", err
+	}
+	return infra.UserID, nil
+}
+
+// SyncDockerServiceBackends re-points the upstream backends linked to service, on running
+// instances of the same owner, at its current replicas and returns how many upstreams were
+// changed
+func (s *nginxService) SyncDockerServiceBackends(ctx context.Context, service *entities.DockerService) (int, error) {
+	owner, err := dockerServiceOwner(s.infraRepo, service)
+	if err != nil {
+		return 0, err
+	}
+	instances, err := s.nginxRepo.ListWithUpstreams()
+	if err != nil {
+		return 0, err
+	}
+	updated := 0
+	var errs []error
+	for i := range instances {
+		instance := &instances[i]
+		if instance.ContainerID == "" || instance.Infrastructure.Status != entities.StatusRunning ||
+			instance.Infrastructure.UserID != owner {
+			continue
+		}
+		state, err := s.loadConfigState(instance)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		var changed []*entities.NginxUpstream
+		for j := range state.upstreams {
+			upstream := &state.upstreams[j]
+			backends := make([]serviceBackend, len(upstream.Backends))
+			for k, backend := range upstream.Backends {
+				backends[k] = serviceBackend{address: backend.Address, linked: backend.DockerServiceID == service.ID}
+			}
+			fronting, addresses, ok := planServiceBackends(service, backends)
+			if !ok {
+				continue
+			}
+
+			weight := 0
+			next := []entities.NginxUpstreamBackend{}
+			for k, backend := range upstream.Backends {
+				if !fronting[k] {
+					next = append(next, backend)
+				} else if weight == 0 {
+					weight = backend.Weight
+				}
+			}
+			for _, address := range addresses {
+				next = append(next, entities.NginxUpstreamBackend{
+					ID: uuid.New().String(), UpstreamID: upstream.ID, Address: address, Weight: weight, DockerServiceID: service.ID,
+				})
+			}
+			upstream.Backends = next
+			changed = append(changed, upstream)
+		}
+		if len(changed) == 0 {
+			continue
+		}
+
+		if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: nginxActionDockerReplicas}); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, upstream := range changed {
+			s.nginxRepo.DeleteUpstreamBackends(upstream.ID)
+			for k := range upstream.Backends {
+				s.nginxRepo.CreateUpstreamBackend(&upstream.Backends[k])
+			}
+		}
+		updated += len(changed)
+		s.logger.Info("nginx upstreams re-pointed at docker service replicas",
+			zap.String("instance_id", instance.ID), zap.String("service_id", service.ID), zap.Int("upstreams", len(changed)))
+	}
+	return updated, errors.Join(errs...)
+}
+
+// SetUpstreamRequestRecorder makes the access log collector report requests per upstream host
+func (s *nginxClusterService) SetUpstreamRequestRecorder(recorder UpstreamRequestRecorder) {
+	s.requestRecorder = recorder
+}
+
+// SyncDockerServiceBackends re-points the upstream servers linked to service, on running
+// clusters of the same owner, at its current replicas and returns how many upstreams were
+// changed. The stored servers are only replaced once the rewritten config is applied.
+func (s *nginxClusterService) SyncDockerServiceBackends(ctx context.Context, service *entities.DockerService) (int, error) {
+	owner, err := dockerServiceOwner(s.infraRepo, service)
+	if err != nil {
+		return 0, err
+	}
+	clusters, err := s.clusterRepo.ListAll()
+	if err != nil {
+		return 0, err
+	}
+	updated := 0
+	var errs []error
+	for i := range clusters {
+		cluster := &clusters[i]
+		if cluster.Infrastructure.Status != entities.StatusRunning || cluster.Infrastructure.UserID != owner {
+			continue
+		}
+		upstreams, err := s.clusterRepo.ListUpstreams(cluster.ID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		config := cluster.NginxConfig
+		changed := make(map[string][]entities.NginxUpstreamServer)
+		for _, upstream := range upstreams {
+			servers, err := s.clusterRepo.ListUpstreamServers(upstream.ID)
+			if err != nil {
+				continue
+			}
+			backends := make([]serviceBackend, len(servers))
+			for k, server := range servers {
+				backends[k] = serviceBackend{address: server.Address, linked: server.DockerServiceID == service.ID}
+			}
+			fronting, addresses, ok := planServiceBackends(service, backends)
+			if !ok {
+				continue
+			}
+
+			var template *entities.NginxUpstreamServer
+			next := []entities.NginxUpstreamServer{}
+			for k := range servers {
+				if !fronting[k] {
+					next = append(next, servers[k])
+				} else if template == nil {
+					template = &servers[k]
+				}
+			}
+			for _, address := range addresses {
+				next = append(next, entities.NginxUpstreamServer{
+					ID:              uuid.New().String(),
+					UpstreamID:      upstream.ID,
+					Address:         address,
+					Weight:          template.Weight,
+					MaxFails:        template.MaxFails,
+					FailTimeout:     template.FailTimeout,
+					IsBackup:        template.IsBackup,
+					DockerServiceID: service.ID,
+				})
+			}
+			changed[upstream.ID] = next
+
+			block := renderClusterUpstreams([]entities.NginxClusterUpstream{upstream}, map[string][]entities.NginxUpstreamServer{upstream.ID: next})
+			config = replaceUpstreamBlock(config, upstream.Name, strings.TrimPrefix(block, "    # Upstreams\n"))
+		}
+		if len(changed) == 0 {
+			continue
+		}
+
+		if config != cluster.NginxConfig {
+			cluster.NginxConfig = config
+			if err := s.applyClusterConfig(ctx, cluster, nginxConfigChange{action: nginxActionDockerReplicas}); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		for upstreamID, servers := range changed {
+			s.clusterRepo.DeleteUpstreamServersByUpstreamID(upstreamID)
+			for k := range servers {
+				s.clusterRepo.CreateUpstreamServer(&servers[k])
+			}
+		}
+		updated += len(changed)
+		s.logger.Info("nginx cluster upstreams re-pointed at docker service replicas",
+			zap.String("cluster_id", cluster.ID), zap.String("service_id", service.ID), zap.Int("upstreams", len(changed)))
+	}
+	return updated, errors.Join(errs...)
+}
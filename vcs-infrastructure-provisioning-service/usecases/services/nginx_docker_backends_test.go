@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountUpstreamRequests(t *testing.T) {
+	counts := countUpstreamRequests([]accessLogEntry{
+		{UpstreamAddr: "172.18.0.5:8080"},
+		{UpstreamAddr: "172.18.0.5:8080, 172.18.0.6:8080"},
+		{UpstreamAddr: "172.18.0.6:8080 : 10.0.0.1:80"},
+		{UpstreamAddr: "unix:/tmp/app.sock"},
+		{UpstreamAddr: ""},
+		{UpstreamAddr: "-"},
+	})
+	assert.Equal(t, map[string]int{
+		"172.18.0.5": 2,
+		"172.18.0.6": 2,
+		"10.0.0.1":   1,
+	}, counts)
+}
+
+func TestPlanServiceBackends(t *testing.T) {
+	service := &entities.DockerService{
+		ID:           "svc-1",
+		ServiceAlias: "api",
+		Containers: []entities.DockerServiceReplica{
+			{ContainerName: "iaas-docker-svc-1", IPAddress: "172.18.0.5"},
+			{ContainerName: "iaas-docker-svc-1-b", IPAddress: "172.18.0.6"},
+		},
+	}
+
+	// A linked backend is replaced by one per replica, other backends are kept
+	fronting, addresses, changed := planServiceBackends(service, []serviceBackend{
+		{address: "api:8080", linked: true},
+		{address: "10.0.0.1:80"},
+	})
+	assert.True(t, changed)
+	assert.Equal(t, []bool{true, false}, fronting)
+	assert.Equal(t, []string{"172.18.0.5:8080", "172.18.0.6:8080"}, addresses)
+
+	// Linked backends of retired replicas are dropped, every port is kept
+	_, addresses, changed = planServiceBackends(service, []serviceBackend{
+		{address: "172.18.0.5:8080", linked: true},
+		{address: "172.18.0.7:8080", linked: true},
+		{address: "iaas-docker-svc-1:9090", linked: true},
+	})
+	assert.True(t, changed)
+	assert.Equal(t, []string{"172.18.0.5:8080", "172.18.0.6:8080", "172.18.0.5:9090", "172.18.0.6:9090"}, addresses)
+
+	// Already in sync
+	_, _, changed = planServiceBackends(service, []serviceBackend{
+		{address: "172.18.0.6:8080", linked: true},
+		{address: "172.18.0.5:8080", linked: true},
+	})
+	assert.False(t, changed)
+
+	// Backends that only share an address with a replica are not the service's to re-point
+	_, _, changed = planServiceBackends(service, []serviceBackend{
+		{address: "172.18.0.5:8080"},
+		{address: "api:8080"},
+		{address: "iaas-docker-svc-1:8080"},
+	})
+	assert.False(t, changed)
+
+	// Nothing to point at before the replicas have addresses
+	_, _, changed = planServiceBackends(&entities.DockerService{ServiceAlias: "api"}, []serviceBackend{{address: "api:8080", linked: true}})
+	assert.False(t, changed)
+}
+
+// foreignClusterRepo lists one running cluster of another user; other calls panic
+type foreignClusterRepo struct {
+	repositories.INginxClusterRepository
+}
+
+func (foreignClusterRepo) ListAll() ([]entities.NginxCluster, error) {
+	return []entities.NginxCluster{{
+		ID:             "cluster-1",
+		Infrastructure: entities.Infrastructure{UserID: "user-2", Status: entities.StatusRunning},
+	}}, nil
+}
+
+func TestSyncDockerServiceBackendsSkipsOtherOwners(t *testing.T) {
+	infraRepo := &memoryInfraRepo{infras: []*entities.Infrastructure{{ID: "infra-1", UserID: "user-1"}}}
+	svc := &nginxClusterService{infraRepo: infraRepo, clusterRepo: foreignClusterRepo{}, logger: discardLogger{}}
+	service := &entities.DockerService{
+		ID:               "svc-1",
+		InfrastructureID: "infra-1",
+		Containers:       []entities.DockerServiceReplica{{IPAddress: "172.18.0.5"}},
+	}
+
+	// The other user's upstreams are never even listed
+	updated, err := svc.SyncDockerServiceBackends(context.Background(), service)
+	require.NoError(t, err)
+	assert.Zero(t, updated)
+}
+
+func TestReplaceUpstreamBlock(t *testing.T) {
+	config := "http {\n" +
+		"    upstream web {\n" +
+		"        server 10.0.0.1:80;\n" +
+		"    }\n\n" +
+		"    upstream api {\n" +
+		"        least_conn;\n" +
+		"        server api:8080;\n" +
+		"    }\n\n" +
+		"    server {\n" +
+		"        location / { proxy_pass http://api; }\n" +
+		"    }\n" +
+		"}"
+	block := "    upstream api {\n" +
+		"        least_conn;\n" +
+		"        server 172.18.0.5:8080;\n" +
+		"        server 172.18.0.6:8080;\n" +
+		"    }\n\n"
+
+	assert.Equal(t, "http {\n"+
+		"    upstream web {\n"+
+		"        server 10.0.0.1:80;\n"+
+		"    }\n\n"+
+		"    upstream api {\n"+
+		"        least_conn;\n"+
+		"        server 172.18.0.5:8080;\n"+
+		"        server 172.18.0.6:8080;\n"+
+		"    }\n\n"+
+		"    server {\n"+
+		"        location / { proxy_pass http://api; }\n"+
+		"    }\n"+
+		"}", replaceUpstreamBlock(config, "api", block))
+
+	assert.Equal(t, config, replaceUpstreamBlock(config, "missing", block))
+}
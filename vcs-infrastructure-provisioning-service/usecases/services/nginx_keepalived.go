@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/docker/docker/api/types"
+	"go.uber.org/zap"
+)
+
+const (
+	keepalivedConfPath       = "/etc/keepalived/keepalived.conf"
+	keepalivedPIDPath        = "/run/keepalived.pid"
+	keepalivedMasterPriority = 150
+	keepalivedVIPTimeout     = 15 * time.Second
+	keepalivedPassChars      = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	keepalivedReadyMarker    = "__iaas_keepalived__"
+
+	// Node images have keepalived baked in, see docker/nginx-keepalived
+	keepalivedNodeImage    = "iaas-nginx-keepalived:alpine"
+	keepalivedWAFNodeImage = "iaas-nginx-keepalived:waf"
+)
+
+// keepalivedCapabilities let keepalived add the VIP and send VRRP adverts from the node
+var keepalivedCapabilities = []string{"NET_ADMIN", "NET_BROADCAST", "NET_RAW"}
+
+// keepalivedNodeCmd runs keepalived next to nginx inside the node container. keepalived comes
+// with the node image and is started again by the same command whenever the container restarts,
+// so a config reload that restarts nginx never leaves the node without VRRP. A node whose image
+// lacks keepalived exits instead of serving without VRRP.
+var keepalivedNodeCmd = []string{"sh", "-c", fmt.Sprintf(`command -v keepalived >/dev/null 2>&1 || { echo "keepalived is not installed in the node image" >&2; exit 1; }
+(
+  while [ ! -f %[1]s ]; do sleep 1; done
+  keepalived --use-file %[1]s --pid %[2]s
+) &
+exec nginx -g 'daemon off;'`, keepalivedConfPath, keepalivedPIDPath)}
+
+var keepalivedSafeValue = regexp.MustCompile(`^[A-Za-z0-9_./-]+$`)
+
+// renderKeepalivedConfig returns keepalived.conf for one node. Nodes send VRRP adverts to each
+// other over unicast because multicast is not reliable on Docker bridges.
+func renderKeepalivedConfig(cluster *entities.NginxCluster, node *entities.NginxNode, nodes []entities.NginxNode) (string, error) {
+	vip := net.ParseIP(cluster.VirtualIP).To4()
+	if vip == nil {
+		return "", fmt.Errorf("virtual IP %q is not an IPv4 address", cluster.VirtualIP)
+	}
+	prefix := 32
+	if cluster.VRRPSubnet != "" {
+		_, subnet, err := net.ParseCIDR(cluster.VRRPSubnet)
+		if err != nil {
+			return "", fmt.Errorf("invalid VRRP subnet %q: %w", cluster.VRRPSubnet, err)
+		}
+		prefix, _ = subnet.Mask.Size()
+	}
+
+	iface := cluster.VRRPInterface
+	if iface == "" {
+		iface = "eth0"
+	}
+	healthPath := cluster.HealthCheckPath
+	if healthPath == "" {
+		healthPath = "/health"
+	}
+	interval := cluster.HealthCheckInterval
+	if interval <= 0 {
+		interval = 5
+	}
+	for field, value := range map[string]string{"interface": iface, "health check path": healthPath, "auth password": cluster.VRRPAuthPass, "node name": node.Name} {
+		if value != "" && !keepalivedSafeValue.MatchString(value) {
+			return "", fmt.Errorf("%s %q contains characters not allowed in keepalived config", field, value)
+		}
+	}
+
+	state := "BACKUP"
+	if node.Role == "master" {
+		state = "MASTER"
+	}
+
+	var b strings.Builder
+	b.WriteString("# Keepalived configuration - Generated by IaaS Platform\n")
+	fmt.Fprintf(&b, "# Cluster: %s\n\n", cluster.ClusterName)
+
+	b.WriteString("global_defs {\n")
+	fmt.Fprintf(&b, "    router_id %s\n", node.Name)
+	b.WriteString("    enable_script_security\n")
+	b.WriteString("    script_user root\n")
+	b.WriteString("}\n\n")
+
+	if cluster.HealthCheckEnabled {
+		b.WriteString("vrrp_script chk_nginx {\n")
+		fmt.Fprintf(&b, "    script \"/usr/bin/wget -q -T 2 -O /dev/null http://127.0.0.1:80%s\"\n", healthPath)
+		fmt.Fprintf(&b, "    interval %d\n", interval)
+		b.WriteString("    timeout 3\n")
+		b.WriteString("    fall 2\n")
+		b.WriteString("    rise 2\n")
+		b.WriteString("}\n\n")
+	}
+
+	fmt.Fprintf(&b, "vrrp_instance VI_%d {\n", cluster.VRRPRouterID)
+	fmt.Fprintf(&b, "    state %s\n", state)
+	fmt.Fprintf(&b, "    interface %s\n", iface)
+	fmt.Fprintf(&b, "    virtual_router_id %d\n", cluster.VRRPRouterID)
+	fmt.Fprintf(&b, "    priority %d\n", node.Priority)
+	b.WriteString("    advert_int 1\n")
+	if node.IPAddress != "" {
+		fmt.Fprintf(&b, "    unicast_src_ip %s\n", node.IPAddress)
+	}
+	b.WriteString("    unicast_peer {\n")
+	for _, peer := range nodes {
+		if peer.ID != node.ID && peer.IPAddress != "" {
+			fmt.Fprintf(&b, "        %s\n", peer.IPAddress)
+		}
+	}
+	b.WriteString("    }\n")
+	if cluster.VRRPAuthPass != "" {
+		b.WriteString("    authentication {\n")
+		b.WriteString("        auth_type PASS\n")
+		fmt.Fprintf(&b, "        auth_pass %s\n", cluster.VRRPAuthPass)
+		b.WriteString("    }\n")
+	}
+	b.WriteString("    virtual_ipaddress {\n")
+	fmt.Fprintf(&b, "        %s/%d dev %s\n", vip, prefix, iface)
+	b.WriteString("    }\n")
+	if cluster.HealthCheckEnabled {
+		b.WriteString("    track_script {\n")
+		b.WriteString("        chk_nginx\n")
+		b.WriteString("    }\n")
+	}
+	b.WriteString("}\n")
+	return b.String(), nil
+}
+
+// configureKeepalived writes every node's keepalived.conf from the current roles and
+// priorities and reloads keepalived, starting it when it is not running yet
+func (s *nginxClusterService) configureKeepalived(ctx context.Context, cluster *entities.NginxCluster) error {
+	if cluster.VirtualIP == "" {
+		return nil
+	}
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return err
+	}
+
+	// ExecCommand does not report exit codes, so only the marker proves the reload worked
+	reload := fmt.Sprintf(`{ if [ -f %[1]s ] && kill -0 "$(cat %[1]s)" 2>/dev/null; then kill -HUP "$(cat %[1]s)"; else keepalived --use-file %[2]s --pid %[1]s; fi; } 2>&1 && echo %[3]s`,
+		keepalivedPIDPath, keepalivedConfPath, keepalivedReadyMarker)
+
+	var failed []string
+	for i := range nodes {
+		node := &nodes[i]
+		if node.ContainerID == "" {
+			continue
+		}
+		config, err := renderKeepalivedConfig(cluster, node, nodes)
+		if err != nil {
+			return err
+		}
+
+		err = s.dockerSvc.WriteFiles(ctx, node.ContainerID, []docker.ContainerFile{{Path: keepalivedConfPath, Content: []byte(config)}})
+		if err == nil {
+			var output string
+			output, err = s.dockerSvc.ExecCommand(ctx, node.ContainerID, []string{"sh", "-c", reload})
+			if err == nil && !strings.Contains(output, keepalivedReadyMarker) {
+				err = fmt.Errorf("keepalived reload failed: %s", strings.TrimSpace(output))
+			}
+		}
+		if err != nil {
+			s.logger.Error("failed to configure keepalived", zap.String("node", node.Name), zap.Error(err))
+			failed = append(failed, node.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to configure keepalived on %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// checkKeepalived makes sure the node container can run keepalived
+func (s *nginxClusterService) checkKeepalived(ctx context.Context, containerID string) error {
+	check := fmt.Sprintf("command -v keepalived >/dev/null 2>&1 && echo %s", keepalivedReadyMarker)
+	output, err := s.dockerSvc.ExecCommand(ctx, containerID, []string{"sh", "-c", check})
+	if err != nil {
+		return fmt.Errorf("failed to check keepalived: %w", err)
+	}
+	if !strings.Contains(output, keepalivedReadyMarker) {
+		return fmt.Errorf("keepalived is not installed in the node image")
+	}
+	return nil
+}
+
+// nodeHoldsVIP reports whether keepalived has assigned the VIP on the node
+func (s *nginxClusterService) nodeHoldsVIP(ctx context.Context, cluster *entities.NginxCluster, node *entities.NginxNode) bool {
+	iface := cluster.VRRPInterface
+	if iface == "" {
+		iface = "eth0"
+	}
+	output, err := s.dockerSvc.ExecCommand(ctx, node.ContainerID, []string{"ip", "-4", "-o", "addr", "show", "dev", iface})
+	return err == nil && strings.Contains(output, " "+cluster.VirtualIP+"/")
+}
+
+// keepalivedStatus reports whether the keepalived process on the node is alive
+func (s *nginxClusterService) keepalivedStatus(ctx context.Context, node *entities.NginxNode) string {
+	if node.ContainerID == "" {
+		return "stopped"
+	}
+	check := fmt.Sprintf(`if [ -f %[1]s ] && kill -0 "$(cat %[1]s)" 2>/dev/null; then echo running; else echo stopped; fi`, keepalivedPIDPath)
+	output, err := s.dockerSvc.ExecCommand(ctx, node.ContainerID, []string{"sh", "-c", check})
+	if err != nil {
+		return "unknown"
+	}
+	if strings.Contains(output, "running") {
+		return "running"
+	}
+	return "stopped"
+}
+
+// waitForVIP waits for the VIP to come up on the node after a keepalived reload
+func (s *nginxClusterService) waitForVIP(ctx context.Context, cluster *entities.NginxCluster, node *entities.NginxNode) error {
+	deadline := time.Now().Add(keepalivedVIPTimeout)
+	for {
+		if s.nodeHoldsVIP(ctx, cluster, node) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("virtual IP %s did not move to %s within %s", cluster.VirtualIP, node.Name, keepalivedVIPTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// createClusterNetwork creates the cluster's bridge network with the VIP on it. A requested
+// VIP pins the network to its /24 and keeps container addresses in the other half; otherwise
+// the last usable address of the subnet Docker assigned becomes the VIP.
+func (s *nginxClusterService) createClusterNetwork(ctx context.Context, networkName, virtualIP string) (string, string, string, error) {
+	if virtualIP != "" {
+		subnet, ipRange, err := vipNetwork(virtualIP)
+		if err != nil {
+			return "", "", "", err
+		}
+		networkID, err := s.dockerSvc.CreateNetworkWithSubnet(ctx, networkName, subnet, ipRange)
+		return networkID, virtualIP, subnet, err
+	}
+
+	networkID, err := s.dockerSvc.CreateNetwork(ctx, networkName)
+	if err != nil {
+		return "", "", "", err
+	}
+	info, err := s.dockerSvc.InspectNetwork(ctx, networkID)
+	if err != nil {
+		return networkID, "", "", err
+	}
+	for _, config := range info.IPAM.Config {
+		if vip, err := lastUsableIP(config.Subnet); err == nil {
+			return networkID, vip, config.Subnet, nil
+		}
+	}
+	return networkID, "", "", fmt.Errorf("network %s has no IPv4 subnet for the virtual IP", networkName)
+}
+
+// vipNetwork returns the /24 around the VIP and the half of it Docker may allocate from
+func vipNetwork(virtualIP string) (string, string, error) {
+	ip := net.ParseIP(virtualIP).To4()
+	if ip == nil {
+		return "", "", fmt.Errorf("virtual IP %q is not an IPv4 address", virtualIP)
+	}
+	if ip[3] <= 1 || ip[3] == 255 {
+		return "", "", fmt.Errorf("virtual IP %s is a network, gateway or broadcast address", virtualIP)
+	}
+	subnet := fmt.Sprintf("%d.%d.%d.0/24", ip[0], ip[1], ip[2])
+	ipRange := fmt.Sprintf("%d.%d.%d.0/25", ip[0], ip[1], ip[2])
+	if ip[3] < 128 {
+		ipRange = fmt.Sprintf("%d.%d.%d.128/25", ip[0], ip[1], ip[2])
+	}
+	return subnet, ipRange, nil
+}
+
+// lastUsableIP returns the address just below the broadcast address of an IPv4 subnet.
+// Docker allocates container addresses from the bottom, so it stays free.
+func lastUsableIP(cidr string) (string, error) {
+	_, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	network := subnet.IP.To4()
+	if network == nil {
+		return "", fmt.Errorf("%s is not an IPv4 subnet", cidr)
+	}
+	ones, bits := subnet.Mask.Size()
+	if bits-ones < 2 {
+		return "", fmt.Errorf("subnet %s is too small for a virtual IP", cidr)
+	}
+	broadcast := binary.BigEndian.Uint32(network) | ^binary.BigEndian.Uint32(net.IP(subnet.Mask).To4())
+	last := make(net.IP, 4)
+	binary.BigEndian.PutUint32(last, broadcast-1)
+	return last.String(), nil
+}
+
+// generateVRRPPassword returns a random password for keepalived PASS authentication
+func generateVRRPPassword() (string, error) {
+	pass := make([]byte, 8)
+	for i := range pass {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(keepalivedPassChars))))
+		if err != nil {
+			return "", err
+		}
+		pass[i] = keepalivedPassChars[n.Int64()]
+	}
+	return string(pass), nil
+}
+
+// containerNetworkIP returns the container's address on the named network. NetworkSettings.IPAddress
+// only covers the default bridge, so it is empty for nodes on the cluster network.
+func containerNetworkIP(info *types.ContainerJSON, networkName string) string {
+	if info == nil || info.NetworkSettings == nil {
+		return ""
+	}
+	if endpoint, ok := info.NetworkSettings.Networks[networkName]; ok && endpoint != nil && endpoint.IPAddress != "" {
+		return endpoint.IPAddress
+	}
+	return info.NetworkSettings.IPAddress
+}
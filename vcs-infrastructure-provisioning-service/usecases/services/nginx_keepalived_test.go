@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderKeepalivedConfig(t *testing.T) {
+	cluster := &entities.NginxCluster{
+		ClusterName:         "web",
+		VirtualIP:           "172.30.5.200",
+		VRRPSubnet:          "172.30.5.0/24",
+		VRRPInterface:       "eth0",
+		VRRPRouterID:        51,
+		VRRPAuthPass:        "s3cretPw",
+		HealthCheckEnabled:  true,
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: 3,
+	}
+	nodes := []entities.NginxNode{
+		{ID: "n1", Name: "web-nginx-1", Role: "master", Priority: keepalivedMasterPriority, IPAddress: "172.30.5.2"},
+		{ID: "n2", Name: "web-nginx-2", Role: "backup", Priority: 99, IPAddress: "172.30.5.3"},
+		{ID: "n3", Name: "web-nginx-3", Role: "backup", Priority: 98, IPAddress: "172.30.5.4"},
+	}
+
+	conf, err := renderKeepalivedConfig(cluster, &nodes[1], nodes)
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "router_id web-nginx-2")
+	assert.Contains(t, conf, "script \"/usr/bin/wget -q -T 2 -O /dev/null http://127.0.0.1:80/health\"\n    interval 3")
+	assert.Contains(t, conf, "vrrp_instance VI_51 {\n    state BACKUP\n    interface eth0\n    virtual_router_id 51\n    priority 99")
+	assert.Contains(t, conf, "unicast_src_ip 172.30.5.3")
+	assert.Contains(t, conf, "unicast_peer {\n        172.30.5.2\n        172.30.5.4\n    }")
+	assert.Contains(t, conf, "auth_type PASS\n        auth_pass s3cretPw")
+	assert.Contains(t, conf, "172.30.5.200/24 dev eth0")
+	assert.Contains(t, conf, "track_script {\n        chk_nginx\n    }")
+
+	conf, err = renderKeepalivedConfig(cluster, &nodes[0], nodes)
+	assert.NoError(t, err)
+	assert.Contains(t, conf, "state MASTER")
+	assert.Contains(t, conf, "priority 150")
+
+	cluster.HealthCheckEnabled = false
+	conf, err = renderKeepalivedConfig(cluster, &nodes[0], nodes)
+	assert.NoError(t, err)
+	assert.NotContains(t, conf, "chk_nginx")
+
+	cluster.HealthCheckPath = "/health; reboot"
+	_, err = renderKeepalivedConfig(cluster, &nodes[0], nodes)
+	assert.Error(t, err)
+
+	cluster.HealthCheckPath = "/health"
+	cluster.VirtualIP = "not-an-ip"
+	_, err = renderKeepalivedConfig(cluster, &nodes[0], nodes)
+	assert.Error(t, err)
+}
+
+func TestConfigureKeepalivedNeedsReloadMarker(t *testing.T) {
+	// Node c2 lacks keepalived: the shell fails but the exec itself still returns no error
+	dockerSvc := newScriptedDocker(func(containerID string, cmd []string) string {
+		if containerID == "c2" {
+			return "sh: keepalived: not found"
+		}
+		return keepalivedReadyMarker
+	})
+	svc := &nginxClusterService{clusterRepo: serverBlockClusterRepo{}, dockerSvc: dockerSvc, logger: discardLogger{}}
+	cluster := &entities.NginxCluster{ID: "cluster-1", ClusterName: "edge", VirtualIP: "172.30.5.200", VRRPRouterID: 51}
+
+	err := svc.configureKeepalived(context.Background(), cluster)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "edge-2")
+	assert.NotContains(t, err.Error(), "edge-1")
+	assert.Contains(t, dockerSvc.file("c1", keepalivedConfPath), "state MASTER")
+	for _, cmd := range dockerSvc.execs {
+		assert.True(t, strings.HasSuffix(cmd[len(cmd)-1], "echo "+keepalivedReadyMarker))
+	}
+}
+
+func TestCheckKeepalived(t *testing.T) {
+	output := keepalivedReadyMarker
+	svc := &nginxClusterService{dockerSvc: newScriptedDocker(func(string, []string) string { return output })}
+	assert.NoError(t, svc.checkKeepalived(context.Background(), "c1"))
+
+	output = ""
+	assert.ErrorContains(t, svc.checkKeepalived(context.Background(), "c1"), "not installed")
+}
+
+func TestVIPNetwork(t *testing.T) {
+	subnet, ipRange, err := vipNetwork("172.30.5.200")
+	assert.NoError(t, err)
+	assert.Equal(t, "172.30.5.0/24", subnet)
+	assert.Equal(t, "172.30.5.0/25", ipRange)
+
+	_, ipRange, err = vipNetwork("10.1.2.50")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.1.2.128/25", ipRange)
+
+	for _, vip := range []string{"10.1.2.0", "10.1.2.1", "10.1.2.255", "fd00::10", ""} {
+		_, _, err := vipNetwork(vip)
+		assert.Error(t, err, vip)
+	}
+}
+
+func TestLastUsableIP(t *testing.T) {
+	ip, err := lastUsableIP("172.18.0.0/16")
+	assert.NoError(t, err)
+	assert.Equal(t, "172.18.255.254", ip)
+
+	ip, err = lastUsableIP("192.168.10.0/24")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.10.254", ip)
+
+	_, err = lastUsableIP("10.0.0.0/31")
+	assert.Error(t, err)
+	_, err = lastUsableIP("fd00::/64")
+	assert.Error(t, err)
+}
+
+func TestGenerateVRRPPassword(t *testing.T) {
+	pass, err := generateVRRPPassword()
+	assert.NoError(t, err)
+	assert.Len(t, pass, 8)
+	assert.Regexp(t, `^[A-Za-z0-9]{8}$`, pass)
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/kafka"
+	"go.uber.org/zap"
+)
+
+const (
+	nginxStatusPath       = "/nginx_status"
+	nginxMetricsInterval  = 15 * time.Second
+	nginxMetricsAction    = "nginx.metrics"
+	nginxRateMinimumSpan  = time.Second // samples closer together than this reuse the previous rate
+	nginxStatusActiveLine = "Active connections:"
+)
+
+// stubStatus holds the counters reported by the stub_status module
+type stubStatus struct {
+	ActiveConnections int64
+	Accepts           int64
+	Handled           int64
+	Requests          int64
+	Reading           int64
+	Writing           int64
+	Waiting           int64
+}
+
+// parseStubStatus reads stub_status output:
+//
+//	Active connections: 2
+//	server accepts handled requests
+//	 10 10 25
+//	Reading: 0 Writing: 1 Waiting: 1
+func parseStubStatus(output string) (*stubStatus, error) {
+	status := &stubStatus{}
+	found := false
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, nginxStatusActiveLine):
+			value, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, nginxStatusActiveLine)), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid active connections line %q", line)
+			}
+			status.ActiveConnections = value
+			found = true
+		case strings.HasPrefix(line, "server accepts handled requests") && i+1 < len(lines):
+			fields := strings.Fields(lines[i+1])
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("invalid request counters line %q", lines[i+1])
+			}
+			counters := []*int64{&status.Accepts, &status.Handled, &status.Requests}
+			for j, counter := range counters {
+				value, err := strconv.ParseInt(fields[j], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid request counters line %q", lines[i+1])
+				}
+				*counter = value
+			}
+		case strings.HasPrefix(line, "Reading:"):
+			// Reading: 0 Writing: 1 Waiting: 1
+			fields := strings.Fields(line)
+			for j := 0; j+1 < len(fields); j += 2 {
+				value, err := strconv.ParseInt(fields[j+1], 10, 64)
+				if err != nil {
+					continue
+				}
+				switch fields[j] {
+				case "Reading:":
+					status.Reading = value
+				case "Writing:":
+					status.Writing = value
+				case "Waiting:":
+					status.Waiting = value
+				}
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no stub_status output")
+	}
+	return status, nil
+}
+
+// stubStatusCommand fetches the status page from inside an nginx container
+func stubStatusCommand() []string {
+	url := "http://127.0.0.1" + nginxStatusPath
+	return []string{"sh", "-c", fmt.Sprintf(
+		"curl -fsS --max-time 3 %[1]s 2>/dev/null || wget -q -T 3 -O - %[1]s", url)}
+}
+
+func scrapeStubStatus(ctx context.Context, dockerSvc docker.IDockerService, containerID string) (*stubStatus, error) {
+	if containerID == "" {
+		return nil, fmt.Errorf("nginx container is not created")
+	}
+	output, err := dockerSvc.ExecCommand(ctx, containerID, stubStatusCommand())
+	if err != nil {
+		return nil, err
+	}
+	return parseStubStatus(output)
+}
+
+// requestRateTracker turns the cumulative request counter into requests per second
+type requestRateTracker struct {
+	mu      sync.Mutex
+	samples map[string]requestRateSample
+}
+
+type requestRateSample struct {
+	requests int64
+	at       time.Time
+	rate     float64
+}
+
+func newRequestRateTracker() *requestRateTracker {
+	return &requestRateTracker{samples: make(map[string]requestRateSample)}
+}
+
+// rate records a counter reading for key and returns the rate since the previous reading.
+// The first reading and a counter reset after a restart report 0.
+func (t *requestRateTracker) rate(key string, requests int64, now time.Time) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous, ok := t.samples[key]
+	if ok && now.Sub(previous.at) < nginxRateMinimumSpan {
+		return previous.rate
+	}
+	sample := requestRateSample{requests: requests, at: now}
+	if ok && requests >= previous.requests {
+		sample.rate = float64(requests-previous.requests) / now.Sub(previous.at).Seconds()
+	}
+	t.samples[key] = sample
+	return sample.rate
+}
+
+// nginxMetricsMetadata is the event payload the monitoring service indexes as a metric
+func nginxMetricsMetadata(status *stubStatus, rate float64) map[string]interface{} {
+	return map[string]interface{}{
+		"active_connections":  status.ActiveConnections,
+		"accepts":             status.Accepts,
+		"handled":             status.Handled,
+		"requests":            status.Requests,
+		"reading":             status.Reading,
+		"writing":             status.Writing,
+		"waiting":             status.Waiting,
+		"requests_per_second": rate,
+	}
+}
+
+func (s *nginxService) GetMetrics(ctx context.Context, id string) (*dto.NginxMetricsResponse, error) {
+	instance, err := s.nginxRepo.FindByInfrastructureID(id)
+	if err != nil {
+		return nil, err
+	}
+	status, err := scrapeStubStatus(ctx, s.dockerSvc, instance.ContainerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read nginx status: %w", err)
+	}
+	return &dto.NginxMetricsResponse{
+		InstanceID:     id,
+		ActiveConns:    status.ActiveConnections,
+		Accepts:        status.Accepts,
+		Handled:        status.Handled,
+		TotalRequests:  status.Requests,
+		RequestsPerSec: s.requestRates.rate(instance.ID, status.Requests, time.Now()),
+		Reading:        status.Reading,
+		Writing:        status.Writing,
+		Waiting:        status.Waiting,
+	}, nil
+}
+
+// StartMetricsCollector scrapes every running instance on nginxMetricsInterval and
+// publishes the numbers for the monitoring service until ctx is cancelled
+func (s *nginxService) StartMetricsCollector(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(nginxMetricsInterval)
+		defer ticker.Stop()
+
+		for {
+			s.collectMetrics(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *nginxService) collectMetrics(ctx context.Context) {
+	instances, err := s.nginxRepo.ListAll()
+	if err != nil {
+		s.logger.Error("failed to list nginx instances for metrics", zap.Error(err))
+		return
+	}
+	for i := range instances {
+		instance := &instances[i]
+		if instance.Infrastructure.Status != entities.StatusRunning {
+			continue
+		}
+		status, err := scrapeStubStatus(ctx, s.dockerSvc, instance.ContainerID)
+		if err != nil {
+			s.logger.Debug("failed to scrape nginx status", zap.String("instance_id", instance.ID), zap.Error(err))
+			continue
+		}
+		rate := s.requestRates.rate(instance.ID, status.Requests, time.Now())
+		s.kafkaProducer.PublishEvent(ctx, kafka.InfrastructureEvent{
+			InstanceID: instance.InfrastructureID,
+			UserID:     instance.Infrastructure.UserID,
+			Type:       "nginx",
+			Action:     nginxMetricsAction,
+			Metadata:   nginxMetricsMetadata(status, rate),
+		})
+	}
+}
+
+// getNginxMetrics reads stub_status of a single node; unreachable nodes report zeros
+func (s *nginxClusterService) getNginxMetrics(ctx context.Context, node *entities.NginxNode) dto.NginxNodeMetrics {
+	metrics := dto.NginxNodeMetrics{
+		NodeID:   node.ID,
+		NodeName: node.Name,
+		Role:     node.Role,
+	}
+	status, err := scrapeStubStatus(ctx, s.dockerSvc, node.ContainerID)
+	if err != nil {
+		s.logger.Debug("failed to scrape nginx node status", zap.String("node_id", node.ID), zap.Error(err))
+		return metrics
+	}
+	metrics.ActiveConns = int(status.ActiveConnections)
+	metrics.Accepts = status.Accepts
+	metrics.Handled = status.Handled
+	metrics.TotalRequests = status.Requests
+	metrics.RequestsPerSec = s.requestRates.rate(node.ID, status.Requests, time.Now())
+	metrics.Reading = status.Reading
+	metrics.Writing = status.Writing
+	metrics.Waiting = status.Waiting
+	return metrics
+}
+
+// StartMetricsCollector scrapes every node of running clusters on nginxMetricsInterval
+// and publishes the numbers for the monitoring service until ctx is cancelled
+func (s *nginxClusterService) StartMetricsCollector(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(nginxMetricsInterval)
+		defer ticker.Stop()
+
+		for {
+			s.collectMetrics(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *nginxClusterService) collectMetrics(ctx context.Context) {
+	if s.kafkaProducer == nil {
+		return
+	}
+	clusters, err := s.clusterRepo.ListAll()
+	if err != nil {
+		s.logger.Error("failed to list nginx clusters for metrics", zap.Error(err))
+		return
+	}
+	for i := range clusters {
+		cluster := &clusters[i]
+		if cluster.Infrastructure.Status != entities.StatusRunning {
+			continue
+		}
+		nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+		if err != nil {
+			s.logger.Error("failed to list nginx nodes", zap.String("cluster_id", cluster.ID), zap.Error(err))
+			continue
+		}
+		for j := range nodes {
+			node := &nodes[j]
+			status, err := scrapeStubStatus(ctx, s.dockerSvc, node.ContainerID)
+			if err != nil {
+				s.logger.Debug("failed to scrape nginx node status", zap.String("node_id", node.ID), zap.Error(err))
+				continue
+			}
+			metadata := nginxMetricsMetadata(status, s.requestRates.rate(node.ID, status.Requests, time.Now()))
+			metadata["cluster_id"] = cluster.ID
+			metadata["node_name"] = node.Name
+			metadata["role"] = node.Role
+			s.kafkaProducer.PublishEvent(ctx, kafka.InfrastructureEvent{
+				InstanceID: node.ID,
+				UserID:     cluster.Infrastructure.UserID,
+				Type:       "nginx_cluster",
+				Action:     nginxMetricsAction,
+				Metadata:   metadata,
+			})
+		}
+	}
+}
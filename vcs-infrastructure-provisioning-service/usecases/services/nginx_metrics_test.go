@@ -0,0 +1,42 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStubStatus(t *testing.T) {
+	output := "Active connections: 291 \nserver accepts handled requests\n 16630948 16630946 31070465 \nReading: 6 Writing: 179 Waiting: 106 \n"
+
+	status, err := parseStubStatus(output)
+	assert.NoError(t, err)
+	assert.Equal(t, &stubStatus{
+		ActiveConnections: 291,
+		Accepts:           16630948,
+		Handled:           16630946,
+		Requests:          31070465,
+		Reading:           6,
+		Writing:           179,
+		Waiting:           106,
+	}, status)
+
+	_, err = parseStubStatus("<html>403 Forbidden</html>")
+	assert.Error(t, err)
+	_, err = parseStubStatus("Active connections: 1\nserver accepts handled requests\n 1 x 3\n")
+	assert.Error(t, err)
+}
+
+func TestRequestRateTracker(t *testing.T) {
+	tracker := newRequestRateTracker()
+	start := time.Now()
+
+	assert.Zero(t, tracker.rate("n1", 100, start))
+	assert.Equal(t, 5.0, tracker.rate("n1", 150, start.Add(10*time.Second)))
+	// A reading right after the previous one keeps the last rate
+	assert.Equal(t, 5.0, tracker.rate("n1", 151, start.Add(10*time.Second+100*time.Millisecond)))
+	// The counter restarts with nginx
+	assert.Zero(t, tracker.rate("n1", 3, start.Add(20*time.Second)))
+	assert.Zero(t, tracker.rate("n2", 500, start))
+}
@@ -32,6 +32,10 @@ type INginxService interface {
 	AddRoute(ctx context.Context, id string, req dto.AddRouteRequest) (*dto.RouteInfo, error)
 	UpdateRoute(ctx context.Context, id, routeID string, req dto.UpdateRouteRequest) error
 	DeleteRoute(ctx context.Context, id, routeID string) error
+	SetRouteCanary(ctx context.Context, id, routeID string, req dto.SetRouteCanaryRequest) (*dto.RouteInfo, error)
+	ShiftRouteCanary(ctx context.Context, id, routeID string, req dto.ShiftRouteCanaryRequest) (*dto.RouteInfo, error)
+	PromoteRouteCanary(ctx context.Context, id, routeID string) (*dto.RouteInfo, error)
+	AbortRouteCanary(ctx context.Context, id, routeID string) (*dto.RouteInfo, error)
 	UploadCertificate(ctx context.Context, id string, req dto.UploadCertificateRequest) error
 	GetCertificate(ctx context.Context, id string) (*dto.CertificateInfo, error)
 	UpdateUpstreams(ctx context.Context, id string, req dto.UpdateUpstreamsRequest) error
@@ -42,29 +46,61 @@ type INginxService interface {
 	GetLogs(ctx context.Context, id string, tail int) (*dto.NginxLogsResponse, error)
 	GetMetrics(ctx context.Context, id string) (*dto.NginxMetricsResponse, error)
 	GetStats(ctx context.Context, id string) (*dto.NginxStatsResponse, error)
+
+	GetWAFPolicy(ctx context.Context, id string) (*dto.WAFPolicyInfo, error)
+	SetWAFMode(ctx context.Context, id string, req dto.SetWAFModeRequest) (*dto.WAFPolicyInfo, error)
+	AddWAFExclusion(ctx context.Context, id string, req dto.AddWAFExclusionRequest) (*dto.WAFExclusionInfo, error)
+	DeleteWAFExclusion(ctx context.Context, id, exclusionID string) error
+
+	ListConfigRevisions(ctx context.Context, id string) ([]dto.NginxConfigRevisionInfo, error)
+	GetConfigRevision(ctx context.Context, id string, revision int) (*dto.NginxConfigRevisionInfo, error)
+	DiffConfigRevisions(ctx context.Context, id string, from, to int) (*dto.NginxConfigDiffResponse, error)
+	RollbackConfig(ctx context.Context, id string, revision int) (*dto.NginxConfigRevisionInfo, error)
+
+	StartUpstreamHealthMonitor(ctx context.Context)
+	StartMetricsCollector(ctx context.Context)
+	StartAccessLogCollector(ctx context.Context)
+
+	// Docker service replicas
+	SetUpstreamRequestRecorder(recorder UpstreamRequestRecorder)
+	SyncDockerServiceBackends(ctx context.Context, service *entities.DockerService) (int, error)
 }
 
 type nginxService struct {
-	infraRepo     repositories.IInfrastructureRepository
-	nginxRepo     repositories.INginxRepository
-	dockerSvc     docker.IDockerService
-	kafkaProducer kafka.IKafkaProducer
-	logger        logger.ILogger
+	infraRepo      repositories.IInfrastructureRepository
+	nginxRepo      repositories.INginxRepository
+	revisionRepo   repositories.INginxConfigRevisionRepository
+	wafRepo        repositories.INginxWAFRepository
+	dockerSvc      docker.IDockerService
+	kafkaProducer  kafka.IKafkaProducer
+	logger         logger.ILogger
+	upstreamHealth *upstreamHealthTracker
+	requestRates   *requestRateTracker
+	accessLogs     *accessLogCursor
+
+	requestRecorder UpstreamRequestRecorder
 }
 
 func NewNginxService(
 	infraRepo repositories.IInfrastructureRepository,
 	nginxRepo repositories.INginxRepository,
+	revisionRepo repositories.INginxConfigRevisionRepository,
+	wafRepo repositories.INginxWAFRepository,
 	dockerSvc docker.IDockerService,
 	kafkaProducer kafka.IKafkaProducer,
 	logger logger.ILogger,
 ) INginxService {
 	return &nginxService{
-		infraRepo:     infraRepo,
-		nginxRepo:     nginxRepo,
-		dockerSvc:     dockerSvc,
-		kafkaProducer: kafkaProducer,
-		logger:        logger,
+		infraRepo:      infraRepo,
+		nginxRepo:      nginxRepo,
+		revisionRepo:   revisionRepo,
+		wafRepo:        wafRepo,
+		dockerSvc:      dockerSvc,
+		kafkaProducer:  kafkaProducer,
+		logger:         logger,
+		upstreamHealth: newUpstreamHealthTracker(),
+		requestRates:   newRequestRateTracker(),
+		accessLogs:     newAccessLogCursor(),
 	}
 }
 
@@ -93,6 +129,8 @@ func (s *nginxService) CreateNginx(ctx context.Context, userID string, req dto.C
 		Config:           req.Config,
 		CPULimit:         req.CPULimit,
 		MemoryLimit:      req.MemoryLimit,
+		WAFEnabled:       req.WAFEnabled,
+		WAFMode:          entities.NginxWAFOff,
 	}
 
 	if err := s.nginxRepo.Create(instance); err != nil {
@@ -110,26 +148,7 @@ func (s *nginxService) CreateNginx(ctx context.Context, userID string, req dto.C
 
 	instance.VolumeID = volumeName
 
-	containerName := fmt.Sprintf("iaas-nginx-%s", instanceID)
-	ports := map[string]string{
-		"80": fmt.Sprintf("%d", req.Port),
-	}
-	if req.SSLPort > 0 {
-		ports["443"] = fmt.Sprintf("%d", req.SSLPort)
-	}
-
-	containerConfig := docker.ContainerConfig{
-		Name:  containerName,
-		Image: "nginx:latest",
-		Ports: ports,
-		Volumes: map[string]string{
-			volumeName: "/etc/nginx/conf.d",
-		},
-		Resources: docker.ResourceConfig{
-			CPULimit:    req.CPULimit,
-			MemoryLimit: req.MemoryLimit,
-		},
-	}
+	containerConfig := nginxContainerConfig(instance)
 
 	containerID, err := s.dockerSvc.CreateContainer(ctx, containerConfig)
 	if err != nil {
@@ -160,6 +179,11 @@ func (s *nginxService) CreateNginx(ctx context.Context, userID string, req dto.C
 		s.logger.Error("failed to update nginx instance", zap.Error(err))
 	}
 
+	// Replace the image's default server with the rendered one
+	if err := s.applyNginxConfig(ctx, &nginxConfigState{instance: instance}, nginxConfigChange{action: nginxActionCreated}); err != nil {
+		s.logger.Error("failed to apply initial nginx config", zap.String("instance_id", instanceID), zap.Error(err))
+	}
+
 	event := kafka.InfrastructureEvent{
 		InstanceID: infraID,
 		UserID:     userID,
@@ -186,11 +210,41 @@ func (s *nginxService) CreateNginx(ctx context.Context, userID string, req dto.C
 		Config:      req.Config,
 		CPULimit:    req.CPULimit,
 		MemoryLimit: req.MemoryLimit,
+		WAF:         toWAFPolicyInfo(req.WAFEnabled, entities.NginxWAFOff, nil),
 		CreatedAt:   infra.CreatedAt.Format(time.RFC3339),
 		UpdatedAt:   infra.UpdatedAt.Format(time.RFC3339),
 	}, nil
 }
 
+// nginxContainerConfig builds the container spec of a single Nginx instance
+func nginxContainerConfig(instance *entities.NginxInstance) docker.ContainerConfig {
+	ports := map[string]string{
+		"80": fmt.Sprintf("%d", instance.Port),
+	}
+	if instance.SSLPort > 0 {
+		ports["443"] = fmt.Sprintf("%d", instance.SSLPort)
+	}
+
+	config := docker.ContainerConfig{
+		Name:  fmt.Sprintf("iaas-nginx-%s", instance.ID),
+		Image: "nginx:latest",
+		Ports: ports,
+		Volumes: map[string]string{
+			instance.VolumeID: "/etc/nginx/conf.d",
+		},
+		Resources: docker.ResourceConfig{
+			CPULimit:    instance.CPULimit,
+			MemoryLimit: instance.MemoryLimit,
+		},
+	}
+	if instance.WAFEnabled {
+		config.Image = nginxWAFImage
+		config.Env = nginxWAFEnv
+		config.User = nginxWAFUser
+	}
+	return config
+}
+
 func (s *nginxService) StartNginx(ctx context.Context, id string) error {
 	infra, err := s.infraRepo.FindByID(id)
 	if err != nil {
@@ -209,6 +263,13 @@ func (s *nginxService) StartNginx(ctx context.Context, id string) error {
 		return err
 	}
 
+	// Changes made while the container was stopped were only stored
+	if state, err := s.loadConfigState(instance); err == nil {
+		if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: nginxActionReapplied}); err != nil {
+			s.logger.Error("failed to apply nginx config on start", zap.String("instance_id", id), zap.Error(err))
+		}
+	}
+
 	infra.Status = entities.StatusRunning
 	if err := s.infraRepo.Update(infra); err != nil {
 		s.logger.Error("failed to update infrastructure status", zap.Error(err))
@@ -277,6 +338,15 @@ func (s *nginxService) RestartNginx(ctx context.Context, id string) error {
 		return err
 	}
 
+	// The ModSecurity image renders its own default server into conf.d on every start
+	if instance.WAFEnabled {
+		if state, err := s.loadConfigState(instance); err == nil {
+			if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: nginxActionReapplied}); err != nil {
+				s.logger.Error("failed to apply nginx config on restart", zap.String("instance_id", id), zap.Error(err))
+			}
+		}
+	}
+
 	infra.Status = entities.StatusRunning
 	if err := s.infraRepo.Update(infra); err != nil {
 		s.logger.Error("failed to update infrastructure status", zap.Error(err))
@@ -322,6 +392,15 @@ func (s *nginxService) DeleteNginx(ctx context.Context, id string) error {
 	if err := s.nginxRepo.Delete(instance.ID); err != nil {
 		s.logger.Error("failed to delete nginx instance", zap.Error(err))
 	}
+	if err := s.revisionRepo.DeleteByResource(entities.NginxRevisionInstance, instance.ID); err != nil {
+		s.logger.Error("failed to delete nginx config revisions", zap.Error(err))
+	}
+	if err := s.wafRepo.DeleteByResource(entities.NginxRevisionInstance, instance.ID); err != nil {
+		s.logger.Error("failed to delete nginx waf exclusions", zap.Error(err))
+	}
+	if err := s.nginxRepo.DeleteCertificate(instance.ID); err != nil {
+		s.logger.Error("failed to delete nginx certificate", zap.Error(err))
+	}
 
 	infra.Status = entities.StatusDeleted
 	if err := s.infraRepo.Update(infra); err != nil {
@@ -386,8 +465,9 @@ func (s *nginxService) GetNginxInfo(ctx context.Context, id string) (*dto.NginxI
 		ContainerID: instance.ContainerID,
 		Port:        instance.Port,
 		SSLPort:     instance.SSLPort,
-		Config:      instance.Config,
-		CPULimit:    instance.CPULimit,
+		Config:           instance.Config,
+		CustomDirectives: instance.CustomDirectives,
+		CPULimit:         instance.CPULimit,
 		MemoryLimit: instance.MemoryLimit,
 		CreatedAt:   infra.CreatedAt.Format(time.RFC3339),
 		UpdatedAt:   infra.UpdatedAt.Format(time.RFC3339),
@@ -400,13 +480,8 @@ func (s *nginxService) GetNginxInfo(ctx context.Context, id string) (*dto.NginxI
 	}
 
 	if routes, err := s.nginxRepo.ListRoutes(instance.ID); err == nil {
-		for _, r := range routes {
-			response.Routes = append(response.Routes, dto.RouteInfo{
-				ID:       r.ID,
-				Path:     r.Path,
-				Backend:  r.Backend,
-				Priority: r.Priority,
-			})
+		for i := range routes {
+			response.Routes = append(response.Routes, toRouteInfo(&routes[i]))
 		}
 	}
 
@@ -415,8 +490,9 @@ func (s *nginxService) GetNginxInfo(ctx context.Context, id string) (*dto.NginxI
 			var backends []dto.BackendServer
 			for _, b := range u.Backends {
 				backends = append(backends, dto.BackendServer{
-					Address: b.Address,
-					Weight:  b.Weight,
+					Address:         b.Address,
+					Weight:          b.Weight,
+					DockerServiceID: b.DockerServiceID,
 				})
 			}
 			response.Upstreams = append(response.Upstreams, dto.UpstreamInfo{
@@ -460,6 +536,12 @@ func (s *nginxService) GetNginxInfo(ctx context.Context, id string) (*dto.NginxI
 		response.Security = policy
 	}
 
+	if instance.WAFEnabled {
+		if exclusions, err := s.wafRepo.ListExclusions(entities.NginxRevisionInstance, instance.ID); err == nil {
+			response.WAF = toWAFPolicyInfo(true, instance.WAFMode, exclusions)
+		}
+	}
+
 	return response, nil
 }
 
@@ -470,14 +552,18 @@ func (s *nginxService) UpdateNginxConfig(ctx context.Context, id string, req dto
 		return err
 	}
 
-	instance.Config = req.Config
-	if err := s.nginxRepo.Update(instance); err != nil {
-		s.logger.Error("failed to update nginx config", zap.Error(err))
+	state, err := s.loadConfigState(instance)
+	if err != nil {
+		return err
+	}
+	instance.CustomDirectives = req.Config
+	if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: "config_updated"}); err != nil {
+		s.logger.Error("failed to apply nginx config", zap.String("instance_id", id), zap.Error(err))
 		return err
 	}
 
-	if err := s.dockerSvc.RestartContainer(ctx, instance.ContainerID); err != nil {
-		s.logger.Error("failed to restart container after config update", zap.Error(err))
+	if err := s.nginxRepo.Update(instance); err != nil {
+		s.logger.Error("failed to update nginx config", zap.Error(err))
 		return err
 	}
 
@@ -494,16 +580,24 @@ func (s *nginxService) UpdateNginxConfig(ctx context.Context, id string, req dto
 }
 
 func (s *nginxService) AddDomain(ctx context.Context, id string, req dto.AddDomainRequest) error {
+	if err := validateNginxValue("domain", req.Domain); err != nil {
+		return err
+	}
 	instance, err := s.nginxRepo.FindByInfrastructureID(id)
 	if err != nil {
 		return err
 	}
-	if err := s.nginxRepo.CreateDomain(&entities.NginxDomain{
-		ID: uuid.New().String(), NginxID: instance.ID, Domain: req.Domain,
-	}); err != nil {
+	state, err := s.loadConfigState(instance)
+	if err != nil {
 		return err
 	}
-	return nil
+
+	domain := &entities.NginxDomain{ID: uuid.New().String(), NginxID: instance.ID, Domain: req.Domain}
+	state.domains = append(state.domains, *domain)
+	if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: "domain_added"}); err != nil {
+		return err
+	}
+	return s.nginxRepo.CreateDomain(domain)
 }
 
 func (s *nginxService) DeleteDomain(ctx context.Context, id, domain string) error {
@@ -511,21 +605,60 @@ func (s *nginxService) DeleteDomain(ctx context.Context, id, domain string) erro
 	if err != nil {
 		return err
 	}
+	state, err := s.loadConfigState(instance)
+	if err != nil {
+		return err
+	}
+
+	domains := state.domains[:0]
+	for _, d := range state.domains {
+		if d.Domain != domain {
+			domains = append(domains, d)
+		}
+	}
+	state.domains = domains
+	if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: "domain_deleted"}); err != nil {
+		return err
+	}
 	return s.nginxRepo.DeleteDomain(instance.ID, domain)
 }
 
 func (s *nginxService) AddRoute(ctx context.Context, id string, req dto.AddRouteRequest) (*dto.RouteInfo, error) {
+	if !strings.HasPrefix(req.Path, "/") {
+		return nil, fmt.Errorf("route path must start with /")
+	}
+	if err := validateNginxValue("path", req.Path); err != nil {
+		return nil, err
+	}
+	if err := validateNginxValue("backend", req.Backend); err != nil {
+		return nil, err
+	}
 	instance, err := s.nginxRepo.FindByInfrastructureID(id)
 	if err != nil {
 		return nil, err
 	}
+	state, err := s.loadConfigState(instance)
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range state.routes {
+		if existing.Path == req.Path {
+			return nil, fmt.Errorf("a route for %s already exists", req.Path)
+		}
+	}
+
 	route := &entities.NginxRoute{
 		ID: uuid.New().String(), NginxID: instance.ID, Path: req.Path, Backend: req.Backend, Priority: req.Priority,
 	}
+	state.routes = append(state.routes, *route)
+	if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: "route_added"}); err != nil {
+		return nil, err
+	}
 	if err := s.nginxRepo.CreateRoute(route); err != nil {
 		return nil, err
 	}
-	return &dto.RouteInfo{ID: route.ID, Path: route.Path, Backend: route.Backend, Priority: route.Priority}, nil
+	info := toRouteInfo(route)
+	return &info, nil
 }
 
 func (s *nginxService) UpdateRoute(ctx context.Context, id, routeID string, req dto.UpdateRouteRequest) error {
@@ -541,13 +674,54 @@ func (s *nginxService) UpdateRoute(ctx context.Context, id, routeID string, req
 		return fmt.Errorf("route does not belong to this nginx instance")
 	}
 	if req.Backend != "" {
+		if err := validateNginxValue("backend", req.Backend); err != nil {
+			return err
+		}
 		route.Backend = req.Backend
 	}
 	route.Priority = req.Priority
+
+	state, err := s.loadConfigState(instance)
+	if err != nil {
+		return err
+	}
+	for i := range state.routes {
+		if state.routes[i].ID == route.ID {
+			state.routes[i] = *route
+		}
+	}
+	if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: "route_updated"}); err != nil {
+		return err
+	}
 	return s.nginxRepo.UpdateRoute(route)
 }
 
 func (s *nginxService) DeleteRoute(ctx context.Context, id, routeID string) error {
+	instance, err := s.nginxRepo.FindByInfrastructureID(id)
+	if err != nil {
+		return err
+	}
+	state, err := s.loadConfigState(instance)
+	if err != nil {
+		return err
+	}
+
+	routes := state.routes[:0]
+	found := false
+	for _, route := range state.routes {
+		if route.ID == routeID {
+			found = true
+			continue
+		}
+		routes = append(routes, route)
+	}
+	if !found {
+		return fmt.Errorf("route does not belong to this nginx instance")
+	}
+	state.routes = routes
+	if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: "route_deleted"}); err != nil {
+		return err
+	}
 	return s.nginxRepo.DeleteRoute(routeID)
 }
 
@@ -564,11 +738,21 @@ func (s *nginxService) UploadCertificate(ctx context.Context, id string, req dto
 	if err != nil {
 		return err
 	}
-	return s.nginxRepo.CreateOrUpdateCertificate(&entities.NginxCertificate{
-		ID: uuid.New().String(), NginxID: instance.ID, Domain: req.Domain,
-		Certificate: req.Certificate, PrivateKey: req.PrivateKey,
+	state, err := s.loadConfigState(instance)
+	if err != nil {
+		return err
+	}
+
+	state.certificate = &entities.NginxCertificate{
+		ID: uuid.New().String(), NginxID: instance.ID, OwnerType: entities.CertificateOwnerInstance,
+		Domain: req.Domain, Certificate: req.Certificate, PrivateKey: req.PrivateKey,
 		Status: "valid", ExpiresAt: cert.NotAfter, Issuer: cert.Issuer.String(),
-	})
+		Source: entities.CertificateSourceManual,
+	}
+	if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: "certificate_uploaded"}); err != nil {
+		return err
+	}
+	return s.nginxRepo.CreateOrUpdateCertificate(state.certificate)
 }
 
 func (s *nginxService) GetCertificate(ctx context.Context, id string) (*dto.CertificateInfo, error) {
@@ -580,28 +764,64 @@ func (s *nginxService) GetCertificate(ctx context.Context, id string) (*dto.Cert
 	if err != nil {
 		return nil, err
 	}
-	return &dto.CertificateInfo{
+	return toCertificateInfo(cert), nil
+}
+
+func toCertificateInfo(cert *entities.NginxCertificate) *dto.CertificateInfo {
+	info := &dto.CertificateInfo{
 		Domain: cert.Domain, Status: cert.Status,
 		ExpiresAt: cert.ExpiresAt.Format(time.RFC3339), Issuer: cert.Issuer,
-	}, nil
+		Source: cert.Source, AutoRenew: cert.AutoRenew, RenewalError: cert.RenewalError,
+	}
+	if cert.LastRenewalAt != nil {
+		info.LastRenewalAt = cert.LastRenewalAt.Format(time.RFC3339)
+	}
+	return info
 }
 
 func (s *nginxService) UpdateUpstreams(ctx context.Context, id string, req dto.UpdateUpstreamsRequest) error {
+	for _, backend := range req.Backends {
+		if err := validateNginxValue("backend address", backend.Address); err != nil {
+			return err
+		}
+	}
 	instance, err := s.nginxRepo.FindByInfrastructureID(id)
 	if err != nil {
 		return err
 	}
+	state, err := s.loadConfigState(instance)
+	if err != nil {
+		return err
+	}
+
 	upstream := &entities.NginxUpstream{
 		ID: uuid.New().String(), NginxID: instance.ID, Name: "backend", Policy: req.Policy,
 	}
+	for _, backend := range req.Backends {
+		upstream.Backends = append(upstream.Backends, entities.NginxUpstreamBackend{
+			ID: uuid.New().String(), Address: backend.Address, Weight: backend.Weight, DockerServiceID: backend.DockerServiceID,
+		})
+	}
+	upstreams := state.upstreams[:0]
+	for _, u := range state.upstreams {
+		if u.Name != upstream.Name {
+			upstreams = append(upstreams, u)
+		}
+	}
+	state.upstreams = append(upstreams, *upstream)
+	if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: "upstreams_updated"}); err != nil {
+		return err
+	}
+
+	backends := upstream.Backends
+	upstream.Backends = nil
 	if err := s.nginxRepo.CreateOrUpdateUpstream(upstream); err != nil {
 		return err
 	}
 	s.nginxRepo.DeleteUpstreamBackends(upstream.ID)
-	for _, backend := range req.Backends {
-		s.nginxRepo.CreateUpstreamBackend(&entities.NginxUpstreamBackend{
-			ID: uuid.New().String(), UpstreamID: upstream.ID, Address: backend.Address, Weight: backend.Weight,
-		})
+	for _, backend := range backends {
+		backend.UpstreamID = upstream.ID
+		s.nginxRepo.CreateUpstreamBackend(&backend)
 	}
 	return nil
 }
@@ -619,7 +839,7 @@ func (s *nginxService) GetUpstreams(ctx context.Context, id string) ([]dto.Upstr
 	for _, u := range upstreams {
 		backends := make([]dto.BackendServer, 0, len(u.Backends))
 		for _, b := range u.Backends {
-			backends = append(backends, dto.BackendServer{Address: b.Address, Weight: b.Weight})
+			backends = append(backends, dto.BackendServer{Address: b.Address, Weight: b.Weight, DockerServiceID: b.DockerServiceID})
 		}
 		result = append(result, dto.UpstreamInfo{Name: u.Name, Backends: backends, Policy: u.Policy})
 	}
@@ -633,19 +853,44 @@ func (s *nginxService) SetSecurityPolicy(ctx context.Context, id string, req dto
 	}
 	security := &entities.NginxSecurity{ID: uuid.New().String(), NginxID: instance.ID}
 	if req.RateLimit != nil {
+		if req.RateLimit.Path != "" {
+			if err := validateNginxValue("rate limit path", req.RateLimit.Path); err != nil {
+				return err
+			}
+		}
 		security.RateLimitRPS = req.RateLimit.RequestsPerSecond
 		security.RateLimitBurst = req.RateLimit.Burst
 		security.RateLimitPath = req.RateLimit.Path
 	}
 	if req.IPFilter != nil {
+		for _, ip := range append(append([]string{}, req.IPFilter.AllowIPs...), req.IPFilter.DenyIPs...) {
+			if err := validateNginxValue("ip", ip); err != nil {
+				return err
+			}
+		}
 		security.AllowIPs = strings.Join(req.IPFilter.AllowIPs, ",")
 		security.DenyIPs = strings.Join(req.IPFilter.DenyIPs, ",")
 	}
 	if req.BasicAuth != nil {
+		if err := validateNginxValue("basic auth username", req.BasicAuth.Username); err != nil {
+			return err
+		}
+		if strings.ContainsAny(req.BasicAuth.Username, ":") || strings.ContainsAny(req.BasicAuth.Realm, "\"\\\r\n$") {
+			return fmt.Errorf("basic auth username or realm contains characters not allowed in nginx config")
+		}
 		security.BasicAuthUsername = req.BasicAuth.Username
 		security.BasicAuthPassword = req.BasicAuth.Password
 		security.BasicAuthRealm = req.BasicAuth.Realm
 	}
+
+	state, err := s.loadConfigState(instance)
+	if err != nil {
+		return err
+	}
+	state.security = security
+	if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: "security_updated"}); err != nil {
+		return err
+	}
 	return s.nginxRepo.CreateOrUpdateSecurity(security)
 }
 
@@ -671,7 +916,7 @@ func (s *nginxService) GetSecurityPolicy(ctx context.Context, id string) (*dto.S
 	}
 	if security.BasicAuthUsername != "" {
 		policy.BasicAuth = &dto.BasicAuthConfig{
-			Username: security.BasicAuthUsername, Password: security.BasicAuthPassword, Realm: security.BasicAuthRealm,
+			Username: security.BasicAuthUsername, Password: revealSecret(ctx, security.BasicAuthPassword), Realm: security.BasicAuthRealm,
 		}
 	}
 	return policy, nil
@@ -682,6 +927,14 @@ func (s *nginxService) DeleteSecurityPolicy(ctx context.Context, id string) erro
 	if err != nil {
 		return err
 	}
+	state, err := s.loadConfigState(instance)
+	if err != nil {
+		return err
+	}
+	state.security = nil
+	if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: "security_deleted"}); err != nil {
+		return err
+	}
 	return s.nginxRepo.DeleteSecurity(instance.ID)
 }
 
@@ -700,10 +953,6 @@ func (s *nginxService) GetLogs(ctx context.Context, id string, tail int) (*dto.N
 	return &dto.NginxLogsResponse{InstanceID: id, Logs: logLines, Tail: tail}, nil
 }
 
-func (s *nginxService) GetMetrics(ctx context.Context, id string) (*dto.NginxMetricsResponse, error) {
-	return &dto.NginxMetricsResponse{InstanceID: id}, nil
-}
-
 func (s *nginxService) GetStats(ctx context.Context, id string) (*dto.NginxStatsResponse, error) {
 	instance, err := s.nginxRepo.FindByInfrastructureID(id)
 	if err != nil {
@@ -713,10 +962,115 @@ func (s *nginxService) GetStats(ctx context.Context, id string) (*dto.NginxStats
 	upstreamHealth := make([]dto.UpstreamHealth, 0)
 	for _, u := range upstreams {
 		for _, b := range u.Backends {
-			upstreamHealth = append(upstreamHealth, dto.UpstreamHealth{
-				Name: u.Name, Address: b.Address, Healthy: true,
-			})
+			upstreamHealth = append(upstreamHealth, toUpstreamHealth(u.Name, b.Address, b.IsDown, b.LastCheckedAt, b.LatencyMs, b.LastError))
 		}
 	}
 	return &dto.NginxStatsResponse{InstanceID: id, UpstreamHealth: upstreamHealth}, nil
 }
+
+func (s *nginxService) ListConfigRevisions(ctx context.Context, id string) ([]dto.NginxConfigRevisionInfo, error) {
+	instance, err := s.nginxRepo.FindByInfrastructureID(id)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := s.revisionRepo.List(entities.NginxRevisionInstance, instance.ID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]dto.NginxConfigRevisionInfo, 0, len(revisions))
+	for i := range revisions {
+		result = append(result, toConfigRevisionInfo(&revisions[i], false))
+	}
+	return result, nil
+}
+
+func (s *nginxService) GetConfigRevision(ctx context.Context, id string, revision int) (*dto.NginxConfigRevisionInfo, error) {
+	instance, err := s.nginxRepo.FindByInfrastructureID(id)
+	if err != nil {
+		return nil, err
+	}
+	rev, err := s.revisionRepo.Find(entities.NginxRevisionInstance, instance.ID, revision)
+	if err != nil {
+		return nil, fmt.Errorf("revision %d not found: %w", revision, err)
+	}
+	info := toConfigRevisionInfo(rev, true)
+	return &info, nil
+}
+
+// DiffConfigRevisions diffs two revisions; from defaults to the revision before to
+func (s *nginxService) DiffConfigRevisions(ctx context.Context, id string, from, to int) (*dto.NginxConfigDiffResponse, error) {
+	instance, err := s.nginxRepo.FindByInfrastructureID(id)
+	if err != nil {
+		return nil, err
+	}
+	if from == 0 {
+		from = to - 1
+	}
+	fromRev, err := s.revisionRepo.Find(entities.NginxRevisionInstance, instance.ID, from)
+	if err != nil {
+		return nil, fmt.Errorf("revision %d not found: %w", from, err)
+	}
+	toRev, err := s.revisionRepo.Find(entities.NginxRevisionInstance, instance.ID, to)
+	if err != nil {
+		return nil, fmt.Errorf("revision %d not found: %w", to, err)
+	}
+	return &dto.NginxConfigDiffResponse{
+		FromRevision: from,
+		ToRevision:   to,
+		Diff:         diffConfig(fmt.Sprintf("revision %d", from), fmt.Sprintf("revision %d", to), fromRev.Config, toRev.Config),
+	}, nil
+}
+
+// RollbackConfig restores the domains, routes, upstreams, certificate, security policy
+// and custom directives of an earlier revision and applies them as a new revision
+func (s *nginxService) RollbackConfig(ctx context.Context, id string, revision int) (*dto.NginxConfigRevisionInfo, error) {
+	instance, err := s.nginxRepo.FindByInfrastructureID(id)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.revisionRepo.Find(entities.NginxRevisionInstance, instance.ID, revision)
+	if err != nil {
+		return nil, fmt.Errorf("revision %d not found: %w", revision, err)
+	}
+	if err := restorableRevision(target); err != nil {
+		return nil, err
+	}
+	state, err := stateFromSnapshot(instance, target.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if instance.WAFEnabled && !state.wafFromSnapshot {
+		// Revisions from before the WAF keep its current setup
+		if state.wafExclusions, err = s.wafRepo.ListExclusions(entities.NginxRevisionInstance, instance.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: nginxActionRollback, rollbackOf: revision}); err != nil {
+		s.logger.Error("failed to roll back nginx config", zap.String("instance_id", id), zap.Int("revision", revision), zap.Error(err))
+		return nil, err
+	}
+	if err := s.nginxRepo.ReplaceConfigState(state.instance, state.domains, state.routes, state.upstreams, state.certificate, state.security); err != nil {
+		return nil, err
+	}
+	if state.wafFromSnapshot {
+		if err := s.wafRepo.ReplaceExclusions(entities.NginxRevisionInstance, instance.ID, state.wafExclusions); err != nil {
+			return nil, err
+		}
+	}
+
+	s.kafkaProducer.PublishEvent(ctx, kafka.InfrastructureEvent{
+		InstanceID: id,
+		UserID:     instance.Infrastructure.UserID,
+		Type:       "nginx",
+		Action:     "config_rolled_back",
+		Metadata:   map[string]interface{}{"revision": revision},
+	})
+
+	latest, err := s.revisionRepo.FindLatest(entities.NginxRevisionInstance, instance.ID)
+	if err != nil {
+		return nil, err
+	}
+	info := toConfigRevisionInfo(latest, true)
+	return &info, nil
+}
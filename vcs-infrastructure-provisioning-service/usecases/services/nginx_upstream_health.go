@@ -0,0 +1,504 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"go.uber.org/zap"
+)
+
+const (
+	upstreamHealthCheckInterval = 10 * time.Second
+	upstreamProbeTimeoutSeconds = 3
+	upstreamProbeMarker         = "IAAS_UPSTREAM_PROBE"
+	upstreamFallThreshold       = 2 // consecutive failed probes before a backend is taken out
+	upstreamRiseThreshold       = 2 // consecutive passed probes before it is put back
+	upstreamLastErrorMaxLen     = 500
+	nginxActionUpstreamHealth   = "upstream_health"
+	upstreamDownPrefix          = "# iaas-down: "
+	upstreamPlaceholder         = "server 127.0.0.1:1 down; # iaas: every server failed health checks"
+)
+
+var (
+	upstreamAddressPattern = regexp.MustCompile(`^[A-Za-z0-9._\[\]:-]+$`)
+	upstreamPathPattern    = regexp.MustCompile(`^/[A-Za-z0-9._~/?=&%+-]*$`)
+	wgetHTTPStatusPattern  = regexp.MustCompile(`server returned error: HTTP/[0-9.]+ ([0-9]{3})`)
+)
+
+// upstreamProbeTarget is one backend address to request, with the path to request
+type upstreamProbeTarget struct {
+	address string
+	path    string
+}
+
+// upstreamProbeResult is the outcome of one probe
+type upstreamProbeResult struct {
+	healthy   bool
+	latencyMs int64
+	err       string
+}
+
+// upstreamProbeCommand builds one script that requests every target from inside an nginx
+// container, so addresses resolve exactly as they do for nginx itself. Each target prints
+// a line "<marker> <index> <exit code> <milliseconds> <wget output>".
+func upstreamProbeCommand(targets []upstreamProbeTarget) []string {
+	var script strings.Builder
+	// Latency reads as 0 where date has no nanosecond support
+	script.WriteString("now() { t=$(date +%s%N 2>/dev/null); case \"$t\" in ''|*[!0-9]*) echo 0 ;; *) echo \"$t\" ;; esac; }\n")
+	for i, target := range targets {
+		fmt.Fprintf(&script,
+			"s=$(now); out=$(wget -q -T %d -O /dev/null 'http://%s%s' 2>&1); rc=$?; e=$(now); "+
+				"echo \"%s %d $rc $(( (e - s) / 1000000 )) $(echo \"$out\" | tr '\\n' ' ')\"\n",
+			upstreamProbeTimeoutSeconds, target.address, target.path, upstreamProbeMarker, i)
+	}
+	return []string{"sh", "-c", script.String()}
+}
+
+// validUpstreamProbeTarget reports whether a target is safe to embed in the probe script
+func validUpstreamProbeTarget(target upstreamProbeTarget) error {
+	if !upstreamAddressPattern.MatchString(target.address) {
+		return fmt.Errorf("address %q cannot be probed", target.address)
+	}
+	if !upstreamPathPattern.MatchString(target.path) {
+		return fmt.Errorf("health path %q cannot be probed", target.path)
+	}
+	return nil
+}
+
+// parseUpstreamProbeOutput maps probe lines back to target indexes. With lenient set any
+// HTTP answer below 500 counts as healthy, for backends without a dedicated health path.
+func parseUpstreamProbeOutput(output string, lenient bool) map[int]upstreamProbeResult {
+	results := make(map[int]upstreamProbeResult)
+	for _, line := range strings.Split(output, "\n") {
+		idx := strings.Index(line, upstreamProbeMarker+" ")
+		if idx < 0 {
+			continue
+		}
+		fields := strings.SplitN(strings.TrimSpace(line[idx+len(upstreamProbeMarker)+1:]), " ", 4)
+		if len(fields) < 3 {
+			continue
+		}
+		index, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		latency, _ := strconv.ParseInt(fields[2], 10, 64)
+		message := ""
+		if len(fields) == 4 {
+			message = strings.TrimSpace(fields[3])
+		}
+
+		result := upstreamProbeResult{healthy: fields[1] == "0", latencyMs: latency}
+		if !result.healthy {
+			if match := wgetHTTPStatusPattern.FindStringSubmatch(message); lenient && match != nil {
+				code, _ := strconv.Atoi(match[1])
+				result.healthy = code < 500
+			}
+			if !result.healthy {
+				result.err = message
+				if result.err == "" {
+					result.err = "probe exited with code " + fields[1]
+				}
+				if len(result.err) > upstreamLastErrorMaxLen {
+					result.err = result.err[:upstreamLastErrorMaxLen]
+				}
+			}
+		}
+		results[index] = result
+	}
+	return results
+}
+
+// upstreamHealthTracker debounces probe results so a single blip does not reload nginx
+type upstreamHealthTracker struct {
+	mu     sync.Mutex
+	streak map[string]int // backend ID -> consecutive probes disagreeing with its state
+}
+
+func newUpstreamHealthTracker() *upstreamHealthTracker {
+	return &upstreamHealthTracker{streak: make(map[string]int)}
+}
+
+// observe returns whether the backend should be down after this probe
+func (t *upstreamHealthTracker) observe(id string, isDown, healthy bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if isDown == !healthy {
+		delete(t.streak, id)
+		return isDown
+	}
+	t.streak[id]++
+	threshold := upstreamFallThreshold
+	if isDown {
+		threshold = upstreamRiseThreshold
+	}
+	if t.streak[id] < threshold {
+		return isDown
+	}
+	delete(t.streak, id)
+	return !isDown
+}
+
+// setUpstreamServersDown comments out the server lines of unhealthy servers in the given
+// upstream blocks of a cluster config and restores the lines of recovered ones. nginx resolves
+// every server at load time, even ones flagged down, so a failed container's name would fail
+// the whole config; excluded lines are commented out instead. A block left with no servers
+// gets a placeholder so it stays valid and answers 502. down maps upstream name -> address ->
+// down; other upstreams and addresses are left untouched.
+func setUpstreamServersDown(config string, down map[string]map[string]bool) string {
+	lines := strings.Split(config, "\n")
+	out := make([]string, 0, len(lines)+1)
+	var current map[string]bool
+	active := 0
+	indent := ""
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		lead := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+
+		if current == nil {
+			if strings.HasPrefix(trimmed, "upstream ") && strings.HasSuffix(trimmed, "{") {
+				name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(trimmed, "upstream "), "{"))
+				current = down[name]
+				active = 0
+				indent = lead + "    "
+			}
+			out = append(out, line)
+			continue
+		}
+
+		switch {
+		case trimmed == "}":
+			if active == 0 {
+				out = append(out, indent+upstreamPlaceholder)
+			}
+			current = nil
+			out = append(out, line)
+			continue
+		case trimmed == upstreamPlaceholder:
+			// Added back when the block is closed if it is still needed
+			continue
+		}
+
+		body := trimmed
+		disabled := strings.HasPrefix(body, upstreamDownPrefix)
+		body = strings.TrimPrefix(body, upstreamDownPrefix)
+		if !strings.HasPrefix(body, "server ") {
+			out = append(out, line)
+			continue
+		}
+		if fields := strings.Fields(strings.TrimSuffix(body, ";")); len(fields) >= 2 {
+			if isDown, ok := current[fields[1]]; ok {
+				disabled = isDown
+			}
+		}
+		if disabled {
+			out = append(out, lead+upstreamDownPrefix+body)
+			continue
+		}
+		active++
+		out = append(out, lead+body)
+	}
+	return strings.Join(out, "\n")
+}
+
+// runUpstreamProbes probes targets from inside containerID and returns one result per target
+func runUpstreamProbes(ctx context.Context, dockerSvc docker.IDockerService, containerID string, targets []upstreamProbeTarget, lenient bool) []upstreamProbeResult {
+	results := make([]upstreamProbeResult, len(targets))
+	valid := make([]upstreamProbeTarget, 0, len(targets))
+	index := make([]int, 0, len(targets))
+	for i, target := range targets {
+		if err := validUpstreamProbeTarget(target); err != nil {
+			results[i] = upstreamProbeResult{err: err.Error()}
+			continue
+		}
+		valid = append(valid, target)
+		index = append(index, i)
+	}
+	if len(valid) == 0 {
+		return results
+	}
+
+	output, err := dockerSvc.ExecCommand(ctx, containerID, upstreamProbeCommand(valid))
+	parsed := parseUpstreamProbeOutput(output, lenient)
+	for j, i := range index {
+		result, ok := parsed[j]
+		if !ok {
+			result = upstreamProbeResult{err: "no probe result"}
+			if err != nil {
+				result.err = "probe failed: " + err.Error()
+			}
+		}
+		results[i] = result
+	}
+	return results
+}
+
+// StartUpstreamHealthMonitor probes the backends of every running instance until ctx is cancelled
+func (s *nginxService) StartUpstreamHealthMonitor(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(upstreamHealthCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			s.checkUpstreamHealth(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *nginxService) checkUpstreamHealth(ctx context.Context) {
+	instances, err := s.nginxRepo.ListWithUpstreams()
+	if err != nil {
+		s.logger.Error("failed to list nginx instances for upstream health check", zap.Error(err))
+		return
+	}
+	for i := range instances {
+		instance := &instances[i]
+		if instance.ContainerID == "" || instance.Infrastructure.Status != entities.StatusRunning {
+			continue
+		}
+		if err := s.checkInstanceUpstreams(ctx, instance); err != nil {
+			s.logger.Error("upstream health check failed", zap.String("instance_id", instance.ID), zap.Error(err))
+		}
+	}
+}
+
+// checkInstanceUpstreams probes every backend, stores the result and re-renders the config
+// when a backend is taken out or put back
+func (s *nginxService) checkInstanceUpstreams(ctx context.Context, instance *entities.NginxInstance) error {
+	upstreams, err := s.nginxRepo.ListUpstreams(instance.ID)
+	if err != nil {
+		return err
+	}
+
+	var targets []upstreamProbeTarget
+	var backends []*entities.NginxUpstreamBackend
+	for i := range upstreams {
+		for j := range upstreams[i].Backends {
+			backend := &upstreams[i].Backends[j]
+			// Instance backends have no health path; any answer from / shows the backend is serving
+			targets = append(targets, upstreamProbeTarget{address: backend.Address, path: "/"})
+			backends = append(backends, backend)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	results := runUpstreamProbes(ctx, s.dockerSvc, instance.ContainerID, targets, true)
+	now := time.Now()
+	changed := false
+	for i, backend := range backends {
+		result := results[i]
+		backend.LastCheckedAt = &now
+		backend.LatencyMs = result.latencyMs
+		backend.LastError = result.err
+
+		down := s.upstreamHealth.observe(backend.ID, backend.IsDown, result.healthy)
+		if down != backend.IsDown {
+			changed = true
+			s.logger.Warn("nginx upstream backend health changed",
+				zap.String("instance_id", instance.ID), zap.String("address", backend.Address), zap.Bool("down", down))
+		}
+		backend.IsDown = down
+		if err := s.nginxRepo.UpdateUpstreamBackend(backend); err != nil {
+			s.logger.Error("failed to save backend health", zap.String("backend_id", backend.ID), zap.Error(err))
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	state, err := s.loadConfigState(instance)
+	if err != nil {
+		return err
+	}
+	return s.applyNginxConfig(ctx, state, nginxConfigChange{action: nginxActionUpstreamHealth})
+}
+
+// checkClusterUpstreams probes the servers of every cluster upstream from prober and flips
+// the down flag on their lines in the cluster config when a server is taken out or put back
+func (s *nginxClusterService) checkClusterUpstreams(ctx context.Context, cluster *entities.NginxCluster, prober *entities.NginxNode) {
+	upstreams, err := s.clusterRepo.ListUpstreams(cluster.ID)
+	if err != nil {
+		s.logger.Error("failed to list cluster upstreams", zap.String("cluster_id", cluster.ID), zap.Error(err))
+		return
+	}
+
+	down := make(map[string]map[string]bool)
+	changed := false
+	now := time.Now()
+	for _, upstream := range upstreams {
+		servers, err := s.clusterRepo.ListUpstreamServers(upstream.ID)
+		if err != nil || len(servers) == 0 {
+			continue
+		}
+		down[upstream.Name] = make(map[string]bool)
+
+		var results []upstreamProbeResult
+		if upstream.HealthCheck {
+			path := upstream.HealthPath
+			if path == "" {
+				path = "/health"
+			}
+			targets := make([]upstreamProbeTarget, 0, len(servers))
+			for _, server := range servers {
+				targets = append(targets, upstreamProbeTarget{address: server.Address, path: path})
+			}
+			results = runUpstreamProbes(ctx, s.dockerSvc, prober.ContainerID, targets, false)
+		}
+
+		for i := range servers {
+			server := &servers[i]
+			isDown := false
+			if results != nil {
+				server.LastCheckedAt = &now
+				server.LatencyMs = results[i].latencyMs
+				server.LastError = results[i].err
+				isDown = s.upstreamHealth.observe(server.ID, server.IsDown, results[i].healthy)
+			}
+			// With health checks off every server is put back
+			if isDown != server.IsDown {
+				changed = true
+				s.logger.Warn("nginx cluster upstream server health changed",
+					zap.String("cluster_id", cluster.ID), zap.String("upstream", upstream.Name),
+					zap.String("address", server.Address), zap.Bool("down", isDown))
+			}
+			server.IsDown = isDown
+			down[upstream.Name][server.Address] = isDown
+			if err := s.clusterRepo.UpdateUpstreamServer(server); err != nil {
+				s.logger.Error("failed to save upstream server health", zap.String("server_id", server.ID), zap.Error(err))
+			}
+		}
+	}
+	if !changed {
+		return
+	}
+
+	config := setUpstreamServersDown(cluster.NginxConfig, down)
+	if config == cluster.NginxConfig {
+		return
+	}
+	cluster.NginxConfig = config
+	if err := s.applyClusterConfig(ctx, cluster, nginxConfigChange{action: nginxActionUpstreamHealth}); err != nil {
+		s.logger.Error("failed to apply cluster config after upstream health change", zap.String("cluster_id", cluster.ID), zap.Error(err))
+	}
+}
+
+// renderClusterUpstreams renders the upstream blocks stored for a cluster, leaving out
+// servers that health checks have taken down
+func (s *nginxClusterService) renderClusterUpstreams(clusterID string) string {
+	upstreams, err := s.clusterRepo.ListUpstreams(clusterID)
+	if err != nil || len(upstreams) == 0 {
+		return ""
+	}
+	servers := make(map[string][]entities.NginxUpstreamServer, len(upstreams))
+	for _, upstream := range upstreams {
+		servers[upstream.ID], _ = s.clusterRepo.ListUpstreamServers(upstream.ID)
+	}
+	return renderClusterUpstreams(upstreams, servers)
+}
+
+func renderClusterUpstreams(upstreams []entities.NginxClusterUpstream, servers map[string][]entities.NginxUpstreamServer) string {
+	var b strings.Builder
+	down := make(map[string]map[string]bool)
+	for _, upstream := range upstreams {
+		if validateNginxValue("upstream name", upstream.Name) != nil || len(servers[upstream.ID]) == 0 {
+			continue
+		}
+		var lines []string
+		for _, server := range servers[upstream.ID] {
+			if validateNginxValue("server address", server.Address) != nil {
+				continue
+			}
+			line := "server " + server.Address
+			if server.Weight > 1 {
+				line += fmt.Sprintf(" weight=%d", server.Weight)
+			}
+			if server.MaxFails > 0 {
+				line += fmt.Sprintf(" max_fails=%d", server.MaxFails)
+			}
+			if server.FailTimeout > 0 {
+				line += fmt.Sprintf(" fail_timeout=%ds", server.FailTimeout)
+			}
+			// nginx does not allow backup servers with ip_hash
+			if server.IsBackup && upstream.Algorithm != "ip_hash" {
+				line += " backup"
+			}
+			lines = append(lines, line+";")
+			if down[upstream.Name] == nil {
+				down[upstream.Name] = make(map[string]bool)
+			}
+			down[upstream.Name][server.Address] = server.IsDown
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "    upstream %s {\n", upstream.Name)
+		switch upstream.Algorithm {
+		case "least_conn":
+			b.WriteString("        least_conn;\n")
+		case "ip_hash":
+			b.WriteString("        ip_hash;\n")
+		}
+		for _, line := range lines {
+			fmt.Fprintf(&b, "        %s\n", line)
+		}
+		b.WriteString("    }\n\n")
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "    # Upstreams\n" + setUpstreamServersDown(b.String(), down)
+}
+
+// upstreamHealthInfo reports the last health check of every cluster upstream server
+func (s *nginxClusterService) upstreamHealthInfo(clusterID string) []dto.UpstreamHealthInfo {
+	upstreams, err := s.clusterRepo.ListUpstreams(clusterID)
+	if err != nil {
+		return nil
+	}
+	result := make([]dto.UpstreamHealthInfo, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		servers, _ := s.clusterRepo.ListUpstreamServers(upstream.ID)
+		info := dto.UpstreamHealthInfo{Name: upstream.Name, TotalServers: len(servers)}
+		for _, server := range servers {
+			if server.IsDown {
+				info.UnhealthyList = append(info.UnhealthyList, server.Address)
+			} else {
+				info.HealthyServers++
+			}
+			info.Servers = append(info.Servers, toUpstreamHealth(upstream.Name, server.Address, server.IsDown, server.LastCheckedAt, server.LatencyMs, server.LastError))
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+func toUpstreamHealth(name, address string, isDown bool, lastChecked *time.Time, latencyMs int64, lastError string) dto.UpstreamHealth {
+	health := dto.UpstreamHealth{
+		Name:      name,
+		Address:   address,
+		Healthy:   !isDown,
+		LatencyMs: latencyMs,
+		LastError: lastError,
+	}
+	if lastChecked != nil {
+		health.LastChecked = lastChecked.Format(time.RFC3339)
+	}
+	return health
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUpstreamProbeOutput(t *testing.T) {
+	output := strings.Join([]string{
+		upstreamProbeMarker + " 0 0 12 ",
+		upstreamProbeMarker + " 1 1 3001 wget: download timed out",
+		upstreamProbeMarker + " 2 1 4 wget: server returned error: HTTP/1.1 404 Not Found",
+		upstreamProbeMarker + " 3 1 5 wget: server returned error: HTTP/1.1 503 Service Unavailable",
+		"unrelated output",
+	}, "\n")
+
+	strict := parseUpstreamProbeOutput(output, false)
+	assert.Len(t, strict, 4)
+	assert.Equal(t, upstreamProbeResult{healthy: true, latencyMs: 12}, strict[0])
+	assert.False(t, strict[1].healthy)
+	assert.Equal(t, int64(3001), strict[1].latencyMs)
+	assert.Equal(t, "wget: download timed out", strict[1].err)
+	assert.False(t, strict[2].healthy)
+
+	lenient := parseUpstreamProbeOutput(output, true)
+	assert.True(t, lenient[2].healthy)
+	assert.Empty(t, lenient[2].err)
+	assert.False(t, lenient[3].healthy)
+	assert.Contains(t, lenient[3].err, "503")
+}
+
+func TestUpstreamProbeCommandRejectsUnsafeTargets(t *testing.T) {
+	assert.NoError(t, validUpstreamProbeTarget(upstreamProbeTarget{address: "app-1:8080", path: "/health?full=1"}))
+	assert.NoError(t, validUpstreamProbeTarget(upstreamProbeTarget{address: "[fd00::1]:80", path: "/"}))
+	assert.Error(t, validUpstreamProbeTarget(upstreamProbeTarget{address: "app'; reboot", path: "/"}))
+	assert.Error(t, validUpstreamProbeTarget(upstreamProbeTarget{address: "app:80", path: "/x' -O /etc/passwd"}))
+
+	cmd := upstreamProbeCommand([]upstreamProbeTarget{{address: "app-1:8080", path: "/health"}})
+	assert.Contains(t, cmd[2], "'http://app-1:8080/health'")
+	assert.Contains(t, cmd[2], upstreamProbeMarker+" 0 $rc")
+}
+
+func TestUpstreamHealthTracker(t *testing.T) {
+	tracker := newUpstreamHealthTracker()
+
+	// One failure is not enough to take a backend out
+	assert.False(t, tracker.observe("b1", false, false))
+	assert.False(t, tracker.observe("b1", false, true))
+	assert.False(t, tracker.observe("b1", false, false))
+	assert.True(t, tracker.observe("b1", false, false))
+
+	// And one success is not enough to put it back
+	assert.True(t, tracker.observe("b1", true, true))
+	assert.True(t, tracker.observe("b1", true, false))
+	assert.True(t, tracker.observe("b1", true, true))
+	assert.False(t, tracker.observe("b1", true, true))
+}
+
+func TestSetUpstreamServersDown(t *testing.T) {
+	config := `http {
+    upstream api {
+        least_conn;
+        server 10.0.0.1:80 weight=2;
+        server 10.0.0.2:80;
+    }
+
+    upstream other {
+        server 10.0.0.1:80;
+    }
+}`
+
+	down := setUpstreamServersDown(config, map[string]map[string]bool{"api": {"10.0.0.1:80": true, "10.0.0.2:80": false}})
+	assert.Contains(t, down, "        "+upstreamDownPrefix+"server 10.0.0.1:80 weight=2;\n        server 10.0.0.2:80;")
+	assert.Contains(t, down, "upstream other {\n        server 10.0.0.1:80;")
+	assert.NotContains(t, down, upstreamPlaceholder)
+
+	allDown := setUpstreamServersDown(down, map[string]map[string]bool{"api": {"10.0.0.1:80": true, "10.0.0.2:80": true}})
+	assert.Contains(t, allDown, "        "+upstreamDownPrefix+"server 10.0.0.2:80;\n        "+upstreamPlaceholder+"\n    }")
+
+	restored := setUpstreamServersDown(allDown, map[string]map[string]bool{"api": {"10.0.0.1:80": false, "10.0.0.2:80": false}})
+	assert.Equal(t, config, restored)
+}
+
+func TestRenderClusterUpstreams(t *testing.T) {
+	upstreams := []entities.NginxClusterUpstream{
+		{ID: "u1", Name: "api", Algorithm: "least_conn"},
+		{ID: "u2", Name: "empty"},
+	}
+	servers := map[string][]entities.NginxUpstreamServer{
+		"u1": {
+			{Address: "app-1:8080", Weight: 2, MaxFails: 3, FailTimeout: 30},
+			{Address: "app-2:8080", Weight: 1, IsBackup: true, IsDown: true},
+		},
+	}
+
+	conf := renderClusterUpstreams(upstreams, servers)
+	assert.Contains(t, conf, "    upstream api {\n        least_conn;\n        server app-1:8080 weight=2 max_fails=3 fail_timeout=30s;\n")
+	assert.Contains(t, conf, "        "+upstreamDownPrefix+"server app-2:8080 backup;\n")
+	assert.NotContains(t, conf, "upstream empty")
+}
@@ -0,0 +1,530 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/kafka"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// The ModSecurity image ships the OWASP Core Rule Set behind setup.conf and runs nginx
+// unprivileged on 8080 unless told otherwise
+const (
+	nginxWAFImage      = "owasp/modsecurity-crs:nginx-alpine"
+	nginxWAFModule     = "modules/ngx_http_modsecurity_module.so"
+	nginxWAFRulesFile  = "/etc/modsecurity.d/setup.conf"
+	nginxWAFUser       = "root"
+	nginxWAFBeginLine  = "# BEGIN iaas-waf"
+	nginxWAFEndLine    = "# END iaas-waf"
+	nginxWAFBlocked    = "waf.blocked"
+	nginxWAFDetected   = "waf.detected"
+	nginxWAFModeAction = "waf_mode_changed"
+
+	// Path scoped exclusions need a rule of their own; ids start in the range ModSecurity
+	// leaves for local rules, well below the 9xxxxx ids of the CRS
+	nginxWAFExclusionRuleBase = 10000
+)
+
+var nginxWAFEnv = []string{
+	"PORT=80",
+	"SSL_PORT=443",
+	"MODSEC_AUDIT_LOG=/dev/stdout",
+	"MODSEC_AUDIT_LOG_FORMAT=JSON",
+}
+
+var wafTargetPattern = regexp.MustCompile(`^[A-Z_]+(:[A-Za-z0-9_.-]+)?$`)
+
+func validWAFMode(mode string) bool {
+	switch mode {
+	case entities.NginxWAFOff, entities.NginxWAFDetectionOnly, entities.NginxWAFBlocking:
+		return true
+	}
+	return false
+}
+
+// validateWAFExclusion rejects exclusions that could break out of the inline rules
+func validateWAFExclusion(exclusion *entities.NginxWAFExclusion) error {
+	if exclusion.RuleID < 1 {
+		return fmt.Errorf("rule id must be positive")
+	}
+	if exclusion.Target != "" && !wafTargetPattern.MatchString(exclusion.Target) {
+		return fmt.Errorf("target %q must be a ModSecurity variable such as ARGS:password", exclusion.Target)
+	}
+	if exclusion.PathPrefix != "" {
+		if !strings.HasPrefix(exclusion.PathPrefix, "/") {
+			return fmt.Errorf("path prefix %q must start with /", exclusion.PathPrefix)
+		}
+		if err := validateNginxValue("path prefix", exclusion.PathPrefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wafExclusionRule renders one exclusion as a ModSecurity directive; id is used by
+// path scoped exclusions, which remove the rule at runtime
+func wafExclusionRule(exclusion entities.NginxWAFExclusion, id int) string {
+	if exclusion.PathPrefix == "" {
+		if exclusion.Target == "" {
+			return fmt.Sprintf("SecRuleRemoveById %d", exclusion.RuleID)
+		}
+		return fmt.Sprintf(`SecRuleUpdateTargetById %d "!%s"`, exclusion.RuleID, exclusion.Target)
+	}
+	ctl := fmt.Sprintf("ctl:ruleRemoveById=%d", exclusion.RuleID)
+	if exclusion.Target != "" {
+		ctl = fmt.Sprintf("ctl:ruleRemoveTargetById=%d;%s", exclusion.RuleID, exclusion.Target)
+	}
+	return fmt.Sprintf(`SecRule REQUEST_FILENAME "@beginsWith %s" "id:%d,phase:1,pass,nolog,%s"`, exclusion.PathPrefix, id, ctl)
+}
+
+// renderWAFDirectives returns the server level ModSecurity directives for mode. Audit
+// records go to stdout as JSON, where the access log collector picks them up.
+func renderWAFDirectives(mode string, exclusions []entities.NginxWAFExclusion, indent string) string {
+	var b strings.Builder
+	if mode != entities.NginxWAFDetectionOnly && mode != entities.NginxWAFBlocking {
+		fmt.Fprintf(&b, "%smodsecurity off;\n", indent)
+		return b.String()
+	}
+	engine := "On"
+	if mode == entities.NginxWAFDetectionOnly {
+		engine = "DetectionOnly"
+	}
+	rules := []string{
+		"SecRuleEngine " + engine,
+		"SecAuditEngine RelevantOnly",
+		"SecAuditLogParts ABFHZ",
+		"SecAuditLogFormat JSON",
+		"SecAuditLogType Serial",
+		"SecAuditLog /dev/stdout",
+	}
+	for i, exclusion := range exclusions {
+		rules = append(rules, wafExclusionRule(exclusion, nginxWAFExclusionRuleBase+i))
+	}
+
+	fmt.Fprintf(&b, "%smodsecurity on;\n", indent)
+	fmt.Fprintf(&b, "%smodsecurity_rules_file %s;\n", indent, nginxWAFRulesFile)
+	fmt.Fprintf(&b, "%smodsecurity_rules '\n", indent)
+	for _, rule := range rules {
+		fmt.Fprintf(&b, "%s    %s\n", indent, rule)
+	}
+	fmt.Fprintf(&b, "%s';\n", indent)
+	return b.String()
+}
+
+// clusterWAFBlock wraps the directives in marker lines so a cluster config can be updated in place
+func clusterWAFBlock(mode string, exclusions []entities.NginxWAFExclusion) string {
+	const indent = "        "
+	return indent + nginxWAFBeginLine + " (managed through the WAF API)\n" +
+		renderWAFDirectives(mode, exclusions, indent) +
+		indent + nginxWAFEndLine + "\n"
+}
+
+// setClusterWAFBlock replaces the WAF block of a cluster config, or adds it to the
+// default server when the config has none
+func setClusterWAFBlock(config, block string) (string, error) {
+	lines := strings.SplitAfter(config, "\n")
+	begin, end := -1, -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if begin < 0 && strings.HasPrefix(trimmed, nginxWAFBeginLine) {
+			begin = i
+		} else if begin >= 0 && trimmed == nginxWAFEndLine {
+			end = i
+			break
+		}
+	}
+	if begin >= 0 && end >= 0 {
+		return strings.Join(lines[:begin], "") + block + strings.Join(lines[end+1:], ""), nil
+	}
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "server_name _;" {
+			return strings.Join(lines[:i+1], "") + "\n" + block + strings.Join(lines[i+1:], ""), nil
+		}
+	}
+	return "", fmt.Errorf("cluster config has no WAF block or default server to add one to")
+}
+
+// clusterWAFMode reads the mode back from the WAF block of a cluster config
+func clusterWAFMode(config string) string {
+	start := strings.Index(config, nginxWAFBeginLine)
+	if start < 0 {
+		return entities.NginxWAFOff
+	}
+	block := config[start:]
+	if end := strings.Index(block, nginxWAFEndLine); end >= 0 {
+		block = block[:end]
+	}
+	switch {
+	case strings.Contains(block, "SecRuleEngine DetectionOnly"):
+		return entities.NginxWAFDetectionOnly
+	case strings.Contains(block, "SecRuleEngine On"):
+		return entities.NginxWAFBlocking
+	}
+	return entities.NginxWAFOff
+}
+
+// wafAuditLine is the part of a ModSecurity JSON audit record the collector reads
+type wafAuditLine struct {
+	Transaction *struct {
+		ClientIP string `json:"client_ip"`
+		UniqueID string `json:"unique_id"`
+		Request  struct {
+			Method  string            `json:"method"`
+			URI     string            `json:"uri"`
+			Headers map[string]string `json:"headers"`
+		} `json:"request"`
+		Response struct {
+			HTTPCode int `json:"http_code"`
+		} `json:"response"`
+		Messages []struct {
+			Message string `json:"message"`
+			Details struct {
+				RuleID   string `json:"ruleId"`
+				Severity string `json:"severity"`
+			} `json:"details"`
+		} `json:"messages"`
+	} `json:"transaction"`
+}
+
+// wafEvent is a request the WAF matched, as published to the log pipeline
+type wafEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	Node      string    `json:"node,omitempty"`
+	UniqueID  string    `json:"unique_id,omitempty"`
+	ClientIP  string    `json:"client_ip"`
+	Method    string    `json:"method"`
+	URI       string    `json:"uri"`
+	Host      string    `json:"host,omitempty"`
+	Status    int       `json:"status"`
+	Blocked   bool      `json:"blocked"`
+	RuleIDs   []string  `json:"rule_ids"`
+	Messages  []string  `json:"messages"`
+}
+
+// parseWAFAuditLine parses the JSON body of a container log line written by ModSecurity.
+// Records without rule matches are ignored.
+func parseWAFAuditLine(body string, at time.Time) (wafEvent, bool) {
+	var parsed wafAuditLine
+	if err := json.Unmarshal([]byte(body), &parsed); err != nil || parsed.Transaction == nil {
+		return wafEvent{}, false
+	}
+	tx := parsed.Transaction
+	if len(tx.Messages) == 0 {
+		return wafEvent{}, false
+	}
+	event := wafEvent{
+		Timestamp: at,
+		UniqueID:  tx.UniqueID,
+		ClientIP:  tx.ClientIP,
+		Method:    tx.Request.Method,
+		URI:       tx.Request.URI,
+		Status:    tx.Response.HTTPCode,
+		Blocked:   tx.Response.HTTPCode == 403,
+	}
+	for name, value := range tx.Request.Headers {
+		if strings.EqualFold(name, "host") {
+			event.Host = value
+		}
+	}
+	for _, message := range tx.Messages {
+		event.RuleIDs = append(event.RuleIDs, message.Details.RuleID)
+		event.Messages = append(event.Messages, message.Message)
+	}
+	return event, true
+}
+
+// publishWAFEvents sends one event per matched request. Only blocking mode blocks, so a
+// 403 in detection-only mode came from the backend.
+func publishWAFEvents(ctx context.Context, producer kafka.IKafkaProducer, event kafka.InfrastructureEvent, mode string, events []wafEvent) {
+	for _, waf := range events {
+		waf.Blocked = waf.Blocked && mode == entities.NginxWAFBlocking
+		event.Action = nginxWAFDetected
+		if waf.Blocked {
+			event.Action = nginxWAFBlocked
+		}
+		event.Metadata = map[string]interface{}{
+			"timestamp": waf.Timestamp,
+			"unique_id": waf.UniqueID,
+			"client_ip": waf.ClientIP,
+			"method":    waf.Method,
+			"uri":       waf.URI,
+			"host":      waf.Host,
+			"status":    waf.Status,
+			"blocked":   waf.Blocked,
+			"rule_ids":  waf.RuleIDs,
+			"messages":  waf.Messages,
+			"mode":      mode,
+		}
+		if waf.Node != "" {
+			event.Metadata["node"] = waf.Node
+		}
+		producer.PublishEvent(ctx, event)
+	}
+}
+
+func toWAFPolicyInfo(enabled bool, mode string, exclusions []entities.NginxWAFExclusion) *dto.WAFPolicyInfo {
+	if mode == "" {
+		mode = entities.NginxWAFOff
+	}
+	info := &dto.WAFPolicyInfo{Enabled: enabled, Mode: mode, Exclusions: make([]dto.WAFExclusionInfo, 0, len(exclusions))}
+	for _, exclusion := range exclusions {
+		info.Exclusions = append(info.Exclusions, toWAFExclusionInfo(&exclusion))
+	}
+	return info
+}
+
+func toWAFExclusionInfo(exclusion *entities.NginxWAFExclusion) dto.WAFExclusionInfo {
+	return dto.WAFExclusionInfo{
+		ID:         exclusion.ID,
+		RuleID:     exclusion.RuleID,
+		Target:     exclusion.Target,
+		PathPrefix: exclusion.PathPrefix,
+		Comment:    exclusion.Comment,
+		CreatedAt:  exclusion.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func newWAFExclusion(resourceType, resourceID string, req dto.AddWAFExclusionRequest) (*entities.NginxWAFExclusion, error) {
+	exclusion := &entities.NginxWAFExclusion{
+		ID:           uuid.New().String(),
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		RuleID:       req.RuleID,
+		Target:       req.Target,
+		PathPrefix:   req.PathPrefix,
+		Comment:      req.Comment,
+		CreatedAt:    time.Now(),
+	}
+	if err := validateWAFExclusion(exclusion); err != nil {
+		return nil, err
+	}
+	return exclusion, nil
+}
+
+func withoutWAFExclusion(exclusions []entities.NginxWAFExclusion, id string) []entities.NginxWAFExclusion {
+	kept := make([]entities.NginxWAFExclusion, 0, len(exclusions))
+	for _, exclusion := range exclusions {
+		if exclusion.ID != id {
+			kept = append(kept, exclusion)
+		}
+	}
+	return kept
+}
+
+// ================== Instances ==================
+
+func (s *nginxService) findWAFInstance(id string) (*entities.NginxInstance, error) {
+	instance, err := s.nginxRepo.FindByInfrastructureID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !instance.WAFEnabled {
+		return nil, fmt.Errorf("nginx instance was not created with waf_enabled")
+	}
+	return instance, nil
+}
+
+func (s *nginxService) GetWAFPolicy(ctx context.Context, id string) (*dto.WAFPolicyInfo, error) {
+	instance, err := s.nginxRepo.FindByInfrastructureID(id)
+	if err != nil {
+		return nil, err
+	}
+	exclusions, err := s.wafRepo.ListExclusions(entities.NginxRevisionInstance, instance.ID)
+	if err != nil {
+		return nil, err
+	}
+	return toWAFPolicyInfo(instance.WAFEnabled, instance.WAFMode, exclusions), nil
+}
+
+func (s *nginxService) SetWAFMode(ctx context.Context, id string, req dto.SetWAFModeRequest) (*dto.WAFPolicyInfo, error) {
+	if !validWAFMode(req.Mode) {
+		return nil, fmt.Errorf("unknown waf mode %q", req.Mode)
+	}
+	instance, err := s.findWAFInstance(id)
+	if err != nil {
+		return nil, err
+	}
+	state, err := s.loadConfigState(instance)
+	if err != nil {
+		return nil, err
+	}
+	state.instance.WAFMode = req.Mode
+	if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: nginxWAFModeAction}); err != nil {
+		return nil, err
+	}
+	if err := s.nginxRepo.Update(instance); err != nil {
+		return nil, err
+	}
+
+	s.kafkaProducer.PublishEvent(ctx, kafka.InfrastructureEvent{
+		InstanceID: id,
+		UserID:     instance.Infrastructure.UserID,
+		Type:       "nginx",
+		Action:     nginxWAFModeAction,
+		Metadata:   map[string]interface{}{"mode": req.Mode},
+	})
+	return toWAFPolicyInfo(true, instance.WAFMode, state.wafExclusions), nil
+}
+
+func (s *nginxService) AddWAFExclusion(ctx context.Context, id string, req dto.AddWAFExclusionRequest) (*dto.WAFExclusionInfo, error) {
+	instance, err := s.findWAFInstance(id)
+	if err != nil {
+		return nil, err
+	}
+	exclusion, err := newWAFExclusion(entities.NginxRevisionInstance, instance.ID, req)
+	if err != nil {
+		return nil, err
+	}
+	state, err := s.loadConfigState(instance)
+	if err != nil {
+		return nil, err
+	}
+	state.wafExclusions = append(state.wafExclusions, *exclusion)
+	if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: "waf_exclusion_added"}); err != nil {
+		return nil, err
+	}
+	if err := s.wafRepo.CreateExclusion(exclusion); err != nil {
+		return nil, err
+	}
+	info := toWAFExclusionInfo(exclusion)
+	return &info, nil
+}
+
+func (s *nginxService) DeleteWAFExclusion(ctx context.Context, id, exclusionID string) error {
+	instance, err := s.findWAFInstance(id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.wafRepo.FindExclusion(entities.NginxRevisionInstance, instance.ID, exclusionID); err != nil {
+		return fmt.Errorf("waf exclusion not found: %w", err)
+	}
+	state, err := s.loadConfigState(instance)
+	if err != nil {
+		return err
+	}
+	state.wafExclusions = withoutWAFExclusion(state.wafExclusions, exclusionID)
+	if err := s.applyNginxConfig(ctx, state, nginxConfigChange{action: "waf_exclusion_deleted"}); err != nil {
+		return err
+	}
+	return s.wafRepo.DeleteExclusion(exclusionID)
+}
+
+// ================== Clusters ==================
+
+func (s *nginxClusterService) findWAFCluster(clusterID string) (*entities.NginxCluster, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	if !cluster.WAFEnabled {
+		return nil, fmt.Errorf("nginx cluster was not created with waf_enabled")
+	}
+	return cluster, nil
+}
+
+// applyClusterWAF renders mode and exclusions into the WAF block of the cluster config, and
+// into the server blocks that follow the cluster mode, and syncs it to the nodes. The stored
+// mode is put back when the config is rejected.
+func (s *nginxClusterService) applyClusterWAF(ctx context.Context, cluster *entities.NginxCluster, mode string, exclusions []entities.NginxWAFExclusion, action string) error {
+	config, err := setClusterWAFBlock(cluster.NginxConfig, clusterWAFBlock(mode, exclusions))
+	if err != nil {
+		return err
+	}
+	// Configs edited by hand without the server block section keep their own server blocks
+	if withBlocks, err := setClusterServerBlocks(config, s.renderServerBlockSection(cluster, mode, exclusions)); err == nil {
+		config = withBlocks
+	}
+	previousMode := cluster.WAFMode
+	cluster.WAFMode = mode
+	cluster.NginxConfig = config
+	if err := s.applyClusterConfig(ctx, cluster, nginxConfigChange{action: action}); err != nil {
+		cluster.WAFMode = previousMode
+		s.clusterRepo.Update(cluster)
+		return err
+	}
+	return nil
+}
+
+func (s *nginxClusterService) GetWAFPolicy(ctx context.Context, clusterID string) (*dto.WAFPolicyInfo, error) {
+	cluster, err := s.clusterRepo.FindByID(clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found: %w", err)
+	}
+	exclusions, err := s.wafRepo.ListExclusions(entities.NginxRevisionCluster, cluster.ID)
+	if err != nil {
+		return nil, err
+	}
+	return toWAFPolicyInfo(cluster.WAFEnabled, cluster.WAFMode, exclusions), nil
+}
+
+func (s *nginxClusterService) SetWAFMode(ctx context.Context, clusterID string, req dto.SetWAFModeRequest) (*dto.WAFPolicyInfo, error) {
+	if !validWAFMode(req.Mode) {
+		return nil, fmt.Errorf("unknown waf mode %q", req.Mode)
+	}
+	cluster, err := s.findWAFCluster(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	exclusions, err := s.wafRepo.ListExclusions(entities.NginxRevisionCluster, cluster.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyClusterWAF(ctx, cluster, req.Mode, exclusions, nginxWAFModeAction); err != nil {
+		return nil, err
+	}
+	s.publishEvent(ctx, "nginx_cluster."+nginxWAFModeAction, cluster.InfrastructureID, clusterID, string(entities.StatusRunning))
+	return toWAFPolicyInfo(true, cluster.WAFMode, exclusions), nil
+}
+
+func (s *nginxClusterService) AddWAFExclusion(ctx context.Context, clusterID string, req dto.AddWAFExclusionRequest) (*dto.WAFExclusionInfo, error) {
+	cluster, err := s.findWAFCluster(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	exclusion, err := newWAFExclusion(entities.NginxRevisionCluster, cluster.ID, req)
+	if err != nil {
+		return nil, err
+	}
+	exclusions, err := s.wafRepo.ListExclusions(entities.NginxRevisionCluster, cluster.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyClusterWAF(ctx, cluster, cluster.WAFMode, append(exclusions, *exclusion), "waf_exclusion_added"); err != nil {
+		return nil, err
+	}
+	if err := s.wafRepo.CreateExclusion(exclusion); err != nil {
+		return nil, err
+	}
+	info := toWAFExclusionInfo(exclusion)
+	return &info, nil
+}
+
+func (s *nginxClusterService) DeleteWAFExclusion(ctx context.Context, clusterID, exclusionID string) error {
+	cluster, err := s.findWAFCluster(clusterID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.wafRepo.FindExclusion(entities.NginxRevisionCluster, cluster.ID, exclusionID); err != nil {
+		return fmt.Errorf("waf exclusion not found: %w", err)
+	}
+	exclusions, err := s.wafRepo.ListExclusions(entities.NginxRevisionCluster, cluster.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.applyClusterWAF(ctx, cluster, cluster.WAFMode, withoutWAFExclusion(exclusions, exclusionID), "waf_exclusion_deleted"); err != nil {
+		return err
+	}
+	if err := s.wafRepo.DeleteExclusion(exclusionID); err != nil {
+		s.logger.Error("failed to delete waf exclusion", zap.String("exclusion_id", exclusionID), zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderNginxConfigWAF(t *testing.T) {
+	state := &nginxConfigState{
+		instance: &entities.NginxInstance{ID: "nginx-1", WAFEnabled: true, WAFMode: entities.NginxWAFBlocking},
+		wafExclusions: []entities.NginxWAFExclusion{
+			{RuleID: 942100},
+			{RuleID: 941100, Target: "ARGS:comment"},
+			{RuleID: 920350, PathPrefix: "/internal"},
+			{RuleID: 932100, Target: "ARGS:cmd", PathPrefix: "/admin"},
+		},
+	}
+
+	files, err := renderNginxConfig(state)
+	assert.NoError(t, err)
+	conf := files[nginxServerConfPath]
+	assert.Contains(t, conf, "    modsecurity on;\n    modsecurity_rules_file "+nginxWAFRulesFile+";\n")
+	assert.Contains(t, conf, "        SecRuleEngine On\n")
+	assert.Contains(t, conf, "        SecRuleRemoveById 942100\n")
+	assert.Contains(t, conf, `        SecRuleUpdateTargetById 941100 "!ARGS:comment"`)
+	assert.Contains(t, conf, `        SecRule REQUEST_FILENAME "@beginsWith /internal" "id:10002,phase:1,pass,nolog,ctl:ruleRemoveById=920350"`)
+	assert.Contains(t, conf, `        SecRule REQUEST_FILENAME "@beginsWith /admin" "id:10003,phase:1,pass,nolog,ctl:ruleRemoveTargetById=932100;ARGS:cmd"`)
+	assert.Contains(t, conf, "    location = /health {\n        access_log off;\n        modsecurity off;\n")
+
+	state.instance.WAFMode = entities.NginxWAFDetectionOnly
+	files, err = renderNginxConfig(state)
+	assert.NoError(t, err)
+	assert.Contains(t, files[nginxServerConfPath], "        SecRuleEngine DetectionOnly\n")
+
+	state.instance.WAFMode = entities.NginxWAFOff
+	files, err = renderNginxConfig(state)
+	assert.NoError(t, err)
+	assert.Contains(t, files[nginxServerConfPath], "    modsecurity off;\n")
+	assert.NotContains(t, files[nginxServerConfPath], "SecRuleEngine")
+
+	// The plain nginx image does not know the modsecurity directives
+	state.instance.WAFEnabled = false
+	files, err = renderNginxConfig(state)
+	assert.NoError(t, err)
+	assert.NotContains(t, files[nginxServerConfPath], "modsecurity")
+}
+
+func TestValidateWAFExclusion(t *testing.T) {
+	assert.NoError(t, validateWAFExclusion(&entities.NginxWAFExclusion{RuleID: 942100, Target: "REQUEST_COOKIES:session", PathPrefix: "/api/v1"}))
+
+	invalid := []entities.NginxWAFExclusion{
+		{RuleID: 0},
+		{RuleID: 942100, Target: "ARGS:a\" \"id:1"},
+		{RuleID: 942100, Target: "args"},
+		{RuleID: 942100, PathPrefix: "api"},
+		{RuleID: 942100, PathPrefix: "/api'"},
+		{RuleID: 942100, PathPrefix: "/a b"},
+	}
+	for _, exclusion := range invalid {
+		assert.Error(t, validateWAFExclusion(&exclusion), "%+v", exclusion)
+	}
+}
+
+func TestSetClusterWAFBlock(t *testing.T) {
+	config := "http {\n    server {\n        listen 80 default_server;\n        server_name _;\n\n        location / {\n        }\n    }\n}\n"
+
+	withBlock, err := setClusterWAFBlock(config, clusterWAFBlock(entities.NginxWAFDetectionOnly, nil))
+	assert.NoError(t, err)
+	assert.Contains(t, withBlock, "server_name _;\n\n        "+nginxWAFBeginLine)
+	assert.Equal(t, entities.NginxWAFDetectionOnly, clusterWAFMode(withBlock))
+
+	exclusions := []entities.NginxWAFExclusion{{RuleID: 942100}}
+	updated, err := setClusterWAFBlock(withBlock, clusterWAFBlock(entities.NginxWAFBlocking, exclusions))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(updated, nginxWAFBeginLine))
+	assert.Contains(t, updated, "SecRuleRemoveById 942100")
+	assert.Contains(t, updated, "        location / {\n")
+	assert.Equal(t, entities.NginxWAFBlocking, clusterWAFMode(updated))
+
+	off, err := setClusterWAFBlock(updated, clusterWAFBlock(entities.NginxWAFOff, exclusions))
+	assert.NoError(t, err)
+	assert.Equal(t, entities.NginxWAFOff, clusterWAFMode(off))
+
+	_, err = setClusterWAFBlock("events {}\n", clusterWAFBlock(entities.NginxWAFBlocking, nil))
+	assert.Error(t, err)
+}
+
+// noUpstreamsClusterRepo serves a cluster without upstreams or server blocks; other calls panic
+type noUpstreamsClusterRepo struct {
+	repositories.INginxClusterRepository
+}
+
+func (noUpstreamsClusterRepo) ListUpstreams(string) ([]entities.NginxClusterUpstream, error) {
+	return nil, nil
+}
+
+func (noUpstreamsClusterRepo) ListServerBlocks(string) ([]entities.NginxServerBlock, error) {
+	return nil, nil
+}
+
+func TestGenerateClusterConfigWAF(t *testing.T) {
+	svc := &nginxClusterService{clusterRepo: noUpstreamsClusterRepo{}}
+	cluster := &entities.NginxCluster{ClusterName: "edge", WAFEnabled: true, WAFMode: entities.NginxWAFOff, WorkerConnections: 1024}
+
+	config := svc.generateNginxConfig(cluster)
+	assert.Contains(t, config, "load_module "+nginxWAFModule+";\nworker_processes auto;")
+	assert.Contains(t, config, nginxWAFBeginLine)
+	assert.Contains(t, config, "            access_log off;\n            modsecurity off;\n")
+
+	cluster.WAFEnabled = false
+	assert.NotContains(t, svc.generateNginxConfig(cluster), "modsecurity")
+}
+
+func TestParseWAFAuditLine(t *testing.T) {
+	at := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	body := `{"transaction":{"client_ip":"172.18.0.1","unique_id":"abc","request":{"method":"GET","uri":"/?q=<script>","headers":{"Host":"shop.example.com"}},` +
+		`"response":{"http_code":403},"messages":[{"message":"XSS Attack Detected via libinjection","details":{"ruleId":"941100","severity":"2"}},` +
+		`{"message":"Inbound Anomaly Score Exceeded (Total Score: 5)","details":{"ruleId":"949110","severity":"0"}}]}}`
+
+	event, ok := parseWAFAuditLine(body, at)
+	assert.True(t, ok)
+	assert.Equal(t, at, event.Timestamp)
+	assert.Equal(t, "172.18.0.1", event.ClientIP)
+	assert.Equal(t, "/?q=<script>", event.URI)
+	assert.Equal(t, "shop.example.com", event.Host)
+	assert.True(t, event.Blocked)
+	assert.Equal(t, []string{"941100", "949110"}, event.RuleIDs)
+
+	_, ok = parseWAFAuditLine(`{"transaction":{"client_ip":"172.18.0.1","response":{"http_code":200},"messages":[]}}`, at)
+	assert.False(t, ok)
+	_, ok = parseWAFAuditLine(`{"status":200}`, at)
+	assert.False(t, ok)
+}
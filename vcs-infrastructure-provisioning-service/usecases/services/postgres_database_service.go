@@ -135,7 +135,7 @@ func (s *postgresDatabaseService) CreateDatabase(ctx context.Context, instanceID
 			Port:     instance.Port,
 			Database: database.DBName,
 			Username: database.OwnerUsername,
-			Password: database.OwnerPassword,
+			Password: revealSecret(ctx, database.OwnerPassword),
 		},
 		CreatedAt: database.CreatedAt.Format(time.RFC3339),
 		UpdatedAt: database.UpdatedAt.Format(time.RFC3339),
@@ -165,7 +165,7 @@ func (s *postgresDatabaseService) GetDatabase(ctx context.Context, databaseID st
 			Port:     database.Instance.Port,
 			Database: database.DBName,
 			Username: database.OwnerUsername,
-			Password: database.OwnerPassword,
+			Password: revealSecret(ctx, database.OwnerPassword),
 		},
 		CreatedAt: database.CreatedAt.Format(time.RFC3339),
 		UpdatedAt: database.UpdatedAt.Format(time.RFC3339),
@@ -102,27 +102,7 @@ func (s *postgreSQLService) CreatePostgreSQL(ctx context.Context, userID string,
 
 	instance.VolumeID = volumeName
 
-	containerName := fmt.Sprintf("iaas-postgres-%s", instanceID)
-	containerConfig := docker.ContainerConfig{
-		Name:  containerName,
-		Image: fmt.Sprintf("postgres:%s", req.Version),
-		Env: []string{
-			fmt.Sprintf("POSTGRES_USER=%s", req.Username),
-			fmt.Sprintf("POSTGRES_PASSWORD=%s", req.Password),
-			fmt.Sprintf("POSTGRES_DB=%s", req.DatabaseName),
-		},
-		Ports: map[string]string{
-			"5432": fmt.Sprintf("%d", req.Port),
-		},
-		Volumes: map[string]string{
-			volumeName: "/var/lib/postgresql/data",
-		},
-		Network: "iaas_iaas-network",
-		Resources: docker.ResourceConfig{
-			CPULimit:    req.CPULimit,
-			MemoryLimit: req.MemoryLimit,
-		},
-	}
+	containerConfig := postgresContainerConfig(instance)
 
 	containerID, err := s.dockerSvc.CreateContainer(ctx, containerConfig)
 	if err != nil {
@@ -187,6 +167,30 @@ func (s *postgreSQLService) CreatePostgreSQL(ctx context.Context, userID string,
 	}, nil
 }
 
+// postgresContainerConfig builds the container spec of a single PostgreSQL instance
+func postgresContainerConfig(instance *entities.PostgreSQLInstance) docker.ContainerConfig {
+	return docker.ContainerConfig{
+		Name:  fmt.Sprintf("iaas-postgres-%s", instance.ID),
+		Image: fmt.Sprintf("postgres:%s", instance.Version),
+		Env: []string{
+			fmt.Sprintf("POSTGRES_USER=%s", instance.Username),
+			fmt.Sprintf("POSTGRES_PASSWORD=%s", instance.Password),
+			fmt.Sprintf("POSTGRES_DB=%s", instance.DatabaseName),
+		},
+		Ports: map[string]string{
+			"5432": fmt.Sprintf("%d", instance.Port),
+		},
+		Volumes: map[string]string{
+			instance.VolumeID: "/var/lib/postgresql/data",
+		},
+		Network: "iaas_iaas-network",
+		Resources: docker.ResourceConfig{
+			CPULimit:    instance.CPULimit,
+			MemoryLimit: instance.MemoryLimit,
+		},
+	}
+}
+
 func (s *postgreSQLService) StartPostgreSQL(ctx context.Context, id string) error {
 	infra, err := s.infraRepo.FindByID(id)
 	if err != nil {
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRegistryCredentialNotFound = errors.New("registry credential not found")
+	ErrRegistryCredentialExists   = errors.New("registry credential with this name already exists")
+	ErrRegistryCredentialInUse    = errors.New("registry credential is used by docker services or dind environments")
+)
+
+// IRegistryCredentialService manages the private registry credentials of users
+type IRegistryCredentialService interface {
+	CreateCredential(ctx context.Context, userID string, req dto.CreateRegistryCredentialRequest) (*dto.RegistryCredentialInfo, error)
+	ListCredentials(ctx context.Context, userID string, req dto.ListRegistryCredentialsRequest) ([]dto.RegistryCredentialInfo, error)
+	GetCredential(ctx context.Context, userID, ref string) (*dto.RegistryCredentialInfo, error)
+	UpdateCredential(ctx context.Context, userID, ref string, req dto.UpdateRegistryCredentialRequest) (*dto.RegistryCredentialInfo, error)
+	DeleteCredential(ctx context.Context, userID, ref string) error
+}
+
+type registryCredentialService struct {
+	registryRepo repositories.IRegistryCredentialRepository
+}
+
+func NewRegistryCredentialService(registryRepo repositories.IRegistryCredentialRepository) IRegistryCredentialService {
+	return &registryCredentialService{registryRepo: registryRepo}
+}
+
+func (s *registryCredentialService) CreateCredential(ctx context.Context, userID string, req dto.CreateRegistryCredentialRequest) (*dto.RegistryCredentialInfo, error) {
+	if _, err := s.registryRepo.FindByUserAndName(userID, req.Name); err == nil {
+		return nil, ErrRegistryCredentialExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	credential := &entities.RegistryCredential{
+		ID:            uuid.New().String(),
+		UserID:        userID,
+		ProjectID:     req.ProjectID,
+		Name:          req.Name,
+		ServerAddress: req.ServerAddress,
+		Username:      req.Username,
+		Password:      req.Password,
+	}
+	if err := s.registryRepo.Create(credential); err != nil {
+		return nil, err
+	}
+	return registryCredentialInfo(ctx, credential), nil
+}
+
+func (s *registryCredentialService) ListCredentials(ctx context.Context, userID string, req dto.ListRegistryCredentialsRequest) ([]dto.RegistryCredentialInfo, error) {
+	credentials, err := s.registryRepo.ListByUser(userID, req.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]dto.RegistryCredentialInfo, 0, len(credentials))
+	for i := range credentials {
+		infos = append(infos, *registryCredentialInfo(ctx, &credentials[i]))
+	}
+	return infos, nil
+}
+
+func (s *registryCredentialService) GetCredential(ctx context.Context, userID, ref string) (*dto.RegistryCredentialInfo, error) {
+	credential, err := resolveRegistryCredential(s.registryRepo, userID, ref)
+	if err != nil {
+		return nil, err
+	}
+	return registryCredentialInfo(ctx, credential), nil
+}
+
+func (s *registryCredentialService) UpdateCredential(ctx context.Context, userID, ref string, req dto.UpdateRegistryCredentialRequest) (*dto.RegistryCredentialInfo, error) {
+	credential, err := resolveRegistryCredential(s.registryRepo, userID, ref)
+	if err != nil {
+		return nil, err
+	}
+	if req.ProjectID != nil {
+		credential.ProjectID = *req.ProjectID
+	}
+	if req.ServerAddress != "" {
+		credential.ServerAddress = req.ServerAddress
+	}
+	if req.Username != "" {
+		credential.Username = req.Username
+	}
+	if req.Password != "" {
+		credential.Password = req.Password
+	}
+	if err := s.registryRepo.Update(credential); err != nil {
+		return nil, err
+	}
+	return registryCredentialInfo(ctx, credential), nil
+}
+
+// DeleteCredential removes a credential nothing pulls with anymore
+func (s *registryCredentialService) DeleteCredential(ctx context.Context, userID, ref string) error {
+	credential, err := resolveRegistryCredential(s.registryRepo, userID, ref)
+	if err != nil {
+		return err
+	}
+	references, err := s.registryRepo.CountReferences(credential.ID)
+	if err != nil {
+		return err
+	}
+	if references > 0 {
+		return fmt.Errorf("%w (%d)", ErrRegistryCredentialInUse, references)
+	}
+	return s.registryRepo.Delete(credential.ID)
+}
+
+// resolveRegistryCredential finds a credential of userID by ID or by name. Credentials of
+// other users are reported as not found.
+func resolveRegistryCredential(registryRepo repositories.IRegistryCredentialRepository, userID, ref string) (*entities.RegistryCredential, error) {
+	credential, err := registryRepo.FindByID(ref)
+	if err == nil && credential.UserID == userID {
+		return credential, nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	credential, err = registryRepo.FindByUserAndName(userID, ref)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrRegistryCredentialNotFound, ref)
+	}
+	return credential, err
+}
+
+// registryAuth loads the login of a stored credential, nil when id is empty
+func registryAuth(registryRepo repositories.IRegistryCredentialRepository, id string) (*docker.RegistryAuth, error) {
+	if id == "" || registryRepo == nil {
+		return nil, nil
+	}
+	credential, err := registryRepo.FindByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load registry credential %s: %w", id, err)
+	}
+	return &docker.RegistryAuth{
+		ServerAddress: credential.ServerAddress,
+		Username:      credential.Username,
+		Password:      credential.Password,
+	}, nil
+}
+
+func registryCredentialInfo(ctx context.Context, credential *entities.RegistryCredential) *dto.RegistryCredentialInfo {
+	return &dto.RegistryCredentialInfo{
+		ID:            credential.ID,
+		Name:          credential.Name,
+		ProjectID:     credential.ProjectID,
+		ServerAddress: credential.ServerAddress,
+		Username:      credential.Username,
+		Password:      revealSecret(ctx, credential.Password),
+		CreatedAt:     credential.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt:     credential.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
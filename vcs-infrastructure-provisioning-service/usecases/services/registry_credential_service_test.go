@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type fakeRegistryCredentialRepository struct {
+	credentials map[string]*entities.RegistryCredential
+	references  int64
+}
+
+func (r *fakeRegistryCredentialRepository) Create(credential *entities.RegistryCredential) error {
+	r.credentials[credential.ID] = credential
+	return nil
+}
+
+func (r *fakeRegistryCredentialRepository) Update(credential *entities.RegistryCredential) error {
+	r.credentials[credential.ID] = credential
+	return nil
+}
+
+func (r *fakeRegistryCredentialRepository) Delete(id string) error {
+	delete(r.credentials, id)
+	return nil
+}
+
+func (r *fakeRegistryCredentialRepository) FindByID(id string) (*entities.RegistryCredential, error) {
+	if credential, ok := r.credentials[id]; ok {
+		return credential, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeRegistryCredentialRepository) FindByUserAndName(userID, name string) (*entities.RegistryCredential, error) {
+	for _, credential := range r.credentials {
+		if credential.UserID == userID && credential.Name == name {
+			return credential, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeRegistryCredentialRepository) ListByUser(userID, projectID string) ([]entities.RegistryCredential, error) {
+	return nil, nil
+}
+
+func (r *fakeRegistryCredentialRepository) CountReferences(id string) (int64, error) {
+	return r.references, nil
+}
+
+func newFakeRegistryRepo() *fakeRegistryCredentialRepository {
+	return &fakeRegistryCredentialRepository{credentials: map[string]*entities.RegistryCredential{
+		"cred-1": {ID: "cred-1", UserID: "alice", Name: "ghcr", ServerAddress: "ghcr.io", Username: "alice", Password: "token"},
+		"cred-2": {ID: "cred-2", UserID: "bob", Name: "ghcr", ServerAddress: "ghcr.io", Username: "bob", Password: "other"},
+	}}
+}
+
+func TestResolveRegistryCredential(t *testing.T) {
+	repo := newFakeRegistryRepo()
+
+	byID, err := resolveRegistryCredential(repo, "alice", "cred-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "cred-1", byID.ID)
+
+	byName, err := resolveRegistryCredential(repo, "bob", "ghcr")
+	assert.NoError(t, err)
+	assert.Equal(t, "cred-2", byName.ID)
+
+	// Credentials of another user are not found, by ID or name
+	_, err = resolveRegistryCredential(repo, "alice", "cred-2")
+	assert.ErrorIs(t, err, ErrRegistryCredentialNotFound)
+	_, err = resolveRegistryCredential(repo, "carol", "ghcr")
+	assert.ErrorIs(t, err, ErrRegistryCredentialNotFound)
+}
+
+func TestRegistryCredentialServiceMasksPassword(t *testing.T) {
+	service := NewRegistryCredentialService(newFakeRegistryRepo())
+
+	info, err := service.GetCredential(context.Background(), "alice", "ghcr")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", info.Username)
+	assert.Equal(t, maskedSecretValue, info.Password)
+}
+
+func TestRegistryCredentialServiceDelete(t *testing.T) {
+	repo := newFakeRegistryRepo()
+	service := NewRegistryCredentialService(repo)
+
+	repo.references = 2
+	assert.ErrorIs(t, service.DeleteCredential(context.Background(), "alice", "cred-1"), ErrRegistryCredentialInUse)
+	assert.Contains(t, repo.credentials, "cred-1")
+
+	repo.references = 0
+	assert.NoError(t, service.DeleteCredential(context.Background(), "alice", "cred-1"))
+	assert.NotContains(t, repo.credentials, "cred-1")
+	assert.ErrorIs(t, service.DeleteCredential(context.Background(), "alice", "cred-2"), ErrRegistryCredentialNotFound)
+}
+
+func TestDockerReplicaContainerConfigImage(t *testing.T) {
+	service := &entities.DockerService{ID: "svc-1", Image: "ghcr.io/acme/api", ImageTag: "1.4", PullPolicy: docker.PullAlways}
+
+	config := dockerReplicaContainerConfig(service, "api-1")
+	assert.Equal(t, "ghcr.io/acme/api:1.4", config.Image)
+	assert.Equal(t, docker.PullAlways, config.PullPolicy)
+
+	// Once pinned, replicas run the digest and never need pulling it again
+	service.ImageDigest = "sha256:0123abcd"
+	config = dockerReplicaContainerConfig(service, "api-1")
+	assert.Equal(t, "ghcr.io/acme/api@sha256:0123abcd", config.Image)
+	assert.Equal(t, docker.PullIfNotPresent, config.PullPolicy)
+}
+
+func TestImageRegistry(t *testing.T) {
+	assert.Equal(t, "", imageRegistry("nginx:latest"))
+	assert.Equal(t, "", imageRegistry("library/nginx"))
+	assert.Equal(t, "ghcr.io", imageRegistry("ghcr.io/acme/api:1.4"))
+	assert.Equal(t, "registry.local:5000", imageRegistry("registry.local:5000/api"))
+	assert.Equal(t, "localhost", imageRegistry("localhost/api"))
+}
+
+// stdinDocker records exec calls made with input; other calls panic
+type stdinDocker struct {
+	docker.IDockerService
+	output string
+	cmd    []string
+	input  string
+}
+
+func (d *stdinDocker) ExecCommandWithInput(ctx context.Context, containerID string, cmd []string, input []byte) (string, error) {
+	d.cmd, d.input = cmd, string(input)
+	return d.output, nil
+}
+
+func TestRegistryLoginPassesPasswordOnStdin(t *testing.T) {
+	dockerSvc := &stdinDocker{output: "Login Succeeded\n"}
+	service := &dinDService{dockerSvc: dockerSvc}
+	auth := &docker.RegistryAuth{ServerAddress: "ghcr.io", Username: "alice", Password: "p'w; rm -rf /"}
+
+	assert.NoError(t, service.registryLogin(context.Background(), "dind-1", auth))
+	assert.Equal(t, []string{"docker", "login", "-u", "alice", "--password-stdin", "ghcr.io"}, dockerSvc.cmd)
+	assert.Equal(t, auth.Password, dockerSvc.input)
+
+	dockerSvc.output = "Error response from daemon: unauthorized"
+	assert.ErrorContains(t, service.registryLogin(context.Background(), "dind-1", auth), "unauthorized")
+}
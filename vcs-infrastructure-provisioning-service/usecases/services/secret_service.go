@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/secrets"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"go.uber.org/zap"
+)
+
+const secretRotationBatchSize = 100
+
+var ErrSecretRotationRunning = errors.New("secret rotation already running")
+
+// secretModels are the entities with fields stored through the secret serializer
+var secretModels = []interface{}{
+	&entities.PostgreSQLInstance{},
+	&entities.PostgreSQLCluster{},
+	&entities.PostgresDatabase{},
+	&entities.NginxCertificate{},
+	&entities.NginxSecurity{},
+	&entities.NginxCluster{},
+	&entities.NginxConfigRevision{},
+	&entities.AcmeAccount{},
+	&entities.K8sCluster{},
+	&entities.DockerEnvVar{},
+	&entities.RegistryCredential{},
+	&entities.StackOperation{},
+}
+
+// ISecretService re-encrypts stored secrets after a master key rotation
+type ISecretService interface {
+	RotateSecrets(ctx context.Context, rotateDataKeys bool) (*dto.SecretRotationResult, error)
+	Start(ctx context.Context)
+}
+
+type secretService struct {
+	secretRepo repositories.ISecretRepository
+	keyring    *secrets.Keyring
+	logger     logger.ILogger
+	running    sync.Mutex
+}
+
+func NewSecretService(secretRepo repositories.ISecretRepository, keyring *secrets.Keyring, logger logger.ILogger) ISecretService {
+	return &secretService{
+		secretRepo: secretRepo,
+		keyring:    keyring,
+		logger:     logger,
+	}
+}
+
+// Start runs a rotation pass in the background so values still in plaintext or wrapped
+// by a previous master key are moved to the current one
+func (s *secretService) Start(ctx context.Context) {
+	go func() {
+		result, err := s.RotateSecrets(ctx, false)
+		if err != nil {
+			s.logger.Error("secret rotation failed", zap.Error(err))
+			return
+		}
+		if result.Rotated > 0 || result.Failed > 0 {
+			s.logger.Info("secret rotation completed",
+				zap.String("key_id", result.KeyID),
+				zap.Int("rotated", result.Rotated),
+				zap.Int("failed", result.Failed))
+		}
+	}()
+}
+
+// RotateSecrets rewraps every secret not yet under the current master key. With
+// rotateDataKeys every value is decrypted and sealed again under a fresh data key.
+func (s *secretService) RotateSecrets(ctx context.Context, rotateDataKeys bool) (*dto.SecretRotationResult, error) {
+	if !s.running.TryLock() {
+		return nil, ErrSecretRotationRunning
+	}
+	defer s.running.Unlock()
+
+	result := &dto.SecretRotationResult{KeyID: s.keyring.CurrentKeyID(), Columns: []dto.SecretColumnRotation{}}
+	for _, model := range secretModels {
+		columns, err := s.secretRepo.SecretColumns(model)
+		if err != nil {
+			return nil, err
+		}
+		for _, column := range columns {
+			rotation, err := s.rotateColumn(ctx, column, rotateDataKeys)
+			if err != nil {
+				return nil, err
+			}
+			result.Scanned += rotation.Scanned
+			result.Rotated += rotation.Rotated
+			result.Failed += rotation.Failed
+			result.Columns = append(result.Columns, *rotation)
+		}
+	}
+	return result, nil
+}
+
+func (s *secretService) rotateColumn(ctx context.Context, column repositories.SecretColumn, rotateDataKeys bool) (*dto.SecretColumnRotation, error) {
+	rotation := &dto.SecretColumnRotation{Table: column.Table, Column: column.Column}
+	afterID := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		values, err := s.secretRepo.ListValues(column, afterID, secretRotationBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			rotation.Scanned++
+			if !rotateDataKeys && !s.keyring.NeedsRotation(value.Value) {
+				continue
+			}
+			if err := s.rotateValue(column, value, rotateDataKeys); err != nil {
+				rotation.Failed++
+				s.logger.Warn("failed to rotate secret",
+					zap.String("table", column.Table),
+					zap.String("column", column.Column),
+					zap.String("id", value.ID),
+					zap.Error(err))
+				continue
+			}
+			rotation.Rotated++
+		}
+		if len(values) < secretRotationBatchSize {
+			return rotation, nil
+		}
+		afterID = values[len(values)-1].ID
+	}
+}
+
+func (s *secretService) rotateValue(column repositories.SecretColumn, value repositories.SecretValue, rotateDataKeys bool) error {
+	var rotated string
+	var err error
+	if rotateDataKeys {
+		var plaintext string
+		if plaintext, err = s.keyring.Decrypt(value.Value); err == nil {
+			rotated, err = s.keyring.Encrypt(plaintext)
+		}
+	} else {
+		rotated, err = s.keyring.Rewrap(value.Value)
+	}
+	if err != nil {
+		return err
+	}
+	// A value changed since it was listed is already sealed under the current key
+	_, err = s.secretRepo.UpdateValue(column, value.ID, value.Value, rotated)
+	return err
+}
+
+// revealSecret returns value for callers holding the reveal scope and a mask otherwise
+func revealSecret(ctx context.Context, value string) string {
+	if value == "" || secrets.CanReveal(ctx) {
+		return value
+	}
+	return maskedSecretValue
+}
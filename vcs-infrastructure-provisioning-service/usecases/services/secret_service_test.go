@@ -0,0 +1,142 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/secrets"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gorm.io/gorm/schema"
+)
+
+// memorySecretRepo keeps one secret column in memory
+type memorySecretRepo struct {
+	values map[string]string
+}
+
+func (r *memorySecretRepo) SecretColumns(model interface{}) ([]repositories.SecretColumn, error) {
+	if _, ok := model.(*entities.DockerEnvVar); ok {
+		return []repositories.SecretColumn{{Table: "docker_env_vars", Column: "value"}}, nil
+	}
+	return nil, nil
+}
+
+func (r *memorySecretRepo) ListValues(column repositories.SecretColumn, afterID string, limit int) ([]repositories.SecretValue, error) {
+	ids := []string{}
+	for id := range r.values {
+		if id > afterID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	values := []repositories.SecretValue{}
+	for _, id := range ids[:min(limit, len(ids))] {
+		values = append(values, repositories.SecretValue{ID: id, Value: r.values[id]})
+	}
+	return values, nil
+}
+
+func (r *memorySecretRepo) UpdateValue(column repositories.SecretColumn, id, oldValue, newValue string) (bool, error) {
+	if r.values[id] != oldValue {
+		return false, nil
+	}
+	r.values[id] = newValue
+	return true, nil
+}
+
+type discardLogger struct {
+	logger.ILogger
+}
+
+func (discardLogger) Debug(string, ...zap.Field) {}
+func (discardLogger) Info(string, ...zap.Field)  {}
+func (discardLogger) Warn(string, ...zap.Field)  {}
+func (discardLogger) Error(string, ...zap.Field) {}
+
+func TestRotateSecrets(t *testing.T) {
+	oldKeyring, _ := secrets.NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	keyring, _ := secrets.NewKeyring("k2", map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 32),
+	})
+	oldSealed, _ := oldKeyring.Encrypt("old")
+	current, _ := keyring.Encrypt("current")
+
+	repo := &memorySecretRepo{values: map[string]string{
+		"a": "plaintext",
+		"b": oldSealed,
+		"c": current,
+		"d": "enc:v1:gone:AAAA:AAAA",
+	}}
+	svc := NewSecretService(repo, keyring, discardLogger{})
+
+	result, err := svc.RotateSecrets(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, "k2", result.KeyID)
+	assert.Equal(t, 4, result.Scanned)
+	assert.Equal(t, 2, result.Rotated)
+	assert.Equal(t, 1, result.Failed)
+	assert.Len(t, result.Columns, 1)
+
+	for id, want := range map[string]string{"a": "plaintext", "b": "old", "c": "current"} {
+		assert.True(t, strings.HasPrefix(repo.values[id], "enc:v1:k2:"), id)
+		plaintext, err := keyring.Decrypt(repo.values[id])
+		assert.NoError(t, err)
+		assert.Equal(t, want, plaintext)
+	}
+	assert.Equal(t, current, repo.values["c"])
+
+	// Rotating data keys re-encrypts even values already under the current key
+	result, err = svc.RotateSecrets(context.Background(), true)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Rotated)
+	assert.NotEqual(t, current, repo.values["c"])
+}
+
+func TestSecretModelsCoverCopiedSecrets(t *testing.T) {
+	// Columns that carry copies of secrets, such as rollback snapshots and stored requests,
+	// have to be sealed and rotated like the originals
+	sealed := map[string]bool{}
+	for _, model := range secretModels {
+		parsed, err := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+		assert.NoError(t, err)
+		for _, field := range parsed.Fields {
+			if field.TagSettings["SERIALIZER"] == secrets.SerializerName {
+				sealed[parsed.Table+"."+field.DBName] = true
+			}
+		}
+	}
+	for _, column := range []string{
+		"nginx_certificates.private_key",
+		"nginx_securities.basic_auth_password",
+		"nginx_clusters.vrrp_auth_pass",
+		"nginx_config_revisions.snapshot",
+		"stack_operations.request",
+	} {
+		assert.True(t, sealed[column], column)
+	}
+}
+
+func TestRevealSecret(t *testing.T) {
+	service := &entities.DockerService{EnvVars: []entities.DockerEnvVar{
+		{Key: "MODE", Value: "prod"},
+		{Key: "API_KEY", Value: "s3cret", IsSecret: true},
+	}}
+
+	info := toDockerServiceInfo(context.Background(), service)
+	assert.Equal(t, "prod", info.EnvVars[0].Value)
+	assert.Equal(t, maskedSecretValue, info.EnvVars[1].Value)
+
+	info = toDockerServiceInfo(secrets.WithReveal(context.Background()), service)
+	assert.Equal(t, "s3cret", info.EnvVars[1].Value)
+
+	assert.Empty(t, revealSecret(context.Background(), ""))
+}
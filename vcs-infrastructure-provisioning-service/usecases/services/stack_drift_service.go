@@ -0,0 +1,526 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/go-connections/nat"
+	"go.uber.org/zap"
+)
+
+type IStackDriftService interface {
+	DetectDrift(ctx context.Context, stackID string) (*dto.StackDriftReport, error)
+	ReconcileStack(ctx context.Context, stackID string) (*dto.StackReconcileResult, error)
+}
+
+type stackDriftService struct {
+	stackRepo        repositories.IStackRepository
+	pgRepo           repositories.IPostgreSQLRepository
+	nginxRepo        repositories.INginxRepository
+	dockerRepo       repositories.IDockerServiceRepository
+	clusterRepo      repositories.IPostgreSQLClusterRepository
+	nginxClusterRepo repositories.INginxClusterRepository
+	dinDRepo         repositories.IDinDRepository
+	dockerSvc        docker.IDockerService
+	logger           logger.ILogger
+}
+
+func NewStackDriftService(
+	stackRepo repositories.IStackRepository,
+	pgRepo repositories.IPostgreSQLRepository,
+	nginxRepo repositories.INginxRepository,
+	dockerRepo repositories.IDockerServiceRepository,
+	clusterRepo repositories.IPostgreSQLClusterRepository,
+	nginxClusterRepo repositories.INginxClusterRepository,
+	dinDRepo repositories.IDinDRepository,
+	dockerSvc docker.IDockerService,
+	logger logger.ILogger,
+) IStackDriftService {
+	return &stackDriftService{
+		stackRepo:        stackRepo,
+		pgRepo:           pgRepo,
+		nginxRepo:        nginxRepo,
+		dockerRepo:       dockerRepo,
+		clusterRepo:      clusterRepo,
+		nginxClusterRepo: nginxClusterRepo,
+		dinDRepo:         dinDRepo,
+		dockerSvc:        dockerSvc,
+		logger:           logger,
+	}
+}
+
+// expectedContainer is the desired state of one container that belongs to a stack resource.
+// Resources built from a single stored spec carry a config and can be recreated;
+// cluster members are only checked for existence and running state.
+type expectedContainer struct {
+	containerID string
+	name        string
+	role        string
+	network     string
+	config      *docker.ContainerConfig
+	persist     func(containerID string) error
+}
+
+func (s *stackDriftService) DetectDrift(ctx context.Context, stackID string) (*dto.StackDriftReport, error) {
+	stack, err := s.stackRepo.FindByID(stackID)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := s.stackRepo.FindResourcesByStackID(stackID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &dto.StackDriftReport{
+		StackID:   stack.ID,
+		StackName: stack.Name,
+		CheckedAt: time.Now(),
+		Resources: []dto.ResourceDrift{},
+	}
+
+	for _, res := range resources {
+		resourceDrift, _, err := s.inspectResource(ctx, res)
+		if err != nil {
+			return nil, err
+		}
+		if resourceDrift.Drifted {
+			report.Drifted = true
+		}
+		report.Resources = append(report.Resources, *resourceDrift)
+	}
+
+	return report, nil
+}
+
+func (s *stackDriftService) ReconcileStack(ctx context.Context, stackID string) (*dto.StackReconcileResult, error) {
+	if _, err := s.stackRepo.FindByID(stackID); err != nil {
+		return nil, err
+	}
+
+	resources, err := s.stackRepo.FindResourcesByStackID(stackID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &dto.StackReconcileResult{
+		StackID: stackID,
+		Actions: []dto.ReconcileAction{},
+	}
+
+	for _, res := range resources {
+		resourceDrift, expected, err := s.inspectResource(ctx, res)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, container := range resourceDrift.Containers {
+			if len(container.Differences) == 0 {
+				continue
+			}
+			action := s.reconcileContainer(ctx, expected[i], container)
+			action.InfrastructureID = res.InfrastructureID
+			action.ResourceType = res.ResourceType
+			result.Actions = append(result.Actions, action)
+		}
+	}
+
+	report, err := s.DetectDrift(ctx, stackID)
+	if err != nil {
+		return nil, err
+	}
+	result.Report = report
+
+	return result, nil
+}
+
+func (s *stackDriftService) reconcileContainer(ctx context.Context, expected expectedContainer, container dto.ContainerDrift) dto.ReconcileAction {
+	action := dto.ReconcileAction{ContainerName: expected.name}
+
+	onlyStopped := true
+	for _, diff := range container.Differences {
+		if diff.Kind != dto.DriftStopped {
+			onlyStopped = false
+		}
+	}
+
+	if onlyStopped {
+		if err := s.dockerSvc.StartContainer(ctx, expected.containerID); err != nil {
+			action.Action = "failed"
+			action.Error = err.Error()
+			return action
+		}
+		action.Action = "restarted"
+		return action
+	}
+
+	if expected.config == nil || expected.persist == nil {
+		action.Action = "skipped"
+		action.Reason = "cluster members cannot be recreated from the stack record; use the cluster's node management"
+		return action
+	}
+
+	newID, err := s.recreateContainer(ctx, expected)
+	if err != nil {
+		action.Action = "failed"
+		action.Error = err.Error()
+		return action
+	}
+
+	action.Action = "recreated"
+	action.NewContainerID = newID
+	return action
+}
+
+// recreateContainer replaces a drifted container with one built from the stored spec.
+// Named volumes are kept so data survives the recreation.
+func (s *stackDriftService) recreateContainer(ctx context.Context, expected expectedContainer) (string, error) {
+	if expected.containerID != "" {
+		if _, err := s.dockerSvc.InspectContainer(ctx, expected.containerID); err == nil {
+			s.dockerSvc.StopContainer(ctx, expected.containerID)
+			if err := s.dockerSvc.RemoveContainer(ctx, expected.containerID); err != nil {
+				return "", fmt.Errorf("failed to remove drifted container: %w", err)
+			}
+		}
+	}
+	// A container with the same name may exist even though the recorded ID is gone
+	if _, err := s.dockerSvc.InspectContainer(ctx, expected.config.Name); err == nil {
+		s.dockerSvc.RemoveContainer(ctx, expected.config.Name)
+	}
+
+	for volumeName := range expected.config.Volumes {
+		if !strings.HasPrefix(volumeName, "/") {
+			if err := s.dockerSvc.CreateVolume(ctx, volumeName); err != nil {
+				return "", fmt.Errorf("failed to ensure volume %s: %w", volumeName, err)
+			}
+		}
+	}
+
+	containerID, err := s.dockerSvc.CreateContainer(ctx, *expected.config)
+	if err != nil {
+		return "", fmt.Errorf("failed to recreate container: %w", err)
+	}
+	if err := s.dockerSvc.StartContainer(ctx, containerID); err != nil {
+		return "", fmt.Errorf("failed to start recreated container: %w", err)
+	}
+	if err := expected.persist(containerID); err != nil {
+		return "", fmt.Errorf("failed to record recreated container: %w", err)
+	}
+
+	s.logger.Info("recreated drifted container",
+		zap.String("container_name", expected.config.Name),
+		zap.String("old_container_id", expected.containerID),
+		zap.String("new_container_id", containerID))
+
+	return containerID, nil
+}
+
+func (s *stackDriftService) inspectResource(ctx context.Context, res entities.StackResource) (*dto.ResourceDrift, []expectedContainer, error) {
+	resourceDrift := &dto.ResourceDrift{
+		InfrastructureID: res.InfrastructureID,
+		ResourceType:     res.ResourceType,
+		ResourceName:     res.Infrastructure.Name,
+		Containers:       []dto.ContainerDrift{},
+	}
+
+	expected, err := s.expectedContainers(res)
+	if err != nil {
+		// The stack still references a resource whose record is gone
+		resourceDrift.Drifted = true
+		resourceDrift.Containers = append(resourceDrift.Containers, dto.ContainerDrift{
+			State: dto.DriftMissing,
+			Differences: []dto.DriftDifference{{
+				Kind:   dto.DriftMissing,
+				Field:  "record",
+				Actual: err.Error(),
+			}},
+		})
+		return resourceDrift, []expectedContainer{{}}, nil
+	}
+
+	resourceDrift.Reconcilable = len(expected) > 0
+	for _, exp := range expected {
+		if exp.config == nil {
+			resourceDrift.Reconcilable = false
+		}
+
+		containerDrift, err := s.compareContainer(ctx, exp)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(containerDrift.Differences) > 0 {
+			resourceDrift.Drifted = true
+		}
+		resourceDrift.Containers = append(resourceDrift.Containers, *containerDrift)
+	}
+
+	return resourceDrift, expected, nil
+}
+
+func (s *stackDriftService) compareContainer(ctx context.Context, exp expectedContainer) (*dto.ContainerDrift, error) {
+	drift := &dto.ContainerDrift{
+		ContainerID:   exp.containerID,
+		ContainerName: exp.name,
+		Role:          exp.role,
+	}
+
+	if exp.containerID == "" {
+		drift.State = dto.DriftMissing
+		drift.Differences = append(drift.Differences, dto.DriftDifference{Kind: dto.DriftMissing, Field: "container_id"})
+		return drift, nil
+	}
+
+	info, err := s.dockerSvc.InspectContainer(ctx, exp.containerID)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			drift.State = dto.DriftMissing
+			drift.Differences = append(drift.Differences, dto.DriftDifference{Kind: dto.DriftMissing, Expected: exp.containerID})
+			return drift, nil
+		}
+		return nil, fmt.Errorf("failed to inspect container %s: %w", exp.containerID, err)
+	}
+
+	if info.State != nil && info.State.Running {
+		drift.State = "running"
+	} else {
+		drift.State = dto.DriftStopped
+		status := ""
+		if info.State != nil {
+			status = info.State.Status
+		}
+		drift.Differences = append(drift.Differences, dto.DriftDifference{Kind: dto.DriftStopped, Expected: "running", Actual: status})
+	}
+
+	if exp.network != "" && !containerOnNetwork(info, exp.network) {
+		drift.Differences = append(drift.Differences, dto.DriftDifference{Kind: dto.DriftNetworkMissing, Expected: exp.network})
+	}
+
+	if exp.config != nil {
+		drift.Differences = append(drift.Differences, diffContainerConfig(info, *exp.config)...)
+	}
+
+	return drift, nil
+}
+
+// diffContainerConfig compares an inspected container with the spec it was created from
+func diffContainerConfig(info *types.ContainerJSON, config docker.ContainerConfig) []dto.DriftDifference {
+	var diffs []dto.DriftDifference
+
+	if info.Config != nil && info.Config.Image != config.Image {
+		diffs = append(diffs, dto.DriftDifference{Kind: dto.DriftImageMismatch, Expected: config.Image, Actual: info.Config.Image})
+	}
+
+	actualEnv := make(map[string]string)
+	if info.Config != nil {
+		for _, kv := range info.Config.Env {
+			key, value, _ := strings.Cut(kv, "=")
+			actualEnv[key] = value
+		}
+	}
+	for _, kv := range config.Env {
+		key, value, _ := strings.Cut(kv, "=")
+		actual, ok := actualEnv[key]
+		if !ok {
+			diffs = append(diffs, dto.DriftDifference{Kind: dto.DriftEnvMismatch, Field: key, Actual: "unset"})
+		} else if actual != value {
+			diffs = append(diffs, dto.DriftDifference{Kind: dto.DriftEnvMismatch, Field: key, Actual: "changed"})
+		}
+	}
+
+	for containerPort, hostPort := range config.Ports {
+		port := nat.Port(containerPort + "/tcp")
+		actual := ""
+		if info.HostConfig != nil {
+			for _, binding := range info.HostConfig.PortBindings[port] {
+				actual = binding.HostPort
+				if binding.HostPort == hostPort {
+					break
+				}
+			}
+		}
+		if actual != hostPort {
+			diffs = append(diffs, dto.DriftDifference{Kind: dto.DriftPortMismatch, Field: string(port), Expected: hostPort, Actual: actual})
+		}
+	}
+
+	for source := range config.Volumes {
+		found := false
+		for _, mount := range info.Mounts {
+			if mount.Name == source || mount.Source == source {
+				found = true
+				break
+			}
+		}
+		if !found {
+			diffs = append(diffs, dto.DriftDifference{Kind: dto.DriftVolumeMissing, Expected: source})
+		}
+	}
+
+	if config.Network != "" && !containerOnNetwork(info, config.Network) {
+		diffs = append(diffs, dto.DriftDifference{Kind: dto.DriftNetworkMissing, Expected: config.Network})
+	}
+
+	return diffs
+}
+
+func containerOnNetwork(info *types.ContainerJSON, network string) bool {
+	if info.NetworkSettings == nil {
+		return false
+	}
+	for name, endpoint := range info.NetworkSettings.Networks {
+		if name == network || (endpoint != nil && endpoint.NetworkID == network) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *stackDriftService) expectedContainers(res entities.StackResource) ([]expectedContainer, error) {
+	switch res.ResourceType {
+	case "POSTGRES_INSTANCE":
+		instance, err := s.pgRepo.FindByInfrastructureID(res.InfrastructureID)
+		if err != nil {
+			return nil, err
+		}
+		config := postgresContainerConfig(instance)
+		return []expectedContainer{{
+			containerID: instance.ContainerID,
+			name:        config.Name,
+			config:      &config,
+			persist: func(containerID string) error {
+				instance.ContainerID = containerID
+				return s.pgRepo.Update(instance)
+			},
+		}}, nil
+
+	case "NGINX_GATEWAY":
+		instance, err := s.nginxRepo.FindByInfrastructureID(res.InfrastructureID)
+		if err != nil {
+			return nil, err
+		}
+		config := nginxContainerConfig(instance)
+		return []expectedContainer{{
+			containerID: instance.ContainerID,
+			name:        config.Name,
+			config:      &config,
+			persist: func(containerID string) error {
+				instance.ContainerID = containerID
+				return s.nginxRepo.Update(instance)
+			},
+		}}, nil
+
+	case "DOCKER_SERVICE":
+		service, err := s.dockerRepo.FindByInfrastructureID(res.InfrastructureID)
+		if err != nil {
+			return nil, err
+		}
+		if len(service.Containers) == 0 {
+			config := dockerServiceContainerConfig(service)
+			return []expectedContainer{{
+				containerID: service.ContainerID,
+				name:        config.Name,
+				config:      &config,
+				persist: func(containerID string) error {
+					service.ContainerID = containerID
+					service.ContainerName = config.Name
+					service.Status = "running"
+					return s.dockerRepo.Update(service)
+				},
+			}}, nil
+		}
+
+		expected := []expectedContainer{}
+		for i := range service.Containers {
+			replica := &service.Containers[i]
+			config := dockerReplicaContainerConfig(service, replica.ContainerName)
+			expected = append(expected, expectedContainer{
+				containerID: replica.ContainerID,
+				name:        config.Name,
+				role:        "replica",
+				config:      &config,
+				persist: func(containerID string) error {
+					replica.ContainerID = containerID
+					replica.Status = "running"
+					if err := s.dockerRepo.UpdateReplica(replica); err != nil {
+						return err
+					}
+					syncPrimary(service)
+					return s.dockerRepo.Update(service)
+				},
+			})
+		}
+		return expected, nil
+
+	case "POSTGRES_CLUSTER":
+		cluster, err := s.clusterRepo.FindByInfrastructureID(res.InfrastructureID)
+		if err != nil {
+			return nil, err
+		}
+		nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+		if err != nil {
+			return nil, err
+		}
+		expected := []expectedContainer{}
+		for _, node := range nodes {
+			expected = append(expected, expectedContainer{
+				containerID: node.ContainerID,
+				name:        node.ID,
+				role:        node.Role,
+				network:     cluster.NetworkID,
+			})
+		}
+		etcdNodes, _ := s.clusterRepo.ListEtcdNodes(cluster.ID)
+		for _, node := range etcdNodes {
+			expected = append(expected, expectedContainer{
+				containerID: node.ContainerID,
+				name:        node.ID,
+				role:        "etcd",
+				network:     cluster.NetworkID,
+			})
+		}
+		return expected, nil
+
+	case "NGINX_CLUSTER":
+		cluster, err := s.nginxClusterRepo.FindByInfrastructureID(res.InfrastructureID)
+		if err != nil {
+			return nil, err
+		}
+		nodes, err := s.nginxClusterRepo.ListNodes(cluster.ID)
+		if err != nil {
+			return nil, err
+		}
+		expected := []expectedContainer{}
+		for _, node := range nodes {
+			expected = append(expected, expectedContainer{
+				containerID: node.ContainerID,
+				name:        node.Name,
+				role:        node.Role,
+				network:     cluster.NetworkID,
+			})
+		}
+		return expected, nil
+
+	case "DIND_ENVIRONMENT":
+		env, err := s.dinDRepo.FindByInfrastructureID(res.InfrastructureID)
+		if err != nil {
+			return nil, err
+		}
+		return []expectedContainer{{
+			containerID: env.ContainerID,
+			name:        env.ContainerName,
+			network:     env.NetworkID,
+		}}, nil
+	}
+
+	// POSTGRES_DATABASE lives inside its instance's container and has nothing of its own to inspect
+	return []expectedContainer{}, nil
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffContainerConfig(t *testing.T) {
+	config := docker.ContainerConfig{
+		Name:    "iaas-docker-1",
+		Image:   "shop/api:1.2",
+		Env:     []string{"PORT=8080", "DB_PASSWORD=s3cret"},
+		Ports:   map[string]string{"8080": "18080"},
+		Volumes: map[string]string{"api-data": "/data"},
+		Network: "iaas_iaas-network",
+	}
+
+	info := &types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			HostConfig: &container.HostConfig{
+				PortBindings: nat.PortMap{"8080/tcp": {{HostPort: "18080"}}},
+			},
+		},
+		Mounts: []types.MountPoint{{Name: "api-data", Destination: "/data"}},
+		Config: &container.Config{
+			Image: "shop/api:1.2",
+			Env:   []string{"PORT=8080", "DB_PASSWORD=s3cret", "PATH=/usr/bin"},
+		},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{"iaas_iaas-network": {}},
+		},
+	}
+	assert.Empty(t, diffContainerConfig(info, config))
+
+	info.Config.Image = "shop/api:1.3"
+	info.Config.Env = []string{"PORT=9090"}
+	info.HostConfig.PortBindings = nat.PortMap{}
+	info.Mounts = nil
+	info.NetworkSettings.Networks = map[string]*network.EndpointSettings{}
+
+	kinds := map[string]dto.DriftDifference{}
+	for _, diff := range diffContainerConfig(info, config) {
+		kinds[diff.Kind+":"+diff.Field] = diff
+	}
+	assert.Equal(t, "shop/api:1.3", kinds[dto.DriftImageMismatch+":"].Actual)
+	assert.Equal(t, "changed", kinds[dto.DriftEnvMismatch+":PORT"].Actual)
+	assert.Equal(t, "unset", kinds[dto.DriftEnvMismatch+":DB_PASSWORD"].Actual)
+	assert.Empty(t, kinds[dto.DriftEnvMismatch+":DB_PASSWORD"].Expected)
+	assert.Contains(t, kinds, dto.DriftPortMismatch+":8080/tcp")
+	assert.Contains(t, kinds, dto.DriftVolumeMissing+":")
+	assert.Contains(t, kinds, dto.DriftNetworkMissing+":")
+}
@@ -0,0 +1,422 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/logger"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"go.uber.org/zap"
+)
+
+const (
+	// Docker emits bursts of events when a stack starts or stops; refreshes are coalesced
+	stackHealthDebounce = 2 * time.Second
+	// Periodic sweep that catches changes no Docker event reports (Patroni, node probes)
+	stackHealthInterval = time.Minute
+)
+
+type IStackHealthService interface {
+	Start(ctx context.Context)
+	EvaluateStack(ctx context.Context, stackID string) (*dto.StackHealthInfo, error)
+	ScheduleRefreshForInfrastructure(infraID string)
+}
+
+type stackHealthService struct {
+	stackRepo        repositories.IStackRepository
+	pgRepo           repositories.IPostgreSQLRepository
+	pgDbRepo         repositories.IPostgresDatabaseRepository
+	nginxRepo        repositories.INginxRepository
+	dockerRepo       repositories.IDockerServiceRepository
+	clusterRepo      repositories.IPostgreSQLClusterRepository
+	nginxClusterRepo repositories.INginxClusterRepository
+	dinDRepo         repositories.IDinDRepository
+	dockerSvc        docker.IDockerService
+	logger           logger.ILogger
+
+	mu      sync.Mutex
+	ctx     context.Context // set by Start, guarded by mu
+	pending map[string]bool
+}
+
+func NewStackHealthService(
+	stackRepo repositories.IStackRepository,
+	pgRepo repositories.IPostgreSQLRepository,
+	pgDbRepo repositories.IPostgresDatabaseRepository,
+	nginxRepo repositories.INginxRepository,
+	dockerRepo repositories.IDockerServiceRepository,
+	clusterRepo repositories.IPostgreSQLClusterRepository,
+	nginxClusterRepo repositories.INginxClusterRepository,
+	dinDRepo repositories.IDinDRepository,
+	dockerSvc docker.IDockerService,
+	logger logger.ILogger,
+) IStackHealthService {
+	return &stackHealthService{
+		stackRepo:        stackRepo,
+		pgRepo:           pgRepo,
+		pgDbRepo:         pgDbRepo,
+		nginxRepo:        nginxRepo,
+		dockerRepo:       dockerRepo,
+		clusterRepo:      clusterRepo,
+		nginxClusterRepo: nginxClusterRepo,
+		dinDRepo:         dinDRepo,
+		dockerSvc:        dockerSvc,
+		logger:           logger,
+		ctx:              context.Background(),
+		pending:          make(map[string]bool),
+	}
+}
+
+// Start evaluates every active stack periodically until ctx is cancelled
+func (s *stackHealthService) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(stackHealthInterval)
+		defer ticker.Stop()
+
+		for {
+			s.refreshAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *stackHealthService) refreshAll(ctx context.Context) {
+	stacks, err := s.stackRepo.FindActive()
+	if err != nil {
+		s.logger.Error("failed to list stacks for health check", zap.Error(err))
+		return
+	}
+	for _, stack := range stacks {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := s.EvaluateStack(ctx, stack.ID); err != nil {
+			s.logger.Error("failed to evaluate stack health", zap.String("stack_id", stack.ID), zap.Error(err))
+		}
+	}
+}
+
+// ScheduleRefreshForInfrastructure re-evaluates the stack owning a resource shortly
+// after one of its containers changed state
+func (s *stackHealthService) ScheduleRefreshForInfrastructure(infraID string) {
+	res, err := s.stackRepo.FindResourceByInfrastructureID(infraID)
+	if err != nil {
+		// Not part of a stack
+		return
+	}
+
+	s.mu.Lock()
+	if s.pending[res.StackID] {
+		s.mu.Unlock()
+		return
+	}
+	s.pending[res.StackID] = true
+	s.mu.Unlock()
+
+	time.AfterFunc(stackHealthDebounce, func() {
+		s.mu.Lock()
+		delete(s.pending, res.StackID)
+		ctx := s.ctx
+		s.mu.Unlock()
+
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := s.EvaluateStack(ctx, res.StackID); err != nil {
+			s.logger.Error("failed to evaluate stack health", zap.String("stack_id", res.StackID), zap.Error(err))
+		}
+	})
+}
+
+// EvaluateStack computes the health of every resource in a stack from its live
+// state, rolls it up and stores the result
+func (s *stackHealthService) EvaluateStack(ctx context.Context, stackID string) (*dto.StackHealthInfo, error) {
+	stack, err := s.stackRepo.FindByID(stackID)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := s.stackRepo.FindResourcesByStackID(stackID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &dto.StackHealthInfo{
+		StackID:   stackID,
+		CheckedAt: time.Now(),
+		Resources: []dto.ResourceHealthInfo{},
+	}
+
+	healths := make([]string, 0, len(resources))
+	for _, res := range resources {
+		health, message := s.resourceHealth(ctx, res)
+		healths = append(healths, health)
+
+		if health != res.Health || message != res.HealthMessage {
+			s.stackRepo.UpdateResourceHealth(res.ID, health, message)
+		}
+
+		info.Resources = append(info.Resources, dto.ResourceHealthInfo{
+			InfrastructureID: res.InfrastructureID,
+			ResourceType:     res.ResourceType,
+			ResourceName:     res.Infrastructure.Name,
+			Health:           health,
+			Message:          message,
+		})
+	}
+
+	info.Health = rollupStackHealth(healths)
+	if err := s.stackRepo.UpdateHealth(stackID, entities.StackHealth(info.Health), info.CheckedAt); err != nil {
+		return nil, fmt.Errorf("failed to store stack health: %w", err)
+	}
+
+	if string(stack.Health) != info.Health {
+		s.logger.Info("stack health changed",
+			zap.String("stack_id", stackID),
+			zap.String("from", string(stack.Health)),
+			zap.String("to", info.Health))
+	}
+
+	return info, nil
+}
+
+// rollupStackHealth is healthy when every resource is healthy, down when every
+// resource is down and degraded otherwise
+func rollupStackHealth(healths []string) string {
+	if len(healths) == 0 {
+		return dto.StackHealthUnknown
+	}
+
+	healthy, down := 0, 0
+	for _, health := range healths {
+		switch health {
+		case dto.StackHealthHealthy:
+			healthy++
+		case dto.StackHealthDown:
+			down++
+		}
+	}
+
+	switch {
+	case healthy == len(healths):
+		return dto.StackHealthHealthy
+	case down == len(healths):
+		return dto.StackHealthDown
+	default:
+		return dto.StackHealthDegraded
+	}
+}
+
+// countHealth turns the number of working members of a replicated resource into a health
+func countHealth(up, total int, what string) (string, string) {
+	message := fmt.Sprintf("%d/%d %s healthy", up, total, what)
+	switch {
+	case total == 0 || up == 0:
+		return dto.StackHealthDown, message
+	case up < total:
+		return dto.StackHealthDegraded, message
+	default:
+		return dto.StackHealthHealthy, ""
+	}
+}
+
+func (s *stackHealthService) resourceHealth(ctx context.Context, res entities.StackResource) (string, string) {
+	switch res.ResourceType {
+	case "POSTGRES_INSTANCE":
+		instance, err := s.pgRepo.FindByInfrastructureID(res.InfrastructureID)
+		if err != nil {
+			return dto.StackHealthDown, "instance record not found"
+		}
+		return s.containerHealth(ctx, instance.ContainerID)
+
+	case "POSTGRES_DATABASE":
+		// Stack resources of this type reference the database record, which lives in its instance
+		db, err := s.pgDbRepo.FindByID(res.InfrastructureID)
+		if err != nil {
+			return dto.StackHealthDown, "database record not found"
+		}
+		instance, err := s.pgRepo.FindByID(db.InstanceID)
+		if err != nil {
+			return dto.StackHealthDown, "database instance not found"
+		}
+		return s.containerHealth(ctx, instance.ContainerID)
+
+	case "NGINX_GATEWAY":
+		instance, err := s.nginxRepo.FindByInfrastructureID(res.InfrastructureID)
+		if err != nil {
+			return dto.StackHealthDown, "gateway record not found"
+		}
+		return s.containerHealth(ctx, instance.ContainerID)
+
+	case "DOCKER_SERVICE":
+		service, err := s.dockerRepo.FindByInfrastructureID(res.InfrastructureID)
+		if err != nil {
+			return dto.StackHealthDown, "service record not found"
+		}
+		return s.dockerServiceHealth(ctx, service)
+
+	case "DIND_ENVIRONMENT":
+		env, err := s.dinDRepo.FindByInfrastructureID(res.InfrastructureID)
+		if err != nil {
+			return dto.StackHealthDown, "environment record not found"
+		}
+		if env.Status != "running" {
+			return dto.StackHealthDown, fmt.Sprintf("environment is %s", env.Status)
+		}
+		return s.containerHealth(ctx, env.ContainerID)
+
+	case "NGINX_CLUSTER":
+		return s.nginxClusterHealth(ctx, res.InfrastructureID)
+
+	case "POSTGRES_CLUSTER":
+		return s.postgresClusterHealth(ctx, res.InfrastructureID)
+	}
+
+	return dto.StackHealthUnknown, fmt.Sprintf("health of %s resources is not tracked", res.ResourceType)
+}
+
+// containerHealth maps a container's state, including its Docker health check, to a health
+func (s *stackHealthService) containerHealth(ctx context.Context, containerID string) (string, string) {
+	if containerID == "" {
+		return dto.StackHealthDown, "container not created"
+	}
+
+	info, err := s.dockerSvc.InspectContainer(ctx, containerID)
+	if err != nil || info.State == nil {
+		return dto.StackHealthDown, "container not found"
+	}
+	if !info.State.Running {
+		return dto.StackHealthDown, fmt.Sprintf("container is %s", info.State.Status)
+	}
+
+	if info.State.Health != nil {
+		switch info.State.Health.Status {
+		case "unhealthy":
+			return dto.StackHealthDown, "health check failing"
+		case "starting":
+			return dto.StackHealthDegraded, "health check starting"
+		}
+	}
+
+	return dto.StackHealthHealthy, ""
+}
+
+// dockerServiceHealth rolls up every replica of the service, counting missing replicas as down
+func (s *stackHealthService) dockerServiceHealth(ctx context.Context, service *entities.DockerService) (string, string) {
+	replicas := dockerServiceReplicas(service)
+	if len(replicas) == 1 && service.Replicas <= 1 {
+		return s.replicaHealth(ctx, replicas[0])
+	}
+
+	total := len(replicas)
+	if service.Replicas > total {
+		total = service.Replicas
+	}
+	up := 0
+	for _, replica := range replicas {
+		if health, _ := s.replicaHealth(ctx, replica); health == dto.StackHealthHealthy {
+			up++
+		}
+	}
+	return countHealth(up, total, "replicas")
+}
+
+// replicaHealth is the health of a replica's container. HTTP and TCP checks are probed from
+// outside the container, so their result is only on the replica record.
+func (s *stackHealthService) replicaHealth(ctx context.Context, replica entities.DockerServiceReplica) (string, string) {
+	health, message := s.containerHealth(ctx, replica.ContainerID)
+	if health == dto.StackHealthHealthy && replica.Health == entities.DockerHealthUnhealthy {
+		return dto.StackHealthDown, "health check failing"
+	}
+	return health, message
+}
+
+func (s *stackHealthService) nginxClusterHealth(ctx context.Context, infraID string) (string, string) {
+	cluster, err := s.nginxClusterRepo.FindByInfrastructureID(infraID)
+	if err != nil {
+		return dto.StackHealthDown, "cluster record not found"
+	}
+	nodes, err := s.nginxClusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return dto.StackHealthDown, "failed to list cluster nodes"
+	}
+
+	up := 0
+	for _, node := range nodes {
+		if health, _ := s.containerHealth(ctx, node.ContainerID); health == dto.StackHealthHealthy && node.IsHealthy {
+			up++
+		}
+	}
+	return countHealth(up, len(nodes), "nodes")
+}
+
+// patroniMember is the subset of Patroni's /patroni response used for health
+type patroniMember struct {
+	State string `json:"state"`
+	Role  string `json:"role"`
+}
+
+func (s *stackHealthService) postgresClusterHealth(ctx context.Context, infraID string) (string, string) {
+	cluster, err := s.clusterRepo.FindByInfrastructureID(infraID)
+	if err != nil {
+		return dto.StackHealthDown, "cluster record not found"
+	}
+	nodes, err := s.clusterRepo.ListNodes(cluster.ID)
+	if err != nil {
+		return dto.StackHealthDown, "failed to list cluster nodes"
+	}
+
+	members, running, hasLeader := 0, 0, false
+	for _, node := range nodes {
+		if node.Role != "primary" && node.Role != "replica" {
+			continue
+		}
+		members++
+
+		if health, _ := s.containerHealth(ctx, node.ContainerID); health != dto.StackHealthHealthy {
+			continue
+		}
+		output, err := s.dockerSvc.ExecCommand(ctx, node.ContainerID, []string{"curl", "-s", "http://localhost:8008/patroni"})
+		if err != nil {
+			continue
+		}
+		var member patroniMember
+		if err := json.Unmarshal([]byte(output), &member); err != nil || member.State != "running" {
+			continue
+		}
+		running++
+		if member.Role == "master" || member.Role == "primary" || member.Role == "leader" {
+			hasLeader = true
+		}
+	}
+
+	if members > 0 && !hasLeader {
+		return dto.StackHealthDown, fmt.Sprintf("no Patroni leader, %d/%d members running", running, members)
+	}
+
+	etcdNodes, _ := s.clusterRepo.ListEtcdNodes(cluster.ID)
+	etcdUp := 0
+	for _, node := range etcdNodes {
+		if health, _ := s.containerHealth(ctx, node.ContainerID); health == dto.StackHealthHealthy {
+			etcdUp++
+		}
+	}
+	if len(etcdNodes) > 0 && etcdUp <= len(etcdNodes)/2 {
+		return dto.StackHealthDegraded, fmt.Sprintf("etcd quorum lost, %d/%d members running", etcdUp, len(etcdNodes))
+	}
+
+	return countHealth(running, members, "Patroni members")
+}
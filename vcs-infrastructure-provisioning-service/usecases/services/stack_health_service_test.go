@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/infrastructures/docker"
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollupStackHealth(t *testing.T) {
+	assert.Equal(t, dto.StackHealthUnknown, rollupStackHealth(nil))
+	assert.Equal(t, dto.StackHealthHealthy, rollupStackHealth([]string{dto.StackHealthHealthy, dto.StackHealthHealthy}))
+	assert.Equal(t, dto.StackHealthDown, rollupStackHealth([]string{dto.StackHealthDown, dto.StackHealthDown}))
+	assert.Equal(t, dto.StackHealthDegraded, rollupStackHealth([]string{dto.StackHealthHealthy, dto.StackHealthDown}))
+	assert.Equal(t, dto.StackHealthDegraded, rollupStackHealth([]string{dto.StackHealthHealthy, dto.StackHealthUnknown}))
+}
+
+func TestCountHealth(t *testing.T) {
+	health, message := countHealth(3, 3, "nodes")
+	assert.Equal(t, dto.StackHealthHealthy, health)
+	assert.Empty(t, message)
+
+	health, message = countHealth(1, 3, "nodes")
+	assert.Equal(t, dto.StackHealthDegraded, health)
+	assert.Equal(t, "1/3 nodes healthy", message)
+
+	health, _ = countHealth(0, 3, "nodes")
+	assert.Equal(t, dto.StackHealthDown, health)
+}
+
+// runningDocker reports the listed containers as running and every other one as exited;
+// other calls panic
+type runningDocker struct {
+	docker.IDockerService
+	running map[string]bool
+}
+
+func (d runningDocker) InspectContainer(ctx context.Context, containerID string) (*types.ContainerJSON, error) {
+	state := &types.ContainerState{Running: d.running[containerID], Status: "exited"}
+	return &types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{State: state}}, nil
+}
+
+func TestDockerServiceHealthRollsUpReplicas(t *testing.T) {
+	svc := &stackHealthService{dockerSvc: runningDocker{running: map[string]bool{"c1": true, "c2": true}}}
+	service := &entities.DockerService{ID: "svc-1", ContainerID: "c1", Replicas: 3, Containers: []entities.DockerServiceReplica{
+		{ContainerID: "c1", Health: entities.DockerHealthHealthy},
+		{ContainerID: "c2", Health: entities.DockerHealthUnhealthy},
+		{ContainerID: "c3"},
+	}}
+
+	// The first container being fine says nothing about the others
+	health, message := svc.dockerServiceHealth(context.Background(), service)
+	assert.Equal(t, dto.StackHealthDegraded, health)
+	assert.Equal(t, "1/3 replicas healthy", message)
+
+	// A replica the service is still missing counts as down
+	service.Containers = service.Containers[:1]
+	health, message = svc.dockerServiceHealth(context.Background(), service)
+	assert.Equal(t, dto.StackHealthDegraded, health)
+	assert.Equal(t, "1/3 replicas healthy", message)
+
+	// A single replica keeps the container's own message
+	service.Replicas = 1
+	service.Containers = []entities.DockerServiceReplica{{ContainerID: "c3"}}
+	health, message = svc.dockerServiceHealth(context.Background(), service)
+	assert.Equal(t, dto.StackHealthDown, health)
+	assert.Equal(t, "container is exited", message)
+}
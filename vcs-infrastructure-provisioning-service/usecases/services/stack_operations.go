@@ -0,0 +1,601 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/google/uuid"
+)
+
+const (
+	stackOperationWorkers   = 4
+	stackOperationQueueSize = 100
+)
+
+// StackOperationBroadcaster pushes stack operation progress to connected clients
+type StackOperationBroadcaster interface {
+	BroadcastStackOperation(update dto.StackOperationUpdate)
+}
+
+// stackOperationRequest is the input persisted with an operation so a worker can
+// run it, or resume it after a restart
+type stackOperationRequest struct {
+	Resources []dto.CreateStackResourceInput `json:"resources,omitempty"`
+}
+
+func (s *stackService) SetWebSocketHandler(handler StackOperationBroadcaster) {
+	s.broadcaster = handler
+}
+
+// StartOperationWorker starts the workers that execute queued stack operations and
+// requeues operations that were pending or interrupted when the service last stopped
+func (s *stackService) StartOperationWorker(ctx context.Context) error {
+	for i := 0; i < stackOperationWorkers; i++ {
+		go s.operationWorker(ctx)
+	}
+
+	operations, err := s.stackRepo.FindOperationsByStatus([]string{
+		entities.StackOperationPending,
+		entities.StackOperationInProgress,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load unfinished stack operations: %w", err)
+	}
+	for _, operation := range operations {
+		s.enqueueOperation(operation.ID)
+	}
+	return nil
+}
+
+func (s *stackService) enqueueOperation(operationID string) {
+	go func() {
+		s.operationQueue <- operationID
+	}()
+}
+
+func (s *stackService) operationWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case operationID := <-s.operationQueue:
+			s.runOperation(ctx, operationID)
+		}
+	}
+}
+
+// newStackOperation records a pending operation and queues it for the workers
+func (s *stackService) newStackOperation(stackID, userID, operationType string, request stackOperationRequest, steps []dto.StackOperationStep) (*dto.StackOperationInfo, error) {
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode operation request: %w", err)
+	}
+	details := &dto.StackOperationDetails{TotalSteps: len(steps), Steps: steps}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode operation details: %w", err)
+	}
+
+	operation := &entities.StackOperation{
+		ID:            uuid.New().String(),
+		StackID:       stackID,
+		OperationType: operationType,
+		Status:        entities.StackOperationPending,
+		UserID:        userID,
+		Details:       string(detailsJSON),
+		Request:       string(requestJSON),
+	}
+	active, err := s.stackRepo.CreateOperationIfIdle(operation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record stack operation: %w", err)
+	}
+	if active != nil {
+		return nil, fmt.Errorf("stack already has a %s operation in progress (%s)", active.OperationType, active.ID)
+	}
+
+	s.publishOperation(operation, details)
+	s.enqueueOperation(operation.ID)
+
+	info := toStackOperationInfo(*operation)
+	return &info, nil
+}
+
+func (s *stackService) ListOperations(ctx context.Context, stackID string) ([]dto.StackOperationInfo, error) {
+	operations, err := s.stackRepo.FindOperationsByStackID(stackID)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []dto.StackOperationInfo{}
+	for _, operation := range operations {
+		infos = append(infos, toStackOperationInfo(operation))
+	}
+	return infos, nil
+}
+
+func (s *stackService) GetOperation(ctx context.Context, stackID, operationID string) (*dto.StackOperationInfo, error) {
+	operation, err := s.stackRepo.FindOperationByID(operationID)
+	if err != nil {
+		return nil, err
+	}
+	if operation.StackID != stackID {
+		return nil, fmt.Errorf("operation %s does not belong to stack %s", operationID, stackID)
+	}
+
+	info := toStackOperationInfo(*operation)
+	return &info, nil
+}
+
+// CancelOperation cancels a queued operation immediately. A running operation is
+// signalled and stops before its next step; the step in flight is allowed to finish.
+func (s *stackService) CancelOperation(ctx context.Context, stackID, operationID string) (*dto.StackOperationInfo, error) {
+	operation, err := s.stackRepo.FindOperationByID(operationID)
+	if err != nil {
+		return nil, err
+	}
+	if operation.StackID != stackID {
+		return nil, fmt.Errorf("operation %s does not belong to stack %s", operationID, stackID)
+	}
+
+	if operation.Status == entities.StackOperationPending {
+		// A worker may have loaded the operation already; whichever moves it out of
+		// pending first wins
+		cancelled, err := s.stackRepo.TransitionOperation(operationID, entities.StackOperationPending, entities.StackOperationCancelled)
+		if err != nil {
+			return nil, err
+		}
+		if !cancelled {
+			if operation, err = s.stackRepo.FindOperationByID(operationID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch operation.Status {
+	case entities.StackOperationPending:
+		// A worker that registered but has not started yet gives up once it sees the status
+		s.operationMu.Lock()
+		if cancel, ok := s.operationCancels[operationID]; ok {
+			cancel()
+		}
+		s.operationMu.Unlock()
+
+		details, err := parseOperationDetails(operation.Details)
+		if err != nil {
+			return nil, err
+		}
+		for i := range details.Steps {
+			details.Steps[i].Status = dto.StepCancelled
+		}
+		s.finishOperation(operation, details, entities.StackOperationCancelled, "cancelled before it started")
+		s.markStackCancelled(operation)
+	case entities.StackOperationInProgress:
+		s.operationMu.Lock()
+		cancel, ok := s.operationCancels[operationID]
+		s.operationMu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("operation %s is not running on this instance", operationID)
+		}
+		cancel()
+	default:
+		return nil, fmt.Errorf("operation %s already finished with status %s", operationID, operation.Status)
+	}
+
+	info := toStackOperationInfo(*operation)
+	return &info, nil
+}
+
+func (s *stackService) runOperation(parent context.Context, operationID string) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	s.operationMu.Lock()
+	// Queued twice, e.g. on creation and by the startup requeue: another worker runs it
+	if _, running := s.operationCancels[operationID]; running {
+		s.operationMu.Unlock()
+		return
+	}
+	s.operationCancels[operationID] = cancel
+	s.operationMu.Unlock()
+	defer func() {
+		s.operationMu.Lock()
+		delete(s.operationCancels, operationID)
+		s.operationMu.Unlock()
+	}()
+
+	operation, err := s.stackRepo.FindOperationByID(operationID)
+	if err != nil {
+		return
+	}
+	// Cancelled or finished while waiting in the queue
+	if operation.Status != entities.StackOperationPending && operation.Status != entities.StackOperationInProgress {
+		return
+	}
+	// Claim a queued operation; a cancel may have landed since it was loaded
+	if operation.Status == entities.StackOperationPending {
+		started, err := s.stackRepo.TransitionOperation(operationID, entities.StackOperationPending, entities.StackOperationInProgress)
+		if err != nil || !started {
+			return
+		}
+		operation.Status = entities.StackOperationInProgress
+	}
+
+	details, err := parseOperationDetails(operation.Details)
+	if err != nil {
+		s.finishOperation(operation, &dto.StackOperationDetails{}, entities.StackOperationFailed, err.Error())
+		return
+	}
+	var request stackOperationRequest
+	if err := json.Unmarshal([]byte(operation.Request), &request); err != nil {
+		s.finishOperation(operation, details, entities.StackOperationFailed, fmt.Sprintf("invalid operation request: %v", err))
+		return
+	}
+
+	// A step that was running when the service stopped is retried. Its resource
+	// may already exist, so creates look it up before creating it again.
+	interrupted := make(map[int]bool)
+	for i := range details.Steps {
+		if details.Steps[i].Status == dto.StepInProgress {
+			details.Steps[i].Status = dto.StepPending
+			interrupted[i] = true
+		}
+	}
+	operation.Status = entities.StackOperationInProgress
+	s.saveOperation(operation, details)
+
+	var runErr error
+	switch operation.OperationType {
+	case "CREATE":
+		runErr = s.runCreateOperation(ctx, operation, details, request, interrupted)
+	case "DELETE":
+		runErr = s.runDeleteOperation(ctx, operation, details)
+	case "RESTART":
+		runErr = s.runRestartOperation(ctx, operation, details)
+	default:
+		runErr = fmt.Errorf("unsupported operation type %s", operation.OperationType)
+	}
+
+	if ctx.Err() != nil && parent.Err() == nil {
+		for i := range details.Steps {
+			if details.Steps[i].Status == dto.StepPending {
+				details.Steps[i].Status = dto.StepCancelled
+			}
+		}
+		s.finishOperation(operation, details, entities.StackOperationCancelled, "cancelled by user")
+		s.markStackCancelled(operation)
+		return
+	}
+	if parent.Err() != nil {
+		// Shutting down: leave the operation in progress so it resumes on the next start
+		return
+	}
+	if runErr != nil {
+		s.finishOperation(operation, details, entities.StackOperationFailed, runErr.Error())
+		return
+	}
+	s.finishOperation(operation, details, entities.StackOperationCompleted, "")
+}
+
+func (s *stackService) runCreateOperation(ctx context.Context, operation *entities.StackOperation, details *dto.StackOperationDetails, request stackOperationRequest, interrupted map[int]bool) error {
+	stack, err := s.stackRepo.FindByID(operation.StackID)
+	if err != nil {
+		return err
+	}
+
+	created := make(map[string]createdStackResource) // name -> created resource
+	for _, step := range details.Steps {
+		if step.Status == dto.StepCompleted {
+			created[step.ResourceName] = createdStackResource{resourceType: step.ResourceType, infraID: step.InfrastructureID}
+		}
+	}
+	resolve := s.newStackOutputResolver(ctx, created)
+
+	for i, resInput := range request.Resources {
+		if i >= len(details.Steps) || details.Steps[i].Status == dto.StepCompleted {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var infraID string
+		var err error
+		if interrupted[i] {
+			infraID, err = s.findCreatedResource(operation.UserID, stack.ID, resInput, details.Steps[i].StartedAt, created)
+		}
+		s.startStep(operation, details, i)
+		switch {
+		case err != nil:
+		case infraID != "":
+			err = s.ensureStackResourceLink(stack.ID, infraID, resInput)
+		default:
+			infraID, err = s.createResource(ctx, operation.UserID, stack.ID, resInput, created, resolve)
+			if err == nil {
+				err = s.linkStackResource(stack.ID, infraID, resInput)
+			}
+		}
+		if err != nil {
+			s.failStep(operation, details, i, err)
+			stack.Status = entities.StackStatusFailed
+			s.stackRepo.Update(stack)
+			return fmt.Errorf("failed to create resource %s: %w", resInput.Name, err)
+		}
+
+		created[resInput.Name] = createdStackResource{resourceType: resInput.Type, infraID: infraID}
+		details.Steps[i].InfrastructureID = infraID
+		s.completeStep(operation, details, i)
+	}
+
+	stack.Status = entities.StackStatusRunning
+	s.stackRepo.Update(stack)
+	return nil
+}
+
+// stackResourceInfraTypes maps stack resource types to the infrastructure records
+// their create calls write
+var stackResourceInfraTypes = map[string]entities.InfrastructureType{
+	"NGINX_GATEWAY":     entities.TypeNginx,
+	"NGINX_CLUSTER":     entities.TypeNginxCluster,
+	"POSTGRES_INSTANCE": entities.TypePostgreSQLSingle,
+	"POSTGRES_CLUSTER":  entities.TypePostgreSQLCluster,
+	"DOCKER_SERVICE":    entities.TypeDockerService,
+	"DIND_ENVIRONMENT":  entities.TypeDinD,
+}
+
+// findCreatedResource looks for a resource that an interrupted create step already
+// made, so resuming the operation does not create it twice. It returns an empty ID
+// when the step has to run again.
+func (s *stackService) findCreatedResource(userID, stackID string, resInput dto.CreateStackResourceInput, startedAt *time.Time, created map[string]createdStackResource) (string, error) {
+	if resInput.Type == "POSTGRES_DATABASE" {
+		if len(resInput.DependsOn) == 0 {
+			return "", nil
+		}
+		dep, ok := created[resInput.DependsOn[0]]
+		if !ok {
+			return "", nil
+		}
+		instance, err := s.pgRepo.FindByInfrastructureID(dep.infraID)
+		if err != nil {
+			return "", nil
+		}
+		database, err := s.pgDbRepo.FindByDBName(instance.ID, resInput.Name)
+		if err != nil {
+			return "", nil
+		}
+		return database.ID, nil
+	}
+
+	infraType, ok := stackResourceInfraTypes[resInput.Type]
+	if !ok {
+		return "", nil
+	}
+	infras, err := s.infraRepo.FindByUserID(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up existing resources: %w", err)
+	}
+	for _, infra := range infras {
+		if infra.Name != resInput.Name || infra.Type != infraType {
+			continue
+		}
+		if infra.Status == entities.StatusDeleting || infra.Status == entities.StatusDeleted {
+			continue
+		}
+		// Older resources with the same name were not made by this step
+		if startedAt != nil && infra.CreatedAt.Before(startedAt.Add(-time.Second)) {
+			continue
+		}
+		return infra.ID, nil
+	}
+	return "", nil
+}
+
+// ensureStackResourceLink links a resource found on resume unless the interrupted
+// step already linked it
+func (s *stackService) ensureStackResourceLink(stackID, infraID string, resInput dto.CreateStackResourceInput) error {
+	if link, err := s.stackRepo.FindResourceByInfrastructureID(infraID); err == nil && link.StackID == stackID {
+		return nil
+	}
+	return s.linkStackResource(stackID, infraID, resInput)
+}
+
+func (s *stackService) linkStackResource(stackID, infraID string, resInput dto.CreateStackResourceInput) error {
+	dependsOnJSON, _ := json.Marshal(resInput.DependsOn)
+	stackResource := &entities.StackResource{
+		ID:               uuid.New().String(),
+		StackID:          stackID,
+		InfrastructureID: infraID,
+		ResourceType:     resInput.Type,
+		Role:             resInput.Role,
+		DependsOn:        string(dependsOnJSON),
+		Order:            resInput.Order,
+	}
+	if err := s.stackRepo.CreateResource(stackResource); err != nil {
+		return fmt.Errorf("failed to link resource: %w", err)
+	}
+	return nil
+}
+
+func (s *stackService) runDeleteOperation(ctx context.Context, operation *entities.StackOperation, details *dto.StackOperationDetails) error {
+	stack, err := s.stackRepo.FindByID(operation.StackID)
+	if err != nil {
+		return err
+	}
+	stack.Status = entities.StackStatusDeleting
+	s.stackRepo.Update(stack)
+
+	resources, _ := s.stackRepo.FindResourcesByStackID(stack.ID)
+	links := make(map[string]string, len(resources)) // infra ID -> stack resource ID
+	for _, res := range resources {
+		links[res.InfrastructureID] = res.ID
+	}
+
+	failed := 0
+	for i, step := range details.Steps {
+		if step.Status == dto.StepCompleted {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		s.startStep(operation, details, i)
+		// Keep deleting the remaining resources; failed ones stay linked so the delete can be retried
+		if err := s.deleteResource(ctx, step.ResourceType, step.InfrastructureID); err != nil {
+			s.failStep(operation, details, i, err)
+			failed++
+			continue
+		}
+		if linkID, ok := links[step.InfrastructureID]; ok {
+			s.stackRepo.DeleteResource(linkID)
+		}
+		s.completeStep(operation, details, i)
+	}
+
+	if failed > 0 {
+		stack.Status = entities.StackStatusFailed
+		s.stackRepo.Update(stack)
+		return fmt.Errorf("%d of %d resources failed to delete", failed, len(details.Steps))
+	}
+
+	// Mark stack as deleted (don't actually delete the record)
+	stack.Status = entities.StackStatusDeleted
+	s.stackRepo.Update(stack)
+	return nil
+}
+
+func (s *stackService) runRestartOperation(ctx context.Context, operation *entities.StackOperation, details *dto.StackOperationDetails) error {
+	for i, step := range details.Steps {
+		if step.Status == dto.StepCompleted {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		s.startStep(operation, details, i)
+		res := entities.StackResource{ResourceType: step.ResourceType, InfrastructureID: step.InfrastructureID}
+		var err error
+		if step.Action == "stop" {
+			err = s.stopResource(ctx, res)
+		} else {
+			err = s.startResource(ctx, res)
+		}
+		if err != nil {
+			s.failStep(operation, details, i, err)
+			return fmt.Errorf("failed to %s %s %s: %w", step.Action, step.ResourceType, step.InfrastructureID, err)
+		}
+		s.completeStep(operation, details, i)
+	}
+
+	if stack, err := s.stackRepo.FindByID(operation.StackID); err == nil {
+		stack.Status = entities.StackStatusRunning
+		s.stackRepo.Update(stack)
+	}
+	return nil
+}
+
+// markStackCancelled leaves a stack whose create or delete was cancelled half way
+// in a failed state so it can be deleted or retried
+func (s *stackService) markStackCancelled(operation *entities.StackOperation) {
+	if operation.OperationType != "CREATE" && operation.OperationType != "DELETE" {
+		return
+	}
+	if stack, err := s.stackRepo.FindByID(operation.StackID); err == nil {
+		stack.Status = entities.StackStatusFailed
+		s.stackRepo.Update(stack)
+	}
+}
+
+func (s *stackService) startStep(operation *entities.StackOperation, details *dto.StackOperationDetails, i int) {
+	now := time.Now()
+	details.Steps[i].Status = dto.StepInProgress
+	details.Steps[i].StartedAt = &now
+	details.Steps[i].Error = ""
+	s.saveOperation(operation, details)
+}
+
+func (s *stackService) completeStep(operation *entities.StackOperation, details *dto.StackOperationDetails, i int) {
+	now := time.Now()
+	details.Steps[i].Status = dto.StepCompleted
+	details.Steps[i].CompletedAt = &now
+	s.saveOperation(operation, details)
+}
+
+func (s *stackService) failStep(operation *entities.StackOperation, details *dto.StackOperationDetails, i int, err error) {
+	now := time.Now()
+	details.Steps[i].Status = dto.StepFailed
+	details.Steps[i].Error = err.Error()
+	details.Steps[i].CompletedAt = &now
+	s.saveOperation(operation, details)
+}
+
+func (s *stackService) finishOperation(operation *entities.StackOperation, details *dto.StackOperationDetails, status, errMsg string) {
+	now := time.Now()
+	operation.Status = status
+	operation.ErrorMessage = errMsg
+	operation.CompletedAt = &now
+	// The request may carry rendered secrets and is only needed while the operation can resume
+	operation.Request = "{}"
+	s.saveOperation(operation, details)
+}
+
+func (s *stackService) saveOperation(operation *entities.StackOperation, details *dto.StackOperationDetails) {
+	details.TotalSteps = len(details.Steps)
+	details.CompletedSteps = 0
+	for _, step := range details.Steps {
+		if step.Status == dto.StepCompleted {
+			details.CompletedSteps++
+		}
+	}
+	details.Progress = 100
+	if details.TotalSteps > 0 {
+		details.Progress = details.CompletedSteps * 100 / details.TotalSteps
+	}
+
+	detailsJSON, _ := json.Marshal(details)
+	operation.Details = string(detailsJSON)
+	s.stackRepo.UpdateOperation(operation)
+	s.publishOperation(operation, details)
+}
+
+func (s *stackService) publishOperation(operation *entities.StackOperation, details *dto.StackOperationDetails) {
+	if s.broadcaster == nil {
+		return
+	}
+	info := toStackOperationInfo(*operation)
+	info.Details = details
+	s.broadcaster.BroadcastStackOperation(dto.StackOperationUpdate{
+		Type:      "stack_operation",
+		Operation: info,
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+}
+
+func parseOperationDetails(raw string) (*dto.StackOperationDetails, error) {
+	details := &dto.StackOperationDetails{}
+	if err := json.Unmarshal([]byte(raw), details); err != nil {
+		return nil, fmt.Errorf("invalid operation details: %w", err)
+	}
+	return details, nil
+}
+
+func toStackOperationInfo(operation entities.StackOperation) dto.StackOperationInfo {
+	info := dto.StackOperationInfo{
+		ID:            operation.ID,
+		StackID:       operation.StackID,
+		OperationType: operation.OperationType,
+		Status:        operation.Status,
+		UserID:        operation.UserID,
+		StartedAt:     operation.StartedAt,
+		CompletedAt:   operation.CompletedAt,
+		ErrorMessage:  operation.ErrorMessage,
+	}
+	// Details that fail to parse are left out rather than failing the listing
+	if details, err := parseOperationDetails(operation.Details); err == nil {
+		info.Details = details
+	}
+	return info
+}
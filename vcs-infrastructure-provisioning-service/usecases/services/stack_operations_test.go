@@ -0,0 +1,448 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// memoryStackRepo keeps stacks, links and operations in memory; other calls panic
+type memoryStackRepo struct {
+	repositories.IStackRepository
+
+	mu         sync.Mutex
+	stacks     map[string]*entities.Stack
+	resources  map[string]*entities.StackResource
+	operations map[string]*entities.StackOperation
+}
+
+func newMemoryStackRepo(stacks ...*entities.Stack) *memoryStackRepo {
+	repo := &memoryStackRepo{
+		stacks:     map[string]*entities.Stack{},
+		resources:  map[string]*entities.StackResource{},
+		operations: map[string]*entities.StackOperation{},
+	}
+	for _, stack := range stacks {
+		repo.stacks[stack.ID] = stack
+	}
+	return repo
+}
+
+func (r *memoryStackRepo) FindByID(id string) (*entities.Stack, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stack, ok := r.stacks[id]; ok {
+		copied := *stack
+		return &copied, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryStackRepo) Update(stack *entities.Stack) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *stack
+	r.stacks[stack.ID] = &copied
+	return nil
+}
+
+func (r *memoryStackRepo) CreateResource(resource *entities.StackResource) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *resource
+	r.resources[resource.ID] = &copied
+	return nil
+}
+
+func (r *memoryStackRepo) FindResourceByInfrastructureID(infraID string) (*entities.StackResource, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, resource := range r.resources {
+		if resource.InfrastructureID == infraID {
+			copied := *resource
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryStackRepo) CreateOperationIfIdle(operation *entities.StackOperation) (*entities.StackOperation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.operations {
+		if existing.StackID == operation.StackID &&
+			(existing.Status == entities.StackOperationPending || existing.Status == entities.StackOperationInProgress) {
+			copied := *existing
+			return &copied, nil
+		}
+	}
+	copied := *operation
+	r.operations[operation.ID] = &copied
+	return nil, nil
+}
+
+func (r *memoryStackRepo) FindOperationByID(id string) (*entities.StackOperation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if operation, ok := r.operations[id]; ok {
+		copied := *operation
+		return &copied, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryStackRepo) FindOperationsByStatus(statuses []string) ([]entities.StackOperation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var operations []entities.StackOperation
+	for _, operation := range r.operations {
+		for _, status := range statuses {
+			if operation.Status == status {
+				operations = append(operations, *operation)
+			}
+		}
+	}
+	return operations, nil
+}
+
+func (r *memoryStackRepo) UpdateOperation(operation *entities.StackOperation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *operation
+	r.operations[operation.ID] = &copied
+	return nil
+}
+
+func (r *memoryStackRepo) TransitionOperation(id, from, to string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	operation, ok := r.operations[id]
+	if !ok || operation.Status != from {
+		return false, nil
+	}
+	operation.Status = to
+	return true, nil
+}
+
+// cancelOnLoadRepo runs cancel the first time an operation is loaded, after the copy
+// handed out is taken, like a cancel landing just after a worker read the row
+type cancelOnLoadRepo struct {
+	*memoryStackRepo
+	loaded atomic.Bool
+	cancel func()
+}
+
+func (r *cancelOnLoadRepo) FindOperationByID(id string) (*entities.StackOperation, error) {
+	operation, err := r.memoryStackRepo.FindOperationByID(id)
+	if r.loaded.CompareAndSwap(false, true) {
+		r.cancel()
+	}
+	return operation, err
+}
+
+// memoryInfraRepo lists a fixed set of infrastructure records; other calls panic
+type memoryInfraRepo struct {
+	repositories.IInfrastructureRepository
+	infras []*entities.Infrastructure
+}
+
+func (r *memoryInfraRepo) FindByID(id string) (*entities.Infrastructure, error) {
+	for _, infra := range r.infras {
+		if infra.ID == id {
+			return infra, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryInfraRepo) FindByUserID(userID string) ([]*entities.Infrastructure, error) {
+	var infras []*entities.Infrastructure
+	for _, infra := range r.infras {
+		if infra.UserID == userID {
+			infras = append(infras, infra)
+		}
+	}
+	return infras, nil
+}
+
+// recordingDockerServices creates Docker services by name and remembers each call
+type recordingDockerServices struct {
+	IDockerServiceService
+
+	mu      sync.Mutex
+	created []string
+	release chan struct{} // when set, creates wait for it
+}
+
+func (s *recordingDockerServices) CreateDockerService(ctx context.Context, userID string, req dto.CreateDockerServiceRequest) (*dto.DockerServiceInfo, error) {
+	if s.release != nil {
+		<-s.release
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.created = append(s.created, req.Name)
+	return &dto.DockerServiceInfo{InfrastructureID: "infra-" + req.Name}, nil
+}
+
+func (s *recordingDockerServices) createdNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.created...)
+}
+
+func newOperationTestService(repo *memoryStackRepo, infraRepo *memoryInfraRepo, docker *recordingDockerServices) *stackService {
+	return &stackService{
+		stackRepo:        repo,
+		infraRepo:        infraRepo,
+		dockerService:    docker,
+		operationQueue:   make(chan string, stackOperationQueueSize),
+		operationCancels: make(map[string]context.CancelFunc),
+	}
+}
+
+func dockerStackResources(names ...string) ([]dto.CreateStackResourceInput, []dto.StackOperationStep) {
+	resources := make([]dto.CreateStackResourceInput, 0, len(names))
+	steps := make([]dto.StackOperationStep, 0, len(names))
+	for i, name := range names {
+		resources = append(resources, dto.CreateStackResourceInput{
+			Name:  name,
+			Type:  "DOCKER_SERVICE",
+			Order: i,
+			Spec:  map[string]interface{}{"image": "nginx", "image_tag": "alpine"},
+		})
+		steps = append(steps, dto.StackOperationStep{Action: "create", ResourceName: name, ResourceType: "DOCKER_SERVICE", Status: dto.StepPending})
+	}
+	return resources, steps
+}
+
+func waitForOperation(t *testing.T, repo *memoryStackRepo, operationID string) *entities.StackOperation {
+	t.Helper()
+	var operation *entities.StackOperation
+	require.Eventually(t, func() bool {
+		found, err := repo.FindOperationByID(operationID)
+		if err != nil {
+			return false
+		}
+		operation = found
+		return found.Status != entities.StackOperationPending && found.Status != entities.StackOperationInProgress
+	}, 5*time.Second, 10*time.Millisecond)
+	return operation
+}
+
+func TestStackOperationEnqueueAndRun(t *testing.T) {
+	repo := newMemoryStackRepo(&entities.Stack{ID: "stack-1", Status: entities.StackStatusCreating})
+	docker := &recordingDockerServices{}
+	svc := newOperationTestService(repo, &memoryInfraRepo{}, docker)
+
+	resources, steps := dockerStackResources("api", "worker")
+	info, err := svc.newStackOperation("stack-1", "alice", "CREATE", stackOperationRequest{Resources: resources}, steps)
+	require.NoError(t, err)
+	assert.Equal(t, entities.StackOperationPending, info.Status)
+
+	// Only one operation may be pending or running per stack
+	_, err = svc.newStackOperation("stack-1", "alice", "RESTART", stackOperationRequest{}, nil)
+	assert.ErrorContains(t, err, "operation in progress")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, svc.StartOperationWorker(ctx))
+
+	operation := waitForOperation(t, repo, info.ID)
+	assert.Equal(t, entities.StackOperationCompleted, operation.Status)
+	assert.Equal(t, "{}", operation.Request)
+	assert.ElementsMatch(t, []string{"api", "worker"}, docker.createdNames())
+
+	details, err := parseOperationDetails(operation.Details)
+	require.NoError(t, err)
+	assert.Equal(t, 100, details.Progress)
+	assert.Equal(t, "infra-api", details.Steps[0].InfrastructureID)
+
+	stack, _ := repo.FindByID("stack-1")
+	assert.Equal(t, entities.StackStatusRunning, stack.Status)
+}
+
+func TestStackOperationConcurrentStart(t *testing.T) {
+	repo := newMemoryStackRepo(&entities.Stack{ID: "stack-1"})
+	svc := newOperationTestService(repo, &memoryInfraRepo{}, &recordingDockerServices{})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	started := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := svc.newStackOperation("stack-1", "alice", "RESTART", stackOperationRequest{}, nil); err == nil {
+				mu.Lock()
+				started++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, started)
+}
+
+func TestCancelStackOperation(t *testing.T) {
+	t.Run("pending", func(t *testing.T) {
+		repo := newMemoryStackRepo(&entities.Stack{ID: "stack-1", Status: entities.StackStatusCreating})
+		svc := newOperationTestService(repo, &memoryInfraRepo{}, &recordingDockerServices{})
+
+		resources, steps := dockerStackResources("api")
+		info, err := svc.newStackOperation("stack-1", "alice", "CREATE", stackOperationRequest{Resources: resources}, steps)
+		require.NoError(t, err)
+
+		_, err = svc.CancelOperation(context.Background(), "stack-1", info.ID)
+		require.NoError(t, err)
+
+		operation, _ := repo.FindOperationByID(info.ID)
+		assert.Equal(t, entities.StackOperationCancelled, operation.Status)
+		details, _ := parseOperationDetails(operation.Details)
+		assert.Equal(t, dto.StepCancelled, details.Steps[0].Status)
+		stack, _ := repo.FindByID("stack-1")
+		assert.Equal(t, entities.StackStatusFailed, stack.Status)
+
+		// A worker that picks up the cancelled operation leaves it alone
+		svc.runOperation(context.Background(), info.ID)
+		operation, _ = repo.FindOperationByID(info.ID)
+		assert.Equal(t, entities.StackOperationCancelled, operation.Status)
+
+		_, err = svc.CancelOperation(context.Background(), "stack-1", info.ID)
+		assert.Error(t, err)
+	})
+
+	t.Run("running", func(t *testing.T) {
+		repo := newMemoryStackRepo(&entities.Stack{ID: "stack-1", Status: entities.StackStatusCreating})
+		docker := &recordingDockerServices{release: make(chan struct{})}
+		svc := newOperationTestService(repo, &memoryInfraRepo{}, docker)
+
+		resources, steps := dockerStackResources("api", "worker")
+		info, err := svc.newStackOperation("stack-1", "alice", "CREATE", stackOperationRequest{Resources: resources}, steps)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		require.NoError(t, svc.StartOperationWorker(ctx))
+
+		// Cancel while the first step is in flight; it finishes and the second never starts
+		require.Eventually(t, func() bool {
+			operation, _ := repo.FindOperationByID(info.ID)
+			details, err := parseOperationDetails(operation.Details)
+			return err == nil && details.Steps[0].Status == dto.StepInProgress
+		}, 5*time.Second, 10*time.Millisecond)
+		_, err = svc.CancelOperation(context.Background(), "stack-1", info.ID)
+		require.NoError(t, err)
+		close(docker.release)
+
+		operation := waitForOperation(t, repo, info.ID)
+		assert.Equal(t, entities.StackOperationCancelled, operation.Status)
+		assert.Equal(t, []string{"api"}, docker.createdNames())
+		details, _ := parseOperationDetails(operation.Details)
+		assert.Equal(t, dto.StepCompleted, details.Steps[0].Status)
+		assert.Equal(t, dto.StepCancelled, details.Steps[1].Status)
+	})
+}
+
+func TestCancelPendingOperationLoadedByWorker(t *testing.T) {
+	memory := newMemoryStackRepo(&entities.Stack{ID: "stack-1", Status: entities.StackStatusCreating})
+	docker := &recordingDockerServices{}
+	repo := &cancelOnLoadRepo{memoryStackRepo: memory}
+	svc := newOperationTestService(memory, &memoryInfraRepo{}, docker)
+	svc.stackRepo = repo
+
+	resources, steps := dockerStackResources("api")
+	info, err := svc.newStackOperation("stack-1", "alice", "CREATE", stackOperationRequest{Resources: resources}, steps)
+	require.NoError(t, err)
+
+	var cancelErr error
+	repo.cancel = func() {
+		_, cancelErr = svc.CancelOperation(context.Background(), "stack-1", info.ID)
+	}
+	// The worker loads the pending row, then the cancel lands before it starts
+	svc.runOperation(context.Background(), info.ID)
+	require.NoError(t, cancelErr)
+
+	operation, _ := memory.FindOperationByID(info.ID)
+	assert.Equal(t, entities.StackOperationCancelled, operation.Status)
+	assert.Empty(t, docker.createdNames())
+	details, _ := parseOperationDetails(operation.Details)
+	assert.Equal(t, dto.StepCancelled, details.Steps[0].Status)
+}
+
+func TestResumeStackOperationAfterCrash(t *testing.T) {
+	stepStarted := time.Now().Add(-time.Minute)
+	repo := newMemoryStackRepo(&entities.Stack{ID: "stack-1", Status: entities.StackStatusCreating})
+	infraRepo := &memoryInfraRepo{infras: []*entities.Infrastructure{
+		// Made by the interrupted step just before the crash
+		{ID: "infra-worker-existing", Name: "worker", Type: entities.TypeDockerService, Status: entities.StatusRunning, UserID: "alice", CreatedAt: stepStarted.Add(time.Second)},
+		// Same name but older than the step, so not made by it
+		{ID: "infra-cache-old", Name: "cache", Type: entities.TypeDockerService, Status: entities.StatusRunning, UserID: "alice", CreatedAt: stepStarted.Add(-time.Hour)},
+	}}
+	docker := &recordingDockerServices{}
+	svc := newOperationTestService(repo, infraRepo, docker)
+
+	resources, steps := dockerStackResources("api", "worker", "cache", "queue")
+	steps[0].Status = dto.StepCompleted
+	steps[0].InfrastructureID = "infra-api"
+	steps[1].Status = dto.StepInProgress
+	steps[1].StartedAt = &stepStarted
+	steps[2].Status = dto.StepInProgress
+	steps[2].StartedAt = &stepStarted
+
+	requestJSON, _ := json.Marshal(stackOperationRequest{Resources: resources})
+	detailsJSON, _ := json.Marshal(dto.StackOperationDetails{Steps: steps})
+	operationID := uuid.New().String()
+	repo.operations[operationID] = &entities.StackOperation{
+		ID:            operationID,
+		StackID:       "stack-1",
+		OperationType: "CREATE",
+		Status:        entities.StackOperationInProgress,
+		UserID:        "alice",
+		Details:       string(detailsJSON),
+		Request:       string(requestJSON),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, svc.StartOperationWorker(ctx))
+
+	operation := waitForOperation(t, repo, operationID)
+	assert.Equal(t, entities.StackOperationCompleted, operation.Status)
+	// The worker found by name is reused; the old cache does not count
+	assert.Equal(t, []string{"cache", "queue"}, docker.createdNames())
+
+	details, _ := parseOperationDetails(operation.Details)
+	assert.Equal(t, "infra-api", details.Steps[0].InfrastructureID)
+	assert.Equal(t, "infra-worker-existing", details.Steps[1].InfrastructureID)
+	assert.Equal(t, "infra-cache", details.Steps[2].InfrastructureID)
+
+	link, err := repo.FindResourceByInfrastructureID("infra-worker-existing")
+	require.NoError(t, err)
+	assert.Equal(t, "stack-1", link.StackID)
+}
+
+func TestRunStackOperationInvalidRequest(t *testing.T) {
+	repo := newMemoryStackRepo(&entities.Stack{ID: "stack-1"})
+	svc := newOperationTestService(repo, &memoryInfraRepo{}, &recordingDockerServices{})
+	repo.operations["op-1"] = &entities.StackOperation{
+		ID: "op-1", StackID: "stack-1", OperationType: "CREATE", Status: entities.StackOperationPending,
+		Details: `{"steps":[]}`, Request: `{"resources":`,
+	}
+
+	svc.runOperation(context.Background(), "op-1")
+
+	operation, _ := repo.FindOperationByID("op-1")
+	assert.Equal(t, entities.StackOperationFailed, operation.Status)
+	assert.Contains(t, operation.ErrorMessage, "invalid operation request")
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+)
+
+// References to outputs of other resources in the same stack look like
+// ${resources.db.outputs.dsn}
+var resourceRefPattern = regexp.MustCompile(`\$\{resources\.([^.}]+)\.outputs\.([A-Za-z0-9_]+)\}`)
+
+// resourceOutputs holds the resolved outputs of one stack resource and which of
+// them carry credentials
+type resourceOutputs struct {
+	values  map[string]interface{}
+	secrets map[string]bool
+}
+
+// outputResolver looks up outputs of already created stack resources by name
+type outputResolver func(resourceName string) (*resourceOutputs, error)
+
+// resolveResourceReferences replaces ${resources.<name>.outputs.<key>} placeholders.
+// It reports whether any secret output was used so callers can protect the result.
+func resolveResourceReferences(value interface{}, resolve outputResolver) (interface{}, bool, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		usedSecret := false
+		for key, item := range v {
+			resolved, secret, err := resolveResourceReferences(item, resolve)
+			if err != nil {
+				return nil, false, err
+			}
+			out[key] = resolved
+			usedSecret = usedSecret || secret
+		}
+		return out, usedSecret, nil
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		usedSecret := false
+		for _, item := range v {
+			resolved, secret, err := resolveResourceReferences(item, resolve)
+			if err != nil {
+				return nil, false, err
+			}
+			out = append(out, resolved)
+			usedSecret = usedSecret || secret
+		}
+		return out, usedSecret, nil
+	case string:
+		return resolveReferenceString(v, resolve)
+	default:
+		return v, false, nil
+	}
+}
+
+func resolveReferenceString(s string, resolve outputResolver) (interface{}, bool, error) {
+	matches := resourceRefPattern.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s, false, nil
+	}
+
+	lookup := func(name, key string) (interface{}, bool, error) {
+		outputs, err := resolve(name)
+		if err != nil {
+			return nil, false, err
+		}
+		value, ok := outputs.values[key]
+		if !ok {
+			return nil, false, fmt.Errorf("resource %s has no output %q", name, key)
+		}
+		return value, outputs.secrets[key], nil
+	}
+
+	// A lone reference keeps the output's type (ports stay numbers)
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(s) {
+		m := matches[0]
+		return lookup(s[m[2]:m[3]], s[m[4]:m[5]])
+	}
+
+	out := make([]byte, 0, len(s))
+	usedSecret := false
+	last := 0
+	for _, m := range matches {
+		value, secret, err := lookup(s[m[2]:m[3]], s[m[4]:m[5]])
+		if err != nil {
+			return nil, false, err
+		}
+		out = append(out, s[last:m[0]]...)
+		out = append(out, fmt.Sprint(value)...)
+		usedSecret = usedSecret || secret
+		last = m[1]
+	}
+	out = append(out, s[last:]...)
+
+	return string(out), usedSecret, nil
+}
+
+// collectResourceReferences returns the names of stack resources referenced in a spec
+func collectResourceReferences(value interface{}) []string {
+	var names []string
+	seen := make(map[string]bool)
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case string:
+			for _, m := range resourceRefPattern.FindAllStringSubmatch(v, -1) {
+				if !seen[m[1]] {
+					seen[m[1]] = true
+					names = append(names, m[1])
+				}
+			}
+		}
+	}
+	walk(value)
+	return names
+}
+
+// validateResourceReferences makes sure every reference points to a resource that
+// is created earlier in the stack and records it as an implicit dependency
+func validateResourceReferences(resources []dto.CreateStackResourceInput) error {
+	position := make(map[string]int, len(resources))
+	for i, res := range resources {
+		position[res.Name] = i
+	}
+
+	for i := range resources {
+		res := &resources[i]
+		for _, name := range collectResourceReferences(res.Spec) {
+			idx, ok := position[name]
+			if !ok {
+				return fmt.Errorf("resource %s references unknown resource %q", res.Name, name)
+			}
+			if idx >= i {
+				return fmt.Errorf("resource %s references %q which is not created before it", res.Name, name)
+			}
+
+			found := false
+			for _, dep := range res.DependsOn {
+				if dep == name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				res.DependsOn = append(res.DependsOn, name)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveStackResourceSpec resolves references in a resource spec. Docker service
+// env vars that pull in a secret output are flagged as secrets.
+func resolveStackResourceSpec(res dto.CreateStackResourceInput, resolve outputResolver) (map[string]interface{}, error) {
+	spec := make(map[string]interface{}, len(res.Spec))
+	for key, value := range res.Spec {
+		spec[key] = value
+	}
+
+	if res.Type == "DOCKER_SERVICE" {
+		if envVars, ok := spec["env_vars"].([]interface{}); ok {
+			resolvedEnv := make([]interface{}, 0, len(envVars))
+			for _, item := range envVars {
+				envVar, ok := item.(map[string]interface{})
+				if !ok {
+					resolvedEnv = append(resolvedEnv, item)
+					continue
+				}
+				resolved, usedSecret, err := resolveResourceReferences(envVar, resolve)
+				if err != nil {
+					return nil, err
+				}
+				resolvedVar := resolved.(map[string]interface{})
+				if value, ok := resolvedVar["value"]; ok {
+					resolvedVar["value"] = fmt.Sprint(value)
+				}
+				if usedSecret {
+					resolvedVar["is_secret"] = true
+				}
+				resolvedEnv = append(resolvedEnv, resolvedVar)
+			}
+			spec["env_vars"] = resolvedEnv
+		}
+	}
+
+	resolved, _, err := resolveResourceReferences(spec, resolve)
+	if err != nil {
+		return nil, err
+	}
+	return resolved.(map[string]interface{}), nil
+}
+
+// newStackOutputResolver resolves outputs of resources already created in this
+// stack, caching the lookups for the lifetime of one stack operation
+func (s *stackService) newStackOutputResolver(ctx context.Context, created map[string]createdStackResource) outputResolver {
+	cache := make(map[string]*resourceOutputs)
+	return func(name string) (*resourceOutputs, error) {
+		if outputs, ok := cache[name]; ok {
+			return outputs, nil
+		}
+		res, ok := created[name]
+		if !ok {
+			return nil, fmt.Errorf("resource %q has not been created", name)
+		}
+		values, secrets := s.collectResourceOutputs(ctx, res.resourceType, res.infraID)
+		outputs := &resourceOutputs{values: values, secrets: secrets}
+		cache[name] = outputs
+		return outputs, nil
+	}
+}
+
+type createdStackResource struct {
+	resourceType string
+	infraID      string
+}
+
+// databaseEnvOutputs maps database outputs to the env vars injected into dependent services
+var databaseEnvOutputs = []struct {
+	key    string
+	output string
+}{
+	{"DATABASE_HOST", "host"},
+	{"DATABASE_PORT", "port"},
+	{"DATABASE_NAME", "database"},
+	{"DATABASE_USER", "username"},
+	{"DATABASE_PASSWORD", "password"},
+	{"DATABASE_URL", "dsn"},
+}
+
+func injectDatabaseEnvVars(envVars []dto.EnvVarInput, outputs *resourceOutputs) []dto.EnvVarInput {
+	existing := make(map[string]bool, len(envVars))
+	for _, env := range envVars {
+		existing[env.Key] = true
+	}
+
+	for _, mapping := range databaseEnvOutputs {
+		value, ok := outputs.values[mapping.output]
+		if !ok || existing[mapping.key] {
+			continue
+		}
+		envVars = append(envVars, dto.EnvVarInput{
+			Key:      mapping.key,
+			Value:    fmt.Sprint(value),
+			IsSecret: outputs.secrets[mapping.output],
+		})
+	}
+	return envVars
+}
@@ -3,32 +3,44 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"time"
+	"sync"
 
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/pkg/secrets"
 	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type IStackService interface {
-	CreateStack(ctx context.Context, userID string, req dto.CreateStackRequest) (*dto.StackInfo, error)
+	CreateStack(ctx context.Context, userID string, req dto.CreateStackRequest) (*dto.StackOperationInfo, error)
 	GetStack(ctx context.Context, stackID string) (*dto.StackInfo, error)
-	ListStacks(ctx context.Context, userID string, page, pageSize int) (*dto.StackListResponse, error)
+	ListStacks(ctx context.Context, userID, health string, page, pageSize int) (*dto.StackListResponse, error)
 	UpdateStack(ctx context.Context, stackID string, req dto.UpdateStackRequest) (*dto.StackInfo, error)
-	DeleteStack(ctx context.Context, stackID string) error
+	DeleteStack(ctx context.Context, userID, stackID string) (*dto.StackOperationInfo, error)
 	CloneStack(ctx context.Context, userID string, req dto.CloneStackRequest) (*dto.StackInfo, error)
 
 	// Operations
 	StartStack(ctx context.Context, stackID string) error
 	StopStack(ctx context.Context, stackID string) error
-	RestartStack(ctx context.Context, stackID string) error
+	RestartStack(ctx context.Context, userID, stackID string) (*dto.StackOperationInfo, error)
+	ListOperations(ctx context.Context, stackID string) ([]dto.StackOperationInfo, error)
+	GetOperation(ctx context.Context, stackID, operationID string) (*dto.StackOperationInfo, error)
+	CancelOperation(ctx context.Context, stackID, operationID string) (*dto.StackOperationInfo, error)
+	StartOperationWorker(ctx context.Context) error
+	SetWebSocketHandler(handler StackOperationBroadcaster)
 
 	// Templates
 	CreateTemplate(ctx context.Context, userID string, req dto.CreateStackTemplateRequest) (*dto.StackTemplateInfo, error)
 	GetTemplate(ctx context.Context, templateID string) (*dto.StackTemplateInfo, error)
 	ListPublicTemplates(ctx context.Context) ([]dto.StackTemplateInfo, error)
+	PublishTemplateVersion(ctx context.Context, userID, templateID string, req dto.PublishTemplateVersionRequest) (*dto.StackTemplateInfo, error)
+	ListTemplateVersions(ctx context.Context, templateID string) ([]dto.StackTemplateVersionInfo, error)
+	GetTemplateVersion(ctx context.Context, templateID string, version int) (*dto.StackTemplateVersionInfo, error)
+	InstantiateTemplate(ctx context.Context, userID, templateID string, req dto.InstantiateTemplateRequest) (*dto.StackOperationInfo, error)
 }
 
 type stackService struct {
@@ -38,11 +50,18 @@ type stackService struct {
 	pgService           IPostgreSQLService
 	clusterService      IPostgreSQLClusterService
 	clusterRepo         repositories.IPostgreSQLClusterRepository
+	pgRepo              repositories.IPostgreSQLRepository
+	pgDbRepo            repositories.IPostgresDatabaseRepository
 	pgDbService         IPostgresDatabaseService
 	dockerService       IDockerServiceService
 	nginxClusterService INginxClusterService
 	nginxClusterRepo    repositories.INginxClusterRepository
 	dindService         IDinDService
+	broadcaster         StackOperationBroadcaster
+
+	operationQueue   chan string
+	operationMu      sync.Mutex
+	operationCancels map[string]context.CancelFunc
 }
 
 func NewStackService(
@@ -52,6 +71,8 @@ func NewStackService(
 	pgService IPostgreSQLService,
 	clusterService IPostgreSQLClusterService,
 	clusterRepo repositories.IPostgreSQLClusterRepository,
+	pgRepo repositories.IPostgreSQLRepository,
+	pgDbRepo repositories.IPostgresDatabaseRepository,
 	pgDbService IPostgresDatabaseService,
 	dockerService IDockerServiceService,
 	nginxClusterService INginxClusterService,
@@ -65,15 +86,43 @@ func NewStackService(
 		pgService:           pgService,
 		clusterService:      clusterService,
 		clusterRepo:         clusterRepo,
+		pgRepo:              pgRepo,
+		pgDbRepo:            pgDbRepo,
 		pgDbService:         pgDbService,
 		dockerService:       dockerService,
 		nginxClusterService: nginxClusterService,
 		nginxClusterRepo:    nginxClusterRepo,
 		dindService:         dindService,
+		operationQueue:      make(chan string, stackOperationQueueSize),
+		operationCancels:    make(map[string]context.CancelFunc),
 	}
 }
 
-func (s *stackService) CreateStack(ctx context.Context, userID string, req dto.CreateStackRequest) (*dto.StackInfo, error) {
+// CreateStack validates the request, records the stack and queues its resources
+// for creation. Progress is tracked on the returned operation.
+func (s *stackService) CreateStack(ctx context.Context, userID string, req dto.CreateStackRequest) (*dto.StackOperationInfo, error) {
+	resources := req.Resources
+	var templateID, templateParams string
+	var templateVersion int
+
+	if req.FromTemplate != "" {
+		rendered, version, params, err := s.renderTemplate(userID, req.FromTemplate, req.TemplateVersion, req.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		resources = rendered
+		templateID = req.FromTemplate
+		templateVersion = version
+		paramsJSON, _ := json.Marshal(params)
+		templateParams = string(paramsJSON)
+	} else if len(resources) == 0 {
+		return nil, fmt.Errorf("either resources or from_template is required")
+	}
+
+	if err := validateResourceReferences(resources); err != nil {
+		return nil, err
+	}
+
 	stackID := uuid.New().String()
 
 	// Create stack record
@@ -87,73 +136,40 @@ func (s *stackService) CreateStack(ctx context.Context, userID string, req dto.C
 		TenantID:    req.TenantID,
 		UserID:      userID,
 		Status:      entities.StackStatusCreating,
+		Health:      entities.StackHealthUnknown,
 		Tags:        string(tagsJSON),
+
+		TemplateID:      templateID,
+		TemplateVersion: templateVersion,
+		TemplateParams:  templateParams,
+	}
+	if stack.TemplateParams == "" {
+		stack.TemplateParams = "{}"
 	}
 
 	if err := s.stackRepo.Create(stack); err != nil {
 		return nil, fmt.Errorf("failed to create stack: %w", err)
 	}
 
-	operation := &entities.StackOperation{
-		ID:            uuid.New().String(),
-		StackID:       stackID,
-		OperationType: "CREATE",
-		Status:        "IN_PROGRESS",
-		UserID:        userID,
-		Details:       "{}",
-	}
-	s.stackRepo.CreateOperation(operation)
-
-	resourceMap := make(map[string]string) // name -> infrastructure_id
-
-	for _, resInput := range req.Resources {
-		infraID, err := s.createResource(ctx, userID, stackID, resInput, resourceMap)
-		if err != nil {
-			stack.Status = entities.StackStatusFailed
-			s.stackRepo.Update(stack)
-
-			operation.Status = "FAILED"
-			operation.ErrorMessage = err.Error()
-			now := time.Now()
-			operation.CompletedAt = &now
-			s.stackRepo.UpdateOperation(operation)
-
-			return nil, fmt.Errorf("failed to create resource %s: %w", resInput.Name, err)
-		}
-
-		resourceMap[resInput.Name] = infraID
-
-		// Create stack resource link
-		dependsOnJSON, _ := json.Marshal(resInput.DependsOn)
-		stackResource := &entities.StackResource{
-			ID:               uuid.New().String(),
-			StackID:          stackID,
-			InfrastructureID: infraID,
-			ResourceType:     resInput.Type,
-			Role:             resInput.Role,
-			DependsOn:        string(dependsOnJSON),
-			Order:            resInput.Order,
-		}
-
-		if err := s.stackRepo.CreateResource(stackResource); err != nil {
-			return nil, fmt.Errorf("failed to link resource: %w", err)
-		}
+	steps := make([]dto.StackOperationStep, 0, len(resources))
+	for _, res := range resources {
+		steps = append(steps, dto.StackOperationStep{
+			Action:       "create",
+			ResourceName: res.Name,
+			ResourceType: res.Type,
+			Status:       dto.StepPending,
+		})
 	}
 
-	// Update stack status
-	stack.Status = entities.StackStatusRunning
-	s.stackRepo.Update(stack)
-
-	operation.Status = "COMPLETED"
-	now := time.Now()
-	operation.CompletedAt = &now
-	s.stackRepo.UpdateOperation(operation)
-
-	return s.GetStack(ctx, stackID)
+	return s.newStackOperation(stackID, userID, "CREATE", stackOperationRequest{Resources: resources}, steps)
 }
 
-func (s *stackService) createResource(ctx context.Context, userID, stackID string, resInput dto.CreateStackResourceInput, resourceMap map[string]string) (string, error) {
-	specJSON, _ := json.Marshal(resInput.Spec)
+func (s *stackService) createResource(ctx context.Context, userID, stackID string, resInput dto.CreateStackResourceInput, created map[string]createdStackResource, resolve outputResolver) (string, error) {
+	spec, err := resolveStackResourceSpec(resInput, resolve)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve references: %w", err)
+	}
+	specJSON, _ := json.Marshal(spec)
 
 	switch resInput.Type {
 	case "NGINX_GATEWAY":
@@ -218,8 +234,8 @@ func (s *stackService) createResource(ctx context.Context, userID, stackID strin
 		// Resolve instance_id from dependencies
 		var instanceID string
 		if len(resInput.DependsOn) > 0 {
-			if id, ok := resourceMap[resInput.DependsOn[0]]; ok {
-				instanceID = id
+			if dep, ok := created[resInput.DependsOn[0]]; ok {
+				instanceID = dep.infraID
 			}
 		}
 
@@ -272,28 +288,19 @@ func (s *stackService) createResource(ctx context.Context, userID, stackID strin
 		}
 		dockerReq.Name = resInput.Name
 
-		// Resolve dependencies for env vars (e.g., database connection strings)
-		if len(resInput.DependsOn) > 0 {
-			for _, depName := range resInput.DependsOn {
-				if depID, ok := resourceMap[depName]; ok {
-					// Get infrastructure to inject connection info
-					infra, _ := s.infraRepo.FindByID(depID)
-					if infra != nil && infra.Type == entities.TypePostgreSQLSingle {
-						pgInstance, _ := s.pgService.GetPostgreSQLInfo(ctx, depID)
-						if pgInstance != nil {
-							dockerReq.EnvVars = append(dockerReq.EnvVars, dto.EnvVarInput{
-								Key:      "DATABASE_HOST",
-								Value:    pgInstance.Name,
-								IsSecret: false,
-							})
-							dockerReq.EnvVars = append(dockerReq.EnvVars, dto.EnvVarInput{
-								Key:      "DATABASE_PORT",
-								Value:    fmt.Sprintf("%d", pgInstance.Port),
-								IsSecret: false,
-							})
-						}
-					}
+		// Inject connection info for database dependencies unless the spec sets it explicitly
+		for _, depName := range resInput.DependsOn {
+			dep, ok := created[depName]
+			if !ok {
+				continue
+			}
+			switch dep.resourceType {
+			case "POSTGRES_INSTANCE", "POSTGRES_CLUSTER", "POSTGRES_DATABASE":
+				outputs, err := resolve(depName)
+				if err != nil {
+					return "", err
 				}
+				dockerReq.EnvVars = injectDatabaseEnvVars(dockerReq.EnvVars, outputs)
 			}
 		}
 
@@ -374,6 +381,9 @@ func (s *stackService) GetStack(ctx context.Context, stackID string) (*dto.Stack
 	var tags []string
 	json.Unmarshal([]byte(stack.Tags), &tags)
 
+	var templateParams map[string]interface{}
+	json.Unmarshal([]byte(stack.TemplateParams), &templateParams)
+
 	resources, _ := s.stackRepo.FindResourcesByStackID(stackID)
 	resourceInfos := []dto.StackResourceInfo{}
 
@@ -391,6 +401,8 @@ func (s *stackService) GetStack(ctx context.Context, stackID string) (*dto.Stack
 			ResourceName:     res.Infrastructure.Name,
 			Role:             res.Role,
 			Status:           string(res.Infrastructure.Status),
+			Health:           res.Health,
+			HealthMessage:    res.HealthMessage,
 			DependsOn:        dependsOn,
 			Order:            res.Order,
 			Outputs:          outputs,
@@ -407,15 +419,41 @@ func (s *stackService) GetStack(ctx context.Context, stackID string) (*dto.Stack
 		TenantID:    stack.TenantID,
 		UserID:      stack.UserID,
 		Status:      string(stack.Status),
+		Health:      string(stack.Health),
 		Tags:        tags,
 		Resources:   resourceInfos,
 		CreatedAt:   stack.CreatedAt,
 		UpdatedAt:   stack.UpdatedAt,
+
+		TemplateID:      stack.TemplateID,
+		TemplateVersion: stack.TemplateVersion,
+		TemplateParams:  templateParams,
+
+		HealthCheckedAt: stack.HealthCheckedAt,
 	}, nil
 }
 
+// getResourceOutputs returns the outputs shown to users, with credentials masked unless
+// the caller may reveal secrets
 func (s *stackService) getResourceOutputs(ctx context.Context, resourceType, infraID string) map[string]interface{} {
+	outputs, secretKeys := s.collectResourceOutputs(ctx, resourceType, infraID)
+	if secrets.CanReveal(ctx) {
+		return outputs
+	}
+	for key := range secretKeys {
+		if _, ok := outputs[key]; ok {
+			outputs[key] = maskedSecretValue
+		}
+	}
+	return outputs
+}
+
+// collectResourceOutputs returns every output of a resource, including
+// credentials, together with the set of keys that must be treated as secrets.
+// Hosts and ports are the ones reachable from other containers on the Docker network.
+func (s *stackService) collectResourceOutputs(ctx context.Context, resourceType, infraID string) (map[string]interface{}, map[string]bool) {
 	outputs := make(map[string]interface{})
+	secrets := make(map[string]bool)
 
 	switch resourceType {
 	case "NGINX_GATEWAY":
@@ -423,17 +461,62 @@ func (s *stackService) getResourceOutputs(ctx context.Context, resourceType, inf
 			outputs["nginx_name"] = nginx.Name
 			outputs["port"] = nginx.Port
 			outputs["status"] = nginx.Status
+			outputs["container_id"] = nginx.ContainerID
+			outputs["url"] = fmt.Sprintf("http://localhost:%d", nginx.Port)
+			if nginx.SSLPort > 0 {
+				outputs["ssl_port"] = nginx.SSLPort
+			}
 		}
 	case "POSTGRES_INSTANCE":
-		if pg, err := s.pgService.GetPostgreSQLInfo(ctx, infraID); err == nil {
+		if instance, err := s.pgRepo.FindByInfrastructureID(infraID); err == nil {
+			host := fmt.Sprintf("iaas-postgres-%s", instance.ID)
 			outputs["connection_string"] = fmt.Sprintf("postgresql://%s:%s@%s:%d/%s",
-				pg.Username, "****", pg.Name, pg.Port, pg.DatabaseName)
-			outputs["host"] = pg.Name
-			outputs["port"] = pg.Port
+				instance.Username, maskedSecretValue, host, 5432, instance.DatabaseName)
+			outputs["host"] = host
+			outputs["port"] = 5432
+			outputs["external_port"] = instance.Port
+			outputs["database"] = instance.DatabaseName
+			outputs["username"] = instance.Username
+			outputs["password"] = instance.Password
+			outputs["dsn"] = fmt.Sprintf("postgresql://%s:%s@%s:%d/%s?sslmode=disable",
+				instance.Username, instance.Password, host, 5432, instance.DatabaseName)
+			secrets["password"] = true
+			secrets["dsn"] = true
+		}
+	case "POSTGRES_DATABASE":
+		// Tenant databases are linked by their own ID rather than an infrastructure ID
+		if database, err := s.pgDbRepo.FindByID(infraID); err == nil {
+			host := fmt.Sprintf("iaas-postgres-%s", database.InstanceID)
+			outputs["host"] = host
+			outputs["port"] = 5432
+			outputs["database"] = database.DBName
+			outputs["username"] = database.OwnerUsername
+			outputs["password"] = database.OwnerPassword
+			outputs["dsn"] = fmt.Sprintf("postgresql://%s:%s@%s:%d/%s?sslmode=disable",
+				database.OwnerUsername, database.OwnerPassword, host, 5432, database.DBName)
+			outputs["status"] = database.Status
+			secrets["password"] = true
+			secrets["dsn"] = true
 		}
 	case "POSTGRES_CLUSTER":
 		// Get cluster by infrastructure_id first, then get cluster info by cluster_id
 		if clusterEntity, err := s.clusterRepo.FindByInfrastructureID(infraID); err == nil {
+			host := fmt.Sprintf("iaas-haproxy-%s", clusterEntity.ID)
+			outputs["host"] = host
+			outputs["port"] = 5000
+			outputs["read_port"] = 5001
+			outputs["network"] = clusterEntity.NetworkID
+			outputs["database"] = clusterEntity.DatabaseName
+			outputs["username"] = clusterEntity.Username
+			outputs["password"] = clusterEntity.Password
+			outputs["dsn"] = fmt.Sprintf("postgresql://%s:%s@%s:%d/%s?sslmode=disable",
+				clusterEntity.Username, clusterEntity.Password, host, 5000, clusterEntity.DatabaseName)
+			outputs["read_dsn"] = fmt.Sprintf("postgresql://%s:%s@%s:%d/%s?sslmode=disable",
+				clusterEntity.Username, clusterEntity.Password, host, 5001, clusterEntity.DatabaseName)
+			secrets["password"] = true
+			secrets["dsn"] = true
+			secrets["read_dsn"] = true
+
 			if cluster, err := s.clusterService.GetClusterInfo(ctx, clusterEntity.ID); err == nil {
 				outputs["cluster_id"] = clusterEntity.ID
 				outputs["cluster_name"] = cluster.ClusterName
@@ -464,6 +547,13 @@ func (s *stackService) getResourceOutputs(ctx context.Context, resourceType, inf
 		if docker, err := s.dockerService.GetDockerService(ctx, infraID); err == nil {
 			outputs["service_name"] = docker.Name
 			outputs["status"] = docker.Status
+			outputs["host"] = fmt.Sprintf("iaas-docker-%s", docker.ID)
+			outputs["ip_address"] = docker.IPAddress
+			outputs["internal_endpoint"] = docker.InternalEndpoint
+			if len(docker.Ports) > 0 {
+				outputs["port"] = docker.Ports[0].ContainerPort
+				outputs["address"] = fmt.Sprintf("iaas-docker-%s:%d", docker.ID, docker.Ports[0].ContainerPort)
+			}
 		}
 	case "NGINX_CLUSTER":
 		if clusterEntity, err := s.nginxClusterRepo.FindByInfrastructureID(infraID); err == nil {
@@ -474,6 +564,8 @@ func (s *stackService) getResourceOutputs(ctx context.Context, resourceType, inf
 				outputs["virtual_ip"] = cluster.VirtualIP
 				outputs["node_count"] = cluster.NodeCount
 				outputs["http_port"] = cluster.HTTPPort
+				outputs["url"] = cluster.Endpoints.HTTPURL
+				outputs["network"] = clusterEntity.NetworkID
 				if cluster.HTTPSPort > 0 {
 					outputs["https_port"] = cluster.HTTPSPort
 				}
@@ -490,10 +582,10 @@ func (s *stackService) getResourceOutputs(ctx context.Context, resourceType, inf
 		}
 	}
 
-	return outputs
+	return outputs, secrets
 }
 
-func (s *stackService) ListStacks(ctx context.Context, userID string, page, pageSize int) (*dto.StackListResponse, error) {
+func (s *stackService) ListStacks(ctx context.Context, userID, health string, page, pageSize int) (*dto.StackListResponse, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -502,7 +594,7 @@ func (s *stackService) ListStacks(ctx context.Context, userID string, page, page
 	}
 
 	offset := (page - 1) * pageSize
-	stacks, total, err := s.stackRepo.FindByUserID(userID, pageSize, offset)
+	stacks, total, err := s.stackRepo.FindByUserID(userID, health, pageSize, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -517,6 +609,7 @@ func (s *stackService) ListStacks(ctx context.Context, userID string, page, page
 			Name:          stack.Name,
 			Environment:   stack.Environment,
 			Status:        string(stack.Status),
+			Health:        string(stack.Health),
 			ResourceCount: len(stack.Resources),
 			Tags:          tags,
 			CreatedAt:     stack.CreatedAt,
@@ -561,35 +654,25 @@ func (s *stackService) UpdateStack(ctx context.Context, stackID string, req dto.
 	return s.GetStack(ctx, stackID)
 }
 
-func (s *stackService) DeleteStack(ctx context.Context, stackID string) error {
-	stack, err := s.stackRepo.FindByID(stackID)
-	if err != nil {
-		return err
+func (s *stackService) DeleteStack(ctx context.Context, userID, stackID string) (*dto.StackOperationInfo, error) {
+	if _, err := s.stackRepo.FindByID(stackID); err != nil {
+		return nil, err
 	}
 
-	// Mark stack as deleting
-	stack.Status = entities.StackStatusDeleting
-	s.stackRepo.Update(stack)
-
 	// Delete all infrastructure resources in reverse order
 	resources, _ := s.stackRepo.FindResourcesByStackID(stackID)
-
+	steps := make([]dto.StackOperationStep, 0, len(resources))
 	for i := len(resources) - 1; i >= 0; i-- {
-		res := resources[i]
-		if err := s.deleteResource(ctx, res.ResourceType, res.InfrastructureID); err != nil {
-			// Log error but continue deleting other resources
-			fmt.Printf("Failed to delete resource %s (%s): %v\n", res.ResourceType, res.InfrastructureID, err)
-		}
+		steps = append(steps, dto.StackOperationStep{
+			Action:           "delete",
+			ResourceName:     resources[i].Infrastructure.Name,
+			ResourceType:     resources[i].ResourceType,
+			InfrastructureID: resources[i].InfrastructureID,
+			Status:           dto.StepPending,
+		})
 	}
 
-	// Delete stack_resources records
-	s.stackRepo.DeleteResourcesByStackID(stackID)
-
-	// Mark stack as deleted (don't actually delete the record)
-	stack.Status = entities.StackStatusDeleted
-	s.stackRepo.Update(stack)
-
-	return nil
+	return s.newStackOperation(stackID, userID, "DELETE", stackOperationRequest{}, steps)
 }
 
 func (s *stackService) deleteResource(ctx context.Context, resourceType, infraID string) error {
@@ -640,26 +723,7 @@ func (s *stackService) StartStack(ctx context.Context, stackID string) error {
 	resources, _ := s.stackRepo.FindResourcesByStackID(stackID)
 
 	for _, res := range resources {
-		switch res.ResourceType {
-		case "POSTGRES_INSTANCE":
-			s.pgService.StartPostgreSQL(ctx, res.InfrastructureID)
-		case "POSTGRES_CLUSTER":
-			if clusterID, err := s.getPostgresClusterIDByInfra(res.InfrastructureID); err == nil {
-				s.clusterService.StartCluster(ctx, clusterID)
-			}
-		case "DOCKER_SERVICE":
-			s.dockerService.StartDockerService(ctx, res.InfrastructureID)
-		case "NGINX_GATEWAY":
-			s.nginxService.StartNginx(ctx, res.InfrastructureID)
-		case "NGINX_CLUSTER":
-			if clusterID, err := s.getNginxClusterIDByInfra(res.InfrastructureID); err == nil {
-				s.nginxClusterService.StartCluster(ctx, clusterID)
-			}
-		case "DIND_ENVIRONMENT":
-			if dindEnv, err := s.dindService.GetEnvironmentByInfraID(ctx, res.InfrastructureID); err == nil {
-				s.dindService.StartEnvironment(ctx, dindEnv.ID)
-			}
-		}
+		s.startResource(ctx, res)
 	}
 
 	return nil
@@ -670,42 +734,110 @@ func (s *stackService) StopStack(ctx context.Context, stackID string) error {
 
 	// Stop in reverse order
 	for i := len(resources) - 1; i >= 0; i-- {
-		res := resources[i]
-		switch res.ResourceType {
-		case "NGINX_GATEWAY":
-			s.nginxService.StopNginx(ctx, res.InfrastructureID)
-		case "NGINX_CLUSTER":
-			if clusterID, err := s.getNginxClusterIDByInfra(res.InfrastructureID); err == nil {
-				s.nginxClusterService.StopCluster(ctx, clusterID)
-			}
-		case "DOCKER_SERVICE":
-			s.dockerService.StopDockerService(ctx, res.InfrastructureID)
-		case "POSTGRES_CLUSTER":
-			if clusterID, err := s.getPostgresClusterIDByInfra(res.InfrastructureID); err == nil {
-				s.clusterService.StopCluster(ctx, clusterID)
-			}
-		case "POSTGRES_INSTANCE":
-			s.pgService.StopPostgreSQL(ctx, res.InfrastructureID)
-		case "DIND_ENVIRONMENT":
-			if dindEnv, err := s.dindService.GetEnvironmentByInfraID(ctx, res.InfrastructureID); err == nil {
-				s.dindService.StopEnvironment(ctx, dindEnv.ID)
-			}
-		}
+		s.stopResource(ctx, resources[i])
 	}
 
 	return nil
 }
 
-func (s *stackService) RestartStack(ctx context.Context, stackID string) error {
-	if err := s.StopStack(ctx, stackID); err != nil {
-		return err
+// RestartStack queues a stop of all resources in reverse order followed by a
+// start in creation order
+func (s *stackService) RestartStack(ctx context.Context, userID, stackID string) (*dto.StackOperationInfo, error) {
+	if _, err := s.stackRepo.FindByID(stackID); err != nil {
+		return nil, err
+	}
+
+	resources, _ := s.stackRepo.FindResourcesByStackID(stackID)
+	steps := make([]dto.StackOperationStep, 0, 2*len(resources))
+	for i := len(resources) - 1; i >= 0; i-- {
+		steps = append(steps, dto.StackOperationStep{
+			Action:           "stop",
+			ResourceName:     resources[i].Infrastructure.Name,
+			ResourceType:     resources[i].ResourceType,
+			InfrastructureID: resources[i].InfrastructureID,
+			Status:           dto.StepPending,
+		})
 	}
-	time.Sleep(2 * time.Second)
-	return s.StartStack(ctx, stackID)
+	for _, res := range resources {
+		steps = append(steps, dto.StackOperationStep{
+			Action:           "start",
+			ResourceName:     res.Infrastructure.Name,
+			ResourceType:     res.ResourceType,
+			InfrastructureID: res.InfrastructureID,
+			Status:           dto.StepPending,
+		})
+	}
+
+	return s.newStackOperation(stackID, userID, "RESTART", stackOperationRequest{}, steps)
+}
+
+func (s *stackService) startResource(ctx context.Context, res entities.StackResource) error {
+	switch res.ResourceType {
+	case "POSTGRES_INSTANCE":
+		return s.pgService.StartPostgreSQL(ctx, res.InfrastructureID)
+	case "POSTGRES_CLUSTER":
+		clusterID, err := s.getPostgresClusterIDByInfra(res.InfrastructureID)
+		if err != nil {
+			return err
+		}
+		return s.clusterService.StartCluster(ctx, clusterID)
+	case "DOCKER_SERVICE":
+		return s.dockerService.StartDockerService(ctx, res.InfrastructureID)
+	case "NGINX_GATEWAY":
+		return s.nginxService.StartNginx(ctx, res.InfrastructureID)
+	case "NGINX_CLUSTER":
+		clusterID, err := s.getNginxClusterIDByInfra(res.InfrastructureID)
+		if err != nil {
+			return err
+		}
+		return s.nginxClusterService.StartCluster(ctx, clusterID)
+	case "DIND_ENVIRONMENT":
+		dindEnv, err := s.dindService.GetEnvironmentByInfraID(ctx, res.InfrastructureID)
+		if err != nil {
+			return err
+		}
+		return s.dindService.StartEnvironment(ctx, dindEnv.ID)
+	}
+	return nil
+}
+
+func (s *stackService) stopResource(ctx context.Context, res entities.StackResource) error {
+	switch res.ResourceType {
+	case "NGINX_GATEWAY":
+		return s.nginxService.StopNginx(ctx, res.InfrastructureID)
+	case "NGINX_CLUSTER":
+		clusterID, err := s.getNginxClusterIDByInfra(res.InfrastructureID)
+		if err != nil {
+			return err
+		}
+		return s.nginxClusterService.StopCluster(ctx, clusterID)
+	case "DOCKER_SERVICE":
+		return s.dockerService.StopDockerService(ctx, res.InfrastructureID)
+	case "POSTGRES_CLUSTER":
+		clusterID, err := s.getPostgresClusterIDByInfra(res.InfrastructureID)
+		if err != nil {
+			return err
+		}
+		return s.clusterService.StopCluster(ctx, clusterID)
+	case "POSTGRES_INSTANCE":
+		return s.pgService.StopPostgreSQL(ctx, res.InfrastructureID)
+	case "DIND_ENVIRONMENT":
+		dindEnv, err := s.dindService.GetEnvironmentByInfraID(ctx, res.InfrastructureID)
+		if err != nil {
+			return err
+		}
+		return s.dindService.StopEnvironment(ctx, dindEnv.ID)
+	}
+	return nil
 }
 
 func (s *stackService) CreateTemplate(ctx context.Context, userID string, req dto.CreateStackTemplateRequest) (*dto.StackTemplateInfo, error) {
+	if err := validateTemplateDefinition(req.Parameters, req.Resources); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
 	specJSON, _ := json.Marshal(req.Resources)
+	paramsJSON, _ := json.Marshal(req.Parameters)
 
 	template := &entities.StackTemplate{
 		ID:          uuid.New().String(),
@@ -715,12 +847,27 @@ func (s *stackService) CreateTemplate(ctx context.Context, userID string, req dt
 		IsPublic:    req.IsPublic,
 		UserID:      userID,
 		Spec:        string(specJSON),
+		Parameters:  string(paramsJSON),
+		Version:     1,
 	}
 
 	if err := s.stackRepo.CreateTemplate(template); err != nil {
 		return nil, err
 	}
 
+	version := &entities.StackTemplateVersion{
+		ID:         uuid.New().String(),
+		TemplateID: template.ID,
+		Version:    1,
+		Parameters: string(paramsJSON),
+		Spec:       string(specJSON),
+		Changelog:  "Initial version",
+		CreatedBy:  userID,
+	}
+	if err := s.stackRepo.CreateTemplateVersion(version); err != nil {
+		return nil, fmt.Errorf("failed to store template version: %w", err)
+	}
+
 	return s.GetTemplate(ctx, template.ID)
 }
 
@@ -730,19 +877,8 @@ func (s *stackService) GetTemplate(ctx context.Context, templateID string) (*dto
 		return nil, err
 	}
 
-	var resources []dto.CreateStackResourceInput
-	json.Unmarshal([]byte(template.Spec), &resources)
-
-	return &dto.StackTemplateInfo{
-		ID:          template.ID,
-		Name:        template.Name,
-		Description: template.Description,
-		Category:    template.Category,
-		IsPublic:    template.IsPublic,
-		UserID:      template.UserID,
-		Resources:   resources,
-		CreatedAt:   template.CreatedAt,
-	}, nil
+	info := toStackTemplateInfo(*template)
+	return &info, nil
 }
 
 func (s *stackService) ListPublicTemplates(ctx context.Context) ([]dto.StackTemplateInfo, error) {
@@ -753,20 +889,184 @@ func (s *stackService) ListPublicTemplates(ctx context.Context) ([]dto.StackTemp
 
 	result := []dto.StackTemplateInfo{}
 	for _, t := range templates {
-		var resources []dto.CreateStackResourceInput
-		json.Unmarshal([]byte(t.Spec), &resources)
-
-		result = append(result, dto.StackTemplateInfo{
-			ID:          t.ID,
-			Name:        t.Name,
-			Description: t.Description,
-			Category:    t.Category,
-			IsPublic:    t.IsPublic,
-			UserID:      t.UserID,
-			Resources:   resources,
-			CreatedAt:   t.CreatedAt,
-		})
+		result = append(result, toStackTemplateInfo(t))
+	}
+
+	return result, nil
+}
+
+func (s *stackService) PublishTemplateVersion(ctx context.Context, userID, templateID string, req dto.PublishTemplateVersionRequest) (*dto.StackTemplateInfo, error) {
+	template, err := s.stackRepo.FindTemplateByID(templateID)
+	if err != nil {
+		return nil, err
+	}
+	if template.UserID != userID {
+		return nil, fmt.Errorf("only the template owner can publish new versions")
+	}
+
+	if err := validateTemplateDefinition(req.Parameters, req.Resources); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	specJSON, _ := json.Marshal(req.Resources)
+	paramsJSON, _ := json.Marshal(req.Parameters)
+
+	version := &entities.StackTemplateVersion{
+		ID:         uuid.New().String(),
+		TemplateID: template.ID,
+		Version:    template.Version + 1,
+		Parameters: string(paramsJSON),
+		Spec:       string(specJSON),
+		Changelog:  req.Changelog,
+		CreatedBy:  userID,
+	}
+	if err := s.stackRepo.CreateTemplateVersion(version); err != nil {
+		return nil, fmt.Errorf("failed to store template version: %w", err)
+	}
+
+	template.Version = version.Version
+	template.Spec = version.Spec
+	template.Parameters = version.Parameters
+	if req.Description != "" {
+		template.Description = req.Description
+	}
+	if err := s.stackRepo.UpdateTemplate(template); err != nil {
+		return nil, err
+	}
+
+	return s.GetTemplate(ctx, templateID)
+}
+
+func (s *stackService) ListTemplateVersions(ctx context.Context, templateID string) ([]dto.StackTemplateVersionInfo, error) {
+	if _, err := s.stackRepo.FindTemplateByID(templateID); err != nil {
+		return nil, err
 	}
 
+	versions, err := s.stackRepo.FindTemplateVersions(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []dto.StackTemplateVersionInfo{}
+	for _, v := range versions {
+		result = append(result, toStackTemplateVersionInfo(v))
+	}
 	return result, nil
 }
+
+func (s *stackService) GetTemplateVersion(ctx context.Context, templateID string, version int) (*dto.StackTemplateVersionInfo, error) {
+	templateVersion, err := s.stackRepo.FindTemplateVersion(templateID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	info := toStackTemplateVersionInfo(*templateVersion)
+	return &info, nil
+}
+
+func (s *stackService) InstantiateTemplate(ctx context.Context, userID, templateID string, req dto.InstantiateTemplateRequest) (*dto.StackOperationInfo, error) {
+	return s.CreateStack(ctx, userID, dto.CreateStackRequest{
+		Name:            req.Name,
+		Description:     req.Description,
+		Environment:     req.Environment,
+		ProjectID:       req.ProjectID,
+		TenantID:        req.TenantID,
+		Tags:            req.Tags,
+		FromTemplate:    templateID,
+		TemplateVersion: req.Version,
+		Parameters:      req.Parameters,
+	})
+}
+
+// renderTemplate loads a template version, resolves parameter values and returns
+// the rendered resources together with the version used and the masked values
+func (s *stackService) renderTemplate(userID, templateID string, version int, values map[string]interface{}) ([]dto.CreateStackResourceInput, int, map[string]interface{}, error) {
+	template, err := s.stackRepo.FindTemplateByID(templateID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, templateID)
+	}
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to load template: %w", err)
+	}
+	// Private templates of other users are reported as missing rather than forbidden
+	if !template.IsPublic && template.UserID != userID {
+		return nil, 0, nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, templateID)
+	}
+
+	if version == 0 {
+		version = template.Version
+	}
+	templateVersion, err := s.stackRepo.FindTemplateVersion(templateID, version)
+	if err != nil {
+		// Templates created before versioning only carry their latest spec
+		if version != template.Version && errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, 0, nil, fmt.Errorf("%w: version %d of %s", ErrTemplateNotFound, version, templateID)
+		}
+		if version != template.Version {
+			return nil, 0, nil, fmt.Errorf("failed to load template version %d: %w", version, err)
+		}
+		templateVersion = &entities.StackTemplateVersion{
+			TemplateID: template.ID,
+			Version:    template.Version,
+			Parameters: template.Parameters,
+			Spec:       template.Spec,
+		}
+	}
+
+	var params []dto.TemplateParameter
+	json.Unmarshal([]byte(templateVersion.Parameters), &params)
+	var resources []dto.CreateStackResourceInput
+	if err := json.Unmarshal([]byte(templateVersion.Spec), &resources); err != nil {
+		return nil, 0, nil, fmt.Errorf("invalid template spec: %w", err)
+	}
+
+	resolved, err := resolveTemplateParameters(params, values)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	rendered, err := renderTemplateResources(resources, resolved)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	return rendered, version, maskTemplateParameters(params, resolved), nil
+}
+
+func toStackTemplateInfo(t entities.StackTemplate) dto.StackTemplateInfo {
+	var resources []dto.CreateStackResourceInput
+	json.Unmarshal([]byte(t.Spec), &resources)
+	params := []dto.TemplateParameter{}
+	json.Unmarshal([]byte(t.Parameters), &params)
+
+	return dto.StackTemplateInfo{
+		ID:          t.ID,
+		Name:        t.Name,
+		Description: t.Description,
+		Category:    t.Category,
+		IsPublic:    t.IsPublic,
+		UserID:      t.UserID,
+		Version:     t.Version,
+		Parameters:  params,
+		Resources:   resources,
+		CreatedAt:   t.CreatedAt,
+		UpdatedAt:   t.UpdatedAt,
+	}
+}
+
+func toStackTemplateVersionInfo(v entities.StackTemplateVersion) dto.StackTemplateVersionInfo {
+	var resources []dto.CreateStackResourceInput
+	json.Unmarshal([]byte(v.Spec), &resources)
+	params := []dto.TemplateParameter{}
+	json.Unmarshal([]byte(v.Parameters), &params)
+
+	return dto.StackTemplateVersionInfo{
+		TemplateID: v.TemplateID,
+		Version:    v.Version,
+		Changelog:  v.Changelog,
+		CreatedBy:  v.CreatedBy,
+		Parameters: params,
+		Resources:  resources,
+		CreatedAt:  v.CreatedAt,
+	}
+}
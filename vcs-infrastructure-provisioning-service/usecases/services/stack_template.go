@@ -0,0 +1,315 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+)
+
+// Placeholders inside template resource specs look like ${params.db_password}
+var (
+	templateParamPattern     = regexp.MustCompile(`\$\{params\.([A-Za-z_][A-Za-z0-9_]*)\}`)
+	templateParamNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+const maskedSecretValue = "****"
+
+var (
+	// ErrTemplateNotFound is returned for templates and template versions the user cannot use
+	ErrTemplateNotFound = errors.New("stack template not found")
+	// ErrInvalidTemplateParameters is returned when parameter values do not satisfy the template
+	ErrInvalidTemplateParameters = errors.New("invalid template parameters")
+)
+
+// validateTemplateDefinition checks parameter declarations and makes sure every
+// placeholder used in the resources refers to a declared parameter
+func validateTemplateDefinition(params []dto.TemplateParameter, resources []dto.CreateStackResourceInput) error {
+	declared := make(map[string]dto.TemplateParameter, len(params))
+	for _, p := range params {
+		if !templateParamNamePattern.MatchString(p.Name) {
+			return fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		if _, exists := declared[p.Name]; exists {
+			return fmt.Errorf("duplicate parameter %q", p.Name)
+		}
+
+		switch p.Type {
+		case dto.TemplateParamString, dto.TemplateParamSecret:
+			if p.Pattern != "" {
+				if _, err := regexp.Compile(p.Pattern); err != nil {
+					return fmt.Errorf("parameter %q has invalid pattern: %w", p.Name, err)
+				}
+			}
+		case dto.TemplateParamInt:
+			if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+				return fmt.Errorf("parameter %q has min greater than max", p.Name)
+			}
+		case dto.TemplateParamEnum:
+			if len(p.AllowedValues) == 0 {
+				return fmt.Errorf("enum parameter %q requires allowed_values", p.Name)
+			}
+		default:
+			return fmt.Errorf("parameter %q has unsupported type %q", p.Name, p.Type)
+		}
+
+		if p.Default != nil {
+			if p.Type == dto.TemplateParamSecret {
+				return fmt.Errorf("secret parameter %q cannot have a default", p.Name)
+			}
+			if _, err := coerceTemplateParameter(p, p.Default); err != nil {
+				return fmt.Errorf("invalid default: %w", err)
+			}
+		}
+		declared[p.Name] = p
+	}
+
+	for _, res := range resources {
+		for _, name := range collectTemplateReferences(res) {
+			if _, ok := declared[name]; !ok {
+				return fmt.Errorf("resource %s references undeclared parameter %q", res.Name, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolveTemplateParameters applies defaults and validates the supplied values
+// against the parameter declarations
+func resolveTemplateParameters(params []dto.TemplateParameter, values map[string]interface{}) (map[string]interface{}, error) {
+	declared := make(map[string]bool, len(params))
+	resolved := make(map[string]interface{}, len(params))
+
+	for _, p := range params {
+		declared[p.Name] = true
+
+		raw, supplied := values[p.Name]
+		if !supplied || raw == nil {
+			if p.Default != nil {
+				raw = p.Default
+			} else if p.Required {
+				return nil, fmt.Errorf("%w: missing required parameter %q", ErrInvalidTemplateParameters, p.Name)
+			} else {
+				// Optional parameters without a default render as their zero value
+				if p.Type == dto.TemplateParamInt {
+					resolved[p.Name] = 0
+				} else {
+					resolved[p.Name] = ""
+				}
+				continue
+			}
+		}
+
+		value, err := coerceTemplateParameter(p, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidTemplateParameters, err)
+		}
+		resolved[p.Name] = value
+	}
+
+	for name := range values {
+		if !declared[name] {
+			return nil, fmt.Errorf("%w: unknown parameter %q", ErrInvalidTemplateParameters, name)
+		}
+	}
+
+	return resolved, nil
+}
+
+func coerceTemplateParameter(p dto.TemplateParameter, raw interface{}) (interface{}, error) {
+	switch p.Type {
+	case dto.TemplateParamInt:
+		var n int
+		switch v := raw.(type) {
+		case int:
+			n = v
+		case int64:
+			n = int(v)
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("parameter %q must be an integer", p.Name)
+			}
+			n = int(v)
+		case string:
+			parsed, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %q must be an integer", p.Name)
+			}
+			n = parsed
+		default:
+			return nil, fmt.Errorf("parameter %q must be an integer", p.Name)
+		}
+		if p.Min != nil && n < *p.Min {
+			return nil, fmt.Errorf("parameter %q must be >= %d", p.Name, *p.Min)
+		}
+		if p.Max != nil && n > *p.Max {
+			return nil, fmt.Errorf("parameter %q must be <= %d", p.Name, *p.Max)
+		}
+		return n, nil
+
+	case dto.TemplateParamEnum:
+		v, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("parameter %q must be a string", p.Name)
+		}
+		for _, allowed := range p.AllowedValues {
+			if v == allowed {
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("parameter %q must be one of %v", p.Name, p.AllowedValues)
+
+	default: // string, secret
+		v, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("parameter %q must be a string", p.Name)
+		}
+		if p.Pattern != "" {
+			re, err := regexp.Compile(p.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %q has invalid pattern: %w", p.Name, err)
+			}
+			if !re.MatchString(v) {
+				return nil, fmt.Errorf("parameter %q does not match pattern %s", p.Name, p.Pattern)
+			}
+		}
+		return v, nil
+	}
+}
+
+// renderTemplateResources substitutes ${params.*} placeholders in resource names,
+// dependencies and specs. A string that consists of a single placeholder is
+// replaced by the typed value so int parameters stay numbers in the spec.
+func renderTemplateResources(resources []dto.CreateStackResourceInput, values map[string]interface{}) ([]dto.CreateStackResourceInput, error) {
+	rendered := make([]dto.CreateStackResourceInput, 0, len(resources))
+
+	for _, res := range resources {
+		name, err := renderTemplateString(res.Name, values)
+		if err != nil {
+			return nil, err
+		}
+		out := res
+		out.Name = fmt.Sprint(name)
+
+		out.DependsOn = make([]string, 0, len(res.DependsOn))
+		for _, dep := range res.DependsOn {
+			v, err := renderTemplateString(dep, values)
+			if err != nil {
+				return nil, err
+			}
+			out.DependsOn = append(out.DependsOn, fmt.Sprint(v))
+		}
+
+		spec, err := renderTemplateValue(res.Spec, values)
+		if err != nil {
+			return nil, fmt.Errorf("resource %s: %w", res.Name, err)
+		}
+		out.Spec, _ = spec.(map[string]interface{})
+
+		rendered = append(rendered, out)
+	}
+
+	return rendered, nil
+}
+
+func renderTemplateValue(value interface{}, values map[string]interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			rendered, err := renderTemplateValue(item, values)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			rendered, err := renderTemplateValue(item, values)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, rendered)
+		}
+		return out, nil
+	case string:
+		return renderTemplateString(v, values)
+	default:
+		return v, nil
+	}
+}
+
+func renderTemplateString(s string, values map[string]interface{}) (interface{}, error) {
+	if m := templateParamPattern.FindStringSubmatch(s); m != nil && m[0] == s {
+		value, ok := values[m[1]]
+		if !ok {
+			return nil, fmt.Errorf("undefined parameter %q", m[1])
+		}
+		return value, nil
+	}
+
+	var missing string
+	out := templateParamPattern.ReplaceAllStringFunc(s, func(match string) string {
+		name := templateParamPattern.FindStringSubmatch(match)[1]
+		value, ok := values[name]
+		if !ok {
+			missing = name
+			return match
+		}
+		return fmt.Sprint(value)
+	})
+	if missing != "" {
+		return nil, fmt.Errorf("undefined parameter %q", missing)
+	}
+	return out, nil
+}
+
+func collectTemplateReferences(res dto.CreateStackResourceInput) []string {
+	var names []string
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case string:
+			for _, m := range templateParamPattern.FindAllStringSubmatch(v, -1) {
+				names = append(names, m[1])
+			}
+		}
+	}
+
+	walk(res.Name)
+	for _, dep := range res.DependsOn {
+		walk(dep)
+	}
+	walk(res.Spec)
+	return names
+}
+
+// maskTemplateParameters returns the resolved values with secret parameters hidden
+func maskTemplateParameters(params []dto.TemplateParameter, values map[string]interface{}) map[string]interface{} {
+	masked := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		masked[name] = value
+	}
+	for _, p := range params {
+		if p.Type == dto.TemplateParamSecret {
+			if _, ok := masked[p.Name]; ok {
+				masked[p.Name] = maskedSecretValue
+			}
+		}
+	}
+	return masked
+}
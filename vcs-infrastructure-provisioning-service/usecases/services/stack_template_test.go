@@ -0,0 +1,170 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/dto"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/entities"
+	"github.com/PhucNguyen204/vcs-infrastructure-provisioning-service/usecases/repositories"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func intPtr(v int) *int { return &v }
+
+func testTemplateParameters() []dto.TemplateParameter {
+	return []dto.TemplateParameter{
+		{Name: "app_name", Type: dto.TemplateParamString, Required: true, Pattern: "^[a-z][a-z0-9-]*$"},
+		{Name: "replicas", Type: dto.TemplateParamInt, Default: float64(2), Min: intPtr(1), Max: intPtr(5)},
+		{Name: "tier", Type: dto.TemplateParamEnum, Default: "small", AllowedValues: []string{"small", "large"}},
+		{Name: "db_password", Type: dto.TemplateParamSecret, Required: true},
+	}
+}
+
+func testTemplateResources() []dto.CreateStackResourceInput {
+	return []dto.CreateStackResourceInput{
+		{
+			Type: "POSTGRES_CLUSTER",
+			Name: "${params.app_name}-db",
+			Spec: map[string]interface{}{
+				"node_count":          "${params.replicas}",
+				"postgresql_password": "${params.db_password}",
+			},
+		},
+		{
+			Type:      "DOCKER_SERVICE",
+			Name:      "${params.app_name}-api",
+			DependsOn: []string{"${params.app_name}-db"},
+			Spec: map[string]interface{}{
+				"plan": "${params.tier}",
+				"env_vars": []interface{}{
+					map[string]interface{}{"key": "APP", "value": "app-${params.app_name}"},
+				},
+			},
+		},
+	}
+}
+
+func TestValidateTemplateDefinition(t *testing.T) {
+	assert.NoError(t, validateTemplateDefinition(testTemplateParameters(), testTemplateResources()))
+
+	err := validateTemplateDefinition(testTemplateParameters()[:1], testTemplateResources())
+	assert.ErrorContains(t, err, "undeclared parameter")
+
+	err = validateTemplateDefinition([]dto.TemplateParameter{{Name: "size", Type: dto.TemplateParamEnum}}, nil)
+	assert.ErrorContains(t, err, "allowed_values")
+
+	err = validateTemplateDefinition([]dto.TemplateParameter{{Name: "port", Type: dto.TemplateParamInt, Default: "abc"}}, nil)
+	assert.ErrorContains(t, err, "invalid default")
+
+	err = validateTemplateDefinition([]dto.TemplateParameter{{Name: "bad-name", Type: dto.TemplateParamString}}, nil)
+	assert.ErrorContains(t, err, "invalid parameter name")
+}
+
+func TestResolveTemplateParameters(t *testing.T) {
+	params := testTemplateParameters()
+
+	resolved, err := resolveTemplateParameters(params, map[string]interface{}{
+		"app_name":    "shop",
+		"db_password": "s3cret",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, resolved["replicas"])
+	assert.Equal(t, "small", resolved["tier"])
+
+	_, err = resolveTemplateParameters(params, map[string]interface{}{"app_name": "shop"})
+	assert.ErrorContains(t, err, "missing required parameter \"db_password\"")
+
+	_, err = resolveTemplateParameters(params, map[string]interface{}{
+		"app_name": "shop", "db_password": "x", "replicas": float64(9),
+	})
+	assert.ErrorContains(t, err, "must be <= 5")
+
+	_, err = resolveTemplateParameters(params, map[string]interface{}{
+		"app_name": "Shop!", "db_password": "x",
+	})
+	assert.ErrorContains(t, err, "does not match pattern")
+
+	_, err = resolveTemplateParameters(params, map[string]interface{}{
+		"app_name": "shop", "db_password": "x", "tier": "huge",
+	})
+	assert.ErrorContains(t, err, "must be one of")
+
+	_, err = resolveTemplateParameters(params, map[string]interface{}{
+		"app_name": "shop", "db_password": "x", "region": "eu",
+	})
+	assert.ErrorContains(t, err, "unknown parameter")
+	assert.ErrorIs(t, err, ErrInvalidTemplateParameters)
+}
+
+// templateRepo serves one private template of user-1 whose only stored version is 2; other
+// calls panic
+type templateRepo struct {
+	repositories.IStackRepository
+}
+
+func (templateRepo) FindTemplateByID(id string) (*entities.StackTemplate, error) {
+	if id != "tpl-1" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &entities.StackTemplate{ID: "tpl-1", UserID: "user-1", Version: 2}, nil
+}
+
+func (templateRepo) FindTemplateVersion(templateID string, version int) (*entities.StackTemplateVersion, error) {
+	if version != 2 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	params, _ := json.Marshal(testTemplateParameters())
+	return &entities.StackTemplateVersion{TemplateID: templateID, Version: 2, Parameters: string(params), Spec: "[]"}, nil
+}
+
+func TestRenderTemplateErrors(t *testing.T) {
+	s := &stackService{stackRepo: templateRepo{}}
+	valid := map[string]interface{}{"app_name": "shop", "db_password": "x"}
+
+	_, version, _, err := s.renderTemplate("user-1", "tpl-1", 0, valid)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	// Missing templates, other users' private templates and unknown versions all read as not found
+	_, _, _, err = s.renderTemplate("user-1", "tpl-2", 0, valid)
+	assert.ErrorIs(t, err, ErrTemplateNotFound)
+	_, _, _, err = s.renderTemplate("user-2", "tpl-1", 0, valid)
+	assert.ErrorIs(t, err, ErrTemplateNotFound)
+	_, _, _, err = s.renderTemplate("user-1", "tpl-1", 1, valid)
+	assert.ErrorIs(t, err, ErrTemplateNotFound)
+
+	_, _, _, err = s.renderTemplate("user-1", "tpl-1", 0, map[string]interface{}{"app_name": "shop", "db_password": "x", "replicas": "two"})
+	assert.ErrorIs(t, err, ErrInvalidTemplateParameters)
+	assert.ErrorContains(t, err, "must be an integer")
+}
+
+func TestRenderTemplateResources(t *testing.T) {
+	resolved, err := resolveTemplateParameters(testTemplateParameters(), map[string]interface{}{
+		"app_name":    "shop",
+		"replicas":    float64(3),
+		"db_password": "s3cret",
+	})
+	assert.NoError(t, err)
+
+	rendered, err := renderTemplateResources(testTemplateResources(), resolved)
+	assert.NoError(t, err)
+	assert.Len(t, rendered, 2)
+
+	assert.Equal(t, "shop-db", rendered[0].Name)
+	assert.Equal(t, 3, rendered[0].Spec["node_count"])
+	assert.Equal(t, "s3cret", rendered[0].Spec["postgresql_password"])
+
+	assert.Equal(t, "shop-api", rendered[1].Name)
+	assert.Equal(t, []string{"shop-db"}, rendered[1].DependsOn)
+	envVars := rendered[1].Spec["env_vars"].([]interface{})
+	assert.Equal(t, "app-shop", envVars[0].(map[string]interface{})["value"])
+
+	// The template itself must not be modified by rendering
+	assert.Equal(t, "${params.app_name}-db", testTemplateResources()[0].Name)
+
+	masked := maskTemplateParameters(testTemplateParameters(), resolved)
+	assert.Equal(t, maskedSecretValue, masked["db_password"])
+	assert.Equal(t, "shop", masked["app_name"])
+}